@@ -0,0 +1,53 @@
+import { useEffect, useRef, useState } from "react";
+import { getApiBase } from "@/api";
+
+type LogEntry = { offset: number; stream: string; content: string };
+
+/** 通过 /api/jobs/:id/logs/stream 实时展示 job 日志；EventSource 断线重连时自动带 Last-Event-ID 续传 */
+export function JobLogStream({ jobId }: { jobId: string }) {
+  const [entries, setEntries] = useState<LogEntry[]>([]);
+  const [ended, setEnded] = useState<string | null>(null);
+  const boxRef = useRef<HTMLPreElement | null>(null);
+
+  useEffect(() => {
+    setEntries([]);
+    setEnded(null);
+    const url = (getApiBase() || "") + `/api/jobs/${encodeURIComponent(jobId)}/logs/stream?offset=0`;
+    const es = new EventSource(url, { withCredentials: true });
+    es.addEventListener("log", (e: MessageEvent) => {
+      try {
+        const entry = JSON.parse(e.data) as LogEntry;
+        setEntries((prev) => [...prev, entry]);
+      } catch {
+        // ignore
+      }
+    });
+    es.addEventListener("end", (e: MessageEvent) => {
+      try {
+        setEnded((JSON.parse(e.data) as { status: string }).status || "finished");
+      } catch {
+        setEnded("finished");
+      }
+      es.close();
+    });
+    return () => es.close();
+  }, [jobId]);
+
+  useEffect(() => {
+    if (boxRef.current) boxRef.current.scrollTop = boxRef.current.scrollHeight;
+  }, [entries]);
+
+  return (
+    <div className="mt-2">
+      <pre
+        ref={boxRef}
+        className="max-h-64 overflow-auto whitespace-pre-wrap rounded bg-slate-900 p-2 font-mono text-xs text-slate-100"
+      >
+        {entries.length === 0 ? "等待日志…" : entries.map((e) => (
+          <span key={e.offset} className={e.stream === "stderr" ? "text-red-300" : undefined}>{e.content}</span>
+        ))}
+      </pre>
+      {ended && <p className="mt-1 text-xs text-slate-500 dark:text-slate-400">job 已结束：{ended}</p>}
+    </div>
+  );
+}
@@ -19,6 +19,7 @@ import {
   type TaskDetail,
 } from "@/api";
 import { useSSE } from "@/useSSE";
+import { JobLogStream } from "@/components/jobs/JobLogStream";
 
 const STATUSES = ["plan", "pending", "in_progress", "review", "testing", "done", "failed"] as const;
 
@@ -27,6 +28,7 @@ export function TaskDetail() {
   const [task, setTask] = useState<TaskDetail | null>(null);
   const [loading, setLoading] = useState(true);
   const [tab, setTab] = useState<"canonical" | "messages" | "legacy-runs" | "legacy-artifacts">("canonical");
+  const [openLogJobId, setOpenLogJobId] = useState<string | null>(null);
   const [dispatchPreview, setDispatchPreview] = useState<Record<string, unknown> | null>(null);
   const [dispatchResult, setDispatchResult] = useState<StepRunDispatchResult | null>(null);
   const [workflowErr, setWorkflowErr] = useState<string>("");
@@ -48,7 +50,7 @@ export function TaskDetail() {
     load();
   };
 
-  const currentStep = task?.currentStep ?? task?.step_runs?.find((sr) => sr.status === "ready" || sr.status === "running" || sr.status === "pending_unassigned");
+  const currentStep = task?.currentStep ?? task?.step_runs?.find((sr) => sr.status === "ready" || sr.status === "queued" || sr.status === "running" || sr.status === "pending_unassigned");
 
   const startCurrentStep = async () => {
     if (!currentStep?.id) return;
@@ -203,6 +205,10 @@ export function TaskDetail() {
                         <p><span className="font-mono">{j.id}</span> · {j.status}</p>
                         <p className="text-xs text-slate-600 dark:text-slate-400">StepRun: #{j.stepRunOrder ?? "-"} {j.stepRunName || j.stepRunId}</p>
                         <p className="text-xs text-slate-500 dark:text-slate-400">Backend: {j.executionBackendId || "-"} · ExternalRef: {j.externalJobRef || "-"}</p>
+                        <Button size="sm" variant="outline" className="mt-1" onClick={() => setOpenLogJobId(openLogJobId === j.id ? null : j.id)}>
+                          {openLogJobId === j.id ? "隐藏日志" : "查看日志"}
+                        </Button>
+                        {openLogJobId === j.id && <JobLogStream jobId={j.id} />}
                       </div>
                     ))}
                   </div>
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// errLeaseLost means the console no longer considers the job ours: it was
+// cancelled, finished or requeued after our lease expired.
+var errLeaseLost = errors.New("job lease lost")
+
+// errGitOperationRefused means branch protection does not allow a git
+// operation of the job, or holds it for approval.
+var errGitOperationRefused = errors.New("refused by branch protection")
+
+// errUnauthorized means the console refused our credential or enrollment
+// token: it was revoked, rotated out, expired or already used.
+var errUnauthorized = errors.New("runner unauthorized")
+
+// Client talks to the console runner API. Credential is the runner-scoped
+// credential obtained by enrolling.
+type Client struct {
+	BaseURL    string
+	Credential string
+	HTTP       *http.Client
+}
+
+// Info is what the runner reports about itself.
+type Info struct {
+	Name    string         `json:"name"`
+	Version string         `json:"version"`
+	Host    map[string]any `json:"host"`
+}
+
+// Lease is a claimed job.
+type Lease struct {
+	JobID          string  `json:"job_id"`
+	RunnerID       string  `json:"runner_id"`
+	Attempt        int     `json:"attempt"`
+	LeaseExpiresAt string  `json:"lease_expires_at"`
+	LeaseSeconds   int     `json:"lease_seconds"`
+	Request        Request `json:"request"`
+}
+
+// Request is the part of the prepared dispatch the runner uses.
+type Request struct {
+	JobID         string         `json:"job_id"`
+	WorkflowRunID string         `json:"workflow_run_id"`
+	StepRunID     string         `json:"step_run_id"`
+	Step          map[string]any `json:"step"`
+	Workspace     map[string]any `json:"workspace"`
+	Input         any            `json:"input"`
+}
+
+// LogChunk is a piece of job output.
+type LogChunk struct {
+	Stream  string `json:"stream"`
+	Content string `json:"content"`
+}
+
+// Result is the final report of a job.
+type Result struct {
+	Status string         `json:"status"`
+	Output map[string]any `json:"output"`
+}
+
+// credentialReply is returned by enrollment and rotation.
+type credentialReply struct {
+	Item struct {
+		ID string `json:"id"`
+	} `json:"item"`
+	Credential string `json:"credential"`
+}
+
+// Enroll exchanges a one-time enrollment token for a runner id and credential.
+func (c *Client) Enroll(ctx context.Context, token string, info Info) (string, string, error) {
+	var out credentialReply
+	body := map[string]any{"enrollment_token": token, "name": info.Name, "version": info.Version, "host": info.Host}
+	if _, err := c.call(ctx, http.MethodPost, "/api/runners/register", body, &out); err != nil {
+		return "", "", err
+	}
+	return out.Item.ID, out.Credential, nil
+}
+
+// Rotate replaces the runner's credential and returns the new one; the
+// current credential stops working.
+func (c *Client) Rotate(ctx context.Context, runnerID string) (string, error) {
+	var out credentialReply
+	if _, err := c.call(ctx, http.MethodPost, "/api/runners/"+url.PathEscape(runnerID)+"/rotate", map[string]any{}, &out); err != nil {
+		return "", err
+	}
+	return out.Credential, nil
+}
+
+// UpdateInfo reports the runner's version and host.
+func (c *Client) UpdateInfo(ctx context.Context, runnerID string, info Info) error {
+	_, err := c.call(ctx, http.MethodPut, "/api/runners/"+url.PathEscape(runnerID)+"/info", info, nil)
+	return err
+}
+
+// Claim long-polls for a job for up to wait; it returns nil when none arrived.
+func (c *Client) Claim(ctx context.Context, runnerID string, wait time.Duration) (*Lease, error) {
+	var out struct {
+		Item *Lease `json:"item"`
+	}
+	path := "/api/runners/" + url.PathEscape(runnerID) + "/claim?wait=" + strconv.Itoa(int(wait/time.Second))
+	status, err := c.call(ctx, http.MethodPost, path, nil, &out)
+	if err != nil || status == http.StatusNoContent {
+		return nil, err
+	}
+	return out.Item, nil
+}
+
+// Heartbeat extends the lease of a job.
+func (c *Client) Heartbeat(ctx context.Context, runnerID, jobID string) error {
+	_, err := c.call(ctx, http.MethodPost, c.jobPath(runnerID, jobID, "heartbeat"), map[string]any{}, nil)
+	return err
+}
+
+// Logs appends output to a job's log.
+func (c *Client) Logs(ctx context.Context, runnerID, jobID string, chunks []LogChunk) error {
+	_, err := c.call(ctx, http.MethodPost, c.jobPath(runnerID, jobID, "logs"), map[string]any{"logs": chunks}, nil)
+	return err
+}
+
+// Upload streams an artifact file of kind to the console.
+func (c *Client) Upload(ctx context.Context, runnerID, jobID, kind, name string, body io.Reader) error {
+	q := url.Values{"kind": {kind}, "name": {name}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+c.jobPath(runnerID, jobID, "artifacts")+"?"+q.Encode(), body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	_, err = c.do(req, nil)
+	return err
+}
+
+// Report closes a job with its final result.
+func (c *Client) Report(ctx context.Context, runnerID, jobID string, res Result) error {
+	_, err := c.call(ctx, http.MethodPost, c.jobPath(runnerID, jobID, "result"), res, nil)
+	return err
+}
+
+// GitOperation is a branch update of a job the console checks against its
+// workspace's branch protection. Observed marks an update a step command
+// already made; otherwise the runner is about to make it.
+type GitOperation struct {
+	Operation string `json:"operation"`
+	Branch    string `json:"branch"`
+	Observed  bool   `json:"observed"`
+}
+
+// CheckGitOperation asks the console whether op may go ahead. A refusal,
+// including one that waits for approval, wraps errGitOperationRefused.
+func (c *Client) CheckGitOperation(ctx context.Context, runnerID, jobID string, op GitOperation) error {
+	var out struct {
+		Item struct {
+			Decision string `json:"decision"`
+		} `json:"item"`
+		Error string `json:"error"`
+	}
+	if _, err := c.call(ctx, http.MethodPost, c.jobPath(runnerID, jobID, "git-operations"), op, &out); err != nil {
+		return err
+	}
+	if out.Item.Decision != "allowed" {
+		msg := out.Error
+		if msg == "" {
+			msg = fmt.Sprintf("%s to branch %q is %s", op.Operation, op.Branch, out.Item.Decision)
+		}
+		return fmt.Errorf("%w: %s", errGitOperationRefused, msg)
+	}
+	return nil
+}
+
+func (c *Client) jobPath(runnerID, jobID, action string) string {
+	return "/api/runners/" + url.PathEscape(runnerID) + "/jobs/" + url.PathEscape(jobID) + "/" + action
+}
+
+func (c *Client) call(ctx context.Context, method, path string, body, out any) (int, error) {
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return 0, err
+		}
+		r = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, r)
+	if err != nil {
+		return 0, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return c.do(req, out)
+}
+
+func (c *Client) do(req *http.Request, out any) (int, error) {
+	if c.Credential != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Credential)
+	}
+	hc := c.HTTP
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		_ = json.Unmarshal(data, &apiErr)
+		msg := apiErr.Error
+		if msg == "" {
+			msg = strings.TrimSpace(string(data))
+		}
+		switch resp.StatusCode {
+		case http.StatusConflict:
+			return resp.StatusCode, fmt.Errorf("%w: %s", errLeaseLost, msg)
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return resp.StatusCode, fmt.Errorf("%w: %s", errUnauthorized, msg)
+		}
+		return resp.StatusCode, fmt.Errorf("%s %s: %d %s", req.Method, req.URL.Path, resp.StatusCode, msg)
+	}
+	if out != nil && resp.StatusCode != http.StatusNoContent && len(data) > 0 {
+		if err := json.Unmarshal(data, out); err != nil {
+			return resp.StatusCode, err
+		}
+	}
+	return resp.StatusCode, nil
+}
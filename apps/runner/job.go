@@ -0,0 +1,581 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PonyDevAI/Bull-Board/pkg/gitrefs"
+	"github.com/PonyDevAI/Bull-Board/pkg/patches"
+	"github.com/PonyDevAI/Bull-Board/pkg/sandbox"
+)
+
+// On-conflict policies for a patch that does not apply.
+const (
+	onConflictFail     = "fail"
+	onConflictContinue = "continue"
+)
+
+var errPatchNotApplied = errors.New("patch did not apply")
+
+// StepSpec is the work a step performs, read from the step template config
+// and overridden by the step run input. Phases run in order: patch,
+// commands, verify, commit. TestReports are uploaded once the phases end,
+// whether or not they succeeded. Commands run under Sandbox.
+//
+// A patch that does not apply strictly is merged 3-way; if that conflicts
+// too, OnConflict "fail" (the default) fails the step and "continue" ends
+// it successfully after the patch phase, as the local backend does.
+type StepSpec struct {
+	Patch       string           `json:"patch"`
+	OnConflict  string           `json:"on_conflict"`
+	Commands    []string         `json:"commands"`
+	Verify      []string         `json:"verify"`
+	Commit      *CommitSpec      `json:"commit"`
+	TestReports []TestReportSpec `json:"test_reports"`
+	Sandbox     sandbox.Config   `json:"-"`
+}
+
+type CommitSpec struct {
+	Message string `json:"message"`
+}
+
+// TestReportSpec names test report files as a worktree-relative path or
+// glob; a plain string is read as the path. Uploads carry no format, so the
+// console detects it from the content.
+type TestReportSpec struct {
+	Path   string `json:"path"`
+	Format string `json:"format"`
+}
+
+func (t *TestReportSpec) UnmarshalJSON(b []byte) error {
+	if len(b) > 0 && b[0] == '"' {
+		*t = TestReportSpec{}
+		return json.Unmarshal(b, &t.Path)
+	}
+	type plain TestReportSpec
+	return json.Unmarshal(b, (*plain)(t))
+}
+
+// parseStepSpec merges the step template config with the step run input; input keys win.
+func parseStepSpec(step map[string]any, input any) (StepSpec, error) {
+	merged := map[string]any{}
+	cfg, _ := step["config"].(map[string]any)
+	if cfg != nil {
+		for k, v := range cfg {
+			merged[k] = v
+		}
+	}
+	if in, ok := input.(map[string]any); ok {
+		for k, v := range in {
+			merged[k] = v
+		}
+	}
+	raw, err := json.Marshal(merged)
+	if err != nil {
+		return StepSpec{}, err
+	}
+	var spec StepSpec
+	if err := json.Unmarshal(raw, &spec); err != nil {
+		return StepSpec{}, fmt.Errorf("invalid step spec: %w", err)
+	}
+	switch spec.OnConflict {
+	case "", onConflictFail, onConflictContinue:
+	default:
+		return StepSpec{}, fmt.Errorf("invalid step spec: on_conflict must be %q or %q", onConflictFail, onConflictContinue)
+	}
+	// Limits come from the step template only so run input cannot loosen them.
+	if spec.Sandbox, err = sandbox.FromStepConfig(cfg); err != nil {
+		return StepSpec{}, err
+	}
+	return spec, nil
+}
+
+// logStream keeps the full job output and ships it to the console in batches.
+type logStream struct {
+	mu      sync.Mutex
+	all     bytes.Buffer
+	pending bytes.Buffer
+}
+
+func (l *logStream) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.all.Write(p)
+	l.pending.Write(p)
+	return len(p), nil
+}
+
+// take returns and clears the output not yet shipped.
+func (l *logStream) take() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	s := l.pending.String()
+	l.pending.Reset()
+	return s
+}
+
+func (l *logStream) bytes() []byte {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]byte(nil), l.all.Bytes()...)
+}
+
+// runLease executes a claimed job: it heartbeats and ships logs while the
+// step runs, uploads the job files and reports the result. A lost lease
+// cancels the work and nothing further is reported.
+func (r *Runner) runLease(ctx context.Context, lease *Lease) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	job := lease.JobID
+	logs := &logStream{}
+	var lost bool
+	var lostMu sync.Mutex
+	markLost := func(err error) {
+		if errors.Is(err, errLeaseLost) {
+			lostMu.Lock()
+			lost = true
+			lostMu.Unlock()
+			cancel()
+		}
+	}
+	flush := func(ctx context.Context) {
+		if s := logs.take(); s != "" {
+			if err := r.client.Logs(ctx, r.id, job, []LogChunk{{Stream: "stdout", Content: s}}); err != nil {
+				markLost(err)
+				r.logf("job %s: ship logs: %v", job, err)
+			}
+		}
+	}
+
+	interval := time.Duration(lease.LeaseSeconds) * time.Second / 3
+	if interval <= 0 {
+		interval = 20 * time.Second
+	}
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		beat := time.NewTicker(interval)
+		ship := time.NewTicker(r.cfg.LogFlushInterval)
+		defer beat.Stop()
+		defer ship.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ship.C:
+				flush(ctx)
+			case <-beat.C:
+				if err := r.client.Heartbeat(ctx, r.id, job); err != nil {
+					markLost(err)
+					r.logf("job %s: heartbeat: %v", job, err)
+				}
+			}
+		}
+	}()
+
+	res, files := r.execute(ctx, lease.Request, logs)
+	close(done)
+	wg.Wait()
+
+	lostMu.Lock()
+	isLost := lost
+	lostMu.Unlock()
+	if isLost {
+		r.logf("job %s: lease lost, abandoning", job)
+		return
+	}
+	// Finish shipping on a fresh context: the job's own may be cancelled.
+	bg := context.Background()
+	flush(bg)
+	for _, f := range files {
+		if err := r.uploadFile(bg, job, f.kind, f.path); err != nil {
+			r.logf("job %s: upload %s: %v", job, f.kind, err)
+		}
+	}
+	if err := r.client.Report(bg, r.id, job, res); err != nil {
+		r.logf("job %s: report: %v", job, err)
+		return
+	}
+	r.logf("job %s: %s", job, res.Status)
+}
+
+type jobFile struct{ kind, path string }
+
+func (r *Runner) uploadFile(ctx context.Context, jobID, kind, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return r.client.Upload(ctx, r.id, jobID, kind, filepath.Base(path), f)
+}
+
+// execute runs the step spec in the workflow run's worktree and writes the
+// job files (execution log, diff, report) to the job directory.
+func (r *Runner) execute(ctx context.Context, req Request, logs *logStream) (Result, []jobFile) {
+	output := map[string]any{}
+	fail := func(phase string, err error) (Result, []jobFile) {
+		output["error"] = err.Error()
+		output["phase"] = phase
+		fmt.Fprintf(logs, "!! %s failed: %v\n", phase, err)
+		return Result{Status: "failed", Output: output}, nil
+	}
+	spec, err := parseStepSpec(req.Step, req.Input)
+	if err != nil {
+		return fail("prepare", err)
+	}
+	worktree, branch, err := r.worktree(ctx, req)
+	if err != nil {
+		return fail("prepare", err)
+	}
+	jobDir := filepath.Join(r.cfg.WorkDir, "jobs", req.JobID)
+	if err := os.MkdirAll(jobDir, 0755); err != nil {
+		return fail("prepare", err)
+	}
+	sh, err := sandbox.NewShell(req.JobID, req.WorkflowRunID, req.StepRunID, spec.Sandbox)
+	if err != nil {
+		return fail("prepare", err)
+	}
+	defer sh.Close()
+	output["branch"] = branch
+	output["worktree_path"] = worktree
+	output["sandbox"] = spec.Sandbox
+
+	// Commands here run without git hooks, so the console checks the
+	// branches they moved once each ends, and the commit before it is made.
+	check := func(ctx context.Context, op GitOperation) error {
+		return r.client.CheckGitOperation(ctx, r.id, req.JobID, op)
+	}
+	sh.AddGuard(&refGuard{dir: worktree, worktrees: filepath.Join(r.cfg.WorkDir, "worktrees"), mu: &r.wtMu, check: check})
+	run := &specRun{sh: sh, logs: logs, branch: branch, check: check}
+	phase, runErr := run.execute(ctx, spec, worktree, jobDir, req)
+	commands := run.commands
+	output["commands"] = commands
+	limitHit := ""
+	if n := len(commands); runErr != nil && n > 0 {
+		limitHit = commands[n-1].LimitHit
+	}
+	status := "succeeded"
+	if runErr != nil {
+		status = "failed"
+		output["error"] = runErr.Error()
+		output["phase"] = phase
+		if limitHit != "" {
+			output["limit_hit"] = limitHit
+		}
+		fmt.Fprintf(logs, "!! %s failed: %v\n", phase, runErr)
+	} else if run.patch != nil && !run.patch.Applied {
+		output["summary"] = run.patch.Summary
+	} else {
+		output["summary"] = fmt.Sprintf("%d command(s) succeeded", len(commands))
+	}
+	if run.patch != nil {
+		output["patch"] = run.patch
+	}
+	output["head"] = headCommit(ctx, worktree)
+
+	diff, _ := git(ctx, worktree, "diff", "--cached", "HEAD")
+	if diff == "" {
+		diff, _ = git(ctx, worktree, "show", "--format=", "HEAD")
+	}
+	reports := testReportFiles(spec.TestReports, worktree, logs)
+	report, _ := json.MarshalIndent(map[string]any{"commands": commands, "sandbox": spec.Sandbox, "limit_hit": limitHit}, "", "  ")
+	written := []struct {
+		kind, name string
+		data       []byte
+	}{
+		{"execution_log", "execution.log", logs.bytes()},
+		{"diff", "diff.patch", []byte(diff)},
+		{"report", "report.json", report},
+	}
+	if run.patch != nil {
+		data, _ := json.MarshalIndent(run.patch, "", "  ")
+		written = append(written, struct {
+			kind, name string
+			data       []byte
+		}{"patch_report", "patch-report.json", data})
+	}
+	var files []jobFile
+	for _, f := range written {
+		path := filepath.Join(jobDir, f.name)
+		if err := os.WriteFile(path, f.data, 0644); err != nil {
+			r.logf("job %s: write %s: %v", req.JobID, f.name, err)
+			continue
+		}
+		files = append(files, jobFile{kind: f.kind, path: path})
+	}
+	files = append(files, reports...)
+	return Result{Status: status, Output: output}, files
+}
+
+// testReportFiles resolves the step's test report paths inside the worktree.
+func testReportFiles(specs []TestReportSpec, worktree string, logs *logStream) []jobFile {
+	var files []jobFile
+	root, err := filepath.EvalSymlinks(worktree)
+	if err != nil {
+		fmt.Fprintf(logs, "-- test reports: %v\n", err)
+		return nil
+	}
+	seen := map[string]bool{}
+	for _, spec := range specs {
+		pattern := filepath.Clean(spec.Path)
+		if spec.Path == "" || filepath.IsAbs(pattern) || pattern == ".." || strings.HasPrefix(pattern, ".."+string(filepath.Separator)) {
+			fmt.Fprintf(logs, "-- test report path %q must be relative to the worktree\n", spec.Path)
+			continue
+		}
+		matches, _ := filepath.Glob(filepath.Join(worktree, pattern))
+		if len(matches) == 0 {
+			fmt.Fprintf(logs, "-- no test report matches %s\n", spec.Path)
+		}
+		for _, m := range matches {
+			// Glob follows symlinked directories; only files that resolve
+			// inside the worktree are uploaded.
+			m, err := filepath.EvalSymlinks(m)
+			if err != nil || !strings.HasPrefix(m, root+string(filepath.Separator)) {
+				fmt.Fprintf(logs, "-- test report %s is outside the worktree\n", spec.Path)
+				continue
+			}
+			if info, err := os.Stat(m); err != nil || !info.Mode().IsRegular() || seen[m] {
+				continue
+			}
+			seen[m] = true
+			files = append(files, jobFile{kind: "test_report", path: m})
+		}
+	}
+	return files
+}
+
+// specRun is the state of one step spec being run.
+type specRun struct {
+	sh       *sandbox.Shell
+	logs     *logStream
+	branch   string
+	check    func(context.Context, GitOperation) error
+	commands []sandbox.CommandReport
+	patch    *patches.Report
+}
+
+func (run *specRun) execute(ctx context.Context, spec StepSpec, worktree, jobDir string, req Request) (string, error) {
+	logs := run.logs
+	if spec.Patch != "" {
+		patchPath := filepath.Join(jobDir, "input.patch")
+		if err := os.WriteFile(patchPath, []byte(spec.Patch), 0644); err != nil {
+			return "patch", err
+		}
+		fmt.Fprintf(logs, "$ git apply --3way %s\n", patchPath)
+		rep, err := patches.Apply(ctx, worktree, []byte(spec.Patch))
+		if err != nil {
+			return "patch", err
+		}
+		run.patch = rep
+		if !rep.Applied {
+			logs.Write([]byte(rep.Text()))
+			if spec.OnConflict != onConflictContinue {
+				return "patch", errPatchNotApplied
+			}
+			logs.Write([]byte("-- on_conflict is continue: skipping the remaining phases\n"))
+			return "", nil
+		}
+		logs.Write([]byte(rep.Summary + "\n"))
+	}
+	for _, phase := range []struct {
+		name string
+		cmds []string
+	}{{"command", spec.Commands}, {"verify", spec.Verify}} {
+		for _, cmd := range phase.cmds {
+			report, err := run.sh.Run(ctx, phase.name, cmd, worktree, logs)
+			run.commands = append(run.commands, report)
+			if err != nil {
+				return phase.name, err
+			}
+		}
+	}
+	if _, err := git(ctx, worktree, "add", "-A"); err != nil {
+		return "diff", err
+	}
+	if spec.Commit == nil {
+		return "", nil
+	}
+	msg := spec.Commit.Message
+	if msg == "" {
+		name, _ := req.Step["name"].(string)
+		msg = "Bull Board: " + name
+	}
+	if out, _ := git(ctx, worktree, "diff", "--cached", "--name-only"); out == "" {
+		logs.Write([]byte("nothing to commit\n"))
+		return "", nil
+	}
+	if err := run.check(ctx, GitOperation{Operation: gitrefs.OpCommit, Branch: run.branch}); err != nil {
+		return "commit", err
+	}
+	fmt.Fprintf(logs, "$ git commit -m %q\n", msg)
+	out, err := git(ctx, worktree, "commit", "-m", msg)
+	logs.Write([]byte(out))
+	if err != nil {
+		return "commit", err
+	}
+	return "", nil
+}
+
+// refGuard is the sandbox.Guard of a job's commands. It compares the
+// branches of the repository before and after each command and asks the
+// console about every branch the command moved; a branch the console does
+// not allow is moved back and the command fails.
+type refGuard struct {
+	dir       string
+	worktrees string
+	// mu is the runner's worktree lock: a run branch is created with its
+	// worktree, never between the two snapshots of a command.
+	mu    *sync.Mutex
+	check func(context.Context, GitOperation) error
+	refs  map[string]string
+}
+
+func (g *refGuard) branches(ctx context.Context) (map[string]string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return gitrefs.Branches(ctx, g.dir)
+}
+
+func (g *refGuard) Before(ctx context.Context) error {
+	refs, err := g.branches(ctx)
+	g.refs = refs
+	return err
+}
+
+func (g *refGuard) After(ctx context.Context) error {
+	refs, err := g.branches(ctx)
+	if err != nil {
+		return err
+	}
+	var moved []string
+	for name, oid := range refs {
+		if g.refs[name] != oid {
+			moved = append(moved, name)
+		}
+	}
+	for name := range g.refs {
+		if _, ok := refs[name]; !ok {
+			moved = append(moved, name)
+		}
+	}
+	sort.Strings(moved)
+	var refused error
+	for _, name := range moved {
+		old, new := g.refs[name], refs[name]
+		if gitrefs.IsZero(old) && g.runBranch(ctx, name) {
+			continue
+		}
+		op := gitrefs.Classify(ctx, g.dir, old, new, true)
+		err := g.check(ctx, GitOperation{Operation: op, Branch: name, Observed: true})
+		if err == nil {
+			continue
+		}
+		// An update the console could not check is moved back too.
+		if rerr := gitrefs.Restore(ctx, g.dir, name, old, new); rerr != nil {
+			return fmt.Errorf("%v; %w", rerr, err)
+		}
+		if refused == nil {
+			refused = fmt.Errorf("branch %q was moved back: %w", name, err)
+		}
+	}
+	return refused
+}
+
+// runBranch reports whether branch is the run branch of one of the runner's
+// worktrees, created for another job while the command ran.
+func (g *refGuard) runBranch(ctx context.Context, branch string) bool {
+	runID, ok := strings.CutPrefix(branch, "bb/run-")
+	if !ok || runID == "" || strings.ContainsAny(runID, `/\`) {
+		return false
+	}
+	return isWorktree(ctx, filepath.Join(g.worktrees, runID))
+}
+
+// worktree returns the run's worktree and branch, creating them from the
+// workspace repo on first use. RUNNER_REPO_PATH overrides the workspace
+// repo_path when the runner host keeps its clone elsewhere.
+func (r *Runner) worktree(ctx context.Context, req Request) (string, string, error) {
+	repoPath := r.cfg.RepoPath
+	if repoPath == "" {
+		repoPath, _ = req.Workspace["repo_path"].(string)
+	}
+	baseBranch, _ := req.Workspace["default_branch"].(string)
+	if repoPath == "" {
+		return "", "", errors.New("workspace repo_path is not configured")
+	}
+	if baseBranch == "" {
+		baseBranch = "main"
+	}
+	branch := "bb/run-" + req.WorkflowRunID
+	worktree := filepath.Join(r.cfg.WorkDir, "worktrees", req.WorkflowRunID)
+	r.wtMu.Lock()
+	defer r.wtMu.Unlock()
+	if isWorktree(ctx, worktree) {
+		return worktree, branch, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(worktree), 0755); err != nil {
+		return "", "", err
+	}
+	var err error
+	if _, verr := git(ctx, repoPath, "rev-parse", "--verify", "--quiet", "refs/heads/"+branch); verr == nil {
+		_, err = git(ctx, repoPath, "worktree", "add", worktree, branch)
+	} else {
+		_, err = git(ctx, repoPath, "worktree", "add", "-b", branch, worktree, baseBranch)
+	}
+	return worktree, branch, err
+}
+
+// gitIdentityEnv supplies a committer identity when the host has none configured.
+var gitIdentityEnv = []string{
+	"GIT_AUTHOR_NAME=Bull Board",
+	"GIT_AUTHOR_EMAIL=bull-board@localhost",
+	"GIT_COMMITTER_NAME=Bull Board",
+	"GIT_COMMITTER_EMAIL=bull-board@localhost",
+}
+
+func git(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Env = os.Environ()
+	for _, kv := range gitIdentityEnv {
+		if os.Getenv(strings.SplitN(kv, "=", 2)[0]) == "" {
+			cmd.Env = append(cmd.Env, kv)
+		}
+	}
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Run(); err != nil {
+		return out.String(), fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(out.String()))
+	}
+	return out.String(), nil
+}
+
+func isWorktree(ctx context.Context, path string) bool {
+	if _, err := os.Stat(path); err != nil {
+		return false
+	}
+	out, err := git(ctx, path, "rev-parse", "--is-inside-work-tree")
+	return err == nil && strings.TrimSpace(out) == "true"
+}
+
+func headCommit(ctx context.Context, dir string) string {
+	out, err := git(ctx, dir, "rev-parse", "HEAD")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(out)
+}
@@ -1,48 +1,56 @@
+// Command runner executes Bull Board jobs of runner execution backends. It
+// talks to the console only through the runner API: it enrolls with a
+// one-time token, long-polls for jobs, heartbeats their leases, streams logs,
+// uploads job files and reports results with its own credential.
+//
+// Run with -rotate to replace the saved credential and exit.
 package main
 
 import (
-	"bytes"
 	"context"
-	"crypto/rand"
-	"database/sql"
-	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"net/http"
 	"os"
-	"os/exec"
+	"os/signal"
 	"path/filepath"
+	"runtime"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
-
-	_ "modernc.org/sqlite"
 )
 
+// Version is reported to the console when the runner registers.
+var Version = "dev"
+
 type Config struct {
-	SQLitePath      string
-	ArtifactsDir    string
-	RunnerID        string
-	MaxConcurrency  int
-	LeaseSeconds    int
-	APIBaseURL      string
-	BackoffBaseSecs int
+	BaseURL          string
+	EnrollmentToken  string
+	Name             string
+	WorkDir          string
+	RepoPath         string
+	MaxConcurrency   int
+	ClaimWait        time.Duration
+	LogFlushInterval time.Duration
 }
 
 func loadConfig() Config {
+	host, _ := os.Hostname()
 	c := Config{
-		SQLitePath:      getEnv("SQLITE_PATH", "data/bullboard.db"),
-		ArtifactsDir:    getEnv("ARTIFACTS_DIR", "artifacts"),
-		RunnerID:        getEnv("RUNNER_ID", "runner-1"),
-		MaxConcurrency:  1,
-		LeaseSeconds:    600,
-		APIBaseURL:      getEnv("API_BASE_URL", "http://localhost:3000"),
-		BackoffBaseSecs: 30,
-	}
-	if v := os.Getenv("MAX_CONCURRENCY"); v != "" {
-		fmt.Sscanf(v, "%d", &c.MaxConcurrency)
-	}
-	if v := os.Getenv("LEASE_SECONDS"); v != "" {
-		fmt.Sscanf(v, "%d", &c.LeaseSeconds)
+		BaseURL:          strings.TrimSuffix(getEnv("BB_URL", "http://localhost:8888"), "/"),
+		EnrollmentToken:  os.Getenv("BB_ENROLLMENT_TOKEN"),
+		Name:             getEnv("RUNNER_NAME", host),
+		WorkDir:          getEnv("RUNNER_WORKDIR", "runner-data"),
+		RepoPath:         os.Getenv("RUNNER_REPO_PATH"),
+		MaxConcurrency:   1,
+		ClaimWait:        30 * time.Second,
+		LogFlushInterval: time.Second,
+	}
+	if n, err := strconv.Atoi(os.Getenv("MAX_CONCURRENCY")); err == nil && n > 0 {
+		c.MaxConcurrency = n
 	}
 	return c
 }
@@ -54,273 +62,134 @@ func getEnv(key, def string) string {
 	return def
 }
 
-func main() {
-	cfg := loadConfig()
-	db, err := sql.Open("sqlite", cfg.SQLitePath)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "open db: %v\n", err)
-		os.Exit(1)
-	}
-	defer db.Close()
-
-	for {
-		claimed, err := claimJob(db, &cfg)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "claim: %v\n", err)
-			time.Sleep(5 * time.Second)
-			continue
-		}
-		if !claimed {
-			time.Sleep(2 * time.Second)
-			continue
-		}
-		// single worker: process one job per loop (run in goroutine if MaxConcurrency > 1 later)
-		time.Sleep(100 * time.Millisecond)
-	}
+// Runner claims and executes jobs with up to MaxConcurrency in flight.
+type Runner struct {
+	cfg    Config
+	client *Client
+	id     string
+	wtMu   sync.Mutex
 }
 
-type JobRow struct {
-	ID         string
-	RunID      string
-	TaskID     string
-	WorkspaceID string
-	Mode       string
-	PayloadJSON string
-	Attempts   int
-	MaxAttempts int
+func (r *Runner) logf(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "%s %s\n", time.Now().Format(time.RFC3339), fmt.Sprintf(format, args...))
 }
 
-func claimJob(db *sql.DB, cfg *Config) (bool, error) {
-	tx, err := db.BeginTx(context.Background(), &sql.TxOptions{})
-	if err != nil {
-		return false, err
-	}
-	defer tx.Rollback()
+// statePath holds the runner id and credential so restarts keep the same identity.
+func (r *Runner) statePath() string { return filepath.Join(r.cfg.WorkDir, "runner.json") }
 
-	// SQLite: BEGIN gets a lock; we need to select and update atomically
-	now := time.Now().UTC().Format(time.RFC3339)
-	leaseUntil := time.Now().Add(time.Duration(cfg.LeaseSeconds) * time.Second).UTC().Format(time.RFC3339)
-
-	var j JobRow
-	err = tx.QueryRow(`
-		SELECT id, run_id, task_id, workspace_id, mode, payload_json, attempts, max_attempts
-		FROM jobs
-		WHERE status = 'queued' AND available_at <= ? AND (locked_until IS NULL OR locked_until < ?)
-		ORDER BY priority DESC, created_at ASC LIMIT 1
-	`, now, now).Scan(&j.ID, &j.RunID, &j.TaskID, &j.WorkspaceID, &j.Mode, &j.PayloadJSON, &j.Attempts, &j.MaxAttempts)
-	if err == sql.ErrNoRows {
-		return false, nil
-	}
-	if err != nil {
-		return false, err
-	}
-
-	_, err = tx.Exec(`
-		UPDATE jobs SET status = 'running', locked_by = ?, locked_until = ?, attempts = attempts + 1, updated_at = ?
-		WHERE id = ?
-	`, cfg.RunnerID, leaseUntil, now, j.ID)
-	if err != nil {
-		return false, err
-	}
-
-	_, err = tx.Exec(`UPDATE runs SET status = 'running', started_at = ?, updated_at = ? WHERE id = ?`, now, now, j.RunID)
-	if err != nil {
-		return false, err
-	}
-
-	if err = tx.Commit(); err != nil {
-		return false, err
-	}
-
-	go runJob(db, cfg, &j)
-	return true, nil
+type runnerState struct {
+	ID         string `json:"id"`
+	Credential string `json:"credential"`
 }
 
-func runJob(db *sql.DB, cfg *Config, j *JobRow) {
-	var payload map[string]interface{}
-	if err := json.Unmarshal([]byte(j.PayloadJSON), &payload); err != nil {
-		finishJob(db, cfg, j, "failed", "infra_failed", "invalid payload", nil)
-		return
+func (r *Runner) saveState() error {
+	if err := os.MkdirAll(r.cfg.WorkDir, 0755); err != nil {
+		return err
 	}
-
-	repoPath, _ := payload["workspace"].(map[string]interface{})["repo_path"].(string)
-	baseBranch, _ := payload["workspace"].(map[string]interface{})["base_branch"].(string)
-	if baseBranch == "" {
-		baseBranch = "main"
-	}
-	branch, _ := payload["branch"].(string)
-	if repoPath == "" || branch == "" {
-		finishJob(db, cfg, j, "failed", "infra_failed", "missing workspace.repo_path or branch", nil)
-		return
-	}
-
-	workDir := filepath.Join(cfg.ArtifactsDir, "worktrees", j.RunID)
-	artifactsDir := filepath.Join(cfg.ArtifactsDir, j.RunID)
-	_ = os.MkdirAll(artifactsDir, 0755)
-	_ = os.MkdirAll(filepath.Dir(workDir), 0755)
-
-	// git worktree add (must run from main repo)
-	if err := runCmd(repoPath, "git", "worktree", "add", workDir, branch); err != nil {
-		// branch might not exist: create from base
-		if err2 := runCmd(repoPath, "git", "worktree", "add", "-b", branch, workDir, baseBranch); err2 != nil {
-			finishJob(db, cfg, j, "failed", "infra_failed", "git worktree add: "+err.Error(), nil)
-			return
-		}
-	}
-
-	db.Exec("UPDATE runs SET worktree_path = ?, branch_name = ?, updated_at = ? WHERE id = ?", workDir, branch, time.Now().UTC().Format(time.RFC3339), j.RunID)
-	defer func() {
-		_ = runCmd(repoPath, "git", "worktree", "remove", workDir, "--force")
-	}()
-
-	var status, errorKind, summary string
-	var artPaths []map[string]string
-
-	artBase := filepath.Join(cfg.ArtifactsDir, j.RunID)
-	switch j.Mode {
-	case "VERIFY":
-		status, errorKind, summary, artPaths = runVerify(payload, workDir, artifactsDir, artBase)
-	case "CODE_CHANGE":
-		status, errorKind, summary, artPaths = runCodeChange(payload, workDir, artifactsDir, artBase)
-	case "SUBMIT":
-		status, errorKind, summary, artPaths = runSubmit(payload, workDir, artifactsDir)
-	default:
-		status, errorKind, summary = "failed", "infra_failed", "unknown mode"
-	}
-
-	// write artifacts to DB (uri = relative path for API)
-	for _, a := range artPaths {
-		db.Exec("INSERT INTO artifacts (id, run_id, type, uri, created_at) VALUES (?, ?, ?, ?, ?)",
-			uuidGen(), j.RunID, a["type"], a["path"], time.Now().UTC().Format(time.RFC3339))
-	}
-
-	finishJob(db, cfg, j, status, errorKind, summary, artPaths)
+	data, _ := json.Marshal(runnerState{ID: r.id, Credential: r.client.Credential})
+	return os.WriteFile(r.statePath(), data, 0600)
 }
 
-func runVerify(payload map[string]interface{}, workDir, artifactsDir, artBase string) (status, errorKind, summary string, arts []map[string]string) {
-	verify, _ := payload["verify"].(map[string]interface{})
-	cmds, _ := verify["commands"].([]interface{})
-	if len(cmds) == 0 {
-		return "failed", "infra_failed", "no commands", nil
-	}
-	var buf bytes.Buffer
-	for _, c := range cmds {
-		cmdStr, _ := c.(string)
-		buf.WriteString("$ " + cmdStr + "\n")
-		out, err := runCmdOut(workDir, "sh", "-c", cmdStr)
-		buf.Write(out)
-		if err != nil {
-			buf.WriteString("exit code: " + err.Error() + "\n")
-			os.WriteFile(filepath.Join(artifactsDir, "log.txt"), buf.Bytes(), 0644)
-			return "failed", "test_failed", err.Error(), []map[string]string{{"type": "log", "path": filepath.Join(artBase, "log.txt")}}
-		}
-	}
-	os.WriteFile(filepath.Join(artifactsDir, "log.txt"), buf.Bytes(), 0644)
-	os.WriteFile(filepath.Join(artifactsDir, "report.json"), []byte(`{"summary":"ok"}`), 0644)
-	diffOut, _ := runCmdOut(workDir, "git", "diff")
-	os.WriteFile(filepath.Join(artifactsDir, "diff.txt"), diffOut, 0644)
-	return "succeeded", "none", "ok", []map[string]string{
-		{"type": "log", "path": filepath.Join(artBase, "log.txt")},
-		{"type": "report", "path": filepath.Join(artBase, "report.json")},
-		{"type": "diff", "path": filepath.Join(artBase, "diff.txt")},
+func (r *Runner) info() Info {
+	host, _ := os.Hostname()
+	return Info{
+		Name:    r.cfg.Name,
+		Version: Version,
+		Host:    map[string]any{"hostname": host, "os": runtime.GOOS, "arch": runtime.GOARCH, "max_concurrency": r.cfg.MaxConcurrency},
 	}
 }
 
-func runCodeChange(payload map[string]interface{}, workDir, artifactsDir, artBase string) (status, errorKind, summary string, arts []map[string]string) {
-	cc, _ := payload["code_change"].(map[string]interface{})
-	patch, _ := cc["patch"].(string)
-	if patch == "" {
-		return "failed", "infra_failed", "no patch", nil
+// identify loads the saved credential, enrolling with BB_ENROLLMENT_TOKEN
+// when there is none, and reports the runner's version and host.
+func (r *Runner) identify(ctx context.Context) error {
+	var state runnerState
+	if data, err := os.ReadFile(r.statePath()); err == nil && json.Unmarshal(data, &state) == nil && state.Credential != "" {
+		r.id, r.client.Credential = state.ID, state.Credential
+		return r.client.UpdateInfo(ctx, r.id, r.info())
 	}
-	patchPath := filepath.Join(workDir, "apply.patch")
-	if err := os.WriteFile(patchPath, []byte(patch), 0644); err != nil {
-		return "failed", "infra_failed", err.Error(), nil
+	if r.cfg.EnrollmentToken == "" {
+		return errors.New("not enrolled: set BB_ENROLLMENT_TOKEN to a token from POST /api/runners/enrollment-tokens")
 	}
-	if err := runCmd(workDir, "git", "apply", "apply.patch"); err != nil {
-		return "failed", "code_failed", "git apply: "+err.Error(), nil
+	id, credential, err := r.client.Enroll(ctx, r.cfg.EnrollmentToken, r.info())
+	if err != nil {
+		return err
 	}
-	diffOut, _ := runCmdOut(workDir, "git", "diff")
-	os.WriteFile(filepath.Join(artifactsDir, "diff.txt"), diffOut, 0644)
-	return "succeeded", "none", "applied", []map[string]string{{"type": "diff", "path": filepath.Join(artBase, "diff.txt")}}
+	r.id, r.client.Credential = id, credential
+	return r.saveState()
 }
 
-func runSubmit(payload map[string]interface{}, workDir, artifactsDir string) (status, errorKind, summary string, arts []map[string]string) {
-	sub, _ := payload["submit"].(map[string]interface{})
-	msg, _ := sub["commit_message"].(string)
-	if msg == "" {
-		msg = "BullBoard: submit"
-	}
-	remote, _ := sub["remote"].(string)
-	if remote == "" {
-		remote = "origin"
-	}
-	if err := runCmd(workDir, "git", "add", "-A"); err != nil {
-		return "failed", "infra_failed", "git add: "+err.Error(), nil
-	}
-	if err := runCmd(workDir, "git", "commit", "-m", msg); err != nil {
-		return "failed", "infra_failed", "git commit: "+err.Error(), nil
+// rotate replaces the saved credential.
+func (r *Runner) rotate(ctx context.Context) error {
+	if err := r.identify(ctx); err != nil {
+		return err
 	}
-	if err := runCmd(workDir, "git", "push", remote, payload["branch"].(string)); err != nil {
-		return "failed", "infra_failed", "git push: "+err.Error(), nil
+	credential, err := r.client.Rotate(ctx, r.id)
+	if err != nil {
+		return err
 	}
-	return "succeeded", "none", "pushed", nil
+	r.client.Credential = credential
+	return r.saveState()
 }
 
-func finishJob(db *sql.DB, cfg *Config, j *JobRow, status, errorKind, summary string, artPaths []map[string]string) {
-	now := time.Now().UTC().Format(time.RFC3339)
-	db.Exec("UPDATE runs SET status = ?, error_kind = ?, error_message = ?, finished_at = ?, updated_at = ? WHERE id = ?",
-		status, errorKind, summary, now, now, j.RunID)
-
-	var attempts, maxAttempts int
-	db.QueryRow("SELECT attempts, max_attempts FROM jobs WHERE id = ?", j.ID).Scan(&attempts, &maxAttempts)
-
-	if status == "failed" && attempts < maxAttempts {
-		backoff := time.Now().Add(time.Duration(cfg.BackoffBaseSecs*attempts) * time.Second).UTC().Format(time.RFC3339)
-		db.Exec("UPDATE jobs SET status = 'queued', locked_until = NULL, last_error = ?, available_at = ?, updated_at = ? WHERE id = ?",
-			summary, backoff, now, j.ID)
-	} else {
-		db.Exec("UPDATE jobs SET status = ?, locked_until = NULL, last_error = ?, updated_at = ? WHERE id = ?",
-			status, summary, now, j.ID)
-	}
-
-	// callback (uri = relative path e.g. artifacts/runId/log.txt)
-	arts := make([]struct{ Type string `json:"type"`; Uri string `json:"uri"` }, 0, len(artPaths))
-	for _, a := range artPaths {
-		arts = append(arts, struct{ Type string `json:"type"`; Uri string `json:"uri"` }{Type: a["type"], Uri: a["path"]})
+// Run claims jobs until ctx is done, then waits for jobs in flight.
+func (r *Runner) Run(ctx context.Context) error {
+	if err := r.identify(ctx); err != nil {
+		return fmt.Errorf("identify: %w", err)
 	}
-	body, _ := json.Marshal(map[string]interface{}{
-		"run_id":     j.RunID,
-		"status":     status,
-		"error_kind": errorKind,
-		"summary":    summary,
-		"artifacts":  arts,
-	})
-	req, _ := http.NewRequest("POST", strings.TrimSuffix(cfg.APIBaseURL, "/")+"/api/runner/report", bytes.NewReader(body))
-	req.Header.Set("Content-Type", "application/json")
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "report callback: %v\n", err)
-		return
+	r.logf("runner %s (%s) polling %s", r.id, r.cfg.Name, r.cfg.BaseURL)
+	slots := make(chan struct{}, r.cfg.MaxConcurrency)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case slots <- struct{}{}:
+		}
+		lease, err := r.client.Claim(ctx, r.id, r.cfg.ClaimWait)
+		if err != nil || lease == nil {
+			<-slots
+			switch {
+			case ctx.Err() != nil:
+				return nil
+			case errors.Is(err, errUnauthorized):
+				return fmt.Errorf("credential refused, enroll again with a new token: %w", err)
+			case err != nil:
+				r.logf("claim: %v", err)
+				sleep(ctx, 5*time.Second)
+			}
+			continue
+		}
+		r.logf("job %s: claimed (attempt %d)", lease.JobID, lease.Attempt)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			r.runLease(ctx, lease)
+		}()
 	}
-	defer resp.Body.Close()
-}
-
-func runCmd(dir, name string, args ...string) error {
-	cmd := exec.Command(name, args...)
-	cmd.Dir = dir
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	return cmd.Run()
 }
 
-func runCmdOut(dir, name string, args ...string) ([]byte, error) {
-	cmd := exec.Command(name, args...)
-	cmd.Dir = dir
-	return cmd.CombinedOutput()
+func sleep(ctx context.Context, d time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(d):
+	}
 }
 
-func uuidGen() string {
-	b := make([]byte, 16)
-	_, _ = rand.Read(b)
-	return hex.EncodeToString(b[0:4]) + "-" + hex.EncodeToString(b[4:6]) + "-" + hex.EncodeToString(b[6:8]) + "-" + hex.EncodeToString(b[8:10]) + "-" + hex.EncodeToString(b[10:16])
+func main() {
+	rotate := flag.Bool("rotate", false, "replace the saved runner credential and exit")
+	flag.Parse()
+	cfg := loadConfig()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	r := &Runner{cfg: cfg, client: &Client{BaseURL: cfg.BaseURL}}
+	run := r.Run
+	if *rotate {
+		run = r.rotate
+	}
+	if err := run(ctx); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/PonyDevAI/Bull-Board/pkg/patches"
+	"github.com/PonyDevAI/Bull-Board/pkg/sandbox"
+)
+
+// fakeConsole serves one job through the runner API and records what the runner sends.
+type fakeConsole struct {
+	mu        sync.Mutex
+	claimed   bool
+	logs      strings.Builder
+	artifacts map[string]string
+	result    *Result
+	auth      string
+	gitOps    []string
+	done      chan struct{}
+}
+
+func (f *fakeConsole) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.auth = r.Header.Get("Authorization")
+	path := r.URL.Path
+	switch {
+	case path == "/api/runners/register":
+		var body map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if body["enrollment_token"] != "bbe_once" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = io.WriteString(w, `{"error":"runner unauthorized"}`)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		_, _ = io.WriteString(w, `{"item":{"id":"runner-1"},"credential":"bbr_first"}`)
+	case path == "/api/runners/runner-1/rotate":
+		_, _ = io.WriteString(w, `{"item":{"id":"runner-1"},"credential":"bbr_second"}`)
+	case path == "/api/runners/runner-1/info":
+		_, _ = io.WriteString(w, `{"item":{"id":"runner-1"}}`)
+	case path == "/api/runners/runner-1/claim":
+		if f.claimed {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		f.claimed = true
+		_, _ = io.WriteString(w, `{"item":{"job_id":"job-1","runner_id":"runner-1","attempt":1,"lease_seconds":60,
+			"request":{"job_id":"job-1","workflow_run_id":"run-1","step":{"name":"Build","config":{"commands":["echo built > out.txt"],"commit":{"message":"build output"}}},"workspace":{}}}}`)
+	case path == "/api/runners/runner-1/jobs/job-1/logs":
+		var body struct {
+			Logs []LogChunk `json:"logs"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		for _, c := range body.Logs {
+			f.logs.WriteString(c.Content)
+		}
+		_, _ = io.WriteString(w, `{"ok":true}`)
+	case path == "/api/runners/runner-1/jobs/job-1/git-operations":
+		// Only main is protected.
+		var op GitOperation
+		_ = json.NewDecoder(r.Body).Decode(&op)
+		f.gitOps = append(f.gitOps, fmt.Sprintf("%s %s observed=%v", op.Operation, op.Branch, op.Observed))
+		if op.Branch == "main" {
+			_, _ = io.WriteString(w, `{"item":{"decision":"blocked"},"error":"main is protected"}`)
+			return
+		}
+		_, _ = io.WriteString(w, `{"item":{"decision":"allowed"}}`)
+	case path == "/api/runners/runner-1/jobs/job-1/artifacts":
+		data, _ := io.ReadAll(r.Body)
+		f.artifacts[r.URL.Query().Get("kind")] = string(data)
+		w.WriteHeader(http.StatusCreated)
+		_, _ = io.WriteString(w, `{"item":{}}`)
+	case path == "/api/runners/runner-1/jobs/job-1/result":
+		var res Result
+		_ = json.NewDecoder(r.Body).Decode(&res)
+		f.result = &res
+		close(f.done)
+		_, _ = io.WriteString(w, `{"ok":true}`)
+	default:
+		w.WriteHeader(http.StatusConflict)
+		_, _ = io.WriteString(w, `{"error":"job lease not held by runner"}`)
+	}
+}
+
+func initRepo(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, args := range [][]string{{"init", "-q", "-b", "main"}, {"commit", "-q", "--allow-empty", "-m", "init"}} {
+		if _, err := git(context.Background(), dir, args...); err != nil {
+			t.Fatalf("git %v: %v", args, err)
+		}
+	}
+	return dir
+}
+
+func TestRunnerExecutesClaimedJob(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	fake := &fakeConsole{artifacts: map[string]string{}, done: make(chan struct{})}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	workDir := t.TempDir()
+	r := &Runner{
+		cfg: Config{
+			Name: "test", EnrollmentToken: "bbe_once", WorkDir: workDir, RepoPath: initRepo(t),
+			MaxConcurrency: 1, ClaimWait: time.Second, LogFlushInterval: 10 * time.Millisecond,
+		},
+		client: &Client{BaseURL: srv.URL},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- r.Run(ctx) }()
+	select {
+	case <-fake.done:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("runner did not report a result")
+	}
+	cancel()
+	if err := <-errc; err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if fake.result.Status != "succeeded" || fake.result.Output["branch"] != "bb/run-run-1" {
+		t.Fatalf("unexpected result %+v", fake.result)
+	}
+	if !strings.Contains(fake.logs.String(), "$ echo built > out.txt") || !strings.Contains(fake.artifacts["execution_log"], "git commit") {
+		t.Fatalf("unexpected logs %q / %q", fake.logs.String(), fake.artifacts["execution_log"])
+	}
+	if !strings.Contains(fake.artifacts["diff"], "+built") || fake.artifacts["report"] == "" {
+		t.Fatalf("unexpected artifacts %v", fake.artifacts)
+	}
+	if strings.Join(fake.gitOps, "\n") != "commit bb/run-run-1 observed=false" {
+		t.Fatalf("unexpected git operation checks %q", fake.gitOps)
+	}
+	if fake.auth != "Bearer bbr_first" {
+		t.Fatalf("expected the enrolled credential, got %q", fake.auth)
+	}
+	out, err := git(context.Background(), filepath.Join(workDir, "worktrees", "run-1"), "log", "-1", "--format=%s")
+	if err != nil || strings.TrimSpace(out) != "build output" {
+		t.Fatalf("worktree head %q, %v", out, err)
+	}
+}
+
+func TestRotateReplacesSavedCredential(t *testing.T) {
+	fake := &fakeConsole{}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	workDir := t.TempDir()
+	r := &Runner{cfg: Config{Name: "test", EnrollmentToken: "bbe_once", WorkDir: workDir}, client: &Client{BaseURL: srv.URL}}
+	if err := r.identify(context.Background()); err != nil {
+		t.Fatalf("enroll: %v", err)
+	}
+
+	// A restarted runner reuses the saved identity; the used token is not needed.
+	r = &Runner{cfg: Config{Name: "test", WorkDir: workDir}, client: &Client{BaseURL: srv.URL}}
+	if err := r.rotate(context.Background()); err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(workDir, "runner.json"))
+	if err != nil || !strings.Contains(string(data), `"credential":"bbr_second"`) {
+		t.Fatalf("saved state %s, %v", data, err)
+	}
+	if fake.auth != "Bearer bbr_first" {
+		t.Fatalf("rotation must authenticate with the current credential, got %q", fake.auth)
+	}
+
+	r = &Runner{cfg: Config{Name: "test", WorkDir: t.TempDir(), EnrollmentToken: "bbe_used"}, client: &Client{BaseURL: srv.URL}}
+	if err := r.identify(context.Background()); !errors.Is(err, errUnauthorized) {
+		t.Fatalf("expected refused token, got %v", err)
+	}
+}
+
+func TestClientMapsLeaseLost(t *testing.T) {
+	srv := httptest.NewServer(&fakeConsole{})
+	defer srv.Close()
+	c := &Client{BaseURL: srv.URL}
+	if err := c.Heartbeat(context.Background(), "runner-1", "job-9"); !errors.Is(err, errLeaseLost) {
+		t.Fatalf("expected lease lost, got %v", err)
+	}
+}
+
+func TestExecuteRunsCommandsInSandbox(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	t.Setenv("BB_TEST_SECRET", "leak")
+	r := &Runner{cfg: Config{WorkDir: t.TempDir(), RepoPath: initRepo(t)}}
+	req := Request{
+		JobID: "job-1", WorkflowRunID: "run-1", StepRunID: "step-1",
+		Step: map[string]any{"config": map[string]any{
+			"commands": []any{`echo "secret=$BB_TEST_SECRET job=$BB_JOB_ID nofile=$(ulimit -n)"`},
+			"verify":   []any{"sleep 30 & sleep 30"},
+			"sandbox":  map[string]any{"timeout_seconds": 1, "open_files": 64},
+		}},
+		// Run input cannot loosen the template's limits.
+		Input: map[string]any{"sandbox": map[string]any{"timeout_seconds": -1}},
+	}
+	logs := &logStream{}
+	start := time.Now()
+	res, _ := r.execute(context.Background(), req, logs)
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Fatalf("background child kept the command alive for %s", elapsed)
+	}
+	if res.Status != "failed" || res.Output["phase"] != "verify" || res.Output["limit_hit"] != sandbox.LimitTimeout {
+		t.Fatalf("unexpected result %+v", res)
+	}
+	if got := string(logs.bytes()); !strings.Contains(got, "secret= job=job-1 nofile=64") {
+		t.Fatalf("expected a scrubbed environment under limits:\n%s", got)
+	}
+}
+
+func TestExecuteSkipsTestReportsOutsideWorktree(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	outside := t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "secret.xml"), []byte("<secret/>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r := &Runner{cfg: Config{WorkDir: t.TempDir(), RepoPath: initRepo(t)}}
+	req := Request{
+		JobID: "job-1", WorkflowRunID: "run-1", StepRunID: "step-1",
+		Step: map[string]any{"config": map[string]any{
+			"commands":     []any{"mkdir -p reports && echo '<ok/>' > reports/unit.xml && ln -s " + outside + " linked"},
+			"test_reports": []any{"reports/*.xml", "linked/*.xml"},
+		}},
+	}
+	_, files := r.execute(context.Background(), req, &logStream{})
+	var reports []string
+	for _, f := range files {
+		if f.kind == "test_report" {
+			reports = append(reports, f.path)
+		}
+	}
+	if len(reports) != 1 || !strings.HasSuffix(reports[0], filepath.Join("reports", "unit.xml")) {
+		t.Fatalf("expected only the report inside the worktree, got %v", reports)
+	}
+}
+
+func TestExecuteReportsPatchThatDoesNotApply(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	repo := initRepo(t)
+	if err := os.WriteFile(filepath.Join(repo, "app.txt"), []byte("one\ntwo\nthree\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{{"add", "-A"}, {"commit", "-q", "-m", "app"}} {
+		if _, err := git(context.Background(), repo, args...); err != nil {
+			t.Fatalf("git %v: %v", args, err)
+		}
+	}
+	r := &Runner{cfg: Config{WorkDir: t.TempDir(), RepoPath: repo}}
+	patch := "diff --git a/app.txt b/app.txt\n--- a/app.txt\n+++ b/app.txt\n@@ -1,3 +1,3 @@\n one\n-TWO\n+2\n three\n"
+	req := Request{
+		JobID: "job-1", WorkflowRunID: "run-1", StepRunID: "step-1",
+		Step:  map[string]any{"config": map[string]any{"on_conflict": "continue", "commands": []any{"echo skipped"}}},
+		Input: map[string]any{"patch": patch},
+	}
+	res, files := r.execute(context.Background(), req, &logStream{})
+	rep, ok := res.Output["patch"].(*patches.Report)
+	if res.Status != "succeeded" || !ok || rep.Applied || len(res.Output["commands"].([]sandbox.CommandReport)) != 0 {
+		t.Fatalf("unexpected result %+v", res)
+	}
+	if f := rep.Files[0]; f.Path != "app.txt" || f.Result != patches.ResultRejected || f.Reason != patches.ReasonContextMismatch || len(f.Hunks) != 1 || f.Hunks[0].Applies {
+		t.Fatalf("unexpected file report %+v", f)
+	}
+	var uploaded bool
+	for _, f := range files {
+		uploaded = uploaded || f.kind == "patch_report"
+	}
+	if !uploaded {
+		t.Fatalf("expected a patch_report upload, got %+v", files)
+	}
+
+	req.Step = map[string]any{"config": map[string]any{}}
+	req.JobID = "job-2"
+	if res, _ := r.execute(context.Background(), req, &logStream{}); res.Status != "failed" || res.Output["phase"] != "patch" {
+		t.Fatalf("expected the patch phase to fail by default, got %+v", res)
+	}
+}
+
+func TestExecuteMovesBackRefusedBranchUpdates(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	fake := &fakeConsole{artifacts: map[string]string{}, done: make(chan struct{})}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	repo := initRepo(t)
+	main := headCommit(context.Background(), repo)
+	r := &Runner{cfg: Config{WorkDir: t.TempDir(), RepoPath: repo}, client: &Client{BaseURL: srv.URL}, id: "runner-1"}
+	req := Request{
+		JobID: "job-1", WorkflowRunID: "run-1", StepRunID: "step-1",
+		Step: map[string]any{"config": map[string]any{
+			"commands": []any{
+				"git -c user.name=t -c user.email=t@example.test commit -q --allow-empty -m work && git branch side",
+				"git -c core.hooksPath=/dev/null update-ref refs/heads/main HEAD",
+				"echo not reached",
+			},
+		}},
+	}
+	res, _ := r.execute(context.Background(), req, &logStream{})
+	if res.Status != "failed" || res.Output["phase"] != "command" || !strings.Contains(res.Output["error"].(string), "main is protected") {
+		t.Fatalf("unexpected result %+v", res)
+	}
+	if got, _ := git(context.Background(), repo, "rev-parse", "main"); strings.TrimSpace(got) != main {
+		t.Fatalf("main was not moved back")
+	}
+	if _, err := git(context.Background(), repo, "rev-parse", "--verify", "side"); err != nil {
+		t.Fatalf("allowed branch was moved back: %v", err)
+	}
+	want := "commit bb/run-run-1 observed=true\ncommit side observed=true\ncommit main observed=true"
+	if got := strings.Join(fake.gitOps, "\n"); got != want {
+		t.Fatalf("git operation checks:\n%s\nwant:\n%s", got, want)
+	}
+}
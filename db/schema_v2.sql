@@ -86,7 +86,13 @@ CREATE TABLE plugins (
   code TEXT NOT NULL UNIQUE,
   name TEXT NOT NULL,
   config_schema_json TEXT NOT NULL DEFAULT '{}',
-  created_at TEXT NOT NULL DEFAULT (datetime('now'))
+  transport TEXT NOT NULL DEFAULT '',
+  command TEXT NOT NULL DEFAULT '',
+  args_json TEXT NOT NULL DEFAULT '[]',
+  env_json TEXT NOT NULL DEFAULT '{}',
+  url TEXT NOT NULL DEFAULT '',
+  created_at TEXT NOT NULL DEFAULT (datetime('now')),
+  updated_at TEXT NOT NULL DEFAULT (datetime('now'))
 );
 
 CREATE TABLE skills (
@@ -145,6 +151,12 @@ CREATE TABLE execution_backends (
   capabilities_json TEXT NOT NULL DEFAULT '{}',
   status TEXT NOT NULL DEFAULT 'offline',
   last_seen_at TEXT,
+  last_checked_at TEXT,
+  last_latency_ms INTEGER,
+  last_error TEXT NOT NULL DEFAULT '',
+  health_failures INTEGER NOT NULL DEFAULT 0,
+  max_concurrency INTEGER NOT NULL DEFAULT 0,
+  callback_secret TEXT NOT NULL DEFAULT '',
   created_at TEXT NOT NULL DEFAULT (datetime('now')),
   updated_at TEXT NOT NULL DEFAULT (datetime('now')),
   FOREIGN KEY (home_id) REFERENCES homes(id) ON DELETE CASCADE,
@@ -152,6 +164,42 @@ CREATE TABLE execution_backends (
 );
 CREATE INDEX idx_execution_backends_home_id ON execution_backends(home_id);
 
+CREATE TABLE runners (
+  id TEXT PRIMARY KEY,
+  name TEXT NOT NULL,
+  version TEXT NOT NULL DEFAULT '',
+  host_json TEXT NOT NULL DEFAULT '{}',
+  credential_hash TEXT NOT NULL DEFAULT '',
+  credential_prefix TEXT NOT NULL DEFAULT '',
+  credential_rotated_at TEXT,
+  revoked_at TEXT,
+  last_seen_at TEXT,
+  created_at TEXT NOT NULL DEFAULT (datetime('now')),
+  updated_at TEXT NOT NULL DEFAULT (datetime('now'))
+);
+
+CREATE TABLE runner_enrollment_tokens (
+  id TEXT PRIMARY KEY,
+  name TEXT NOT NULL DEFAULT '',
+  token_hash TEXT NOT NULL UNIQUE,
+  token_prefix TEXT NOT NULL,
+  backend_ids_json TEXT NOT NULL DEFAULT '[]',
+  expires_at TEXT NOT NULL,
+  used_at TEXT,
+  runner_id TEXT,
+  created_at TEXT NOT NULL DEFAULT (datetime('now'))
+);
+
+CREATE TABLE runner_backends (
+  runner_id TEXT NOT NULL,
+  execution_backend_id TEXT NOT NULL,
+  created_at TEXT NOT NULL DEFAULT (datetime('now')),
+  PRIMARY KEY (runner_id, execution_backend_id),
+  FOREIGN KEY (runner_id) REFERENCES runners(id) ON DELETE CASCADE,
+  FOREIGN KEY (execution_backend_id) REFERENCES execution_backends(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_runner_backends_backend_id ON runner_backends(execution_backend_id);
+
 CREATE TABLE workers (
   id TEXT PRIMARY KEY,
   home_id TEXT NOT NULL,
@@ -193,11 +241,30 @@ CREATE TABLE workflow_step_templates (
   step_type TEXT NOT NULL,
   step_order INTEGER NOT NULL,
   config_json TEXT NOT NULL DEFAULT '{}',
+  required_capabilities_json TEXT NOT NULL DEFAULT '{}',
   created_at TEXT NOT NULL DEFAULT (datetime('now')),
   FOREIGN KEY (workflow_template_id) REFERENCES workflow_templates(id) ON DELETE CASCADE,
   FOREIGN KEY (role_id) REFERENCES roles(id) ON DELETE SET NULL
 );
 
+CREATE TABLE workspace_repos (
+  workspace_id TEXT PRIMARY KEY,
+  remote_url TEXT NOT NULL,
+  clone_path TEXT NOT NULL DEFAULT '',
+  deploy_key_public TEXT NOT NULL DEFAULT '',
+  deploy_key_fingerprint TEXT NOT NULL DEFAULT '',
+  deploy_key_encrypted TEXT NOT NULL DEFAULT '',
+  fetch_interval_minutes INTEGER NOT NULL DEFAULT 0,
+  status TEXT NOT NULL DEFAULT 'pending',
+  last_operation TEXT NOT NULL DEFAULT '',
+  last_error TEXT NOT NULL DEFAULT '',
+  head TEXT NOT NULL DEFAULT '',
+  last_sync_at TEXT,
+  created_at TEXT NOT NULL,
+  updated_at TEXT NOT NULL,
+  FOREIGN KEY (workspace_id) REFERENCES workspaces(id) ON DELETE CASCADE
+);
+
 CREATE TABLE boards (
   id TEXT PRIMARY KEY,
   workspace_id TEXT NOT NULL,
@@ -238,6 +305,77 @@ CREATE TABLE workflow_runs (
   FOREIGN KEY (task_id) REFERENCES tasks(id) ON DELETE SET NULL
 );
 
+CREATE TABLE run_worktrees (
+  workflow_run_id TEXT PRIMARY KEY,
+  repo_path TEXT NOT NULL,
+  path TEXT NOT NULL,
+  branch TEXT NOT NULL,
+  base_branch TEXT NOT NULL,
+  base_commit TEXT NOT NULL DEFAULT '',
+  head TEXT NOT NULL DEFAULT '',
+  status TEXT NOT NULL DEFAULT 'active',
+  size_bytes INTEGER NOT NULL DEFAULT 0,
+  created_at TEXT NOT NULL,
+  updated_at TEXT NOT NULL,
+  pruned_at TEXT,
+  FOREIGN KEY (workflow_run_id) REFERENCES workflow_runs(id) ON DELETE CASCADE
+);
+
+CREATE TABLE pull_requests (
+  id TEXT PRIMARY KEY,
+  integration_instance_id TEXT NOT NULL,
+  repo TEXT NOT NULL,
+  number INTEGER NOT NULL,
+  url TEXT NOT NULL,
+  workspace_id TEXT NOT NULL,
+  task_id TEXT NOT NULL DEFAULT '',
+  workflow_run_id TEXT NOT NULL,
+  head_branch TEXT NOT NULL,
+  base_branch TEXT NOT NULL,
+  head_sha TEXT NOT NULL DEFAULT '',
+  title TEXT NOT NULL DEFAULT '',
+  state TEXT NOT NULL DEFAULT 'open',
+  review_state TEXT NOT NULL DEFAULT 'pending',
+  checked_at TEXT NOT NULL DEFAULT '',
+  created_at TEXT NOT NULL,
+  updated_at TEXT NOT NULL,
+  UNIQUE (integration_instance_id, repo, number),
+  FOREIGN KEY (integration_instance_id) REFERENCES integration_instances(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_pull_requests_task_id ON pull_requests(task_id);
+
+CREATE TABLE branch_protection_rules (
+  id TEXT PRIMARY KEY,
+  workspace_id TEXT NOT NULL,
+  pattern TEXT NOT NULL,
+  allowed_operations_json TEXT NOT NULL DEFAULT '[]',
+  on_violation TEXT NOT NULL DEFAULT 'block',
+  created_at TEXT NOT NULL,
+  updated_at TEXT NOT NULL,
+  FOREIGN KEY (workspace_id) REFERENCES workspaces(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_branch_protection_rules_workspace_id ON branch_protection_rules(workspace_id);
+
+CREATE TABLE git_operation_attempts (
+  id TEXT PRIMARY KEY,
+  workspace_id TEXT NOT NULL,
+  operation TEXT NOT NULL,
+  branch TEXT NOT NULL,
+  source TEXT NOT NULL,
+  rule_id TEXT NOT NULL DEFAULT '',
+  decision TEXT NOT NULL,
+  reason TEXT NOT NULL DEFAULT '',
+  task_id TEXT NOT NULL DEFAULT '',
+  workflow_run_id TEXT NOT NULL DEFAULT '',
+  step_run_id TEXT NOT NULL DEFAULT '',
+  decided_by TEXT NOT NULL DEFAULT '',
+  decided_at TEXT NOT NULL DEFAULT '',
+  consumed_at TEXT NOT NULL DEFAULT '',
+  created_at TEXT NOT NULL
+);
+CREATE INDEX idx_git_operation_attempts_workspace_id ON git_operation_attempts(workspace_id, created_at);
+CREATE INDEX idx_git_operation_attempts_step_run_id ON git_operation_attempts(step_run_id);
+
 CREATE TABLE step_runs (
   id TEXT PRIMARY KEY,
   workflow_run_id TEXT NOT NULL,
@@ -246,6 +384,9 @@ CREATE TABLE step_runs (
   status TEXT NOT NULL DEFAULT 'pending',
   input_json TEXT NOT NULL DEFAULT '{}',
   output_json TEXT NOT NULL DEFAULT '{}',
+  diff_stats_json TEXT NOT NULL DEFAULT '{}',
+  test_totals_json TEXT NOT NULL DEFAULT '{}',
+  queued_at TEXT,
   started_at TEXT,
   finished_at TEXT,
   created_at TEXT NOT NULL DEFAULT (datetime('now')),
@@ -263,12 +404,38 @@ CREATE TABLE jobs (
   status TEXT NOT NULL DEFAULT 'queued',
   request_json TEXT NOT NULL DEFAULT '{}',
   result_json TEXT NOT NULL DEFAULT '{}',
+  progress_json TEXT NOT NULL DEFAULT '{}',
+  cancel_reason TEXT NOT NULL DEFAULT '',
+  log_cursor TEXT NOT NULL DEFAULT '',
+  runner_id TEXT NOT NULL DEFAULT '',
+  lease_expires_at TEXT,
+  attempts INTEGER NOT NULL DEFAULT 0,
+  started_at TEXT,
+  finished_at TEXT,
   created_at TEXT NOT NULL DEFAULT (datetime('now')),
   updated_at TEXT NOT NULL DEFAULT (datetime('now')),
   FOREIGN KEY (step_run_id) REFERENCES step_runs(id) ON DELETE CASCADE,
   FOREIGN KEY (execution_backend_id) REFERENCES execution_backends(id) ON DELETE SET NULL
 );
 
+CREATE TABLE job_logs (
+  job_id TEXT NOT NULL,
+  byte_offset INTEGER NOT NULL,
+  stream TEXT NOT NULL DEFAULT 'stdout',
+  content TEXT NOT NULL,
+  created_at TEXT NOT NULL DEFAULT (datetime('now')),
+  PRIMARY KEY (job_id, byte_offset),
+  FOREIGN KEY (job_id) REFERENCES jobs(id) ON DELETE CASCADE
+);
+
+CREATE TABLE job_callback_nonces (
+  execution_backend_id TEXT NOT NULL,
+  nonce TEXT NOT NULL,
+  created_at TEXT NOT NULL,
+  PRIMARY KEY (execution_backend_id, nonce)
+);
+CREATE INDEX idx_job_callback_nonces_created_at ON job_callback_nonces(created_at);
+
 CREATE TABLE artifacts (
   id TEXT PRIMARY KEY,
   job_id TEXT NOT NULL,
@@ -276,11 +443,70 @@ CREATE TABLE artifacts (
   kind TEXT NOT NULL,
   uri TEXT NOT NULL,
   metadata_json TEXT NOT NULL DEFAULT '{}',
+  sha256 TEXT NOT NULL DEFAULT '',
+  size_bytes INTEGER NOT NULL DEFAULT 0,
+  mime_type TEXT NOT NULL DEFAULT '',
   created_at TEXT NOT NULL DEFAULT (datetime('now')),
   FOREIGN KEY (job_id) REFERENCES jobs(id) ON DELETE CASCADE,
   FOREIGN KEY (step_run_id) REFERENCES step_runs(id) ON DELETE SET NULL
 );
 
+CREATE TABLE artifact_blobs (
+  sha256 TEXT PRIMARY KEY,
+  size_bytes INTEGER NOT NULL,
+  mime_type TEXT NOT NULL DEFAULT '',
+  created_at TEXT NOT NULL
+);
+
+CREATE TABLE test_runs (
+  id TEXT PRIMARY KEY,
+  job_id TEXT NOT NULL,
+  step_run_id TEXT,
+  artifact_id TEXT NOT NULL,
+  format TEXT NOT NULL,
+  total INTEGER NOT NULL DEFAULT 0,
+  passed INTEGER NOT NULL DEFAULT 0,
+  failed INTEGER NOT NULL DEFAULT 0,
+  skipped INTEGER NOT NULL DEFAULT 0,
+  errors INTEGER NOT NULL DEFAULT 0,
+  duration_ms INTEGER NOT NULL DEFAULT 0,
+  created_at TEXT NOT NULL,
+  FOREIGN KEY (job_id) REFERENCES jobs(id) ON DELETE CASCADE,
+  FOREIGN KEY (step_run_id) REFERENCES step_runs(id) ON DELETE SET NULL,
+  FOREIGN KEY (artifact_id) REFERENCES artifacts(id) ON DELETE CASCADE
+);
+
+CREATE TABLE test_cases (
+  test_run_id TEXT NOT NULL,
+  seq INTEGER NOT NULL,
+  suite TEXT NOT NULL DEFAULT '',
+  name TEXT NOT NULL,
+  status TEXT NOT NULL,
+  duration_ms INTEGER NOT NULL DEFAULT 0,
+  message TEXT NOT NULL DEFAULT '',
+  PRIMARY KEY (test_run_id, seq),
+  FOREIGN KEY (test_run_id) REFERENCES test_runs(id) ON DELETE CASCADE
+);
+
+CREATE TABLE tool_calls (
+  id TEXT PRIMARY KEY,
+  job_id TEXT NOT NULL,
+  step_run_id TEXT,
+  seq INTEGER NOT NULL,
+  turn INTEGER NOT NULL DEFAULT 0,
+  call_id TEXT NOT NULL DEFAULT '',
+  tool TEXT NOT NULL,
+  input_json TEXT NOT NULL DEFAULT '{}',
+  output TEXT NOT NULL DEFAULT '',
+  status TEXT NOT NULL DEFAULT 'ok',
+  error TEXT NOT NULL DEFAULT '',
+  policy_rule TEXT NOT NULL DEFAULT '',
+  started_at TEXT NOT NULL,
+  duration_ms INTEGER NOT NULL DEFAULT 0,
+  FOREIGN KEY (job_id) REFERENCES jobs(id) ON DELETE CASCADE,
+  FOREIGN KEY (step_run_id) REFERENCES step_runs(id) ON DELETE SET NULL
+);
+
 CREATE INDEX idx_workspaces_home_id ON workspaces(home_id);
 CREATE INDEX idx_groups_workspace_id ON groups(workspace_id);
 CREATE INDEX idx_workers_workspace_id ON workers(workspace_id);
@@ -291,8 +517,13 @@ CREATE UNIQUE INDEX idx_workflow_step_templates_order ON workflow_step_templates
 CREATE INDEX idx_workflow_runs_template_id ON workflow_runs(workflow_template_id);
 CREATE INDEX idx_workflow_runs_task_id ON workflow_runs(task_id);
 CREATE INDEX idx_step_runs_worker_id ON step_runs(worker_id);
+CREATE INDEX idx_step_runs_status ON step_runs(status);
 CREATE INDEX idx_tasks_workflow_template_id ON tasks(workflow_template_id);
 CREATE INDEX idx_workflow_runs_workspace_id ON workflow_runs(workspace_id);
 CREATE INDEX idx_step_runs_workflow_run_id ON step_runs(workflow_run_id);
 CREATE INDEX idx_jobs_step_run_id ON jobs(step_run_id);
+CREATE INDEX idx_jobs_status ON jobs(status);
 CREATE INDEX idx_artifacts_job_id ON artifacts(job_id);
+CREATE INDEX idx_test_runs_step_run_id ON test_runs(step_run_id, job_id);
+CREATE INDEX idx_test_runs_artifact_id ON test_runs(artifact_id);
+CREATE INDEX idx_tool_calls_step_run_id ON tool_calls(step_run_id, job_id, seq);
@@ -0,0 +1,82 @@
+package cli
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/PonyDevAI/Bull-Board/internal/common"
+	"github.com/PonyDevAI/Bull-Board/internal/console/retention"
+	"github.com/spf13/cobra"
+)
+
+var gcDryRun bool
+
+// NewGCCmd 按 bb.json 的 retention 配置清理过期的 run、产物、日志与派发载荷
+func NewGCCmd() *cobra.Command {
+	cc := &cobra.Command{
+		Use:   "gc",
+		Short: "按保留策略清理运行数据与产物存储",
+		RunE:  runGC,
+	}
+	cc.Flags().BoolVar(&gcDryRun, "dry-run", false, "只报告将删除的内容与可释放空间，不做修改")
+	return cc
+}
+
+func runGC(cmd *cobra.Command, args []string) error {
+	cfg, err := common.LoadServerConfig(prefix)
+	if err != nil {
+		return err
+	}
+	db, _, err := common.OpenDB(prefix)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	root := cfg.Prefix
+	if root == "" {
+		root = prefix
+	}
+	rep, err := retention.New(db, filepath.Join(root, "data"), cfg.Retention).Collect(cmd.Context(), gcDryRun)
+	if err != nil {
+		return err
+	}
+	out := cmd.OutOrStdout()
+	if rep.DryRun {
+		fmt.Fprintln(out, "=== bb gc --dry-run（未做任何修改）===")
+	} else {
+		fmt.Fprintln(out, "=== bb gc ===")
+	}
+	p := cfg.Retention
+	fmt.Fprintf(out, "策略: 每任务保留 %s 次 run，产物保留 %s 天，存储上限 %s\n", orOff(p.KeepRunsPerTask > 0, p.KeepRunsPerTask), orOff(p.ArtifactMaxAgeDays > 0, p.ArtifactMaxAgeDays), orOff(p.MaxStorageMB > 0, fmt.Sprintf("%d MB", p.MaxStorageMB)))
+	fmt.Fprintf(out, "workflow run: %d  step run: %d  job: %d\n", rep.WorkflowRuns, rep.StepRuns, rep.Jobs)
+	fmt.Fprintf(out, "产物: %d  测试报告: %d  工具调用: %d  git 操作记录: %d\n", rep.Artifacts, rep.TestRuns, rep.ToolCalls, rep.GitOperations)
+	fmt.Fprintf(out, "日志分片: %d (%s)  派发载荷: %d (%s)\n", rep.LogChunks, humanBytes(rep.LogBytes), rep.Payloads, humanBytes(rep.PayloadBytes))
+	fmt.Fprintf(out, "blob: %d (%s)  文件: %d (%s)\n", rep.Blobs, humanBytes(rep.BlobBytes), rep.Files, humanBytes(rep.FileBytes))
+	verb := "已释放"
+	if rep.DryRun {
+		verb = "可释放"
+	}
+	fmt.Fprintf(out, "%s: %s，剩余产物存储: %s\n", verb, humanBytes(rep.BytesFreed), humanBytes(rep.StorageBytes))
+	return nil
+}
+
+// orOff 规则未启用时显示“不限”
+func orOff(on bool, v any) string {
+	if !on {
+		return "不限"
+	}
+	return fmt.Sprint(v)
+}
+
+func humanBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,24 @@
+package cli
+
+import (
+	"os"
+
+	"github.com/PonyDevAI/Bull-Board/internal/console/protection"
+	"github.com/spf13/cobra"
+)
+
+// NewGitGuardCmd 是步骤命令的 git hook 调用的内部命令：把分支更新经 hook 目录下的 socket 交给控制台检查，
+// 不打开数据库；不允许时以非零退出让 git 拒绝该更新（参数由 protection.ServeHooks 生成）
+func NewGitGuardCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:                "git-guard",
+		Short:              "检查 git hook 报告的分支更新（内部使用）",
+		Hidden:             true,
+		DisableFlagParsing: true,
+		SilenceUsage:       true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			os.Exit(protection.RunHook(args, cmd.InOrStdin(), cmd.ErrOrStderr()))
+			return nil
+		},
+	}
+}
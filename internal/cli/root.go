@@ -14,7 +14,7 @@ func NewRootCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "bb",
 		Short: "Bull Board 管理命令",
-		Long:  "bb 提供 server、status、logs、restart、doctor、tls、upgrade、uninstall 等命令。首次安装请用: curl -fsSL <INSTALL_URL> | bash",
+		Long:  "bb 提供 server、status、logs、restart、doctor、gc、tls、upgrade、uninstall 等命令。首次安装请用: curl -fsSL <INSTALL_URL> | bash",
 	}
 	cmd.PersistentFlags().StringVar(&prefix, "prefix", getEnv("BB_PREFIX", "/opt/bull-board"), "安装前缀")
 	cmd.PersistentFlags().IntVar(&port, "port", 8888, "端口（仅 server）")
@@ -27,6 +27,8 @@ func NewRootCmd() *cobra.Command {
 	cmd.AddCommand(NewLogsCmd())
 	cmd.AddCommand(NewRestartCmd())
 	cmd.AddCommand(NewDoctorCmd())
+	cmd.AddCommand(NewGCCmd())
+	cmd.AddCommand(NewGitGuardCmd())
 	return cmd
 }
 
@@ -11,10 +11,27 @@ import (
 type ServerConfig struct {
 	Port       int
 	StaticDir  string
-	Prefix     string   // 安装前缀，用于 VERSION、initial_credentials 等
+	Prefix     string // 安装前缀，用于 VERSION、initial_credentials 等
 	TLSEnabled bool
 	TLSCert    string
 	TLSKey     string
+	Retention  RetentionConfig
+	Worktrees  WorktreeConfig
+}
+
+// RetentionConfig 为 bb.json 的 retention 段，控制后台 GC；各规则为 0 时不启用
+type RetentionConfig struct {
+	KeepRunsPerTask    int   `json:"keepRunsPerTask"`    // 每个任务保留最近 N 次 workflow run
+	ArtifactMaxAgeDays int   `json:"artifactMaxAgeDays"` // 超过 X 天的产物、job 日志与派发载荷被清理
+	MaxStorageMB       int64 `json:"maxStorageMB"`       // 产物存储总量上限，超出时从最旧的产物开始删
+	IntervalMinutes    int   `json:"intervalMinutes"`    // 后台 GC 间隔，默认 60
+}
+
+// WorktreeConfig 为 bb.json 的 worktrees 段：每个 workflow run 的 worktree 分支命名与清理策略
+type WorktreeConfig struct {
+	BranchPattern     string `json:"branchPattern"`     // 分支命名，支持 {run_id} {short_id} {task_id} {workspace_id}，默认 bb/run-{run_id}
+	KeepFinishedHours int    `json:"keepFinishedHours"` // run 结束后 worktree 保留的小时数，默认 72，负数表示不按时间清理
+	MaxDiskMB         int64  `json:"maxDiskMB"`         // 所有 worktree 的磁盘配额，超出时从最早结束的 run 开始清理
 }
 
 // LoadServerConfig 从 PREFIX/config/bb.json 或环境变量解析
@@ -34,6 +51,8 @@ func LoadServerConfig(prefix string) (*ServerConfig, error) {
 			CertPath string `json:"certPath"`
 			KeyPath  string `json:"keyPath"`
 		} `json:"tls"`
+		Retention RetentionConfig `json:"retention"`
+		Worktrees WorktreeConfig  `json:"worktrees"`
 	}
 	if err := json.Unmarshal(data, &out); err != nil {
 		return defaultServerConfig(prefix), nil
@@ -42,6 +61,8 @@ func LoadServerConfig(prefix string) (*ServerConfig, error) {
 	if out.Port > 0 {
 		cfg.Port = out.Port
 	}
+	cfg.Retention = out.Retention
+	cfg.Worktrees = out.Worktrees
 	if out.TLS != nil && out.TLS.Enabled {
 		cfg.TLSEnabled = true
 		cfg.TLSCert = out.TLS.CertPath
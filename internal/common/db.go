@@ -23,7 +23,7 @@ func OpenDB(prefix string) (*sql.DB, string, error) {
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return nil, "", err
 	}
-	db, err := sql.Open("sqlite", dbPath)
+	db, err := sql.Open("sqlite", dbPath+"?_pragma=busy_timeout(5000)")
 	if err != nil {
 		return nil, "", err
 	}
@@ -130,6 +130,7 @@ func initSchema(db *sql.DB) error {
 		"ALTER TABLE legacy_jobs ADD COLUMN last_error TEXT",
 		"ALTER TABLE legacy_jobs ADD COLUMN assigned_worker_id TEXT",
 		"ALTER TABLE legacy_tasks ADD COLUMN workflow_template_id TEXT",
+		"ALTER TABLE legacy_tasks ADD COLUMN important INTEGER NOT NULL DEFAULT 0",
 	} {
 		_, _ = db.Exec(q)
 	}
@@ -137,6 +138,37 @@ func initSchema(db *sql.DB) error {
 	return initSchemaWorkforceV2(db)
 }
 
+// workforceColumnMigrations 为 schema_v2.sql 中后续新增的列补齐旧库；列已存在时的错误被忽略。
+var workforceColumnMigrations = []string{
+	"ALTER TABLE jobs ADD COLUMN started_at TEXT",
+	"ALTER TABLE jobs ADD COLUMN finished_at TEXT",
+	"ALTER TABLE jobs ADD COLUMN progress_json TEXT NOT NULL DEFAULT '{}'",
+	"ALTER TABLE execution_backends ADD COLUMN callback_secret TEXT NOT NULL DEFAULT ''",
+	"ALTER TABLE execution_backends ADD COLUMN last_checked_at TEXT",
+	"ALTER TABLE execution_backends ADD COLUMN last_latency_ms INTEGER",
+	"ALTER TABLE execution_backends ADD COLUMN last_error TEXT NOT NULL DEFAULT ''",
+	"ALTER TABLE execution_backends ADD COLUMN health_failures INTEGER NOT NULL DEFAULT 0",
+	"ALTER TABLE workflow_step_templates ADD COLUMN required_capabilities_json TEXT NOT NULL DEFAULT '{}'",
+	"ALTER TABLE step_runs ADD COLUMN queued_at TEXT",
+	"ALTER TABLE execution_backends ADD COLUMN max_concurrency INTEGER NOT NULL DEFAULT 0",
+	"ALTER TABLE jobs ADD COLUMN cancel_reason TEXT NOT NULL DEFAULT ''",
+	"ALTER TABLE jobs ADD COLUMN log_cursor TEXT NOT NULL DEFAULT ''",
+	"ALTER TABLE plugins ADD COLUMN transport TEXT NOT NULL DEFAULT ''",
+	"ALTER TABLE plugins ADD COLUMN command TEXT NOT NULL DEFAULT ''",
+	"ALTER TABLE plugins ADD COLUMN args_json TEXT NOT NULL DEFAULT '[]'",
+	"ALTER TABLE plugins ADD COLUMN env_json TEXT NOT NULL DEFAULT '{}'",
+	"ALTER TABLE plugins ADD COLUMN url TEXT NOT NULL DEFAULT ''",
+	"ALTER TABLE plugins ADD COLUMN updated_at TEXT",
+	"ALTER TABLE jobs ADD COLUMN runner_id TEXT NOT NULL DEFAULT ''",
+	"ALTER TABLE jobs ADD COLUMN lease_expires_at TEXT",
+	"ALTER TABLE jobs ADD COLUMN attempts INTEGER NOT NULL DEFAULT 0",
+	"ALTER TABLE artifacts ADD COLUMN sha256 TEXT NOT NULL DEFAULT ''",
+	"ALTER TABLE artifacts ADD COLUMN size_bytes INTEGER NOT NULL DEFAULT 0",
+	"ALTER TABLE artifacts ADD COLUMN mime_type TEXT NOT NULL DEFAULT ''",
+	"ALTER TABLE step_runs ADD COLUMN diff_stats_json TEXT NOT NULL DEFAULT '{}'",
+	"ALTER TABLE step_runs ADD COLUMN test_totals_json TEXT NOT NULL DEFAULT '{}'",
+}
+
 func initSchemaWorkforceV2(db *sql.DB) error {
 	schemaBytes, err := readSchemaV2()
 	if err != nil {
@@ -169,6 +201,9 @@ func initSchemaWorkforceV2(db *sql.DB) error {
 			return fmt.Errorf("apply workforce schema statement: %w", err)
 		}
 	}
+	for _, q := range workforceColumnMigrations {
+		_, _ = db.Exec(q)
+	}
 	if err := seedDefaultWorkforceData(db); err != nil {
 		return err
 	}
@@ -191,6 +226,16 @@ func seedDefaultWorkforceData(db *sql.DB) error {
 		{name: "default workspace", sql: `INSERT INTO workspaces (id,home_id,name) VALUES ('default-workspace','default','Default Workspace') ON CONFLICT(id) DO UPDATE SET home_id=excluded.home_id, name=excluded.name, updated_at=datetime('now')`},
 		{name: "default group", sql: `INSERT INTO groups (id,home_id,workspace_id,name) VALUES ('default-group','default','default-workspace','Default Group') ON CONFLICT(id) DO UPDATE SET home_id=excluded.home_id, workspace_id=excluded.workspace_id, name=excluded.name, updated_at=datetime('now')`},
 		{name: "openclaw connector", sql: `INSERT INTO connectors (id,home_id,code,name,category) VALUES ('openclaw','default','openclaw','OpenClaw','execution_backend') ON CONFLICT(id) DO UPDATE SET home_id=excluded.home_id, code=excluded.code, name=excluded.name, category=excluded.category, updated_at=datetime('now')`},
+		{name: "local connector", sql: `INSERT INTO connectors (id,home_id,code,name,category) VALUES ('local','default','local','Local Worktree','execution_backend') ON CONFLICT(id) DO UPDATE SET home_id=excluded.home_id, code=excluded.code, name=excluded.name, category=excluded.category, updated_at=datetime('now')`},
+		{name: "llm connector", sql: `INSERT INTO connectors (id,home_id,code,name,category) VALUES ('llm','default','llm','LLM Chat Completion','execution_backend') ON CONFLICT(id) DO UPDATE SET home_id=excluded.home_id, code=excluded.code, name=excluded.name, category=excluded.category, updated_at=datetime('now')`},
+		{name: "agent connector", sql: `INSERT INTO connectors (id,home_id,code,name,category) VALUES ('agent','default','agent','Tool-calling Agent','execution_backend') ON CONFLICT(id) DO UPDATE SET home_id=excluded.home_id, code=excluded.code, name=excluded.name, category=excluded.category, updated_at=datetime('now')`},
+		{name: "runner connector", sql: `INSERT INTO connectors (id,home_id,code,name,category) VALUES ('runner','default','runner','Remote Runner','execution_backend') ON CONFLICT(id) DO UPDATE SET home_id=excluded.home_id, code=excluded.code, name=excluded.name, category=excluded.category, updated_at=datetime('now')`},
+		{name: "pull request connector", sql: `INSERT INTO connectors (id,home_id,code,name,category) VALUES ('pull_request','default','pull_request','Pull Request','execution_backend') ON CONFLICT(id) DO UPDATE SET home_id=excluded.home_id, code=excluded.code, name=excluded.name, category=excluded.category, updated_at=datetime('now')`},
+		{name: "gitea connector", sql: `INSERT INTO connectors (id,home_id,code,name,category) VALUES ('gitea','default','gitea','Gitea','git_hosting') ON CONFLICT(id) DO UPDATE SET home_id=excluded.home_id, code=excluded.code, name=excluded.name, category=excluded.category, updated_at=datetime('now')`},
+		{name: "github connector", sql: `INSERT INTO connectors (id,home_id,code,name,category) VALUES ('github','default','github','GitHub','git_hosting') ON CONFLICT(id) DO UPDATE SET home_id=excluded.home_id, code=excluded.code, name=excluded.name, category=excluded.category, updated_at=datetime('now')`},
+		{name: "openai-compatible connector", sql: `INSERT INTO connectors (id,home_id,code,name,category) VALUES ('openai_compatible','default','openai_compatible','OpenAI-compatible API','model_provider') ON CONFLICT(id) DO UPDATE SET home_id=excluded.home_id, code=excluded.code, name=excluded.name, category=excluded.category, updated_at=datetime('now')`},
+		{name: "anthropic connector", sql: `INSERT INTO connectors (id,home_id,code,name,category) VALUES ('anthropic','default','anthropic','Anthropic Messages API','model_provider') ON CONFLICT(id) DO UPDATE SET home_id=excluded.home_id, code=excluded.code, name=excluded.name, category=excluded.category, updated_at=datetime('now')`},
+		{name: "ollama connector", sql: `INSERT INTO connectors (id,home_id,code,name,category) VALUES ('ollama','default','ollama','Ollama','model_provider') ON CONFLICT(id) DO UPDATE SET home_id=excluded.home_id, code=excluded.code, name=excluded.name, category=excluded.category, updated_at=datetime('now')`},
 		{name: "default workspace runtime config", sql: `INSERT INTO workspace_runtime_configs (workspace_id,repo_path,default_branch,created_at,updated_at) VALUES ('default-workspace','.','main',datetime('now'),datetime('now')) ON CONFLICT(workspace_id) DO UPDATE SET repo_path=excluded.repo_path, default_branch=excluded.default_branch, updated_at=datetime('now')`},
 	}
 	for _, stmt := range seedStatements {
@@ -304,7 +349,7 @@ func tableNameFromCreate(statement string) (string, bool) {
 
 func isWorkforceTable(table string) bool {
 	switch table {
-	case "homes", "workspaces", "groups", "roles", "model_profiles", "connectors", "integration_instances", "plugins", "skills", "agent_apps", "agent_app_skills", "agent_app_plugins", "execution_backends", "workers", "workflow_templates", "workflow_step_templates", "boards", "tasks", "workflow_runs", "step_runs", "jobs", "artifacts":
+	case "homes", "workspaces", "groups", "roles", "model_profiles", "connectors", "integration_instances", "plugins", "skills", "agent_apps", "agent_app_skills", "agent_app_plugins", "execution_backends", "workers", "workflow_templates", "workflow_step_templates", "boards", "tasks", "workflow_runs", "step_runs", "jobs", "job_logs", "job_callback_nonces", "artifacts", "tool_calls", "runners", "runner_backends", "runner_enrollment_tokens", "artifact_blobs", "test_runs", "test_cases", "workspace_repos", "run_worktrees", "pull_requests", "branch_protection_rules", "git_operation_attempts":
 		return true
 	default:
 		return false
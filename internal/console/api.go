@@ -9,10 +9,12 @@ import (
 	"time"
 
 	"github.com/PonyDevAI/Bull-Board/internal/common"
+	"github.com/PonyDevAI/Bull-Board/internal/console/protection"
 	"github.com/PonyDevAI/Bull-Board/internal/console/workflows"
 )
 
-// apiWorkspaces 处理 GET/POST /api/workspaces、GET /api/workspaces/:id
+// apiWorkspaces 处理 GET/POST /api/workspaces、GET /api/workspaces/:id、/api/workspaces/:id/repo*、
+// /api/workspaces/:id/branch-protection*、GET /api/workspaces/:id/git-operations
 func (s *Server) apiWorkspaces(w http.ResponseWriter, r *http.Request) {
 	if s.db == nil {
 		http.Error(w, `{"error":"db not configured"}`, http.StatusServiceUnavailable)
@@ -33,6 +35,18 @@ func (s *Server) apiWorkspaces(w http.ResponseWriter, r *http.Request) {
 	}
 	if strings.HasPrefix(path, "/api/workspaces/") {
 		id := strings.TrimPrefix(path, "/api/workspaces/")
+		if wsID, sub, ok := strings.Cut(id, "/"); ok && wsID != "" && (sub == "repo" || strings.HasPrefix(sub, "repo/")) {
+			s.apiWorkspaceRepo(w, r, wsID, strings.TrimPrefix(strings.TrimPrefix(sub, "repo"), "/"))
+			return
+		}
+		if wsID, sub, ok := strings.Cut(id, "/"); ok && wsID != "" && (sub == "branch-protection" || strings.HasPrefix(sub, "branch-protection/")) {
+			s.apiBranchProtection(w, r, wsID, strings.TrimPrefix(strings.TrimPrefix(sub, "branch-protection"), "/"))
+			return
+		}
+		if wsID, sub, ok := strings.Cut(id, "/"); ok && wsID != "" && sub == "git-operations" {
+			s.listGitOperations(w, r, wsID)
+			return
+		}
 		if id == "" || strings.Contains(id, "/") {
 			http.NotFound(w, r)
 			return
@@ -79,7 +93,11 @@ func (s *Server) getWorkspace(w http.ResponseWriter, id string) {
 		writeJSONError(w, "db", http.StatusInternalServerError)
 		return
 	}
-	writeJSON(w, map[string]any{"id": id, "name": name, "repoPath": repoPath, "defaultBranch": defaultBranch, "createdAt": createdAt})
+	out := map[string]any{"id": id, "name": name, "repoPath": repoPath, "defaultBranch": defaultBranch, "createdAt": createdAt}
+	if repo, err := s.repos.Get(id); err == nil {
+		out["repo"] = repo
+	}
+	writeJSON(w, out)
 }
 
 func (s *Server) createWorkspace(w http.ResponseWriter, r *http.Request) {
@@ -166,6 +184,11 @@ func (s *Server) apiTasks(w http.ResponseWriter, r *http.Request) {
 			s.updateTaskStatus(w, r, taskID)
 			return
 		}
+	case "important":
+		if r.Method == http.MethodPost {
+			s.updateTaskImportant(w, r, taskID)
+			return
+		}
 	case "messages":
 		if r.Method == http.MethodGet {
 			s.listMessages(w, taskID)
@@ -180,6 +203,11 @@ func (s *Server) apiTasks(w http.ResponseWriter, r *http.Request) {
 			s.listRuns(w, taskID)
 			return
 		}
+	case "pull-requests":
+		if r.Method == http.MethodGet {
+			s.listTaskPullRequests(w, r, taskID)
+			return
+		}
 	case "enqueue":
 		if r.Method == http.MethodPost {
 			s.enqueueTask(w, r, taskID)
@@ -221,7 +249,7 @@ func (s *Server) listTasks(w http.ResponseWriter, r *http.Request) {
 	q := r.URL.Query()
 	workspaceID := q.Get("workspace_id")
 	status := q.Get("status")
-	sqlStr := `SELECT t.id, t.workspace_id, t.title, t.description, t.status, t.plan_round, t.fix_round, t.submit_state, t.created_at, t.updated_at, w.name as workspace_name
+	sqlStr := `SELECT t.id, t.workspace_id, t.title, t.description, t.status, t.plan_round, t.fix_round, t.submit_state, t.important, t.created_at, t.updated_at, w.name as workspace_name
 		FROM legacy_tasks t LEFT JOIN workspaces w ON t.workspace_id = w.id WHERE 1=1`
 	args := []any{}
 	if workspaceID != "" {
@@ -249,15 +277,16 @@ func (s *Server) listTasks(w http.ResponseWriter, r *http.Request) {
 	for rows.Next() {
 		var id, workspaceId, title, desc, st, submitState, createdAt, updatedAt string
 		var planRound, fixRound int
+		var important bool
 		var workspaceName sql.NullString
-		if err := rows.Scan(&id, &workspaceId, &title, &desc, &st, &planRound, &fixRound, &submitState, &createdAt, &updatedAt, &workspaceName); err != nil {
+		if err := rows.Scan(&id, &workspaceId, &title, &desc, &st, &planRound, &fixRound, &submitState, &important, &createdAt, &updatedAt, &workspaceName); err != nil {
 			continue
 		}
 		derivedStatus := s.deriveTaskExecutionStatus(id, st)
 		m := map[string]any{
 			"id": id, "workspaceId": workspaceId, "title": title, "description": desc, "status": derivedStatus,
 			"legacyStatus": st,
-			"planRound":    planRound, "fixRound": fixRound, "submitState": submitState, "createdAt": createdAt, "updatedAt": updatedAt,
+			"planRound":    planRound, "fixRound": fixRound, "submitState": submitState, "important": important, "createdAt": createdAt, "updatedAt": updatedAt,
 		}
 		m["statusSource"] = "workflow_run"
 		if derivedStatus == st {
@@ -275,8 +304,9 @@ func (s *Server) getTask(w http.ResponseWriter, id string) {
 	var workspaceId, title, desc, status, submitState, createdAt, updatedAt string
 	var workflowTemplateID sql.NullString
 	var planRound, fixRound int
-	err := s.db.QueryRow(`SELECT workspace_id, title, description, status, plan_round, fix_round, submit_state, created_at, updated_at, workflow_template_id FROM legacy_tasks WHERE id = ?`, id).
-		Scan(&workspaceId, &title, &desc, &status, &planRound, &fixRound, &submitState, &createdAt, &updatedAt, &workflowTemplateID)
+	var important bool
+	err := s.db.QueryRow(`SELECT workspace_id, title, description, status, plan_round, fix_round, submit_state, important, created_at, updated_at, workflow_template_id FROM legacy_tasks WHERE id = ?`, id).
+		Scan(&workspaceId, &title, &desc, &status, &planRound, &fixRound, &submitState, &important, &createdAt, &updatedAt, &workflowTemplateID)
 	if err == sql.ErrNoRows {
 		writeJSONError(w, "Not found", http.StatusNotFound)
 		return
@@ -289,7 +319,7 @@ func (s *Server) getTask(w http.ResponseWriter, id string) {
 	task := map[string]any{
 		"id": id, "workspaceId": workspaceId, "title": title, "description": desc, "status": derivedStatus,
 		"legacyStatus": status,
-		"planRound":    planRound, "fixRound": fixRound, "submitState": submitState, "createdAt": createdAt, "updatedAt": updatedAt,
+		"planRound":    planRound, "fixRound": fixRound, "submitState": submitState, "important": important, "createdAt": createdAt, "updatedAt": updatedAt,
 	}
 	task["statusSource"] = "workflow_run"
 	if derivedStatus == status {
@@ -424,6 +454,29 @@ func (s *Server) updateTaskStatus(w http.ResponseWriter, r *http.Request, taskID
 	writeJSON(w, map[string]any{"id": taskID, "workspaceId": workspaceId, "title": title, "description": desc, "status": status, "planRound": planRound, "fixRound": fixRound, "submitState": submitState, "createdAt": createdAt, "updatedAt": updatedAt})
 }
 
+// updateTaskImportant 标记/取消重要任务；重要任务的 run 与产物不受保留策略清理
+func (s *Server) updateTaskImportant(w http.ResponseWriter, r *http.Request, taskID string) {
+	var body struct {
+		Important *bool `json:"important"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Important == nil {
+		writeJSONError(w, "important required", http.StatusBadRequest)
+		return
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	res, err := s.db.Exec(`UPDATE legacy_tasks SET important = ?, updated_at = ? WHERE id = ?`, *body.Important, now, taskID)
+	if err != nil {
+		writeJSONError(w, "db", http.StatusInternalServerError)
+		return
+	}
+	n, _ := res.RowsAffected()
+	if n == 0 {
+		writeJSONError(w, "Not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, map[string]any{"id": taskID, "important": *body.Important, "updatedAt": now})
+}
+
 func (s *Server) listMessages(w http.ResponseWriter, taskID string) {
 	rows, err := s.db.Query(`SELECT id, task_id, round_type, round_no, author, content, created_at FROM legacy_messages WHERE task_id = ? ORDER BY id ASC`, taskID)
 	if err != nil {
@@ -569,13 +622,27 @@ func (s *Server) enqueue(p runEnqueueParams) (runId, jobId string) {
 }
 
 func (s *Server) actionSubmit(w http.ResponseWriter, taskID string) {
-	var taskTitle, workspaceId, repoPath, defaultBranch string
-	err := s.db.QueryRow(`SELECT t.title, t.workspace_id, COALESCE(c.repo_path,''), COALESCE(c.default_branch,'main') FROM legacy_tasks t JOIN workspaces w ON t.workspace_id = w.id LEFT JOIN workspace_runtime_configs c ON c.workspace_id = w.id WHERE t.id = ?`, taskID).
-		Scan(&taskTitle, &workspaceId, &repoPath, &defaultBranch)
+	runId, jobId, err := s.submitTask(taskID)
 	if err == sql.ErrNoRows {
 		writeJSONError(w, "Not found", http.StatusNotFound)
 		return
 	}
+	if err != nil {
+		writeGitOperationError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	writeJSON(w, map[string]any{"runId": runId, "jobId": jobId})
+}
+
+// submitTask 为任务排入 SUBMIT job（commit 并 push 到任务分支）；push 先经分支保护检查
+func (s *Server) submitTask(taskID string) (runId, jobId string, err error) {
+	var taskTitle, workspaceId, repoPath, defaultBranch string
+	err = s.db.QueryRow(`SELECT t.title, t.workspace_id, COALESCE(c.repo_path,''), COALESCE(c.default_branch,'main') FROM legacy_tasks t JOIN workspaces w ON t.workspace_id = w.id LEFT JOIN workspace_runtime_configs c ON c.workspace_id = w.id WHERE t.id = ?`, taskID).
+		Scan(&taskTitle, &workspaceId, &repoPath, &defaultBranch)
+	if err != nil {
+		return "", "", err
+	}
 	if defaultBranch == "" {
 		defaultBranch = "main"
 	}
@@ -584,15 +651,17 @@ func (s *Server) actionSubmit(w http.ResponseWriter, taskID string) {
 	if branch == "" {
 		branch = "bb/task-" + taskID + "-submit"
 	}
+	if _, err := s.protection.Check(protection.Operation{WorkspaceID: workspaceId, Operation: protection.OpPush, Branch: branch, Source: "submit", TaskID: taskID}); err != nil {
+		return "", "", err
+	}
 	payload := map[string]any{
 		"workspace":        map[string]any{"repo_path": repoPath, "base_branch": defaultBranch},
 		"workdir_strategy": "git_worktree",
 		"branch":           branch,
 		"submit":           map[string]any{"actions": []string{"commit", "push"}, "commit_message": "BullBoard: " + taskTitle, "remote": "origin"},
 	}
-	runId, jobId := s.enqueue(runEnqueueParams{TaskID: taskID, WorkspaceID: workspaceId, Mode: "SUBMIT", Payload: payload, AssignedWorkerID: "default"})
-	w.WriteHeader(http.StatusCreated)
-	writeJSON(w, map[string]any{"runId": runId, "jobId": jobId})
+	runId, jobId = s.enqueue(runEnqueueParams{TaskID: taskID, WorkspaceID: workspaceId, Mode: "SUBMIT", Payload: payload, AssignedWorkerID: "default"})
+	return runId, jobId, nil
 }
 
 func (s *Server) actionReplan(w http.ResponseWriter, taskID string) {
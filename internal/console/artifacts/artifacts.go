@@ -0,0 +1,257 @@
+package artifacts
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/PonyDevAI/Bull-Board/internal/common"
+)
+
+var (
+	ErrArtifactNotFound = errors.New("artifact not found")
+	// ErrNoContent means the artifact only has a URI the console cannot read,
+	// e.g. a link into a remote backend.
+	ErrNoContent = errors.New("artifact content not stored")
+)
+
+// Artifact is an artifacts row. SHA256, Size and MIMEType are set once the
+// content is in the store.
+type Artifact struct {
+	ID        string         `json:"id"`
+	JobID     string         `json:"job_id"`
+	StepRunID string         `json:"step_run_id"`
+	Kind      string         `json:"kind"`
+	URI       string         `json:"uri"`
+	Metadata  map[string]any `json:"metadata"`
+	SHA256    string         `json:"sha256"`
+	Size      int64          `json:"size_bytes"`
+	MIMEType  string         `json:"mime_type"`
+	CreatedAt string         `json:"created_at"`
+}
+
+// Service records artifact rows against blobs in a Store rooted at
+// <dataDir>/artifacts. With an empty dataDir it records rows only.
+type Service struct {
+	db      *sql.DB
+	store   *Store
+	dataDir string
+}
+
+func NewService(db *sql.DB, dataDir string) *Service {
+	return &Service{db: db, store: NewStore(filepath.Join(dataDir, "artifacts")), dataDir: dataDir}
+}
+
+// Store returns the blob store.
+func (s *Service) Store() *Store { return s.store }
+
+// Record notes a stored blob in artifact_blobs.
+func (s *Service) Record(b Blob) error {
+	_, err := s.db.Exec(`INSERT INTO artifact_blobs (sha256, size_bytes, mime_type, created_at) VALUES (?, ?, ?, ?) ON CONFLICT(sha256) DO NOTHING`,
+		b.SHA256, b.Size, b.MIMEType, time.Now().UTC().Format(time.RFC3339))
+	return err
+}
+
+// Ingest brings the content behind uri, reported for jobID, into the store.
+// It understands blob URIs of content uploaded for the same job and local
+// files ("file://" URIs or paths relative to the data directory) inside one
+// of roots, which are only given for content produced in this process;
+// anything else reports false. A blob stored for another job is not
+// reachable by naming its hash.
+func (s *Service) Ingest(jobID, uri string, roots []string) (Blob, bool, error) {
+	if s.dataDir == "" {
+		return Blob{}, false, nil
+	}
+	if sum, ok := ParseBlobURI(uri); ok {
+		if owned, err := s.uploadedFor(jobID, sum); err != nil || !owned {
+			return Blob{}, false, err
+		}
+		return s.blob(sum)
+	}
+	path, ok := s.localPath(uri, roots)
+	if !ok {
+		return Blob{}, false, nil
+	}
+	b, err := s.store.PutFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return Blob{}, false, nil
+	}
+	if err != nil {
+		return Blob{}, false, err
+	}
+	return b, true, s.Record(b)
+}
+
+// uploadedFor reports whether jobID already has an artifact stored as sum,
+// i.e. the job's backend uploaded that content itself.
+func (s *Service) uploadedFor(jobID, sum string) (bool, error) {
+	if jobID == "" {
+		return false, nil
+	}
+	var n int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM artifacts WHERE job_id = ? AND sha256 = ?`, jobID, sum).Scan(&n)
+	return n > 0, err
+}
+
+// blob returns the recorded metadata of a stored blob.
+func (s *Service) blob(sum string) (Blob, bool, error) {
+	if !s.store.Has(sum) {
+		return Blob{}, false, nil
+	}
+	b := Blob{SHA256: sum}
+	err := s.db.QueryRow(`SELECT size_bytes, mime_type FROM artifact_blobs WHERE sha256 = ?`, sum).Scan(&b.Size, &b.MIMEType)
+	if err == sql.ErrNoRows {
+		// Stored by hand or before artifact_blobs was recorded: describe it from the file.
+		f, err := s.store.Open(sum)
+		if err != nil {
+			return Blob{}, false, err
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			return Blob{}, false, err
+		}
+		head := make([]byte, sniffLen)
+		n, _ := io.ReadFull(f, head)
+		b.Size, b.MIMEType = info.Size(), DetectMIME("", head[:n])
+		return b, true, s.Record(b)
+	}
+	return b, err == nil, err
+}
+
+// localPath resolves uri to a file inside one of roots. Symlinks are
+// resolved first so a link cannot point the check elsewhere.
+func (s *Service) localPath(uri string, roots []string) (string, bool) {
+	if uri == "" || len(roots) == 0 {
+		return "", false
+	}
+	p := uri
+	if rest, ok := strings.CutPrefix(uri, "file://"); ok {
+		p = rest
+	} else if strings.Contains(uri, "://") {
+		return "", false
+	}
+	if !filepath.IsAbs(p) {
+		dataDir, err := filepath.Abs(s.dataDir)
+		if err != nil {
+			return "", false
+		}
+		p = filepath.Join(dataDir, p)
+	}
+	p, err := filepath.EvalSymlinks(p)
+	if err != nil {
+		return "", false
+	}
+	for _, root := range roots {
+		root, err := filepath.EvalSymlinks(root)
+		if err != nil {
+			continue
+		}
+		if root, err = filepath.Abs(root); err == nil && strings.HasPrefix(p, root+string(filepath.Separator)) {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+// JobDir is the directory of a job's own files under the data directory.
+func (s *Service) JobDir(jobID string) string {
+	return filepath.Join(s.dataDir, "artifacts", "jobs", jobID)
+}
+
+// Create inserts an artifact row. ID and CreatedAt are filled in when empty.
+func (s *Service) Create(a Artifact) (Artifact, error) {
+	if a.ID == "" {
+		a.ID = common.UUID()
+	}
+	if a.CreatedAt == "" {
+		a.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+	}
+	if a.Metadata == nil {
+		a.Metadata = map[string]any{}
+	}
+	metadataJSON, err := json.Marshal(a.Metadata)
+	if err != nil {
+		return a, err
+	}
+	var stepRunID any
+	if a.StepRunID != "" {
+		stepRunID = a.StepRunID
+	}
+	_, err = s.db.Exec(`INSERT INTO artifacts (id, job_id, step_run_id, kind, uri, metadata_json, sha256, size_bytes, mime_type, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		a.ID, a.JobID, stepRunID, a.Kind, a.URI, string(metadataJSON), a.SHA256, a.Size, a.MIMEType, a.CreatedAt)
+	return a, err
+}
+
+// Get returns one artifact.
+func (s *Service) Get(id string) (Artifact, error) {
+	items, err := s.query(`WHERE id = ?`, id)
+	if err != nil {
+		return Artifact{}, err
+	}
+	if len(items) == 0 {
+		return Artifact{}, ErrArtifactNotFound
+	}
+	return items[0], nil
+}
+
+// ListByJob returns a job's artifacts in creation order.
+func (s *Service) ListByJob(jobID string) ([]Artifact, error) {
+	return s.query(`WHERE job_id = ? ORDER BY created_at ASC, rowid ASC`, jobID)
+}
+
+func (s *Service) query(where string, args ...any) ([]Artifact, error) {
+	rows, err := s.db.Query(`SELECT id, job_id, COALESCE(step_run_id,''), kind, uri, metadata_json, sha256, size_bytes, mime_type, created_at FROM artifacts `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Artifact{}
+	for rows.Next() {
+		var a Artifact
+		var metadataJSON string
+		if err := rows.Scan(&a.ID, &a.JobID, &a.StepRunID, &a.Kind, &a.URI, &metadataJSON, &a.SHA256, &a.Size, &a.MIMEType, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		_ = json.Unmarshal([]byte(metadataJSON), &a.Metadata)
+		items = append(items, a)
+	}
+	return items, rows.Err()
+}
+
+// Open returns an artifact and a reader over its content. Rows written before
+// the store existed are ingested on first access from the job's own
+// directory and updated to reference the blob.
+func (s *Service) Open(id string) (Artifact, *os.File, error) {
+	a, err := s.Get(id)
+	if err != nil {
+		return a, nil, err
+	}
+	if a.SHA256 == "" {
+		var roots []string
+		if a.JobID != "" {
+			roots = []string{s.JobDir(a.JobID)}
+		}
+		b, ok, err := s.Ingest(a.JobID, a.URI, roots)
+		if err != nil {
+			return a, nil, err
+		}
+		if !ok {
+			return a, nil, ErrNoContent
+		}
+		if _, err := s.db.Exec(`UPDATE artifacts SET sha256 = ?, size_bytes = ?, mime_type = ? WHERE id = ?`, b.SHA256, b.Size, b.MIMEType, a.ID); err != nil {
+			return a, nil, err
+		}
+		a.SHA256, a.Size, a.MIMEType = b.SHA256, b.Size, b.MIMEType
+	}
+	f, err := s.store.Open(a.SHA256)
+	if errors.Is(err, ErrBlobNotFound) {
+		return a, nil, ErrNoContent
+	}
+	return a, f, err
+}
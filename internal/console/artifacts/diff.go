@@ -0,0 +1,27 @@
+package artifacts
+
+import (
+	"errors"
+	"io"
+
+	"github.com/PonyDevAI/Bull-Board/internal/console/diffs"
+)
+
+// MaxDiffSize bounds the diffs ParseDiff reads; larger ones are only served raw.
+const MaxDiffSize = 64 << 20
+
+var ErrDiffTooLarge = errors.New("diff too large to parse")
+
+// ParseDiff parses a stored artifact's content as a unified diff.
+func (s *Service) ParseDiff(id string) (Artifact, *diffs.Diff, error) {
+	a, f, err := s.Open(id)
+	if err != nil {
+		return a, nil, err
+	}
+	defer f.Close()
+	if a.Size > MaxDiffSize {
+		return a, nil, ErrDiffTooLarge
+	}
+	d, err := diffs.Parse(io.LimitReader(f, MaxDiffSize))
+	return a, d, err
+}
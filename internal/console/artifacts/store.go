@@ -0,0 +1,229 @@
+// Package artifacts stores job artifact content under PREFIX/data/artifacts,
+// addressed by sha256, and maps artifact rows to the blobs they reference.
+package artifacts
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// BlobURIPrefix marks artifact URIs that name a stored blob, e.g. "sha256:9f86d0…".
+const BlobURIPrefix = "sha256:"
+
+// sniffLen is how much of a blob is inspected to guess its MIME type.
+const sniffLen = 512
+
+var (
+	ErrBlobNotFound = errors.New("artifact blob not found")
+	ErrInvalidHash  = errors.New("invalid sha256")
+)
+
+// Blob describes stored content.
+type Blob struct {
+	SHA256   string `json:"sha256"`
+	Size     int64  `json:"size_bytes"`
+	MIMEType string `json:"mime_type"`
+}
+
+// URI returns the artifact URI naming the blob.
+func (b Blob) URI() string { return BlobURIPrefix + b.SHA256 }
+
+// Store keeps blobs at <Root>/blobs/sha256/<first two hex>/<hex>. Writes go
+// through <Root>/tmp and are renamed into place, so a blob path only ever holds
+// complete content and identical uploads share one file.
+type Store struct {
+	Root string
+}
+
+func NewStore(root string) *Store {
+	return &Store{Root: root}
+}
+
+// Path returns where the blob with the given hash lives.
+func (s *Store) Path(sum string) (string, error) {
+	if !ValidHash(sum) {
+		return "", ErrInvalidHash
+	}
+	return filepath.Join(s.Root, "blobs", "sha256", sum[:2], sum), nil
+}
+
+// Open opens a stored blob for reading.
+func (s *Store) Open(sum string) (*os.File, error) {
+	p, err := s.Path(sum)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrBlobNotFound
+	}
+	return f, err
+}
+
+// Has reports whether the blob is stored.
+func (s *Store) Has(sum string) bool {
+	p, err := s.Path(sum)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(p)
+	return err == nil
+}
+
+// Staged is content written to the store's temp area but not yet visible
+// under its hash. Callers that must check the content first (e.g. a signature
+// over the streamed body) decide between Commit and Discard.
+type Staged struct {
+	Blob
+	store *Store
+	tmp   string
+}
+
+// Stage streams r into a temp file, hashing and sizing it on the way. name is
+// only used to guess the MIME type.
+func (s *Store) Stage(r io.Reader, name string) (*Staged, error) {
+	dir := filepath.Join(s.Root, "tmp")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.CreateTemp(dir, "blob-*")
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	sniff := &headWriter{max: sniffLen}
+	size, err := io.Copy(io.MultiWriter(f, h, sniff), r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return nil, err
+	}
+	return &Staged{
+		Blob:  Blob{SHA256: hex.EncodeToString(h.Sum(nil)), Size: size, MIMEType: DetectMIME(name, sniff.buf)},
+		store: s,
+		tmp:   f.Name(),
+	}, nil
+}
+
+// Commit moves the staged content to its blob path. Content already stored
+// under the same hash is kept and the staged copy dropped.
+func (st *Staged) Commit() (Blob, error) {
+	p, err := st.store.Path(st.SHA256)
+	if err != nil {
+		return Blob{}, err
+	}
+	if _, err := os.Stat(p); err == nil {
+		_ = os.Remove(st.tmp)
+		return st.Blob, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		_ = os.Remove(st.tmp)
+		return Blob{}, err
+	}
+	if err := os.Rename(st.tmp, p); err != nil {
+		_ = os.Remove(st.tmp)
+		return Blob{}, err
+	}
+	return st.Blob, nil
+}
+
+// Discard drops the staged content.
+func (st *Staged) Discard() {
+	_ = os.Remove(st.tmp)
+}
+
+// Put streams r into the store and returns the stored blob.
+func (s *Store) Put(r io.Reader, name string) (Blob, error) {
+	st, err := s.Stage(r, name)
+	if err != nil {
+		return Blob{}, err
+	}
+	return st.Commit()
+}
+
+// PutFile copies an existing file into the store.
+func (s *Store) PutFile(path string) (Blob, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Blob{}, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return Blob{}, err
+	}
+	if !info.Mode().IsRegular() {
+		return Blob{}, fmt.Errorf("%s is not a regular file", path)
+	}
+	return s.Put(f, path)
+}
+
+// ValidHash reports whether sum is a lowercase hex sha256.
+func ValidHash(sum string) bool {
+	if len(sum) != sha256.Size*2 {
+		return false
+	}
+	for _, c := range sum {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseBlobURI returns the hash named by a "sha256:<hex>" artifact URI.
+func ParseBlobURI(uri string) (string, bool) {
+	sum, ok := strings.CutPrefix(uri, BlobURIPrefix)
+	return sum, ok && ValidHash(sum)
+}
+
+// textTypes are extensions the mime package does not know (or maps to
+// something unhelpful) that artifacts commonly use.
+var textTypes = map[string]string{
+	".patch": "text/x-diff",
+	".diff":  "text/x-diff",
+	".log":   "text/plain; charset=utf-8",
+	".jsonl": "application/x-ndjson",
+	".tap":   "text/plain; charset=utf-8",
+}
+
+// DetectMIME guesses a MIME type from the file name, falling back to
+// sniffing the first bytes of the content.
+func DetectMIME(name string, head []byte) string {
+	ext := strings.ToLower(filepath.Ext(name))
+	if t, ok := textTypes[ext]; ok {
+		return t
+	}
+	if ext != "" {
+		if t := mime.TypeByExtension(ext); t != "" {
+			return t
+		}
+	}
+	return http.DetectContentType(head)
+}
+
+// headWriter keeps the first max bytes written to it.
+type headWriter struct {
+	buf []byte
+	max int
+}
+
+func (w *headWriter) Write(p []byte) (int, error) {
+	if room := w.max - len(w.buf); room > 0 {
+		if len(p) < room {
+			room = len(p)
+		}
+		w.buf = append(w.buf, p[:room]...)
+	}
+	return len(p), nil
+}
@@ -0,0 +1,108 @@
+package artifacts
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPutDeduplicatesContent(t *testing.T) {
+	s := NewStore(t.TempDir())
+	a, err := s.Put(strings.NewReader("--- a\n+++ b\n"), "diff.patch")
+	if err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	if a.Size != 12 || a.MIMEType != "text/x-diff" || !ValidHash(a.SHA256) {
+		t.Fatalf("unexpected blob %+v", a)
+	}
+	b, err := s.Put(strings.NewReader("--- a\n+++ b\n"), "")
+	if err != nil || b.SHA256 != a.SHA256 {
+		t.Fatalf("second put %+v, %v", b, err)
+	}
+	f, err := s.Open(a.SHA256)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	data, _ := io.ReadAll(f)
+	f.Close()
+	if string(data) != "--- a\n+++ b\n" {
+		t.Fatalf("content %q", data)
+	}
+	if tmp, _ := os.ReadDir(filepath.Join(s.Root, "tmp")); len(tmp) != 0 {
+		t.Fatalf("temp files left behind: %v", tmp)
+	}
+}
+
+func TestDiscardedStageIsNotStored(t *testing.T) {
+	s := NewStore(t.TempDir())
+	st, err := s.Stage(strings.NewReader("unsigned"), "x.bin")
+	if err != nil {
+		t.Fatalf("stage: %v", err)
+	}
+	st.Discard()
+	if s.Has(st.SHA256) {
+		t.Fatalf("discarded content is visible")
+	}
+	if _, err := s.Open(st.SHA256); err != ErrBlobNotFound {
+		t.Fatalf("expected ErrBlobNotFound, got %v", err)
+	}
+	if _, err := s.Open("../../etc/passwd"); err != ErrInvalidHash {
+		t.Fatalf("expected ErrInvalidHash, got %v", err)
+	}
+}
+
+func TestDetectMIME(t *testing.T) {
+	for _, tc := range []struct {
+		name, head, want string
+	}{
+		{"execution.log", "", "text/plain; charset=utf-8"},
+		{"trace.jsonl", "", "application/x-ndjson"},
+		{"report.json", "", "application/json"},
+		{"", "\x89PNG\r\n\x1a\n", "image/png"},
+		{"noext", "hello", "text/plain; charset=utf-8"},
+	} {
+		if got := DetectMIME(tc.name, []byte(tc.head)); got != tc.want {
+			t.Errorf("DetectMIME(%q) = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestLocalPathStaysInRoots(t *testing.T) {
+	dir := t.TempDir()
+	jobDir := filepath.Join(dir, "artifacts/jobs/j")
+	if err := os.MkdirAll(filepath.Join(dir, "db"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(jobDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"artifacts/jobs/j/execution.log", "artifacts/jobs/j/diff.patch", "db/bb.sqlite", "artifacts/jobs/other.log"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(dir, "db/bb.sqlite"), filepath.Join(jobDir, "db.link")); err != nil {
+		t.Fatal(err)
+	}
+	s := &Service{dataDir: dir}
+	roots := []string{jobDir}
+	for uri, want := range map[string]bool{
+		"file://" + filepath.Join(jobDir, "execution.log"): true,
+		"artifacts/jobs/j/diff.patch":                      true,
+		"file://" + filepath.Join(dir, "db/bb.sqlite"):     false,
+		"file://" + filepath.Join(jobDir, "db.link"):       false,
+		"artifacts/jobs/j/../other.log":                    false,
+		"file:///etc/passwd":                               false,
+		"../outside.txt":                                   false,
+		"openclaw://runs/step-1/log":                       false,
+	} {
+		if _, ok := s.localPath(uri, roots); ok != want {
+			t.Errorf("localPath(%q) = %t, want %t", uri, ok, want)
+		}
+	}
+	if _, ok := s.localPath("file://"+filepath.Join(jobDir, "execution.log"), nil); ok {
+		t.Errorf("localPath without roots accepted a file")
+	}
+}
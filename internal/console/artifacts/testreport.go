@@ -0,0 +1,29 @@
+package artifacts
+
+import (
+	"errors"
+	"io"
+
+	"github.com/PonyDevAI/Bull-Board/internal/console/testreports"
+)
+
+// MaxTestReportSize bounds the test reports ParseTestReport reads.
+const MaxTestReportSize = 64 << 20
+
+var ErrTestReportTooLarge = errors.New("test report too large to parse")
+
+// ParseTestReport parses a stored artifact's content as a test report. The
+// format is taken from the artifact's "format" metadata, or detected.
+func (s *Service) ParseTestReport(id string) (Artifact, *testreports.Report, error) {
+	a, f, err := s.Open(id)
+	if err != nil {
+		return a, nil, err
+	}
+	defer f.Close()
+	if a.Size > MaxTestReportSize {
+		return a, nil, ErrTestReportTooLarge
+	}
+	format, _ := a.Metadata["format"].(string)
+	rep, err := testreports.Parse(format, io.LimitReader(f, MaxTestReportSize))
+	return a, rep, err
+}
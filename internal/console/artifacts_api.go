@@ -0,0 +1,149 @@
+package console
+
+import (
+	"errors"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PonyDevAI/Bull-Board/internal/console/artifacts"
+	"github.com/PonyDevAI/Bull-Board/internal/console/diffs"
+)
+
+// maxArtifactUpload 限制 runner 与执行后端单个上传产物的大小
+const maxArtifactUpload = 1 << 30
+
+// apiArtifactRoutes 处理 GET /api/artifacts/:id（元数据）、GET /api/artifacts/:id/content（内容，支持 Range）、
+// GET /api/artifacts/:id/diff（解析后的文件列表与统计，不含 hunk）、
+// GET /api/artifacts/:id/diff/files/:index 与 GET /api/artifacts/:id/diff/file?path=（单个文件含 hunk）
+func (s *Server) apiArtifactRoutes(w http.ResponseWriter, r *http.Request) {
+	if s.db == nil {
+		writeJSONError(w, "db not configured", http.StatusServiceUnavailable)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "", http.StatusMethodNotAllowed)
+		return
+	}
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/artifacts"), "/")
+	parts := strings.Split(rest, "/")
+	id := parts[0]
+	switch {
+	case id == "":
+		http.NotFound(w, r)
+	case len(parts) == 1:
+		a, err := s.execution.Artifacts().Get(id)
+		if err != nil {
+			writeArtifactError(w, err)
+			return
+		}
+		writeJSON(w, map[string]any{"item": a})
+	case len(parts) == 2 && parts[1] == "content":
+		s.artifactContent(w, r, id)
+	case parts[1] == "diff":
+		s.artifactDiff(w, r, id, parts[2:])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// artifactDiff 把产物内容按 unified diff 解析；列表接口只给文件摘要，hunk 按文件单独取，避免大 diff 一次返回
+func (s *Server) artifactDiff(w http.ResponseWriter, r *http.Request, id string, sub []string) {
+	index := -1
+	switch {
+	case len(sub) == 0:
+	case len(sub) == 1 && sub[0] == "file":
+	case len(sub) == 2 && sub[0] == "files":
+		n, err := strconv.Atoi(sub[1])
+		if err != nil || n < 0 {
+			http.NotFound(w, r)
+			return
+		}
+		index = n
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	a, d, err := s.execution.Artifacts().ParseDiff(id)
+	if err != nil {
+		writeArtifactError(w, err)
+		return
+	}
+	if len(sub) == 0 {
+		writeJSON(w, map[string]any{"item": map[string]any{"artifact_id": a.ID, "files": d.Summary().Files, "stats": d.Stats}})
+		return
+	}
+	var file *diffs.File
+	if index >= 0 && index < len(d.Files) {
+		file = d.Files[index]
+	} else if index < 0 {
+		file, _ = d.File(r.URL.Query().Get("path"))
+	}
+	if file == nil {
+		writeJSONError(w, "file not in diff", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, map[string]any{"item": file})
+}
+
+// artifactContent 输出产物内容；尚未入库的旧产物（数据目录内的本地文件）在首次下载时写入存储。
+// 内容按 sha256 寻址，ETag 即 hash，Range / If-Range 由 http.ServeContent 处理
+func (s *Server) artifactContent(w http.ResponseWriter, r *http.Request, id string) {
+	a, f, err := s.execution.Artifacts().Open(id)
+	if err != nil {
+		writeArtifactError(w, err)
+		return
+	}
+	defer f.Close()
+	var modTime time.Time
+	if info, err := f.Stat(); err == nil {
+		modTime = info.ModTime()
+	}
+	h := w.Header()
+	h.Set("Content-Type", a.MIMEType)
+	h.Set("ETag", `"`+a.SHA256+`"`)
+	h.Set("Cache-Control", "private, max-age=31536000, immutable")
+	// 产物来自 agent 与外部后端，不允许浏览器按页面渲染或嗅探类型
+	h.Set("X-Content-Type-Options", "nosniff")
+	h.Set("Content-Security-Policy", "sandbox")
+	disposition := "inline"
+	if r.URL.Query().Get("download") == "1" {
+		disposition = "attachment"
+	}
+	h.Set("Content-Disposition", disposition+`; filename="`+artifactFileName(a)+`"`)
+	http.ServeContent(w, r, "", modTime, f)
+}
+
+// artifactFileName 取上传时的文件名，否则取 URI 末段，最后退回 kind
+func artifactFileName(a artifacts.Artifact) string {
+	name, _ := a.Metadata["name"].(string)
+	if name == "" && !strings.HasPrefix(a.URI, artifacts.BlobURIPrefix) {
+		name = path.Base(a.URI)
+	}
+	if name == "" || name == "." || name == "/" {
+		name = a.Kind
+	}
+	return strings.Map(func(c rune) rune {
+		if c < 0x20 || c == '"' || c == '\\' || c == 0x7f {
+			return '_'
+		}
+		return c
+	}, name)
+}
+
+func writeArtifactError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, artifacts.ErrArtifactNotFound):
+		writeJSONError(w, "not found", http.StatusNotFound)
+	case errors.Is(err, artifacts.ErrNoContent):
+		writeJSONError(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, artifacts.ErrDiffTooLarge):
+		writeJSONError(w, err.Error(), http.StatusUnprocessableEntity)
+	case errors.Is(err, diffs.ErrMalformed):
+		writeJSONError(w, err.Error(), http.StatusUnprocessableEntity)
+	default:
+		writeJSONError(w, "artifact store", http.StatusInternalServerError)
+	}
+}
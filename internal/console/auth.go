@@ -220,6 +220,18 @@ func ValidateAPIKey(db *sql.DB, plainKey string) (ok bool) {
 	return true
 }
 
+// APIKeyName 返回有效 API key 的名称与前缀，用于记录操作者身份
+func APIKeyName(db *sql.DB, plainKey string) (name, prefix string, ok bool) {
+	if plainKey == "" {
+		return "", "", false
+	}
+	hashHex, _ := HashAPIKey(plainKey)
+	if err := db.QueryRow(`SELECT name, key_prefix FROM api_keys WHERE key_hash = ? AND (revoked_at IS NULL OR revoked_at = '')`, hashHex).Scan(&name, &prefix); err != nil {
+		return "", "", false
+	}
+	return name, prefix, true
+}
+
 // GetIgnoredVersions 从 settings 读取 ignored_versions JSON array
 func GetIgnoredVersions(db *sql.DB) ([]string, error) {
 	var val string
@@ -24,8 +24,10 @@ func getAPIKey(r *http.Request) string {
 	return ""
 }
 
-// authRequired 要求 session 或 API key 任一通过；若未通过写 401 并返回 false
+// authRequired 要求 session 或 API key 任一通过；若未通过写 401 并返回 false。
+// X-BB-User 只由 session 设置，客户端传入的值被丢弃
 func (s *Server) authRequired(w http.ResponseWriter, r *http.Request) bool {
+	r.Header.Del("X-BB-User")
 	if s.db == nil {
 		writeJSONError(w, "auth not configured", http.StatusServiceUnavailable)
 		return false
@@ -49,6 +51,7 @@ func (s *Server) authRequired(w http.ResponseWriter, r *http.Request) bool {
 
 // sessionRequired 仅要求 session（用于 SSE）；未通过写 401 并返回 false
 func (s *Server) sessionRequired(w http.ResponseWriter, r *http.Request) bool {
+	r.Header.Del("X-BB-User")
 	if s.db == nil {
 		writeJSONError(w, "auth not configured", http.StatusServiceUnavailable)
 		return false
@@ -70,6 +73,18 @@ func (s *Server) sessionRequired(w http.ResponseWriter, r *http.Request) bool {
 	return false
 }
 
+// actor 返回请求的认证身份：session 的用户名，或 "api_key:<名称> (<前缀>)"；
+// 只从 cookie 与 API key 推导，不读取请求头里的 X-BB-User
+func (s *Server) actor(r *http.Request) string {
+	if username, ok := ValidateSession(s.db, getSessionID(r)); ok {
+		return username
+	}
+	if name, prefix, ok := APIKeyName(s.db, getAPIKey(r)); ok {
+		return "api_key:" + name + " (" + prefix + ")"
+	}
+	return ""
+}
+
 func (s *Server) authLogin(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost || r.URL.Path != "/api/auth/login" {
 		http.NotFound(w, r)
@@ -0,0 +1,197 @@
+package console
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/PonyDevAI/Bull-Board/internal/console/protection"
+	"github.com/PonyDevAI/Bull-Board/internal/console/workflows"
+)
+
+// apiBranchProtection 处理工作区分支保护规则：
+// GET/POST /api/workspaces/:id/branch-protection（列出 / 新建）、
+// PUT/DELETE /api/workspaces/:id/branch-protection/:rule_id（整体替换 / 删除）
+func (s *Server) apiBranchProtection(w http.ResponseWriter, r *http.Request, workspaceID, ruleID string) {
+	switch {
+	case ruleID == "" && r.Method == http.MethodGet:
+		items, err := s.protection.Rules(workspaceID)
+		if err != nil {
+			writeJSONError(w, "db", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, map[string]any{"items": items})
+	case ruleID == "" && r.Method == http.MethodPost, ruleID != "" && r.Method == http.MethodPut:
+		var body struct {
+			Pattern           string   `json:"pattern"`
+			AllowedOperations []string `json:"allowed_operations"`
+			OnViolation       string   `json:"on_violation"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeJSONError(w, "invalid body", http.StatusBadRequest)
+			return
+		}
+		if ruleID == "" && !s.workspaceExists(workspaceID) {
+			writeJSONError(w, "workspace not found", http.StatusNotFound)
+			return
+		}
+		rule, err := s.protection.SaveRule(protection.Rule{ID: ruleID, WorkspaceID: workspaceID, Pattern: body.Pattern, AllowedOperations: body.AllowedOperations, OnViolation: body.OnViolation})
+		switch {
+		case errors.Is(err, protection.ErrInvalidRule):
+			writeJSONError(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, protection.ErrRuleNotFound):
+			writeJSONError(w, err.Error(), http.StatusNotFound)
+		case err != nil:
+			writeJSONError(w, "db", http.StatusInternalServerError)
+		default:
+			if ruleID == "" {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusCreated)
+			}
+			writeJSON(w, map[string]any{"item": rule})
+		}
+	case ruleID != "" && r.Method == http.MethodDelete:
+		err := s.protection.DeleteRule(workspaceID, ruleID)
+		switch {
+		case errors.Is(err, protection.ErrRuleNotFound):
+			writeJSONError(w, err.Error(), http.StatusNotFound)
+		case err != nil:
+			writeJSONError(w, "db", http.StatusInternalServerError)
+		default:
+			writeJSON(w, map[string]any{"ok": true})
+		}
+	case strings.Contains(ruleID, "/"):
+		http.NotFound(w, r)
+	default:
+		http.Error(w, "", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) workspaceExists(id string) bool {
+	var n int
+	return s.db.QueryRow(`SELECT COUNT(*) FROM workspaces WHERE id = ?`, id).Scan(&n) == nil && n > 0
+}
+
+// listGitOperations 处理 GET /api/workspaces/:id/git-operations：受保护的 git 操作记录，
+// 新的在前；?decision=pending_approval 只看待审批的，?limit= 默认 100
+func (s *Server) listGitOperations(w http.ResponseWriter, r *http.Request, workspaceID string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "", http.StatusMethodNotAllowed)
+		return
+	}
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	items, err := s.protection.Attempts(workspaceID, r.URL.Query().Get("decision"), limit)
+	if err != nil {
+		writeJSONError(w, "db", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]any{"items": items})
+}
+
+// apiGitOperationRoutes 处理 GET /api/git-operations/:id 与
+// POST /api/git-operations/:id/approve|reject（审批待定的受保护操作）。
+// 批准后停在审批关口的步骤回到 ready 并重新派发，提交流程的操作重新排入 SUBMIT job；
+// 拒绝则让该步骤失败
+func (s *Server) apiGitOperationRoutes(w http.ResponseWriter, r *http.Request) {
+	if s.db == nil {
+		writeJSONError(w, "db not configured", http.StatusServiceUnavailable)
+		return
+	}
+	id, action, _ := strings.Cut(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/git-operations"), "/"), "/")
+	if id == "" || strings.Contains(action, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	by := s.actor(r)
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		attempt, err := s.protection.GetAttempt(id)
+		if err != nil {
+			writeAttemptError(w, err)
+			return
+		}
+		writeJSON(w, map[string]any{"item": attempt})
+	case action == "approve" && r.Method == http.MethodPost:
+		attempt, err := s.protection.Approve(id, by)
+		if err != nil {
+			writeAttemptError(w, err)
+			return
+		}
+		out := map[string]any{"item": attempt}
+		switch {
+		case attempt.StepRunID != "":
+			if err := workflows.NewService(s.db).ResumeStep(attempt.StepRunID); err != nil {
+				out["resume_error"] = err.Error()
+				break
+			}
+			if result, err := s.execution.DispatchStepRun(r.Context(), attempt.StepRunID); err != nil {
+				out["resume_error"] = err.Error()
+			} else {
+				out["dispatch"] = result
+			}
+		case attempt.Source == "submit" && attempt.TaskID != "":
+			if runId, jobId, err := s.submitTask(attempt.TaskID); err != nil {
+				out["resume_error"] = err.Error()
+			} else {
+				out["submit"] = map[string]any{"runId": runId, "jobId": jobId}
+			}
+		}
+		writeJSON(w, out)
+	case action == "reject" && r.Method == http.MethodPost:
+		var body struct {
+			Reason string `json:"reason"`
+		}
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				writeJSONError(w, "invalid body", http.StatusBadRequest)
+				return
+			}
+		}
+		attempt, err := s.protection.Reject(id, by, body.Reason)
+		if err != nil {
+			writeAttemptError(w, err)
+			return
+		}
+		out := map[string]any{"item": attempt}
+		if attempt.StepRunID != "" {
+			info := map[string]any{"error": "git operation " + attempt.ID + " rejected by " + by, "approval": attempt}
+			if err := workflows.NewService(s.db).FailStep(attempt.StepRunID, info); err != nil {
+				out["resume_error"] = err.Error()
+			}
+		}
+		writeJSON(w, out)
+	case action == "" || action == "approve" || action == "reject":
+		http.Error(w, "", http.StatusMethodNotAllowed)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func writeAttemptError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, protection.ErrAttemptNotFound):
+		writeJSONError(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, protection.ErrNotPending):
+		writeJSONError(w, err.Error(), http.StatusConflict)
+	default:
+		writeJSONError(w, "db", http.StatusInternalServerError)
+	}
+}
+
+// writeGitOperationError 输出分支保护的拒绝：需审批时 202 并带上待审批记录，被阻止时 403
+func writeGitOperationError(w http.ResponseWriter, err error) {
+	var v *protection.Violation
+	if !errors.As(err, &v) {
+		writeJSONError(w, "db", http.StatusInternalServerError)
+		return
+	}
+	code, key := http.StatusForbidden, "attempt"
+	if errors.Is(err, protection.ErrApprovalRequired) {
+		code, key = http.StatusAccepted, "approval"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(map[string]any{"error": err.Error(), key: v.Attempt})
+}
@@ -0,0 +1,446 @@
+// Package diffs parses unified diffs (plain or git-extended, as produced by
+// git diff, git show and diff -u) into files, hunks and line counts.
+package diffs
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// File statuses.
+const (
+	StatusAdded    = "added"
+	StatusDeleted  = "deleted"
+	StatusModified = "modified"
+	StatusRenamed  = "renamed"
+	StatusCopied   = "copied"
+)
+
+// Line kinds.
+const (
+	LineContext = "context"
+	LineAdd     = "add"
+	LineDelete  = "delete"
+)
+
+var ErrMalformed = errors.New("malformed diff")
+
+// Diff is a parsed unified diff.
+type Diff struct {
+	Files []*File `json:"files"`
+	Stats Stats   `json:"stats"`
+}
+
+// Stats summarizes a diff.
+type Stats struct {
+	Files       int `json:"files"`
+	Additions   int `json:"additions"`
+	Deletions   int `json:"deletions"`
+	Added       int `json:"added"`
+	Deleted     int `json:"deleted"`
+	Modified    int `json:"modified"`
+	Renamed     int `json:"renamed"`
+	Copied      int `json:"copied"`
+	BinaryFiles int `json:"binary_files"`
+}
+
+// LinesChanged is the number of added plus removed lines.
+func (s Stats) LinesChanged() int { return s.Additions + s.Deletions }
+
+// File is one file of a diff. OldPath is empty for added files and NewPath
+// for deleted ones. Modes are set only when the diff carries them.
+type File struct {
+	Index      int    `json:"index"`
+	OldPath    string `json:"old_path"`
+	NewPath    string `json:"new_path"`
+	Status     string `json:"status"`
+	OldMode    string `json:"old_mode,omitempty"`
+	NewMode    string `json:"new_mode,omitempty"`
+	Similarity int    `json:"similarity,omitempty"`
+	Binary     bool   `json:"binary"`
+	Additions  int    `json:"additions"`
+	Deletions  int    `json:"deletions"`
+	Hunks      []Hunk `json:"hunks,omitempty"`
+
+	git    bool
+	sawOld bool
+	// newFile and deletedFile are set by git's "new file mode" and
+	// "deleted file mode" headers.
+	newFile, deletedFile bool
+	renamed, copied      bool
+}
+
+// Path is the file's path after the change, or before it for deletions.
+func (f *File) Path() string {
+	if f.NewPath != "" {
+		return f.NewPath
+	}
+	return f.OldPath
+}
+
+// ModeChanged reports whether the diff changes the file mode.
+func (f *File) ModeChanged() bool {
+	return f.OldMode != "" && f.NewMode != "" && f.OldMode != f.NewMode
+}
+
+// Hunk is one "@@ -a,b +c,d @@" section.
+type Hunk struct {
+	OldStart int    `json:"old_start"`
+	OldLines int    `json:"old_lines"`
+	NewStart int    `json:"new_start"`
+	NewLines int    `json:"new_lines"`
+	Section  string `json:"section,omitempty"`
+	Lines    []Line `json:"lines"`
+}
+
+// Line is a hunk line with its line numbers in the old and new file (zero
+// where the line does not exist). NoNewline marks a line followed by
+// "\ No newline at end of file".
+type Line struct {
+	Kind      string `json:"kind"`
+	Content   string `json:"content"`
+	OldLine   int    `json:"old_line,omitempty"`
+	NewLine   int    `json:"new_line,omitempty"`
+	NoNewline bool   `json:"no_newline,omitempty"`
+}
+
+// Summary returns the diff without hunks.
+func (d *Diff) Summary() *Diff {
+	out := &Diff{Files: make([]*File, 0, len(d.Files)), Stats: d.Stats}
+	for _, f := range d.Files {
+		c := *f
+		c.Hunks = nil
+		out.Files = append(out.Files, &c)
+	}
+	return out
+}
+
+// File returns the file whose new or old path is path.
+func (d *Diff) File(path string) (*File, bool) {
+	for _, f := range d.Files {
+		if f.NewPath == path || f.OldPath == path {
+			return f, true
+		}
+	}
+	return nil, false
+}
+
+var hunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@ ?(.*)$`)
+
+// parser holds the state of one Parse call.
+type parser struct {
+	diff *Diff
+	file *File
+	// header is true between a file's first header line and its first hunk.
+	header bool
+	hunk   *Hunk
+	// oldLeft and newLeft count the lines the current hunk still expects.
+	oldLeft, newLeft int
+	oldNo, newNo     int
+}
+
+// Parse reads a unified diff. Text outside file sections (commit messages,
+// mail headers) is ignored; a diff without any file yields an empty Diff.
+func Parse(r io.Reader) (*Diff, error) {
+	p := &parser{diff: &Diff{Files: []*File{}}}
+	br := bufio.NewReader(r)
+	for lineNo := 1; ; lineNo++ {
+		raw, err := br.ReadString('\n')
+		if raw == "" && err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		if perr := p.line(strings.TrimSuffix(raw, "\n")); perr != nil {
+			return nil, fmt.Errorf("%w: line %d: %v", ErrMalformed, lineNo, perr)
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	p.finish()
+	for _, f := range p.diff.Files {
+		s := &p.diff.Stats
+		s.Files++
+		s.Additions += f.Additions
+		s.Deletions += f.Deletions
+		if f.Binary {
+			s.BinaryFiles++
+		}
+		switch f.Status {
+		case StatusAdded:
+			s.Added++
+		case StatusDeleted:
+			s.Deleted++
+		case StatusRenamed:
+			s.Renamed++
+		case StatusCopied:
+			s.Copied++
+		default:
+			s.Modified++
+		}
+	}
+	return p.diff, nil
+}
+
+// ParseString parses a diff held in memory.
+func ParseString(s string) (*Diff, error) {
+	return Parse(strings.NewReader(s))
+}
+
+func (p *parser) line(l string) error {
+	if p.hunk != nil && (p.oldLeft > 0 || p.newLeft > 0) {
+		if ok := p.hunkLine(l); ok {
+			return nil
+		}
+		// The hunk ended early: the counts in its header were wrong, or the
+		// diff was truncated. Treat the line as a header.
+		p.hunk = nil
+	}
+	if strings.HasPrefix(l, `\ `) && p.hunk != nil && len(p.hunk.Lines) > 0 {
+		p.hunk.Lines[len(p.hunk.Lines)-1].NoNewline = true
+		return nil
+	}
+	switch {
+	case strings.HasPrefix(l, "diff --git "):
+		p.start(true)
+		p.file.OldPath, p.file.NewPath = gitHeaderPaths(strings.TrimPrefix(l, "diff --git "))
+	case strings.HasPrefix(l, "@@ "):
+		if p.file == nil {
+			return errors.New("hunk outside a file")
+		}
+		return p.startHunk(l)
+	case strings.HasPrefix(l, "--- "):
+		if !p.header || p.file.sawOld {
+			p.start(false)
+		}
+		p.file.OldPath = p.headerPath(strings.TrimPrefix(l, "--- "), "a/")
+		p.file.sawOld = true
+	case strings.HasPrefix(l, "+++ ") && p.header:
+		p.file.NewPath = p.headerPath(strings.TrimPrefix(l, "+++ "), "b/")
+	case strings.HasPrefix(l, "Binary files ") && p.header:
+		p.file.Binary = true
+	case p.header && p.file.git:
+		p.gitHeader(l)
+	}
+	return nil
+}
+
+// start begins a new file section, closing the current one.
+func (p *parser) start(git bool) {
+	p.finish()
+	p.file = &File{Index: len(p.diff.Files), git: git}
+	p.diff.Files = append(p.diff.Files, p.file)
+	p.header = true
+	p.hunk = nil
+}
+
+// finish settles the status and paths of the current file.
+func (p *parser) finish() {
+	f := p.file
+	if f == nil {
+		return
+	}
+	p.file = nil
+	if !f.git && strings.HasPrefix(f.OldPath, "a/") && strings.HasPrefix(f.NewPath, "b/") {
+		f.OldPath, f.NewPath = f.OldPath[2:], f.NewPath[2:]
+	}
+	switch {
+	case f.newFile || (f.OldPath == devNull && f.NewPath != devNull):
+		f.Status = StatusAdded
+	case f.deletedFile || (f.NewPath == devNull && f.OldPath != devNull):
+		f.Status = StatusDeleted
+	case f.renamed:
+		f.Status = StatusRenamed
+	case f.copied:
+		f.Status = StatusCopied
+	default:
+		f.Status = StatusModified
+	}
+	switch f.Status {
+	case StatusAdded:
+		f.OldPath = ""
+	case StatusDeleted:
+		f.NewPath = ""
+	}
+	if f.OldPath == devNull {
+		f.OldPath = ""
+	}
+	if f.NewPath == devNull {
+		f.NewPath = ""
+	}
+}
+
+const devNull = "/dev/null"
+
+// gitHeader applies one git extended header line to the current file.
+func (p *parser) gitHeader(l string) {
+	f := p.file
+	switch {
+	case strings.HasPrefix(l, "old mode "):
+		f.OldMode = strings.TrimPrefix(l, "old mode ")
+	case strings.HasPrefix(l, "new mode "):
+		f.NewMode = strings.TrimPrefix(l, "new mode ")
+	case strings.HasPrefix(l, "new file mode "):
+		f.newFile = true
+		f.NewMode = strings.TrimPrefix(l, "new file mode ")
+	case strings.HasPrefix(l, "deleted file mode "):
+		f.deletedFile = true
+		f.OldMode = strings.TrimPrefix(l, "deleted file mode ")
+	case strings.HasPrefix(l, "rename from "):
+		f.renamed = true
+		f.OldPath = unquote(strings.TrimPrefix(l, "rename from "))
+	case strings.HasPrefix(l, "rename to "):
+		f.renamed = true
+		f.NewPath = unquote(strings.TrimPrefix(l, "rename to "))
+	case strings.HasPrefix(l, "copy from "):
+		f.copied = true
+		f.OldPath = unquote(strings.TrimPrefix(l, "copy from "))
+	case strings.HasPrefix(l, "copy to "):
+		f.copied = true
+		f.NewPath = unquote(strings.TrimPrefix(l, "copy to "))
+	case strings.HasPrefix(l, "similarity index "):
+		f.Similarity, _ = strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(l, "similarity index "), "%"))
+	case strings.HasPrefix(l, "index "):
+		// "index <old>..<new> <mode>" carries the mode of unchanged-mode files.
+		if fields := strings.Fields(l); len(fields) == 3 && f.OldMode == "" && f.NewMode == "" {
+			f.OldMode, f.NewMode = fields[2], fields[2]
+		}
+	case strings.HasPrefix(l, "GIT binary patch"):
+		f.Binary = true
+	}
+}
+
+// headerPath returns the path of a "--- " or "+++ " line, dropping a
+// trailing timestamp and, for git diffs, the a/ or b/ prefix.
+func (p *parser) headerPath(v, prefix string) string {
+	if i := strings.IndexByte(v, '\t'); i >= 0 && !strings.HasPrefix(v, `"`) {
+		v = v[:i]
+	}
+	v = unquote(strings.TrimRight(v, " "))
+	if v == devNull {
+		return v
+	}
+	if p.file.git {
+		v = strings.TrimPrefix(v, prefix)
+	}
+	return v
+}
+
+// gitHeaderPaths splits the "a/<old> b/<new>" part of a diff --git line.
+// Unquoted paths containing " b/" are ambiguous; the usual case of an
+// unchanged name is split in the middle, and the ---/+++ or rename lines
+// that follow override the guess.
+func gitHeaderPaths(rest string) (string, string) {
+	if strings.HasPrefix(rest, `"`) {
+		if old, tail, ok := cutQuoted(rest); ok {
+			return strings.TrimPrefix(old, "a/"), strings.TrimPrefix(unquote(strings.TrimSpace(tail)), "b/")
+		}
+	}
+	if n := (len(rest) - 1) / 2; len(rest)%2 == 1 && rest[n] == ' ' && strings.HasPrefix(rest, "a/") && strings.HasPrefix(rest[n+1:], "b/") && rest[2:n] == rest[n+3:] {
+		return rest[2:n], rest[n+3:]
+	}
+	if i := strings.LastIndex(rest, " b/"); i >= 0 {
+		return strings.TrimPrefix(rest[:i], "a/"), rest[i+3:]
+	}
+	if i := strings.LastIndex(rest, ` "b/`); i >= 0 {
+		return strings.TrimPrefix(rest[:i], "a/"), strings.TrimPrefix(unquote(rest[i+1:]), "b/")
+	}
+	return rest, rest
+}
+
+// cutQuoted splits a leading C-style quoted string from s.
+func cutQuoted(s string) (string, string, bool) {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			v, err := strconv.Unquote(s[:i+1])
+			if err != nil {
+				return "", "", false
+			}
+			return v, s[i+1:], true
+		}
+	}
+	return "", "", false
+}
+
+// unquote decodes git's C-style quoting of paths with special characters.
+func unquote(s string) string {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		if v, err := strconv.Unquote(s); err == nil {
+			return v
+		}
+	}
+	return s
+}
+
+func (p *parser) startHunk(l string) error {
+	m := hunkHeader.FindStringSubmatch(l)
+	if m == nil {
+		return fmt.Errorf("bad hunk header %q", l)
+	}
+	h := Hunk{Section: m[5]}
+	h.OldStart, _ = strconv.Atoi(m[1])
+	h.OldLines = 1
+	if m[2] != "" {
+		h.OldLines, _ = strconv.Atoi(m[2])
+	}
+	h.NewStart, _ = strconv.Atoi(m[3])
+	h.NewLines = 1
+	if m[4] != "" {
+		h.NewLines, _ = strconv.Atoi(m[4])
+	}
+	p.file.Hunks = append(p.file.Hunks, h)
+	p.hunk = &p.file.Hunks[len(p.file.Hunks)-1]
+	p.header = false
+	p.oldLeft, p.newLeft = h.OldLines, h.NewLines
+	p.oldNo, p.newNo = h.OldStart, h.NewStart
+	return nil
+}
+
+// hunkLine consumes a line of the current hunk, reporting false when the
+// line cannot belong to it.
+func (p *parser) hunkLine(l string) bool {
+	var line Line
+	kind := byte(' ')
+	if l != "" {
+		kind = l[0]
+	}
+	switch {
+	case kind == ' ' && p.oldLeft > 0 && p.newLeft > 0:
+		// An empty line is context whose leading space was stripped.
+		line = Line{Kind: LineContext, OldLine: p.oldNo, NewLine: p.newNo}
+		p.oldNo++
+		p.newNo++
+		p.oldLeft--
+		p.newLeft--
+	case kind == '-' && p.oldLeft > 0:
+		line = Line{Kind: LineDelete, OldLine: p.oldNo}
+		p.oldNo++
+		p.oldLeft--
+		p.file.Deletions++
+	case kind == '+' && p.newLeft > 0:
+		line = Line{Kind: LineAdd, NewLine: p.newNo}
+		p.newNo++
+		p.newLeft--
+		p.file.Additions++
+	case kind == '\\' && len(p.hunk.Lines) > 0:
+		p.hunk.Lines[len(p.hunk.Lines)-1].NoNewline = true
+		return true
+	default:
+		return false
+	}
+	if l != "" {
+		line.Content = l[1:]
+	}
+	p.hunk.Lines = append(p.hunk.Lines, line)
+	return true
+}
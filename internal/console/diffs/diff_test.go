@@ -0,0 +1,138 @@
+package diffs
+
+import (
+	"errors"
+	"testing"
+)
+
+// gitDiff is `git diff --cached -M` over an edit, an add, a binary change, a
+// delete, a rename and a mode change.
+const gitDiff = `diff --git a/a.txt b/a.txt
+index 4cb29ea..047ece5 100644
+--- a/a.txt
++++ b/a.txt
+@@ -1,3 +1,4 @@
+ one
+-two
++2
+ three
++four
+\ No newline at end of file
+diff --git a/added.txt b/added.txt
+new file mode 100644
+index 0000000..45b983b
+--- /dev/null
++++ b/added.txt
+@@ -0,0 +1 @@
++hi
+diff --git a/bin.dat b/bin.dat
+index bdc955b..8835708 100644
+Binary files a/bin.dat and b/bin.dat differ
+diff --git a/del.txt b/del.txt
+deleted file mode 100644
+index 286c5f5..0000000
+--- a/del.txt
++++ /dev/null
+@@ -1 +0,0 @@
+-gone
+diff --git a/old.txt b/new.txt
+similarity index 100%
+rename from old.txt
+rename to new.txt
+diff --git a/sp ace.txt b/sp ace.txt
+old mode 100644
+new mode 100755
+`
+
+func TestParseGitDiff(t *testing.T) {
+	d, err := ParseString(gitDiff)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	want := []struct {
+		old, new, status string
+		add, del         int
+		binary           bool
+	}{
+		{"a.txt", "a.txt", StatusModified, 2, 1, false},
+		{"", "added.txt", StatusAdded, 1, 0, false},
+		{"bin.dat", "bin.dat", StatusModified, 0, 0, true},
+		{"del.txt", "", StatusDeleted, 0, 1, false},
+		{"old.txt", "new.txt", StatusRenamed, 0, 0, false},
+		{"sp ace.txt", "sp ace.txt", StatusModified, 0, 0, false},
+	}
+	if len(d.Files) != len(want) {
+		t.Fatalf("got %d files", len(d.Files))
+	}
+	for i, w := range want {
+		f := d.Files[i]
+		if f.Index != i || f.OldPath != w.old || f.NewPath != w.new || f.Status != w.status || f.Additions != w.add || f.Deletions != w.del || f.Binary != w.binary {
+			t.Errorf("file %d = %+v, want %+v", i, f, w)
+		}
+	}
+	if d.Stats != (Stats{Files: 6, Additions: 3, Deletions: 2, Added: 1, Deleted: 1, Modified: 3, Renamed: 1, BinaryFiles: 1}) {
+		t.Errorf("stats %+v", d.Stats)
+	}
+	if f := d.Files[5]; !f.ModeChanged() || f.NewMode != "100755" {
+		t.Errorf("mode change not parsed: %+v", f)
+	}
+	if d.Files[4].Similarity != 100 {
+		t.Errorf("similarity %d", d.Files[4].Similarity)
+	}
+
+	h := d.Files[0].Hunks[0]
+	if h.OldStart != 1 || h.OldLines != 3 || h.NewStart != 1 || h.NewLines != 4 || len(h.Lines) != 5 {
+		t.Fatalf("hunk %+v", h)
+	}
+	last := h.Lines[4]
+	if last.Kind != LineAdd || last.Content != "four" || last.NewLine != 4 || !last.NoNewline {
+		t.Errorf("last line %+v", last)
+	}
+	if del := h.Lines[1]; del.Kind != LineDelete || del.OldLine != 2 || del.NewLine != 0 {
+		t.Errorf("deleted line %+v", del)
+	}
+	if f, ok := d.File("old.txt"); !ok || f.NewPath != "new.txt" {
+		t.Errorf("lookup by old path: %+v %t", f, ok)
+	}
+	if s := d.Summary(); s.Files[0].Hunks != nil || d.Files[0].Hunks == nil {
+		t.Errorf("summary should drop hunks without touching the diff")
+	}
+}
+
+func TestParsePlainAndQuotedDiffs(t *testing.T) {
+	plain := "--- src/main.go\t2024-01-01 10:00:00\n+++ src/main.go\t2024-01-02 10:00:00\n@@ -5 +5,2 @@ func main() {\n-\told()\n+\tnew()\n+\tmore()\n" +
+		"--- a/x\n+++ b/x\n@@ -1 +1 @@\n-a\n+b\n"
+	d, err := ParseString(plain)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(d.Files) != 2 || d.Files[0].NewPath != "src/main.go" || d.Files[0].Hunks[0].Section != "func main() {" || d.Files[0].Additions != 2 {
+		t.Fatalf("plain diff %+v", d.Files[0])
+	}
+	if d.Files[1].OldPath != "x" || d.Files[1].NewPath != "x" {
+		t.Fatalf("a/ b/ prefixes not dropped: %+v", d.Files[1])
+	}
+
+	quoted := "From 1234 Mon Sep 17 00:00:00 2001\nSubject: [PATCH] tabs\n\n---\n" +
+		"diff --git \"a/t\\tab.txt\" \"b/t\\tab.txt\"\nnew file mode 100644\nindex 0000000..e69de29\n" +
+		"diff --git a/img.png b/img.png\nnew file mode 100644\nindex 0000000..1234567\nGIT binary patch\nliteral 4\nLcmZ?wbY%bq04M+i\n\nliteral 0\nHcmV?d00001\n\n"
+	d, err = ParseString(quoted)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(d.Files) != 2 || d.Files[0].NewPath != "t\tab.txt" || d.Files[0].Status != StatusAdded {
+		t.Fatalf("quoted path %+v", d.Files)
+	}
+	if f := d.Files[1]; !f.Binary || f.Status != StatusAdded || f.NewPath != "img.png" {
+		t.Fatalf("binary patch %+v", f)
+	}
+}
+
+func TestParseRejectsBadHunkHeader(t *testing.T) {
+	if _, err := ParseString("--- a\n+++ b\n@@ -x +1 @@\n"); !errors.Is(err, ErrMalformed) {
+		t.Fatalf("expected ErrMalformed, got %v", err)
+	}
+	if d, err := ParseString("just a log line\n"); err != nil || len(d.Files) != 0 {
+		t.Fatalf("text without files: %+v %v", d, err)
+	}
+}
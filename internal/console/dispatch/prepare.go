@@ -7,6 +7,7 @@ import (
 	"fmt"
 
 	"github.com/PonyDevAI/Bull-Board/internal/console/models"
+	"github.com/PonyDevAI/Bull-Board/internal/console/toolpolicy"
 )
 
 var ErrStepRunWorkerMissing = errors.New("step run has no assigned worker")
@@ -20,21 +21,47 @@ type PreparedDispatchRequest struct {
 	AgentApp         map[string]any `json:"agent_app"`
 	ExecutionBackend map[string]any `json:"execution_backend"`
 	ResolvedConfig   any            `json:"resolved_config"`
+	Step             map[string]any `json:"step"`
+	Workspace        map[string]any `json:"workspace"`
 	Input            any            `json:"input"`
+	// ToolPolicy merges the model profile, agent app and worker tool policies.
+	ToolPolicy toolpolicy.Resolved `json:"tool_policy"`
 }
 
 func PrepareDispatchForStep(db *sql.DB, stepRunID string) (PreparedDispatchRequest, error) {
 	var out PreparedDispatchRequest
-	var workerID, inputJSON string
+	var workerID, inputJSON, runWorkspaceID string
+	var stepTemplateID, stepName, stepType, stepConfigJSON string
+	var stepOrder int
 	err := db.QueryRow(`
-		SELECT sr.id, sr.workflow_run_id, COALESCE(wr.task_id,''), COALESCE(sr.worker_id,''), COALESCE(sr.input_json,'{}')
+		SELECT sr.id, sr.workflow_run_id, COALESCE(wr.task_id,''), COALESCE(sr.worker_id,''), COALESCE(sr.input_json,'{}'), wr.workspace_id,
+			COALESCE(wst.id,''), COALESCE(wst.name,''), COALESCE(wst.step_type,''), COALESCE(wst.step_order,0), COALESCE(wst.config_json,'{}')
 		FROM step_runs sr
 		JOIN workflow_runs wr ON wr.id = sr.workflow_run_id
+		LEFT JOIN workflow_step_templates wst ON wst.id = sr.workflow_step_template_id
 		WHERE sr.id = ?`, stepRunID).
-		Scan(&out.StepRunID, &out.WorkflowRunID, &out.TaskID, &workerID, &inputJSON)
+		Scan(&out.StepRunID, &out.WorkflowRunID, &out.TaskID, &workerID, &inputJSON, &runWorkspaceID,
+			&stepTemplateID, &stepName, &stepType, &stepOrder, &stepConfigJSON)
 	if err != nil {
 		return out, err
 	}
+	var stepConfig map[string]any
+	if err := json.Unmarshal([]byte(stepConfigJSON), &stepConfig); err != nil || stepConfig == nil {
+		stepConfig = map[string]any{}
+	}
+	out.Step = map[string]any{
+		"id":         stepTemplateID,
+		"name":       stepName,
+		"step_type":  stepType,
+		"step_order": stepOrder,
+		"config":     stepConfig,
+	}
+	var repoPath, defaultBranch string
+	_ = db.QueryRow(`SELECT COALESCE(repo_path,''), COALESCE(default_branch,'main') FROM workspace_runtime_configs WHERE workspace_id = ?`, runWorkspaceID).Scan(&repoPath, &defaultBranch)
+	if defaultBranch == "" {
+		defaultBranch = "main"
+	}
+	out.Workspace = map[string]any{"id": runWorkspaceID, "repo_path": repoPath, "default_branch": defaultBranch}
 	if workerID == "" {
 		return out, ErrStepRunWorkerMissing
 	}
@@ -67,6 +94,14 @@ func PrepareDispatchForStep(db *sql.DB, stepRunID string) (PreparedDispatchReque
 	out.AgentApp = asMap(cfg.AgentApp)
 	out.ExecutionBackend = asMap(cfg.ExecutionBackend)
 
+	modelProfileID, _ := stepConfig["model_profile_id"].(string)
+	if modelProfileID == "" {
+		modelProfileID, _ = asMap(cfg.ModelProfile)["id"].(string)
+	}
+	if out.ToolPolicy, err = toolpolicy.Resolve(db, modelProfileID, agentAppID, workerID); err != nil {
+		return out, err
+	}
+
 	var input any
 	if err := json.Unmarshal([]byte(inputJSON), &input); err != nil {
 		input = map[string]any{}
@@ -37,6 +37,9 @@ func TestPrepareDispatchForStep(t *testing.T) {
 	if payload.Worker["id"] == "" || payload.Role["id"] == "" || payload.AgentApp["id"] == "" || payload.ExecutionBackend["id"] == "" {
 		t.Fatalf("expected worker/role/app/backend in payload, got %+v", payload)
 	}
+	if payload.Step["step_type"] != "analysis" || payload.Workspace["default_branch"] != "main" {
+		t.Fatalf("expected step template and workspace checkout in payload, got step=%+v workspace=%+v", payload.Step, payload.Workspace)
+	}
 }
 
 func testDB(t *testing.T) *sql.DB {
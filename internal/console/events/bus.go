@@ -0,0 +1,51 @@
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Event is one message published to /api/events subscribers.
+type Event struct {
+	Type string `json:"type"`
+	Data any    `json:"data"`
+	At   string `json:"at"`
+}
+
+// Bus fans out console events to in-process subscribers (SSE connections).
+// A nil *Bus is valid and drops every event.
+type Bus struct {
+	mu   sync.Mutex
+	subs map[chan Event]struct{}
+}
+
+func NewBus() *Bus { return &Bus{subs: map[chan Event]struct{}{}} }
+
+// Publish delivers the event to every subscriber; slow subscribers whose buffer is full miss it.
+func (b *Bus) Publish(eventType string, data any) {
+	if b == nil {
+		return
+	}
+	ev := Event{Type: eventType, Data: data, At: time.Now().UTC().Format(time.RFC3339)}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subs {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a buffered channel of events and a function that unsubscribes it.
+func (b *Bus) Subscribe(buffer int) (<-chan Event, func()) {
+	ch := make(chan Event, buffer)
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+	return ch, func() {
+		b.mu.Lock()
+		delete(b.subs, ch)
+		b.mu.Unlock()
+	}
+}
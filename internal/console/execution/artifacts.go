@@ -0,0 +1,162 @@
+package execution
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"strings"
+
+	"github.com/PonyDevAI/Bull-Board/internal/console/artifacts"
+	"github.com/PonyDevAI/Bull-Board/internal/console/diffs"
+	"github.com/PonyDevAI/Bull-Board/internal/console/execution_backends"
+	"github.com/PonyDevAI/Bull-Board/internal/console/workflows"
+)
+
+// uploadName validates the kind and file name of an uploaded artifact. Only
+// the base name is kept; it is metadata, never a path.
+func uploadName(kind, name string) (string, string, error) {
+	kind, name = strings.TrimSpace(kind), filepath.Base(strings.TrimSpace(name))
+	if kind == "" || name == "" || name == "." || name == ".." || name == string(filepath.Separator) {
+		return "", "", fmt.Errorf("%w: kind and name required", ErrInvalidUpload)
+	}
+	return kind, name, nil
+}
+
+// stageUpload streams body into the artifact store's temp area.
+func (s *Service) stageUpload(body io.Reader, name string) (*artifacts.Staged, error) {
+	if s.dataDir == "" {
+		return nil, errors.New("artifact storage is not configured")
+	}
+	return s.artifacts.Store().Stage(body, name)
+}
+
+// commitUpload makes staged content visible under its hash and records it as
+// an artifact of the job.
+func (s *Service) commitUpload(staged *artifacts.Staged, jobID, stepRunID, kind, name string, metadata map[string]any) (artifacts.Artifact, error) {
+	blob, err := staged.Commit()
+	if err != nil {
+		return artifacts.Artifact{}, err
+	}
+	if err := s.artifacts.Record(blob); err != nil {
+		return artifacts.Artifact{}, err
+	}
+	metadata["name"] = name
+	metadata["size"] = blob.Size
+	a, err := s.artifacts.Create(artifacts.Artifact{
+		JobID:     jobID,
+		StepRunID: stepRunID,
+		Kind:      kind,
+		URI:       blob.URI(),
+		Metadata:  metadata,
+		SHA256:    blob.SHA256,
+		Size:      blob.Size,
+		MIMEType:  blob.MIMEType,
+	})
+	if err != nil {
+		return a, err
+	}
+	s.indexArtifact(a)
+	return a, nil
+}
+
+// StoreBackendArtifact streams an artifact uploaded by the execution backend
+// of jobID into the store. The upload is signed like a job callback, with
+// execution_backends.ArtifactUploadTarget in place of the job id and the file content as the
+// body; the signature is checked once the body has been streamed and the
+// content is discarded if it does not match.
+func (s *Service) StoreBackendArtifact(jobID string, sig CallbackSignature, kind, name string, body io.Reader) (artifacts.Artifact, error) {
+	var backendID, stepRunID, status string
+	err := s.db.QueryRow(`SELECT COALESCE(execution_backend_id,''), step_run_id, status FROM jobs WHERE id = ?`, jobID).Scan(&backendID, &stepRunID, &status)
+	if err == sql.ErrNoRows {
+		return artifacts.Artifact{}, ErrJobNotFound
+	}
+	if err != nil {
+		return artifacts.Artifact{}, err
+	}
+	backend, err := execution_backends.NewRepository(s.db).Get(backendID)
+	if err != nil || backend.CallbackSecret == "" {
+		return artifacts.Artifact{}, ErrCallbackUnauthorized
+	}
+	// Check everything that does not need the body before accepting bytes.
+	if !strings.HasPrefix(sig.Signature, "sha256=") {
+		return artifacts.Artifact{}, ErrCallbackUnauthorized
+	}
+	target := execution_backends.ArtifactUploadTarget(jobID, kind, name)
+	kind, name, err = uploadName(kind, name)
+	if err != nil {
+		return artifacts.Artifact{}, err
+	}
+	if status != "queued" && status != "running" && status != "cancelling" {
+		return artifacts.Artifact{}, fmt.Errorf("%w: status=%s", ErrJobNotActive, status)
+	}
+
+	mac := execution_backends.NewCallbackMAC(backend.CallbackSecret, sig.Timestamp, sig.Nonce, target)
+	staged, err := s.stageUpload(io.TeeReader(body, mac), name)
+	if err != nil {
+		return artifacts.Artifact{}, err
+	}
+	if !execution_backends.VerifyCallbackMAC(mac, sig.Signature) {
+		staged.Discard()
+		return artifacts.Artifact{}, ErrCallbackUnauthorized
+	}
+	if err := s.checkCallbackFreshness(backendID, sig); err != nil {
+		staged.Discard()
+		return artifacts.Artifact{}, err
+	}
+	return s.commitUpload(staged, jobID, stepRunID, kind, name, map[string]any{"source": backend.ConnectorCode, "execution_backend_id": backendID})
+}
+
+// DiffStats is the scope of a step run's change, taken from the latest diff
+// artifact recorded for it and kept in step_runs.diff_stats_json.
+type DiffStats struct {
+	ArtifactID string `json:"artifact_id"`
+	diffs.Stats
+	LinesChanged int `json:"lines_changed"`
+}
+
+// indexArtifact derives what the console keeps about a newly recorded
+// artifact beyond the row itself: diff stats and parsed test reports.
+func (s *Service) indexArtifact(a artifacts.Artifact) {
+	s.recordDiffStats(a)
+	s.recordTestReport(a)
+}
+
+// recordDiffStats parses a stored diff artifact and records its stats on the
+// step run. Diffs that cannot be parsed leave the previous stats in place.
+func (s *Service) recordDiffStats(a artifacts.Artifact) {
+	if a.Kind != "diff" || a.SHA256 == "" || a.StepRunID == "" {
+		return
+	}
+	_, d, err := s.artifacts.ParseDiff(a.ID)
+	if err != nil {
+		slog.Warn("execution: parse diff artifact", "artifact_id", a.ID, "err", err)
+		return
+	}
+	statsJSON, err := json.Marshal(DiffStats{ArtifactID: a.ID, Stats: d.Stats, LinesChanged: d.Stats.LinesChanged()})
+	if err != nil {
+		return
+	}
+	if _, err := s.db.Exec(`UPDATE step_runs SET diff_stats_json = ? WHERE id = ?`, string(statsJSON), a.StepRunID); err != nil {
+		slog.Warn("execution: store diff stats", "step_run_id", a.StepRunID, "err", err)
+	}
+}
+
+// StepDiffStats returns the diff stats recorded for a step run; ArtifactID is
+// empty when no diff has been recorded.
+func (s *Service) StepDiffStats(stepRunID string) (DiffStats, error) {
+	var out DiffStats
+	var statsJSON string
+	err := s.db.QueryRow(`SELECT diff_stats_json FROM step_runs WHERE id = ?`, stepRunID).Scan(&statsJSON)
+	if err == sql.ErrNoRows {
+		return out, workflows.ErrStepRunNotFound
+	}
+	if err != nil {
+		return out, err
+	}
+	_ = json.Unmarshal([]byte(statsJSON), &out)
+	return out, nil
+}
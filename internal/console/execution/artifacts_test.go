@@ -0,0 +1,245 @@
+package execution
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PonyDevAI/Bull-Board/internal/console/artifacts"
+	"github.com/PonyDevAI/Bull-Board/internal/console/execution_backends"
+	"github.com/PonyDevAI/Bull-Board/internal/console/workflows"
+)
+
+func readArtifact(t *testing.T, svc *Service, id string) (artifacts.Artifact, string) {
+	t.Helper()
+	a, f, err := svc.Artifacts().Open(id)
+	if err != nil {
+		t.Fatalf("open artifact %s: %v", id, err)
+	}
+	defer f.Close()
+	data, _ := io.ReadAll(f)
+	return a, string(data)
+}
+
+func TestBackendArtifactUploadVerifiesSignature(t *testing.T) {
+	db := testDB(t)
+	svc, jobID, _ := dispatchExternalJob(t, db)
+	svc.SetDataDir(t.TempDir())
+
+	sign := func(secret, nonce, kind, name, body string) CallbackSignature {
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		target := execution_backends.ArtifactUploadTarget(jobID, kind, name)
+		return CallbackSignature{Timestamp: ts, Nonce: nonce, Signature: execution_backends.SignCallback(secret, ts, nonce, target, []byte(body))}
+	}
+	if _, err := svc.StoreBackendArtifact(jobID, sign("wrong", "n-1", "report", "r.json", "{}"), "report", "r.json", strings.NewReader("{}")); !errors.Is(err, ErrCallbackUnauthorized) {
+		t.Fatalf("expected ErrCallbackUnauthorized, got %v", err)
+	}
+	// The signature binds the kind: relabelling a signed upload fails.
+	if _, err := svc.StoreBackendArtifact(jobID, sign("s3cret", "n-2", "report", "r.json", "{}"), "diff", "r.json", strings.NewReader("{}")); !errors.Is(err, ErrCallbackUnauthorized) {
+		t.Fatalf("expected relabelled upload to be refused, got %v", err)
+	}
+	var blobs int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM artifact_blobs`).Scan(&blobs); err != nil || blobs != 0 {
+		t.Fatalf("refused uploads left %d blobs: %v", blobs, err)
+	}
+
+	sig := sign("s3cret", "n-3", "report", "r.json", `{"ok":true}`)
+	a, err := svc.StoreBackendArtifact(jobID, sig, "report", "r.json", strings.NewReader(`{"ok":true}`))
+	if err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	if a.MIMEType != "application/json" || a.Size != 11 || a.Metadata["source"] != "openclaw" {
+		t.Fatalf("unexpected artifact %+v", a)
+	}
+	if _, data := readArtifact(t, svc, a.ID); data != `{"ok":true}` {
+		t.Fatalf("content %q", data)
+	}
+	if _, err := svc.StoreBackendArtifact(jobID, sig, "report", "r.json", strings.NewReader(`{"ok":true}`)); !errors.Is(err, ErrCallbackReplayed) {
+		t.Fatalf("expected ErrCallbackReplayed, got %v", err)
+	}
+}
+
+func TestReportedArtifactsReferenceStoredBlobs(t *testing.T) {
+	db := testDB(t)
+	svc, jobID, stepID := dispatchExternalJob(t, db)
+	dataDir := t.TempDir()
+	svc.SetDataDir(dataDir)
+
+	jobDir := filepath.Join(dataDir, "artifacts", "jobs", jobID)
+	if err := os.MkdirAll(jobDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	logPath := filepath.Join(jobDir, "execution.log")
+	if err := os.WriteFile(logPath, []byte("done\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.insertArtifacts(jobID, stepID, []execution_backends.Artifact{
+		{Kind: "execution_log", URI: "file://" + logPath},
+		{Kind: "report", URI: "https://example.test/r.json"},
+	}, []string{jobDir}); err != nil {
+		t.Fatalf("insert artifacts: %v", err)
+	}
+	items, err := svc.Artifacts().ListByJob(jobID)
+	if err != nil || len(items) != 2 {
+		t.Fatalf("artifacts %+v, %v", items, err)
+	}
+	if items[0].SHA256 == "" || items[0].Size != 5 || items[0].MIMEType != "text/plain; charset=utf-8" {
+		t.Fatalf("local artifact not stored: %+v", items[0])
+	}
+	if _, _, err := svc.Artifacts().Open(items[1].ID); !errors.Is(err, artifacts.ErrNoContent) {
+		t.Fatalf("expected remote artifact without content, got %v", err)
+	}
+
+	// A row written before the store existed is ingested when first read.
+	legacyPath := filepath.Join(jobDir, "diff.patch")
+	if err := os.WriteFile(legacyPath, []byte("+x\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO artifacts (id, job_id, step_run_id, kind, uri) VALUES ('legacy', ?, ?, 'diff', ?)`, jobID, stepID, "file://"+legacyPath); err != nil {
+		t.Fatalf("insert legacy artifact: %v", err)
+	}
+	a, data := readArtifact(t, svc, "legacy")
+	if data != "+x\n" || a.MIMEType != "text/x-diff" {
+		t.Fatalf("legacy artifact %+v: %q", a, data)
+	}
+	if err := os.Remove(legacyPath); err != nil {
+		t.Fatal(err)
+	}
+	if _, data := readArtifact(t, svc, "legacy"); data != "+x\n" {
+		t.Fatalf("ingested content should outlive the original file, got %q", data)
+	}
+}
+
+func TestReportedBlobReferencesMustBeTheJobsOwnUploads(t *testing.T) {
+	db := testDB(t)
+	svc, jobID, stepID := dispatchExternalJob(t, db)
+	svc.SetDataDir(t.TempDir())
+
+	// Content another job stored, whose hash this job's backend has learnt.
+	theirs, err := svc.Artifacts().Store().Put(strings.NewReader("other job's secret"), "secret.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.Artifacts().Record(theirs); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Artifacts().Create(artifacts.Artifact{JobID: "other-job", Kind: "report", URI: theirs.URI(), SHA256: theirs.SHA256}); err != nil {
+		t.Fatal(err)
+	}
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	target := execution_backends.ArtifactUploadTarget(jobID, "report", "r.json")
+	sig := CallbackSignature{Timestamp: ts, Nonce: "n-up", Signature: execution_backends.SignCallback("s3cret", ts, "n-up", target, []byte(`{"ok":true}`))}
+	own, err := svc.StoreBackendArtifact(jobID, sig, "report", "r.json", strings.NewReader(`{"ok":true}`))
+	if err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+
+	if err := svc.insertArtifacts(jobID, stepID, []execution_backends.Artifact{
+		{Kind: "report", URI: theirs.URI()},
+		{Kind: "report", URI: own.URI},
+	}, nil); err != nil {
+		t.Fatalf("insert artifacts: %v", err)
+	}
+	items, err := svc.Artifacts().ListByJob(jobID)
+	if err != nil || len(items) != 3 {
+		t.Fatalf("artifacts %+v, %v", items, err)
+	}
+	refused := 0
+	for _, a := range items {
+		switch a.URI {
+		case theirs.URI():
+			refused++
+			if _, _, err := svc.Artifacts().Open(a.ID); !errors.Is(err, artifacts.ErrNoContent) {
+				t.Fatalf("another job's blob was attached: %+v, %v", a, err)
+			}
+		case own.URI:
+			if _, data := readArtifact(t, svc, a.ID); data != `{"ok":true}` {
+				t.Fatalf("own upload content %q", data)
+			}
+		}
+	}
+	if refused != 1 {
+		t.Fatalf("expected one reference to another job's blob, got %d", refused)
+	}
+}
+
+func TestRemoteResultsCannotReadLocalFiles(t *testing.T) {
+	db := testDB(t)
+	svc, jobID, _ := dispatchExternalJob(t, db)
+	dataDir := t.TempDir()
+	svc.SetDataDir(dataDir)
+
+	secret := filepath.Join(dataDir, "db", "bb.sqlite")
+	if err := os.MkdirAll(filepath.Dir(secret), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(secret, []byte("SQLite format 3"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	own := filepath.Join(dataDir, "artifacts", "jobs", jobID, "execution.log")
+	if err := os.MkdirAll(filepath.Dir(own), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(own, []byte("done\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	final := `{"status":"succeeded","artifacts":[{"kind":"report","uri":"file://` + secret + `"},{"kind":"diff","uri":"db/bb.sqlite"},{"kind":"execution_log","uri":"file://` + own + `"}]}`
+	if err := svc.HandleCallback(jobID, signed("s3cret", "n-1", jobID, final), []byte(final)); err != nil {
+		t.Fatalf("final callback: %v", err)
+	}
+	items, err := svc.Artifacts().ListByJob(jobID)
+	if err != nil || len(items) != 3 {
+		t.Fatalf("artifacts %+v, %v", items, err)
+	}
+	for _, a := range items {
+		if a.SHA256 != "" {
+			t.Fatalf("remote artifact ingested a local file: %+v", a)
+		}
+	}
+	for _, a := range items[:2] {
+		if _, _, err := svc.Artifacts().Open(a.ID); !errors.Is(err, artifacts.ErrNoContent) {
+			t.Fatalf("expected %s to have no content, got %v", a.URI, err)
+		}
+	}
+}
+
+func TestDiffArtifactRecordsStepStats(t *testing.T) {
+	svc, runnerID, stepID := runnerSetup(t)
+	if stats, err := svc.StepDiffStats(stepID); err != nil || stats.ArtifactID != "" {
+		t.Fatalf("stats before any diff: %+v, %v", stats, err)
+	}
+	if _, err := svc.StepDiffStats("missing"); !errors.Is(err, workflows.ErrStepRunNotFound) {
+		t.Fatalf("expected ErrStepRunNotFound, got %v", err)
+	}
+	res, err := svc.DispatchStepRun(context.Background(), stepID)
+	if err != nil {
+		t.Fatalf("dispatch: %v", err)
+	}
+	svc.Wait()
+	if _, err := svc.ClaimJob(context.Background(), runnerID, 0); err != nil {
+		t.Fatalf("claim: %v", err)
+	}
+	patch := "diff --git a/main.go b/main.go\n--- a/main.go\n+++ b/main.go\n@@ -1,2 +1,2 @@\n-a\n+b\n c\n" +
+		"diff --git a/new.go b/new.go\nnew file mode 100644\n--- /dev/null\n+++ b/new.go\n@@ -0,0 +1,2 @@\n+x\n+y\n"
+	a, err := svc.StoreRunnerArtifact(runnerID, res.JobID, "diff", "diff.patch", strings.NewReader(patch))
+	if err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	stats, err := svc.StepDiffStats(stepID)
+	if err != nil {
+		t.Fatalf("stats: %v", err)
+	}
+	if stats.ArtifactID != a.ID || stats.Files != 2 || stats.Additions != 3 || stats.Deletions != 1 || stats.LinesChanged != 4 || stats.Added != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	_, d, err := svc.Artifacts().ParseDiff(a.ID)
+	if err != nil || d.Files[1].NewPath != "new.go" || len(d.Files[1].Hunks[0].Lines) != 2 {
+		t.Fatalf("parsed diff %+v, %v", d, err)
+	}
+}
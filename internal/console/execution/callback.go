@@ -0,0 +1,147 @@
+package execution
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PonyDevAI/Bull-Board/internal/console/execution_backends"
+)
+
+var (
+	ErrCallbackUnauthorized = errors.New("callback signature invalid")
+	ErrCallbackExpired      = errors.New("callback timestamp outside allowed window")
+	ErrCallbackReplayed     = errors.New("callback nonce already used")
+	ErrInvalidCallback      = errors.New("invalid callback payload")
+)
+
+// CallbackWindow is how far a callback timestamp may drift from console time.
+// Nonces are remembered for the same window.
+const CallbackWindow = 5 * time.Minute
+
+// CallbackSignature carries the signing headers of a job callback.
+type CallbackSignature struct {
+	Timestamp string
+	Nonce     string
+	Signature string
+}
+
+// LogChunk is a piece of job output reported by a backend.
+type LogChunk = execution_backends.LogChunk
+
+// Callback is the body an external backend posts to /api/jobs/{id}/callback.
+// Every field is optional; a final Status of "succeeded" or "failed" closes the job.
+type Callback struct {
+	Status         string                        `json:"status"`
+	ExternalJobRef string                        `json:"external_job_ref"`
+	Progress       map[string]any                `json:"progress"`
+	Logs           []LogChunk                    `json:"logs"`
+	Artifacts      []execution_backends.Artifact `json:"artifacts"`
+	Output         any                           `json:"output"`
+}
+
+// HandleCallback verifies a signed callback for jobID and applies it: log
+// chunks are appended, progress is stored on the job, and a final status is
+// applied through FinishJob so step and run state follow the job.
+func (s *Service) HandleCallback(jobID string, sig CallbackSignature, body []byte) error {
+	var backendID, status string
+	err := s.db.QueryRow(`SELECT COALESCE(execution_backend_id,''), status FROM jobs WHERE id = ?`, jobID).Scan(&backendID, &status)
+	if err == sql.ErrNoRows {
+		return ErrJobNotFound
+	}
+	if err != nil {
+		return err
+	}
+	backend, err := execution_backends.NewRepository(s.db).Get(backendID)
+	if err != nil {
+		return ErrCallbackUnauthorized
+	}
+	if !execution_backends.VerifyCallbackSignature(backend.CallbackSecret, sig.Timestamp, sig.Nonce, jobID, body, sig.Signature) {
+		return ErrCallbackUnauthorized
+	}
+	if err := s.checkCallbackFreshness(backendID, sig); err != nil {
+		return err
+	}
+
+	var cb Callback
+	if err := json.Unmarshal(body, &cb); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidCallback, err)
+	}
+	switch cb.Status {
+	case "", "running", "succeeded", "failed":
+	default:
+		return fmt.Errorf("%w: unknown status %q", ErrInvalidCallback, cb.Status)
+	}
+	if status != "queued" && status != "running" && status != "cancelling" {
+		return fmt.Errorf("%w: status=%s", ErrJobNotActive, status)
+	}
+
+	for _, chunk := range cb.Logs {
+		if err := s.appendJobLog(jobID, chunk); err != nil {
+			return err
+		}
+	}
+	if cb.Progress != nil {
+		if err := s.storeProgress(jobID, cb.Progress); err != nil {
+			return err
+		}
+	}
+	if cb.Status == "" {
+		return nil
+	}
+	return s.FinishJob(jobID, execution_backends.Result{
+		Status:         cb.Status,
+		ExternalJobRef: cb.ExternalJobRef,
+		Output:         cb.Output,
+		Artifacts:      cb.Artifacts,
+	})
+}
+
+// checkCallbackFreshness rejects callbacks outside CallbackWindow and records
+// the nonce so the same signed request cannot be accepted twice.
+func (s *Service) checkCallbackFreshness(backendID string, sig CallbackSignature) error {
+	unix, err := strconv.ParseInt(sig.Timestamp, 10, 64)
+	if err != nil {
+		return ErrCallbackExpired
+	}
+	now := time.Now().UTC()
+	if d := now.Sub(time.Unix(unix, 0)); d > CallbackWindow || d < -CallbackWindow {
+		return ErrCallbackExpired
+	}
+	if strings.TrimSpace(sig.Nonce) == "" {
+		return ErrCallbackReplayed
+	}
+	cutoff := now.Add(-2 * CallbackWindow).Format(time.RFC3339)
+	if _, err := s.db.Exec(`DELETE FROM job_callback_nonces WHERE created_at < ?`, cutoff); err != nil {
+		return err
+	}
+	res, err := s.db.Exec(`INSERT INTO job_callback_nonces (execution_backend_id, nonce, created_at) VALUES (?, ?, ?) ON CONFLICT DO NOTHING`, backendID, sig.Nonce, now.Format(time.RFC3339))
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrCallbackReplayed
+	}
+	return nil
+}
+
+func (s *Service) storeProgress(jobID string, progress map[string]any) error {
+	progressJSON, err := json.Marshal(progress)
+	if err != nil {
+		return err
+	}
+	var stepRunID string
+	if err := s.db.QueryRow(`SELECT step_run_id FROM jobs WHERE id = ?`, jobID).Scan(&stepRunID); err != nil {
+		return err
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	if _, err := s.db.Exec(`UPDATE jobs SET progress_json = ?, updated_at = ? WHERE id = ?`, string(progressJSON), now, jobID); err != nil {
+		return err
+	}
+	s.events.Publish("job_progress", map[string]any{"job_id": jobID, "step_run_id": stepRunID, "progress": progress})
+	return nil
+}
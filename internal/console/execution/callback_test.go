@@ -0,0 +1,102 @@
+package execution
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/PonyDevAI/Bull-Board/internal/console/execution_backends"
+)
+
+func dispatchExternalJob(t *testing.T, db *sql.DB) (*Service, string, string) {
+	t.Helper()
+	seedExecutionStack(t, db)
+	seedWorker(t, db, "worker-exec", "planner")
+	_, stepID := seedWorkflowRun(t, db)
+	if err := execution_backends.NewRepository(db).SetCallbackSecret("backend-default", "s3cret"); err != nil {
+		t.Fatalf("set callback secret: %v", err)
+	}
+	svc := NewService(db)
+	svc.Connectors().Register("openclaw", fakeConnector{result: execution_backends.Result{Status: "running", ExternalJobRef: "ext-1"}})
+	result, err := svc.DispatchStepRun(context.Background(), stepID)
+	if err != nil {
+		t.Fatalf("dispatch step run: %v", err)
+	}
+	svc.Wait()
+	return svc, result.JobID, stepID
+}
+
+func signed(secret, nonce, jobID, body string) CallbackSignature {
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	return CallbackSignature{Timestamp: ts, Nonce: nonce, Signature: execution_backends.SignCallback(secret, ts, nonce, jobID, []byte(body))}
+}
+
+func TestHandleCallbackStoresProgressAndCompletesStep(t *testing.T) {
+	db := testDB(t)
+	svc, jobID, stepID := dispatchExternalJob(t, db)
+
+	progress := `{"progress":{"percent":50},"logs":[{"content":"building\n"},{"stream":"stderr","content":"warn\n"}]}`
+	if err := svc.HandleCallback(jobID, signed("s3cret", "n-1", jobID, progress), []byte(progress)); err != nil {
+		t.Fatalf("progress callback: %v", err)
+	}
+	var progressJSON string
+	if err := db.QueryRow(`SELECT progress_json FROM jobs WHERE id = ?`, jobID).Scan(&progressJSON); err != nil {
+		t.Fatalf("read progress: %v", err)
+	}
+	if progressJSON != `{"percent":50}` {
+		t.Fatalf("unexpected progress %s", progressJSON)
+	}
+	var lastOffset int
+	if err := db.QueryRow(`SELECT MAX(byte_offset) FROM job_logs WHERE job_id = ?`, jobID).Scan(&lastOffset); err != nil {
+		t.Fatalf("read logs: %v", err)
+	}
+	if lastOffset != len("building\n") {
+		t.Fatalf("expected second chunk at offset %d, got %d", len("building\n"), lastOffset)
+	}
+	assertStepStatus(t, db, stepID, "running")
+
+	final := `{"status":"succeeded","output":{"summary":"done"},"artifacts":[{"kind":"report","uri":"https://example.test/r.json"}]}`
+	if err := svc.HandleCallback(jobID, signed("s3cret", "n-2", jobID, final), []byte(final)); err != nil {
+		t.Fatalf("final callback: %v", err)
+	}
+	assertStepStatus(t, db, stepID, "completed")
+	var artifacts int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM artifacts WHERE job_id = ?`, jobID).Scan(&artifacts); err != nil {
+		t.Fatalf("read artifacts: %v", err)
+	}
+	if artifacts != 1 {
+		t.Fatalf("expected 1 artifact, got %d", artifacts)
+	}
+}
+
+func TestHandleCallbackRejectsBadSignatureReplayAndStaleTimestamp(t *testing.T) {
+	db := testDB(t)
+	svc, jobID, stepID := dispatchExternalJob(t, db)
+	body := `{"status":"failed"}`
+
+	if err := svc.HandleCallback(jobID, signed("wrong", "n-1", jobID, body), []byte(body)); !errors.Is(err, ErrCallbackUnauthorized) {
+		t.Fatalf("expected unauthorized, got %v", err)
+	}
+	otherJob := signed("s3cret", "n-1", "other-job", body)
+	if err := svc.HandleCallback(jobID, otherJob, []byte(body)); !errors.Is(err, ErrCallbackUnauthorized) {
+		t.Fatalf("expected signature bound to job id, got %v", err)
+	}
+	old := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	stale := CallbackSignature{Timestamp: old, Nonce: "n-2", Signature: execution_backends.SignCallback("s3cret", old, "n-2", jobID, []byte(body))}
+	if err := svc.HandleCallback(jobID, stale, []byte(body)); !errors.Is(err, ErrCallbackExpired) {
+		t.Fatalf("expected expired, got %v", err)
+	}
+
+	progress := `{"progress":{"percent":10}}`
+	sig := signed("s3cret", "n-3", jobID, progress)
+	if err := svc.HandleCallback(jobID, sig, []byte(progress)); err != nil {
+		t.Fatalf("first callback: %v", err)
+	}
+	if err := svc.HandleCallback(jobID, sig, []byte(progress)); !errors.Is(err, ErrCallbackReplayed) {
+		t.Fatalf("expected replay rejection, got %v", err)
+	}
+	assertStepStatus(t, db, stepID, "running")
+}
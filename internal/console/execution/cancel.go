@@ -0,0 +1,223 @@
+package execution
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/PonyDevAI/Bull-Board/internal/console/execution_backends"
+	"github.com/PonyDevAI/Bull-Board/internal/console/workflows"
+)
+
+var (
+	ErrCancelUnsupported = errors.New("execution backend cannot cancel jobs")
+	ErrCancelFailed      = errors.New("execution backend failed to cancel job")
+)
+
+const (
+	// CancelReasonTimeout marks cancellations caused by a step timeout; the
+	// step run fails instead of being cancelled.
+	CancelReasonTimeout = "timeout"
+	// JobTimeoutSweepInterval is how often running jobs are checked against
+	// their step's timeout_seconds.
+	JobTimeoutSweepInterval = 10 * time.Second
+)
+
+// CancelJob stops an active job. In-process executions are interrupted and
+// finish as cancelled once the connector returns; jobs leased by a runner
+// finish once the runner hears of it (see RenewLease); jobs accepted by a
+// remote backend are cancelled through the connector's Cancel using
+// external_job_ref. It returns the job status after the call: "cancelling"
+// or "cancelled".
+func (s *Service) CancelJob(ctx context.Context, jobID, reason string) (string, error) {
+	var stepRunID, status, externalRef string
+	var backendID sql.NullString
+	err := s.db.QueryRow(`SELECT step_run_id, status, COALESCE(external_job_ref,''), execution_backend_id FROM jobs WHERE id = ?`, jobID).
+		Scan(&stepRunID, &status, &externalRef, &backendID)
+	if err == sql.ErrNoRows {
+		return "", ErrJobNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	if status != "queued" && status != "running" {
+		return status, fmt.Errorf("%w: status=%s", ErrJobNotActive, status)
+	}
+
+	s.mu.Lock()
+	interrupt, inProcess := s.running[jobID]
+	s.mu.Unlock()
+
+	var canceler execution_backends.Canceler
+	var backend execution_backends.Backend
+	var leased bool
+	if !inProcess && status == "running" {
+		backend, err = execution_backends.NewRepository(s.db).Get(backendID.String)
+		if err != nil {
+			return status, err
+		}
+		connector, _ := s.connectors.ForBackend(backend)
+		_, leased = connector.(execution_backends.Pulled)
+		c, ok := connector.(execution_backends.Canceler)
+		if !leased && (!ok || externalRef == "") {
+			return status, fmt.Errorf("%w: backend %s (%s)", ErrCancelUnsupported, backend.ID, backend.Type)
+		}
+		canceler = c
+	}
+
+	if err := s.markJobCancelling(jobID, status, reason); err != nil {
+		return status, err
+	}
+	s.publishJobStatus(jobID, stepRunID, "cancelling", externalRef)
+
+	switch {
+	case inProcess:
+		// runJob observes the interrupted context and finishes the job as cancelled.
+		interrupt()
+		return "cancelling", nil
+	case leased:
+		// The runner keeps the lease until its next heartbeat is refused,
+		// which is when it stops the work, or until it reports first.
+		return "cancelling", nil
+	case canceler != nil:
+		if err := canceler.Cancel(ctx, backend, externalRef); err != nil {
+			now := time.Now().UTC().Format(time.RFC3339)
+			_, _ = s.db.Exec(`UPDATE jobs SET status=?, cancel_reason='', updated_at=? WHERE id=? AND status='cancelling'`, status, now, jobID)
+			s.publishJobStatus(jobID, stepRunID, status, externalRef)
+			return status, fmt.Errorf("%w: %v", ErrCancelFailed, err)
+		}
+	}
+	// Queued jobs that have not started, and remote jobs the backend stopped, end here.
+	if err := s.finishCancelled(jobID, stepRunID, execution_backends.Result{ExternalJobRef: externalRef}, nil); err != nil {
+		return "cancelling", err
+	}
+	return "cancelled", nil
+}
+
+func (s *Service) markJobCancelling(jobID, from, reason string) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	res, err := s.db.Exec(`UPDATE jobs SET status='cancelling', cancel_reason=?, updated_at=? WHERE id=? AND status=?`, reason, now, jobID, from)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrJobNotActive
+	}
+	return nil
+}
+
+// finishCancelled closes a cancelling job as cancelled. A timeout fails the
+// step run; any other reason cancels it, which also cancels the workflow run.
+func (s *Service) finishCancelled(jobID, stepRunID string, result execution_backends.Result, roots []string) error {
+	var reason string
+	if err := s.db.QueryRow(`SELECT cancel_reason FROM jobs WHERE id = ?`, jobID).Scan(&reason); err != nil {
+		return err
+	}
+	result.Status = "cancelled"
+	if err := s.completeJob(jobID, "cancelled", result); err != nil {
+		return err
+	}
+	if err := s.insertArtifacts(jobID, stepRunID, result.Artifacts, roots); err != nil {
+		return err
+	}
+	if err := s.archiveJobLog(jobID, stepRunID, result.Artifacts); err != nil {
+		slog.Warn("execution: archive job log", "job_id", jobID, "err", err)
+	}
+	s.publishJobStatus(jobID, stepRunID, "cancelled", result.ExternalJobRef)
+
+	wf := workflows.NewService(s.db)
+	var err error
+	if reason == CancelReasonTimeout {
+		err = wf.FailStep(stepRunID, map[string]any{"error": "job timed out", "job_id": jobID})
+	} else {
+		err = wf.CancelStep(stepRunID, map[string]any{"cancelled": true, "reason": reason, "job_id": jobID})
+	}
+	s.DrainQueue()
+	return err
+}
+
+// pendingJob is an active job found by Start.
+type pendingJob struct{ id, stepRunID, status, externalRef, backendID string }
+
+// recoverCancelling finishes a job a previous console process was cancelling.
+// A runner still holding the lease is told on its next heartbeat and expired
+// leases are closed by RequeueExpiredLeases, so leased jobs are left to them.
+// A remote backend is asked to cancel again, since the earlier request may
+// never have been sent; the job is closed whatever it answers. In-process
+// executions did not survive the restart and are closed at once.
+func (s *Service) recoverCancelling(ctx context.Context, j pendingJob) error {
+	var connector execution_backends.Connector
+	var backend execution_backends.Backend
+	if j.backendID != "" {
+		b, err := execution_backends.NewRepository(s.db).Get(j.backendID)
+		if err != nil {
+			return err
+		}
+		backend = b
+		connector, _ = s.connectors.ForBackend(backend)
+	}
+	if _, leased := connector.(execution_backends.Pulled); leased {
+		return nil
+	}
+	if canceler, ok := connector.(execution_backends.Canceler); ok && j.externalRef != "" {
+		if err := canceler.Cancel(ctx, backend, j.externalRef); err != nil {
+			slog.Warn("execution: cancel remote job after restart", "job_id", j.id, "err", err)
+		}
+	}
+	return s.finishCancelled(j.id, j.stepRunID, execution_backends.Result{ExternalJobRef: j.externalRef}, nil)
+}
+
+// RunJobTimeouts cancels jobs that outlive their step's timeout_seconds until ctx is done.
+func (s *Service) RunJobTimeouts(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		s.CancelTimedOutJobs(ctx, time.Now().UTC())
+	}
+}
+
+// CancelTimedOutJobs cancels running jobs started more than the step
+// config's timeout_seconds before now.
+func (s *Service) CancelTimedOutJobs(ctx context.Context, now time.Time) {
+	rows, err := s.db.Query(`SELECT id, COALESCE(started_at,''), request_json FROM jobs WHERE status = 'running'`)
+	if err != nil {
+		slog.Error("execution: job timeouts", "err", err)
+		return
+	}
+	var expired []string
+	for rows.Next() {
+		var id, startedAt, requestJSON string
+		if err := rows.Scan(&id, &startedAt, &requestJSON); err != nil {
+			continue
+		}
+		var req struct {
+			Step struct {
+				Config struct {
+					TimeoutSeconds int `json:"timeout_seconds"`
+				} `json:"config"`
+			} `json:"step"`
+		}
+		started, err := time.Parse(time.RFC3339, startedAt)
+		if err != nil || json.Unmarshal([]byte(requestJSON), &req) != nil || req.Step.Config.TimeoutSeconds <= 0 {
+			continue
+		}
+		if now.Sub(started) > time.Duration(req.Step.Config.TimeoutSeconds)*time.Second {
+			expired = append(expired, id)
+		}
+	}
+	rows.Close()
+	for _, id := range expired {
+		if _, err := s.CancelJob(ctx, id, CancelReasonTimeout); err != nil {
+			slog.Warn("execution: cancel timed out job", "job_id", id, "err", err)
+		}
+	}
+}
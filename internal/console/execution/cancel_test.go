@@ -0,0 +1,237 @@
+package execution
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/PonyDevAI/Bull-Board/internal/console/execution_backends"
+)
+
+type cancelConnector struct {
+	fakeConnector
+	cancelled *[]string
+	err       error
+}
+
+func (c cancelConnector) Cancel(ctx context.Context, b execution_backends.Backend, ref string) error {
+	if c.err != nil {
+		return c.err
+	}
+	*c.cancelled = append(*c.cancelled, ref)
+	return nil
+}
+
+// blockingConnector runs until its context is cancelled.
+type blockingConnector struct{ started chan struct{} }
+
+func (b blockingConnector) Execute(ctx context.Context, req execution_backends.Request) (execution_backends.Result, error) {
+	close(b.started)
+	<-ctx.Done()
+	return execution_backends.Result{}, ctx.Err()
+}
+
+func jobStatus(t *testing.T, svc *Service, jobID string) string {
+	t.Helper()
+	var status string
+	if err := svc.db.QueryRow(`SELECT status FROM jobs WHERE id = ?`, jobID).Scan(&status); err != nil {
+		t.Fatalf("read job: %v", err)
+	}
+	return status
+}
+
+func dispatchRemoteJob(t *testing.T, svc *Service, stepID string) string {
+	t.Helper()
+	res, err := svc.DispatchStepRun(context.Background(), stepID)
+	if err != nil {
+		t.Fatalf("dispatch: %v", err)
+	}
+	svc.Wait()
+	return res.JobID
+}
+
+func TestCancelJobCallsBackendCancel(t *testing.T) {
+	db := testDB(t)
+	seedExecutionStack(t, db)
+	seedWorker(t, db, "worker-exec", "planner")
+	runID, stepID := seedWorkflowRun(t, db)
+	svc := NewService(db)
+	var cancelled []string
+	svc.Connectors().Register("openclaw", cancelConnector{
+		fakeConnector: fakeConnector{result: execution_backends.Result{Status: "running", ExternalJobRef: "ext-42"}},
+		cancelled:     &cancelled,
+	})
+	jobID := dispatchRemoteJob(t, svc, stepID)
+
+	status, err := svc.CancelJob(context.Background(), jobID, "cancelled by user")
+	if err != nil || status != "cancelled" {
+		t.Fatalf("cancel: status=%s err=%v", status, err)
+	}
+	if len(cancelled) != 1 || cancelled[0] != "ext-42" {
+		t.Fatalf("expected backend cancel with external ref, got %v", cancelled)
+	}
+	if got := jobStatus(t, svc, jobID); got != "cancelled" {
+		t.Fatalf("job status %s", got)
+	}
+	assertStepStatus(t, db, stepID, "cancelled")
+	var runStatus string
+	if err := db.QueryRow(`SELECT status FROM workflow_runs WHERE id = ?`, runID).Scan(&runStatus); err != nil {
+		t.Fatalf("read run: %v", err)
+	}
+	if runStatus != "cancelled" {
+		t.Fatalf("expected workflow run cancelled, got %s", runStatus)
+	}
+	if _, err := svc.CancelJob(context.Background(), jobID, ""); !errors.Is(err, ErrJobNotActive) {
+		t.Fatalf("expected second cancel to be rejected, got %v", err)
+	}
+}
+
+func TestStartFinishesJobsLeftCancelling(t *testing.T) {
+	db := testDB(t)
+	seedExecutionStack(t, db)
+	seedWorker(t, db, "worker-exec", "planner")
+	_, stepID := seedWorkflowRun(t, db)
+	svc := NewService(db)
+	svc.Connectors().Register("openclaw", fakeConnector{result: execution_backends.Result{Status: "running", ExternalJobRef: "ext-7"}})
+	jobID := dispatchRemoteJob(t, svc, stepID)
+	// The console stopped after marking the job but before the backend answered.
+	if _, err := db.Exec(`UPDATE jobs SET status = 'cancelling', cancel_reason = 'stop' WHERE id = ?`, jobID); err != nil {
+		t.Fatal(err)
+	}
+
+	restarted := NewService(db)
+	var cancelled []string
+	restarted.Connectors().Register("openclaw", cancelConnector{cancelled: &cancelled})
+	if err := restarted.Start(context.Background()); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	if got := jobStatus(t, restarted, jobID); got != "cancelled" {
+		t.Fatalf("job status %s, want cancelled", got)
+	}
+	if len(cancelled) != 1 || cancelled[0] != "ext-7" {
+		t.Fatalf("expected the backend to be asked again, got %v", cancelled)
+	}
+	assertStepStatus(t, db, stepID, "cancelled")
+}
+
+func TestCancelJobReportsUnsupportedBackend(t *testing.T) {
+	db := testDB(t)
+	seedExecutionStack(t, db)
+	seedWorker(t, db, "worker-exec", "planner")
+	_, stepID := seedWorkflowRun(t, db)
+	svc := NewService(db)
+	svc.Connectors().Register("openclaw", fakeConnector{result: execution_backends.Result{Status: "running", ExternalJobRef: "ext-1"}})
+	jobID := dispatchRemoteJob(t, svc, stepID)
+
+	if _, err := svc.CancelJob(context.Background(), jobID, "stop"); !errors.Is(err, ErrCancelUnsupported) {
+		t.Fatalf("expected ErrCancelUnsupported, got %v", err)
+	}
+	if got := jobStatus(t, svc, jobID); got != "running" {
+		t.Fatalf("expected job to stay running, got %s", got)
+	}
+	assertStepStatus(t, db, stepID, "running")
+}
+
+func TestCancelJobRevertsWhenBackendFails(t *testing.T) {
+	db := testDB(t)
+	seedExecutionStack(t, db)
+	seedWorker(t, db, "worker-exec", "planner")
+	_, stepID := seedWorkflowRun(t, db)
+	svc := NewService(db)
+	svc.Connectors().Register("openclaw", cancelConnector{
+		fakeConnector: fakeConnector{result: execution_backends.Result{Status: "running", ExternalJobRef: "ext-1"}},
+		err:           errors.New("gateway down"),
+	})
+	jobID := dispatchRemoteJob(t, svc, stepID)
+
+	if _, err := svc.CancelJob(context.Background(), jobID, "stop"); !errors.Is(err, ErrCancelFailed) {
+		t.Fatalf("expected ErrCancelFailed, got %v", err)
+	}
+	if got := jobStatus(t, svc, jobID); got != "running" {
+		t.Fatalf("expected job reverted to running, got %s", got)
+	}
+}
+
+func TestCancelJobInterruptsInProcessExecution(t *testing.T) {
+	db := testDB(t)
+	seedExecutionStack(t, db)
+	seedWorker(t, db, "worker-exec", "planner")
+	_, stepID := seedWorkflowRun(t, db)
+	svc := NewService(db)
+	started := make(chan struct{})
+	svc.Connectors().Register("openclaw", blockingConnector{started: started})
+	res, err := svc.DispatchStepRun(context.Background(), stepID)
+	if err != nil {
+		t.Fatalf("dispatch: %v", err)
+	}
+	<-started
+
+	status, err := svc.CancelJob(context.Background(), res.JobID, "stop")
+	if err != nil || status != "cancelling" {
+		t.Fatalf("cancel: status=%s err=%v", status, err)
+	}
+	svc.Wait()
+	if got := jobStatus(t, svc, res.JobID); got != "cancelled" {
+		t.Fatalf("expected cancelled after interrupt, got %s", got)
+	}
+	assertStepStatus(t, db, stepID, "cancelled")
+}
+
+// executedConnector records whether a job reached Execute.
+type executedConnector struct{ executed *bool }
+
+func (c executedConnector) Execute(ctx context.Context, req execution_backends.Request) (execution_backends.Result, error) {
+	*c.executed = true
+	return execution_backends.Result{Status: "succeeded"}, nil
+}
+
+func TestCancelBeforeJobStartsFinishesCancelled(t *testing.T) {
+	db := testDB(t)
+	seedExecutionStack(t, db)
+	seedWorker(t, db, "worker-exec", "planner")
+	_, stepID := seedWorkflowRun(t, db)
+	svc := NewService(db)
+	svc.Connectors().Register("openclaw", fakeConnector{result: execution_backends.Result{Status: "running", ExternalJobRef: "ext"}})
+	jobID := dispatchRemoteJob(t, svc, stepID)
+
+	// CancelJob found the job registered as in-process but not yet marked
+	// running: it moved it to cancelling and left it to runJob.
+	if _, err := db.Exec(`UPDATE jobs SET status='cancelling', cancel_reason='stop' WHERE id = ?`, jobID); err != nil {
+		t.Fatalf("mark cancelling: %v", err)
+	}
+	var executed bool
+	svc.Connectors().Register("openclaw", executedConnector{executed: &executed})
+	svc.runJob(jobID)
+	if executed {
+		t.Fatalf("a cancelled job must not execute")
+	}
+	if got := jobStatus(t, svc, jobID); got != "cancelled" {
+		t.Fatalf("expected cancelled, got %s", got)
+	}
+	assertStepStatus(t, db, stepID, "cancelled")
+}
+
+func TestCancelTimedOutJobsFailsStep(t *testing.T) {
+	db := testDB(t)
+	seedExecutionStack(t, db)
+	seedWorker(t, db, "worker-exec", "planner")
+	_, stepID := seedWorkflowRun(t, db)
+	svc := NewService(db)
+	var cancelled []string
+	svc.Connectors().Register("openclaw", cancelConnector{
+		fakeConnector: fakeConnector{result: execution_backends.Result{Status: "running", ExternalJobRef: "ext-slow"}},
+		cancelled:     &cancelled,
+	})
+	jobID := dispatchRemoteJob(t, svc, stepID)
+	started := time.Now().UTC().Add(-time.Minute).Format(time.RFC3339)
+	if _, err := db.Exec(`UPDATE jobs SET started_at = ?, request_json = '{"step":{"config":{"timeout_seconds":30}}}' WHERE id = ?`, started, jobID); err != nil {
+		t.Fatalf("age job: %v", err)
+	}
+
+	svc.CancelTimedOutJobs(context.Background(), time.Now().UTC())
+	if got := jobStatus(t, svc, jobID); got != "cancelled" {
+		t.Fatalf("expected timed out job cancelled, got %s", got)
+	}
+	assertStepStatus(t, db, stepID, "failed")
+}
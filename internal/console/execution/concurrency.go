@@ -0,0 +1,162 @@
+package execution
+
+import (
+	"database/sql"
+	"log/slog"
+
+	"github.com/PonyDevAI/Bull-Board/internal/console/workflows"
+)
+
+// hasCapacity reports whether the worker and its execution backend can start
+// one more step. A max_concurrency of 0 or less means unlimited. Callers hold
+// s.admission so the count and the following start are atomic.
+func (s *Service) hasCapacity(workerID, backendID string) (bool, error) {
+	var workerMax, workerRunning int
+	err := s.db.QueryRow(`SELECT max_concurrency, (SELECT COUNT(*) FROM step_runs WHERE worker_id = workers.id AND status = 'running') FROM workers WHERE id = ?`, workerID).
+		Scan(&workerMax, &workerRunning)
+	if err != nil {
+		return false, err
+	}
+	if workerMax > 0 && workerRunning >= workerMax {
+		return false, nil
+	}
+	var backendMax, backendRunning int
+	err = s.db.QueryRow(`
+		SELECT max_concurrency, (SELECT COUNT(*) FROM step_runs sr JOIN workers w ON w.id = sr.worker_id WHERE w.execution_backend_id = execution_backends.id AND sr.status = 'running')
+		FROM execution_backends WHERE id = ?`, backendID).Scan(&backendMax, &backendRunning)
+	if err != nil {
+		return false, err
+	}
+	return backendMax <= 0 || backendRunning < backendMax, nil
+}
+
+// queuePosition is the 1-based position of a queued step among the steps
+// queued for the same worker. Steps queued at the same instant are ordered
+// by rowid, as in DrainQueue and WorkerLoad.
+func (s *Service) queuePosition(stepRunID string) (int, error) {
+	var position int
+	err := s.db.QueryRow(`
+		SELECT COUNT(*) FROM step_runs q
+		JOIN step_runs sr ON sr.id = ?
+		WHERE q.status = 'queued' AND q.worker_id = sr.worker_id
+		  AND (q.queued_at < sr.queued_at OR (q.queued_at = sr.queued_at AND q.rowid <= sr.rowid))`, stepRunID).Scan(&position)
+	return position, err
+}
+
+// DrainQueue starts queued step runs, oldest first, while their worker and
+// backend have capacity. A step whose worker's backend went offline or lost
+// a required capability moves to another eligible worker of its role first.
+// Steps that can no longer be dispatched stay queued and are logged.
+func (s *Service) DrainQueue() {
+	s.admission.Lock()
+	defer s.admission.Unlock()
+	rows, err := s.db.Query(`SELECT id FROM step_runs WHERE status = 'queued' ORDER BY queued_at ASC, rowid ASC`)
+	if err != nil {
+		slog.Error("execution: drain queue", "err", err)
+		return
+	}
+	var queued []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err == nil {
+			queued = append(queued, id)
+		}
+	}
+	rows.Close()
+
+	wf := workflows.NewService(s.db)
+	for _, stepRunID := range queued {
+		s.rerouteQueued(wf, stepRunID)
+		prepared, backend, err := s.prepare(stepRunID)
+		if err != nil {
+			slog.Warn("execution: queued step not dispatchable", "step_run_id", stepRunID, "err", err)
+			continue
+		}
+		ok, err := s.hasCapacity(asString(prepared.Worker["id"]), backend.ID)
+		if err != nil || !ok {
+			continue
+		}
+		if _, err := s.startJob(wf, stepRunID, backend.ID, prepared); err != nil {
+			slog.Error("execution: start queued step", "step_run_id", stepRunID, "err", err)
+		}
+	}
+}
+
+// rerouteQueued moves a queued step off a worker that is no longer eligible
+// for it, as routeToEligibleWorker does for a step being dispatched.
+func (s *Service) rerouteQueued(wf *workflows.Service, stepRunID string) {
+	_, assigned, _, err := wf.StepCandidates(stepRunID)
+	if err != nil || assigned == nil || assigned.Eligible {
+		return
+	}
+	workerID, err := wf.MoveQueuedStep(stepRunID)
+	if err != nil {
+		slog.Warn("execution: reroute queued step", "step_run_id", stepRunID, "err", err)
+		return
+	}
+	if workerID != "" {
+		s.events.Publish("step_run_queued", map[string]any{"step_run_id": stepRunID, "worker_id": workerID, "rerouted_from": assigned.WorkerID})
+	}
+}
+
+// StepLoad is a running or queued step run on a worker.
+type StepLoad struct {
+	StepRunID     string `json:"step_run_id"`
+	WorkflowRunID string `json:"workflow_run_id"`
+	Status        string `json:"status"`
+	JobID         string `json:"job_id,omitempty"`
+	QueuePosition int    `json:"queue_position,omitempty"`
+	QueuedAt      string `json:"queued_at,omitempty"`
+	StartedAt     string `json:"started_at,omitempty"`
+}
+
+// WorkerLoad is a worker's running and queued step runs against its capacity
+// and the capacity of its execution backend.
+type WorkerLoad struct {
+	WorkerID           string     `json:"worker_id"`
+	MaxConcurrency     int        `json:"max_concurrency"`
+	Running            []StepLoad `json:"running"`
+	Queued             []StepLoad `json:"queued"`
+	ExecutionBackendID string     `json:"execution_backend_id"`
+	BackendMax         int        `json:"backend_max_concurrency"`
+	BackendRunning     int        `json:"backend_running"`
+}
+
+func (s *Service) WorkerLoad(workerID string) (WorkerLoad, error) {
+	load := WorkerLoad{WorkerID: workerID, Running: []StepLoad{}, Queued: []StepLoad{}}
+	err := s.db.QueryRow(`
+		SELECT w.max_concurrency, w.execution_backend_id, COALESCE(eb.max_concurrency, 0),
+			(SELECT COUNT(*) FROM step_runs sr JOIN workers bw ON bw.id = sr.worker_id WHERE bw.execution_backend_id = w.execution_backend_id AND sr.status = 'running')
+		FROM workers w LEFT JOIN execution_backends eb ON eb.id = w.execution_backend_id
+		WHERE w.id = ?`, workerID).Scan(&load.MaxConcurrency, &load.ExecutionBackendID, &load.BackendMax, &load.BackendRunning)
+	if err == sql.ErrNoRows {
+		return load, ErrWorkerNotFound
+	}
+	if err != nil {
+		return load, err
+	}
+	rows, err := s.db.Query(`
+		SELECT sr.id, sr.workflow_run_id, sr.status, COALESCE(sr.queued_at,''), COALESCE(sr.started_at,''),
+			COALESCE((SELECT j.id FROM jobs j WHERE j.step_run_id = sr.id ORDER BY j.created_at DESC LIMIT 1), '')
+		FROM step_runs sr
+		WHERE sr.worker_id = ? AND sr.status IN ('running','queued')
+		ORDER BY sr.queued_at ASC, sr.rowid ASC`, workerID)
+	if err != nil {
+		return load, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var st StepLoad
+		if err := rows.Scan(&st.StepRunID, &st.WorkflowRunID, &st.Status, &st.QueuedAt, &st.StartedAt, &st.JobID); err != nil {
+			return load, err
+		}
+		if st.Status == "queued" {
+			st.JobID = ""
+			st.QueuePosition = len(load.Queued) + 1
+			load.Queued = append(load.Queued, st)
+		} else {
+			load.Running = append(load.Running, st)
+		}
+	}
+	return load, rows.Err()
+}
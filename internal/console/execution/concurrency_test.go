@@ -0,0 +1,206 @@
+package execution
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/PonyDevAI/Bull-Board/internal/console/execution_backends"
+	"github.com/PonyDevAI/Bull-Board/internal/console/workflows"
+)
+
+func TestDispatchQueuesStepsBeyondWorkerCapacity(t *testing.T) {
+	db := testDB(t)
+	seedExecutionStack(t, db)
+	seedWorker(t, db, "worker-exec", "planner")
+	_, firstStep := seedWorkflowRun(t, db)
+	wf := workflows.NewService(db)
+	secondRun, err := wf.CreateRunFromTask("task-second", "default-workspace", "tpl-dispatch", workflows.NewDBWorkerResolver(db))
+	if err != nil {
+		t.Fatalf("create second run: %v", err)
+	}
+	state, err := wf.GetWorkflowRunState(secondRun)
+	if err != nil {
+		t.Fatalf("second run state: %v", err)
+	}
+	secondStep := state.StepRuns[0]["id"].(string)
+
+	svc := NewService(db)
+	svc.Connectors().Register("openclaw", fakeConnector{result: execution_backends.Result{Status: "running", ExternalJobRef: "ext"}})
+	first, err := svc.DispatchStepRun(context.Background(), firstStep)
+	if err != nil {
+		t.Fatalf("dispatch first: %v", err)
+	}
+	second, err := svc.DispatchStepRun(context.Background(), secondStep)
+	if err != nil {
+		t.Fatalf("dispatch second: %v", err)
+	}
+	svc.Wait()
+	if second.JobID != "" || second.ExecutionStatus != "waiting_for_capacity" || second.QueuePosition != 1 {
+		t.Fatalf("expected second dispatch queued at position 1, got %+v", second)
+	}
+	assertStepStatus(t, db, secondStep, "queued")
+
+	load, err := svc.WorkerLoad("worker-exec")
+	if err != nil {
+		t.Fatalf("worker load: %v", err)
+	}
+	if load.MaxConcurrency != 1 || len(load.Running) != 1 || len(load.Queued) != 1 || load.Queued[0].StepRunID != secondStep || load.Running[0].JobID != first.JobID {
+		t.Fatalf("unexpected load %+v", load)
+	}
+
+	if err := svc.FinishJob(first.JobID, execution_backends.Result{Status: "succeeded"}); err != nil {
+		t.Fatalf("finish first job: %v", err)
+	}
+	svc.Wait()
+	assertStepStatus(t, db, secondStep, "running")
+	var jobs int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM jobs WHERE step_run_id = ?`, secondStep).Scan(&jobs); err != nil {
+		t.Fatalf("count jobs: %v", err)
+	}
+	if jobs != 1 {
+		t.Fatalf("expected queued step to get a job once capacity freed, got %d", jobs)
+	}
+}
+
+func TestDispatchEnforcesBackendConcurrency(t *testing.T) {
+	db := testDB(t)
+	seedExecutionStack(t, db)
+	seedWorker(t, db, "worker-exec", "planner")
+	seedWorker(t, db, "worker-other", "planner")
+	if _, err := db.Exec(`UPDATE execution_backends SET max_concurrency = 1 WHERE id = 'backend-default'`); err != nil {
+		t.Fatalf("set backend limit: %v", err)
+	}
+	_, firstStep := seedWorkflowRun(t, db)
+	wf := workflows.NewService(db)
+	secondRun, err := wf.CreateRunFromTask("task-second", "default-workspace", "tpl-dispatch", workflows.NewDBWorkerResolver(db))
+	if err != nil {
+		t.Fatalf("create second run: %v", err)
+	}
+	state, _ := wf.GetWorkflowRunState(secondRun)
+	secondStep := state.StepRuns[0]["id"].(string)
+	if _, err := db.Exec(`UPDATE step_runs SET worker_id = 'worker-other' WHERE id = ?`, secondStep); err != nil {
+		t.Fatalf("assign second worker: %v", err)
+	}
+
+	svc := NewService(db)
+	svc.Connectors().Register("openclaw", fakeConnector{result: execution_backends.Result{Status: "running", ExternalJobRef: "ext"}})
+	if _, err := svc.DispatchStepRun(context.Background(), firstStep); err != nil {
+		t.Fatalf("dispatch first: %v", err)
+	}
+	second, err := svc.DispatchStepRun(context.Background(), secondStep)
+	if err != nil {
+		t.Fatalf("dispatch second: %v", err)
+	}
+	svc.Wait()
+	if second.ExecutionStatus != "waiting_for_capacity" {
+		t.Fatalf("expected backend limit to queue second step, got %+v", second)
+	}
+}
+
+// downConnector fails the health probe of one backend.
+type downConnector struct {
+	fakeConnector
+	down string
+}
+
+func (d downConnector) Health(ctx context.Context, b execution_backends.Backend) error {
+	if b.ID == d.down {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+func TestHealthRoundReroutesStepsQueuedOnOfflineBackend(t *testing.T) {
+	db := testDB(t)
+	seedExecutionStack(t, db)
+	seedWorker(t, db, "worker-exec", "planner")
+	_, firstStep := seedWorkflowRun(t, db)
+	wf := workflows.NewService(db)
+	secondRun, err := wf.CreateRunFromTask("task-second", "default-workspace", "tpl-dispatch", workflows.NewDBWorkerResolver(db))
+	if err != nil {
+		t.Fatalf("create second run: %v", err)
+	}
+	state, _ := wf.GetWorkflowRunState(secondRun)
+	secondStep := state.StepRuns[0]["id"].(string)
+
+	svc := NewService(db)
+	svc.Connectors().Register("openclaw", downConnector{fakeConnector: fakeConnector{result: execution_backends.Result{Status: "running", ExternalJobRef: "ext"}}, down: "backend-default"})
+	if _, err := svc.DispatchStepRun(context.Background(), firstStep); err != nil {
+		t.Fatalf("dispatch first: %v", err)
+	}
+	if res, err := svc.DispatchStepRun(context.Background(), secondStep); err != nil || res.ExecutionStatus != "waiting_for_capacity" {
+		t.Fatalf("expected second step queued, got %+v, %v", res, err)
+	}
+	svc.Wait()
+
+	// The worker's backend goes offline while a spare one can take the step;
+	// no job finishes to drain the queue.
+	now := time.Now().UTC().Format(time.RFC3339)
+	if _, err := db.Exec(`UPDATE execution_backends SET health_failures = 2 WHERE id = 'backend-default'`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO execution_backends (id, home_id, connector_code, name, type, endpoint_url, status, created_at, updated_at) VALUES ('backend-spare','default','openclaw','Spare','openclaw','http://spare.local','online',?,?)`, now, now); err != nil {
+		t.Fatalf("insert spare backend: %v", err)
+	}
+	if _, err := db.Exec(`INSERT INTO workers (id, home_id, workspace_id, group_id, role_id, agent_app_id, execution_backend_id, name, status, max_concurrency, config_override_json, created_at, updated_at) VALUES ('worker-spare','default','default-workspace','default-group','planner','app-default','backend-spare','Spare','active',1,'{}',?,?)`, now, now); err != nil {
+		t.Fatalf("insert spare worker: %v", err)
+	}
+	if _, err := svc.CheckBackends(context.Background()); err != nil {
+		t.Fatalf("check backends: %v", err)
+	}
+	svc.Wait()
+	var workerID string
+	if err := db.QueryRow(`SELECT worker_id FROM step_runs WHERE id = ?`, secondStep).Scan(&workerID); err != nil {
+		t.Fatal(err)
+	}
+	if workerID != "worker-spare" {
+		t.Fatalf("expected queued step rerouted to worker-spare, got %s", workerID)
+	}
+	assertStepStatus(t, db, secondStep, "running")
+}
+
+func TestQueueOrdersByQueuedAtThenRowid(t *testing.T) {
+	db := testDB(t)
+	seedExecutionStack(t, db)
+	seedWorker(t, db, "worker-exec", "planner")
+	_, firstStep := seedWorkflowRun(t, db)
+	wf := workflows.NewService(db)
+	steps := []string{firstStep}
+	for _, task := range []string{"task-second", "task-third"} {
+		runID, err := wf.CreateRunFromTask(task, "default-workspace", "tpl-dispatch", workflows.NewDBWorkerResolver(db))
+		if err != nil {
+			t.Fatalf("create run: %v", err)
+		}
+		state, _ := wf.GetWorkflowRunState(runID)
+		steps = append(steps, state.StepRuns[0]["id"].(string))
+	}
+
+	svc := NewService(db)
+	svc.Connectors().Register("openclaw", fakeConnector{result: execution_backends.Result{Status: "running", ExternalJobRef: "ext"}})
+	for _, id := range steps {
+		if _, err := svc.DispatchStepRun(context.Background(), id); err != nil {
+			t.Fatalf("dispatch %s: %v", id, err)
+		}
+	}
+	svc.Wait()
+	var queuedAt string
+	if err := db.QueryRow(`SELECT queued_at FROM step_runs WHERE id = ?`, steps[1]).Scan(&queuedAt); err != nil || len(queuedAt) != len("2006-01-02T15:04:05.000000000Z") {
+		t.Fatalf("queued_at %q is not fixed width: %v", queuedAt, err)
+	}
+
+	// Steps queued at the same instant keep the order they were created in.
+	if _, err := db.Exec(`UPDATE step_runs SET queued_at = ? WHERE status = 'queued'`, queuedAt); err != nil {
+		t.Fatalf("align queued_at: %v", err)
+	}
+	load, err := svc.WorkerLoad("worker-exec")
+	if err != nil || len(load.Queued) != 2 || load.Queued[0].StepRunID != steps[1] || load.Queued[1].StepRunID != steps[2] {
+		t.Fatalf("unexpected load %+v, %v", load, err)
+	}
+	for i, id := range steps[1:] {
+		if pos, err := svc.queuePosition(id); err != nil || pos != i+1 {
+			t.Fatalf("position of %s = %d, %v; want %d", id, pos, err, i+1)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package execution
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/PonyDevAI/Bull-Board/internal/console/execution_backends"
+)
+
+const (
+	// HealthCheckInterval is how often the console probes execution backends.
+	HealthCheckInterval = 30 * time.Second
+	// healthProbeTimeout bounds a single backend probe.
+	healthProbeTimeout = 10 * time.Second
+	// healthProbeWorkers bounds how many backends are probed at once, so one
+	// slow backend does not hold up the rest of the round.
+	healthProbeWorkers = 8
+	// degradedLatency marks a backend degraded when a successful probe is slower.
+	degradedLatency = 2 * time.Second
+	// offlineAfterFailures consecutive failed probes mark a backend offline;
+	// fewer failures leave it degraded.
+	offlineAfterFailures = 3
+)
+
+// BackendHealth is the outcome of one backend probe.
+type BackendHealth struct {
+	BackendID string `json:"execution_backend_id"`
+	Status    string `json:"status"`
+	Previous  string `json:"previous_status"`
+	LatencyMS int64  `json:"latency_ms"`
+	LastError string `json:"last_error"`
+}
+
+// RunHealthChecks probes all backends every interval until ctx is done.
+func (s *Service) RunHealthChecks(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := s.CheckBackends(ctx); err != nil && ctx.Err() == nil {
+			slog.Error("execution: backend health check", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// CheckBackends probes every execution backend through its connector, up to
+// healthProbeWorkers at a time, records latency, last error and the
+// resulting status, then drains the dispatch queue. Connectors without a
+// health method are online as long as the connector is registered.
+func (s *Service) CheckBackends(ctx context.Context) ([]BackendHealth, error) {
+	backends, err := execution_backends.NewRepository(s.db).ListAll()
+	if err != nil {
+		return nil, err
+	}
+	results := make([]BackendHealth, len(backends))
+	errs := make([]error, len(backends))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(healthProbeWorkers, len(backends)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				results[i], errs[i] = s.checkBackend(ctx, backends[i])
+			}
+		}()
+	}
+	for i := range backends {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	// Every round drains the dispatch queue: a backend coming back or going
+	// offline changes where queued steps can run, and a queue with no
+	// running job left has nothing else to start it.
+	s.DrainQueue()
+
+	out := make([]BackendHealth, 0, len(backends))
+	for i, err := range errs {
+		if err != nil {
+			return out, err
+		}
+		out = append(out, results[i])
+	}
+	return out, nil
+}
+
+func (s *Service) checkBackend(ctx context.Context, b execution_backends.Backend) (BackendHealth, error) {
+	h := BackendHealth{BackendID: b.ID, Previous: b.Status}
+	var probeErr error
+	start := time.Now()
+	connector, ok := s.connectors.ForBackend(b)
+	switch {
+	case !ok:
+		probeErr = errNoConnector(b)
+	default:
+		if checker, ok := connector.(execution_backends.HealthChecker); ok {
+			probeCtx, cancel := context.WithTimeout(ctx, healthProbeTimeout)
+			probeErr = checker.Health(probeCtx, b)
+			cancel()
+		}
+	}
+	h.LatencyMS = time.Since(start).Milliseconds()
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	var failures int
+	if err := s.db.QueryRow(`SELECT health_failures FROM execution_backends WHERE id = ?`, b.ID).Scan(&failures); err != nil {
+		return h, err
+	}
+	if probeErr != nil {
+		failures++
+		h.LastError = probeErr.Error()
+		h.Status = "degraded"
+		if failures >= offlineAfterFailures || !ok {
+			h.Status = "offline"
+		}
+		_, err := s.db.Exec(`UPDATE execution_backends SET status=?, health_failures=?, last_latency_ms=?, last_error=?, last_checked_at=?, updated_at=? WHERE id=?`, h.Status, failures, h.LatencyMS, h.LastError, now, now, b.ID)
+		if err != nil {
+			return h, err
+		}
+	} else {
+		h.Status = "online"
+		if time.Duration(h.LatencyMS)*time.Millisecond > degradedLatency {
+			h.Status = "degraded"
+		}
+		_, err := s.db.Exec(`UPDATE execution_backends SET status=?, health_failures=0, last_latency_ms=?, last_error='', last_checked_at=?, last_seen_at=?, updated_at=? WHERE id=?`, h.Status, h.LatencyMS, now, now, now, b.ID)
+		if err != nil {
+			return h, err
+		}
+	}
+	if h.Status != h.Previous {
+		s.events.Publish("execution_backend_status_changed", h)
+	}
+	return h, nil
+}
+
+func errNoConnector(b execution_backends.Backend) error {
+	return fmt.Errorf("no connector for backend type %s", b.Type)
+}
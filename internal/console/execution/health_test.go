@@ -0,0 +1,190 @@
+package execution
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/PonyDevAI/Bull-Board/internal/console/events"
+	"github.com/PonyDevAI/Bull-Board/internal/console/execution_backends"
+)
+
+type healthConnector struct {
+	fakeConnector
+	err *error
+}
+
+func (h healthConnector) Health(ctx context.Context, b execution_backends.Backend) error {
+	return *h.err
+}
+
+func backendStatus(t *testing.T, svc *Service, id string) (string, string) {
+	t.Helper()
+	var status, lastError string
+	if err := svc.db.QueryRow(`SELECT status, last_error FROM execution_backends WHERE id = ?`, id).Scan(&status, &lastError); err != nil {
+		t.Fatalf("read backend: %v", err)
+	}
+	return status, lastError
+}
+
+func TestCheckBackendsFlipsStatusAndPublishesEvents(t *testing.T) {
+	db := testDB(t)
+	seedExecutionStack(t, db)
+	svc := NewService(db)
+	bus := events.NewBus()
+	svc.SetEventBus(bus)
+	ch, unsubscribe := bus.Subscribe(16)
+	defer unsubscribe()
+
+	probeErr := errors.New("connection refused")
+	svc.Connectors().Register("openclaw", healthConnector{err: &probeErr})
+
+	for i, want := range []string{"degraded", "degraded", "offline"} {
+		if _, err := svc.CheckBackends(context.Background()); err != nil {
+			t.Fatalf("check %d: %v", i, err)
+		}
+		status, lastError := backendStatus(t, svc, "backend-default")
+		if status != want || lastError != "connection refused" {
+			t.Fatalf("check %d: got status=%s last_error=%q, want %s", i, status, lastError, want)
+		}
+	}
+
+	probeErr = nil
+	if _, err := svc.CheckBackends(context.Background()); err != nil {
+		t.Fatalf("recovery check: %v", err)
+	}
+	if status, lastError := backendStatus(t, svc, "backend-default"); status != "online" || lastError != "" {
+		t.Fatalf("expected online after recovery, got %s %q", status, lastError)
+	}
+
+	var transitions []string
+	for len(ch) > 0 {
+		ev := <-ch
+		if ev.Type == "execution_backend_status_changed" {
+			transitions = append(transitions, ev.Data.(BackendHealth).Status)
+		}
+	}
+	if len(transitions) != 3 || transitions[0] != "degraded" || transitions[1] != "offline" || transitions[2] != "online" {
+		t.Fatalf("unexpected status events: %v", transitions)
+	}
+}
+
+// blockingHealthConnector's probes report on started and wait for release.
+type blockingHealthConnector struct {
+	fakeConnector
+	started chan<- string
+	release <-chan struct{}
+}
+
+func (h blockingHealthConnector) Health(ctx context.Context, b execution_backends.Backend) error {
+	h.started <- b.ID
+	<-h.release
+	return nil
+}
+
+func TestCheckBackendsProbesConcurrentlyUpToWorkerLimit(t *testing.T) {
+	db := testDB(t)
+	seedExecutionStack(t, db)
+	now := time.Now().UTC().Format(time.RFC3339)
+	total := healthProbeWorkers + 3
+	for i := 1; i < total; i++ {
+		if _, err := db.Exec(`INSERT INTO execution_backends (id, home_id, connector_code, name, type, endpoint_url, status, created_at, updated_at) VALUES (?,'default','openclaw','Extra','openclaw','http://extra.local','offline',?,?)`, fmt.Sprintf("backend-extra-%d", i), now, now); err != nil {
+			t.Fatalf("insert backend %d: %v", i, err)
+		}
+	}
+	svc := NewService(db)
+	started := make(chan string, total)
+	release := make(chan struct{})
+	svc.Connectors().Register("openclaw", blockingHealthConnector{started: started, release: release})
+
+	done := make(chan []BackendHealth)
+	go func() {
+		out, err := svc.CheckBackends(context.Background())
+		if err != nil {
+			t.Errorf("check backends: %v", err)
+		}
+		done <- out
+	}()
+	for i := 0; i < healthProbeWorkers; i++ {
+		select {
+		case <-started:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("only %d probes started concurrently, want %d", i, healthProbeWorkers)
+		}
+	}
+	select {
+	case id := <-started:
+		t.Fatalf("probe of %s started beyond the worker limit", id)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	out := <-done
+	if len(out) != total {
+		t.Fatalf("expected %d results, got %d", total, len(out))
+	}
+	for _, h := range out {
+		if h.Status != "online" {
+			t.Fatalf("backend %s: status %s", h.BackendID, h.Status)
+		}
+	}
+}
+
+func TestDispatchRoutesAroundOfflineBackend(t *testing.T) {
+	db := testDB(t)
+	seedExecutionStack(t, db)
+	seedWorker(t, db, "worker-exec", "planner")
+	_, stepID := seedWorkflowRun(t, db)
+	if _, err := db.Exec(`UPDATE execution_backends SET status='offline' WHERE id='backend-default'`); err != nil {
+		t.Fatalf("mark offline: %v", err)
+	}
+
+	svc := NewService(db)
+	if _, err := svc.DispatchStepRun(context.Background(), stepID); !errors.Is(err, ErrStepNotDispatchable) {
+		t.Fatalf("expected offline backend to block dispatch, got %v", err)
+	}
+	assertStepStatus(t, db, stepID, "pending_unassigned")
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	if _, err := db.Exec(`INSERT INTO execution_backends (id, home_id, connector_code, name, type, endpoint_url, status, created_at, updated_at) VALUES ('backend-spare','default','openclaw','Spare','openclaw','http://spare.local','online',?,?)`, now, now); err != nil {
+		t.Fatalf("insert spare backend: %v", err)
+	}
+	if _, err := db.Exec(`INSERT INTO workers (id, home_id, workspace_id, group_id, role_id, agent_app_id, execution_backend_id, name, status, max_concurrency, config_override_json, created_at, updated_at) VALUES ('worker-spare','default','default-workspace','default-group','planner','app-default','backend-spare','Spare','active',1,'{}',?,?)`, now, now); err != nil {
+		t.Fatalf("insert spare worker: %v", err)
+	}
+	if _, err := db.Exec(`UPDATE step_runs SET status='ready', worker_id='worker-exec' WHERE id = ?`, stepID); err != nil {
+		t.Fatalf("reset step: %v", err)
+	}
+	if _, err := svc.DispatchStepRun(context.Background(), stepID); err != nil {
+		t.Fatalf("dispatch with spare worker: %v", err)
+	}
+	svc.Wait()
+	var workerID string
+	if err := db.QueryRow(`SELECT worker_id FROM step_runs WHERE id = ?`, stepID).Scan(&workerID); err != nil {
+		t.Fatalf("read worker: %v", err)
+	}
+	if workerID != "worker-spare" {
+		t.Fatalf("expected step rerouted to worker-spare, got %s", workerID)
+	}
+}
+
+func TestDispatchRejectsCapabilityMismatchWithReport(t *testing.T) {
+	db := testDB(t)
+	seedExecutionStack(t, db)
+	seedWorker(t, db, "worker-exec", "planner")
+	_, stepID := seedWorkflowRun(t, db)
+	if _, err := db.Exec(`UPDATE workflow_step_templates SET required_capabilities_json = '{"docker":true}' WHERE id = 'tpl-dispatch-step'`); err != nil {
+		t.Fatalf("set requirements: %v", err)
+	}
+
+	_, err := NewService(db).DispatchStepRun(context.Background(), stepID)
+	var rejected *DispatchRejectedError
+	if !errors.As(err, &rejected) || !errors.Is(err, ErrStepNotDispatchable) {
+		t.Fatalf("expected dispatch rejection, got %v", err)
+	}
+	if len(rejected.Candidates) != 1 || rejected.Candidates[0].Missing[0].Key != "docker" {
+		t.Fatalf("unexpected mismatch report %+v", rejected.Candidates)
+	}
+	assertStepStatus(t, db, stepID, "pending_unassigned")
+}
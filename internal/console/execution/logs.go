@@ -0,0 +1,262 @@
+package execution
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/PonyDevAI/Bull-Board/internal/console/artifacts"
+	"github.com/PonyDevAI/Bull-Board/internal/console/execution_backends"
+)
+
+const (
+	// DefaultLogPageLimit and MaxLogPageLimit bound the chunks returned by one ReadJobLog call.
+	DefaultLogPageLimit = 200
+	MaxLogPageLimit     = 1000
+	// LogPollInterval is how often running jobs on LogPoller backends are polled for output.
+	LogPollInterval = 5 * time.Second
+)
+
+// JobLogEntry is one stored chunk of job output. Offset is the position of
+// its first byte in the job's full log.
+type JobLogEntry struct {
+	Offset    int64  `json:"offset"`
+	Stream    string `json:"stream"`
+	Content   string `json:"content"`
+	CreatedAt string `json:"created_at"`
+}
+
+// End is the offset just past the entry, where the next entry starts.
+func (e JobLogEntry) End() int64 { return e.Offset + int64(len(e.Content)) }
+
+// JobLogEvent is published as "job_log" for every appended chunk.
+type JobLogEvent struct {
+	JobID string `json:"job_id"`
+	JobLogEntry
+}
+
+// JobLogPage is a slice of a job log starting at Offset. Done reports that
+// the job has finished and NextOffset is the end of its log.
+type JobLogPage struct {
+	JobID      string        `json:"job_id"`
+	Status     string        `json:"status"`
+	Offset     int64         `json:"offset"`
+	NextOffset int64         `json:"next_offset"`
+	Entries    []JobLogEntry `json:"entries"`
+	Done       bool          `json:"done"`
+}
+
+// IsTerminalJobStatus reports whether a job in status will not change again.
+func IsTerminalJobStatus(status string) bool {
+	return status == "succeeded" || status == "failed" || status == "cancelled"
+}
+
+// SetDataDir sets where finished job logs are archived (dir/artifacts/jobs/<job>/)
+// and roots the artifact store at dir/artifacts.
+func (s *Service) SetDataDir(dir string) {
+	s.dataDir = dir
+	s.artifacts = artifacts.NewService(s.db, dir)
+}
+
+// Artifacts returns the artifact service; without a data directory it records
+// rows but stores no content.
+func (s *Service) Artifacts() *artifacts.Service { return s.artifacts }
+
+// appendJobLog appends a chunk at the end of the job log; byte_offset is the
+// position of the chunk's first byte in the job's full output.
+func (s *Service) appendJobLog(jobID string, chunk LogChunk) error {
+	if chunk.Content == "" {
+		return nil
+	}
+	stream := chunk.Stream
+	if stream == "" {
+		stream = "stdout"
+	}
+	s.logMu.Lock()
+	defer s.logMu.Unlock()
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var offset int64
+	if err := tx.QueryRow(`SELECT COALESCE(MAX(byte_offset + length(CAST(content AS BLOB))), 0) FROM job_logs WHERE job_id = ?`, jobID).Scan(&offset); err != nil {
+		return err
+	}
+	entry := JobLogEntry{Offset: offset, Stream: stream, Content: chunk.Content, CreatedAt: time.Now().UTC().Format(time.RFC3339)}
+	if _, err := tx.Exec(`INSERT INTO job_logs (job_id, byte_offset, stream, content, created_at) VALUES (?, ?, ?, ?, ?)`, jobID, entry.Offset, entry.Stream, entry.Content, entry.CreatedAt); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s.events.Publish("job_log", JobLogEvent{JobID: jobID, JobLogEntry: entry})
+	return nil
+}
+
+// logSink returns the sink handed to in-process connectors for jobID.
+func (s *Service) logSink(jobID string) execution_backends.LogSink {
+	return func(stream, content string) {
+		if err := s.appendJobLog(jobID, LogChunk{Stream: stream, Content: content}); err != nil {
+			slog.Warn("execution: append job log", "job_id", jobID, "err", err)
+		}
+	}
+}
+
+// ReadJobLog returns up to limit chunks of the job log starting at byte
+// offset. An offset inside a chunk returns the rest of that chunk.
+func (s *Service) ReadJobLog(jobID string, offset int64, limit int) (JobLogPage, error) {
+	page := JobLogPage{JobID: jobID, Offset: offset, NextOffset: offset, Entries: []JobLogEntry{}}
+	err := s.db.QueryRow(`SELECT status FROM jobs WHERE id = ?`, jobID).Scan(&page.Status)
+	if err == sql.ErrNoRows {
+		return page, ErrJobNotFound
+	}
+	if err != nil {
+		return page, err
+	}
+	if offset < 0 {
+		offset, page.Offset, page.NextOffset = 0, 0, 0
+	}
+	if limit <= 0 {
+		limit = DefaultLogPageLimit
+	}
+	if limit > MaxLogPageLimit {
+		limit = MaxLogPageLimit
+	}
+	rows, err := s.db.Query(`SELECT byte_offset, stream, content, created_at FROM job_logs
+		WHERE job_id = ? AND byte_offset + length(CAST(content AS BLOB)) > ?
+		ORDER BY byte_offset ASC LIMIT ?`, jobID, offset, limit)
+	if err != nil {
+		return page, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e JobLogEntry
+		if err := rows.Scan(&e.Offset, &e.Stream, &e.Content, &e.CreatedAt); err != nil {
+			return page, err
+		}
+		if e.Offset < offset {
+			e.Content = e.Content[offset-e.Offset:]
+			e.Offset = offset
+		}
+		page.Entries = append(page.Entries, e)
+		page.NextOffset = e.End()
+	}
+	if err := rows.Err(); err != nil {
+		return page, err
+	}
+	if IsTerminalJobStatus(page.Status) && len(page.Entries) < limit {
+		page.Done = true
+	}
+	return page, nil
+}
+
+// archiveJobLog stores the full job log as an execution_log artifact once the
+// job has finished, unless the connector already reported one.
+func (s *Service) archiveJobLog(jobID, stepRunID string, reported []execution_backends.Artifact) error {
+	if s.dataDir == "" {
+		return nil
+	}
+	for _, a := range reported {
+		if a.Kind == "execution_log" {
+			return nil
+		}
+	}
+	rows, err := s.db.Query(`SELECT content FROM job_logs WHERE job_id = ? ORDER BY byte_offset ASC`, jobID)
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	chunks := 0
+	for rows.Next() {
+		var content string
+		if err := rows.Scan(&content); err != nil {
+			rows.Close()
+			return err
+		}
+		b.WriteString(content)
+		chunks++
+	}
+	rows.Close()
+	if chunks == 0 {
+		return nil
+	}
+	dir := filepath.Join(s.dataDir, "artifacts", "jobs", jobID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	path := filepath.Join(dir, "execution.log")
+	if err := os.WriteFile(path, []byte(b.String()), 0644); err != nil {
+		return err
+	}
+	return s.insertArtifacts(jobID, stepRunID, []execution_backends.Artifact{{
+		Kind:     "execution_log",
+		URI:      "file://" + path,
+		Metadata: map[string]any{"source": "job_logs", "size": b.Len(), "chunks": chunks},
+	}}, []string{dir})
+}
+
+// RunLogPolls polls LogPoller backends for running job output until ctx is done.
+func (s *Service) RunLogPolls(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		s.PollJobLogs(ctx)
+	}
+}
+
+// PollJobLogs fetches new output for running remote jobs whose connector
+// implements LogPoller and appends it to the job logs. The backend cursor is
+// kept in jobs.log_cursor so polling resumes where it stopped.
+func (s *Service) PollJobLogs(ctx context.Context) {
+	rows, err := s.db.Query(`SELECT id, COALESCE(execution_backend_id,''), external_job_ref, log_cursor FROM jobs
+		WHERE status = 'running' AND COALESCE(external_job_ref,'') != ''`)
+	if err != nil {
+		slog.Error("execution: poll job logs", "err", err)
+		return
+	}
+	type polled struct{ id, backendID, ref, cursor string }
+	var jobs []polled
+	for rows.Next() {
+		var p polled
+		if err := rows.Scan(&p.id, &p.backendID, &p.ref, &p.cursor); err == nil {
+			jobs = append(jobs, p)
+		}
+	}
+	rows.Close()
+
+	repo := execution_backends.NewRepository(s.db)
+	for _, job := range jobs {
+		backend, err := repo.Get(job.backendID)
+		if err != nil {
+			continue
+		}
+		connector, _ := s.connectors.ForBackend(backend)
+		poller, ok := connector.(execution_backends.LogPoller)
+		if !ok {
+			continue
+		}
+		chunks, next, err := poller.PollLogs(ctx, backend, job.ref, job.cursor)
+		if err != nil {
+			slog.Warn("execution: poll job logs", "job_id", job.id, "err", err)
+			continue
+		}
+		for _, chunk := range chunks {
+			if err := s.appendJobLog(job.id, chunk); err != nil {
+				slog.Warn("execution: append job log", "job_id", job.id, "err", err)
+			}
+		}
+		if next != job.cursor {
+			_, _ = s.db.Exec(`UPDATE jobs SET log_cursor = ?, updated_at = ? WHERE id = ?`, next, time.Now().UTC().Format(time.RFC3339), job.id)
+		}
+	}
+}
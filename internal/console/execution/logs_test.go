@@ -0,0 +1,140 @@
+package execution
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/PonyDevAI/Bull-Board/internal/console/events"
+	"github.com/PonyDevAI/Bull-Board/internal/console/execution_backends"
+)
+
+// loggingConnector writes its chunks to the request log sink before succeeding.
+type loggingConnector struct{ chunks []string }
+
+func (c loggingConnector) Execute(ctx context.Context, req execution_backends.Request) (execution_backends.Result, error) {
+	for _, chunk := range c.chunks {
+		req.Logs("stdout", chunk)
+	}
+	return execution_backends.Result{Status: "succeeded"}, nil
+}
+
+type pollingConnector struct {
+	fakeConnector
+	cursors *[]string
+}
+
+func (p pollingConnector) PollLogs(ctx context.Context, b execution_backends.Backend, ref, cursor string) ([]execution_backends.LogChunk, string, error) {
+	*p.cursors = append(*p.cursors, cursor)
+	return []execution_backends.LogChunk{{Stream: "stderr", Content: "polled " + ref + "\n"}}, cursor + "x", nil
+}
+
+func TestReadJobLogPagesByOffset(t *testing.T) {
+	db := testDB(t)
+	seedExecutionStack(t, db)
+	seedWorker(t, db, "worker-exec", "planner")
+	_, stepID := seedWorkflowRun(t, db)
+	svc := NewService(db)
+	svc.Connectors().Register("openclaw", fakeConnector{result: execution_backends.Result{Status: "running", ExternalJobRef: "ext"}})
+	jobID := dispatchRemoteJob(t, svc, stepID)
+	for _, c := range []string{"hello\n", "world\n", "done\n"} {
+		if err := svc.appendJobLog(jobID, LogChunk{Content: c}); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+	}
+
+	page, err := svc.ReadJobLog(jobID, 0, 2)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if len(page.Entries) != 2 || page.NextOffset != 12 || page.Done {
+		t.Fatalf("unexpected first page %+v", page)
+	}
+	page, err = svc.ReadJobLog(jobID, 8, 10)
+	if err != nil {
+		t.Fatalf("read mid-chunk: %v", err)
+	}
+	if len(page.Entries) != 2 || page.Entries[0].Offset != 8 || page.Entries[0].Content != "rld\n" || page.NextOffset != 17 {
+		t.Fatalf("unexpected mid-chunk page %+v", page)
+	}
+	if page.Done {
+		t.Fatalf("running job log must not be done")
+	}
+	if _, err := svc.ReadJobLog("missing", 0, 0); err != ErrJobNotFound {
+		t.Fatalf("expected ErrJobNotFound, got %v", err)
+	}
+}
+
+func TestInProcessLogsStreamAndArchiveOnFinish(t *testing.T) {
+	db := testDB(t)
+	seedExecutionStack(t, db)
+	seedWorker(t, db, "worker-exec", "planner")
+	_, stepID := seedWorkflowRun(t, db)
+	svc := NewService(db)
+	svc.SetDataDir(t.TempDir())
+	bus := events.NewBus()
+	svc.SetEventBus(bus)
+	ch, unsubscribe := bus.Subscribe(32)
+	defer unsubscribe()
+	svc.Connectors().Register("openclaw", loggingConnector{chunks: []string{"step 1\n", "step 2\n"}})
+
+	res, err := svc.DispatchStepRun(context.Background(), stepID)
+	if err != nil {
+		t.Fatalf("dispatch: %v", err)
+	}
+	svc.Wait()
+
+	var logEvents int
+	for len(ch) > 0 {
+		if ev := <-ch; ev.Type == "job_log" {
+			logEvents++
+		}
+	}
+	if logEvents != 2 {
+		t.Fatalf("expected 2 job_log events, got %d", logEvents)
+	}
+	page, err := svc.ReadJobLog(res.JobID, 0, 0)
+	if err != nil || !page.Done || page.NextOffset != 14 {
+		t.Fatalf("unexpected final page %+v err=%v", page, err)
+	}
+
+	var uri string
+	if err := db.QueryRow(`SELECT uri FROM artifacts WHERE job_id = ? AND kind = 'execution_log'`, res.JobID).Scan(&uri); err != nil {
+		t.Fatalf("read execution_log artifact: %v", err)
+	}
+	data, err := os.ReadFile(strings.TrimPrefix(uri, "file://"))
+	if err != nil {
+		t.Fatalf("read archived log: %v", err)
+	}
+	if string(data) != "step 1\nstep 2\n" {
+		t.Fatalf("unexpected archived log %q", data)
+	}
+}
+
+func TestPollJobLogsResumesFromCursor(t *testing.T) {
+	db := testDB(t)
+	seedExecutionStack(t, db)
+	seedWorker(t, db, "worker-exec", "planner")
+	_, stepID := seedWorkflowRun(t, db)
+	svc := NewService(db)
+	var cursors []string
+	svc.Connectors().Register("openclaw", pollingConnector{
+		fakeConnector: fakeConnector{result: execution_backends.Result{Status: "running", ExternalJobRef: "ext-9"}},
+		cursors:       &cursors,
+	})
+	jobID := dispatchRemoteJob(t, svc, stepID)
+
+	svc.PollJobLogs(context.Background())
+	svc.PollJobLogs(context.Background())
+	if len(cursors) != 2 || cursors[0] != "" || cursors[1] != "x" {
+		t.Fatalf("expected poll to resume from stored cursor, got %q", cursors)
+	}
+	page, err := svc.ReadJobLog(jobID, 0, 0)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if len(page.Entries) != 2 || page.Entries[1].Stream != "stderr" || page.Entries[1].Offset != int64(len("polled ext-9\n")) {
+		t.Fatalf("unexpected polled log %+v", page.Entries)
+	}
+}
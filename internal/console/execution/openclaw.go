@@ -0,0 +1,42 @@
+package execution
+
+import (
+	"context"
+
+	"github.com/PonyDevAI/Bull-Board/internal/console/execution_backends"
+	"github.com/PonyDevAI/Bull-Board/internal/integrations/openclaw"
+)
+
+// openclawConnector adapts the OpenClaw integration adapter to the execution backend connector contract.
+type openclawConnector struct{ adapter *openclaw.Adapter }
+
+func (c openclawConnector) Execute(ctx context.Context, req execution_backends.Request) (execution_backends.Result, error) {
+	res, err := c.adapter.ExecutePreparedDispatch(ctx, openclaw.PreparedDispatchRequest{
+		WorkflowRunID:    req.WorkflowRunID,
+		StepRunID:        req.StepRunID,
+		TaskID:           req.TaskID,
+		Worker:           req.Worker,
+		Role:             req.Role,
+		AgentApp:         req.AgentApp,
+		ExecutionBackend: req.ExecutionBackend,
+		ResolvedConfig:   req.ResolvedConfig,
+		Input:            req.Input,
+	})
+	if err != nil {
+		return execution_backends.Result{}, err
+	}
+	out := execution_backends.Result{
+		Status:         res.Status,
+		ExternalJobRef: res.ExternalJobRef,
+		Output:         res.Output,
+		Response:       res.Response,
+	}
+	for _, a := range res.Artifacts {
+		out.Artifacts = append(out.Artifacts, execution_backends.Artifact{Kind: a.Kind, URI: a.URI, Metadata: a.Metadata})
+	}
+	return out, nil
+}
+
+func (c openclawConnector) Health(ctx context.Context, b execution_backends.Backend) error {
+	return c.adapter.Ping(ctx, b.EndpointURL)
+}
@@ -0,0 +1,104 @@
+package execution
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/PonyDevAI/Bull-Board/internal/console/execution_backends"
+	"github.com/PonyDevAI/Bull-Board/internal/console/protection"
+)
+
+// runnerBranch is the branch runners commit a workflow run's work to.
+func runnerBranch(workflowRunID string) string { return "bb/run-" + workflowRunID }
+
+// guardRunnerCommit checks the commit phase of a job for runners against the
+// workspace's branch protection before the job is handed out, since runners
+// commit on hosts the console does not control. It returns the result to
+// finish the job with when the commit is not allowed.
+func (s *Service) guardRunnerCommit(req execution_backends.Request) (execution_backends.Result, bool) {
+	if !hasCommit(req.Step, req.Input) {
+		return execution_backends.Result{}, false
+	}
+	workspaceID, _ := req.Workspace["id"].(string)
+	branch := runnerBranch(req.WorkflowRunID)
+	_, err := protection.NewStore(s.db).Check(protection.Operation{
+		WorkspaceID: workspaceID, Operation: protection.OpCommit, Branch: branch, Source: RunnerConnectorCode,
+		TaskID: req.TaskID, WorkflowRunID: req.WorkflowRunID, StepRunID: req.StepRunID,
+	})
+	if err == nil {
+		return execution_backends.Result{}, false
+	}
+	result, err := protection.StepResult(err, map[string]any{"branch": branch})
+	if err != nil {
+		return failedResult(err), true
+	}
+	return result, true
+}
+
+// RunnerGitOperation is a git operation a runner asks about for a job it
+// holds. Observed is set for a branch update a step command already made,
+// which the runner moves back unless it is allowed; otherwise the runner is
+// about to perform the operation itself, such as its commit phase.
+type RunnerGitOperation struct {
+	Operation string `json:"operation"`
+	Branch    string `json:"branch"`
+	Observed  bool   `json:"observed"`
+}
+
+// CheckRunnerGitOperation checks a runner's git operation against the
+// branch protection of the job's workspace, in the job's context. It
+// returns a *protection.Violation when the operation is not allowed.
+// Runners update branches only in their own clones: pushes run from the
+// pull request step and submit, so a runner may not ask for one.
+func (s *Service) CheckRunnerGitOperation(runnerID, jobID string, op RunnerGitOperation) (protection.Attempt, error) {
+	if _, _, err := s.leasedJob(runnerID, jobID); err != nil {
+		return protection.Attempt{}, err
+	}
+	switch {
+	case op.Branch == "":
+		return protection.Attempt{}, fmt.Errorf("%w: branch required", ErrInvalidGitOperation)
+	case op.Operation == protection.OpPush:
+		return protection.Attempt{}, fmt.Errorf("%w: runners do not push", ErrInvalidGitOperation)
+	case op.Operation != protection.OpCommit && op.Operation != protection.OpMerge && op.Operation != protection.OpForcePush:
+		return protection.Attempt{}, fmt.Errorf("%w: unknown operation %q", ErrInvalidGitOperation, op.Operation)
+	}
+	req, err := s.loadRequest(jobID)
+	if err != nil {
+		return protection.Attempt{}, err
+	}
+	workspaceID, _ := req.Workspace["id"].(string)
+	o := protection.Operation{
+		WorkspaceID: workspaceID, Operation: op.Operation, Branch: op.Branch, Source: RunnerConnectorCode,
+		TaskID: req.TaskID, WorkflowRunID: req.WorkflowRunID, StepRunID: req.StepRunID,
+	}
+	store := protection.NewStore(s.db)
+	if op.Observed {
+		return store.CheckUpdate(o, protection.Now())
+	}
+	return store.Recheck(o)
+}
+
+// heldRunnerOperation returns the *protection.Violation of the latest git
+// operation of the job that waits for approval, or nil.
+func (s *Service) heldRunnerOperation(jobID, stepRunID string) error {
+	var startedAt string
+	if err := s.db.QueryRow(`SELECT COALESCE(started_at, '') FROM jobs WHERE id = ?`, jobID).Scan(&startedAt); err != nil {
+		return err
+	}
+	since := ""
+	if t, err := time.Parse(time.RFC3339, startedAt); err == nil {
+		since = protection.Stamp(t)
+	}
+	return protection.NewStore(s.db).Held(stepRunID, since)
+}
+
+// hasCommit reports whether the step config or input asks for a commit.
+func hasCommit(step map[string]any, input any) bool {
+	if in, ok := input.(map[string]any); ok {
+		if v, ok := in["commit"]; ok {
+			return v != nil
+		}
+	}
+	cfg, _ := step["config"].(map[string]any)
+	return cfg["commit"] != nil
+}
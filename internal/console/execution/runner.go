@@ -0,0 +1,438 @@
+package execution
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/PonyDevAI/Bull-Board/internal/console/artifacts"
+	"github.com/PonyDevAI/Bull-Board/internal/console/execution_backends"
+	"github.com/PonyDevAI/Bull-Board/internal/console/protection"
+)
+
+// RunnerConnectorCode is the connector of backends served by pull runners.
+const RunnerConnectorCode = "runner"
+
+const (
+	// LeaseDuration is how long a claim or heartbeat keeps a job with its runner.
+	LeaseDuration = 60 * time.Second
+	// MaxClaimWait bounds the long poll of one claim request.
+	MaxClaimWait = 60 * time.Second
+	// MaxLeaseAttempts is how many times a job may be claimed before an
+	// expired lease fails it instead of requeueing it.
+	MaxLeaseAttempts = 3
+	// LeaseSweepInterval is how often expired leases are returned to the queue.
+	LeaseSweepInterval = 10 * time.Second
+	// RunnerSeenWindow is how recently a runner must have called in for its
+	// backends to count as online.
+	RunnerSeenWindow = 90 * time.Second
+	// claimRecheck is how often a waiting claim looks at the queue even
+	// without a wake-up.
+	claimRecheck = 2 * time.Second
+)
+
+var (
+	ErrRunnerNotFound = errors.New("runner not found")
+	ErrInvalidRunner  = errors.New("invalid runner registration")
+	// ErrRunnerUnauthorized means a runner credential or enrollment token is
+	// unknown, revoked, expired or already used.
+	ErrRunnerUnauthorized      = errors.New("runner unauthorized")
+	ErrEnrollmentTokenNotFound = errors.New("enrollment token not found")
+	// ErrLeaseLost means the job is no longer running under the caller's
+	// lease: it finished, was cancelled or was requeued after expiring.
+	ErrLeaseLost     = errors.New("job lease not held by runner")
+	ErrInvalidResult = errors.New("invalid runner result")
+	ErrInvalidUpload = errors.New("invalid artifact upload")
+	// ErrInvalidGitOperation means a runner asked about a git operation it
+	// may not perform, such as a push.
+	ErrInvalidGitOperation = errors.New("invalid runner git operation")
+)
+
+// Runner is an enrolled runner process. Status is "online" while it has
+// called in within RunnerSeenWindow, "offline" otherwise and "revoked" once
+// its credential was revoked.
+type Runner struct {
+	ID                  string         `json:"id"`
+	Name                string         `json:"name"`
+	Version             string         `json:"version"`
+	Host                map[string]any `json:"host"`
+	BackendIDs          []string       `json:"backend_ids"`
+	Status              string         `json:"status"`
+	CredentialPrefix    string         `json:"credential_prefix"`
+	CredentialRotatedAt string         `json:"credential_rotated_at,omitempty"`
+	LastSeenAt          string         `json:"last_seen_at,omitempty"`
+	RevokedAt           string         `json:"revoked_at,omitempty"`
+	CreatedAt           string         `json:"created_at"`
+}
+
+// RunnerInfo is what a runner reports about itself.
+type RunnerInfo struct {
+	Name    string         `json:"name"`
+	Version string         `json:"version"`
+	Host    map[string]any `json:"host"`
+}
+
+// Lease is a job claimed by a runner. Request is the job's prepared dispatch.
+type Lease struct {
+	JobID          string          `json:"job_id"`
+	RunnerID       string          `json:"runner_id"`
+	Attempt        int             `json:"attempt"`
+	LeaseExpiresAt string          `json:"lease_expires_at"`
+	LeaseSeconds   int             `json:"lease_seconds"`
+	Request        json.RawMessage `json:"request"`
+}
+
+// RunnerResult is the final report of a claimed job.
+type RunnerResult struct {
+	Status    string                        `json:"status"`
+	Output    any                           `json:"output"`
+	Artifacts []execution_backends.Artifact `json:"artifacts"`
+}
+
+// runnerConnector marks runner backends: their jobs wait in the queue for a
+// runner instead of being executed by the console.
+type runnerConnector struct{ db *sql.DB }
+
+func (runnerConnector) Pulled() {}
+
+func (runnerConnector) Execute(ctx context.Context, req execution_backends.Request) (execution_backends.Result, error) {
+	return execution_backends.Result{}, errors.New("runner backend jobs are claimed by runners")
+}
+
+// Health reports the backend online while a runner bound to it has called in recently.
+func (c runnerConnector) Health(ctx context.Context, b execution_backends.Backend) error {
+	since := time.Now().UTC().Add(-RunnerSeenWindow).Format(time.RFC3339)
+	var n int
+	if err := c.db.QueryRowContext(ctx, `
+		SELECT COUNT(1) FROM runner_backends rb JOIN runners r ON r.id = rb.runner_id
+		WHERE rb.execution_backend_id = ? AND r.last_seen_at >= ? AND r.revoked_at IS NULL`, b.ID, since).Scan(&n); err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("no runner seen for backend %s in the last %s", b.ID, RunnerSeenWindow)
+	}
+	return nil
+}
+
+// validateRunnerBackends checks that every id names a runner execution backend.
+func (s *Service) validateRunnerBackends(ids []string) error {
+	if len(ids) == 0 {
+		return fmt.Errorf("%w: backend_ids required", ErrInvalidRunner)
+	}
+	for _, id := range ids {
+		var code string
+		err := s.db.QueryRow(`SELECT connector_code FROM execution_backends WHERE id = ?`, id).Scan(&code)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("%w: unknown execution backend %s", ErrInvalidRunner, id)
+		}
+		if err != nil {
+			return err
+		}
+		if code != RunnerConnectorCode {
+			return fmt.Errorf("%w: execution backend %s uses connector %s, not %s", ErrInvalidRunner, id, code, RunnerConnectorCode)
+		}
+	}
+	return nil
+}
+
+// touchRunner records that a runner called in. A runner revoked while a
+// call is in flight is refused from then on.
+func (s *Service) touchRunner(runnerID string) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	res, err := s.db.Exec(`UPDATE runners SET last_seen_at = ?, updated_at = ? WHERE id = ? AND revoked_at IS NULL`, now, now, runnerID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrRunnerUnauthorized
+	}
+	return nil
+}
+
+// notifyRunners wakes claims waiting for work.
+func (s *Service) notifyRunners() {
+	s.mu.Lock()
+	if s.runnerWake != nil {
+		close(s.runnerWake)
+	}
+	s.runnerWake = make(chan struct{})
+	s.mu.Unlock()
+}
+
+func (s *Service) runnerWakeChan() chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.runnerWake == nil {
+		s.runnerWake = make(chan struct{})
+	}
+	return s.runnerWake
+}
+
+// ClaimJob leases the oldest queued job of the runner's backends. It waits up
+// to wait for one to be queued and returns nil when none arrives.
+func (s *Service) ClaimJob(ctx context.Context, runnerID string, wait time.Duration) (*Lease, error) {
+	if wait > MaxClaimWait {
+		wait = MaxClaimWait
+	}
+	deadline := time.Now().Add(wait)
+	for {
+		wake := s.runnerWakeChan()
+		if err := s.touchRunner(runnerID); err != nil {
+			return nil, err
+		}
+		lease, err := s.tryClaim(runnerID)
+		if err != nil || lease != nil {
+			return lease, err
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return nil, nil
+		}
+		if remaining > claimRecheck {
+			remaining = claimRecheck
+		}
+		timer := time.NewTimer(remaining)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+func (s *Service) tryClaim(runnerID string) (*Lease, error) {
+	for {
+		var jobID, requestJSON string
+		var attempts int
+		err := s.db.QueryRow(`
+			SELECT j.id, j.request_json, j.attempts
+			FROM jobs j
+			JOIN execution_backends b ON b.id = j.execution_backend_id
+			JOIN runner_backends rb ON rb.execution_backend_id = j.execution_backend_id AND rb.runner_id = ?
+			WHERE j.status = 'queued' AND b.connector_code = ?
+			ORDER BY j.created_at ASC, j.id ASC LIMIT 1`, runnerID, RunnerConnectorCode).Scan(&jobID, &requestJSON, &attempts)
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		now := time.Now().UTC()
+		expires := now.Add(LeaseDuration).Format(time.RFC3339)
+		res, err := s.db.Exec(`UPDATE jobs SET status='running', runner_id=?, external_job_ref=?, lease_expires_at=?, attempts=attempts+1, started_at=COALESCE(started_at, ?), updated_at=? WHERE id=? AND status='queued'`,
+			runnerID, runnerID, expires, now.Format(time.RFC3339), now.Format(time.RFC3339), jobID)
+		if err != nil {
+			return nil, err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			// Another runner won the race; look again.
+			continue
+		}
+		var stepRunID string
+		_ = s.db.QueryRow(`SELECT step_run_id FROM jobs WHERE id = ?`, jobID).Scan(&stepRunID)
+		s.publishJobStatus(jobID, stepRunID, "running", runnerID)
+		return &Lease{
+			JobID:          jobID,
+			RunnerID:       runnerID,
+			Attempt:        attempts + 1,
+			LeaseExpiresAt: expires,
+			LeaseSeconds:   int(LeaseDuration / time.Second),
+			Request:        json.RawMessage(requestJSON),
+		}, nil
+	}
+}
+
+// leasedJob returns the step run and status of a job held under runnerID's
+// lease: running, or cancelling until the runner has been told.
+func (s *Service) leasedJob(runnerID, jobID string) (string, string, error) {
+	if err := s.touchRunner(runnerID); err != nil {
+		return "", "", err
+	}
+	var stepRunID, status, owner string
+	err := s.db.QueryRow(`SELECT step_run_id, status, runner_id FROM jobs WHERE id = ?`, jobID).Scan(&stepRunID, &status, &owner)
+	if err == sql.ErrNoRows {
+		return "", "", ErrJobNotFound
+	}
+	if err != nil {
+		return "", "", err
+	}
+	if (status != "running" && status != "cancelling") || owner != runnerID {
+		return "", "", fmt.Errorf("%w: status=%s", ErrLeaseLost, status)
+	}
+	return stepRunID, status, nil
+}
+
+// RenewLease extends a job's lease and optionally stores its progress. The
+// heartbeat of a cancelling job is refused with ErrLeaseLost, on which the
+// runner stops the work, and the job finishes as cancelled.
+func (s *Service) RenewLease(runnerID, jobID string, progress map[string]any) (string, error) {
+	stepRunID, status, err := s.leasedJob(runnerID, jobID)
+	if err != nil {
+		return "", err
+	}
+	if status == "cancelling" {
+		err := s.finishCancelled(jobID, stepRunID, execution_backends.Result{ExternalJobRef: runnerID}, nil)
+		if err != nil && !errors.Is(err, ErrJobNotActive) {
+			return "", err
+		}
+		return "", fmt.Errorf("%w: status=cancelled", ErrLeaseLost)
+	}
+	now := time.Now().UTC()
+	expires := now.Add(LeaseDuration).Format(time.RFC3339)
+	res, err := s.db.Exec(`UPDATE jobs SET lease_expires_at=?, updated_at=? WHERE id=? AND runner_id=? AND status='running'`, expires, now.Format(time.RFC3339), jobID, runnerID)
+	if err != nil {
+		return "", err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return "", ErrLeaseLost
+	}
+	if progress != nil {
+		if err := s.storeProgress(jobID, progress); err != nil {
+			return "", err
+		}
+	}
+	return expires, nil
+}
+
+// AppendRunnerLogs appends output of a leased job to its log.
+func (s *Service) AppendRunnerLogs(runnerID, jobID string, chunks []LogChunk) error {
+	if _, _, err := s.leasedJob(runnerID, jobID); err != nil {
+		return err
+	}
+	for _, chunk := range chunks {
+		if err := s.appendJobLog(jobID, chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StoreRunnerArtifact streams an uploaded file of a leased job into the
+// artifact store and records it as an artifact of kind.
+func (s *Service) StoreRunnerArtifact(runnerID, jobID, kind, name string, body io.Reader) (artifacts.Artifact, error) {
+	stepRunID, _, err := s.leasedJob(runnerID, jobID)
+	if err != nil {
+		return artifacts.Artifact{}, err
+	}
+	kind, name, err = uploadName(kind, name)
+	if err != nil {
+		return artifacts.Artifact{}, err
+	}
+	staged, err := s.stageUpload(body, name)
+	if err != nil {
+		return artifacts.Artifact{}, err
+	}
+	return s.commitUpload(staged, jobID, stepRunID, kind, name, map[string]any{"source": RunnerConnectorCode, "runner_id": runnerID})
+}
+
+// ReportRunnerResult closes a leased job with the runner's final status; a
+// cancelling job finishes as cancelled with the reported output.
+func (s *Service) ReportRunnerResult(runnerID, jobID string, result RunnerResult) error {
+	if result.Status != "succeeded" && result.Status != "failed" {
+		return fmt.Errorf("%w: status must be succeeded or failed", ErrInvalidResult)
+	}
+	stepRunID, _, err := s.leasedJob(runnerID, jobID)
+	if err != nil {
+		return err
+	}
+	finished := execution_backends.Result{
+		Status:         result.Status,
+		ExternalJobRef: runnerID,
+		Output:         result.Output,
+		Response:       map[string]any{"runtime": RunnerConnectorCode, "runner_id": runnerID},
+		Artifacts:      result.Artifacts,
+	}
+	// A git operation of the job that waits for approval parks the step
+	// instead of failing it.
+	if result.Status == "failed" {
+		if held := s.heldRunnerOperation(jobID, stepRunID); held != nil {
+			output, _ := result.Output.(map[string]any)
+			parked, err := protection.StepResult(held, output)
+			if err != nil {
+				return err
+			}
+			parked.ExternalJobRef, parked.Response, parked.Artifacts = finished.ExternalJobRef, finished.Response, finished.Artifacts
+			finished = parked
+		}
+	}
+	return s.FinishJob(jobID, finished)
+}
+
+// RunLeaseSweeps requeues jobs with expired leases until ctx is done.
+func (s *Service) RunLeaseSweeps(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.RequeueExpiredLeases(time.Now())
+		}
+	}
+}
+
+// RequeueExpiredLeases returns running jobs whose runner stopped heartbeating
+// to the queue, or fails them once they have used MaxLeaseAttempts claims.
+// Cancelling jobs whose runner stopped heartbeating finish as cancelled.
+func (s *Service) RequeueExpiredLeases(now time.Time) {
+	rows, err := s.db.Query(`SELECT id, step_run_id, status, runner_id, attempts, lease_expires_at FROM jobs WHERE status IN ('running','cancelling') AND runner_id != '' AND lease_expires_at < ?`, now.UTC().Format(time.RFC3339))
+	if err != nil {
+		slog.Error("execution: lease sweep", "err", err)
+		return
+	}
+	type expired struct {
+		id, stepRunID, status, runnerID, expiresAt string
+		attempts                                   int
+	}
+	var jobs []expired
+	for rows.Next() {
+		var j expired
+		if err := rows.Scan(&j.id, &j.stepRunID, &j.status, &j.runnerID, &j.attempts, &j.expiresAt); err != nil {
+			slog.Error("execution: lease sweep", "err", err)
+			break
+		}
+		jobs = append(jobs, j)
+	}
+	rows.Close()
+	requeued := false
+	for _, j := range jobs {
+		if j.status == "cancelling" {
+			_ = s.appendJobLog(j.id, LogChunk{Stream: "stderr", Content: fmt.Sprintf("lease of runner %s expired while cancelling; job cancelled\n", j.runnerID)})
+			err := s.finishCancelled(j.id, j.stepRunID, execution_backends.Result{ExternalJobRef: j.runnerID}, nil)
+			if err != nil && !errors.Is(err, ErrJobNotActive) {
+				slog.Error("execution: cancel expired lease", "job_id", j.id, "err", err)
+			}
+			continue
+		}
+		msg := fmt.Sprintf("lease of runner %s expired (attempt %d of %d)", j.runnerID, j.attempts, MaxLeaseAttempts)
+		if j.attempts >= MaxLeaseAttempts {
+			_ = s.appendJobLog(j.id, LogChunk{Stream: "stderr", Content: msg + "; job failed\n"})
+			s.finishOrLog(j.id, execution_backends.Result{Status: "failed", ExternalJobRef: j.runnerID, Output: map[string]any{"error": msg}})
+			continue
+		}
+		ts := now.UTC().Format(time.RFC3339)
+		res, err := s.db.Exec(`UPDATE jobs SET status='queued', runner_id='', external_job_ref=NULL, lease_expires_at=NULL, updated_at=? WHERE id=? AND status='running' AND runner_id=? AND lease_expires_at=?`, ts, j.id, j.runnerID, j.expiresAt)
+		if err != nil {
+			slog.Error("execution: requeue job", "job_id", j.id, "err", err)
+			continue
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			continue
+		}
+		_ = s.appendJobLog(j.id, LogChunk{Stream: "stderr", Content: msg + "; job requeued\n"})
+		s.publishJobStatus(j.id, j.stepRunID, "queued", "")
+		requeued = true
+	}
+	if requeued {
+		s.notifyRunners()
+	}
+}
@@ -0,0 +1,337 @@
+package execution
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/PonyDevAI/Bull-Board/internal/common"
+)
+
+const (
+	// EnrollmentTokenPrefix and RunnerCredentialPrefix start every enrollment
+	// token and runner credential, so neither is mistaken for an API key.
+	EnrollmentTokenPrefix  = "bbe_"
+	RunnerCredentialPrefix = "bbr_"
+	// DefaultEnrollmentTTL is how long an enrollment token stays usable
+	// unless its creator asks for another lifetime.
+	DefaultEnrollmentTTL = 24 * time.Hour
+	// MaxEnrollmentTTL bounds the lifetime of an enrollment token.
+	MaxEnrollmentTTL = 30 * 24 * time.Hour
+	// secretDisplayLen is how much of a secret is kept in clear to identify it.
+	secretDisplayLen = 12
+)
+
+// EnrollmentToken is a one-time token that enrolls one runner bound to
+// BackendIDs. Token holds the plaintext and is only set when it is created.
+type EnrollmentToken struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	TokenPrefix string   `json:"token_prefix"`
+	Token       string   `json:"token,omitempty"`
+	BackendIDs  []string `json:"backend_ids"`
+	ExpiresAt   string   `json:"expires_at"`
+	UsedAt      string   `json:"used_at,omitempty"`
+	RunnerID    string   `json:"runner_id,omitempty"`
+	CreatedAt   string   `json:"created_at"`
+}
+
+// EnrollmentRequest describes an enrollment token to create.
+type EnrollmentRequest struct {
+	Name             string   `json:"name"`
+	BackendIDs       []string `json:"backend_ids"`
+	ExpiresInSeconds int      `json:"expires_in_seconds"`
+}
+
+// newSecret returns a random secret starting with prefix, its sha256 hex and
+// the leading characters kept for display.
+func newSecret(prefix string) (plain, hash, display string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", "", err
+	}
+	plain = prefix + hex.EncodeToString(b)
+	return plain, hashSecret(plain), plain[:secretDisplayLen], nil
+}
+
+func hashSecret(plain string) string {
+	h := sha256.Sum256([]byte(plain))
+	return hex.EncodeToString(h[:])
+}
+
+// CreateEnrollmentToken issues a one-time token that enrolls a runner bound
+// to req.BackendIDs.
+func (s *Service) CreateEnrollmentToken(req EnrollmentRequest) (EnrollmentToken, error) {
+	if err := s.validateRunnerBackends(req.BackendIDs); err != nil {
+		return EnrollmentToken{}, err
+	}
+	ttl := DefaultEnrollmentTTL
+	if req.ExpiresInSeconds < 0 {
+		return EnrollmentToken{}, fmt.Errorf("%w: expires_in_seconds must be positive", ErrInvalidRunner)
+	}
+	if req.ExpiresInSeconds > 0 {
+		ttl = time.Duration(req.ExpiresInSeconds) * time.Second
+	}
+	if ttl > MaxEnrollmentTTL {
+		return EnrollmentToken{}, fmt.Errorf("%w: expires_in_seconds exceeds %d", ErrInvalidRunner, int(MaxEnrollmentTTL/time.Second))
+	}
+	plain, hash, display, err := newSecret(EnrollmentTokenPrefix)
+	if err != nil {
+		return EnrollmentToken{}, err
+	}
+	backends, _ := json.Marshal(req.BackendIDs)
+	now := time.Now().UTC()
+	t := EnrollmentToken{
+		ID:          common.UUID(),
+		Name:        strings.TrimSpace(req.Name),
+		TokenPrefix: display,
+		Token:       plain,
+		BackendIDs:  req.BackendIDs,
+		ExpiresAt:   now.Add(ttl).Format(time.RFC3339),
+		CreatedAt:   now.Format(time.RFC3339),
+	}
+	_, err = s.db.Exec(`INSERT INTO runner_enrollment_tokens (id, name, token_hash, token_prefix, backend_ids_json, expires_at, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		t.ID, t.Name, hash, t.TokenPrefix, string(backends), t.ExpiresAt, t.CreatedAt)
+	return t, err
+}
+
+// ListEnrollmentTokens returns all enrollment tokens, newest first, without their secrets.
+func (s *Service) ListEnrollmentTokens() ([]EnrollmentToken, error) {
+	rows, err := s.db.Query(`SELECT id, name, token_prefix, backend_ids_json, expires_at, COALESCE(used_at,''), COALESCE(runner_id,''), created_at FROM runner_enrollment_tokens ORDER BY created_at DESC, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []EnrollmentToken{}
+	for rows.Next() {
+		var t EnrollmentToken
+		var backends string
+		if err := rows.Scan(&t.ID, &t.Name, &t.TokenPrefix, &backends, &t.ExpiresAt, &t.UsedAt, &t.RunnerID, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		_ = json.Unmarshal([]byte(backends), &t.BackendIDs)
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+// DeleteEnrollmentToken withdraws an enrollment token.
+func (s *Service) DeleteEnrollmentToken(id string) error {
+	res, err := s.db.Exec(`DELETE FROM runner_enrollment_tokens WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrEnrollmentTokenNotFound
+	}
+	return nil
+}
+
+// EnrollRunner exchanges an unused, unexpired enrollment token for a runner
+// bound to the token's backends and returns the runner with its credential.
+// The credential is only ever returned here and by RotateRunnerCredential.
+func (s *Service) EnrollRunner(token string, info RunnerInfo) (Runner, string, error) {
+	info.Name = strings.TrimSpace(info.Name)
+	if info.Name == "" {
+		return Runner{}, "", fmt.Errorf("%w: name required", ErrInvalidRunner)
+	}
+	if info.Host == nil {
+		info.Host = map[string]any{}
+	}
+	hostJSON, err := json.Marshal(info.Host)
+	if err != nil {
+		return Runner{}, "", err
+	}
+	credential, credHash, credDisplay, err := newSecret(RunnerCredentialPrefix)
+	if err != nil {
+		return Runner{}, "", err
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	r := Runner{ID: common.UUID(), Name: info.Name, Version: info.Version, Host: info.Host, Status: "online", CredentialPrefix: credDisplay, CredentialRotatedAt: now, LastSeenAt: now, CreatedAt: now}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return Runner{}, "", err
+	}
+	defer tx.Rollback()
+	// Claim the token first so two enrollments cannot both use it.
+	res, err := tx.Exec(`UPDATE runner_enrollment_tokens SET used_at = ?, runner_id = ? WHERE token_hash = ? AND used_at IS NULL AND expires_at > ?`, now, r.ID, hashSecret(token), now)
+	if err != nil {
+		return Runner{}, "", err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return Runner{}, "", fmt.Errorf("%w: enrollment token is invalid, expired or already used", ErrRunnerUnauthorized)
+	}
+	var backends string
+	if err := tx.QueryRow(`SELECT backend_ids_json FROM runner_enrollment_tokens WHERE token_hash = ?`, hashSecret(token)).Scan(&backends); err != nil {
+		return Runner{}, "", err
+	}
+	if err := json.Unmarshal([]byte(backends), &r.BackendIDs); err != nil {
+		return Runner{}, "", err
+	}
+	if _, err := tx.Exec(`INSERT INTO runners (id, name, version, host_json, credential_hash, credential_prefix, credential_rotated_at, last_seen_at, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		r.ID, r.Name, r.Version, string(hostJSON), credHash, credDisplay, now, now, now, now); err != nil {
+		return Runner{}, "", err
+	}
+	for _, id := range r.BackendIDs {
+		if _, err := tx.Exec(`INSERT OR IGNORE INTO runner_backends (runner_id, execution_backend_id, created_at) VALUES (?, ?, ?)`, r.ID, id, now); err != nil {
+			return Runner{}, "", err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return Runner{}, "", err
+	}
+	return r, credential, nil
+}
+
+// AuthenticateRunner returns the runner a credential belongs to. Revoked
+// and rotated-out credentials are rejected.
+func (s *Service) AuthenticateRunner(credential string) (string, error) {
+	if !strings.HasPrefix(credential, RunnerCredentialPrefix) {
+		return "", ErrRunnerUnauthorized
+	}
+	var id string
+	err := s.db.QueryRow(`SELECT id FROM runners WHERE credential_hash = ? AND revoked_at IS NULL`, hashSecret(credential)).Scan(&id)
+	if err == sql.ErrNoRows {
+		return "", ErrRunnerUnauthorized
+	}
+	return id, err
+}
+
+// RotateRunnerCredential replaces a runner's credential; the old one stops
+// working immediately. Revoked runners cannot be rotated back to life.
+func (s *Service) RotateRunnerCredential(runnerID string) (string, error) {
+	credential, hash, display, err := newSecret(RunnerCredentialPrefix)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	res, err := s.db.Exec(`UPDATE runners SET credential_hash = ?, credential_prefix = ?, credential_rotated_at = ?, updated_at = ? WHERE id = ? AND revoked_at IS NULL`, hash, display, now, now, runnerID)
+	if err != nil {
+		return "", err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		if _, err := s.GetRunner(runnerID); err != nil {
+			return "", err
+		}
+		return "", fmt.Errorf("%w: runner is revoked", ErrRunnerUnauthorized)
+	}
+	return credential, nil
+}
+
+// RevokeRunner disables a runner's credential. Jobs it holds return to the
+// queue once their leases expire.
+func (s *Service) RevokeRunner(runnerID string) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	res, err := s.db.Exec(`UPDATE runners SET revoked_at = COALESCE(revoked_at, ?), updated_at = ? WHERE id = ?`, now, now, runnerID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrRunnerNotFound
+	}
+	return nil
+}
+
+// UpdateRunnerInfo records the version and host a runner reports; an empty
+// name keeps the current one.
+func (s *Service) UpdateRunnerInfo(runnerID string, info RunnerInfo) error {
+	if info.Host == nil {
+		info.Host = map[string]any{}
+	}
+	hostJSON, err := json.Marshal(info.Host)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	res, err := s.db.Exec(`UPDATE runners SET name = COALESCE(NULLIF(?, ''), name), version = ?, host_json = ?, last_seen_at = ?, updated_at = ? WHERE id = ?`,
+		strings.TrimSpace(info.Name), info.Version, string(hostJSON), now, now, runnerID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrRunnerNotFound
+	}
+	return nil
+}
+
+// ListRunners returns every runner with its bindings, oldest first.
+func (s *Service) ListRunners() ([]Runner, error) {
+	return s.queryRunners(``)
+}
+
+// GetRunner returns one runner with its bindings.
+func (s *Service) GetRunner(id string) (Runner, error) {
+	runners, err := s.queryRunners(`WHERE id = ?`, id)
+	if err != nil {
+		return Runner{}, err
+	}
+	if len(runners) == 0 {
+		return Runner{}, ErrRunnerNotFound
+	}
+	return runners[0], nil
+}
+
+func (s *Service) queryRunners(where string, args ...any) ([]Runner, error) {
+	rows, err := s.db.Query(`SELECT id, name, version, host_json, credential_prefix, COALESCE(credential_rotated_at,''), COALESCE(last_seen_at,''), COALESCE(revoked_at,''), created_at FROM runners `+where+` ORDER BY created_at ASC, id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	out := []Runner{}
+	for rows.Next() {
+		var r Runner
+		var host string
+		if err := rows.Scan(&r.ID, &r.Name, &r.Version, &host, &r.CredentialPrefix, &r.CredentialRotatedAt, &r.LastSeenAt, &r.RevokedAt, &r.CreatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		_ = json.Unmarshal([]byte(host), &r.Host)
+		r.Status = runnerStatus(r)
+		out = append(out, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for i := range out {
+		ids, err := s.runnerBackendIDs(out[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		out[i].BackendIDs = ids
+	}
+	return out, nil
+}
+
+func (s *Service) runnerBackendIDs(runnerID string) ([]string, error) {
+	rows, err := s.db.Query(`SELECT execution_backend_id FROM runner_backends WHERE runner_id = ? ORDER BY execution_backend_id`, runnerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func runnerStatus(r Runner) string {
+	if r.RevokedAt != "" {
+		return "revoked"
+	}
+	seen, err := time.Parse(time.RFC3339, r.LastSeenAt)
+	if err == nil && time.Since(seen) <= RunnerSeenWindow {
+		return "online"
+	}
+	return "offline"
+}
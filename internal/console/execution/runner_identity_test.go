@@ -0,0 +1,117 @@
+package execution
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEnrollmentTokenIsSingleUse(t *testing.T) {
+	db := testDB(t)
+	seedExecutionStack(t, db)
+	seedRunnerBackend(t, db)
+	svc := NewService(db)
+	token, err := svc.CreateEnrollmentToken(EnrollmentRequest{BackendIDs: []string{"backend-runner"}})
+	if err != nil || !strings.HasPrefix(token.Token, EnrollmentTokenPrefix) {
+		t.Fatalf("create token = %+v, %v", token, err)
+	}
+	runner, credential, err := svc.EnrollRunner(token.Token, RunnerInfo{Name: "r1", Version: "1.2.0", Host: map[string]any{"hostname": "ci-1"}})
+	if err != nil || !strings.HasPrefix(credential, RunnerCredentialPrefix) || len(runner.BackendIDs) != 1 {
+		t.Fatalf("enroll = %+v, %q, %v", runner, credential, err)
+	}
+	if _, _, err := svc.EnrollRunner(token.Token, RunnerInfo{Name: "r2"}); !errors.Is(err, ErrRunnerUnauthorized) {
+		t.Fatalf("expected used token to be refused, got %v", err)
+	}
+	tokens, err := svc.ListEnrollmentTokens()
+	if err != nil || len(tokens) != 1 || tokens[0].RunnerID != runner.ID || tokens[0].UsedAt == "" || tokens[0].Token != "" {
+		t.Fatalf("tokens = %+v, %v", tokens, err)
+	}
+
+	expired, err := svc.CreateEnrollmentToken(EnrollmentRequest{BackendIDs: []string{"backend-runner"}, ExpiresInSeconds: 60})
+	if err != nil {
+		t.Fatalf("create token: %v", err)
+	}
+	if _, err := db.Exec(`UPDATE runner_enrollment_tokens SET expires_at = ? WHERE id = ?`, time.Now().Add(-time.Minute).UTC().Format(time.RFC3339), expired.ID); err != nil {
+		t.Fatalf("expire token: %v", err)
+	}
+	if _, _, err := svc.EnrollRunner(expired.Token, RunnerInfo{Name: "r3"}); !errors.Is(err, ErrRunnerUnauthorized) {
+		t.Fatalf("expected expired token to be refused, got %v", err)
+	}
+}
+
+func TestRunnerCredentialRotateAndRevoke(t *testing.T) {
+	db := testDB(t)
+	seedExecutionStack(t, db)
+	seedRunnerBackend(t, db)
+	svc := NewService(db)
+	runnerID, credential := enrollTestRunner(t, svc, "backend-runner")
+
+	if id, err := svc.AuthenticateRunner(credential); err != nil || id != runnerID {
+		t.Fatalf("authenticate = %q, %v", id, err)
+	}
+	for _, bad := range []string{"", "not-a-credential", RunnerCredentialPrefix + "0000"} {
+		if _, err := svc.AuthenticateRunner(bad); !errors.Is(err, ErrRunnerUnauthorized) {
+			t.Fatalf("%q: expected ErrRunnerUnauthorized, got %v", bad, err)
+		}
+	}
+
+	rotated, err := svc.RotateRunnerCredential(runnerID)
+	if err != nil || rotated == credential {
+		t.Fatalf("rotate = %q, %v", rotated, err)
+	}
+	if _, err := svc.AuthenticateRunner(credential); !errors.Is(err, ErrRunnerUnauthorized) {
+		t.Fatalf("expected old credential to stop working, got %v", err)
+	}
+	if id, err := svc.AuthenticateRunner(rotated); err != nil || id != runnerID {
+		t.Fatalf("authenticate rotated = %q, %v", id, err)
+	}
+
+	if err := svc.UpdateRunnerInfo(runnerID, RunnerInfo{Version: "2.0.0", Host: map[string]any{"arch": "arm64"}}); err != nil {
+		t.Fatalf("update info: %v", err)
+	}
+	runners, err := svc.ListRunners()
+	if err != nil || len(runners) != 1 {
+		t.Fatalf("list = %+v, %v", runners, err)
+	}
+	r := runners[0]
+	if r.Name != "build-01" || r.Version != "2.0.0" || r.Host["arch"] != "arm64" || r.Status != "online" || r.LastSeenAt == "" || r.BackendIDs[0] != "backend-runner" {
+		t.Fatalf("unexpected runner %+v", r)
+	}
+
+	if err := svc.RevokeRunner(runnerID); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	if _, err := svc.AuthenticateRunner(rotated); !errors.Is(err, ErrRunnerUnauthorized) {
+		t.Fatalf("expected revoked credential to be refused, got %v", err)
+	}
+	if _, err := svc.RotateRunnerCredential(runnerID); !errors.Is(err, ErrRunnerUnauthorized) {
+		t.Fatalf("expected revoked runner rotation to be refused, got %v", err)
+	}
+	if _, err := svc.ClaimJob(context.Background(), runnerID, 0); !errors.Is(err, ErrRunnerUnauthorized) {
+		t.Fatalf("expected revoked runner claim to be refused, got %v", err)
+	}
+	if got, _ := svc.GetRunner(runnerID); got.Status != "revoked" {
+		t.Fatalf("expected revoked status, got %+v", got)
+	}
+	if _, err := svc.GetRunner("missing"); !errors.Is(err, ErrRunnerNotFound) {
+		t.Fatalf("expected ErrRunnerNotFound, got %v", err)
+	}
+}
+
+func TestRunnerOnlyClaimsBoundBackends(t *testing.T) {
+	svc, _, stepID := runnerSetup(t)
+	now := time.Now().UTC().Format(time.RFC3339)
+	if _, err := svc.db.Exec(`INSERT INTO execution_backends (id, home_id, connector_code, name, type, endpoint_url, status, created_at, updated_at) VALUES ('backend-gpu','default','runner','GPU Pool','runner','','online',?,?)`, now, now); err != nil {
+		t.Fatalf("insert backend: %v", err)
+	}
+	gpuRunner, _ := enrollTestRunner(t, svc, "backend-gpu")
+	if _, err := svc.DispatchStepRun(context.Background(), stepID); err != nil {
+		t.Fatalf("dispatch: %v", err)
+	}
+	svc.Wait()
+	if lease, err := svc.ClaimJob(context.Background(), gpuRunner, 0); err != nil || lease != nil {
+		t.Fatalf("runner bound elsewhere claimed %+v, %v", lease, err)
+	}
+}
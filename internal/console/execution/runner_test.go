@@ -0,0 +1,282 @@
+package execution
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PonyDevAI/Bull-Board/internal/console/protection"
+)
+
+// seedRunnerBackend points the default worker at a runner backend.
+func seedRunnerBackend(t *testing.T, db *sql.DB) {
+	t.Helper()
+	now := time.Now().UTC().Format(time.RFC3339)
+	if _, err := db.Exec(`INSERT INTO execution_backends (id, home_id, connector_code, name, type, endpoint_url, status, created_at, updated_at) VALUES ('backend-runner','default','runner','Runner Pool','runner','','online',?,?)`, now, now); err != nil {
+		t.Fatalf("insert runner backend: %v", err)
+	}
+	if _, err := db.Exec(`UPDATE workers SET execution_backend_id = 'backend-runner'`); err != nil {
+		t.Fatalf("point worker at runner backend: %v", err)
+	}
+}
+
+// enrollTestRunner enrolls a runner bound to backendIDs and returns its id and credential.
+func enrollTestRunner(t *testing.T, svc *Service, backendIDs ...string) (string, string) {
+	t.Helper()
+	token, err := svc.CreateEnrollmentToken(EnrollmentRequest{Name: "build pool", BackendIDs: backendIDs})
+	if err != nil {
+		t.Fatalf("enrollment token: %v", err)
+	}
+	runner, credential, err := svc.EnrollRunner(token.Token, RunnerInfo{Name: "build-01", Version: "1.0.0", Host: map[string]any{"os": "linux"}})
+	if err != nil {
+		t.Fatalf("enroll: %v", err)
+	}
+	return runner.ID, credential
+}
+
+func runnerSetup(t *testing.T) (*Service, string, string) {
+	t.Helper()
+	db := testDB(t)
+	seedExecutionStack(t, db)
+	seedWorker(t, db, "worker-exec", "planner")
+	seedRunnerBackend(t, db)
+	_, stepID := seedWorkflowRun(t, db)
+	svc := NewService(db)
+	svc.SetDataDir(t.TempDir())
+	runnerID, _ := enrollTestRunner(t, svc, "backend-runner")
+	return svc, runnerID, stepID
+}
+
+func TestEnrollmentTokenValidatesBackends(t *testing.T) {
+	db := testDB(t)
+	seedExecutionStack(t, db)
+	svc := NewService(db)
+	for _, req := range []EnrollmentRequest{
+		{},
+		{BackendIDs: []string{"missing"}},
+		{BackendIDs: []string{"backend-default"}},
+	} {
+		if _, err := svc.CreateEnrollmentToken(req); !errors.Is(err, ErrInvalidRunner) {
+			t.Errorf("%+v: expected ErrInvalidRunner, got %v", req, err)
+		}
+	}
+}
+
+func TestRunnerClaimsAndCompletesJob(t *testing.T) {
+	svc, runnerID, stepID := runnerSetup(t)
+	res, err := svc.DispatchStepRun(context.Background(), stepID)
+	if err != nil {
+		t.Fatalf("dispatch: %v", err)
+	}
+	svc.Wait()
+	if got := jobStatus(t, svc, res.JobID); got != "queued" {
+		t.Fatalf("runner job should wait in the queue, got %s", got)
+	}
+
+	lease, err := svc.ClaimJob(context.Background(), runnerID, 0)
+	if err != nil || lease == nil || lease.JobID != res.JobID || lease.Attempt != 1 {
+		t.Fatalf("claim = %+v, %v", lease, err)
+	}
+	var req map[string]any
+	if err := json.Unmarshal(lease.Request, &req); err != nil || req["step_run_id"] != stepID {
+		t.Fatalf("lease request %s: %v", lease.Request, err)
+	}
+	if got := jobStatus(t, svc, res.JobID); got != "running" {
+		t.Fatalf("claimed job status %s", got)
+	}
+	if again, err := svc.ClaimJob(context.Background(), runnerID, 0); err != nil || again != nil {
+		t.Fatalf("expected empty queue, got %+v, %v", again, err)
+	}
+
+	if _, err := svc.RenewLease(runnerID, res.JobID, map[string]any{"percent": 50}); err != nil {
+		t.Fatalf("heartbeat: %v", err)
+	}
+	if _, err := svc.RenewLease("other-runner", res.JobID, nil); !errors.Is(err, ErrRunnerUnauthorized) {
+		t.Fatalf("expected unknown runner to be refused, got %v", err)
+	}
+	if err := svc.AppendRunnerLogs(runnerID, res.JobID, []LogChunk{{Stream: "stdout", Content: "building\n"}}); err != nil {
+		t.Fatalf("logs: %v", err)
+	}
+	a, err := svc.StoreRunnerArtifact(runnerID, res.JobID, "diff", "../diff.patch", strings.NewReader("--- a\n+++ b\n"))
+	if err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	_, f, err := svc.Artifacts().Open(a.ID)
+	if err != nil {
+		t.Fatalf("open artifact: %v", err)
+	}
+	data, _ := io.ReadAll(f)
+	f.Close()
+	if string(data) != "--- a\n+++ b\n" || a.Metadata["name"] != "diff.patch" || a.URI != "sha256:"+a.SHA256 || a.MIMEType != "text/x-diff" {
+		t.Fatalf("stored artifact %+v: %q", a, data)
+	}
+	if _, err := svc.StoreRunnerArtifact(runnerID, res.JobID, "", "x", strings.NewReader("")); !errors.Is(err, ErrInvalidUpload) {
+		t.Fatalf("expected ErrInvalidUpload, got %v", err)
+	}
+	if err := svc.ReportRunnerResult(runnerID, res.JobID, RunnerResult{Status: "running"}); !errors.Is(err, ErrInvalidResult) {
+		t.Fatalf("expected ErrInvalidResult, got %v", err)
+	}
+	if err := svc.ReportRunnerResult(runnerID, res.JobID, RunnerResult{Status: "succeeded", Output: map[string]any{"summary": "ok"}}); err != nil {
+		t.Fatalf("result: %v", err)
+	}
+	if got := jobStatus(t, svc, res.JobID); got != "succeeded" {
+		t.Fatalf("job status %s", got)
+	}
+	assertStepStatus(t, svc.db, stepID, "completed")
+	page, err := svc.ReadJobLog(res.JobID, 0, 10)
+	if err != nil || len(page.Entries) == 0 || page.Entries[0].Content != "building\n" {
+		t.Fatalf("job log %+v, %v", page, err)
+	}
+	if _, err := svc.RenewLease(runnerID, res.JobID, nil); !errors.Is(err, ErrLeaseLost) {
+		t.Fatalf("expected lease lost after result, got %v", err)
+	}
+}
+
+func TestClaimJobWakesOnDispatch(t *testing.T) {
+	svc, runnerID, stepID := runnerSetup(t)
+	claimed := make(chan *Lease, 1)
+	go func() {
+		lease, _ := svc.ClaimJob(context.Background(), runnerID, 10*time.Second)
+		claimed <- lease
+	}()
+	time.Sleep(50 * time.Millisecond)
+	res, err := svc.DispatchStepRun(context.Background(), stepID)
+	if err != nil {
+		t.Fatalf("dispatch: %v", err)
+	}
+	select {
+	case lease := <-claimed:
+		if lease == nil || lease.JobID != res.JobID {
+			t.Fatalf("unexpected lease %+v", lease)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("waiting claim was not woken by dispatch")
+	}
+}
+
+func TestExpiredLeaseRequeuesThenFails(t *testing.T) {
+	svc, runnerID, stepID := runnerSetup(t)
+	res, err := svc.DispatchStepRun(context.Background(), stepID)
+	if err != nil {
+		t.Fatalf("dispatch: %v", err)
+	}
+	svc.Wait()
+	for attempt := 1; attempt <= MaxLeaseAttempts; attempt++ {
+		lease, err := svc.ClaimJob(context.Background(), runnerID, 0)
+		if err != nil || lease == nil || lease.Attempt != attempt {
+			t.Fatalf("claim %d = %+v, %v", attempt, lease, err)
+		}
+		svc.RequeueExpiredLeases(time.Now().Add(2 * LeaseDuration))
+		want := "queued"
+		if attempt == MaxLeaseAttempts {
+			want = "failed"
+		}
+		if got := jobStatus(t, svc, res.JobID); got != want {
+			t.Fatalf("after expiry %d: status %s want %s", attempt, got, want)
+		}
+		if attempt == 1 {
+			if _, err := svc.RenewLease(runnerID, res.JobID, nil); !errors.Is(err, ErrLeaseLost) {
+				t.Fatalf("expected stale runner to lose its lease, got %v", err)
+			}
+		}
+	}
+	assertStepStatus(t, svc.db, stepID, "failed")
+}
+
+func TestCancelledRunnerJobWaitsForRunner(t *testing.T) {
+	endings := map[string]func(svc *Service, runnerID, jobID string) error{
+		"heartbeat": func(svc *Service, runnerID, jobID string) error {
+			if _, err := svc.RenewLease(runnerID, jobID, nil); !errors.Is(err, ErrLeaseLost) {
+				return fmt.Errorf("expected the heartbeat to be refused, got %v", err)
+			}
+			return nil
+		},
+		"result": func(svc *Service, runnerID, jobID string) error {
+			if err := svc.AppendRunnerLogs(runnerID, jobID, []LogChunk{{Stream: "stdout", Content: "done\n"}}); err != nil {
+				return err
+			}
+			return svc.ReportRunnerResult(runnerID, jobID, RunnerResult{Status: "succeeded"})
+		},
+		"lease expiry": func(svc *Service, runnerID, jobID string) error {
+			svc.RequeueExpiredLeases(time.Now().Add(2 * LeaseDuration))
+			return nil
+		},
+	}
+	for name, end := range endings {
+		t.Run(name, func(t *testing.T) {
+			svc, runnerID, stepID := runnerSetup(t)
+			res, err := svc.DispatchStepRun(context.Background(), stepID)
+			if err != nil {
+				t.Fatalf("dispatch: %v", err)
+			}
+			svc.Wait()
+			if _, err := svc.ClaimJob(context.Background(), runnerID, 0); err != nil {
+				t.Fatalf("claim: %v", err)
+			}
+			status, err := svc.CancelJob(context.Background(), res.JobID, "stop")
+			if err != nil || status != "cancelling" {
+				t.Fatalf("cancel: status=%s err=%v", status, err)
+			}
+			if got := jobStatus(t, svc, res.JobID); got != "cancelling" {
+				t.Fatalf("job should stay cancelling until the runner hears of it, got %s", got)
+			}
+			if err := end(svc, runnerID, res.JobID); err != nil {
+				t.Fatal(err)
+			}
+			if got := jobStatus(t, svc, res.JobID); got != "cancelled" {
+				t.Fatalf("job status %s", got)
+			}
+			assertStepStatus(t, svc.db, stepID, "cancelled")
+			if _, err := svc.RenewLease(runnerID, res.JobID, nil); !errors.Is(err, ErrLeaseLost) {
+				t.Fatalf("expected ErrLeaseLost, got %v", err)
+			}
+		})
+	}
+}
+
+func TestRunnerGitOperationsFollowBranchProtection(t *testing.T) {
+	svc, runnerID, stepID := runnerSetup(t)
+	store := protection.NewStore(svc.db)
+	if _, err := store.SaveRule(protection.Rule{WorkspaceID: "default-workspace", Pattern: "main"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.SaveRule(protection.Rule{WorkspaceID: "default-workspace", Pattern: "release/*", OnViolation: protection.ViolationApproval}); err != nil {
+		t.Fatal(err)
+	}
+	res, err := svc.DispatchStepRun(context.Background(), stepID)
+	if err != nil {
+		t.Fatalf("dispatch: %v", err)
+	}
+	svc.Wait()
+	if lease, err := svc.ClaimJob(context.Background(), runnerID, 0); err != nil || lease == nil {
+		t.Fatalf("claim = %+v, %v", lease, err)
+	}
+
+	if a, err := svc.CheckRunnerGitOperation(runnerID, res.JobID, RunnerGitOperation{Operation: protection.OpCommit, Branch: "bb/run-1"}); err != nil || a.Decision != protection.DecisionAllowed || a.Source != RunnerConnectorCode || a.StepRunID != stepID {
+		t.Fatalf("commit to an unprotected branch = %+v, %v", a, err)
+	}
+	if _, err := svc.CheckRunnerGitOperation(runnerID, res.JobID, RunnerGitOperation{Operation: protection.OpForcePush, Branch: "main", Observed: true}); !errors.Is(err, protection.ErrBlocked) {
+		t.Fatalf("expected the deletion of main blocked, got %v", err)
+	}
+	if _, err := svc.CheckRunnerGitOperation(runnerID, res.JobID, RunnerGitOperation{Operation: protection.OpPush, Branch: "bb/run-1"}); !errors.Is(err, ErrInvalidGitOperation) {
+		t.Fatalf("expected a runner push refused, got %v", err)
+	}
+	if _, err := svc.CheckRunnerGitOperation("other-runner", res.JobID, RunnerGitOperation{Operation: protection.OpCommit, Branch: "main"}); !errors.Is(err, ErrRunnerUnauthorized) {
+		t.Fatalf("expected unknown runner refused, got %v", err)
+	}
+
+	// An update waiting for approval parks the step when the job fails on it.
+	if _, err := svc.CheckRunnerGitOperation(runnerID, res.JobID, RunnerGitOperation{Operation: protection.OpCommit, Branch: "release/1", Observed: true}); !errors.Is(err, protection.ErrApprovalRequired) {
+		t.Fatalf("expected the update held for approval, got %v", err)
+	}
+	if err := svc.ReportRunnerResult(runnerID, res.JobID, RunnerResult{Status: "failed", Output: map[string]any{"error": "branch moved back"}}); err != nil {
+		t.Fatalf("result: %v", err)
+	}
+	assertStepStatus(t, svc.db, stepID, "awaiting_approval")
+}
@@ -6,36 +6,123 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log/slog"
+	"sync"
 	"time"
 
 	"github.com/PonyDevAI/Bull-Board/internal/common"
+	"github.com/PonyDevAI/Bull-Board/internal/console/artifacts"
 	"github.com/PonyDevAI/Bull-Board/internal/console/dispatch"
+	"github.com/PonyDevAI/Bull-Board/internal/console/events"
+	"github.com/PonyDevAI/Bull-Board/internal/console/execution_backends"
+	"github.com/PonyDevAI/Bull-Board/internal/console/testreports"
 	"github.com/PonyDevAI/Bull-Board/internal/console/workflows"
 	"github.com/PonyDevAI/Bull-Board/internal/integrations/openclaw"
 )
 
-var ErrStepNotDispatchable = errors.New("step run is not dispatchable")
+var (
+	ErrStepNotDispatchable = errors.New("step run is not dispatchable")
+	ErrJobNotFound         = errors.New("job not found")
+	ErrJobNotActive        = errors.New("job is not active")
+	ErrWorkerNotFound      = errors.New("worker not found")
+)
 
 type DispatchResult struct {
-	StepRunID       string                 `json:"step_run_id"`
-	JobID           string                 `json:"job_id"`
-	JobStatus       string                 `json:"job_status"`
-	ExternalJobRef  string                 `json:"external_job_ref,omitempty"`
-	ExecutionStatus string                 `json:"execution_status"`
-	Output          any                    `json:"output,omitempty"`
-	Response        map[string]any         `json:"response,omitempty"`
-	Artifacts       []openclaw.JobArtifact `json:"artifacts,omitempty"`
+	StepRunID       string                        `json:"step_run_id"`
+	JobID           string                        `json:"job_id"`
+	JobStatus       string                        `json:"job_status"`
+	ExternalJobRef  string                        `json:"external_job_ref,omitempty"`
+	ExecutionStatus string                        `json:"execution_status"`
+	QueuePosition   int                           `json:"queue_position,omitempty"`
+	Output          any                           `json:"output,omitempty"`
+	Response        map[string]any                `json:"response,omitempty"`
+	Artifacts       []execution_backends.Artifact `json:"artifacts,omitempty"`
 }
 
+// Service dispatches step runs as jobs and executes them in the background.
+// Dispatch only records a queued job; a background executor drives the
+// connector and applies the final result to step and workflow state.
 type Service struct {
-	db      *sql.DB
-	adapter *openclaw.Adapter
+	db         *sql.DB
+	connectors *execution_backends.Registry
+	events     *events.Bus
+	ctx        context.Context
+	wg         sync.WaitGroup
+	// admission serializes capacity checks with step starts so concurrent
+	// dispatches cannot both take a worker's last slot.
+	admission sync.Mutex
+	mu        sync.Mutex
+	// running holds the interrupt func of jobs currently executing in-process.
+	running map[string]context.CancelFunc
+	// logMu serializes job log appends so chunk offsets stay contiguous.
+	logMu     sync.Mutex
+	dataDir   string
+	artifacts *artifacts.Service
+	tests     *testreports.Service
+	// runnerWake is closed and replaced whenever runner jobs are queued, waking waiting claims.
+	runnerWake chan struct{}
 }
 
 func NewService(db *sql.DB) *Service {
-	return &Service{db: db, adapter: openclaw.NewAdapter()}
+	connectors := execution_backends.NewRegistry()
+	connectors.Register("openclaw", openclawConnector{adapter: openclaw.NewAdapter()})
+	connectors.Register(RunnerConnectorCode, runnerConnector{db: db})
+	return &Service{db: db, connectors: connectors, ctx: context.Background(), running: map[string]context.CancelFunc{}, artifacts: artifacts.NewService(db, ""), tests: testreports.NewService(db)}
 }
 
+// SetEventBus publishes job status changes to bus.
+func (s *Service) SetEventBus(bus *events.Bus) { s.events = bus }
+
+// Connectors exposes the connector registry so callers can register additional backends.
+func (s *Service) Connectors() *execution_backends.Registry { return s.connectors }
+
+// Start binds background execution to ctx and recovers jobs left behind by a
+// previous console process: queued jobs are executed again (or left for
+// runners to claim), while in-process jobs that were running without an
+// external reference cannot be resumed and fail. Jobs that were being
+// cancelled finish as cancelled (see recoverCancelling).
+func (s *Service) Start(ctx context.Context) error {
+	s.ctx = ctx
+	rows, err := s.db.Query(`SELECT id, step_run_id, status, COALESCE(external_job_ref,''), COALESCE(execution_backend_id,'') FROM jobs WHERE status IN ('queued','running','cancelling') ORDER BY created_at ASC`)
+	if err != nil {
+		return err
+	}
+	var pending []pendingJob
+	for rows.Next() {
+		var j pendingJob
+		if err := rows.Scan(&j.id, &j.stepRunID, &j.status, &j.externalRef, &j.backendID); err != nil {
+			rows.Close()
+			return err
+		}
+		pending = append(pending, j)
+	}
+	rows.Close()
+	for _, j := range pending {
+		switch {
+		case j.status == "queued":
+			s.submit(j.id)
+		case j.status == "cancelling":
+			if err := s.recoverCancelling(ctx, j); err != nil {
+				slog.Error("execution: recover cancelled job", "job_id", j.id, "err", err)
+			}
+		case j.externalRef == "":
+			failure := execution_backends.Result{Status: "failed", Output: map[string]any{"error": "job interrupted by console restart"}}
+			if err := s.FinishJob(j.id, failure); err != nil {
+				slog.Error("execution: recover job", "job_id", j.id, "err", err)
+			}
+		}
+	}
+	s.DrainQueue()
+	return nil
+}
+
+// Wait blocks until all background executions started so far have finished.
+func (s *Service) Wait() { s.wg.Wait() }
+
+// DispatchStepRun starts a ready step run and queues a job for it. The job is
+// executed in the background; callers follow it through the jobs API or events.
+// When the worker or its execution backend is at max_concurrency the step is
+// parked as queued instead and started once capacity frees up.
 func (s *Service) DispatchStepRun(ctx context.Context, stepRunID string) (DispatchResult, error) {
 	out := DispatchResult{StepRunID: stepRunID}
 	wf := workflows.NewService(s.db)
@@ -43,76 +130,295 @@ func (s *Service) DispatchStepRun(ctx context.Context, stepRunID string) (Dispat
 	if err := ensureDispatchable(s.db, stepRunID); err != nil {
 		return out, err
 	}
-	if err := wf.StartStep(stepRunID); err != nil {
-		if errors.Is(err, workflows.ErrStepRunNotFound) {
+	if err := s.routeToEligibleWorker(wf, stepRunID); err != nil {
+		return out, err
+	}
+	prepared, backend, err := s.prepare(stepRunID)
+	if err != nil {
+		return out, err
+	}
+
+	s.admission.Lock()
+	defer s.admission.Unlock()
+	ok, err := s.hasCapacity(asString(prepared.Worker["id"]), backend.ID)
+	if err != nil {
+		return out, err
+	}
+	if !ok {
+		if err := wf.QueueStep(stepRunID); err != nil {
+			return out, fmt.Errorf("%w: %v", ErrStepNotDispatchable, err)
+		}
+		position, err := s.queuePosition(stepRunID)
+		if err != nil {
 			return out, err
 		}
-		return out, fmt.Errorf("%w: %v", ErrStepNotDispatchable, err)
+		s.events.Publish("step_run_queued", map[string]any{"step_run_id": stepRunID, "worker_id": prepared.Worker["id"], "queue_position": position})
+		out.ExecutionStatus = "waiting_for_capacity"
+		out.QueuePosition = position
+		return out, nil
 	}
-
-	prepared, err := dispatch.PrepareDispatchForStep(s.db, stepRunID)
+	jobID, err := s.startJob(wf, stepRunID, backend.ID, prepared)
 	if err != nil {
 		return out, err
 	}
+	out.JobID = jobID
+	out.JobStatus = "queued"
+	out.ExecutionStatus = "queued"
+	return out, nil
+}
 
+// prepare builds the dispatch payload and checks the worker's backend can take it.
+func (s *Service) prepare(stepRunID string) (dispatch.PreparedDispatchRequest, execution_backends.Backend, error) {
+	var backend execution_backends.Backend
+	prepared, err := dispatch.PrepareDispatchForStep(s.db, stepRunID)
+	if err != nil {
+		return prepared, backend, err
+	}
 	backendID := asString(prepared.Worker["execution_backend_id"])
 	if backendID == "" {
-		return out, fmt.Errorf("%w: worker execution backend missing", ErrStepNotDispatchable)
+		return prepared, backend, fmt.Errorf("%w: worker execution backend missing", ErrStepNotDispatchable)
 	}
+	backend, err = execution_backends.NewRepository(s.db).Get(backendID)
+	if err != nil {
+		return prepared, backend, fmt.Errorf("%w: %v", ErrStepNotDispatchable, err)
+	}
+	if backend.Status == "offline" {
+		return prepared, backend, fmt.Errorf("%w: execution backend %s is offline", ErrStepNotDispatchable, backend.ID)
+	}
+	if _, ok := s.connectors.ForBackend(backend); !ok {
+		return prepared, backend, fmt.Errorf("%w: no connector for backend type %s", ErrStepNotDispatchable, backend.Type)
+	}
+	return prepared, backend, nil
+}
 
+// startJob moves the step to running and submits its job. Callers hold s.admission.
+func (s *Service) startJob(wf *workflows.Service, stepRunID, backendID string, prepared dispatch.PreparedDispatchRequest) (string, error) {
+	if err := wf.StartStep(stepRunID); err != nil {
+		if errors.Is(err, workflows.ErrStepRunNotFound) {
+			return "", err
+		}
+		return "", fmt.Errorf("%w: %v", ErrStepNotDispatchable, err)
+	}
 	jobID, err := s.createJob(stepRunID, backendID, prepared)
 	if err != nil {
-		return out, err
+		return "", err
 	}
-	out.JobID = jobID
+	s.publishJobStatus(jobID, stepRunID, "queued", "")
+	s.submit(jobID)
+	return jobID, nil
+}
 
-	execResult, execErr := s.adapter.ExecutePreparedDispatch(ctx, openclaw.PreparedDispatchRequest{
-		WorkflowRunID:    prepared.WorkflowRunID,
-		StepRunID:        prepared.StepRunID,
-		TaskID:           prepared.TaskID,
-		Worker:           prepared.Worker,
-		Role:             prepared.Role,
-		AgentApp:         prepared.AgentApp,
-		ExecutionBackend: prepared.ExecutionBackend,
-		ResolvedConfig:   prepared.ResolvedConfig,
-		Input:            prepared.Input,
-	})
+// DispatchRejectedError reports why no worker can take a step run: each
+// candidate of the step's role with its backend status and missing capabilities.
+type DispatchRejectedError struct {
+	StepRunID  string                          `json:"step_run_id"`
+	Required   execution_backends.Capabilities `json:"required_capabilities"`
+	Candidates []workflows.WorkerCandidate     `json:"candidates"`
+}
+
+func (e *DispatchRejectedError) Error() string {
+	return ErrStepNotDispatchable.Error() + ": no eligible worker"
+}
+
+func (e *DispatchRejectedError) Unwrap() error { return ErrStepNotDispatchable }
+
+// routeToEligibleWorker reassigns the step to another worker of its role when
+// the assigned worker's backend is offline or lacks the step's required
+// capabilities, and rejects the dispatch when no worker is eligible.
+func (s *Service) routeToEligibleWorker(wf *workflows.Service, stepRunID string) error {
+	required, assigned, candidates, err := wf.StepCandidates(stepRunID)
+	if err != nil {
+		return err
+	}
+	if assigned == nil || assigned.Eligible {
+		return nil
+	}
+	workerID, err := wf.ReassignWorker(stepRunID)
+	if err != nil {
+		return err
+	}
+	if workerID != "" {
+		return nil
+	}
+	if len(candidates) == 0 {
+		candidates = []workflows.WorkerCandidate{*assigned}
+	}
+	return &DispatchRejectedError{StepRunID: stepRunID, Required: required, Candidates: candidates}
+}
+
+func (s *Service) submit(jobID string) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.runJob(jobID)
+	}()
+}
+
+func (s *Service) runJob(jobID string) {
+	req, err := s.loadRequest(jobID)
+	if err != nil {
+		slog.Error("execution: load job", "job_id", jobID, "err", err)
+		return
+	}
+	connector, ok := s.connectors.ForBackend(req.Backend)
+	if !ok {
+		s.finishOrLog(jobID, failedResult(errNoConnector(req.Backend)))
+		return
+	}
+	if _, ok := connector.(execution_backends.Pulled); ok {
+		if result, guarded := s.guardRunnerCommit(req); guarded {
+			s.finishOrLog(jobID, result)
+			return
+		}
+		// The job stays queued until a runner claims it.
+		s.notifyRunners()
+		return
+	}
+	ctx, interrupt := context.WithCancel(s.ctx)
+	defer interrupt()
+	s.mu.Lock()
+	s.running[jobID] = interrupt
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.running, jobID)
+		s.mu.Unlock()
+	}()
+	if err := s.markJobRunning(jobID); err != nil {
+		var status string
+		_ = s.db.QueryRow(`SELECT status FROM jobs WHERE id = ?`, jobID).Scan(&status)
+		if status == "cancelling" {
+			// CancelJob got to the job before it started and left it to this
+			// run to close, since the job was already registered as running.
+			s.finishOrLog(jobID, execution_backends.Result{})
+			return
+		}
+		slog.Error("execution: mark job running", "job_id", jobID, "err", err)
+		return
+	}
+	s.publishJobStatus(jobID, req.StepRunID, "running", "")
+
+	req.Logs = s.logSink(jobID)
+	result, execErr := connector.Execute(ctx, req)
 	if execErr != nil {
-		execResult = openclaw.ExecutionResult{
-			Status:   "failed",
-			Output:   map[string]any{"error": execErr.Error()},
-			Response: map[string]any{"error": execErr.Error()},
+		result = failedResult(execErr)
+	}
+	var roots []string
+	if local, ok := connector.(execution_backends.LocalArtifacts); ok {
+		roots = local.ArtifactRoots(req)
+	}
+	if err := s.finishJob(jobID, result, roots); err != nil {
+		slog.Error("execution: finish job", "job_id", jobID, "err", err)
+	}
+}
+
+func (s *Service) finishOrLog(jobID string, result execution_backends.Result) {
+	if err := s.FinishJob(jobID, result); err != nil {
+		slog.Error("execution: finish job", "job_id", jobID, "err", err)
+	}
+}
+
+func failedResult(err error) execution_backends.Result {
+	return execution_backends.Result{
+		Status:   "failed",
+		Output:   map[string]any{"error": err.Error()},
+		Response: map[string]any{"error": err.Error()},
+	}
+}
+
+// FinishJob applies a connector result to a job. A "running" result records
+// the external reference and leaves the job active; "succeeded" or "failed"
+// closes the job, stores its artifacts and completes or fails the step run;
+// "awaiting_approval" closes the job and parks the step run.
+// Any result for a job being cancelled closes it as cancelled. Reported
+// artifacts must reference stored blobs; local paths are only taken from
+// connectors running in this process (see finishJob).
+func (s *Service) FinishJob(jobID string, result execution_backends.Result) error {
+	return s.finishJob(jobID, result, nil)
+}
+
+// finishJob is FinishJob for a result whose artifacts may also name files
+// under roots.
+func (s *Service) finishJob(jobID string, result execution_backends.Result, roots []string) error {
+	var stepRunID, status string
+	err := s.db.QueryRow(`SELECT step_run_id, status FROM jobs WHERE id = ?`, jobID).Scan(&stepRunID, &status)
+	if err == sql.ErrNoRows {
+		return ErrJobNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if status == "cancelling" {
+		return s.finishCancelled(jobID, stepRunID, result, roots)
+	}
+	if status != "queued" && status != "running" {
+		return fmt.Errorf("%w: status=%s", ErrJobNotActive, status)
+	}
+
+	if result.Status == "running" {
+		now := time.Now().UTC().Format(time.RFC3339)
+		if _, err := s.db.Exec(`UPDATE jobs SET external_job_ref = COALESCE(NULLIF(?, ''), external_job_ref), status='running', started_at=COALESCE(started_at, ?), updated_at=? WHERE id=?`, result.ExternalJobRef, now, now, jobID); err != nil {
+			return err
 		}
+		s.publishJobStatus(jobID, stepRunID, "running", result.ExternalJobRef)
+		return nil
 	}
 
 	jobStatus := "failed"
-	if execResult.Status == "succeeded" {
-		jobStatus = "succeeded"
+	switch result.Status {
+	case "succeeded", execution_backends.StatusAwaitingApproval:
+		jobStatus = result.Status
 	}
-	if err := s.completeJob(jobID, jobStatus, execResult); err != nil {
-		return out, err
+	// Claim the job before recording anything, so that a result reported
+	// twice or racing a cancellation cannot add its artifacts again.
+	if err := s.completeJob(jobID, jobStatus, result); err != nil {
+		return err
 	}
-	if err := s.insertArtifacts(jobID, stepRunID, execResult.Artifacts); err != nil {
-		return out, err
+	// Artifacts go in before the step's test conditions are checked so they
+	// see this job's reports. The job is already closed: a failure to record
+	// them is logged rather than leaving the step without an outcome.
+	if err := s.insertArtifacts(jobID, stepRunID, result.Artifacts, roots); err != nil {
+		slog.Error("execution: record artifacts", "job_id", jobID, "err", err)
 	}
-
-	if execResult.Status == "succeeded" {
-		if err := wf.CompleteStep(stepRunID, execResult.Output); err != nil {
-			return out, err
+	if jobStatus == "succeeded" {
+		ok, err := s.applyTestConditions(jobID, &result)
+		if err != nil {
+			ok = false
+			result.Status = "failed"
+			result.Output = map[string]any{"error": "check test conditions: " + err.Error(), "phase": "test_conditions", "output": result.Output}
 		}
-	} else {
-		if err := wf.FailStep(stepRunID, execResult.Output); err != nil {
-			return out, err
+		if !ok {
+			jobStatus = "failed"
 		}
+		if err := s.amendJobResult(jobID, jobStatus, result); err != nil {
+			return err
+		}
+	}
+	if err := s.archiveJobLog(jobID, stepRunID, result.Artifacts); err != nil {
+		slog.Warn("execution: archive job log", "job_id", jobID, "err", err)
 	}
+	s.publishJobStatus(jobID, stepRunID, jobStatus, result.ExternalJobRef)
 
-	out.JobStatus = jobStatus
-	out.ExternalJobRef = execResult.ExternalJobRef
-	out.ExecutionStatus = execResult.Status
-	out.Output = execResult.Output
-	out.Response = execResult.Response
-	out.Artifacts = execResult.Artifacts
-	return out, nil
+	wf := workflows.NewService(s.db)
+	switch jobStatus {
+	case "succeeded":
+		err = wf.CompleteStep(stepRunID, result.Output)
+	case execution_backends.StatusAwaitingApproval:
+		err = wf.AwaitApproval(stepRunID, result.Output)
+	default:
+		err = wf.FailStep(stepRunID, result.Output)
+	}
+	s.DrainQueue()
+	return err
+}
+
+func (s *Service) publishJobStatus(jobID, stepRunID, status, externalRef string) {
+	s.events.Publish("job_status_changed", map[string]any{
+		"job_id":           jobID,
+		"step_run_id":      stepRunID,
+		"status":           status,
+		"external_job_ref": externalRef,
+	})
 }
 
 func ensureDispatchable(db *sql.DB, stepRunID string) error {
@@ -134,30 +440,108 @@ func (s *Service) createJob(stepRunID, backendID string, payload dispatch.Prepar
 	}
 	now := time.Now().UTC().Format(time.RFC3339)
 	jobID := common.UUID()
-	_, err = s.db.Exec(`INSERT INTO jobs (id, step_run_id, execution_backend_id, status, request_json, result_json, created_at, updated_at) VALUES (?, ?, ?, 'running', ?, '{}', ?, ?)`, jobID, stepRunID, backendID, string(requestJSON), now, now)
+	_, err = s.db.Exec(`INSERT INTO jobs (id, step_run_id, execution_backend_id, status, request_json, result_json, created_at, updated_at) VALUES (?, ?, ?, 'queued', ?, '{}', ?, ?)`, jobID, stepRunID, backendID, string(requestJSON), now, now)
 	return jobID, err
 }
 
-func (s *Service) completeJob(jobID, status string, result openclaw.ExecutionResult) error {
+// loadRequest rebuilds the connector request for a job from its stored dispatch payload.
+func (s *Service) loadRequest(jobID string) (execution_backends.Request, error) {
+	var req execution_backends.Request
+	var backendID sql.NullString
+	var requestJSON string
+	err := s.db.QueryRow(`SELECT execution_backend_id, request_json FROM jobs WHERE id = ?`, jobID).Scan(&backendID, &requestJSON)
+	if err == sql.ErrNoRows {
+		return req, ErrJobNotFound
+	}
+	if err != nil {
+		return req, err
+	}
+	var prepared dispatch.PreparedDispatchRequest
+	if err := json.Unmarshal([]byte(requestJSON), &prepared); err != nil {
+		return req, fmt.Errorf("decode job request: %w", err)
+	}
+	backend, err := execution_backends.NewRepository(s.db).Get(backendID.String)
+	if err != nil {
+		return req, err
+	}
+	req = execution_backends.Request{
+		JobID:            jobID,
+		WorkflowRunID:    prepared.WorkflowRunID,
+		StepRunID:        prepared.StepRunID,
+		TaskID:           prepared.TaskID,
+		Worker:           prepared.Worker,
+		Role:             prepared.Role,
+		AgentApp:         prepared.AgentApp,
+		ExecutionBackend: prepared.ExecutionBackend,
+		ResolvedConfig:   prepared.ResolvedConfig,
+		Step:             prepared.Step,
+		Workspace:        prepared.Workspace,
+		Input:            prepared.Input,
+		ToolPolicy:       &prepared.ToolPolicy,
+		Backend:          backend,
+	}
+	return req, nil
+}
+
+func (s *Service) markJobRunning(jobID string) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	res, err := s.db.Exec(`UPDATE jobs SET status='running', started_at=COALESCE(started_at, ?), updated_at=? WHERE id=? AND status='queued'`, now, now, jobID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrJobNotActive
+	}
+	return nil
+}
+
+func (s *Service) completeJob(jobID, status string, result execution_backends.Result) error {
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	res, err := s.db.Exec(`UPDATE jobs SET external_job_ref = COALESCE(NULLIF(?, ''), external_job_ref), status=?, result_json=?, finished_at=?, updated_at=? WHERE id=? AND status IN ('queued','running','cancelling')`, result.ExternalJobRef, status, string(resultJSON), now, now, jobID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrJobNotActive
+	}
+	return nil
+}
+
+// amendJobResult replaces the result of a job completeJob closed, once its
+// test conditions have been checked.
+func (s *Service) amendJobResult(jobID, status string, result execution_backends.Result) error {
 	resultJSON, err := json.Marshal(result)
 	if err != nil {
 		return err
 	}
 	now := time.Now().UTC().Format(time.RFC3339)
-	_, err = s.db.Exec(`UPDATE jobs SET external_job_ref = NULLIF(?, ''), status=?, result_json=?, updated_at=? WHERE id=?`, result.ExternalJobRef, status, string(resultJSON), now, jobID)
+	_, err = s.db.Exec(`UPDATE jobs SET status=?, result_json=?, updated_at=? WHERE id=?`, status, string(resultJSON), now, jobID)
 	return err
 }
 
-func (s *Service) insertArtifacts(jobID, stepRunID string, artifacts []openclaw.JobArtifact) error {
-	for _, artifact := range artifacts {
-		metadataJSON, err := json.Marshal(artifact.Metadata)
+// insertArtifacts records reported artifacts. Content the console can read
+// (stored blobs, local files under roots) is copied into the artifact store
+// so the row references its blob; a failed copy only loses the blob
+// reference, not the row.
+func (s *Service) insertArtifacts(jobID, stepRunID string, reported []execution_backends.Artifact, roots []string) error {
+	for _, artifact := range reported {
+		row := artifacts.Artifact{JobID: jobID, StepRunID: stepRunID, Kind: artifact.Kind, URI: artifact.URI, Metadata: artifact.Metadata}
+		blob, ok, err := s.artifacts.Ingest(jobID, artifact.URI, roots)
 		if err != nil {
-			return err
+			slog.Warn("execution: store artifact", "job_id", jobID, "uri", artifact.URI, "err", err)
+		}
+		if ok {
+			row.SHA256, row.Size, row.MIMEType = blob.SHA256, blob.Size, blob.MIMEType
 		}
-		_, err = s.db.Exec(`INSERT INTO artifacts (id, job_id, step_run_id, kind, uri, metadata_json, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)`, common.UUID(), jobID, stepRunID, artifact.Kind, artifact.URI, string(metadataJSON), time.Now().UTC().Format(time.RFC3339))
+		created, err := s.artifacts.Create(row)
 		if err != nil {
 			return err
 		}
+		s.indexArtifact(created)
 	}
 	return nil
 }
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/PonyDevAI/Bull-Board/internal/common"
+	"github.com/PonyDevAI/Bull-Board/internal/console/execution_backends"
 	"github.com/PonyDevAI/Bull-Board/internal/console/workflows"
 )
 
@@ -22,9 +23,10 @@ func TestDispatchStepRunSuccessPersistsJobArtifactsAndAdvances(t *testing.T) {
 	if err != nil {
 		t.Fatalf("dispatch step run: %v", err)
 	}
-	if result.JobID == "" || result.ExecutionStatus != "succeeded" {
+	if result.JobID == "" || result.JobStatus != "queued" {
 		t.Fatalf("unexpected dispatch result: %+v", result)
 	}
+	svc.Wait()
 
 	var stepStatus string
 	if err := db.QueryRow(`SELECT status FROM step_runs WHERE id = ?`, stepID).Scan(&stepStatus); err != nil {
@@ -59,6 +61,38 @@ func TestDispatchStepRunSuccessPersistsJobArtifactsAndAdvances(t *testing.T) {
 	}
 }
 
+func TestDispatchStepRunWaitsForExternalCompletion(t *testing.T) {
+	db := testDB(t)
+	seedExecutionStack(t, db)
+	seedWorker(t, db, "worker-exec", "planner")
+	_, stepID := seedWorkflowRun(t, db)
+
+	svc := NewService(db)
+	svc.Connectors().Register("openclaw", fakeConnector{result: execution_backends.Result{Status: "running", ExternalJobRef: "ext-1"}})
+	result, err := svc.DispatchStepRun(context.Background(), stepID)
+	if err != nil {
+		t.Fatalf("dispatch step run: %v", err)
+	}
+	svc.Wait()
+
+	var jobStatus, externalRef string
+	if err := db.QueryRow(`SELECT status, COALESCE(external_job_ref, '') FROM jobs WHERE id = ?`, result.JobID).Scan(&jobStatus, &externalRef); err != nil {
+		t.Fatalf("read job: %v", err)
+	}
+	if jobStatus != "running" || externalRef != "ext-1" {
+		t.Fatalf("expected running job awaiting backend, got status=%s ref=%s", jobStatus, externalRef)
+	}
+	assertStepStatus(t, db, stepID, "running")
+
+	if err := svc.FinishJob(result.JobID, execution_backends.Result{Status: "failed", Output: map[string]any{"error": "boom"}}); err != nil {
+		t.Fatalf("finish job: %v", err)
+	}
+	assertStepStatus(t, db, stepID, "failed")
+	if err := svc.FinishJob(result.JobID, execution_backends.Result{Status: "succeeded"}); err == nil {
+		t.Fatalf("expected finished job to reject a second result")
+	}
+}
+
 func TestDispatchStepRunRequiresReadyState(t *testing.T) {
 	db := testDB(t)
 	seedExecutionStack(t, db)
@@ -75,6 +109,30 @@ func TestDispatchStepRunRequiresReadyState(t *testing.T) {
 	}
 }
 
+type fakeConnector struct {
+	result execution_backends.Result
+	err    error
+	// roots makes the fake an in-process connector whose files are ingested.
+	roots []string
+}
+
+func (f fakeConnector) Execute(ctx context.Context, req execution_backends.Request) (execution_backends.Result, error) {
+	return f.result, f.err
+}
+
+func (f fakeConnector) ArtifactRoots(req execution_backends.Request) []string { return f.roots }
+
+func assertStepStatus(t *testing.T, db *sql.DB, stepRunID, want string) {
+	t.Helper()
+	var got string
+	if err := db.QueryRow(`SELECT status FROM step_runs WHERE id = ?`, stepRunID).Scan(&got); err != nil {
+		t.Fatalf("query step status: %v", err)
+	}
+	if got != want {
+		t.Fatalf("step %s status got %s want %s", stepRunID, got, want)
+	}
+}
+
 func testDB(t *testing.T) *sql.DB {
 	t.Helper()
 	t.Setenv("SQLITE_PATH", filepath.Join(t.TempDir(), "bb.sqlite"))
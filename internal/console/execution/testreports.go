@@ -0,0 +1,152 @@
+package execution
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/PonyDevAI/Bull-Board/internal/console/artifacts"
+	"github.com/PonyDevAI/Bull-Board/internal/console/dispatch"
+	"github.com/PonyDevAI/Bull-Board/internal/console/execution_backends"
+	"github.com/PonyDevAI/Bull-Board/internal/console/testreports"
+	"github.com/PonyDevAI/Bull-Board/internal/console/workflows"
+)
+
+// TestReportKind is the artifact kind parsed as a test report (go test -json,
+// JUnit XML or TAP) when recorded. Metadata "format" names the format; without
+// it the format is detected from the content.
+const TestReportKind = "test_report"
+
+// maxStepFailures bounds the failing tests returned with a step's test summary.
+const maxStepFailures = 100
+
+// TestTotals is the test outcome of a step run kept in
+// step_runs.test_totals_json, summed over the reports of its latest job.
+type TestTotals struct {
+	JobID   string `json:"job_id"`
+	Reports int    `json:"reports"`
+	testreports.Totals
+	Failing int `json:"failing"`
+}
+
+// recordTestReport parses a stored test report artifact and records its
+// cases. Reports that cannot be parsed stay plain artifacts.
+func (s *Service) recordTestReport(a artifacts.Artifact) {
+	if a.Kind != TestReportKind || a.SHA256 == "" {
+		return
+	}
+	_, rep, err := s.artifacts.ParseTestReport(a.ID)
+	if err != nil {
+		slog.Warn("execution: parse test report", "artifact_id", a.ID, "err", err)
+		return
+	}
+	if _, err := s.tests.Record(a.JobID, a.StepRunID, a.ID, rep); err != nil {
+		slog.Warn("execution: store test report", "artifact_id", a.ID, "err", err)
+		return
+	}
+	if a.StepRunID == "" {
+		return
+	}
+	summary, err := s.tests.StepSummary(a.StepRunID, 0)
+	if err != nil {
+		return
+	}
+	totalsJSON, err := json.Marshal(TestTotals{JobID: summary.JobID, Reports: summary.Reports, Totals: summary.Totals, Failing: summary.Totals.Failing()})
+	if err != nil {
+		return
+	}
+	if _, err := s.db.Exec(`UPDATE step_runs SET test_totals_json = ? WHERE id = ?`, string(totalsJSON), a.StepRunID); err != nil {
+		slog.Warn("execution: store test totals", "step_run_id", a.StepRunID, "err", err)
+	}
+}
+
+// Tests returns the test report service.
+func (s *Service) Tests() *testreports.Service { return s.tests }
+
+// StepTests returns a step run's test totals, reports and failing tests.
+func (s *Service) StepTests(stepRunID string) (testreports.StepSummary, error) {
+	var exists int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM step_runs WHERE id = ?`, stepRunID).Scan(&exists); err != nil {
+		return testreports.StepSummary{}, err
+	}
+	if exists == 0 {
+		return testreports.StepSummary{}, workflows.ErrStepRunNotFound
+	}
+	return s.tests.StepSummary(stepRunID, maxStepFailures)
+}
+
+// applyTestConditions checks a succeeding job against the test_conditions of
+// its step template, e.g. ["failing == 0", "reports > 0"]. Conditions are
+// evaluated over the test reports the job recorded; when one does not hold,
+// or a condition cannot be parsed, the result is turned into a failure that
+// names the unmet conditions. Only the template config counts, so step run
+// input cannot waive a gate.
+func (s *Service) applyTestConditions(jobID string, result *execution_backends.Result) (bool, error) {
+	exprs, err := s.testConditions(jobID)
+	if err != nil || len(exprs) == 0 {
+		return true, err
+	}
+	totals, reports, err := s.tests.JobTotals(jobID)
+	if err != nil {
+		return false, err
+	}
+	check := map[string]any{"conditions": exprs, "reports": reports, "totals": totals}
+	var unmet []string
+	conds, err := testreports.ParseConditions(exprs)
+	if err != nil {
+		unmet = append(unmet, err.Error())
+	}
+	for _, c := range conds {
+		if !c.Holds(totals, reports) {
+			unmet = append(unmet, c.String())
+		}
+	}
+	check["unmet"] = unmet
+	out, ok := result.Output.(map[string]any)
+	if !ok {
+		out = map[string]any{}
+		if result.Output != nil {
+			out["output"] = result.Output
+		}
+	}
+	out["test_conditions"] = check
+	result.Output = out
+	if len(unmet) == 0 {
+		return true, nil
+	}
+	result.Status = "failed"
+	out["error"] = "test conditions not met: " + strings.Join(unmet, ", ")
+	out["phase"] = "test_conditions"
+	return false, nil
+}
+
+// testConditions reads test_conditions from the step template config the
+// job was dispatched with.
+func (s *Service) testConditions(jobID string) ([]string, error) {
+	var requestJSON string
+	if err := s.db.QueryRow(`SELECT request_json FROM jobs WHERE id = ?`, jobID).Scan(&requestJSON); err != nil {
+		return nil, err
+	}
+	var prepared dispatch.PreparedDispatchRequest
+	if err := json.Unmarshal([]byte(requestJSON), &prepared); err != nil {
+		return nil, fmt.Errorf("decode job request: %w", err)
+	}
+	cfg, _ := prepared.Step["config"].(map[string]any)
+	var raw []any
+	switch v := cfg["test_conditions"].(type) {
+	case []any:
+		raw = v
+	case string:
+		raw = []any{v}
+	}
+	exprs := make([]string, 0, len(raw))
+	for _, v := range raw {
+		if e, ok := v.(string); ok {
+			exprs = append(exprs, e)
+		} else {
+			exprs = append(exprs, fmt.Sprint(v))
+		}
+	}
+	return exprs, nil
+}
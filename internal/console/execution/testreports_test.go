@@ -0,0 +1,64 @@
+package execution
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/PonyDevAI/Bull-Board/internal/console/execution_backends"
+)
+
+func TestTestConditionsFailStepOnFailingReport(t *testing.T) {
+	db := testDB(t)
+	seedExecutionStack(t, db)
+	seedWorker(t, db, "worker-exec", "planner")
+	_, stepID := seedWorkflowRun(t, db)
+	if _, err := db.Exec(`UPDATE workflow_step_templates SET config_json = '{"test_conditions":["failing == 0","reports > 0"]}' WHERE id = 'tpl-dispatch-step'`); err != nil {
+		t.Fatal(err)
+	}
+	dataDir := t.TempDir()
+	report := filepath.Join(dataDir, "report.xml")
+	junit := `<testsuite name="api"><testcase name="ok"/><testcase name="broken"><failure message="want 1, got 2"/></testcase></testsuite>`
+	if err := os.WriteFile(report, []byte(junit), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	svc := NewService(db)
+	svc.SetDataDir(dataDir)
+	svc.Connectors().Register("openclaw", fakeConnector{result: execution_backends.Result{
+		Status:    "succeeded",
+		Output:    map[string]any{"summary": "ok"},
+		Artifacts: []execution_backends.Artifact{{Kind: TestReportKind, URI: "file://" + report}},
+	}, roots: []string{dataDir}})
+	res, err := svc.DispatchStepRun(context.Background(), stepID)
+	if err != nil {
+		t.Fatalf("dispatch: %v", err)
+	}
+	svc.Wait()
+
+	assertStepStatus(t, db, stepID, "failed")
+	var jobStatus, resultJSON string
+	if err := db.QueryRow(`SELECT status, result_json FROM jobs WHERE id = ?`, res.JobID).Scan(&jobStatus, &resultJSON); err != nil {
+		t.Fatal(err)
+	}
+	if jobStatus != "failed" || !strings.Contains(resultJSON, "test conditions not met: failing == 0") {
+		t.Fatalf("job %s result %s", jobStatus, resultJSON)
+	}
+
+	summary, err := svc.StepTests(stepID)
+	if err != nil {
+		t.Fatalf("step tests: %v", err)
+	}
+	if summary.JobID != res.JobID || summary.Reports != 1 || summary.Totals.Total != 2 || summary.Totals.Failed != 1 {
+		t.Fatalf("unexpected summary %+v", summary)
+	}
+	if len(summary.Failures) != 1 || summary.Failures[0].Name != "broken" || summary.Failures[0].Message != "want 1, got 2" {
+		t.Fatalf("unexpected failures %+v", summary.Failures)
+	}
+	var totalsJSON string
+	if err := db.QueryRow(`SELECT test_totals_json FROM step_runs WHERE id = ?`, stepID).Scan(&totalsJSON); err != nil || !strings.Contains(totalsJSON, `"failing":1`) {
+		t.Fatalf("step totals %s, %v", totalsJSON, err)
+	}
+}
@@ -0,0 +1,310 @@
+// Package agent implements the built-in "agent" execution backend: a
+// tool-calling loop in which the step's model proposes tool calls, the
+// console runs them against the workflow run's worktree and feeds the
+// results back until the model answers without calling a tool.
+package agent
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/PonyDevAI/Bull-Board/internal/console/execution_backends"
+	"github.com/PonyDevAI/Bull-Board/internal/console/execution_backends/llm"
+	"github.com/PonyDevAI/Bull-Board/internal/console/execution_backends/local"
+	"github.com/PonyDevAI/Bull-Board/internal/console/models"
+	"github.com/PonyDevAI/Bull-Board/internal/console/protection"
+	"github.com/PonyDevAI/Bull-Board/internal/console/toolpolicy"
+	"github.com/PonyDevAI/Bull-Board/pkg/patches"
+	"github.com/PonyDevAI/Bull-Board/pkg/sandbox"
+)
+
+const (
+	ConnectorCode = "agent"
+	// DefaultMaxTurns bounds model round trips when the step config sets no max_turns.
+	DefaultMaxTurns = 30
+)
+
+// Connector runs agent loops. Worktrees and sandboxed commands come from the
+// local backend; the model comes from the llm backend's resolution; extra
+// tools come from the MCP servers attached to the agent app.
+type Connector struct {
+	db        *sql.DB
+	worktrees *local.Connector
+	models    *llm.Connector
+	tools     []Tool
+}
+
+func NewConnector(db *sql.DB, worktrees *local.Connector) *Connector {
+	return &Connector{db: db, worktrees: worktrees, models: llm.NewConnector(db), tools: BuiltinTools()}
+}
+
+// Health checks the worktree host and the model endpoint.
+func (c *Connector) Health(ctx context.Context, b execution_backends.Backend) error {
+	if err := c.worktrees.Health(ctx, b); err != nil {
+		return err
+	}
+	return c.models.Health(ctx, b)
+}
+
+// ArtifactRoots returns the job directory and worktree the agent writes its
+// artifacts to, which are the local backend's.
+func (c *Connector) ArtifactRoots(req execution_backends.Request) []string {
+	return c.worktrees.ArtifactRoots(req)
+}
+
+// run is the state of one agent loop.
+type run struct {
+	req     execution_backends.Request
+	env     *Env
+	trace   *trace
+	policy  *toolpolicy.Enforcer
+	tools   map[string]Tool
+	usage   models.Usage
+	turns   int
+	content string
+	// repair is the report of the patch the run's previous step could not
+	// apply, handed to the model with the step input.
+	repair string
+}
+
+func (r *run) logf(format string, args ...any) {
+	if r.req.Logs != nil {
+		r.req.Logs("stdout", fmt.Sprintf(format, args...))
+	}
+}
+
+func (c *Connector) Execute(ctx context.Context, req execution_backends.Request) (execution_backends.Result, error) {
+	m, err := c.models.Model(req)
+	if err != nil {
+		return execution_backends.Result{}, err
+	}
+	stepConfig, _ := req.Step["config"].(map[string]any)
+	sb, err := sandbox.FromStepConfig(stepConfig)
+	if err != nil {
+		return execution_backends.Result{}, err
+	}
+	policy := toolpolicy.Resolved{}
+	if req.ToolPolicy != nil {
+		policy = *req.ToolPolicy
+	}
+	if policy.NetworkDisabled() {
+		off := false
+		sb.Network = &off
+	}
+	worktree, branch, err := c.worktrees.Worktree(ctx, req)
+	if err != nil {
+		return execution_backends.Result{}, err
+	}
+	jobDir, err := c.worktrees.JobDir(req.JobID)
+	if err != nil {
+		return execution_backends.Result{}, err
+	}
+	shell, err := sandbox.NewShell(req.JobID, req.WorkflowRunID, req.StepRunID, sb)
+	if err != nil {
+		return execution_backends.Result{}, err
+	}
+	defer shell.Close()
+	stopGuard, err := c.worktrees.GuardShell(shell, req, ConnectorCode, worktree)
+	if err != nil {
+		return execution_backends.Result{}, err
+	}
+	defer stopGuard()
+	since := protection.Now()
+	plugins, pluginTools, err := c.startPlugins(ctx, req, worktree, policy)
+	if err != nil {
+		return execution_backends.Result{}, err
+	}
+	defer plugins.close()
+
+	r := &run{
+		req:    req,
+		env:    &Env{Worktree: worktree, Shell: shell},
+		trace:  &trace{db: c.db, jobID: req.JobID, stepRunID: req.StepRunID},
+		policy: toolpolicy.NewEnforcer(policy),
+		tools:  map[string]Tool{},
+		repair: c.unappliedPatch(req),
+	}
+	tools := append(append([]Tool{}, c.tools...), pluginTools...)
+	defs := make([]models.Tool, 0, len(tools))
+	for _, t := range tools {
+		r.tools[t.Name] = t
+		defs = append(defs, t.definition())
+	}
+	if len(plugins.clients) > 0 {
+		r.logf("plugins: %s (%d tools)\n", strings.Join(plugins.codes(), ", "), len(pluginTools))
+	}
+	finish, loopErr := r.loop(ctx, m, defs, maxTurns(stepConfig))
+
+	output := map[string]any{
+		"content":          r.content,
+		"finish_reason":    finish,
+		"turns":            r.turns,
+		"tool_calls":       len(r.trace.entries),
+		"plugins":          plugins.codes(),
+		"usage":            r.usage,
+		"model_profile_id": m.Profile.ID,
+		"provider":         m.Provider.Code(),
+		"branch":           branch,
+		"worktree_path":    worktree,
+	}
+	result := execution_backends.Result{Status: "succeeded", Output: output, Response: map[string]any{"runtime": ConnectorCode}}
+	if loopErr != nil {
+		result.Status = "failed"
+		output["error"] = loopErr.Error()
+		r.logf("!! agent failed: %v\n", loopErr)
+	}
+	// Stage everything so the diff covers new files; the run's next step commits.
+	diff := ""
+	if _, _, err := gitOutput(ctx, worktree, "add", "-A"); err == nil {
+		diff, _, _ = gitOutput(ctx, worktree, "diff", "--cached", "HEAD")
+	}
+	head, _, _ := gitOutput(ctx, worktree, "rev-parse", "HEAD")
+	output["head"] = strings.TrimSpace(head)
+	c.worktrees.RecordHead(req.WorkflowRunID, output["head"].(string))
+
+	files := []struct {
+		kind, name string
+		data       []byte
+	}{
+		{"diff", "diff.patch", []byte(diff)},
+		{"trace", "trace.jsonl", r.trace.jsonl()},
+	}
+	for _, f := range files {
+		path := filepath.Join(jobDir, f.name)
+		if err := os.WriteFile(path, f.data, 0644); err != nil {
+			return execution_backends.Result{}, err
+		}
+		result.Artifacts = append(result.Artifacts, execution_backends.Artifact{
+			Kind:     f.kind,
+			URI:      "file://" + path,
+			Metadata: map[string]any{"source": ConnectorCode, "size": len(f.data)},
+		})
+	}
+	// A command the model ran that was stopped by a branch protection hook
+	// parks the step until the operation is approved.
+	if held := c.worktrees.Held(req, since); held != nil {
+		parked, err := protection.StepResult(held, output)
+		if err != nil {
+			return execution_backends.Result{}, err
+		}
+		parked.Response, parked.Artifacts = result.Response, result.Artifacts
+		return parked, nil
+	}
+	return result, nil
+}
+
+// unappliedPatch returns the report of the patch the run's latest finished
+// step failed to apply (a local step with on_conflict "continue"), or "".
+func (c *Connector) unappliedPatch(req execution_backends.Request) string {
+	if c.db == nil || req.WorkflowRunID == "" {
+		return ""
+	}
+	var raw string
+	err := c.db.QueryRow(`SELECT output_json FROM step_runs WHERE workflow_run_id = ? AND id != ? AND finished_at IS NOT NULL
+		ORDER BY finished_at DESC, updated_at DESC LIMIT 1`, req.WorkflowRunID, req.StepRunID).Scan(&raw)
+	if err != nil {
+		return ""
+	}
+	var out struct {
+		Patch *patches.Report `json:"patch"`
+	}
+	if json.Unmarshal([]byte(raw), &out) != nil || out.Patch == nil || out.Patch.Applied {
+		return ""
+	}
+	return out.Patch.Text()
+}
+
+// loop alternates model turns and tool calls until the model stops calling
+// tools, returning the final finish reason.
+func (r *run) loop(ctx context.Context, m llm.Model, defs []models.Tool, limit int) (string, error) {
+	messages := llm.BuildMessages(r.req.Step, r.req.Input)
+	if r.repair != "" {
+		r.logf("previous step left a patch that did not apply; passing its report to the model\n")
+		messages = append(messages, models.Message{Role: "user", Content: "The previous step's patch did not apply to the worktree. " +
+			"Apply its intended change by hand, resolving the conflicts below against the current files.\n\n" + r.repair})
+	}
+	for r.turns < limit {
+		r.turns++
+		chat := m.Profile.Request(m.SystemPrompt, messages)
+		chat.Tools = defs
+		resp, err := m.Provider.Chat(ctx, m.Settings, chat)
+		if err != nil {
+			return "", err
+		}
+		r.usage.InputTokens += resp.Usage.InputTokens
+		r.usage.OutputTokens += resp.Usage.OutputTokens
+		r.usage.TotalTokens += resp.Usage.TotalTokens
+		messages = append(messages, resp.Message)
+		if resp.Message.Content != "" {
+			r.content = resp.Message.Content
+			r.logf("%s\n", resp.Message.Content)
+		}
+		if len(resp.Message.ToolCalls) == 0 {
+			return resp.FinishReason, nil
+		}
+		for _, call := range resp.Message.ToolCalls {
+			messages = append(messages, models.Message{Role: "tool", ToolCallID: call.ID, Content: r.invoke(ctx, call)})
+		}
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+	}
+	return models.FinishLength, fmt.Errorf("agent stopped after %d turns without a final answer", limit)
+}
+
+// invoke checks one tool call against the tool policy, runs it, records it
+// in the trace and returns the text for the model. Denials and tool failures
+// are reported to the model, not the job.
+func (r *run) invoke(ctx context.Context, call models.ToolCall) string {
+	started := time.Now()
+	args := json.RawMessage(call.Arguments)
+	entry := TraceEntry{Turn: r.turns, CallID: call.ID, Tool: call.Name, Input: args, StartedAt: now(), Status: TraceOK}
+	r.logf("→ %s %s\n", call.Name, call.Arguments)
+	tool, ok := r.tools[call.Name]
+	inv := toolpolicy.Invocation{Tool: call.Name}
+	if ok {
+		inv = tool.invocation(args)
+	}
+	var output string
+	var err error
+	if decision := r.policy.Check(inv); !decision.Allowed {
+		entry.Status = TraceDenied
+		entry.Rule = decision.Rule
+		err = fmt.Errorf("denied by tool policy rule %s: %s", decision.Rule, decision.Reason)
+	} else if !ok {
+		err = fmt.Errorf("unknown tool %q", call.Name)
+	} else {
+		output, err = tool.Run(ctx, r.env, args)
+	}
+	output = truncate(output)
+	entry.Output = output
+	entry.DurationMS = time.Since(started).Milliseconds()
+	if err != nil {
+		if entry.Status == TraceOK {
+			entry.Status = TraceError
+		}
+		entry.Error = err.Error()
+		output = "error: " + err.Error()
+	}
+	if _, recErr := r.trace.record(entry); recErr != nil {
+		r.logf("!! trace %s: %v\n", call.Name, recErr)
+	}
+	if entry.Status == TraceDenied {
+		r.logf("!! %s %s\n", call.Name, entry.Error)
+	}
+	r.logf("← %s %s (%d ms)\n", call.Name, entry.Status, entry.DurationMS)
+	return output
+}
+
+func maxTurns(cfg map[string]any) int {
+	if n, ok := cfg["max_turns"].(float64); ok && n > 0 {
+		return int(n)
+	}
+	return DefaultMaxTurns
+}
@@ -0,0 +1,411 @@
+package agent
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/PonyDevAI/Bull-Board/internal/common"
+	"github.com/PonyDevAI/Bull-Board/internal/console/execution_backends"
+	"github.com/PonyDevAI/Bull-Board/internal/console/execution_backends/local"
+	"github.com/PonyDevAI/Bull-Board/internal/console/toolpolicy"
+)
+
+// fakeModel answers /v1/chat/completions with scripted assistant turns and
+// records the messages of each request.
+type fakeModel struct {
+	*httptest.Server
+	mu       sync.Mutex
+	turns    []map[string]any
+	requests [][]map[string]any
+}
+
+func newFakeModel(t *testing.T, turns ...map[string]any) *fakeModel {
+	f := &fakeModel{turns: turns}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Messages []map[string]any `json:"messages"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		f.mu.Lock()
+		f.requests = append(f.requests, body.Messages)
+		next := map[string]any{"role": "assistant", "content": "still working"}
+		if len(f.turns) > 0 {
+			next, f.turns = f.turns[0], f.turns[1:]
+		}
+		f.mu.Unlock()
+		finish := "stop"
+		if _, ok := next["tool_calls"]; ok {
+			finish = "tool_calls"
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"id":      "chatcmpl-agent",
+			"model":   "gpt-test",
+			"choices": []any{map[string]any{"message": next, "finish_reason": finish}},
+			"usage":   map[string]any{"prompt_tokens": 10, "completion_tokens": 2, "total_tokens": 12},
+		})
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+// toolTurn is an assistant turn calling the given tools; args are JSON objects.
+func toolTurn(calls ...[2]string) map[string]any {
+	var out []any
+	for i, c := range calls {
+		out = append(out, map[string]any{"id": "call_" + c[0] + string(rune('a'+i)), "type": "function", "function": map[string]any{"name": c[0], "arguments": c[1]}})
+	}
+	return map[string]any{"role": "assistant", "content": "", "tool_calls": out}
+}
+
+func answer(content string) map[string]any {
+	return map[string]any{"role": "assistant", "content": content}
+}
+
+func testDB(t *testing.T, baseURL string) *sql.DB {
+	t.Helper()
+	t.Setenv("SQLITE_PATH", filepath.Join(t.TempDir(), "bb.sqlite"))
+	db, _, err := common.OpenDB("")
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	for _, stmt := range []string{
+		`INSERT INTO model_profiles (id, home_id, name, provider, model_name, temperature, reasoning_level) VALUES ('model-agent','default','Coder','openai_compatible','gpt-test',0,'standard')`,
+		`INSERT INTO agent_apps (id, home_id, name, default_model_profile_id, system_prompt) VALUES ('app-agent','default','Coder','model-agent','You are a careful coder.')`,
+		`INSERT INTO integration_instances (id, home_id, connector_code, name, endpoint) VALUES ('int-agent','default','openai_compatible','Fake','` + baseURL + `/v1')`,
+		`INSERT INTO jobs (id, step_run_id, status, created_at) VALUES ('job-1','step-run-1','running','2026-01-01T00:00:00Z')`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+	}
+	return db
+}
+
+func testRepo(t *testing.T) string {
+	t.Helper()
+	repo := t.TempDir()
+	for _, args := range [][]string{{"init", "-b", "main"}, {"add", "-A"}, {"-c", "user.name=t", "-c", "user.email=t@t", "commit", "-m", "init"}} {
+		if args[0] == "add" {
+			if err := os.WriteFile(filepath.Join(repo, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repo
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+	return repo
+}
+
+func testRequest(repo string) execution_backends.Request {
+	return execution_backends.Request{
+		JobID:         "job-1",
+		WorkflowRunID: "run-1",
+		StepRunID:     "step-run-1",
+		Worker:        map[string]any{"agent_app_id": "app-agent"},
+		Step:          map[string]any{"name": "Implement", "config": map[string]any{"prompt": "Add a greeting."}},
+		Workspace:     map[string]any{"repo_path": repo, "default_branch": "main"},
+		Input:         map[string]any{},
+		Backend:       execution_backends.Backend{ID: "backend-agent", ConnectorCode: ConnectorCode, IntegrationInstanceID: "int-agent"},
+	}
+}
+
+func TestExecuteRunsToolLoopAndRecordsTrace(t *testing.T) {
+	srv := newFakeModel(t,
+		toolTurn([2]string{ToolWriteFile, `{"path":"greet/hello.txt","content":"hello\n"}`}, [2]string{ToolRunCommand, `{"command":"cat greet/hello.txt && exit 3"}`}),
+		toolTurn([2]string{ToolReadFile, `{"path":"../outside.txt"}`}, [2]string{ToolGitStatus, `{}`}),
+		answer("Added greet/hello.txt."),
+	)
+	db := testDB(t, srv.URL)
+	c := NewConnector(db, local.NewConnector(t.TempDir()))
+	req := testRequest(testRepo(t))
+	var logged strings.Builder
+	req.Logs = func(stream, content string) { logged.WriteString(content) }
+
+	res, err := c.Execute(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	output := res.Output.(map[string]any)
+	if res.Status != "succeeded" || output["content"] != "Added greet/hello.txt." || output["turns"] != 3 || output["tool_calls"] != 4 {
+		t.Fatalf("unexpected result %s %v", res.Status, output)
+	}
+	if !strings.Contains(logged.String(), "→ write_file") {
+		t.Fatalf("expected tool calls in log, got %q", logged.String())
+	}
+
+	// Tool results were fed back: the command's output and exit code, and the rejected path as an error.
+	second := srv.requests[1]
+	if len(second) != 5 || second[0]["role"] != "system" || second[1]["content"] != "Add a greeting." {
+		t.Fatalf("unexpected second request %v", second)
+	}
+	if got := second[4]["content"].(string); !strings.Contains(got, "exit code: 3") || !strings.Contains(got, "hello") {
+		t.Fatalf("expected command result, got %q", got)
+	}
+	third := srv.requests[2]
+	if got := third[6]["content"].(string); !strings.HasPrefix(got, "error: ") || !strings.Contains(got, "outside worktree") {
+		t.Fatalf("expected path error for the model, got %q", got)
+	}
+	if got := third[7]["content"].(string); !strings.Contains(got, "bb/run-run-1") || !strings.Contains(got, "greet/") {
+		t.Fatalf("expected git status, got %q", got)
+	}
+
+	items, err := ListToolCalls(db, "step-run-1")
+	if err != nil || len(items) != 4 {
+		t.Fatalf("ListToolCalls = %v, %v", items, err)
+	}
+	if items[0]["tool"] != ToolWriteFile || items[0]["status"] != TraceOK || items[0]["turn"] != 1 || items[0]["call_id"] != "call_write_filea" {
+		t.Fatalf("unexpected first trace entry %v", items[0])
+	}
+	if items[2]["status"] != TraceError || items[2]["seq"] != 3 || !strings.Contains(items[2]["error"].(string), "outside worktree") {
+		t.Fatalf("unexpected error trace entry %v", items[2])
+	}
+	var input map[string]any
+	if err := json.Unmarshal(items[1]["input"].(json.RawMessage), &input); err != nil || input["command"] != "cat greet/hello.txt && exit 3" {
+		t.Fatalf("unexpected recorded input %s", items[1]["input"])
+	}
+
+	kinds := map[string]string{}
+	for _, a := range res.Artifacts {
+		data, _ := os.ReadFile(strings.TrimPrefix(a.URI, "file://"))
+		kinds[a.Kind] = string(data)
+	}
+	if !strings.Contains(kinds["diff"], "+hello") || strings.Count(kinds["trace"], "\n") != 4 {
+		t.Fatalf("unexpected artifacts %v", kinds)
+	}
+}
+
+func TestExecuteFailsAfterMaxTurns(t *testing.T) {
+	srv := newFakeModel(t,
+		toolTurn([2]string{ToolListFiles, `{}`}),
+		toolTurn([2]string{"delete_repo", `{}`}),
+	)
+	db := testDB(t, srv.URL)
+	req := testRequest(testRepo(t))
+	req.Step["config"].(map[string]any)["max_turns"] = float64(2)
+
+	res, err := NewConnector(db, local.NewConnector(t.TempDir())).Execute(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	output := res.Output.(map[string]any)
+	if res.Status != "failed" || !strings.Contains(output["error"].(string), "after 2 turns") {
+		t.Fatalf("expected max turns failure, got %s %v", res.Status, output)
+	}
+	items, _ := ListToolCalls(db, "step-run-1")
+	if len(items) != 2 || items[1]["status"] != TraceError || !strings.Contains(items[1]["error"].(string), "unknown tool") {
+		t.Fatalf("unexpected trace %v", items)
+	}
+	if !strings.Contains(srv.requests[1][3]["content"].(string), "main.go") {
+		t.Fatalf("expected file listing fed back, got %v", srv.requests[1][3])
+	}
+}
+
+func TestExecuteDeniesToolCallsOutsidePolicy(t *testing.T) {
+	srv := newFakeModel(t,
+		toolTurn([2]string{ToolRunCommand, `{"command":"go test ./... && curl example.com"}`}, [2]string{ToolWriteFile, `{"path":"notes.txt","content":"x"}`}),
+		answer("Done."),
+	)
+	db := testDB(t, srv.URL)
+	repo := testRepo(t)
+	req := testRequest(repo)
+	commands, err := toolpolicy.Parse(`{"commands":["go test *"]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolved := toolpolicy.Merge(toolpolicy.Layer{Name: toolpolicy.LayerWorker, Policy: commands})
+	req.ToolPolicy = &resolved
+
+	res, err := NewConnector(db, local.NewConnector(t.TempDir())).Execute(context.Background(), req)
+	if err != nil || res.Status != "succeeded" {
+		t.Fatalf("Execute = %s, %v", res.Status, err)
+	}
+	if got := srv.requests[1][3]["content"].(string); !strings.Contains(got, "denied by tool policy rule worker.commands") {
+		t.Fatalf("expected denial fed back, got %q", got)
+	}
+	items, _ := ListToolCalls(db, "step-run-1")
+	if len(items) != 2 || items[0]["status"] != TraceDenied || items[0]["rule"] != "worker.commands" || items[1]["status"] != TraceOK {
+		t.Fatalf("unexpected trace %v", items)
+	}
+}
+
+// newDocsPlugin serves a one-tool MCP server over HTTP.
+func TestExecuteHandsUnappliedPatchToModel(t *testing.T) {
+	srv := newFakeModel(t, answer("Resolved."))
+	db := testDB(t, srv.URL)
+	report := `{"patch":{"applied":false,"summary":"patch did not apply: 1 of 1 file(s) failed (main.go: conflict)","files":[{"path":"main.go","status":"modified","result":"conflict","reason":"conflict","conflicts":[{"start_line":3,"current":"func main() {}","base":"func main() { }","patch":"func main() { run() }"}]}]}}`
+	if _, err := db.Exec(`INSERT INTO step_runs (id, workflow_run_id, workflow_step_template_id, status, output_json, finished_at) VALUES ('step-run-0','run-1','wst-patch','completed',?,'2026-01-01T00:00:00Z')`, report); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := NewConnector(db, local.NewConnector(t.TempDir())).Execute(context.Background(), testRequest(testRepo(t)))
+	if err != nil || res.Status != "succeeded" {
+		t.Fatalf("Execute: %v %v", res.Status, err)
+	}
+	first := srv.requests[0]
+	repair, _ := first[len(first)-1]["content"].(string)
+	if !strings.Contains(repair, "did not apply") || !strings.Contains(repair, "conflict at line 3") || !strings.Contains(repair, "run()") {
+		t.Fatalf("expected the patch report in the initial messages, got %v", first)
+	}
+}
+
+// newDocsPlugin serves an HTTP MCP server whose tools (lookup by default)
+// answer with the query they were given.
+func newDocsPlugin(t *testing.T, names ...string) *httptest.Server {
+	if len(names) == 0 {
+		names = []string{"lookup"}
+	}
+	var tools []any
+	for _, name := range names {
+		tools = append(tools, map[string]any{"name": name, "description": "Search internal docs", "inputSchema": map[string]any{"type": "object", "properties": map[string]any{"query": map[string]any{"type": "string"}}}})
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var m struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+			Params struct {
+				Arguments map[string]any `json:"arguments"`
+			} `json:"params"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&m)
+		if len(m.ID) == 0 {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		var result any
+		switch m.Method {
+		case "initialize":
+			result = map[string]any{"protocolVersion": "2025-03-26", "capabilities": map[string]any{"tools": map[string]any{}}, "serverInfo": map[string]any{"name": "docs"}}
+		case "tools/list":
+			result = map[string]any{"tools": tools}
+		case "tools/call":
+			result = map[string]any{"content": []any{map[string]any{"type": "text", "text": "docs: " + m.Params.Arguments["query"].(string)}}}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"jsonrpc": "2.0", "id": m.ID, "result": result})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestExecuteExposesPluginTools(t *testing.T) {
+	plugin := newDocsPlugin(t)
+	srv := newFakeModel(t,
+		toolTurn([2]string{"docs__lookup", `{"query":"retries"}`}, [2]string{ToolSearch, `{"pattern":"main"}`}),
+		answer("Read the docs."),
+	)
+	db := testDB(t, srv.URL)
+	for _, stmt := range []string{
+		`INSERT INTO plugins (id, code, name, transport, url) VALUES ('p-docs','docs','Docs','http','` + plugin.URL + `')`,
+		`INSERT INTO agent_app_plugins (agent_app_id, plugin_id) VALUES ('app-agent','p-docs')`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+	}
+	req := testRequest(testRepo(t))
+	policy, err := toolpolicy.Parse(`{"allowed_tools":["docs__*","read_file"]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolved := toolpolicy.Merge(toolpolicy.Layer{Name: toolpolicy.LayerAgentApp, Policy: policy})
+	req.ToolPolicy = &resolved
+
+	res, err := NewConnector(db, local.NewConnector(t.TempDir())).Execute(context.Background(), req)
+	if err != nil || res.Status != "succeeded" {
+		t.Fatalf("Execute = %s, %v", res.Status, err)
+	}
+	output := res.Output.(map[string]any)
+	if plugins, _ := output["plugins"].([]string); len(plugins) != 1 || plugins[0] != "docs" {
+		t.Fatalf("unexpected plugins %v", output["plugins"])
+	}
+	if got := srv.requests[1][3]["content"]; got != "docs: retries" {
+		t.Fatalf("expected plugin result fed back, got %v", got)
+	}
+	items, _ := ListToolCalls(db, "step-run-1")
+	if len(items) != 2 || items[0]["tool"] != "docs__lookup" || items[0]["status"] != TraceOK || items[1]["rule"] != "agent_app.allowed_tools" {
+		t.Fatalf("unexpected trace %v", items)
+	}
+}
+
+func TestExecuteFailsWhenPluginCannotStart(t *testing.T) {
+	db := testDB(t, "http://127.0.0.1:1")
+	for _, stmt := range []string{
+		`INSERT INTO plugins (id, code, name, transport, command) VALUES ('p-gone','gone','Gone','stdio','/nonexistent/mcp-server')`,
+		`INSERT INTO agent_app_plugins (agent_app_id, plugin_id) VALUES ('app-agent','p-gone')`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+	}
+	_, err := NewConnector(db, local.NewConnector(t.TempDir())).Execute(context.Background(), testRequest(testRepo(t)))
+	if err == nil || !strings.Contains(err.Error(), "plugin gone") {
+		t.Fatalf("expected plugin start error, got %v", err)
+	}
+}
+
+func TestExecuteRefusesPluginsWithoutNetwork(t *testing.T) {
+	plugin := newDocsPlugin(t)
+	db := testDB(t, "http://127.0.0.1:1")
+	for _, stmt := range []string{
+		`INSERT INTO plugins (id, code, name, transport, url) VALUES ('p-docs','docs','Docs','http','` + plugin.URL + `')`,
+		`INSERT INTO agent_app_plugins (agent_app_id, plugin_id) VALUES ('app-agent','p-docs')`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+	}
+	req := testRequest(testRepo(t))
+	policy, err := toolpolicy.Parse(`{"network":false}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolved := toolpolicy.Merge(toolpolicy.Layer{Name: toolpolicy.LayerWorker, Policy: policy})
+	req.ToolPolicy = &resolved
+	_, err = NewConnector(db, local.NewConnector(t.TempDir())).Execute(context.Background(), req)
+	if err == nil || !strings.Contains(err.Error(), "plugin docs") || !strings.Contains(err.Error(), "worker.network") {
+		t.Fatalf("expected plugins refused without network, got %v", err)
+	}
+}
+
+func TestExecuteFailsOnCollidingPluginTools(t *testing.T) {
+	plugin := newDocsPlugin(t, "list.tables", "list_tables")
+	db := testDB(t, "http://127.0.0.1:1")
+	for _, stmt := range []string{
+		`INSERT INTO plugins (id, code, name, transport, url) VALUES ('p-db','db','DB','http','` + plugin.URL + `')`,
+		`INSERT INTO agent_app_plugins (agent_app_id, plugin_id) VALUES ('app-agent','p-db')`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+	}
+	_, err := NewConnector(db, local.NewConnector(t.TempDir())).Execute(context.Background(), testRequest(testRepo(t)))
+	if err == nil || !strings.Contains(err.Error(), "both exposed as db__list_tables") {
+		t.Fatalf("expected a tool name collision, got %v", err)
+	}
+}
+
+func TestPluginToolName(t *testing.T) {
+	if got := PluginToolName("db-schema", "list.tables"); got != "db-schema__list_tables" {
+		t.Fatalf("PluginToolName = %q", got)
+	}
+	long := PluginToolName("docs", strings.Repeat("x", 80))
+	if len(long) != 64 {
+		t.Fatalf("expected name capped at 64, got %d", len(long))
+	}
+	if other := PluginToolName("docs", strings.Repeat("x", 81)); other == long || len(other) != 64 {
+		t.Fatalf("expected distinct capped names, got %q and %q", long, other)
+	}
+}
@@ -0,0 +1,125 @@
+package agent
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/PonyDevAI/Bull-Board/internal/console/execution_backends"
+	"github.com/PonyDevAI/Bull-Board/internal/console/mcp"
+	"github.com/PonyDevAI/Bull-Board/internal/console/toolpolicy"
+)
+
+// maxToolName is the longest function name model providers accept.
+const maxToolName = 64
+
+var toolNameUnsafe = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+// PluginToolName is the name an MCP tool is exposed under: the plugin code
+// and the tool name joined by "__", so plugin tools never shadow built-ins.
+// A name over the limit keeps its head and ends in a hash of the full name,
+// so tools sharing a long prefix stay distinct.
+func PluginToolName(pluginCode, tool string) string {
+	name := toolNameUnsafe.ReplaceAllString(pluginCode, "_") + "__" + toolNameUnsafe.ReplaceAllString(tool, "_")
+	if len(name) > maxToolName {
+		sum := sha256.Sum256([]byte(pluginCode + "\x00" + tool))
+		suffix := "_" + hex.EncodeToString(sum[:4])
+		name = name[:maxToolName-len(suffix)] + suffix
+	}
+	return name
+}
+
+// plugins holds the MCP sessions of one agent run.
+type plugins struct {
+	clients []*mcp.Client
+}
+
+// startPlugins connects to every MCP server attached to the worker's agent
+// app; stdio servers run in the worktree. Plugins run outside the sandbox,
+// so none is started when the tool policy disables network access. Two
+// tools exposed under the same name fail the job. On error the servers
+// already started are stopped.
+func (c *Connector) startPlugins(ctx context.Context, req execution_backends.Request, worktree string, policy toolpolicy.Resolved) (*plugins, []Tool, error) {
+	agentAppID, _ := req.Worker["agent_app_id"].(string)
+	servers, err := mcp.LoadServers(c.db, agentAppID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(servers) > 0 && policy.NetworkDisabled() {
+		return nil, nil, fmt.Errorf("plugin %s: plugins run outside the sandbox, so they cannot start while the %s.network rule disables network", servers[0].Code, policy.Sources["network"])
+	}
+	p := &plugins{}
+	var tools []Tool
+	exposed := map[string]string{}
+	for _, s := range servers {
+		s.Dir = worktree
+		client, err := mcp.Connect(ctx, s)
+		if err != nil {
+			p.close()
+			return nil, nil, fmt.Errorf("plugin %s: %w", s.Code, err)
+		}
+		p.clients = append(p.clients, client)
+		list, err := client.ListTools(ctx)
+		if err != nil {
+			p.close()
+			return nil, nil, fmt.Errorf("plugin %s: list tools: %w", s.Code, err)
+		}
+		for _, t := range list {
+			tool := pluginTool(client, t)
+			if prev, ok := exposed[tool.Name]; ok {
+				p.close()
+				return nil, nil, fmt.Errorf("plugin %s: tool %q and %s are both exposed as %s", s.Code, t.Name, prev, tool.Name)
+			}
+			exposed[tool.Name] = fmt.Sprintf("%q of plugin %s", t.Name, s.Code)
+			tools = append(tools, tool)
+		}
+	}
+	return p, tools, nil
+}
+
+func (p *plugins) codes() []string {
+	out := []string{}
+	for _, c := range p.clients {
+		out = append(out, c.Server.Code)
+	}
+	return out
+}
+
+// close shuts every server down.
+func (p *plugins) close() {
+	for _, c := range p.clients {
+		_ = c.Close()
+	}
+}
+
+// pluginTool wraps an MCP tool. Plugin tools run outside the worktree
+// sandbox, so the tool policy checks them by name only.
+func pluginTool(client *mcp.Client, t mcp.Tool) Tool {
+	params := t.InputSchema
+	if params == nil {
+		params = schema(map[string]any{})
+	}
+	desc := t.Description
+	if desc == "" {
+		desc = fmt.Sprintf("Tool %s of plugin %s.", t.Name, client.Server.Name)
+	}
+	return Tool{
+		Name:        PluginToolName(client.Server.Code, t.Name),
+		Description: desc,
+		Parameters:  params,
+		Run: func(ctx context.Context, _ *Env, args json.RawMessage) (string, error) {
+			res, err := client.CallTool(ctx, t.Name, args)
+			if err != nil {
+				return "", err
+			}
+			if res.IsError {
+				return "", errors.New(res.Text())
+			}
+			return res.Text(), nil
+		},
+	}
+}
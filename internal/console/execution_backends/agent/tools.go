@@ -0,0 +1,514 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/PonyDevAI/Bull-Board/internal/console/models"
+	"github.com/PonyDevAI/Bull-Board/internal/console/toolpolicy"
+	"github.com/PonyDevAI/Bull-Board/pkg/patches"
+	"github.com/PonyDevAI/Bull-Board/pkg/sandbox"
+)
+
+var ErrPathOutsideWorktree = errors.New("path outside worktree")
+
+// Limits on what a tool hands back to the model.
+const (
+	maxToolOutput = 32 * 1024
+	maxListItems  = 1000
+	maxSearchHits = 200
+)
+
+// Env is what tools act on: the run's worktree and the job's sandboxed shell.
+type Env struct {
+	Worktree string
+	Shell    *sandbox.Shell
+}
+
+// Tool is one function exposed to the model. Run gets the call's JSON
+// arguments and returns the text fed back to the model. Describe tells the
+// tool policy what a call would touch before it runs.
+type Tool struct {
+	Name        string
+	Description string
+	Parameters  map[string]any
+	Run         func(ctx context.Context, env *Env, args json.RawMessage) (string, error)
+	Describe    func(args json.RawMessage) toolpolicy.Invocation
+}
+
+// invocation classifies a call for the policy; tools without Describe are
+// checked by name only.
+func (t Tool) invocation(args json.RawMessage) toolpolicy.Invocation {
+	if t.Describe == nil {
+		return toolpolicy.Invocation{Tool: t.Name}
+	}
+	inv := t.Describe(args)
+	inv.Tool = t.Name
+	return inv
+}
+
+func (t Tool) definition() models.Tool {
+	return models.Tool{Name: t.Name, Description: t.Description, Parameters: t.Parameters}
+}
+
+// Built-in tool names.
+const (
+	ToolListFiles  = "list_files"
+	ToolReadFile   = "read_file"
+	ToolWriteFile  = "write_file"
+	ToolSearch     = "search"
+	ToolApplyPatch = "apply_patch"
+	ToolRunCommand = "run_command"
+	ToolGitDiff    = "git_diff"
+	ToolGitStatus  = "git_status"
+)
+
+// BuiltinTools returns the repo tools every agent run starts with.
+func BuiltinTools() []Tool {
+	return []Tool{
+		{
+			Name:        ToolListFiles,
+			Description: "List files under a directory of the repository (default: the root). Set recursive to walk subdirectories.",
+			Parameters:  schema(map[string]any{"path": str("Directory relative to the repository root"), "recursive": map[string]any{"type": "boolean"}}),
+			Run:         listFiles,
+			Describe:    describePath("path", ".", false),
+		},
+		{
+			Name:        ToolReadFile,
+			Description: "Read a text file. start_line and max_lines select a range of lines (1-based).",
+			Parameters:  schema(map[string]any{"path": str("File path relative to the repository root"), "start_line": integer(), "max_lines": integer()}, "path"),
+			Run:         readFile,
+			Describe:    describePath("path", "", false),
+		},
+		{
+			Name:        ToolWriteFile,
+			Description: "Create or overwrite a file with the given content.",
+			Parameters:  schema(map[string]any{"path": str("File path relative to the repository root"), "content": str("Full new file content")}, "path", "content"),
+			Run:         writeFile,
+			Describe:    describePath("path", "", true),
+		},
+		{
+			Name:        ToolSearch,
+			Description: "Search tracked and untracked files for an extended regular expression; returns path:line:text matches.",
+			Parameters:  schema(map[string]any{"pattern": str("Extended regular expression"), "path": str("Limit the search to this path")}, "pattern"),
+			Run:         search,
+			Describe:    describePath("path", ".", false),
+		},
+		{
+			Name:        ToolApplyPatch,
+			Description: "Apply a unified diff (git apply format) to the working tree, falling back to a 3-way merge. A failed apply changes nothing and reports the failing hunks and conflicts.",
+			Parameters:  schema(map[string]any{"patch": str("Unified diff")}, "patch"),
+			Run:         applyPatch,
+			Describe:    describePatch,
+		},
+		{
+			Name:        ToolRunCommand,
+			Description: "Run a shell command in the repository root inside the job sandbox; returns its output and exit code.",
+			Parameters:  schema(map[string]any{"command": str("Shell command")}, "command"),
+			Run:         runCommand,
+			Describe:    describeCommand,
+		},
+		{
+			Name:        ToolGitDiff,
+			Description: "Show uncommitted changes as a unified diff, optionally for one path.",
+			Parameters:  schema(map[string]any{"path": str("Limit the diff to this path")}),
+			Run:         gitDiff,
+			Describe:    describeGit("diff"),
+		},
+		{
+			Name:        ToolGitStatus,
+			Description: "Show the branch and changed files (git status --short).",
+			Parameters:  schema(map[string]any{}),
+			Run:         gitStatus,
+			Describe:    describeGit("status"),
+		},
+	}
+}
+
+// describePath reports the path argument key (or def when empty) as read or written.
+func describePath(key, def string, write bool) func(json.RawMessage) toolpolicy.Invocation {
+	return func(raw json.RawMessage) toolpolicy.Invocation {
+		args := map[string]any{}
+		_ = json.Unmarshal(raw, &args)
+		p, _ := args[key].(string)
+		if p == "" {
+			p = def
+		}
+		inv := toolpolicy.Invocation{Write: write}
+		if p != "" {
+			inv.Paths = []string{p}
+		}
+		return inv
+	}
+}
+
+func describePatch(raw json.RawMessage) toolpolicy.Invocation {
+	var args struct {
+		Patch string `json:"patch"`
+	}
+	_ = json.Unmarshal(raw, &args)
+	return toolpolicy.Invocation{Paths: PatchPaths(args.Patch), Write: true, Git: []string{"apply"}}
+}
+
+func describeCommand(raw json.RawMessage) toolpolicy.Invocation {
+	var args struct {
+		Command string `json:"command"`
+	}
+	_ = json.Unmarshal(raw, &args)
+	return toolpolicy.Invocation{Command: args.Command}
+}
+
+func describeGit(sub string) func(json.RawMessage) toolpolicy.Invocation {
+	return func(raw json.RawMessage) toolpolicy.Invocation {
+		inv := describePath("path", "", false)(raw)
+		inv.Git = []string{sub}
+		return inv
+	}
+}
+
+// PatchPaths lists the files a unified diff touches, old and new names alike.
+func PatchPaths(patch string) []string {
+	seen := map[string]bool{}
+	var out []string
+	add := func(p string) {
+		p = strings.TrimSpace(p)
+		if i := strings.IndexByte(p, '\t'); i >= 0 {
+			p = p[:i]
+		}
+		if p == "" || p == "/dev/null" {
+			return
+		}
+		if strings.HasPrefix(p, "a/") || strings.HasPrefix(p, "b/") {
+			p = p[2:]
+		}
+		if !seen[p] {
+			seen[p] = true
+			out = append(out, p)
+		}
+	}
+	for _, line := range strings.Split(patch, "\n") {
+		switch {
+		case strings.HasPrefix(line, "--- "), strings.HasPrefix(line, "+++ "):
+			add(line[4:])
+		case strings.HasPrefix(line, "rename from "):
+			add(strings.TrimPrefix(line, "rename from "))
+		case strings.HasPrefix(line, "rename to "):
+			add(strings.TrimPrefix(line, "rename to "))
+		}
+	}
+	return out
+}
+
+func schema(props map[string]any, required ...string) map[string]any {
+	s := map[string]any{"type": "object", "properties": props}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
+
+func str(description string) map[string]any {
+	return map[string]any{"type": "string", "description": description}
+}
+
+func integer() map[string]any { return map[string]any{"type": "integer"} }
+
+func decodeArgs(args json.RawMessage, v any) error {
+	if len(bytes.TrimSpace(args)) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(args, v); err != nil {
+		return fmt.Errorf("invalid arguments: %w", err)
+	}
+	return nil
+}
+
+// resolve maps a repository-relative path to an absolute path inside the
+// worktree, rejecting paths that escape it or reach into .git.
+func (e *Env) resolve(rel string) (string, error) {
+	if filepath.IsAbs(rel) {
+		return "", fmt.Errorf("%w: %s is absolute", ErrPathOutsideWorktree, rel)
+	}
+	clean := filepath.Clean(filepath.FromSlash(rel))
+	if clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w: %s", ErrPathOutsideWorktree, rel)
+	}
+	if clean == ".git" || strings.HasPrefix(clean, ".git"+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w: %s is inside .git", ErrPathOutsideWorktree, rel)
+	}
+	abs := filepath.Join(e.Worktree, clean)
+	// Symlinks must not lead out of the worktree either; for paths that do
+	// not exist yet the deepest existing parent is checked.
+	root, err := filepath.EvalSymlinks(e.Worktree)
+	if err != nil {
+		return "", err
+	}
+	existing := abs
+	for {
+		real, err := filepath.EvalSymlinks(existing)
+		if err == nil {
+			if r, err := filepath.Rel(root, real); err != nil || r == ".." || strings.HasPrefix(r, ".."+string(filepath.Separator)) {
+				return "", fmt.Errorf("%w: %s", ErrPathOutsideWorktree, rel)
+			}
+			return abs, nil
+		}
+		if existing == e.Worktree {
+			return abs, nil
+		}
+		existing = filepath.Dir(existing)
+	}
+}
+
+func listFiles(ctx context.Context, env *Env, raw json.RawMessage) (string, error) {
+	var args struct {
+		Path      string `json:"path"`
+		Recursive bool   `json:"recursive"`
+	}
+	if err := decodeArgs(raw, &args); err != nil {
+		return "", err
+	}
+	if args.Path == "" {
+		args.Path = "."
+	}
+	dir, err := env.resolve(args.Path)
+	if err != nil {
+		return "", err
+	}
+	var items []string
+	truncated := false
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == dir {
+			return nil
+		}
+		if d.Name() == ".git" {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if len(items) >= maxListItems {
+			truncated = true
+			return filepath.SkipAll
+		}
+		rel, _ := filepath.Rel(env.Worktree, path)
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() {
+			items = append(items, rel+"/")
+			if !args.Recursive {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		items = append(items, rel)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(items)
+	out := strings.Join(items, "\n")
+	if truncated {
+		out += fmt.Sprintf("\n... truncated at %d entries", maxListItems)
+	}
+	return out, nil
+}
+
+func readFile(ctx context.Context, env *Env, raw json.RawMessage) (string, error) {
+	var args struct {
+		Path      string `json:"path"`
+		StartLine int    `json:"start_line"`
+		MaxLines  int    `json:"max_lines"`
+	}
+	if err := decodeArgs(raw, &args); err != nil {
+		return "", err
+	}
+	path, err := env.resolve(args.Path)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	if args.StartLine <= 1 && args.MaxLines <= 0 {
+		return string(data), nil
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	start := args.StartLine - 1
+	if start < 0 {
+		start = 0
+	}
+	if start > len(lines) {
+		start = len(lines)
+	}
+	end := len(lines)
+	if args.MaxLines > 0 && start+args.MaxLines < end {
+		end = start + args.MaxLines
+	}
+	return strings.Join(lines[start:end], ""), nil
+}
+
+func writeFile(ctx context.Context, env *Env, raw json.RawMessage) (string, error) {
+	var args struct {
+		Path    string `json:"path"`
+		Content string `json:"content"`
+	}
+	if err := decodeArgs(raw, &args); err != nil {
+		return "", err
+	}
+	path, err := env.resolve(args.Path)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, []byte(args.Content), 0644); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("wrote %d bytes to %s", len(args.Content), args.Path), nil
+}
+
+func search(ctx context.Context, env *Env, raw json.RawMessage) (string, error) {
+	var args struct {
+		Pattern string `json:"pattern"`
+		Path    string `json:"path"`
+	}
+	if err := decodeArgs(raw, &args); err != nil {
+		return "", err
+	}
+	if args.Pattern == "" {
+		return "", errors.New("pattern is required")
+	}
+	gitArgs := []string{"grep", "-n", "-I", "-E", "--untracked", "-e", args.Pattern}
+	if args.Path != "" {
+		if _, err := env.resolve(args.Path); err != nil {
+			return "", err
+		}
+		gitArgs = append(gitArgs, "--", args.Path)
+	}
+	out, code, err := gitOutput(ctx, env.Worktree, gitArgs...)
+	if code == 1 {
+		return "no matches", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	lines := strings.Split(strings.TrimRight(out, "\n"), "\n")
+	if len(lines) > maxSearchHits {
+		lines = append(lines[:maxSearchHits], fmt.Sprintf("... truncated at %d matches", maxSearchHits))
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+func applyPatch(ctx context.Context, env *Env, raw json.RawMessage) (string, error) {
+	var args struct {
+		Patch string `json:"patch"`
+	}
+	if err := decodeArgs(raw, &args); err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(args.Patch) == "" {
+		return "", errors.New("patch is required")
+	}
+	rep, err := patches.Apply(ctx, env.Worktree, []byte(args.Patch))
+	if err != nil {
+		return "", err
+	}
+	if !rep.Applied {
+		return "", errors.New(rep.Text())
+	}
+	stat, _, _ := gitOutput(ctx, env.Worktree, "diff", "--stat")
+	return rep.Summary + "\n" + stat, nil
+}
+
+func runCommand(ctx context.Context, env *Env, raw json.RawMessage) (string, error) {
+	var args struct {
+		Command string `json:"command"`
+	}
+	if err := decodeArgs(raw, &args); err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(args.Command) == "" {
+		return "", errors.New("command is required")
+	}
+	var out bytes.Buffer
+	report, err := env.Shell.Run(ctx, "agent", args.Command, env.Worktree, &out)
+	result := fmt.Sprintf("exit code: %d\n%s", report.ExitCode, out.String())
+	if err != nil && report.ExitCode < 0 && report.LimitHit == "" {
+		return "", err
+	}
+	// A non-zero exit is a normal answer for the model, not a tool failure.
+	return result, nil
+}
+
+func gitDiff(ctx context.Context, env *Env, raw json.RawMessage) (string, error) {
+	var args struct {
+		Path string `json:"path"`
+	}
+	if err := decodeArgs(raw, &args); err != nil {
+		return "", err
+	}
+	// Intent-to-add makes new files show up in the diff.
+	if _, _, err := gitOutput(ctx, env.Worktree, "add", "-A", "--intent-to-add"); err != nil {
+		return "", err
+	}
+	gitArgs := []string{"diff", "HEAD"}
+	if args.Path != "" {
+		if _, err := env.resolve(args.Path); err != nil {
+			return "", err
+		}
+		gitArgs = append(gitArgs, "--", args.Path)
+	}
+	out, _, err := gitOutput(ctx, env.Worktree, gitArgs...)
+	if err != nil {
+		return "", err
+	}
+	if out == "" {
+		return "no changes", nil
+	}
+	return out, nil
+}
+
+func gitStatus(ctx context.Context, env *Env, raw json.RawMessage) (string, error) {
+	out, _, err := gitOutput(ctx, env.Worktree, "status", "--short", "--branch")
+	return out, err
+}
+
+// gitOutput runs git in dir and returns stdout and the exit code.
+func gitOutput(ctx context.Context, dir string, args ...string) (string, int, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	code := 0
+	if cmd.ProcessState != nil {
+		code = cmd.ProcessState.ExitCode()
+	}
+	if err != nil {
+		return stdout.String(), code, fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), code, nil
+}
+
+// truncate caps tool output fed back to the model.
+func truncate(s string) string {
+	if len(s) <= maxToolOutput {
+		return s
+	}
+	return s[:maxToolOutput] + fmt.Sprintf("\n... truncated %d bytes", len(s)-maxToolOutput)
+}
@@ -0,0 +1,71 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func runTool(t *testing.T, env *Env, name string, args any) (string, error) {
+	t.Helper()
+	raw, _ := json.Marshal(args)
+	for _, tool := range BuiltinTools() {
+		if tool.Name == name {
+			return tool.Run(context.Background(), env, raw)
+		}
+	}
+	t.Fatalf("no tool %s", name)
+	return "", nil
+}
+
+func TestRepoTools(t *testing.T) {
+	env := &Env{Worktree: testRepo(t)}
+
+	patch := "--- a/main.go\n+++ b/main.go\n@@ -1,3 +1,3 @@\n package main\n \n-func main() {}\n+func main() { println(\"hi\") }\n"
+	if out, err := runTool(t, env, ToolApplyPatch, map[string]any{"patch": patch}); err != nil || !strings.Contains(out, "main.go") {
+		t.Fatalf("apply_patch = %q, %v", out, err)
+	}
+	if _, err := runTool(t, env, ToolApplyPatch, map[string]any{"patch": patch}); err == nil {
+		t.Fatal("expected re-applying the patch to fail")
+	}
+	if _, err := runTool(t, env, ToolWriteFile, map[string]any{"path": "docs/notes.md", "content": "println is fine\n"}); err != nil {
+		t.Fatalf("write_file: %v", err)
+	}
+	out, err := runTool(t, env, ToolSearch, map[string]any{"pattern": "println"})
+	if err != nil || !strings.Contains(out, "main.go:3:") || !strings.Contains(out, "docs/notes.md:1:") {
+		t.Fatalf("search = %q, %v", out, err)
+	}
+	if out, _ := runTool(t, env, ToolSearch, map[string]any{"pattern": "nothing-here"}); out != "no matches" {
+		t.Fatalf("expected no matches, got %q", out)
+	}
+	out, err = runTool(t, env, ToolGitDiff, map[string]any{})
+	if err != nil || !strings.Contains(out, "+func main() { println") || !strings.Contains(out, "+++ b/docs/notes.md") {
+		t.Fatalf("git_diff = %q, %v", out, err)
+	}
+	if out, _ := runTool(t, env, ToolReadFile, map[string]any{"path": "main.go", "start_line": 3, "max_lines": 1}); out != "func main() { println(\"hi\") }\n" {
+		t.Fatalf("read_file range = %q", out)
+	}
+	if out, _ := runTool(t, env, ToolListFiles, map[string]any{"recursive": true}); out != "docs/\ndocs/notes.md\nmain.go" {
+		t.Fatalf("list_files = %q", out)
+	}
+}
+
+func TestToolPathsStayInWorktree(t *testing.T) {
+	env := &Env{Worktree: testRepo(t)}
+	outside := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(env.Worktree, "escape")); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"/etc/passwd", "../x", "a/../../x", ".git/config", "escape/secret"} {
+		if _, err := runTool(t, env, ToolWriteFile, map[string]any{"path": path, "content": "x"}); !errors.Is(err, ErrPathOutsideWorktree) {
+			t.Errorf("write_file %s: expected ErrPathOutsideWorktree, got %v", path, err)
+		}
+	}
+	if entries, _ := os.ReadDir(outside); len(entries) != 0 {
+		t.Fatalf("file written outside worktree: %v", entries)
+	}
+}
@@ -0,0 +1,104 @@
+package agent
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/PonyDevAI/Bull-Board/internal/common"
+)
+
+// Trace entry statuses.
+const (
+	TraceOK     = "ok"
+	TraceError  = "error"
+	TraceDenied = "denied"
+)
+
+// TraceEntry records one tool call of an agent run. Entries are stored in
+// tool_calls as they finish and written to the job's trace.jsonl artifact.
+type TraceEntry struct {
+	Seq        int             `json:"seq"`
+	Turn       int             `json:"turn"`
+	CallID     string          `json:"call_id"`
+	Tool       string          `json:"tool"`
+	Input      json.RawMessage `json:"input"`
+	Output     string          `json:"output"`
+	Status     string          `json:"status"`
+	Error      string          `json:"error,omitempty"`
+	Rule       string          `json:"rule,omitempty"`
+	StartedAt  string          `json:"started_at"`
+	DurationMS int64           `json:"duration_ms"`
+}
+
+type trace struct {
+	db        *sql.DB
+	jobID     string
+	stepRunID string
+	entries   []TraceEntry
+}
+
+// record numbers the entry and stores it.
+func (t *trace) record(e TraceEntry) (TraceEntry, error) {
+	e.Seq = len(t.entries) + 1
+	if !json.Valid(e.Input) {
+		raw, _ := json.Marshal(string(e.Input))
+		e.Input = raw
+	}
+	t.entries = append(t.entries, e)
+	var stepRunID any
+	if t.stepRunID != "" {
+		stepRunID = t.stepRunID
+	}
+	_, err := t.db.Exec(`INSERT INTO tool_calls (id, job_id, step_run_id, seq, turn, call_id, tool, input_json, output, status, error, policy_rule, started_at, duration_ms) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		common.UUID(), t.jobID, stepRunID, e.Seq, e.Turn, e.CallID, e.Tool, string(e.Input), e.Output, e.Status, e.Error, e.Rule, e.StartedAt, e.DurationMS)
+	return e, err
+}
+
+// jsonl renders the trace one entry per line.
+func (t *trace) jsonl() []byte {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, e := range t.entries {
+		_ = enc.Encode(e)
+	}
+	return buf.Bytes()
+}
+
+// ListToolCalls returns a step run's tool calls across its jobs in call order.
+func ListToolCalls(db *sql.DB, stepRunID string) ([]map[string]any, error) {
+	rows, err := db.Query(`SELECT t.job_id, t.seq, t.turn, t.call_id, t.tool, t.input_json, t.output, t.status, t.error, t.policy_rule, t.started_at, t.duration_ms
+		FROM tool_calls t JOIN jobs j ON j.id = t.job_id
+		WHERE t.step_run_id = ? ORDER BY j.created_at, t.job_id, t.seq`, stepRunID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []map[string]any{}
+	for rows.Next() {
+		var jobID, callID, tool, input, output, status, errText, rule, startedAt string
+		var seq, turn int
+		var durationMS int64
+		if err := rows.Scan(&jobID, &seq, &turn, &callID, &tool, &input, &output, &status, &errText, &rule, &startedAt, &durationMS); err != nil {
+			return nil, err
+		}
+		items = append(items, map[string]any{
+			"job_id":      jobID,
+			"seq":         seq,
+			"turn":        turn,
+			"call_id":     callID,
+			"tool":        tool,
+			"input":       json.RawMessage(input),
+			"output":      output,
+			"status":      status,
+			"error":       errText,
+			"rule":        rule,
+			"started_at":  startedAt,
+			"duration_ms": durationMS,
+		})
+	}
+	return items, rows.Err()
+}
+
+func now() string { return time.Now().UTC().Format(time.RFC3339Nano) }
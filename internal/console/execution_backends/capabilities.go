@@ -0,0 +1,153 @@
+package execution_backends
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+var ErrInvalidCapabilities = errors.New("invalid capabilities")
+
+type capabilityKind int
+
+const (
+	capabilityBool capabilityKind = iota
+	capabilityList
+	capabilityString
+)
+
+// CapabilityVocabulary lists the capability keys Bull-Board understands.
+// Keys prefixed with "x-" are custom and may hold a bool, string or string list.
+var CapabilityVocabulary = map[string]capabilityKind{
+	"git_push":  capabilityBool,   // may push branches to the workspace remote
+	"network":   capabilityBool,   // has outbound network access
+	"docker":    capabilityBool,   // can run docker
+	"gpu":       capabilityBool,   // has a GPU
+	"shell":     capabilityBool,   // can run shell commands
+	"languages": capabilityList,   // toolchains installed, e.g. ["go","node"]
+	"os":        capabilityString, // e.g. "linux"
+	"arch":      capabilityString, // e.g. "amd64"
+}
+
+// Capabilities is a parsed capabilities_json document, either what a backend
+// offers or what a step template requires.
+type Capabilities map[string]any
+
+// CapabilityMismatch describes one required capability a backend does not satisfy.
+type CapabilityMismatch struct {
+	Key      string `json:"key"`
+	Required any    `json:"required"`
+	Offered  any    `json:"offered"`
+}
+
+// ParseCapabilities decodes and validates a capabilities document. Empty input is no capabilities.
+func ParseCapabilities(raw string) (Capabilities, error) {
+	caps := Capabilities{}
+	if strings.TrimSpace(raw) == "" {
+		return caps, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &caps); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCapabilities, err)
+	}
+	if caps == nil {
+		caps = Capabilities{}
+	}
+	for key, value := range caps {
+		kind, known := CapabilityVocabulary[key]
+		if !known {
+			if !strings.HasPrefix(key, "x-") {
+				return nil, fmt.Errorf("%w: unknown key %q (custom keys must start with \"x-\")", ErrInvalidCapabilities, key)
+			}
+			kind = kindOf(value)
+		}
+		normalized, ok := normalizeCapability(kind, value)
+		if !ok {
+			return nil, fmt.Errorf("%w: %q has unsupported value %v", ErrInvalidCapabilities, key, value)
+		}
+		caps[key] = normalized
+	}
+	return caps, nil
+}
+
+// Missing returns the requirements offered does not satisfy, sorted by key.
+// A true bool requires the capability, a false bool requires its absence,
+// a list requires every element and a string requires an exact match.
+func (required Capabilities) Missing(offered Capabilities) []CapabilityMismatch {
+	var out []CapabilityMismatch
+	for key, want := range required {
+		have := offered[key]
+		if !satisfies(want, have) {
+			out = append(out, CapabilityMismatch{Key: key, Required: want, Offered: have})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out
+}
+
+func satisfies(want, have any) bool {
+	switch w := want.(type) {
+	case bool:
+		h, _ := have.(bool)
+		return h == w
+	case string:
+		h, _ := have.(string)
+		return h == w
+	case []string:
+		h, _ := have.([]string)
+		for _, item := range w {
+			if !containsString(h, item) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func kindOf(v any) capabilityKind {
+	switch v.(type) {
+	case []any:
+		return capabilityList
+	case string:
+		return capabilityString
+	default:
+		return capabilityBool
+	}
+}
+
+func normalizeCapability(kind capabilityKind, v any) (any, bool) {
+	switch kind {
+	case capabilityBool:
+		b, ok := v.(bool)
+		return b, ok
+	case capabilityString:
+		s, ok := v.(string)
+		return s, ok
+	case capabilityList:
+		items, ok := v.([]any)
+		if !ok {
+			return nil, false
+		}
+		out := make([]string, 0, len(items))
+		for _, item := range items {
+			s, ok := item.(string)
+			if !ok {
+				return nil, false
+			}
+			out = append(out, s)
+		}
+		return out, true
+	}
+	return nil, false
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
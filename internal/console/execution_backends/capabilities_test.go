@@ -0,0 +1,37 @@
+package execution_backends
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseCapabilitiesValidatesVocabulary(t *testing.T) {
+	caps, err := ParseCapabilities(`{"git_push":true,"languages":["go","node"],"os":"linux","x-team":"infra"}`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if langs := caps["languages"].([]string); len(langs) != 2 || langs[0] != "go" {
+		t.Fatalf("unexpected languages %v", caps["languages"])
+	}
+	for _, raw := range []string{`{"gpus":true}`, `{"network":"yes"}`, `{"languages":"go"}`, `{"x-tags":[1]}`, `[1]`} {
+		if _, err := ParseCapabilities(raw); !errors.Is(err, ErrInvalidCapabilities) {
+			t.Fatalf("%s: expected invalid capabilities, got %v", raw, err)
+		}
+	}
+}
+
+func TestMissingReportsUnsatisfiedRequirements(t *testing.T) {
+	offered, _ := ParseCapabilities(`{"git_push":true,"network":true,"gpu":true,"languages":["go"],"x-pool":"fast"}`)
+	required, _ := ParseCapabilities(`{"git_push":true,"gpu":false,"docker":true,"languages":["go","rust"],"x-pool":"fast"}`)
+	missing := required.Missing(offered)
+	var keys []string
+	for _, m := range missing {
+		keys = append(keys, m.Key)
+	}
+	if len(keys) != 3 || keys[0] != "docker" || keys[1] != "gpu" || keys[2] != "languages" {
+		t.Fatalf("unexpected mismatches %v", keys)
+	}
+	if len(Capabilities{}.Missing(offered)) != 0 {
+		t.Fatalf("empty requirements must match any backend")
+	}
+}
@@ -0,0 +1,170 @@
+package execution_backends
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+
+	"github.com/PonyDevAI/Bull-Board/internal/console/toolpolicy"
+)
+
+var ErrBackendNotFound = errors.New("execution backend not found")
+
+// Backend is the execution_backends row a connector executes against.
+type Backend struct {
+	ID                    string `json:"id"`
+	Name                  string `json:"name"`
+	ConnectorCode         string `json:"connector_code"`
+	Type                  string `json:"type"`
+	EndpointURL           string `json:"endpoint_url"`
+	IntegrationInstanceID string `json:"integration_instance_id,omitempty"`
+	ConfigJSON            string `json:"config_json"`
+	CapabilitiesJSON      string `json:"capabilities_json"`
+	Status                string `json:"status"`
+	CallbackSecret        string `json:"-"`
+}
+
+// Request is a prepared step dispatch handed to a connector for one job.
+type Request struct {
+	JobID            string         `json:"job_id"`
+	WorkflowRunID    string         `json:"workflow_run_id"`
+	StepRunID        string         `json:"step_run_id"`
+	TaskID           string         `json:"task_id"`
+	Worker           map[string]any `json:"worker"`
+	Role             map[string]any `json:"role"`
+	AgentApp         map[string]any `json:"agent_app"`
+	ExecutionBackend map[string]any `json:"execution_backend"`
+	ResolvedConfig   any            `json:"resolved_config"`
+	Step             map[string]any `json:"step"`
+	Workspace        map[string]any `json:"workspace"`
+	Input            any            `json:"input"`
+	// ToolPolicy is the merged tool policy locally executed agents enforce.
+	ToolPolicy *toolpolicy.Resolved `json:"tool_policy,omitempty"`
+	Backend    Backend              `json:"-"`
+	// Logs, when set, receives output while the job runs; it is appended to
+	// the job's log store and streamed to the console.
+	Logs LogSink `json:"-"`
+}
+
+// LogSink receives a chunk of job output written to stream ("stdout" or "stderr").
+type LogSink func(stream, content string)
+
+// LogChunk is a piece of job output reported by a backend.
+type LogChunk struct {
+	Stream  string `json:"stream"`
+	Content string `json:"content"`
+}
+
+// StatusAwaitingApproval is the Result status of a job stopped by a git
+// operation that needs approval.
+const StatusAwaitingApproval = "awaiting_approval"
+
+type Artifact struct {
+	Kind     string         `json:"kind"`
+	URI      string         `json:"uri"`
+	Metadata map[string]any `json:"metadata"`
+}
+
+// Result is what a connector reports for a job. Status "succeeded" or "failed"
+// is final; "running" means the backend accepted the job and will report the
+// outcome later through the job callback endpoint. StatusAwaitingApproval
+// ends the job but parks its step until a guarded git operation is approved.
+type Result struct {
+	Status         string         `json:"status"`
+	ExternalJobRef string         `json:"external_job_ref"`
+	Output         any            `json:"output"`
+	Response       map[string]any `json:"response"`
+	Artifacts      []Artifact     `json:"artifacts"`
+}
+
+// Connector executes jobs on one kind of execution backend.
+type Connector interface {
+	Execute(ctx context.Context, req Request) (Result, error)
+}
+
+// Registry maps connector codes to connectors.
+type Registry struct {
+	mu         sync.RWMutex
+	connectors map[string]Connector
+}
+
+func NewRegistry() *Registry { return &Registry{connectors: map[string]Connector{}} }
+
+func (r *Registry) Register(code string, c Connector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.connectors[code] = c
+}
+
+// ForBackend resolves a backend's connector by connector_code, falling back to type.
+func (r *Registry) ForBackend(b Backend) (Connector, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if c, ok := r.connectors[b.ConnectorCode]; ok {
+		return c, true
+	}
+	c, ok := r.connectors[b.Type]
+	return c, ok
+}
+
+func (r *Repository) Get(id string) (Backend, error) {
+	var b Backend
+	err := r.DB.QueryRow(`SELECT id, name, connector_code, type, endpoint_url, COALESCE(integration_instance_id,''), config_json, capabilities_json, status, callback_secret FROM execution_backends WHERE id = ?`, id).
+		Scan(&b.ID, &b.Name, &b.ConnectorCode, &b.Type, &b.EndpointURL, &b.IntegrationInstanceID, &b.ConfigJSON, &b.CapabilitiesJSON, &b.Status, &b.CallbackSecret)
+	if err == sql.ErrNoRows {
+		return b, ErrBackendNotFound
+	}
+	return b, err
+}
+
+// HealthChecker is implemented by connectors that can probe their backend.
+// A nil error means the backend is reachable and accepting work.
+type HealthChecker interface {
+	Health(ctx context.Context, b Backend) error
+}
+
+// Canceler is implemented by connectors that can stop a job they accepted,
+// identified by the external reference the backend returned.
+type Canceler interface {
+	Cancel(ctx context.Context, b Backend, externalJobRef string) error
+}
+
+// LogPoller is implemented by connectors whose backend exposes job output for
+// polling. cursor is the opaque value returned by the previous poll, empty on
+// the first; the backend returns the chunks after it and the next cursor.
+type LogPoller interface {
+	PollLogs(ctx context.Context, b Backend, externalJobRef, cursor string) ([]LogChunk, string, error)
+}
+
+// LocalArtifacts is implemented by connectors that execute jobs inside the
+// console process. Their results may name artifacts by local path, and only
+// files under the directories returned for the job are taken in; results of
+// any other backend must upload their content or reference stored blobs.
+type LocalArtifacts interface {
+	ArtifactRoots(req Request) []string
+}
+
+// Pulled is implemented by connectors whose jobs are not executed by the
+// console: they stay queued until a runner claims them through the runner API.
+type Pulled interface {
+	Pulled()
+}
+
+// ListAll returns every execution backend.
+func (r *Repository) ListAll() ([]Backend, error) {
+	rows, err := r.DB.Query(`SELECT id, name, connector_code, type, endpoint_url, COALESCE(integration_instance_id,''), config_json, capabilities_json, status, callback_secret FROM execution_backends ORDER BY created_at ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Backend
+	for rows.Next() {
+		var b Backend
+		if err := rows.Scan(&b.ID, &b.Name, &b.ConnectorCode, &b.Type, &b.EndpointURL, &b.IntegrationInstanceID, &b.ConfigJSON, &b.CapabilitiesJSON, &b.Status, &b.CallbackSecret); err != nil {
+			return nil, err
+		}
+		out = append(out, b)
+	}
+	return out, rows.Err()
+}
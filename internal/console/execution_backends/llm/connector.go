@@ -0,0 +1,177 @@
+// Package llm implements the built-in "llm" execution backend: a step run is
+// answered by one chat request against the model provider configured in an
+// integration instance.
+package llm
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/PonyDevAI/Bull-Board/internal/console/execution_backends"
+	"github.com/PonyDevAI/Bull-Board/internal/console/models"
+)
+
+const ConnectorCode = "llm"
+
+var (
+	ErrNoModelProfile = errors.New("no model profile for step")
+	ErrNoEndpoint     = errors.New("llm backend has no endpoint")
+)
+
+// Connector runs steps as chat requests.
+type Connector struct {
+	db        *sql.DB
+	providers *models.Registry
+}
+
+func NewConnector(db *sql.DB) *Connector {
+	return &Connector{db: db, providers: models.DefaultRegistry}
+}
+
+func (c *Connector) Execute(ctx context.Context, req execution_backends.Request) (execution_backends.Result, error) {
+	m, err := c.Model(req)
+	if err != nil {
+		return execution_backends.Result{}, err
+	}
+	resp, err := m.Provider.Chat(ctx, m.Settings, m.Profile.Request(m.SystemPrompt, BuildMessages(req.Step, req.Input)))
+	if err != nil {
+		return execution_backends.Result{}, err
+	}
+	if req.Logs != nil {
+		req.Logs("stdout", resp.Message.Content)
+	}
+	return execution_backends.Result{
+		Status: "succeeded",
+		Output: map[string]any{
+			"content":          resp.Message.Content,
+			"finish_reason":    resp.FinishReason,
+			"model":            resp.Model,
+			"model_profile_id": m.Profile.ID,
+			"provider":         m.Provider.Code(),
+			"usage":            resp.Usage,
+		},
+		Response: map[string]any{"runtime": ConnectorCode, "id": resp.ID},
+	}, nil
+}
+
+// Model is what a step runs against: the provider adapter with its settings,
+// the validated model profile and the agent app system prompt.
+type Model struct {
+	Provider     models.Provider
+	Settings     models.Settings
+	Profile      models.Profile
+	SystemPrompt string
+}
+
+// Model resolves the model for a step run and validates the profile against
+// the provider before any request is made.
+func (c *Connector) Model(req execution_backends.Request) (Model, error) {
+	agentAppID, _ := req.Worker["agent_app_id"].(string)
+	stepConfig, _ := req.Step["config"].(map[string]any)
+	profile, err := c.modelProfile(agentAppID, stepConfig)
+	if err != nil {
+		return Model{}, err
+	}
+	provider, settings, err := c.provider(req.Backend, profile.Provider)
+	if err != nil {
+		return Model{}, err
+	}
+	profile.Provider = provider.Code()
+	if err := c.providers.ValidateProfile(profile); err != nil {
+		return Model{}, err
+	}
+	m := Model{Provider: provider, Settings: settings, Profile: profile}
+	_ = c.db.QueryRow(`SELECT system_prompt FROM agent_apps WHERE id = ?`, agentAppID).Scan(&m.SystemPrompt)
+	return m, nil
+}
+
+// Health lists the endpoint's models.
+func (c *Connector) Health(ctx context.Context, b execution_backends.Backend) error {
+	provider, settings, err := c.provider(b, "")
+	if err != nil {
+		return err
+	}
+	_, err = provider.ListModels(ctx, settings)
+	return err
+}
+
+// BuildMessages turns the resolved step input into the user message: the step
+// config "prompt" followed by the input's "prompt" string, or the whole input
+// as JSON. The agent app system prompt travels separately.
+func BuildMessages(step map[string]any, input any) []models.Message {
+	var parts []string
+	if cfg, ok := step["config"].(map[string]any); ok {
+		if p, _ := cfg["prompt"].(string); strings.TrimSpace(p) != "" {
+			parts = append(parts, p)
+		}
+	}
+	if in, ok := input.(map[string]any); ok {
+		if p, _ := in["prompt"].(string); p != "" {
+			parts = append(parts, p)
+		} else if len(in) > 0 {
+			data, _ := json.MarshalIndent(in, "", "  ")
+			parts = append(parts, string(data))
+		}
+	} else if s, ok := input.(string); ok && s != "" {
+		parts = append(parts, s)
+	}
+	if len(parts) == 0 {
+		name, _ := step["name"].(string)
+		parts = append(parts, name)
+	}
+	return []models.Message{{Role: "user", Content: strings.Join(parts, "\n\n")}}
+}
+
+// modelProfile loads the step config's model_profile_id, else the agent app default.
+func (c *Connector) modelProfile(agentAppID string, stepConfig map[string]any) (models.Profile, error) {
+	id, _ := stepConfig["model_profile_id"].(string)
+	if id == "" {
+		var def sql.NullString
+		_ = c.db.QueryRow(`SELECT default_model_profile_id FROM agent_apps WHERE id = ?`, agentAppID).Scan(&def)
+		id = def.String
+	}
+	if id == "" {
+		return models.Profile{}, fmt.Errorf("%w: agent app %s has no default_model_profile_id", ErrNoModelProfile, agentAppID)
+	}
+	p, err := models.LoadProfile(c.db, id)
+	if err == sql.ErrNoRows {
+		return p, fmt.Errorf("%w: model profile %s not found", ErrNoModelProfile, id)
+	}
+	return p, err
+}
+
+// provider resolves the adapter and settings for a backend. The integration
+// instance's connector code picks the provider; without an instance the
+// backend endpoint_url is called with the profile's provider (default
+// openai_compatible) and no credentials.
+func (c *Connector) provider(b execution_backends.Backend, profileProvider string) (models.Provider, models.Settings, error) {
+	settings := models.Settings{BaseURL: b.EndpointURL}
+	code := profileProvider
+	if b.IntegrationInstanceID != "" {
+		instanceCode, s, err := models.LoadSettings(c.db, b.IntegrationInstanceID)
+		if err != nil {
+			return nil, settings, err
+		}
+		if s.BaseURL == "" {
+			s.BaseURL = b.EndpointURL
+		}
+		settings = s
+		if _, err := c.providers.Get(instanceCode); err == nil {
+			code = instanceCode
+		}
+	} else if settings.BaseURL == "" {
+		return nil, settings, fmt.Errorf("%w: %s", ErrNoEndpoint, b.ID)
+	}
+	if code == "" {
+		code = models.ProviderOpenAICompatible
+	}
+	provider, err := c.providers.Get(code)
+	if err != nil {
+		return nil, settings, err
+	}
+	return provider, settings, nil
+}
@@ -0,0 +1,186 @@
+package llm
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/PonyDevAI/Bull-Board/internal/common"
+	"github.com/PonyDevAI/Bull-Board/internal/console/execution_backends"
+	"github.com/PonyDevAI/Bull-Board/internal/console/models"
+)
+
+// wireRequest is the chat-completions request body as the fake server sees it.
+type wireRequest struct {
+	Model    string `json:"model"`
+	Messages []struct {
+		Role    string `json:"role"`
+		Content string `json:"content"`
+	} `json:"messages"`
+	Temperature     *float64 `json:"temperature"`
+	ReasoningEffort string   `json:"reasoning_effort"`
+}
+
+// fakeServer answers /chat/completions with scripted responses in order and
+// records the requests it received.
+type fakeServer struct {
+	*httptest.Server
+	mu        sync.Mutex
+	responses []fakeResponse
+	requests  []wireRequest
+	headers   []http.Header
+}
+
+type fakeResponse struct {
+	status int
+	body   any
+}
+
+func newFakeServer(t *testing.T, responses ...fakeResponse) *fakeServer {
+	f := &fakeServer{responses: responses}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/models" {
+			_ = json.NewEncoder(w).Encode(map[string]any{"data": []any{map[string]any{"id": "gpt-test"}}})
+			return
+		}
+		var req wireRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		f.mu.Lock()
+		f.requests = append(f.requests, req)
+		f.headers = append(f.headers, r.Header.Clone())
+		next := f.responses[0]
+		f.responses = f.responses[1:]
+		f.mu.Unlock()
+		w.WriteHeader(next.status)
+		_ = json.NewEncoder(w).Encode(next.body)
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func completion(content string) fakeResponse {
+	return fakeResponse{status: http.StatusOK, body: map[string]any{
+		"id":      "chatcmpl-1",
+		"model":   "gpt-test",
+		"choices": []any{map[string]any{"index": 0, "message": map[string]any{"role": "assistant", "content": content}, "finish_reason": "stop"}},
+		"usage":   map[string]any{"prompt_tokens": 12, "completion_tokens": 5, "total_tokens": 17},
+	}}
+}
+
+func testDB(t *testing.T, baseURL string) *sql.DB {
+	t.Helper()
+	t.Setenv("SQLITE_PATH", filepath.Join(t.TempDir(), "bb.sqlite"))
+	t.Setenv("BB_TEST_LLM_KEY", "sk-test")
+	db, _, err := common.OpenDB("")
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	for _, stmt := range []string{
+		`INSERT INTO model_profiles (id, home_id, name, provider, model_name, temperature, reasoning_level) VALUES ('model-llm','default','Test','openai_compatible','gpt-test',0.3,'standard')`,
+		`INSERT INTO agent_apps (id, home_id, name, default_model_profile_id, system_prompt) VALUES ('app-llm','default','Planner','model-llm','You plan work.')`,
+		`INSERT INTO integration_instances (id, home_id, connector_code, name, endpoint, auth_config_json, metadata_json) VALUES ('int-llm','default','openai_compatible','Fake','` + baseURL + `/v1','{"api_key_env":"BB_TEST_LLM_KEY"}','{"headers":{"X-Org":"bull"}}')`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+	}
+	return db
+}
+
+func testRequest(input any) execution_backends.Request {
+	return execution_backends.Request{
+		JobID:   "job-1",
+		Worker:  map[string]any{"agent_app_id": "app-llm"},
+		Step:    map[string]any{"name": "Plan", "config": map[string]any{"prompt": "Write a plan."}},
+		Input:   input,
+		Backend: execution_backends.Backend{ID: "backend-llm", ConnectorCode: ConnectorCode, IntegrationInstanceID: "int-llm"},
+	}
+}
+
+func TestExecuteSendsMessagesAndReturnsUsage(t *testing.T) {
+	srv := newFakeServer(t, completion("1. do it"))
+	c := NewConnector(testDB(t, srv.URL))
+	var logged string
+	req := testRequest(map[string]any{"prompt": "Add login page"})
+	req.Logs = func(stream, content string) { logged += content }
+
+	res, err := c.Execute(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	output := res.Output.(map[string]any)
+	if res.Status != "succeeded" || output["content"] != "1. do it" || logged != "1. do it" {
+		t.Fatalf("unexpected result %+v", res)
+	}
+	if usage := output["usage"].(models.Usage); usage.TotalTokens != 17 || usage.InputTokens != 12 || usage.OutputTokens != 5 {
+		t.Fatalf("unexpected usage %+v", usage)
+	}
+
+	sent := srv.requests[0]
+	if sent.Model != "gpt-test" || sent.Temperature == nil || *sent.Temperature != 0.3 {
+		t.Fatalf("unexpected model settings %+v", sent)
+	}
+	if len(sent.Messages) != 2 || sent.Messages[0].Role != "system" || sent.Messages[0].Content != "You plan work." ||
+		sent.Messages[1].Content != "Write a plan.\n\nAdd login page" {
+		t.Fatalf("unexpected messages %+v", sent.Messages)
+	}
+	if got := srv.headers[0].Get("Authorization"); got != "Bearer sk-test" {
+		t.Fatalf("expected api key from env, got %q", got)
+	}
+	if got := srv.headers[0].Get("X-Org"); got != "bull" {
+		t.Fatalf("expected integration header, got %q", got)
+	}
+}
+
+func TestExecuteUsesReasoningEffortAndReportsAPIErrors(t *testing.T) {
+	srv := newFakeServer(t, fakeResponse{status: http.StatusTooManyRequests, body: map[string]any{"error": map[string]any{"message": "rate limited"}}})
+	db := testDB(t, srv.URL)
+	if _, err := db.Exec(`UPDATE model_profiles SET reasoning_level = 'high' WHERE id = 'model-llm'`); err != nil {
+		t.Fatalf("update profile: %v", err)
+	}
+	_, err := NewConnector(db).Execute(context.Background(), testRequest(map[string]any{"files": []any{"a.go"}}))
+	var apiErr *models.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusTooManyRequests || apiErr.Message != "rate limited" {
+		t.Fatalf("expected API error, got %v", err)
+	}
+	sent := srv.requests[0]
+	if sent.ReasoningEffort != "high" || sent.Temperature != nil {
+		t.Fatalf("expected reasoning effort without temperature, got %+v", sent)
+	}
+	if sent.Messages[1].Content != "Write a plan.\n\n{\n  \"files\": [\n    \"a.go\"\n  ]\n}" {
+		t.Fatalf("expected JSON input in user message, got %q", sent.Messages[1].Content)
+	}
+}
+
+func TestHealthListsModels(t *testing.T) {
+	srv := newFakeServer(t)
+	c := NewConnector(testDB(t, srv.URL))
+	if err := c.Health(context.Background(), execution_backends.Backend{ID: "b", IntegrationInstanceID: "int-llm"}); err != nil {
+		t.Fatalf("Health: %v", err)
+	}
+	if err := c.Health(context.Background(), execution_backends.Backend{ID: "b"}); !errors.Is(err, ErrNoEndpoint) {
+		t.Fatalf("expected ErrNoEndpoint, got %v", err)
+	}
+}
+
+func TestExecuteValidatesProfileAgainstInstanceProvider(t *testing.T) {
+	srv := newFakeServer(t)
+	db := testDB(t, srv.URL)
+	if _, err := db.Exec(`UPDATE integration_instances SET connector_code = 'anthropic' WHERE id = 'int-llm'`); err != nil {
+		t.Fatalf("update instance: %v", err)
+	}
+	if _, err := db.Exec(`UPDATE model_profiles SET temperature = 1.5 WHERE id = 'model-llm'`); err != nil {
+		t.Fatalf("update profile: %v", err)
+	}
+	_, err := NewConnector(db).Execute(context.Background(), testRequest("hi"))
+	if !errors.Is(err, models.ErrInvalidProfile) || len(srv.requests) != 0 {
+		t.Fatalf("expected invalid profile before any request, got %v", err)
+	}
+}
@@ -0,0 +1,507 @@
+// Package local implements the built-in "local" execution backend: a step run
+// executes as shell work inside a per-run git worktree of the workspace repo.
+package local
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/PonyDevAI/Bull-Board/internal/common"
+	"github.com/PonyDevAI/Bull-Board/internal/console/execution_backends"
+	"github.com/PonyDevAI/Bull-Board/internal/console/protection"
+	"github.com/PonyDevAI/Bull-Board/internal/console/testreports"
+	"github.com/PonyDevAI/Bull-Board/internal/console/worktrees"
+	"github.com/PonyDevAI/Bull-Board/pkg/patches"
+	"github.com/PonyDevAI/Bull-Board/pkg/sandbox"
+)
+
+const ConnectorCode = "local"
+
+// On-conflict policies for a patch that does not apply.
+const (
+	OnConflictFail     = "fail"
+	OnConflictContinue = "continue"
+)
+
+var ErrPatchNotApplied = errors.New("patch did not apply")
+
+// StepSpec is the local work a step performs, read from the step template
+// config and overridden by the step run input. Phases run in order: patch,
+// commands, verify, commit. TestReports are collected once the phases end,
+// whether or not they succeeded.
+//
+// A patch that does not apply strictly is merged 3-way; if that conflicts
+// too, OnConflict "fail" (the default) fails the step and "continue" ends
+// it successfully after the patch phase, leaving the worktree as it was so
+// that a later step can repair the patch from the patch_report artifact.
+type StepSpec struct {
+	Patch       string           `json:"patch"`
+	OnConflict  string           `json:"on_conflict"`
+	Commands    []string         `json:"commands"`
+	Verify      []string         `json:"verify"`
+	Commit      *CommitSpec      `json:"commit"`
+	TestReports []TestReportSpec `json:"test_reports"`
+	Sandbox     sandbox.Config   `json:"-"`
+}
+
+type CommitSpec struct {
+	Message string `json:"message"`
+}
+
+// TestReportSpec names test report files the step's commands write, as a
+// worktree-relative path or glob. Format is go_test_json, junit or tap;
+// empty means detect. A plain string is read as the path.
+type TestReportSpec struct {
+	Path   string `json:"path"`
+	Format string `json:"format"`
+}
+
+func (t TestReportSpec) validate() error {
+	p := filepath.Clean(t.Path)
+	if t.Path == "" || filepath.IsAbs(p) || p == ".." || strings.HasPrefix(p, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("invalid local step spec: test report path %q must be relative to the worktree", t.Path)
+	}
+	if _, err := filepath.Match(p, ""); err != nil {
+		return fmt.Errorf("invalid local step spec: test report path %q: %w", t.Path, err)
+	}
+	if t.Format != "" && !testreports.ValidFormat(t.Format) {
+		return fmt.Errorf("invalid local step spec: unknown test report format %q", t.Format)
+	}
+	return nil
+}
+
+func (t *TestReportSpec) UnmarshalJSON(b []byte) error {
+	if len(b) > 0 && b[0] == '"' {
+		*t = TestReportSpec{}
+		return json.Unmarshal(b, &t.Path)
+	}
+	type plain TestReportSpec
+	return json.Unmarshal(b, (*plain)(t))
+}
+
+// Connector runs step runs on the console host. Worktrees live under
+// dataDir/worktrees/<workflow_run_id> and are kept across the run's steps
+// (see package worktrees); job files live under dataDir/artifacts/jobs/<job_id>.
+type Connector struct {
+	dataDir    string
+	worktrees  *worktrees.Manager
+	protection *protection.Store
+	gitGuard   []string
+}
+
+// NewConnector uses an unrecorded worktree manager with the default branch
+// pattern until SetWorktrees installs the server's.
+func NewConnector(dataDir string) *Connector {
+	return &Connector{dataDir: dataDir, worktrees: worktrees.NewManager(nil, dataDir, common.WorktreeConfig{})}
+}
+
+// SetWorktrees installs the manager that records and prunes run worktrees.
+func (c *Connector) SetWorktrees(m *worktrees.Manager) { c.worktrees = m }
+
+// SetProtection installs the branch protection the commit phase is checked
+// against; without it commits are not guarded.
+func (c *Connector) SetProtection(p *protection.Store) { c.protection = p }
+
+// SetGitGuard sets the command the git hooks of step commands run to report
+// branch updates (see protection.ServeHooks). Without it, and without
+// SetProtection, commands are not guarded.
+func (c *Connector) SetGitGuard(guard []string) { c.gitGuard = guard }
+
+// GuardShell makes shell's git commands in the repository of dir subject to
+// the workspace's branch protection, logging their attempts under source:
+// hooks check each branch update, and protected branches a command moved
+// without a check are moved back. The returned stop ends the guard once the
+// shell's commands are done.
+func (c *Connector) GuardShell(shell *sandbox.Shell, req execution_backends.Request, source, dir string) (stop func(), err error) {
+	if c.protection == nil || len(c.gitGuard) == 0 {
+		return func() {}, nil
+	}
+	workspaceID, _ := req.Workspace["id"].(string)
+	// The hooks and their socket live in the job's temporary HOME.
+	op := protection.Operation{
+		WorkspaceID: workspaceID, Source: source, TaskID: req.TaskID, WorkflowRunID: req.WorkflowRunID, StepRunID: req.StepRunID,
+	}
+	hooks, vars, err := c.protection.ServeHooks(filepath.Join(shell.Home(), "git-hooks"), c.gitGuard, op)
+	if err != nil {
+		return nil, err
+	}
+	shell.AddEnv(vars...)
+	shell.AddGuard(c.protection.GuardRefs(dir, op))
+	return func() { hooks.Close() }, nil
+}
+
+// Held returns the violation of a git operation a command of req's step
+// attempted since since and that waits for approval, or nil.
+func (c *Connector) Held(req execution_backends.Request, since string) error {
+	if c.protection == nil {
+		return nil
+	}
+	return c.protection.Held(req.StepRunID, since)
+}
+
+// Health checks that git is installed and the data directory is writable.
+func (c *Connector) Health(ctx context.Context, b execution_backends.Backend) error {
+	if _, err := exec.LookPath("git"); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(c.dataDir, 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(c.dataDir, ".health-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+type jobRun struct {
+	log      jobLog
+	commands []sandbox.CommandReport
+	sh       *sandbox.Shell
+	limitHit string
+	patch    *patches.Report
+}
+
+// jobLog keeps the full job output for the execution_log artifact and
+// forwards each write to the request's log sink as it happens.
+type jobLog struct {
+	buf  bytes.Buffer
+	sink execution_backends.LogSink
+}
+
+func (l *jobLog) Write(p []byte) (int, error) {
+	l.buf.Write(p)
+	if l.sink != nil && len(p) > 0 {
+		l.sink("stdout", string(p))
+	}
+	return len(p), nil
+}
+
+func (l *jobLog) WriteString(s string) (int, error) { return l.Write([]byte(s)) }
+
+func (l *jobLog) Bytes() []byte { return l.buf.Bytes() }
+
+func (c *Connector) Execute(ctx context.Context, req execution_backends.Request) (execution_backends.Result, error) {
+	spec, err := ParseStepSpec(req.Step, req.Input)
+	if err != nil {
+		return execution_backends.Result{}, err
+	}
+	worktree, branch, err := c.Worktree(ctx, req)
+	if err != nil {
+		return execution_backends.Result{}, err
+	}
+	jobDir, err := c.JobDir(req.JobID)
+	if err != nil {
+		return execution_backends.Result{}, err
+	}
+	// The commit is checked before any phase runs so that a step resumed
+	// after approval does its work once.
+	if spec.Commit != nil && c.protection != nil {
+		workspaceID, _ := req.Workspace["id"].(string)
+		if _, err := c.protection.Check(protection.Operation{
+			WorkspaceID: workspaceID, Operation: protection.OpCommit, Branch: branch, Source: ConnectorCode,
+			TaskID: req.TaskID, WorkflowRunID: req.WorkflowRunID, StepRunID: req.StepRunID,
+		}); err != nil {
+			return protection.StepResult(err, map[string]any{"branch": branch, "worktree_path": worktree})
+		}
+	}
+
+	shell, err := sandbox.NewShell(req.JobID, req.WorkflowRunID, req.StepRunID, spec.Sandbox)
+	if err != nil {
+		return execution_backends.Result{}, err
+	}
+	defer shell.Close()
+	stopGuard, err := c.GuardShell(shell, req, ConnectorCode, worktree)
+	if err != nil {
+		return execution_backends.Result{}, err
+	}
+	defer stopGuard()
+
+	since := protection.Now()
+	run := &jobRun{log: jobLog{sink: req.Logs}, sh: shell}
+	phase, runErr := run.execute(ctx, spec, worktree, jobDir, req)
+	output := map[string]any{
+		"branch":        branch,
+		"worktree_path": worktree,
+		"commands":      run.commands,
+		"sandbox":       spec.Sandbox,
+	}
+	result := execution_backends.Result{Status: "succeeded", Output: output, Response: map[string]any{"runtime": ConnectorCode}}
+	if runErr != nil {
+		result.Status = "failed"
+		output["error"] = runErr.Error()
+		output["phase"] = phase
+		if run.limitHit != "" {
+			output["limit_hit"] = run.limitHit
+		}
+		fmt.Fprintf(&run.log, "!! %s failed: %v\n", phase, runErr)
+	} else if run.patch != nil && !run.patch.Applied {
+		output["summary"] = run.patch.Summary
+	} else {
+		output["summary"] = fmt.Sprintf("%d command(s) succeeded", len(run.commands))
+	}
+	if run.patch != nil {
+		output["patch"] = run.patch
+	}
+	output["head"] = headCommit(ctx, worktree)
+	c.RecordHead(req.WorkflowRunID, output["head"].(string))
+
+	reports, err := run.collectTestReports(spec.TestReports, jobDir, worktree)
+	if err != nil {
+		return execution_backends.Result{}, err
+	}
+	artifacts, err := run.writeArtifacts(ctx, jobDir, worktree)
+	if err != nil {
+		return execution_backends.Result{}, err
+	}
+	result.Artifacts = append(artifacts, reports...)
+	// A command stopped by a branch protection hook parks the step instead
+	// of failing it when the operation waits for approval.
+	if held := c.Held(req, since); held != nil {
+		parked, err := protection.StepResult(held, output)
+		if err != nil {
+			return execution_backends.Result{}, err
+		}
+		parked.Response, parked.Artifacts = result.Response, result.Artifacts
+		return parked, nil
+	}
+	return result, nil
+}
+
+func (run *jobRun) execute(ctx context.Context, spec StepSpec, worktree, jobDir string, req execution_backends.Request) (string, error) {
+	if spec.Patch != "" {
+		patchPath := filepath.Join(jobDir, "input.patch")
+		if err := os.WriteFile(patchPath, []byte(spec.Patch), 0644); err != nil {
+			return "patch", err
+		}
+		fmt.Fprintf(&run.log, "$ git apply --3way %s\n", patchPath)
+		rep, err := patches.Apply(ctx, worktree, []byte(spec.Patch))
+		if err != nil {
+			return "patch", err
+		}
+		run.patch = rep
+		if !rep.Applied {
+			run.log.WriteString(rep.Text())
+			if spec.OnConflict != OnConflictContinue {
+				return "patch", ErrPatchNotApplied
+			}
+			run.log.WriteString("-- on_conflict is continue: skipping the remaining phases\n")
+			return "", nil
+		}
+		run.log.WriteString(rep.Summary + "\n")
+	}
+	for _, cmd := range spec.Commands {
+		if err := run.shell(ctx, "command", cmd, worktree); err != nil {
+			return "command", err
+		}
+	}
+	for _, cmd := range spec.Verify {
+		if err := run.shell(ctx, "verify", cmd, worktree); err != nil {
+			return "verify", err
+		}
+	}
+	if _, err := git(ctx, worktree, "add", "-A"); err != nil {
+		return "diff", err
+	}
+	if spec.Commit != nil {
+		msg := spec.Commit.Message
+		if msg == "" {
+			name, _ := req.Step["name"].(string)
+			msg = "Bull Board: " + name
+		}
+		if out, _ := git(ctx, worktree, "diff", "--cached", "--name-only"); out == "" {
+			run.log.WriteString("nothing to commit\n")
+			return "", nil
+		}
+		fmt.Fprintf(&run.log, "$ git commit -m %q\n", msg)
+		out, err := git(ctx, worktree, "commit", "-m", msg)
+		run.log.WriteString(out)
+		if err != nil {
+			return "commit", err
+		}
+	}
+	return "", nil
+}
+
+func (run *jobRun) shell(ctx context.Context, phase, command, dir string) error {
+	report, err := run.sh.Run(ctx, phase, command, dir, &run.log)
+	run.commands = append(run.commands, report)
+	if err != nil {
+		if report.LimitHit != "" {
+			run.limitHit = report.LimitHit
+		}
+		return err
+	}
+	return nil
+}
+
+// writeArtifacts stores the job log, the step's diff against the previous commit and a JSON report.
+func (run *jobRun) writeArtifacts(ctx context.Context, jobDir, worktree string) ([]execution_backends.Artifact, error) {
+	diff, _ := git(ctx, worktree, "diff", "--cached", "HEAD")
+	if diff == "" {
+		diff, _ = git(ctx, worktree, "show", "--format=", "HEAD")
+	}
+	report, err := json.MarshalIndent(map[string]any{"commands": run.commands, "sandbox": run.sh.Config(), "limit_hit": run.limitHit}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	files := []struct {
+		kind, name string
+		data       []byte
+	}{
+		{"execution_log", "execution.log", run.log.Bytes()},
+		{"diff", "diff.patch", []byte(diff)},
+		{"report", "report.json", report},
+	}
+	if run.patch != nil {
+		data, err := json.MarshalIndent(run.patch, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, struct {
+			kind, name string
+			data       []byte
+		}{"patch_report", "patch-report.json", data})
+	}
+	var out []execution_backends.Artifact
+	for _, f := range files {
+		path := filepath.Join(jobDir, f.name)
+		if err := os.WriteFile(path, f.data, 0644); err != nil {
+			return nil, err
+		}
+		meta := map[string]any{"source": ConnectorCode, "size": len(f.data)}
+		if f.kind == "patch_report" {
+			meta["applied"] = run.patch.Applied
+		}
+		out = append(out, execution_backends.Artifact{Kind: f.kind, URI: "file://" + path, Metadata: meta})
+	}
+	return out, nil
+}
+
+// collectTestReports copies the report files matched by specs from the
+// worktree into the job directory as test_report artifacts. Missing files
+// are noted in the log; a step that wrote no report is judged by the step's
+// test conditions, not here.
+func (run *jobRun) collectTestReports(specs []TestReportSpec, jobDir, worktree string) ([]execution_backends.Artifact, error) {
+	var out []execution_backends.Artifact
+	root, err := filepath.EvalSymlinks(worktree)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	for _, spec := range specs {
+		matches, _ := filepath.Glob(filepath.Join(worktree, filepath.Clean(spec.Path)))
+		if len(matches) == 0 {
+			fmt.Fprintf(&run.log, "-- no test report matches %s\n", spec.Path)
+		}
+		for _, match := range matches {
+			// Glob follows symlinked directories; only files that resolve
+			// inside the worktree are read.
+			match, err := filepath.EvalSymlinks(match)
+			if err != nil || !strings.HasPrefix(match, root+string(filepath.Separator)) {
+				fmt.Fprintf(&run.log, "-- test report %s is outside the worktree\n", spec.Path)
+				continue
+			}
+			info, err := os.Stat(match)
+			if err != nil || !info.Mode().IsRegular() || seen[match] {
+				continue
+			}
+			seen[match] = true
+			rel, _ := filepath.Rel(root, match)
+			data, err := os.ReadFile(match)
+			if err != nil {
+				return nil, err
+			}
+			path := filepath.Join(jobDir, fmt.Sprintf("test-report-%d%s", len(out)+1, filepath.Ext(match)))
+			if err := os.WriteFile(path, data, 0644); err != nil {
+				return nil, err
+			}
+			out = append(out, execution_backends.Artifact{
+				Kind:     "test_report",
+				URI:      "file://" + path,
+				Metadata: map[string]any{"source": ConnectorCode, "path": filepath.ToSlash(rel), "format": spec.Format, "size": len(data)},
+			})
+		}
+	}
+	return out, nil
+}
+
+// Worktree returns the run's worktree and branch, creating them from the
+// workspace repo's default branch on first use.
+func (c *Connector) Worktree(ctx context.Context, req execution_backends.Request) (string, string, error) {
+	repoPath, _ := req.Workspace["repo_path"].(string)
+	baseBranch, _ := req.Workspace["default_branch"].(string)
+	wt, err := c.worktrees.Ensure(ctx, req.WorkflowRunID, repoPath, baseBranch)
+	if err != nil {
+		return "", "", err
+	}
+	return wt.Path, wt.Branch, nil
+}
+
+// RecordHead notes the commit a job left the run's worktree at.
+func (c *Connector) RecordHead(workflowRunID, head string) {
+	c.worktrees.RecordHead(workflowRunID, head)
+}
+
+// JobDir creates and returns the directory for a job's files.
+func (c *Connector) JobDir(jobID string) (string, error) {
+	dir := filepath.Join(c.dataDir, "artifacts", "jobs", jobID)
+	return dir, os.MkdirAll(dir, 0755)
+}
+
+// ArtifactRoots returns the job's directory and the run's worktree, where the
+// job's artifacts are written.
+func (c *Connector) ArtifactRoots(req execution_backends.Request) []string {
+	roots := []string{filepath.Join(c.dataDir, "artifacts", "jobs", req.JobID)}
+	if wt, err := c.worktrees.Get(req.WorkflowRunID); err == nil && wt.Path != "" {
+		roots = append(roots, wt.Path)
+	}
+	return roots
+}
+
+// ParseStepSpec merges the step template config with the step run input; input keys win.
+func ParseStepSpec(step map[string]any, input any) (StepSpec, error) {
+	merged := map[string]any{}
+	if cfg, ok := step["config"].(map[string]any); ok {
+		for k, v := range cfg {
+			merged[k] = v
+		}
+	}
+	if in, ok := input.(map[string]any); ok {
+		for k, v := range in {
+			merged[k] = v
+		}
+	}
+	raw, err := json.Marshal(merged)
+	if err != nil {
+		return StepSpec{}, err
+	}
+	var spec StepSpec
+	if err := json.Unmarshal(raw, &spec); err != nil {
+		return StepSpec{}, fmt.Errorf("invalid local step spec: %w", err)
+	}
+	for _, r := range spec.TestReports {
+		if err := r.validate(); err != nil {
+			return StepSpec{}, err
+		}
+	}
+	switch spec.OnConflict {
+	case "", OnConflictFail, OnConflictContinue:
+	default:
+		return StepSpec{}, fmt.Errorf("invalid local step spec: on_conflict must be %q or %q", OnConflictFail, OnConflictContinue)
+	}
+	// Limits come from the step template only so run input cannot loosen them.
+	cfg, _ := step["config"].(map[string]any)
+	if spec.Sandbox, err = sandbox.FromStepConfig(cfg); err != nil {
+		return StepSpec{}, err
+	}
+	return spec, nil
+}
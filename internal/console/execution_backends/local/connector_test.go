@@ -0,0 +1,357 @@
+package local
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/PonyDevAI/Bull-Board/internal/common"
+	"github.com/PonyDevAI/Bull-Board/internal/console/execution_backends"
+	"github.com/PonyDevAI/Bull-Board/internal/console/protection"
+	"github.com/PonyDevAI/Bull-Board/pkg/sandbox"
+)
+
+// The test binary doubles as the git guard the step commands' hooks run.
+func TestMain(m *testing.M) {
+	if len(os.Args) > 1 && os.Args[1] == "git-guard" {
+		os.Exit(protection.RunHook(os.Args[2:], os.Stdin, os.Stderr))
+	}
+	os.Exit(m.Run())
+}
+
+func testRepo(t *testing.T) string {
+	t.Helper()
+	ctx := context.Background()
+	repo := t.TempDir()
+	if _, err := git(ctx, repo, "init", "-b", "main"); err != nil {
+		t.Fatalf("git init: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(repo, "README.md"), []byte("hello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := git(ctx, repo, "add", "-A"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := git(ctx, repo, "commit", "-m", "init"); err != nil {
+		t.Fatalf("git commit: %v", err)
+	}
+	return repo
+}
+
+func testRequest(repo string, input map[string]any) execution_backends.Request {
+	return execution_backends.Request{
+		JobID:         "job-1",
+		WorkflowRunID: "run-1",
+		StepRunID:     "step-run-1",
+		Step:          map[string]any{"name": "Implement", "config": map[string]any{"verify": []any{"test -f README.md"}}},
+		Workspace:     map[string]any{"repo_path": repo, "default_branch": "main"},
+		Input:         input,
+	}
+}
+
+func TestExecuteAppliesPatchVerifiesAndCommits(t *testing.T) {
+	repo := testRepo(t)
+	dataDir := t.TempDir()
+	patch := "diff --git a/README.md b/README.md\n--- a/README.md\n+++ b/README.md\n@@ -1 +1,2 @@\n hello\n+world\n"
+	req := testRequest(repo, map[string]any{
+		"patch":    patch,
+		"commands": []any{"echo generated > out.txt"},
+		"commit":   map[string]any{"message": "apply change"},
+	})
+	var streamed strings.Builder
+	req.Logs = func(stream, content string) { streamed.WriteString(content) }
+	res, err := NewConnector(dataDir).Execute(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if res.Status != "succeeded" {
+		t.Fatalf("expected succeeded, got %s (%v)", res.Status, res.Output)
+	}
+	worktree := filepath.Join(dataDir, "worktrees", "run-1")
+	data, err := os.ReadFile(filepath.Join(worktree, "README.md"))
+	if err != nil || string(data) != "hello\nworld\n" {
+		t.Fatalf("patch not applied: %q %v", data, err)
+	}
+	subject, err := git(context.Background(), worktree, "log", "-1", "--format=%s", "bb/run-run-1")
+	if err != nil || strings.TrimSpace(subject) != "apply change" {
+		t.Fatalf("expected commit on run branch, got %q %v", subject, err)
+	}
+	kinds := map[string]string{}
+	for _, a := range res.Artifacts {
+		kinds[a.Kind] = strings.TrimPrefix(a.URI, "file://")
+	}
+	for _, kind := range []string{"execution_log", "diff", "report"} {
+		if _, err := os.Stat(kinds[kind]); err != nil {
+			t.Fatalf("missing %s artifact: %v", kind, err)
+		}
+	}
+	logData, _ := os.ReadFile(kinds["execution_log"])
+	if streamed.Len() == 0 || streamed.String() != string(logData) {
+		t.Fatalf("expected streamed output to match execution log, got %q vs %q", streamed.String(), logData)
+	}
+	diff, _ := os.ReadFile(kinds["diff"])
+	if !strings.Contains(string(diff), "+world") || !strings.Contains(string(diff), "out.txt") {
+		t.Fatalf("unexpected diff artifact: %s", diff)
+	}
+}
+
+func TestExecuteReportsFailedVerification(t *testing.T) {
+	repo := testRepo(t)
+	res, err := NewConnector(t.TempDir()).Execute(context.Background(), testRequest(repo, map[string]any{
+		"verify": []any{"echo broken; exit 3"},
+	}))
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if res.Status != "failed" {
+		t.Fatalf("expected failed, got %s", res.Status)
+	}
+	output := res.Output.(map[string]any)
+	if output["phase"] != "verify" {
+		t.Fatalf("expected verify phase failure, got %v", output["phase"])
+	}
+	commands := output["commands"].([]sandbox.CommandReport)
+	if len(commands) != 1 || commands[0].ExitCode != 3 {
+		t.Fatalf("unexpected command reports: %+v", commands)
+	}
+	log, _ := os.ReadFile(strings.TrimPrefix(res.Artifacts[0].URI, "file://"))
+	if !strings.Contains(string(log), "broken") {
+		t.Fatalf("log artifact missing command output: %s", log)
+	}
+}
+
+func TestExecuteCollectsTestReportsAfterFailedVerify(t *testing.T) {
+	repo := testRepo(t)
+	res, err := NewConnector(t.TempDir()).Execute(context.Background(), testRequest(repo, map[string]any{
+		"verify":       []any{"mkdir -p reports && printf '1..1\\nnot ok 1 - broken\\n' > reports/unit.tap && exit 1"},
+		"test_reports": []any{"reports/*.tap", map[string]any{"path": "missing.xml", "format": "junit"}},
+	}))
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if res.Status != "failed" {
+		t.Fatalf("expected failed, got %s", res.Status)
+	}
+	var reports []execution_backends.Artifact
+	for _, a := range res.Artifacts {
+		if a.Kind == "test_report" {
+			reports = append(reports, a)
+		}
+	}
+	if len(reports) != 1 || reports[0].Metadata["path"] != "reports/unit.tap" {
+		t.Fatalf("unexpected test report artifacts: %+v", reports)
+	}
+	data, err := os.ReadFile(strings.TrimPrefix(reports[0].URI, "file://"))
+	if err != nil || !strings.Contains(string(data), "not ok 1") {
+		t.Fatalf("report content %q, %v", data, err)
+	}
+
+	for _, bad := range []any{"../outside.xml", "/tmp/report.xml", map[string]any{"path": "r.xml", "format": "nunit"}} {
+		if _, err := ParseStepSpec(map[string]any{"config": map[string]any{"test_reports": []any{bad}}}, nil); err == nil {
+			t.Errorf("expected %v to be rejected", bad)
+		}
+	}
+}
+
+func TestExecuteIgnoresTestReportsOutsideWorktree(t *testing.T) {
+	repo := testRepo(t)
+	outside := t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "secret.xml"), []byte("<secret/>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	res, err := NewConnector(t.TempDir()).Execute(context.Background(), testRequest(repo, map[string]any{
+		"verify":       []any{"ln -s " + outside + " reports"},
+		"test_reports": []any{"reports/*.xml"},
+	}))
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	for _, a := range res.Artifacts {
+		if a.Kind == "test_report" {
+			t.Fatalf("collected a report through a symlinked directory: %+v", a)
+		}
+	}
+}
+
+func TestExecuteReportsPatchConflicts(t *testing.T) {
+	patch := "diff --git a/README.md b/README.md\n--- a/README.md\n+++ b/README.md\n@@ -1 +1 @@\n-goodbye\n+farewell\n"
+	for _, tc := range []struct {
+		onConflict, status string
+	}{{"", "failed"}, {OnConflictContinue, "succeeded"}} {
+		res, err := NewConnector(t.TempDir()).Execute(context.Background(), testRequest(testRepo(t), map[string]any{
+			"patch":       patch,
+			"on_conflict": tc.onConflict,
+			"commands":    []any{"echo ran > ran.txt"},
+		}))
+		if err != nil {
+			t.Fatalf("Execute: %v", err)
+		}
+		if res.Status != tc.status {
+			t.Fatalf("on_conflict %q: expected %s, got %s (%v)", tc.onConflict, tc.status, res.Status, res.Output)
+		}
+		output := res.Output.(map[string]any)
+		if commands := output["commands"].([]sandbox.CommandReport); len(commands) != 0 {
+			t.Fatalf("on_conflict %q: phases after the patch ran: %+v", tc.onConflict, commands)
+		}
+		var report *execution_backends.Artifact
+		for i, a := range res.Artifacts {
+			if a.Kind == "patch_report" {
+				report = &res.Artifacts[i]
+			}
+		}
+		if report == nil || report.Metadata["applied"] != false {
+			t.Fatalf("on_conflict %q: patch_report artifact = %+v", tc.onConflict, report)
+		}
+		data, _ := os.ReadFile(strings.TrimPrefix(report.URI, "file://"))
+		if !strings.Contains(string(data), `"reason": "context_mismatch"`) {
+			t.Fatalf("on_conflict %q: report = %s", tc.onConflict, data)
+		}
+	}
+
+	if _, err := ParseStepSpec(map[string]any{"config": map[string]any{"on_conflict": "ignore"}}, nil); err == nil {
+		t.Fatal("expected invalid on_conflict to be rejected")
+	}
+}
+
+func TestExecuteHoldsProtectedCommitForApproval(t *testing.T) {
+	t.Setenv("SQLITE_PATH", filepath.Join(t.TempDir(), "bb.sqlite"))
+	db, _, err := common.OpenDB("")
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+	store := protection.NewStore(db)
+	if _, err := store.SaveRule(protection.Rule{WorkspaceID: "ws", Pattern: "bb/**", AllowedOperations: []string{protection.OpPush}, OnViolation: protection.ViolationApproval}); err != nil {
+		t.Fatal(err)
+	}
+
+	repo := testRepo(t)
+	dataDir := t.TempDir()
+	req := testRequest(repo, map[string]any{
+		"commands": []any{"echo more >> README.md"},
+		"commit":   map[string]any{"message": "guarded change"},
+	})
+	req.Workspace["id"] = "ws"
+	c := NewConnector(dataDir)
+	c.SetProtection(store)
+
+	res, err := c.Execute(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if res.Status != execution_backends.StatusAwaitingApproval {
+		t.Fatalf("expected awaiting_approval, got %s (%v)", res.Status, res.Output)
+	}
+	output, _ := res.Output.(map[string]any)
+	attempt, ok := output["approval"].(protection.Attempt)
+	if !ok || attempt.ID == "" || attempt.Operation != protection.OpCommit || attempt.Branch != "bb/run-run-1" {
+		t.Fatalf("unexpected approval output: %#v", res.Output)
+	}
+	worktree := filepath.Join(dataDir, "worktrees", "run-1")
+	if data, _ := os.ReadFile(filepath.Join(worktree, "README.md")); string(data) != "hello\n" {
+		t.Fatalf("commands ran before approval: %q", data)
+	}
+
+	if _, err := store.Approve(attempt.ID, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	req.JobID = "job-2"
+	if res, err = c.Execute(context.Background(), req); err != nil || res.Status != "succeeded" {
+		t.Fatalf("Execute after approval = %s, %v (%v)", res.Status, err, res.Output)
+	}
+	subject, err := git(context.Background(), worktree, "log", "-1", "--format=%s", "bb/run-run-1")
+	if err != nil || strings.TrimSpace(subject) != "guarded change" {
+		t.Fatalf("expected commit on run branch, got %q %v", subject, err)
+	}
+	items, err := store.Attempts("ws", "", 0)
+	if err != nil || len(items) != 2 || items[0].Decision != protection.DecisionAllowed || items[1].Decision != protection.DecisionApproved {
+		t.Fatalf("attempts = %+v, %v", items, err)
+	}
+}
+
+func TestExecuteGuardsCommandGitOperations(t *testing.T) {
+	t.Setenv("SQLITE_PATH", filepath.Join(t.TempDir(), "bb.sqlite"))
+	db, _, err := common.OpenDB("")
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+	store := protection.NewStore(db)
+	if _, err := store.SaveRule(protection.Rule{WorkspaceID: "ws", Pattern: "release/**", OnViolation: protection.ViolationApproval}); err != nil {
+		t.Fatal(err)
+	}
+
+	repo := testRepo(t)
+	remote := filepath.Join(t.TempDir(), "remote.git")
+	if _, err := git(context.Background(), repo, "init", "-q", "--bare", remote); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := git(context.Background(), repo, "remote", "add", "origin", remote); err != nil {
+		t.Fatal(err)
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewConnector(t.TempDir())
+	c.SetProtection(store)
+	c.SetGitGuard([]string{exe, "git-guard"})
+
+	// Step commands never push, whatever the rules say.
+	req := testRequest(repo, map[string]any{"commands": []any{"git push -q origin HEAD:refs/heads/feature"}})
+	req.Workspace["id"] = "ws"
+	res, err := c.Execute(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if res.Status != "failed" {
+		t.Fatalf("expected command push to fail the step, got %s (%v)", res.Status, res.Output)
+	}
+	if _, err := git(context.Background(), remote, "rev-parse", "--verify", "feature"); err == nil {
+		t.Fatalf("command push reached the remote")
+	}
+	attempts, err := store.Attempts("ws", "", 10)
+	if err != nil || len(attempts) != 1 || attempts[0].Operation != protection.OpPush || attempts[0].Decision != protection.DecisionBlocked {
+		t.Fatalf("expected the push logged as blocked, got %+v, %v", attempts, err)
+	}
+
+	// A local update of a protected branch waits for approval.
+	req = testRequest(repo, map[string]any{"commands": []any{"git branch release/1"}})
+	req.JobID = "job-2"
+	req.Workspace["id"] = "ws"
+	if res, err = c.Execute(context.Background(), req); err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	output, _ := res.Output.(map[string]any)
+	attempt, ok := output["approval"].(protection.Attempt)
+	if res.Status != execution_backends.StatusAwaitingApproval || !ok || attempt.Operation != protection.OpCommit || attempt.Branch != "release/1" || attempt.Source != ConnectorCode {
+		t.Fatalf("expected branch update held for approval, got %s (%v)", res.Status, res.Output)
+	}
+	if _, err := git(context.Background(), repo, "rev-parse", "--verify", "release/1"); err == nil {
+		t.Fatalf("held update reached the branch")
+	}
+
+	if _, err := store.Approve(attempt.ID, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	req.JobID = "job-3"
+	if res, err = c.Execute(context.Background(), req); err != nil || res.Status != "succeeded" {
+		t.Fatalf("Execute after approval = %s, %v (%v)", res.Status, err, res.Output)
+	}
+	if _, err := git(context.Background(), repo, "rev-parse", "--verify", "release/1"); err != nil {
+		t.Fatalf("approved update did not reach the branch: %v", err)
+	}
+
+	// Going around the hooks does not keep the update either.
+	req = testRequest(repo, map[string]any{"commands": []any{"git -c core.hooksPath=/dev/null branch release/2"}})
+	req.JobID = "job-4"
+	req.Workspace["id"] = "ws"
+	if res, err = c.Execute(context.Background(), req); err != nil || res.Status != execution_backends.StatusAwaitingApproval {
+		t.Fatalf("Execute with unhooked update = %s, %v (%v)", res.Status, err, res.Output)
+	}
+	if _, err := git(context.Background(), repo, "rev-parse", "--verify", "release/2"); err == nil {
+		t.Fatalf("unhooked update was kept")
+	}
+}
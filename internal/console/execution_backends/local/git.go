@@ -0,0 +1,44 @@
+package local
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// gitIdentityEnv supplies a committer identity when the host has none configured.
+var gitIdentityEnv = []string{
+	"GIT_AUTHOR_NAME=Bull Board",
+	"GIT_AUTHOR_EMAIL=bull-board@localhost",
+	"GIT_COMMITTER_NAME=Bull Board",
+	"GIT_COMMITTER_EMAIL=bull-board@localhost",
+}
+
+func git(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Env = os.Environ()
+	for _, kv := range gitIdentityEnv {
+		if os.Getenv(strings.SplitN(kv, "=", 2)[0]) == "" {
+			cmd.Env = append(cmd.Env, kv)
+		}
+	}
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Run(); err != nil {
+		return out.String(), fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(out.String()))
+	}
+	return out.String(), nil
+}
+
+func headCommit(ctx context.Context, dir string) string {
+	out, err := git(ctx, dir, "rev-parse", "HEAD")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(out)
+}
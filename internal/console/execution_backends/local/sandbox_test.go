@@ -0,0 +1,41 @@
+package local
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/PonyDevAI/Bull-Board/pkg/sandbox"
+)
+
+func TestStepSpecSandboxIgnoresInput(t *testing.T) {
+	step := map[string]any{"config": map[string]any{"sandbox": map[string]any{"cpu_seconds": 5}}}
+	spec, err := ParseStepSpec(step, map[string]any{"sandbox": map[string]any{"cpu_seconds": -1}})
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if spec.Sandbox.CPUSeconds != 5 || spec.Sandbox.TimeoutSeconds != sandbox.Default.TimeoutSeconds {
+		t.Fatalf("unexpected sandbox %+v", spec.Sandbox)
+	}
+	if err := sandbox.ValidateStepConfig(`{"sandbox":{"cpu_seconds":"lots"}}`); !errors.Is(err, sandbox.ErrInvalid) {
+		t.Fatalf("expected sandbox.ErrInvalid, got %v", err)
+	}
+}
+
+func TestExecuteRecordsLimitHitInResult(t *testing.T) {
+	repo := testRepo(t)
+	req := testRequest(repo, nil)
+	req.Step["config"] = map[string]any{"verify": []any{"sleep 10"}, "sandbox": map[string]any{"timeout_seconds": 1}}
+	res, err := NewConnector(t.TempDir()).Execute(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	output := res.Output.(map[string]any)
+	if res.Status != "failed" || output["limit_hit"] != sandbox.LimitTimeout {
+		t.Fatalf("expected failed job with timeout limit, got %s %v", res.Status, output)
+	}
+	commands := output["commands"].([]sandbox.CommandReport)
+	if commands[len(commands)-1].LimitHit != sandbox.LimitTimeout {
+		t.Fatalf("expected command report to record the limit, got %+v", commands)
+	}
+}
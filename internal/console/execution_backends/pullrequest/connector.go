@@ -0,0 +1,302 @@
+// Package pullrequest implements the built-in "pull_request" execution
+// backend: the step pushes the run branch and opens, or on re-runs updates,
+// a pull request on the git host of the backend's integration instance.
+package pullrequest
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/PonyDevAI/Bull-Board/internal/console/execution_backends"
+	"github.com/PonyDevAI/Bull-Board/internal/console/githosting"
+	"github.com/PonyDevAI/Bull-Board/internal/console/protection"
+	"github.com/PonyDevAI/Bull-Board/internal/console/repos"
+	"github.com/PonyDevAI/Bull-Board/internal/console/worktrees"
+)
+
+const ConnectorCode = "pull_request"
+
+var (
+	ErrNoInstance = errors.New("pull_request backend has no git hosting integration instance")
+	ErrNoWorktree = errors.New("workflow run has no worktree to open a pull request from")
+	ErrNoRepo     = errors.New("no repository for pull request")
+)
+
+// StepSpec is read from the step template config and overridden by the step
+// run input. Repo defaults to the integration instance's repo, then to the
+// owner/name of the workspace remote; Base defaults to the branch the run's
+// worktree was cut from.
+type StepSpec struct {
+	Repo  string `json:"repo"`
+	Base  string `json:"base"`
+	Title string `json:"title"`
+}
+
+// Connector opens pull requests for runs.
+type Connector struct {
+	db         *sql.DB
+	worktrees  *worktrees.Manager
+	repos      *repos.Manager
+	pulls      *githosting.Store
+	protection *protection.Store
+}
+
+func NewConnector(db *sql.DB, wt *worktrees.Manager, rm *repos.Manager) *Connector {
+	return &Connector{db: db, worktrees: wt, repos: rm, pulls: githosting.NewStore(db), protection: protection.NewStore(db)}
+}
+
+// Health checks the instance's token against the host.
+func (c *Connector) Health(ctx context.Context, b execution_backends.Backend) error {
+	if b.IntegrationInstanceID == "" {
+		return fmt.Errorf("%w: %s", ErrNoInstance, b.ID)
+	}
+	inst, err := githosting.LoadInstance(c.db, b.IntegrationInstanceID)
+	if err != nil {
+		return err
+	}
+	return inst.Client().CheckAuth(ctx)
+}
+
+func (c *Connector) Execute(ctx context.Context, req execution_backends.Request) (execution_backends.Result, error) {
+	logf := func(format string, args ...any) {
+		if req.Logs != nil {
+			req.Logs("stdout", fmt.Sprintf(format, args...))
+		}
+	}
+	if req.Backend.IntegrationInstanceID == "" {
+		return execution_backends.Result{}, fmt.Errorf("%w: %s", ErrNoInstance, req.Backend.ID)
+	}
+	inst, err := githosting.LoadInstance(c.db, req.Backend.IntegrationInstanceID)
+	if err != nil {
+		return execution_backends.Result{}, err
+	}
+	spec, err := parseStepSpec(req.Step, req.Input)
+	if err != nil {
+		return execution_backends.Result{}, err
+	}
+	wt, err := c.worktrees.Get(req.WorkflowRunID)
+	if errors.Is(err, worktrees.ErrWorktreeNotFound) {
+		return execution_backends.Result{}, fmt.Errorf("%w: %s", ErrNoWorktree, req.WorkflowRunID)
+	}
+	if err != nil {
+		return execution_backends.Result{}, err
+	}
+	workspaceID, _ := req.Workspace["id"].(string)
+	repo, err := c.repoName(spec, inst, workspaceID)
+	if err != nil {
+		return execution_backends.Result{}, err
+	}
+	base := spec.Base
+	if base == "" {
+		base = wt.BaseBranch
+	}
+	client := inst.Client()
+
+	// A re-run of the task updates its open pull request: the new run's
+	// commits replace those on the pull request's head branch.
+	pr, found, err := c.pulls.Open(inst.ID, repo, req.TaskID, req.WorkflowRunID)
+	if err != nil {
+		return execution_backends.Result{}, err
+	}
+	if found {
+		pull, state, err := client.ReviewState(ctx, repo, pr.Number)
+		if err != nil && !errors.Is(err, githosting.ErrNotFound) {
+			return execution_backends.Result{}, err
+		}
+		if err == nil {
+			pr.Apply(pull, state)
+		}
+		if err != nil || pr.State != "open" {
+			if _, err := c.pulls.Save(markGone(pr, err)); err != nil {
+				return execution_backends.Result{}, err
+			}
+			pr, found = githosting.PullRequest{}, false
+		}
+	}
+	// Pushing a new branch is a push; replacing the commits of an open pull
+	// request's branch is a force push.
+	head, op := wt.Branch, protection.OpPush
+	if found {
+		head, op = pr.HeadBranch, protection.OpForcePush
+	}
+	if _, err := c.protection.Check(protection.Operation{
+		WorkspaceID: workspaceID, Operation: op, Branch: head, Source: ConnectorCode,
+		TaskID: req.TaskID, WorkflowRunID: req.WorkflowRunID, StepRunID: req.StepRunID,
+	}); err != nil {
+		return protection.StepResult(err, map[string]any{"repo": repo, "head": head, "base": base})
+	}
+	if op == protection.OpForcePush {
+		logf("$ git push --force origin %s:%s\n", wt.Branch, head)
+	} else {
+		logf("$ git push origin %s:%s\n", wt.Branch, head)
+	}
+	if err := c.push(ctx, workspaceID, wt, head, op == protection.OpForcePush); err != nil {
+		return execution_backends.Result{}, err
+	}
+
+	summary := c.describe(ctx, req, wt, spec)
+	input := githosting.PullInput{Title: summary.Title, Body: summary.Body, Head: head, Base: base}
+	action := "updated"
+	var pull githosting.Pull
+	if found {
+		pull, err = client.UpdatePull(ctx, repo, pr.Number, input)
+	} else {
+		// The branch may already have a pull request opened by hand.
+		var existing bool
+		pull, existing, err = client.FindOpenPull(ctx, repo, head, base)
+		switch {
+		case err != nil:
+		case existing:
+			pull, err = client.UpdatePull(ctx, repo, pull.Number, input)
+		default:
+			action = "created"
+			pull, err = client.CreatePull(ctx, repo, input)
+		}
+	}
+	if err != nil {
+		return execution_backends.Result{}, err
+	}
+	reviews, err := client.ListReviews(ctx, repo, pull.Number)
+	if err != nil {
+		return execution_backends.Result{}, err
+	}
+	pr.IntegrationInstanceID, pr.Repo, pr.WorkspaceID = inst.ID, repo, workspaceID
+	pr.TaskID, pr.WorkflowRunID = req.TaskID, req.WorkflowRunID
+	pr.Apply(pull, githosting.SummarizeReviews(pull, reviews))
+	if pr.HeadSHA == "" {
+		pr.HeadSHA = revParse(ctx, wt.RepoPath, "refs/heads/"+wt.Branch)
+	}
+	if pr, err = c.pulls.Save(pr); err != nil {
+		return execution_backends.Result{}, err
+	}
+	if req.TaskID != "" {
+		_, _ = c.db.Exec(`UPDATE legacy_tasks SET submit_state = 'pr_opened', updated_at = datetime('now') WHERE id = ?`, req.TaskID)
+	}
+	logf("pull request %s: %s (%s)\n", action, pr.URL, pr.ReviewState)
+
+	meta := map[string]any{
+		"source":          ConnectorCode,
+		"pull_request_id": pr.ID,
+		"repo":            repo,
+		"number":          pr.Number,
+		"head":            pr.HeadBranch,
+		"base":            pr.BaseBranch,
+		"review_state":    pr.ReviewState,
+	}
+	return execution_backends.Result{
+		Status: "succeeded",
+		Output: map[string]any{
+			"action":          action,
+			"pull_request_id": pr.ID,
+			"url":             pr.URL,
+			"number":          pr.Number,
+			"repo":            repo,
+			"head":            pr.HeadBranch,
+			"base":            pr.BaseBranch,
+			"head_sha":        pr.HeadSHA,
+			"review_state":    pr.ReviewState,
+			"summary":         fmt.Sprintf("pull request %s: %s", action, pr.URL),
+		},
+		Response:  map[string]any{"runtime": ConnectorCode},
+		Artifacts: []execution_backends.Artifact{{Kind: "pull_request", URI: pr.URL, Metadata: meta}},
+	}, nil
+}
+
+// markGone records that a pull request the host no longer has open, or no
+// longer has at all, will not be updated again.
+func markGone(pr githosting.PullRequest, err error) githosting.PullRequest {
+	if err != nil {
+		pr.State = "closed"
+		pr.ReviewState = githosting.ReviewClosed
+	}
+	return pr
+}
+
+func (c *Connector) repoName(spec StepSpec, inst githosting.Instance, workspaceID string) (string, error) {
+	name := spec.Repo
+	if name == "" {
+		name = inst.Repo
+	}
+	if name == "" && c.repos != nil {
+		if r, err := c.repos.Get(workspaceID); err == nil {
+			name, _ = githosting.RepoFromRemote(r.RemoteURL)
+		}
+	}
+	if name == "" {
+		return "", fmt.Errorf("%w: set repo in the step config or the integration instance metadata", ErrNoRepo)
+	}
+	if !githosting.ValidRepo(name) {
+		return "", fmt.Errorf("%w: %q", githosting.ErrInvalidRepo, name)
+	}
+	return name, nil
+}
+
+// push sends the run branch to head on the remote: through the workspace's
+// managed clone and deploy key when it has one, otherwise with git's own
+// credentials from the repository the worktree belongs to. Only a checked
+// force push replaces commits on the remote.
+func (c *Connector) push(ctx context.Context, workspaceID string, wt worktrees.Worktree, head string, force bool) error {
+	if c.repos != nil {
+		err := c.repos.Push(ctx, workspaceID, wt.Branch, head, force)
+		if !errors.Is(err, repos.ErrRepoNotFound) {
+			return err
+		}
+	}
+	spec := "refs/heads/" + wt.Branch + ":refs/heads/" + head
+	if force {
+		spec = "+" + spec
+	}
+	_, err := git(ctx, wt.RepoPath, "push", "--quiet", "origin", spec)
+	return err
+}
+
+func parseStepSpec(step map[string]any, input any) (StepSpec, error) {
+	merged := map[string]any{}
+	if cfg, ok := step["config"].(map[string]any); ok {
+		for k, v := range cfg {
+			merged[k] = v
+		}
+	}
+	if in, ok := input.(map[string]any); ok {
+		for k, v := range in {
+			merged[k] = v
+		}
+	}
+	raw, err := json.Marshal(merged)
+	if err != nil {
+		return StepSpec{}, err
+	}
+	var spec StepSpec
+	if err := json.Unmarshal(raw, &spec); err != nil {
+		return StepSpec{}, fmt.Errorf("invalid pull_request step spec: %w", err)
+	}
+	return spec, nil
+}
+
+func git(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Run(); err != nil {
+		return out.String(), fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(out.String()))
+	}
+	return out.String(), nil
+}
+
+func revParse(ctx context.Context, dir, ref string) string {
+	out, err := git(ctx, dir, "rev-parse", "--verify", "--quiet", ref)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(out)
+}
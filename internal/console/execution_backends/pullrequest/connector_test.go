@@ -0,0 +1,322 @@
+package pullrequest
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/PonyDevAI/Bull-Board/internal/common"
+	"github.com/PonyDevAI/Bull-Board/internal/console/execution_backends"
+	"github.com/PonyDevAI/Bull-Board/internal/console/githosting"
+	"github.com/PonyDevAI/Bull-Board/internal/console/repos"
+	"github.com/PonyDevAI/Bull-Board/internal/console/worktrees"
+)
+
+// fakeGitea serves the pull request endpoints of one repository under
+// /api/v1/repos/org/app and keeps pull requests and reviews in memory.
+type fakeGitea struct {
+	*httptest.Server
+	mu      sync.Mutex
+	pulls   []*githosting.Pull
+	reviews map[int][]githosting.Review
+}
+
+func newFakeGitea(t *testing.T) *fakeGitea {
+	f := &fakeGitea{reviews: map[int][]githosting.Review{}}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeGitea) serve(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r.Header.Get("Authorization") != "token secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = json.NewEncoder(w).Encode(map[string]string{"message": "token is required"})
+		return
+	}
+	rest, ok := strings.CutPrefix(r.URL.Path, "/api/v1/repos/org/app/pulls")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	parts := strings.Split(strings.Trim(rest, "/"), "/")
+	switch {
+	case rest == "" && r.Method == http.MethodGet:
+		open := []*githosting.Pull{}
+		if r.URL.Query().Get("page") == "1" {
+			for _, p := range f.pulls {
+				if p.State == "open" {
+					open = append(open, p)
+				}
+			}
+		}
+		_ = json.NewEncoder(w).Encode(open)
+	case rest == "" && r.Method == http.MethodPost:
+		var in githosting.PullInput
+		_ = json.NewDecoder(r.Body).Decode(&in)
+		n := len(f.pulls) + 1
+		p := &githosting.Pull{Number: n, HTMLURL: fmt.Sprintf("%s/org/app/pulls/%d", f.URL, n), State: "open", Title: in.Title, Body: in.Body,
+			Head: githosting.Ref{Ref: in.Head, SHA: "sha-" + strconv.Itoa(n)}, Base: githosting.Ref{Ref: in.Base}}
+		f.pulls = append(f.pulls, p)
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(p)
+	default:
+		n, _ := strconv.Atoi(parts[0])
+		if n < 1 || n > len(f.pulls) {
+			http.NotFound(w, r)
+			return
+		}
+		p := f.pulls[n-1]
+		switch {
+		case len(parts) == 2 && parts[1] == "reviews":
+			_ = json.NewEncoder(w).Encode(append([]githosting.Review{}, f.reviews[n]...))
+		case r.Method == http.MethodPatch:
+			var in githosting.PullInput
+			_ = json.NewDecoder(r.Body).Decode(&in)
+			p.Title, p.Body = in.Title, in.Body
+			_ = json.NewEncoder(w).Encode(p)
+		default:
+			_ = json.NewEncoder(w).Encode(p)
+		}
+	}
+}
+
+func (f *fakeGitea) pull(n int) githosting.Pull {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return *f.pulls[n-1]
+}
+
+func (f *fakeGitea) review(n int, login, state string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	r := githosting.Review{State: state}
+	r.User.Login = login
+	f.reviews[n] = append(f.reviews[n], r)
+}
+
+func mustGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	out, err := git(context.Background(), dir, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(out)
+}
+
+type fixture struct {
+	db        *sql.DB
+	host      *fakeGitea
+	origin    string
+	repo      string
+	worktrees *worktrees.Manager
+	conn      *Connector
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	t.Setenv("SQLITE_PATH", filepath.Join(t.TempDir(), "bb.sqlite"))
+	t.Setenv("BB_TEST_GITEA_TOKEN", "secret")
+	for _, k := range []string{"GIT_AUTHOR_NAME", "GIT_COMMITTER_NAME"} {
+		t.Setenv(k, "test")
+	}
+	for _, k := range []string{"GIT_AUTHOR_EMAIL", "GIT_COMMITTER_EMAIL"} {
+		t.Setenv(k, "test@example.com")
+	}
+	db, _, err := common.OpenDB("")
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	f := &fixture{db: db, host: newFakeGitea(t), origin: filepath.Join(t.TempDir(), "origin.git"), repo: t.TempDir()}
+	mustGit(t, "", "init", "--bare", "-b", "main", f.origin)
+	mustGit(t, f.repo, "init", "-b", "main")
+	writeFile(t, filepath.Join(f.repo, "README.md"), "hello\n")
+	mustGit(t, f.repo, "add", "-A")
+	mustGit(t, f.repo, "commit", "-m", "init")
+	mustGit(t, f.repo, "remote", "add", "origin", f.origin)
+	mustGit(t, f.repo, "push", "origin", "main")
+
+	seed := []string{
+		`INSERT INTO workspaces (id, home_id, name) VALUES ('ws', 'default', 'WS')`,
+		`INSERT INTO integration_instances (id, home_id, connector_code, name, endpoint, auth_config_json, metadata_json) VALUES ('gitea-1', 'default', 'gitea', 'Gitea', '` + f.host.URL + `', '{"token_env":"BB_TEST_GITEA_TOKEN"}', '{"repo":"org/app"}')`,
+		`INSERT INTO legacy_tasks (id, workspace_id, title, description, created_at, updated_at) VALUES ('task-1', 'ws', 'Add greeting', 'Say hello in the README.', datetime('now'), datetime('now'))`,
+		`INSERT INTO workflow_templates (id, workspace_id, name) VALUES ('tpl', 'ws', 'Pipeline')`,
+		`INSERT INTO workflow_step_templates (id, workflow_template_id, name, step_type, step_order) VALUES ('plan', 'tpl', 'Plan', 'llm', 1)`,
+		`INSERT INTO workflow_step_templates (id, workflow_template_id, name, step_type, step_order) VALUES ('verify', 'tpl', 'Verify', 'local', 2)`,
+	}
+	for _, q := range seed {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatalf("seed %s: %v", q, err)
+		}
+	}
+	dataDir := t.TempDir()
+	f.worktrees = worktrees.NewManager(db, dataDir, common.WorktreeConfig{})
+	f.conn = NewConnector(db, f.worktrees, repos.NewManager(db, dataDir, nil))
+	return f
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// run creates a run of task-1 whose plan step completed and whose worktree
+// has one commit writing content to README.md.
+func (f *fixture) run(t *testing.T, id, content string) execution_backends.Request {
+	t.Helper()
+	for _, q := range []string{
+		`INSERT INTO workflow_runs (id, workspace_id, workflow_template_id, task_id, status) VALUES ('` + id + `', 'ws', 'tpl', 'task-1', 'running')`,
+		`INSERT INTO step_runs (id, workflow_run_id, workflow_step_template_id, status, output_json, finished_at) VALUES ('` + id + `-plan', '` + id + `', 'plan', 'completed', '{"content":"1. Edit README.md"}', datetime('now'))`,
+		`INSERT INTO step_runs (id, workflow_run_id, workflow_step_template_id, status, test_totals_json) VALUES ('` + id + `-verify', '` + id + `', 'verify', 'completed', '{"total":3,"passed":2,"skipped":1}')`,
+	} {
+		if _, err := f.db.Exec(q); err != nil {
+			t.Fatalf("seed run: %v", err)
+		}
+	}
+	wt, err := f.worktrees.Ensure(context.Background(), id, f.repo, "main")
+	if err != nil {
+		t.Fatalf("worktree: %v", err)
+	}
+	writeFile(t, filepath.Join(wt.Path, "README.md"), content)
+	mustGit(t, wt.Path, "commit", "-am", "update readme")
+	return execution_backends.Request{
+		JobID: "job-" + id, WorkflowRunID: id, TaskID: "task-1",
+		Workspace: map[string]any{"id": "ws", "repo_path": f.repo, "default_branch": "main"},
+		Step:      map[string]any{"name": "Open PR", "config": map[string]any{}},
+		Backend:   execution_backends.Backend{ID: "pr", ConnectorCode: ConnectorCode, IntegrationInstanceID: "gitea-1"},
+	}
+}
+
+func TestExecuteOpensThenUpdatesPullRequest(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+
+	res, err := f.conn.Execute(ctx, f.run(t, "run-1", "hello world\n"))
+	if err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	out := res.Output.(map[string]any)
+	if out["action"] != "created" || out["number"] != 1 || out["head"] != "bb/run-run-1" || out["base"] != "main" || out["review_state"] != githosting.ReviewPending {
+		t.Fatalf("output %+v", out)
+	}
+	pull := f.host.pull(1)
+	if len(res.Artifacts) != 1 || res.Artifacts[0].Kind != "pull_request" || res.Artifacts[0].URI != pull.HTMLURL {
+		t.Fatalf("artifacts %+v, want %s", res.Artifacts, pull.HTMLURL)
+	}
+	if pull.Title != "Add greeting" {
+		t.Fatalf("title %q", pull.Title)
+	}
+	for _, want := range []string{"Say hello in the README.", "1. Edit README.md", "2 passed, 0 failed, 0 errors, 1 skipped (3 total)", "1 files changed, +1 −1", "`run-1`"} {
+		if !strings.Contains(pull.Body, want) {
+			t.Errorf("body missing %q:\n%s", want, pull.Body)
+		}
+	}
+	want := mustGit(t, f.repo, "rev-parse", "bb/run-run-1")
+	if got := mustGit(t, f.origin, "rev-parse", "refs/heads/bb/run-run-1"); got != want {
+		t.Fatalf("pushed %s, want %s", got, want)
+	}
+	var submitState string
+	if err := f.db.QueryRow(`SELECT submit_state FROM legacy_tasks WHERE id = 'task-1'`).Scan(&submitState); err != nil || submitState != "pr_opened" {
+		t.Fatalf("submit_state %q, %v", submitState, err)
+	}
+
+	// A re-run pushes its commits onto the open pull request's branch.
+	f.host.review(1, "alice", "APPROVED")
+	f.host.review(1, "bob", "REQUEST_CHANGES")
+	res, err = f.conn.Execute(ctx, f.run(t, "run-2", "hello again\n"))
+	if err != nil {
+		t.Fatalf("re-run: %v", err)
+	}
+	out = res.Output.(map[string]any)
+	if out["action"] != "updated" || out["number"] != 1 || out["head"] != "bb/run-run-1" || out["review_state"] != githosting.ReviewChangesRequested {
+		t.Fatalf("re-run output %+v", out)
+	}
+	want = mustGit(t, f.repo, "rev-parse", "bb/run-run-2")
+	if got := mustGit(t, f.origin, "rev-parse", "refs/heads/bb/run-run-1"); got != want {
+		t.Fatalf("pull request branch at %s, want %s", got, want)
+	}
+	if body := f.host.pull(1).Body; !strings.Contains(body, "`run-2`") {
+		t.Fatalf("body not updated:\n%s", body)
+	}
+	prs, err := githosting.NewStore(f.db).ForTask("task-1")
+	if err != nil || len(prs) != 1 || prs[0].WorkflowRunID != "run-2" || prs[0].ReviewState != githosting.ReviewChangesRequested {
+		t.Fatalf("pull requests %+v, %v", prs, err)
+	}
+
+	// Once it is closed the next run opens a new one.
+	f.host.mu.Lock()
+	f.host.pulls[0].State = "closed"
+	f.host.mu.Unlock()
+	res, err = f.conn.Execute(ctx, f.run(t, "run-3", "third\n"))
+	if err != nil {
+		t.Fatalf("run after close: %v", err)
+	}
+	out = res.Output.(map[string]any)
+	if out["action"] != "created" || out["number"] != 2 || out["head"] != "bb/run-run-3" {
+		t.Fatalf("output after close %+v", out)
+	}
+	prs, _ = githosting.NewStore(f.db).ForTask("task-1")
+	if len(prs) != 2 {
+		t.Fatalf("pull requests %+v", prs)
+	}
+	for _, p := range prs {
+		if (p.Number == 1) != (p.State == "closed") {
+			t.Errorf("pull request %d state %s", p.Number, p.State)
+		}
+	}
+}
+
+func TestExecutePushDoesNotOverwriteRemoteCommits(t *testing.T) {
+	f := newFixture(t)
+	// The run branch already exists on the remote with a commit the run
+	// does not have, and no pull request is open for it.
+	other := t.TempDir()
+	mustGit(t, "", "clone", "-q", f.origin, other)
+	mustGit(t, other, "checkout", "-q", "-b", "bb/run-run-1")
+	writeFile(t, filepath.Join(other, "NOTES.md"), "theirs\n")
+	mustGit(t, other, "add", "-A")
+	mustGit(t, other, "commit", "-m", "theirs")
+	mustGit(t, other, "push", "-q", "origin", "bb/run-run-1")
+	theirs := mustGit(t, other, "rev-parse", "HEAD")
+
+	if _, err := f.conn.Execute(context.Background(), f.run(t, "run-1", "hello world\n")); err == nil {
+		t.Fatalf("expected the push to be refused")
+	}
+	if got := mustGit(t, f.origin, "rev-parse", "refs/heads/bb/run-run-1"); got != theirs {
+		t.Fatalf("remote branch moved to %s, want %s", got, theirs)
+	}
+}
+
+func TestExecuteRequiresWorktreeAndToken(t *testing.T) {
+	f := newFixture(t)
+	req := f.run(t, "run-1", "x\n")
+	req.WorkflowRunID = "other"
+	if _, err := f.conn.Execute(context.Background(), req); !errors.Is(err, ErrNoWorktree) {
+		t.Fatalf("expected ErrNoWorktree, got %v", err)
+	}
+	t.Setenv("BB_TEST_GITEA_TOKEN", "wrong")
+	req.WorkflowRunID = "run-1"
+	_, err := f.conn.Execute(context.Background(), req)
+	var apiErr *githosting.APIError
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusUnauthorized {
+		t.Fatalf("expected 401 from host, got %v", err)
+	}
+	if err := f.conn.Health(context.Background(), req.Backend); err == nil {
+		t.Fatal("health passed with a rejected token")
+	}
+}
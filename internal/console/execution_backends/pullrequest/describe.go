@@ -0,0 +1,128 @@
+package pullrequest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/PonyDevAI/Bull-Board/internal/console/diffs"
+	"github.com/PonyDevAI/Bull-Board/internal/console/execution_backends"
+	"github.com/PonyDevAI/Bull-Board/internal/console/testreports"
+	"github.com/PonyDevAI/Bull-Board/internal/console/worktrees"
+)
+
+// maxPlan bounds the plan summary quoted in a pull request body.
+const maxPlan = 4000
+
+// Summary is the generated title and body of a run's pull request.
+type Summary struct {
+	Title string
+	Body  string
+}
+
+// describe writes the pull request for a run: the task, the output of its
+// latest completed plan step (a step whose name contains "plan"), the test
+// totals of its latest step that reported tests and the stats of the diff
+// from the worktree's base commit to the run branch.
+func (c *Connector) describe(ctx context.Context, req execution_backends.Request, wt worktrees.Worktree, spec StepSpec) Summary {
+	var taskTitle, taskDesc string
+	if req.TaskID != "" {
+		_ = c.db.QueryRow(`SELECT title, description FROM legacy_tasks WHERE id = ?`, req.TaskID).Scan(&taskTitle, &taskDesc)
+	}
+	s := Summary{Title: spec.Title}
+	if s.Title == "" {
+		s.Title = taskTitle
+	}
+	if s.Title == "" {
+		s.Title = "Bull Board run " + shortID(req.WorkflowRunID)
+	}
+
+	var b strings.Builder
+	if taskTitle != "" {
+		fmt.Fprintf(&b, "## Task\n\n**%s**\n", taskTitle)
+		if d := strings.TrimSpace(taskDesc); d != "" {
+			fmt.Fprintf(&b, "\n%s\n", d)
+		}
+		b.WriteString("\n")
+	}
+	if plan := c.planSummary(req.WorkflowRunID); plan != "" {
+		fmt.Fprintf(&b, "## Plan\n\n%s\n\n", plan)
+	}
+	b.WriteString("## Tests\n\n")
+	if t, ok := c.testTotals(req.WorkflowRunID); ok {
+		fmt.Fprintf(&b, "%d passed, %d failed, %d errors, %d skipped (%d total)\n\n", t.Passed, t.Failed, t.Errors, t.Skipped, t.Total)
+	} else {
+		b.WriteString("No test reports.\n\n")
+	}
+	b.WriteString("## Changes\n\n")
+	if st, ok := diffStats(ctx, wt); ok {
+		fmt.Fprintf(&b, "%d files changed, +%d −%d (%d added, %d modified, %d deleted, %d renamed, %d binary)\n\n",
+			st.Files, st.Additions, st.Deletions, st.Added, st.Modified, st.Deleted, st.Renamed, st.BinaryFiles)
+	} else {
+		b.WriteString("Diff unavailable.\n\n")
+	}
+	fmt.Fprintf(&b, "---\nOpened by Bull Board for workflow run `%s` (branch `%s`).\n", req.WorkflowRunID, wt.Branch)
+	s.Body = b.String()
+	return s
+}
+
+func (c *Connector) planSummary(runID string) string {
+	var outputJSON string
+	err := c.db.QueryRow(`SELECT sr.output_json FROM step_runs sr JOIN workflow_step_templates wst ON wst.id = sr.workflow_step_template_id
+		WHERE sr.workflow_run_id = ? AND sr.status = 'completed' AND LOWER(wst.name) LIKE '%plan%' ORDER BY sr.finished_at DESC, sr.updated_at DESC LIMIT 1`, runID).Scan(&outputJSON)
+	if err != nil {
+		return ""
+	}
+	var out map[string]any
+	_ = json.Unmarshal([]byte(outputJSON), &out)
+	var text string
+	for _, k := range []string{"summary", "content", "plan"} {
+		if v, _ := out[k].(string); strings.TrimSpace(v) != "" {
+			text = strings.TrimSpace(v)
+			break
+		}
+	}
+	if len(text) > maxPlan {
+		text = strings.ToValidUTF8(text[:maxPlan], "") + "…"
+	}
+	return text
+}
+
+func (c *Connector) testTotals(runID string) (testreports.Totals, bool) {
+	rows, err := c.db.Query(`SELECT test_totals_json FROM step_runs WHERE workflow_run_id = ? ORDER BY created_at DESC`, runID)
+	if err != nil {
+		return testreports.Totals{}, false
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var raw string
+		var t testreports.Totals
+		if rows.Scan(&raw) == nil && json.Unmarshal([]byte(raw), &t) == nil && t.Total > 0 {
+			return t, true
+		}
+	}
+	return testreports.Totals{}, false
+}
+
+func diffStats(ctx context.Context, wt worktrees.Worktree) (diffs.Stats, bool) {
+	if wt.BaseCommit == "" {
+		return diffs.Stats{}, false
+	}
+	out, err := git(ctx, wt.RepoPath, "diff", wt.BaseCommit, "refs/heads/"+wt.Branch)
+	if err != nil {
+		return diffs.Stats{}, false
+	}
+	d, err := diffs.ParseString(out)
+	if err != nil {
+		return diffs.Stats{}, false
+	}
+	return d.Stats, true
+}
+
+func shortID(id string) string {
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
+}
@@ -0,0 +1,273 @@
+// Package githosting talks to git hosting services with a Gitea/GitHub
+// compatible REST API: it opens and updates pull requests for run branches
+// and reads back their review state. Pull requests opened for runs are kept
+// in the pull_requests table.
+package githosting
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Review states of a pull request, as recorded in pull_requests.review_state.
+const (
+	ReviewPending          = "pending"
+	ReviewApproved         = "approved"
+	ReviewChangesRequested = "changes_requested"
+	ReviewMerged           = "merged"
+	ReviewClosed           = "closed"
+)
+
+// maxPages bounds the open pull requests scanned for a head branch.
+const maxPages = 20
+
+const perPage = 50
+
+var (
+	ErrInvalidRepo = errors.New("invalid repository name")
+	ErrNotFound    = errors.New("not found on git host")
+)
+
+// APIError is a non-2xx response from the git host.
+type APIError struct {
+	Status  int
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("git host returned %d: %s", e.Status, e.Message)
+}
+
+// Pull is a pull request as both APIs return it.
+type Pull struct {
+	Number   int        `json:"number"`
+	HTMLURL  string     `json:"html_url"`
+	State    string     `json:"state"`
+	Title    string     `json:"title"`
+	Body     string     `json:"body"`
+	Merged   bool       `json:"merged"`
+	MergedAt *time.Time `json:"merged_at"`
+	Head     Ref        `json:"head"`
+	Base     Ref        `json:"base"`
+}
+
+type Ref struct {
+	Ref string `json:"ref"`
+	SHA string `json:"sha"`
+}
+
+// IsMerged covers GitHub list responses, which carry merged_at only.
+func (p Pull) IsMerged() bool { return p.Merged || p.MergedAt != nil }
+
+// Review is one submitted review. GitHub reports CHANGES_REQUESTED and
+// COMMENTED where Gitea reports REQUEST_CHANGES and COMMENT.
+type Review struct {
+	ID    int64  `json:"id"`
+	State string `json:"state"`
+	User  struct {
+		Login string `json:"login"`
+	} `json:"user"`
+}
+
+// PullInput is the body of a create or update request. Head and Base are
+// ignored on update.
+type PullInput struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+	Head  string `json:"head,omitempty"`
+	Base  string `json:"base,omitempty"`
+}
+
+// Client calls one git host with a token.
+type Client struct {
+	BaseURL string
+	Token   string
+	HTTP    *http.Client
+}
+
+func NewClient(baseURL, token string) *Client {
+	return &Client{BaseURL: strings.TrimRight(baseURL, "/"), Token: token, HTTP: &http.Client{Timeout: 30 * time.Second}}
+}
+
+var repoName = regexp.MustCompile(`^[A-Za-z0-9_.-]+/[A-Za-z0-9_.-]+$`)
+
+// ValidRepo reports whether repo is an "owner/name" pair.
+func ValidRepo(repo string) bool {
+	return repoName.MatchString(repo) && !strings.Contains(repo, "..")
+}
+
+func (c *Client) do(ctx context.Context, method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Token != "" {
+		// Both hosts accept the "token" scheme for personal access tokens.
+		req.Header.Set("Authorization", "token "+c.Token)
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 8<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%w: %s %s", ErrNotFound, method, path)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var e struct {
+			Message string `json:"message"`
+		}
+		_ = json.Unmarshal(data, &e)
+		if e.Message == "" {
+			e.Message = strings.TrimSpace(string(data))
+		}
+		return &APIError{Status: resp.StatusCode, Message: e.Message}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+func pullsPath(repo string) (string, error) {
+	if !ValidRepo(repo) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidRepo, repo)
+	}
+	return "/repos/" + repo + "/pulls", nil
+}
+
+// CheckAuth fetches the token's user.
+func (c *Client) CheckAuth(ctx context.Context) error {
+	return c.do(ctx, http.MethodGet, "/user", nil, &struct{}{})
+}
+
+// FindOpenPull returns the open pull request from head into base, if any.
+// Gitea has no head filter on the list endpoint, so open pull requests are
+// paged through and matched here.
+func (c *Client) FindOpenPull(ctx context.Context, repo, head, base string) (Pull, bool, error) {
+	path, err := pullsPath(repo)
+	if err != nil {
+		return Pull{}, false, err
+	}
+	for page := 1; page <= maxPages; page++ {
+		var pulls []Pull
+		if err := c.do(ctx, http.MethodGet, fmt.Sprintf("%s?state=open&page=%d&per_page=%d&limit=%d", path, page, perPage, perPage), nil, &pulls); err != nil {
+			return Pull{}, false, err
+		}
+		for _, p := range pulls {
+			if p.Head.Ref == head && (base == "" || p.Base.Ref == base) {
+				return p, true, nil
+			}
+		}
+		if len(pulls) < perPage {
+			break
+		}
+	}
+	return Pull{}, false, nil
+}
+
+func (c *Client) GetPull(ctx context.Context, repo string, number int) (Pull, error) {
+	path, err := pullsPath(repo)
+	if err != nil {
+		return Pull{}, err
+	}
+	var p Pull
+	return p, c.do(ctx, http.MethodGet, fmt.Sprintf("%s/%d", path, number), nil, &p)
+}
+
+func (c *Client) CreatePull(ctx context.Context, repo string, in PullInput) (Pull, error) {
+	path, err := pullsPath(repo)
+	if err != nil {
+		return Pull{}, err
+	}
+	var p Pull
+	return p, c.do(ctx, http.MethodPost, path, in, &p)
+}
+
+// UpdatePull replaces the title and body of a pull request.
+func (c *Client) UpdatePull(ctx context.Context, repo string, number int, in PullInput) (Pull, error) {
+	path, err := pullsPath(repo)
+	if err != nil {
+		return Pull{}, err
+	}
+	var p Pull
+	return p, c.do(ctx, http.MethodPatch, fmt.Sprintf("%s/%d", path, number), PullInput{Title: in.Title, Body: in.Body}, &p)
+}
+
+func (c *Client) ListReviews(ctx context.Context, repo string, number int) ([]Review, error) {
+	path, err := pullsPath(repo)
+	if err != nil {
+		return nil, err
+	}
+	var reviews []Review
+	return reviews, c.do(ctx, http.MethodGet, fmt.Sprintf("%s/%d/reviews", path, number), nil, &reviews)
+}
+
+// ReviewState reads a pull request and its reviews and sums them up.
+func (c *Client) ReviewState(ctx context.Context, repo string, number int) (Pull, string, error) {
+	p, err := c.GetPull(ctx, repo, number)
+	if err != nil {
+		return p, "", err
+	}
+	reviews, err := c.ListReviews(ctx, repo, number)
+	if err != nil {
+		return p, "", err
+	}
+	return p, SummarizeReviews(p, reviews), nil
+}
+
+// SummarizeReviews gives a merged or closed pull request that state;
+// otherwise each reviewer's latest approval or change request counts and
+// one request for changes outweighs any approvals. Comments do not change
+// a reviewer's verdict; a dismissal clears it.
+func SummarizeReviews(p Pull, reviews []Review) string {
+	switch {
+	case p.IsMerged():
+		return ReviewMerged
+	case p.State == "closed":
+		return ReviewClosed
+	}
+	verdicts := map[string]string{}
+	for _, r := range reviews {
+		switch strings.ToUpper(r.State) {
+		case "APPROVED":
+			verdicts[r.User.Login] = ReviewApproved
+		case "CHANGES_REQUESTED", "REQUEST_CHANGES":
+			verdicts[r.User.Login] = ReviewChangesRequested
+		case "DISMISSED":
+			delete(verdicts, r.User.Login)
+		}
+	}
+	state := ReviewPending
+	for _, v := range verdicts {
+		if v == ReviewChangesRequested {
+			return ReviewChangesRequested
+		}
+		state = ReviewApproved
+	}
+	return state
+}
@@ -0,0 +1,87 @@
+package githosting
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/PonyDevAI/Bull-Board/internal/common"
+)
+
+func review(login, state string) Review {
+	r := Review{State: state}
+	r.User.Login = login
+	return r
+}
+
+func TestSummarizeReviews(t *testing.T) {
+	merged := time.Now()
+	for name, tc := range map[string]struct {
+		pull    Pull
+		reviews []Review
+		want    string
+	}{
+		"none":               {Pull{State: "open"}, nil, ReviewPending},
+		"comments only":      {Pull{State: "open"}, []Review{review("a", "COMMENT"), review("b", "COMMENTED")}, ReviewPending},
+		"approved":           {Pull{State: "open"}, []Review{review("a", "APPROVED"), review("b", "COMMENTED")}, ReviewApproved},
+		"changes outweigh":   {Pull{State: "open"}, []Review{review("a", "APPROVED"), review("b", "REQUEST_CHANGES")}, ReviewChangesRequested},
+		"latest verdict":     {Pull{State: "open"}, []Review{review("a", "CHANGES_REQUESTED"), review("a", "COMMENTED"), review("a", "APPROVED")}, ReviewApproved},
+		"dismissed":          {Pull{State: "open"}, []Review{review("a", "CHANGES_REQUESTED"), review("a", "DISMISSED")}, ReviewPending},
+		"merged":             {Pull{State: "closed", Merged: true}, []Review{review("a", "APPROVED")}, ReviewMerged},
+		"merged github list": {Pull{State: "closed", MergedAt: &merged}, nil, ReviewMerged},
+		"closed":             {Pull{State: "closed"}, []Review{review("a", "APPROVED")}, ReviewClosed},
+	} {
+		if got := SummarizeReviews(tc.pull, tc.reviews); got != tc.want {
+			t.Errorf("%s: %s, want %s", name, got, tc.want)
+		}
+	}
+}
+
+func TestRepoFromRemote(t *testing.T) {
+	for remote, want := range map[string]string{
+		"git@github.com:org/app.git":          "org/app",
+		"ssh://git@gitea.local:2222/org/app":  "org/app",
+		"https://gitea.local/org/app.git":     "org/app",
+		"https://gitea.local/sub/org/my.app/": "org/my.app",
+		"app.git":                             "",
+		"https://gitea.local/org/app?x=1":     "",
+	} {
+		got, ok := RepoFromRemote(remote)
+		if got != want || ok != (want != "") {
+			t.Errorf("RepoFromRemote(%q) = %q, %t; want %q", remote, got, ok, want)
+		}
+	}
+}
+
+func TestLoadInstance(t *testing.T) {
+	t.Setenv("SQLITE_PATH", filepath.Join(t.TempDir(), "bb.sqlite"))
+	t.Setenv("BB_TEST_TOKEN", "secret")
+	db, _, err := common.OpenDB("")
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+	for _, q := range []string{
+		`INSERT INTO integration_instances (id, home_id, connector_code, name, endpoint, auth_config_json) VALUES ('gitea', 'default', 'gitea', 'Gitea', 'https://gitea.local/', '{"token_env":"BB_TEST_TOKEN"}')`,
+		`INSERT INTO integration_instances (id, home_id, connector_code, name, endpoint, metadata_json) VALUES ('gitea-api', 'default', 'gitea', 'Gitea', 'https://gitea.local/api/v1', '{"repo":"org/app"}')`,
+		`INSERT INTO integration_instances (id, home_id, connector_code, name) VALUES ('github', 'default', 'github', 'GitHub')`,
+		`INSERT INTO integration_instances (id, home_id, connector_code, name) VALUES ('llm', 'default', 'openai_compatible', 'Models')`,
+	} {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for id, want := range map[string]Instance{
+		"gitea":     {ID: "gitea", Code: CodeGitea, BaseURL: "https://gitea.local/api/v1", Token: "secret"},
+		"gitea-api": {ID: "gitea-api", Code: CodeGitea, BaseURL: "https://gitea.local/api/v1", Repo: "org/app"},
+		"github":    {ID: "github", Code: CodeGitHub, BaseURL: defaultGitHubAPI},
+	} {
+		got, err := LoadInstance(db, id)
+		if err != nil || got != want {
+			t.Errorf("LoadInstance(%s) = %+v, %v; want %+v", id, got, err, want)
+		}
+	}
+	if _, err := LoadInstance(db, "llm"); err == nil {
+		t.Error("loaded a model provider as git hosting")
+	}
+}
@@ -0,0 +1,91 @@
+package githosting
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Connector codes of git hosting integration instances.
+const (
+	CodeGitea  = "gitea"
+	CodeGitHub = "github"
+)
+
+const defaultGitHubAPI = "https://api.github.com"
+
+var (
+	ErrInstanceNotFound = errors.New("git hosting integration instance not found")
+	ErrNotGitHosting    = errors.New("integration instance is not a git hosting connector")
+)
+
+// Instance is a git hosting integration instance: endpoint is the API base
+// URL (a Gitea server URL gets /api/v1 appended, GitHub defaults to
+// api.github.com), auth_config_json {"token_env": "NAME"} names the
+// environment variable holding the token and metadata_json {"repo":
+// "owner/name"} optionally fixes the repository.
+type Instance struct {
+	ID      string
+	Code    string
+	BaseURL string
+	Token   string
+	Repo    string
+}
+
+func LoadInstance(db *sql.DB, id string) (Instance, error) {
+	inst := Instance{ID: id}
+	var authJSON, metaJSON string
+	err := db.QueryRow(`SELECT connector_code, COALESCE(endpoint,''), auth_config_json, metadata_json FROM integration_instances WHERE id = ?`, id).
+		Scan(&inst.Code, &inst.BaseURL, &authJSON, &metaJSON)
+	if err == sql.ErrNoRows {
+		return inst, fmt.Errorf("%w: %s", ErrInstanceNotFound, id)
+	}
+	if err != nil {
+		return inst, err
+	}
+	switch inst.Code {
+	case CodeGitHub:
+		if inst.BaseURL == "" {
+			inst.BaseURL = defaultGitHubAPI
+		}
+	case CodeGitea:
+		if u, err := url.Parse(inst.BaseURL); err == nil && !strings.Contains(u.Path, "/api/") {
+			inst.BaseURL = strings.TrimRight(inst.BaseURL, "/") + "/api/v1"
+		}
+	default:
+		return inst, fmt.Errorf("%w: %s is %q", ErrNotGitHosting, id, inst.Code)
+	}
+	var auth struct {
+		TokenEnv string `json:"token_env"`
+	}
+	_ = json.Unmarshal([]byte(authJSON), &auth)
+	if auth.TokenEnv != "" {
+		inst.Token = os.Getenv(auth.TokenEnv)
+	}
+	var meta struct {
+		Repo string `json:"repo"`
+	}
+	_ = json.Unmarshal([]byte(metaJSON), &meta)
+	inst.Repo = meta.Repo
+	return inst, nil
+}
+
+// Client returns a client for the instance.
+func (i Instance) Client() *Client { return NewClient(i.BaseURL, i.Token) }
+
+// remotePath matches the owner/name tail of ssh, scp-like and http remotes.
+var remotePath = regexp.MustCompile(`[:/]([A-Za-z0-9_.-]+/[A-Za-z0-9_.-]+?)(?:\.git)?/?$`)
+
+// RepoFromRemote derives "owner/name" from a git remote URL.
+func RepoFromRemote(remote string) (string, bool) {
+	m := remotePath.FindStringSubmatch(strings.TrimSpace(remote))
+	if m == nil || !ValidRepo(m[1]) {
+		return "", false
+	}
+	return m[1], true
+}
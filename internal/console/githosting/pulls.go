@@ -0,0 +1,151 @@
+package githosting
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/PonyDevAI/Bull-Board/internal/common"
+)
+
+var ErrPullRequestNotFound = errors.New("pull request not found")
+
+// PullRequest is a pull_requests row: a pull request opened for a task's
+// run. Re-runs of the task update the same row while the pull request is
+// open.
+type PullRequest struct {
+	ID                    string `json:"id"`
+	IntegrationInstanceID string `json:"integration_instance_id"`
+	Repo                  string `json:"repo"`
+	Number                int    `json:"number"`
+	URL                   string `json:"url"`
+	WorkspaceID           string `json:"workspace_id"`
+	TaskID                string `json:"task_id"`
+	WorkflowRunID         string `json:"workflow_run_id"`
+	HeadBranch            string `json:"head_branch"`
+	BaseBranch            string `json:"base_branch"`
+	HeadSHA               string `json:"head_sha"`
+	Title                 string `json:"title"`
+	State                 string `json:"state"`
+	ReviewState           string `json:"review_state"`
+	CheckedAt             string `json:"checked_at"`
+	CreatedAt             string `json:"created_at"`
+	UpdatedAt             string `json:"updated_at"`
+}
+
+// Store keeps pull_requests rows.
+type Store struct{ db *sql.DB }
+
+func NewStore(db *sql.DB) *Store { return &Store{db: db} }
+
+const pullColumns = `id, integration_instance_id, repo, number, url, workspace_id, task_id, workflow_run_id, head_branch, base_branch, head_sha, title, state, review_state, checked_at, created_at, updated_at`
+
+func (s *Store) query(where string, args ...any) ([]PullRequest, error) {
+	rows, err := s.db.Query(`SELECT `+pullColumns+` FROM pull_requests `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []PullRequest{}
+	for rows.Next() {
+		var p PullRequest
+		if err := rows.Scan(&p.ID, &p.IntegrationInstanceID, &p.Repo, &p.Number, &p.URL, &p.WorkspaceID, &p.TaskID, &p.WorkflowRunID,
+			&p.HeadBranch, &p.BaseBranch, &p.HeadSHA, &p.Title, &p.State, &p.ReviewState, &p.CheckedAt, &p.CreatedAt, &p.UpdatedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, p)
+	}
+	return items, rows.Err()
+}
+
+func (s *Store) Get(id string) (PullRequest, error) {
+	items, err := s.query(`WHERE id = ?`, id)
+	if err != nil {
+		return PullRequest{}, err
+	}
+	if len(items) == 0 {
+		return PullRequest{}, ErrPullRequestNotFound
+	}
+	return items[0], nil
+}
+
+// ForTask lists a task's pull requests, newest first.
+func (s *Store) ForTask(taskID string) ([]PullRequest, error) {
+	return s.query(`WHERE task_id = ? ORDER BY created_at DESC`, taskID)
+}
+
+// Open returns the open pull request a re-run should update: the task's on
+// that repository, or the run's when the run has no task.
+func (s *Store) Open(instanceID, repo, taskID, runID string) (PullRequest, bool, error) {
+	where, key := `task_id = ?`, taskID
+	if taskID == "" {
+		where, key = `workflow_run_id = ?`, runID
+	}
+	items, err := s.query(`WHERE integration_instance_id = ? AND repo = ? AND state = 'open' AND `+where+` ORDER BY updated_at DESC LIMIT 1`, instanceID, repo, key)
+	if err != nil || len(items) == 0 {
+		return PullRequest{}, false, err
+	}
+	return items[0], true, nil
+}
+
+// Save inserts or updates the row for the pull request's number.
+func (s *Store) Save(p PullRequest) (PullRequest, error) {
+	ts := time.Now().UTC().Format(time.RFC3339)
+	if p.ID == "" {
+		p.ID = common.UUID()
+		p.CreatedAt = ts
+	}
+	p.UpdatedAt = ts
+	_, err := s.db.Exec(`INSERT INTO pull_requests (`+pullColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(integration_instance_id, repo, number) DO UPDATE SET url = excluded.url, workspace_id = excluded.workspace_id, task_id = excluded.task_id,
+			workflow_run_id = excluded.workflow_run_id, head_branch = excluded.head_branch, base_branch = excluded.base_branch, head_sha = excluded.head_sha,
+			title = excluded.title, state = excluded.state, review_state = excluded.review_state, checked_at = excluded.checked_at, updated_at = excluded.updated_at`,
+		p.ID, p.IntegrationInstanceID, p.Repo, p.Number, p.URL, p.WorkspaceID, p.TaskID, p.WorkflowRunID,
+		p.HeadBranch, p.BaseBranch, p.HeadSHA, p.Title, p.State, p.ReviewState, p.CheckedAt, p.CreatedAt, p.UpdatedAt)
+	if err != nil {
+		return p, err
+	}
+	return p, s.db.QueryRow(`SELECT id, created_at FROM pull_requests WHERE integration_instance_id = ? AND repo = ? AND number = ?`, p.IntegrationInstanceID, p.Repo, p.Number).Scan(&p.ID, &p.CreatedAt)
+}
+
+// Apply copies what the host reports about a pull request into p.
+func (p *PullRequest) Apply(pull Pull, reviewState string) {
+	p.Number, p.URL, p.Title = pull.Number, pull.HTMLURL, pull.Title
+	if pull.Head.Ref != "" {
+		p.HeadBranch = pull.Head.Ref
+	}
+	if pull.Head.SHA != "" {
+		p.HeadSHA = pull.Head.SHA
+	}
+	if pull.Base.Ref != "" {
+		p.BaseBranch = pull.Base.Ref
+	}
+	p.State = "open"
+	switch {
+	case pull.IsMerged():
+		p.State = "merged"
+	case pull.State == "closed":
+		p.State = "closed"
+	}
+	p.ReviewState = reviewState
+	p.CheckedAt = time.Now().UTC().Format(time.RFC3339)
+}
+
+// Refresh reads a pull request's state and reviews back from its host.
+func (s *Store) Refresh(ctx context.Context, id string) (PullRequest, error) {
+	p, err := s.Get(id)
+	if err != nil {
+		return p, err
+	}
+	inst, err := LoadInstance(s.db, p.IntegrationInstanceID)
+	if err != nil {
+		return p, err
+	}
+	pull, state, err := inst.Client().ReviewState(ctx, p.Repo, p.Number)
+	if err != nil {
+		return p, err
+	}
+	p.Apply(pull, state)
+	return s.Save(p)
+}
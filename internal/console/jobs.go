@@ -1,3 +1,422 @@
 package console
 
 // Legacy pull/report runtime endpoints were removed in Bull-Board 2.0 cleanup.
+// Canonical jobs are created by step-run dispatch and read back here.
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PonyDevAI/Bull-Board/internal/console/execution"
+	"github.com/PonyDevAI/Bull-Board/internal/console/execution_backends"
+)
+
+// maxCallbackBody 限制单次 job 回调的请求体大小
+const maxCallbackBody = 8 << 20
+
+// apiJobRoutes 处理 GET /api/jobs、GET /api/jobs/:id、POST /api/jobs/:id/cancel、
+// GET /api/jobs/:id/logs、GET /api/jobs/:id/logs/stream、GET /api/jobs/:id/artifacts
+func (s *Server) apiJobRoutes(w http.ResponseWriter, r *http.Request) {
+	if s.db == nil {
+		writeJSONError(w, "db not configured", http.StatusServiceUnavailable)
+		return
+	}
+	path := r.URL.Path
+	if path == "/api/jobs" {
+		if r.Method != http.MethodGet {
+			http.Error(w, "", http.StatusMethodNotAllowed)
+			return
+		}
+		s.listJobs(w, r)
+		return
+	}
+	rest := strings.TrimPrefix(path, "/api/jobs/")
+	parts := strings.SplitN(rest, "/", 2)
+	jobID := parts[0]
+	if jobID == "" {
+		http.NotFound(w, r)
+		return
+	}
+	if len(parts) == 1 {
+		if r.Method != http.MethodGet {
+			http.Error(w, "", http.StatusMethodNotAllowed)
+			return
+		}
+		s.getJob(w, jobID)
+		return
+	}
+	if parts[1] == "logs" || parts[1] == "logs/stream" {
+		if r.Method != http.MethodGet {
+			http.Error(w, "", http.StatusMethodNotAllowed)
+			return
+		}
+		if parts[1] == "logs" {
+			s.jobLogs(w, r, jobID)
+		} else {
+			s.jobLogsStream(w, r, jobID)
+		}
+		return
+	}
+	if parts[1] == "artifacts" {
+		if r.Method != http.MethodGet {
+			http.Error(w, "", http.StatusMethodNotAllowed)
+			return
+		}
+		s.jobArtifacts(w, jobID)
+		return
+	}
+	if parts[1] == "cancel" {
+		if r.Method != http.MethodPost {
+			http.Error(w, "", http.StatusMethodNotAllowed)
+			return
+		}
+		s.cancelJob(w, r, jobID)
+		return
+	}
+	http.NotFound(w, r)
+}
+
+// cancelJob 取消运行中或排队中的 job；远端后端不支持取消时明确返回错误，job 保持原状态
+func (s *Server) cancelJob(w http.ResponseWriter, r *http.Request, jobID string) {
+	var body struct {
+		Reason string `json:"reason"`
+	}
+	if r.Body != nil {
+		_ = json.NewDecoder(io.LimitReader(r.Body, 64<<10)).Decode(&body)
+	}
+	reason := strings.TrimSpace(body.Reason)
+	if reason == "" {
+		reason = "cancelled by user"
+	}
+	status, err := s.execution.CancelJob(r.Context(), jobID, reason)
+	switch {
+	case err == nil:
+	case errors.Is(err, execution.ErrJobNotFound):
+		writeJSONError(w, "not found", http.StatusNotFound)
+		return
+	case errors.Is(err, execution.ErrJobNotActive), errors.Is(err, execution.ErrCancelUnsupported):
+		writeJSONError(w, err.Error(), http.StatusConflict)
+		return
+	case errors.Is(err, execution.ErrCancelFailed):
+		writeJSONError(w, err.Error(), http.StatusBadGateway)
+		return
+	default:
+		writeJSONError(w, "db", http.StatusInternalServerError)
+		return
+	}
+	if status == "cancelling" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+	}
+	writeJSON(w, map[string]any{"item": map[string]any{"job_id": jobID, "status": status}})
+}
+
+func (s *Server) listJobs(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	query := `SELECT id, step_run_id, COALESCE(execution_backend_id,'') AS execution_backend_id, COALESCE(external_job_ref,'') AS external_job_ref, status, started_at, finished_at, created_at, updated_at FROM jobs WHERE 1=1`
+	args := []any{}
+	if v := q.Get("step_run_id"); v != "" {
+		query += ` AND step_run_id = ?`
+		args = append(args, v)
+	}
+	if v := q.Get("status"); v != "" {
+		query += ` AND status = ?`
+		args = append(args, v)
+	}
+	query += ` ORDER BY created_at DESC LIMIT 200`
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		writeJSONError(w, "db", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	items, err := scanRows(rows)
+	if err != nil {
+		writeJSONError(w, "db", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]any{"items": items})
+}
+
+func (s *Server) getJob(w http.ResponseWriter, jobID string) {
+	rows, err := s.db.Query(`SELECT * FROM jobs WHERE id = ?`, jobID)
+	if err != nil {
+		writeJSONError(w, "db", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	items, err := scanRows(rows)
+	if err != nil {
+		writeJSONError(w, "db", http.StatusInternalServerError)
+		return
+	}
+	if len(items) == 0 {
+		writeJSONError(w, "not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, map[string]any{"item": items[0]})
+}
+
+// jobLogs 按字节偏移分页返回 job 日志：?offset=&limit=，下一页从 next_offset 继续
+func (s *Server) jobLogs(w http.ResponseWriter, r *http.Request, jobID string) {
+	q := r.URL.Query()
+	offset, _ := strconv.ParseInt(q.Get("offset"), 10, 64)
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	page, err := s.execution.ReadJobLog(jobID, offset, limit)
+	if err != nil {
+		if errors.Is(err, execution.ErrJobNotFound) {
+			writeJSONError(w, "not found", http.StatusNotFound)
+			return
+		}
+		writeJSONError(w, "db", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, page)
+}
+
+// jobLogsStream 以 SSE 推送 job 日志：先补发 offset（或 Last-Event-ID）之后的已有日志，再推送新日志；
+// 每条 log 事件的 id 为下一偏移，断线后可从该偏移续传；job 结束且日志发完后发送 end 事件
+func (s *Server) jobLogsStream(w http.ResponseWriter, r *http.Request, jobID string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	offsetParam := r.URL.Query().Get("offset")
+	if id := r.Header.Get("Last-Event-ID"); id != "" {
+		offsetParam = id
+	}
+	next, _ := strconv.ParseInt(offsetParam, 10, 64)
+
+	// 先订阅再补发，避免补发与订阅之间追加的日志丢失
+	sub, unsubscribe := s.bus.Subscribe(256)
+	defer unsubscribe()
+	if _, err := s.execution.ReadJobLog(jobID, next, 1); err != nil {
+		if errors.Is(err, execution.ErrJobNotFound) {
+			writeJSONError(w, "not found", http.StatusNotFound)
+			return
+		}
+		writeJSONError(w, "db", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	flusher.Flush()
+
+	writeEntry := func(e execution.JobLogEntry) {
+		data, _ := json.Marshal(e)
+		_, _ = fmt.Fprintf(w, "id: %d\nevent: log\ndata: %s\n\n", e.End(), data)
+		next = e.End()
+	}
+	// catchUp 从数据库补发 next 之后的日志，返回 job 是否已结束且日志已全部发出
+	catchUp := func() (bool, string) {
+		for {
+			page, err := s.execution.ReadJobLog(jobID, next, execution.MaxLogPageLimit)
+			if err != nil {
+				return true, ""
+			}
+			for _, e := range page.Entries {
+				writeEntry(e)
+			}
+			flusher.Flush()
+			if len(page.Entries) < execution.MaxLogPageLimit {
+				return page.Done, page.Status
+			}
+		}
+	}
+	end := func(status string) {
+		_, _ = fmt.Fprintf(w, "event: end\ndata: {\"status\":%q,\"offset\":%d}\n\n", status, next)
+		flusher.Flush()
+	}
+	if done, status := catchUp(); done {
+		end(status)
+		return
+	}
+
+	ticker := time.NewTicker(15 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case ev := <-sub:
+			switch ev.Type {
+			case "job_log":
+				le, ok := ev.Data.(execution.JobLogEvent)
+				if !ok || le.JobID != jobID || le.End() <= next {
+					continue
+				}
+				if le.Offset == next {
+					writeEntry(le.JobLogEntry)
+					flusher.Flush()
+					continue
+				}
+				// 订阅缓冲溢出丢了事件，回数据库补齐
+				catchUp()
+			case "job_status_changed":
+				data, _ := ev.Data.(map[string]any)
+				if id, _ := data["job_id"].(string); id != jobID {
+					continue
+				}
+				if status, _ := data["status"].(string); !execution.IsTerminalJobStatus(status) {
+					continue
+				}
+				if done, status := catchUp(); done {
+					end(status)
+					return
+				}
+			}
+		case <-ticker.C:
+			_, _ = w.Write([]byte(": heartbeat\n\n"))
+			flusher.Flush()
+		}
+	}
+}
+
+// jobCallback 处理 POST /api/jobs/:id/callback；不走 session/API key，由执行后端的 HMAC 签名鉴权
+func (s *Server) jobCallback(w http.ResponseWriter, r *http.Request) {
+	if s.db == nil {
+		writeJSONError(w, "db not configured", http.StatusServiceUnavailable)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "", http.StatusMethodNotAllowed)
+		return
+	}
+	jobID := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/jobs/"), "/callback")
+	if jobID == "" || strings.Contains(jobID, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxCallbackBody+1))
+	if err != nil || len(body) > maxCallbackBody {
+		writeJSONError(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	sig := execution.CallbackSignature{
+		Timestamp: r.Header.Get(execution_backends.CallbackTimestampHeader),
+		Nonce:     r.Header.Get(execution_backends.CallbackNonceHeader),
+		Signature: r.Header.Get(execution_backends.CallbackSignatureHeader),
+	}
+	err = s.execution.HandleCallback(jobID, sig, body)
+	switch {
+	case err == nil:
+		writeJSON(w, map[string]any{"ok": true})
+	case errors.Is(err, execution.ErrJobNotFound):
+		writeJSONError(w, "not found", http.StatusNotFound)
+	case errors.Is(err, execution.ErrCallbackUnauthorized), errors.Is(err, execution.ErrCallbackExpired), errors.Is(err, execution.ErrCallbackReplayed):
+		writeJSONError(w, err.Error(), http.StatusUnauthorized)
+	case errors.Is(err, execution.ErrInvalidCallback):
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, execution.ErrJobNotActive):
+		writeJSONError(w, err.Error(), http.StatusConflict)
+	default:
+		writeJSONError(w, "db", http.StatusInternalServerError)
+	}
+}
+
+// jobArtifactUpload 处理 POST /api/jobs/:id/artifacts?kind=&name=，请求体为产物原始内容流；
+// 与回调一样由执行后端 HMAC 签名鉴权，签名对象见 execution_backends.ArtifactUploadTarget
+func (s *Server) jobArtifactUpload(w http.ResponseWriter, r *http.Request) {
+	if s.db == nil {
+		writeJSONError(w, "db not configured", http.StatusServiceUnavailable)
+		return
+	}
+	jobID := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/jobs/"), "/artifacts")
+	if jobID == "" || strings.Contains(jobID, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	sig := execution.CallbackSignature{
+		Timestamp: r.Header.Get(execution_backends.CallbackTimestampHeader),
+		Nonce:     r.Header.Get(execution_backends.CallbackNonceHeader),
+		Signature: r.Header.Get(execution_backends.CallbackSignatureHeader),
+	}
+	q := r.URL.Query()
+	body := http.MaxBytesReader(w, r.Body, maxArtifactUpload)
+	artifact, err := s.execution.StoreBackendArtifact(jobID, sig, q.Get("kind"), q.Get("name"), body)
+	var tooLarge *http.MaxBytesError
+	switch {
+	case err == nil:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]any{"item": artifact})
+	case errors.As(err, &tooLarge):
+		writeJSONError(w, "artifact too large", http.StatusRequestEntityTooLarge)
+	case errors.Is(err, execution.ErrJobNotFound):
+		writeJSONError(w, "not found", http.StatusNotFound)
+	case errors.Is(err, execution.ErrCallbackUnauthorized), errors.Is(err, execution.ErrCallbackExpired), errors.Is(err, execution.ErrCallbackReplayed):
+		writeJSONError(w, err.Error(), http.StatusUnauthorized)
+	case errors.Is(err, execution.ErrInvalidUpload):
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, execution.ErrJobNotActive):
+		writeJSONError(w, err.Error(), http.StatusConflict)
+	default:
+		writeJSONError(w, "artifact store", http.StatusInternalServerError)
+	}
+}
+
+// jobArtifacts 列出 job 的产物，按创建顺序
+func (s *Server) jobArtifacts(w http.ResponseWriter, jobID string) {
+	items, err := s.execution.Artifacts().ListByJob(jobID)
+	if err != nil {
+		writeJSONError(w, "db", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]any{"items": items})
+}
+
+// rotateCallbackSecret 处理 POST /api/execution-backends/:id/callback-secret，生成新密钥并仅在本次响应中返回
+func (s *Server) rotateCallbackSecret(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "", http.StatusMethodNotAllowed)
+		return
+	}
+	id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/execution-backends/"), "/callback-secret")
+	if id == "" || strings.Contains(id, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	secret := execution_backends.NewCallbackSecret()
+	if err := execution_backends.NewRepository(s.db).SetCallbackSecret(id, secret); err != nil {
+		if errors.Is(err, execution_backends.ErrBackendNotFound) {
+			writeJSONError(w, "not found", http.StatusNotFound)
+			return
+		}
+		writeJSONError(w, "db", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]any{"execution_backend_id": id, "callback_secret": secret})
+}
+
+// workerLoad 处理 GET /api/workers/:id/load，返回 worker 运行中与排队中的 step run 及容量
+func (s *Server) workerLoad(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "", http.StatusMethodNotAllowed)
+		return
+	}
+	id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/workers/"), "/load")
+	if id == "" || strings.Contains(id, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	load, err := s.execution.WorkerLoad(id)
+	if errors.Is(err, execution.ErrWorkerNotFound) {
+		writeJSONError(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeJSONError(w, "db", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]any{"item": load})
+}
@@ -0,0 +1,189 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+// ProtocolVersion is the MCP revision the client asks for in initialize.
+const ProtocolVersion = "2025-03-26"
+
+// request is an outgoing JSON-RPC request, or a notification when ID is nil.
+type request struct {
+	JSONRPC string `json:"jsonrpc"`
+	ID      *int64 `json:"id,omitempty"`
+	Method  string `json:"method"`
+	Params  any    `json:"params,omitempty"`
+}
+
+// message is any incoming JSON-RPC message.
+type message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+}
+
+// isResponse reports whether m answers a request rather than being one.
+func (m message) isResponse() bool { return m.Method == "" && len(m.ID) > 0 }
+
+// RPCError is a JSON-RPC error returned by the server.
+type RPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *RPCError) Error() string { return fmt.Sprintf("mcp error %d: %s", e.Code, e.Message) }
+
+// transport carries JSON-RPC messages to one server. roundTrip returns the
+// response to a request and nil for a notification.
+type transport interface {
+	roundTrip(ctx context.Context, req request) (*message, error)
+	close() error
+}
+
+// Tool is a tool advertised by a server.
+type Tool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	InputSchema map[string]any `json:"inputSchema"`
+}
+
+// Content is one item of a tool result.
+type Content struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	MimeType string `json:"mimeType,omitempty"`
+}
+
+// CallResult is the result of tools/call. IsError marks a failure reported
+// by the tool itself rather than by the protocol.
+type CallResult struct {
+	Content []Content `json:"content"`
+	IsError bool      `json:"isError,omitempty"`
+}
+
+// Text joins the text items; other content is shown as a placeholder.
+func (r CallResult) Text() string {
+	parts := make([]string, 0, len(r.Content))
+	for _, c := range r.Content {
+		if c.Type == "text" {
+			parts = append(parts, c.Text)
+			continue
+		}
+		parts = append(parts, strings.TrimSpace(fmt.Sprintf("[%s %s]", c.Type, c.MimeType)))
+	}
+	return strings.Join(parts, "\n")
+}
+
+// Client is an initialized session with one server.
+type Client struct {
+	Server Server
+	// Info is the serverInfo the server reported in initialize.
+	Info struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	}
+	t      transport
+	nextID atomic.Int64
+}
+
+// Connect starts or dials the server and performs the initialize handshake.
+// The caller must Close the client.
+func Connect(ctx context.Context, s Server) (*Client, error) {
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	var t transport
+	var err error
+	if s.Transport == TransportStdio {
+		t, err = startStdio(s)
+	} else {
+		t = newHTTP(s.URL)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := &Client{Server: s, t: t}
+	var init struct {
+		ProtocolVersion string          `json:"protocolVersion"`
+		ServerInfo      json.RawMessage `json:"serverInfo"`
+	}
+	err = c.call(ctx, "initialize", map[string]any{
+		"protocolVersion": ProtocolVersion,
+		"capabilities":    map[string]any{},
+		"clientInfo":      map[string]any{"name": "bull-board", "version": "2"},
+	}, &init)
+	if err == nil {
+		_ = json.Unmarshal(init.ServerInfo, &c.Info)
+		if h, ok := t.(*httpTransport); ok {
+			h.setProtocolVersion(init.ProtocolVersion)
+		}
+		_, err = t.roundTrip(ctx, request{JSONRPC: "2.0", Method: "notifications/initialized"})
+	}
+	if err != nil {
+		_ = t.close()
+		return nil, fmt.Errorf("initialize %s: %w", s.Code, err)
+	}
+	return c, nil
+}
+
+func (c *Client) call(ctx context.Context, method string, params, out any) error {
+	id := c.nextID.Add(1)
+	resp, err := c.t.roundTrip(ctx, request{JSONRPC: "2.0", ID: &id, Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+	if resp.Error != nil {
+		return resp.Error
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(resp.Result, out); err != nil {
+		return fmt.Errorf("decode %s result: %w", method, err)
+	}
+	return nil
+}
+
+// ListTools returns every tool, following pagination cursors.
+func (c *Client) ListTools(ctx context.Context) ([]Tool, error) {
+	var out []Tool
+	cursor := ""
+	for {
+		var params any
+		if cursor != "" {
+			params = map[string]any{"cursor": cursor}
+		}
+		var page struct {
+			Tools      []Tool `json:"tools"`
+			NextCursor string `json:"nextCursor"`
+		}
+		if err := c.call(ctx, "tools/list", params, &page); err != nil {
+			return nil, err
+		}
+		out = append(out, page.Tools...)
+		if page.NextCursor == "" || page.NextCursor == cursor {
+			return out, nil
+		}
+		cursor = page.NextCursor
+	}
+}
+
+// CallTool calls a tool with JSON object arguments.
+func (c *Client) CallTool(ctx context.Context, name string, args json.RawMessage) (CallResult, error) {
+	if len(strings.TrimSpace(string(args))) == 0 {
+		args = json.RawMessage("{}")
+	}
+	var res CallResult
+	err := c.call(ctx, "tools/call", map[string]any{"name": name, "arguments": args}, &res)
+	return res, err
+}
+
+// Close ends the session and stops a stdio server.
+func (c *Client) Close() error { return c.t.close() }
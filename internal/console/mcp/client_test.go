@@ -0,0 +1,247 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/PonyDevAI/Bull-Board/internal/common"
+)
+
+// The test binary doubles as a tiny stdio MCP server when this is set.
+const tinyServerEnv = "BB_MCP_TINY_SERVER"
+
+func TestMain(m *testing.M) {
+	switch os.Getenv(tinyServerEnv) {
+	case "stdio":
+		serveStdio()
+		os.Exit(0)
+	case "crash":
+		fmt.Fprintln(os.Stderr, "boom: missing config")
+		os.Exit(3)
+	case "env":
+		fmt.Fprintf(os.Stderr, "secret=%q plugin=%q\n", os.Getenv("BB_MCP_TEST_SECRET"), os.Getenv("PLUGIN_SETTING"))
+		os.Exit(3)
+	}
+	os.Exit(m.Run())
+}
+
+// tinyHandle answers one request of the tiny server: two tools listed over
+// two pages, echo returns its text and fail reports a tool error.
+func tinyHandle(m message) map[string]any {
+	reply := map[string]any{"jsonrpc": "2.0", "id": m.ID}
+	var params struct {
+		Cursor    string         `json:"cursor"`
+		Name      string         `json:"name"`
+		Arguments map[string]any `json:"arguments"`
+	}
+	_ = json.Unmarshal(m.Params, &params)
+	switch {
+	case m.Method == "initialize":
+		reply["result"] = map[string]any{"protocolVersion": ProtocolVersion, "capabilities": map[string]any{"tools": map[string]any{}}, "serverInfo": map[string]any{"name": "tiny", "version": "1.0"}}
+	case m.Method == "tools/list" && params.Cursor == "":
+		reply["result"] = map[string]any{"tools": []any{map[string]any{"name": "echo", "description": "Echo text", "inputSchema": map[string]any{"type": "object", "properties": map[string]any{"text": map[string]any{"type": "string"}}}}}, "nextCursor": "page-2"}
+	case m.Method == "tools/list":
+		reply["result"] = map[string]any{"tools": []any{map[string]any{"name": "fail", "inputSchema": map[string]any{"type": "object"}}}}
+	case m.Method == "tools/call" && params.Name == "echo":
+		reply["result"] = map[string]any{"content": []any{map[string]any{"type": "text", "text": fmt.Sprint(params.Arguments["text"])}, map[string]any{"type": "image", "mimeType": "image/png", "data": "AA=="}}}
+	case m.Method == "tools/call" && params.Name == "fail":
+		reply["result"] = map[string]any{"content": []any{map[string]any{"type": "text", "text": "table not found"}}, "isError": true}
+	default:
+		reply["error"] = map[string]any{"code": -32601, "message": "unknown " + m.Method + " " + params.Name}
+	}
+	return reply
+}
+
+func serveStdio() {
+	sc := bufio.NewScanner(os.Stdin)
+	enc := json.NewEncoder(os.Stdout)
+	for sc.Scan() {
+		var m message
+		if json.Unmarshal(sc.Bytes(), &m) != nil || len(m.ID) == 0 || m.isResponse() {
+			continue
+		}
+		if m.Method == "tools/call" {
+			// Interleave a notification and a ping before the response.
+			_ = enc.Encode(map[string]any{"jsonrpc": "2.0", "method": "notifications/message", "params": map[string]any{"data": "calling"}})
+			_ = enc.Encode(map[string]any{"jsonrpc": "2.0", "id": "srv-1", "method": "ping"})
+		}
+		_ = enc.Encode(tinyHandle(m))
+	}
+}
+
+func exerciseTiny(t *testing.T, c *Client) {
+	t.Helper()
+	ctx := context.Background()
+	if c.Info.Name != "tiny" {
+		t.Fatalf("unexpected server info %+v", c.Info)
+	}
+	tools, err := c.ListTools(ctx)
+	if err != nil || len(tools) != 2 || tools[0].Name != "echo" || tools[1].Name != "fail" || tools[0].InputSchema["type"] != "object" {
+		t.Fatalf("ListTools = %+v, %v", tools, err)
+	}
+	res, err := c.CallTool(ctx, "echo", json.RawMessage(`{"text":"hi"}`))
+	if err != nil || res.IsError || res.Text() != "hi\n[image image/png]" {
+		t.Fatalf("echo = %+v, %v", res, err)
+	}
+	res, err = c.CallTool(ctx, "fail", nil)
+	if err != nil || !res.IsError || res.Text() != "table not found" {
+		t.Fatalf("fail = %+v, %v", res, err)
+	}
+	var rpcErr *RPCError
+	if _, err := c.CallTool(ctx, "missing", nil); !errors.As(err, &rpcErr) || rpcErr.Code != -32601 {
+		t.Fatalf("expected method error, got %v", err)
+	}
+}
+
+func TestStdioServer(t *testing.T) {
+	c, err := Connect(context.Background(), Server{Code: "tiny", Transport: TransportStdio, Command: os.Args[0], Env: map[string]string{tinyServerEnv: "stdio"}, Dir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	exerciseTiny(t, c)
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if _, err := c.ListTools(context.Background()); err == nil || !strings.Contains(err.Error(), "exited") {
+		t.Fatalf("expected exited server, got %v", err)
+	}
+}
+
+func TestStdioServerThatExits(t *testing.T) {
+	_, err := Connect(context.Background(), Server{Code: "broken", Transport: TransportStdio, Command: os.Args[0], Env: map[string]string{tinyServerEnv: "crash"}})
+	if err == nil || !strings.Contains(err.Error(), "boom: missing config") {
+		t.Fatalf("expected stderr in error, got %v", err)
+	}
+}
+
+func TestStdioServerGetsMinimalEnv(t *testing.T) {
+	t.Setenv("BB_MCP_TEST_SECRET", "console-only")
+	_, err := Connect(context.Background(), Server{Code: "env", Transport: TransportStdio, Command: os.Args[0], Env: map[string]string{tinyServerEnv: "env", "PLUGIN_SETTING": "on"}})
+	if err == nil || !strings.Contains(err.Error(), `secret="" plugin="on"`) {
+		t.Fatalf("expected only the plugin env passed, got %v", err)
+	}
+}
+
+func TestHTTPServer(t *testing.T) {
+	var mu sync.Mutex
+	var sessions []string
+	deleted := ""
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Method == http.MethodDelete {
+			deleted = r.Header.Get("Mcp-Session-Id")
+			return
+		}
+		var m message
+		_ = json.NewDecoder(r.Body).Decode(&m)
+		sessions = append(sessions, r.Header.Get("Mcp-Session-Id"))
+		if len(m.ID) == 0 {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		if m.Method == "initialize" {
+			w.Header().Set("Mcp-Session-Id", "sess-1")
+		}
+		reply, _ := json.Marshal(tinyHandle(m))
+		if m.Method == "tools/call" {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprintf(w, "event: message\ndata: {\"jsonrpc\":\"2.0\",\"method\":\"notifications/progress\"}\n\n")
+			fmt.Fprintf(w, "event: message\ndata: %s\n\n", reply)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(reply)
+	}))
+	defer srv.Close()
+
+	c, err := Connect(context.Background(), Server{Code: "tiny", Transport: TransportHTTP, URL: srv.URL + "/mcp"})
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	exerciseTiny(t, c)
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if sessions[0] != "" || sessions[1] != "sess-1" || sessions[len(sessions)-1] != "sess-1" || deleted != "sess-1" {
+		t.Fatalf("unexpected session headers %v, deleted %q", sessions, deleted)
+	}
+}
+
+func TestConnectHonoursContext(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := Connect(ctx, Server{Code: "slow", Transport: TransportHTTP, URL: srv.URL}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline, got %v", err)
+	}
+}
+
+func TestConfigServer(t *testing.T) {
+	ok := []Config{
+		{Transport: TransportStdio, Command: "docs-mcp", ArgsJSON: `["--root","."]`, EnvJSON: `{"DOCS_INDEX":"/srv/docs"}`},
+		{Transport: TransportHTTP, URL: "http://127.0.0.1:7010/mcp"},
+		{Transport: TransportHTTP, URL: "http://localhost:7010/mcp"},
+	}
+	for _, c := range ok {
+		if _, err := c.Server(); err != nil {
+			t.Errorf("%+v: %v", c, err)
+		}
+	}
+	bad := []Config{
+		{Transport: "websocket", URL: "ws://127.0.0.1"},
+		{Transport: TransportStdio},
+		{Transport: TransportStdio, Command: "x", ArgsJSON: `"--flag"`},
+		{Transport: TransportStdio, Command: "x", EnvJSON: `{"N":1}`},
+		{Transport: TransportHTTP, URL: "ftp://127.0.0.1/mcp"},
+		{Transport: TransportHTTP, URL: "https://mcp.example.com/mcp"},
+	}
+	for _, c := range bad {
+		if _, err := c.Server(); !errors.Is(err, ErrInvalidServer) {
+			t.Errorf("%+v: expected ErrInvalidServer, got %v", c, err)
+		}
+	}
+}
+
+func TestLoadServers(t *testing.T) {
+	t.Setenv("SQLITE_PATH", filepath.Join(t.TempDir(), "bb.sqlite"))
+	db, _, err := common.OpenDB("")
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+	for _, stmt := range []string{
+		`INSERT INTO plugins (id, code, name, transport, command, args_json, env_json) VALUES ('p-docs','docs','Docs','stdio','docs-mcp','["serve"]','{"K":"v"}')`,
+		`INSERT INTO plugins (id, code, name, transport, url) VALUES ('p-schema','db_schema','Schema','http','http://127.0.0.1:7010/mcp')`,
+		`INSERT INTO plugins (id, code, name) VALUES ('p-legacy','legacy','Legacy')`,
+		`INSERT INTO plugins (id, code, name, transport, command) VALUES ('p-other','other','Other','stdio','other-mcp')`,
+		`INSERT INTO agent_app_plugins (agent_app_id, plugin_id) VALUES ('app-1','p-schema'), ('app-1','p-docs'), ('app-1','p-legacy'), ('app-2','p-other')`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+	}
+	servers, err := LoadServers(db, "app-1")
+	if err != nil {
+		t.Fatalf("LoadServers: %v", err)
+	}
+	if len(servers) != 2 || servers[0].Code != "db_schema" || servers[1].Code != "docs" || servers[1].Args[0] != "serve" || servers[1].Env["K"] != "v" || servers[0].PluginID != "p-schema" {
+		t.Fatalf("unexpected servers %+v", servers)
+	}
+}
@@ -0,0 +1,147 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// httpTransport speaks the streamable HTTP transport: every message is a
+// POST, answered with JSON or a short server-sent event stream.
+type httpTransport struct {
+	url    string
+	client *http.Client
+
+	mu       sync.Mutex
+	session  string
+	protocol string
+}
+
+func newHTTP(url string) *httpTransport {
+	return &httpTransport{url: url, client: &http.Client{}}
+}
+
+func (t *httpTransport) setProtocolVersion(v string) {
+	t.mu.Lock()
+	t.protocol = v
+	t.mu.Unlock()
+}
+
+func (t *httpTransport) headers(h http.Header) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.session != "" {
+		h.Set("Mcp-Session-Id", t.session)
+	}
+	if t.protocol != "" {
+		h.Set("Mcp-Protocol-Version", t.protocol)
+	}
+}
+
+func (t *httpTransport) roundTrip(ctx context.Context, req request) (*message, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	hreq, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	hreq.Header.Set("Content-Type", "application/json")
+	hreq.Header.Set("Accept", "application/json, text/event-stream")
+	t.headers(hreq.Header)
+	resp, err := t.client.Do(hreq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if sid := resp.Header.Get("Mcp-Session-Id"); sid != "" {
+		t.mu.Lock()
+		t.session = sid
+		t.mu.Unlock()
+	}
+	if resp.StatusCode >= 300 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("mcp http %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	if req.ID == nil {
+		return nil, nil
+	}
+	want := fmt.Sprint(*req.ID)
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType == "text/event-stream" {
+		return readEventStream(resp.Body, want)
+	}
+	var m message
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxMessage)).Decode(&m); err != nil {
+		return nil, fmt.Errorf("decode mcp response: %w", err)
+	}
+	return &m, nil
+}
+
+// readEventStream returns the response with the wanted id from an SSE body,
+// skipping server notifications and requests sent before it.
+func readEventStream(body io.Reader, id string) (*message, error) {
+	sc := bufio.NewScanner(body)
+	sc.Buffer(make([]byte, 64*1024), maxMessage)
+	var data strings.Builder
+	// event handles the data of one event; true when it is the response.
+	event := func() (*message, bool) {
+		var m message
+		err := json.Unmarshal([]byte(data.String()), &m)
+		data.Reset()
+		return &m, err == nil && m.isResponse() && string(m.ID) == id
+	}
+	for sc.Scan() {
+		line := sc.Text()
+		if strings.HasPrefix(line, "data:") {
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+			continue
+		}
+		if line != "" || data.Len() == 0 {
+			continue
+		}
+		if m, ok := event(); ok {
+			return m, nil
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if data.Len() > 0 {
+		if m, ok := event(); ok {
+			return m, nil
+		}
+	}
+	return nil, fmt.Errorf("mcp event stream ended without a response to request %s", id)
+}
+
+// close ends the server-side session, if the server assigned one.
+func (t *httpTransport) close() error {
+	t.mu.Lock()
+	session := t.session
+	t.mu.Unlock()
+	if session == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), stopGrace)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, t.url, nil)
+	if err != nil {
+		return err
+	}
+	t.headers(req.Header)
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
@@ -0,0 +1,125 @@
+// Package mcp is a small Model Context Protocol client. It launches a tool
+// server as a stdio command or reaches it over HTTP, lists its tools and
+// calls them on behalf of the agent backend.
+package mcp
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+var ErrInvalidServer = errors.New("invalid mcp server")
+
+// Transports a plugins row can use. Rows with an empty transport are not MCP servers.
+const (
+	TransportStdio = "stdio"
+	TransportHTTP  = "http"
+)
+
+// Server describes one MCP server: a command speaking JSON-RPC over its
+// stdin/stdout, or a streamable HTTP endpoint on the local host.
+type Server struct {
+	PluginID  string            `json:"plugin_id"`
+	Code      string            `json:"code"`
+	Name      string            `json:"name"`
+	Transport string            `json:"transport"`
+	Command   string            `json:"command,omitempty"`
+	Args      []string          `json:"args,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+	URL       string            `json:"url,omitempty"`
+	// Dir is the working directory of a stdio server; the agent backend
+	// sets it to the run's worktree.
+	Dir string `json:"-"`
+}
+
+// Config holds the MCP columns of a plugins row.
+type Config struct {
+	Transport string
+	Command   string
+	ArgsJSON  string
+	EnvJSON   string
+	URL       string
+}
+
+// Server parses and validates the row's columns.
+func (c Config) Server() (Server, error) {
+	s := Server{Transport: strings.TrimSpace(c.Transport), Command: strings.TrimSpace(c.Command), URL: strings.TrimSpace(c.URL)}
+	if raw := strings.TrimSpace(c.ArgsJSON); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &s.Args); err != nil {
+			return s, fmt.Errorf("%w: args_json must be an array of strings", ErrInvalidServer)
+		}
+	}
+	if raw := strings.TrimSpace(c.EnvJSON); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &s.Env); err != nil {
+			return s, fmt.Errorf("%w: env_json must be an object of strings", ErrInvalidServer)
+		}
+	}
+	return s, s.Validate()
+}
+
+// Validate checks the transport settings.
+func (s Server) Validate() error {
+	switch s.Transport {
+	case TransportStdio:
+		if s.Command == "" {
+			return fmt.Errorf("%w: stdio transport needs a command", ErrInvalidServer)
+		}
+	case TransportHTTP:
+		u, err := url.Parse(s.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%w: http transport needs an http(s) url", ErrInvalidServer)
+		}
+		if !isLocalHost(u.Hostname()) {
+			return fmt.Errorf("%w: http transport must point at a local endpoint, got %q", ErrInvalidServer, u.Hostname())
+		}
+	default:
+		return fmt.Errorf("%w: unknown transport %q", ErrInvalidServer, s.Transport)
+	}
+	return nil
+}
+
+func isLocalHost(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// LoadServers returns the MCP servers attached to an agent app, ordered by
+// plugin code. Attached plugins without a transport are skipped.
+func LoadServers(db *sql.DB, agentAppID string) ([]Server, error) {
+	if agentAppID == "" {
+		return nil, nil
+	}
+	rows, err := db.Query(`
+		SELECT p.id, p.code, p.name, p.transport, p.command, p.args_json, p.env_json, p.url
+		FROM agent_app_plugins ap
+		JOIN plugins p ON p.id = ap.plugin_id
+		WHERE ap.agent_app_id = ? AND p.transport != ''
+		ORDER BY p.code`, agentAppID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Server
+	for rows.Next() {
+		var id, code, name string
+		var c Config
+		if err := rows.Scan(&id, &code, &name, &c.Transport, &c.Command, &c.ArgsJSON, &c.EnvJSON, &c.URL); err != nil {
+			return nil, err
+		}
+		s, err := c.Server()
+		if err != nil {
+			return nil, fmt.Errorf("plugin %s: %w", code, err)
+		}
+		s.PluginID, s.Code, s.Name = id, code, name
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,228 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxMessage bounds one newline-delimited message from a stdio server.
+	maxMessage = 16 << 20
+	// stopGrace is how long a stdio server gets to exit after stdin closes.
+	stopGrace  = 2 * time.Second
+	stderrTail = 4096
+)
+
+// stdioTransport talks to a child process over newline-delimited JSON on
+// its stdin and stdout.
+type stdioTransport struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout io.ReadCloser
+	stderr *tailBuffer
+
+	writeMu sync.Mutex
+	mu      sync.Mutex
+	pending map[int64]chan *message
+	// done is closed when the process has exited; err says why.
+	done chan struct{}
+	err  error
+}
+
+// serverEnv is the environment a stdio server starts with: only PATH, HOME,
+// TMPDIR and LANG are inherited from the console, plus the plugin's own env.
+func serverEnv(s Server) []string {
+	env := []string{"LANG=C.UTF-8"}
+	for _, k := range []string{"PATH", "HOME", "TMPDIR"} {
+		if v, ok := os.LookupEnv(k); ok {
+			env = append(env, k+"="+v)
+		}
+	}
+	for k, v := range s.Env {
+		env = append(env, k+"="+v)
+	}
+	return env
+}
+
+func startStdio(s Server) (*stdioTransport, error) {
+	cmd := exec.Command(s.Command, s.Args...)
+	cmd.Dir = s.Dir
+	cmd.Env = serverEnv(s)
+	cmd.SysProcAttr = processGroupAttrs()
+	t := &stdioTransport{cmd: cmd, stderr: &tailBuffer{}, pending: map[int64]chan *message{}, done: make(chan struct{})}
+	cmd.Stderr = t.stderr
+	cmd.WaitDelay = time.Second
+	var err error
+	if t.stdin, err = cmd.StdinPipe(); err != nil {
+		return nil, err
+	}
+	if t.stdout, err = cmd.StdoutPipe(); err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start %s: %w", s.Command, err)
+	}
+	go t.read()
+	return t, nil
+}
+
+// read dispatches responses to waiting callers and answers server requests
+// until stdout closes, then reaps the process.
+func (t *stdioTransport) read() {
+	sc := bufio.NewScanner(t.stdout)
+	sc.Buffer(make([]byte, 64*1024), maxMessage)
+	for sc.Scan() {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var m message
+		if err := json.Unmarshal(line, &m); err != nil {
+			continue
+		}
+		switch {
+		case m.isResponse():
+			id, err := strconv.ParseInt(string(m.ID), 10, 64)
+			if err != nil {
+				continue
+			}
+			t.mu.Lock()
+			ch := t.pending[id]
+			delete(t.pending, id)
+			t.mu.Unlock()
+			if ch != nil {
+				ch <- &m
+			}
+		case len(m.ID) > 0:
+			t.answer(m)
+		}
+	}
+	waitErr := t.cmd.Wait()
+	t.mu.Lock()
+	t.err = fmt.Errorf("mcp server exited: %v", waitErr)
+	if waitErr == nil {
+		t.err = errors.New("mcp server exited")
+	}
+	if tail := strings.TrimSpace(t.stderr.String()); tail != "" {
+		t.err = fmt.Errorf("%w: %s", t.err, tail)
+	}
+	t.mu.Unlock()
+	close(t.done)
+}
+
+// answer replies to a request from the server: ping succeeds, anything else
+// is unsupported by this client.
+func (t *stdioTransport) answer(m message) {
+	reply := map[string]any{"jsonrpc": "2.0", "id": m.ID}
+	if m.Method == "ping" {
+		reply["result"] = map[string]any{}
+	} else {
+		reply["error"] = RPCError{Code: -32601, Message: "method not found"}
+	}
+	_ = t.write(reply)
+}
+
+func (t *stdioTransport) write(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	_, err = t.stdin.Write(append(data, '\n'))
+	return err
+}
+
+func (t *stdioTransport) exitErr() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.err
+}
+
+func (t *stdioTransport) roundTrip(ctx context.Context, req request) (*message, error) {
+	select {
+	case <-t.done:
+		return nil, t.exitErr()
+	default:
+	}
+	if req.ID == nil {
+		return nil, t.write(req)
+	}
+	ch := make(chan *message, 1)
+	t.mu.Lock()
+	t.pending[*req.ID] = ch
+	t.mu.Unlock()
+	forget := func() {
+		t.mu.Lock()
+		delete(t.pending, *req.ID)
+		t.mu.Unlock()
+	}
+	if err := t.write(req); err != nil {
+		forget()
+		return nil, err
+	}
+	select {
+	case m := <-ch:
+		return m, nil
+	case <-t.done:
+		return nil, t.exitErr()
+	case <-ctx.Done():
+		forget()
+		return nil, ctx.Err()
+	}
+}
+
+// close shuts stdin so the server can exit on its own, then kills its
+// process group after a grace period. The group is killed even when the
+// server exits in time, so processes it spawned do not outlive the job.
+func (t *stdioTransport) close() error {
+	_ = t.stdin.Close()
+	select {
+	case <-t.done:
+		_ = killProcessGroup(t.cmd)
+		return nil
+	case <-time.After(stopGrace):
+	}
+	_ = killProcessGroup(t.cmd)
+	select {
+	case <-t.done:
+	case <-time.After(stopGrace):
+		// A grandchild still holds stdout; stop reading it.
+		_ = t.stdout.Close()
+		<-t.done
+	}
+	return nil
+}
+
+// tailBuffer keeps the last bytes a server wrote to stderr.
+type tailBuffer struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf = append(b.buf, p...)
+	if len(b.buf) > stderrTail {
+		b.buf = b.buf[len(b.buf)-stderrTail:]
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return string(b.buf)
+}
@@ -0,0 +1,16 @@
+package mcp
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// processGroupAttrs starts a stdio server in its own process group.
+func processGroupAttrs() *syscall.SysProcAttr { return &syscall.SysProcAttr{Setpgid: true} }
+
+func killProcessGroup(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
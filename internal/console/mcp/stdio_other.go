@@ -0,0 +1,19 @@
+//go:build !linux
+
+package mcp
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// Process groups are only used on Linux; elsewhere close kills the server
+// alone.
+func processGroupAttrs() *syscall.SysProcAttr { return nil }
+
+func killProcessGroup(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	return cmd.Process.Kill()
+}
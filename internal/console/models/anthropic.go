@@ -0,0 +1,263 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+const (
+	ProviderAnthropic = "anthropic"
+	anthropicVersion  = "2023-06-01"
+	// anthropicMaxTokens is sent when the request sets no MaxTokens; the
+	// Messages API requires one.
+	anthropicMaxTokens = 4096
+)
+
+// anthropicThinkingBudget maps reasoning levels to extended-thinking budgets.
+var anthropicThinkingBudget = map[string]int{"low": 2048, "medium": 8192, "high": 24576}
+
+// anthropicProvider speaks the Anthropic Messages dialect.
+type anthropicProvider struct{}
+
+func (anthropicProvider) Code() string { return ProviderAnthropic }
+
+func (anthropicProvider) Capabilities() Capabilities {
+	return Capabilities{
+		Streaming:       true,
+		ToolCalls:       true,
+		ReasoningLevels: []string{"low", "medium", "high"},
+		MaxTemperature:  1,
+		DefaultBaseURL:  "https://api.anthropic.com",
+	}
+}
+
+type anthropicBlock struct {
+	Type      string          `json:"type"`
+	Text      string          `json:"text,omitempty"`
+	ID        string          `json:"id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Input     json.RawMessage `json:"input,omitempty"`
+	ToolUseID string          `json:"tool_use_id,omitempty"`
+	Content   string          `json:"content,omitempty"`
+}
+
+type anthropicMessage struct {
+	Role    string           `json:"role"`
+	Content []anthropicBlock `json:"content"`
+}
+
+type anthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+func (p anthropicProvider) body(req ChatRequest, stream bool) map[string]any {
+	var messages []anthropicMessage
+	add := func(role string, blocks ...anthropicBlock) {
+		// The API wants alternating roles; consecutive tool results share one user turn.
+		if n := len(messages); n > 0 && messages[n-1].Role == role {
+			messages[n-1].Content = append(messages[n-1].Content, blocks...)
+			return
+		}
+		messages = append(messages, anthropicMessage{Role: role, Content: blocks})
+	}
+	for _, m := range req.Messages {
+		switch m.Role {
+		case "tool":
+			add("user", anthropicBlock{Type: "tool_result", ToolUseID: m.ToolCallID, Content: m.Content})
+		case "assistant":
+			var blocks []anthropicBlock
+			if m.Content != "" {
+				blocks = append(blocks, anthropicBlock{Type: "text", Text: m.Content})
+			}
+			for _, tc := range m.ToolCalls {
+				input := json.RawMessage(tc.Arguments)
+				if !json.Valid(input) {
+					input = json.RawMessage("{}")
+				}
+				blocks = append(blocks, anthropicBlock{Type: "tool_use", ID: tc.ID, Name: tc.Name, Input: input})
+			}
+			add("assistant", blocks...)
+		default:
+			add("user", anthropicBlock{Type: "text", Text: m.Content})
+		}
+	}
+	maxTokens := req.MaxTokens
+	if maxTokens <= 0 {
+		maxTokens = anthropicMaxTokens
+	}
+	body := map[string]any{"model": req.Model, "messages": messages}
+	if req.System != "" {
+		body["system"] = req.System
+	}
+	if len(req.Tools) > 0 {
+		tools := make([]map[string]any, 0, len(req.Tools))
+		for _, t := range req.Tools {
+			tools = append(tools, map[string]any{"name": t.Name, "description": t.Description, "input_schema": t.Parameters})
+		}
+		body["tools"] = tools
+	}
+	if budget, ok := anthropicThinkingBudget[req.ReasoningLevel]; ok {
+		// Extended thinking needs room beyond the budget and rejects a custom temperature.
+		body["thinking"] = map[string]any{"type": "enabled", "budget_tokens": budget}
+		maxTokens += budget
+	} else if req.Temperature != nil {
+		body["temperature"] = *req.Temperature
+	}
+	body["max_tokens"] = maxTokens
+	if stream {
+		body["stream"] = true
+	}
+	return body
+}
+
+func (p anthropicProvider) headers(s Settings) map[string]string {
+	h := map[string]string{"anthropic-version": anthropicVersion}
+	if s.APIKey != "" {
+		h["x-api-key"] = s.APIKey
+	}
+	return h
+}
+
+func (p anthropicProvider) Chat(ctx context.Context, s Settings, req ChatRequest) (ChatResponse, error) {
+	resp, err := call(ctx, p.Code(), s, http.MethodPost, baseURL(s, p), "/v1/messages", p.body(req, false), p.headers(s))
+	if err != nil {
+		return ChatResponse{}, err
+	}
+	var body struct {
+		ID         string           `json:"id"`
+		Model      string           `json:"model"`
+		Content    []anthropicBlock `json:"content"`
+		StopReason string           `json:"stop_reason"`
+		Usage      anthropicUsage   `json:"usage"`
+	}
+	if err := decodeJSON(resp, &body); err != nil {
+		return ChatResponse{}, fmt.Errorf("decode message: %w", err)
+	}
+	out := ChatResponse{ID: body.ID, Model: body.Model, FinishReason: anthropicFinish(body.StopReason), Message: Message{Role: "assistant"}}
+	for _, block := range body.Content {
+		switch block.Type {
+		case "text":
+			out.Message.Content += block.Text
+		case "tool_use":
+			out.Message.ToolCalls = append(out.Message.ToolCalls, ToolCall{ID: block.ID, Name: block.Name, Arguments: string(block.Input)})
+		}
+	}
+	out.Usage = Usage{InputTokens: body.Usage.InputTokens, OutputTokens: body.Usage.OutputTokens, TotalTokens: body.Usage.InputTokens + body.Usage.OutputTokens}
+	return out, nil
+}
+
+func (p anthropicProvider) ChatStream(ctx context.Context, s Settings, req ChatRequest, onEvent func(StreamEvent)) (ChatResponse, error) {
+	resp, err := call(ctx, p.Code(), s, http.MethodPost, baseURL(s, p), "/v1/messages", p.body(req, true), p.headers(s))
+	if err != nil {
+		return ChatResponse{}, err
+	}
+	defer resp.Body.Close()
+	out := ChatResponse{Message: Message{Role: "assistant"}}
+	calls := map[int]*ToolCall{}
+	err = readSSE(resp.Body, func(data []byte) (bool, error) {
+		var ev struct {
+			Type    string `json:"type"`
+			Index   int    `json:"index"`
+			Message struct {
+				ID    string         `json:"id"`
+				Model string         `json:"model"`
+				Usage anthropicUsage `json:"usage"`
+			} `json:"message"`
+			ContentBlock anthropicBlock `json:"content_block"`
+			Delta        struct {
+				Type        string `json:"type"`
+				Text        string `json:"text"`
+				PartialJSON string `json:"partial_json"`
+				StopReason  string `json:"stop_reason"`
+			} `json:"delta"`
+			Usage anthropicUsage `json:"usage"`
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal(data, &ev); err != nil {
+			return false, fmt.Errorf("decode stream event: %w", err)
+		}
+		switch ev.Type {
+		case "message_start":
+			out.ID, out.Model = ev.Message.ID, ev.Message.Model
+			out.Usage.InputTokens = ev.Message.Usage.InputTokens
+		case "content_block_start":
+			if ev.ContentBlock.Type == "tool_use" {
+				calls[ev.Index] = &ToolCall{ID: ev.ContentBlock.ID, Name: ev.ContentBlock.Name}
+			}
+		case "content_block_delta":
+			switch ev.Delta.Type {
+			case "text_delta":
+				out.Message.Content += ev.Delta.Text
+				onEvent(StreamEvent{Text: ev.Delta.Text})
+			case "input_json_delta":
+				if tc, ok := calls[ev.Index]; ok {
+					tc.Arguments += ev.Delta.PartialJSON
+				}
+			}
+		case "content_block_stop":
+			if tc, ok := calls[ev.Index]; ok {
+				if tc.Arguments == "" {
+					tc.Arguments = "{}"
+				}
+				done := *tc
+				onEvent(StreamEvent{ToolCall: &done})
+			}
+		case "message_delta":
+			out.FinishReason = anthropicFinish(ev.Delta.StopReason)
+			out.Usage.OutputTokens = ev.Usage.OutputTokens
+		case "message_stop":
+			return true, nil
+		case "error":
+			return true, &APIError{Provider: p.Code(), StatusCode: http.StatusOK, Message: ev.Error.Message}
+		}
+		return false, nil
+	})
+	indexes := make([]int, 0, len(calls))
+	for idx := range calls {
+		indexes = append(indexes, idx)
+	}
+	sort.Ints(indexes)
+	for _, idx := range indexes {
+		out.Message.ToolCalls = append(out.Message.ToolCalls, *calls[idx])
+	}
+	out.Usage.TotalTokens = out.Usage.InputTokens + out.Usage.OutputTokens
+	return out, err
+}
+
+func (p anthropicProvider) ListModels(ctx context.Context, s Settings) ([]string, error) {
+	resp, err := call(ctx, p.Code(), s, http.MethodGet, baseURL(s, p), "/v1/models", nil, p.headers(s))
+	if err != nil {
+		return nil, err
+	}
+	var body struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := decodeJSON(resp, &body); err != nil {
+		return nil, fmt.Errorf("decode models: %w", err)
+	}
+	ids := make([]string, 0, len(body.Data))
+	for _, m := range body.Data {
+		ids = append(ids, m.ID)
+	}
+	return ids, nil
+}
+
+func anthropicFinish(reason string) string {
+	switch reason {
+	case "tool_use":
+		return FinishToolCalls
+	case "max_tokens":
+		return FinishLength
+	case "":
+		return ""
+	}
+	return FinishStop
+}
@@ -0,0 +1,119 @@
+package models
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// APIError is a non-2xx response from a provider endpoint.
+type APIError struct {
+	Provider   string
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s endpoint returned %d: %s", e.Provider, e.StatusCode, e.Message)
+}
+
+var defaultHTTPClient = &http.Client{Timeout: 10 * time.Minute}
+
+// call sends a request to baseURL+path with the settings' headers plus
+// extra, returning the response when it is 2xx.
+func call(ctx context.Context, provider string, s Settings, method, baseURL, path string, body any, extra map[string]string) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(baseURL, "/")+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range extra {
+		req.Header.Set(k, v)
+	}
+	for k, v := range s.Headers {
+		req.Header.Set(k, v)
+	}
+	client := s.HTTP
+	if client == nil {
+		client = defaultHTTPClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, &APIError{Provider: provider, StatusCode: resp.StatusCode, Message: errorMessage(data)}
+	}
+	return resp, nil
+}
+
+// errorMessage extracts {"error":{"message":..}} or {"error":".."} bodies.
+func errorMessage(data []byte) string {
+	var nested struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(data, &nested) == nil && nested.Error.Message != "" {
+		return nested.Error.Message
+	}
+	var flat struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(data, &flat) == nil && flat.Error != "" {
+		return flat.Error
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func decodeJSON(resp *http.Response, v any) error {
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// readSSE calls fn with the data of each server-sent event until the body
+// ends or fn returns done.
+func readSSE(body io.Reader, fn func(data []byte) (done bool, err error)) error {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "" {
+			continue
+		}
+		done, err := fn([]byte(data))
+		if err != nil || done {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func baseURL(s Settings, p Provider) string {
+	if s.BaseURL != "" {
+		return s.BaseURL
+	}
+	return p.Capabilities().DefaultBaseURL
+}
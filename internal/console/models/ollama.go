@@ -0,0 +1,196 @@
+package models
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+const ProviderOllama = "ollama"
+
+// ollamaProvider speaks the Ollama /api/chat dialect of local model servers.
+type ollamaProvider struct{}
+
+func (ollamaProvider) Code() string { return ProviderOllama }
+
+func (ollamaProvider) Capabilities() Capabilities {
+	return Capabilities{
+		Streaming:      true,
+		ToolCalls:      true,
+		MaxTemperature: 2,
+		DefaultBaseURL: "http://127.0.0.1:11434",
+	}
+}
+
+type ollamaToolCall struct {
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	} `json:"function"`
+}
+
+type ollamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+}
+
+type ollamaResponse struct {
+	Model           string        `json:"model"`
+	CreatedAt       string        `json:"created_at"`
+	Message         ollamaMessage `json:"message"`
+	Done            bool          `json:"done"`
+	DoneReason      string        `json:"done_reason"`
+	PromptEvalCount int           `json:"prompt_eval_count"`
+	EvalCount       int           `json:"eval_count"`
+}
+
+func (p ollamaProvider) body(req ChatRequest, stream bool) map[string]any {
+	var messages []ollamaMessage
+	if req.System != "" {
+		messages = append(messages, ollamaMessage{Role: "system", Content: req.System})
+	}
+	for _, m := range req.Messages {
+		om := ollamaMessage{Role: m.Role, Content: m.Content}
+		for _, tc := range m.ToolCalls {
+			var call ollamaToolCall
+			call.Function.Name = tc.Name
+			call.Function.Arguments = json.RawMessage(tc.Arguments)
+			if !json.Valid(call.Function.Arguments) {
+				call.Function.Arguments = json.RawMessage("{}")
+			}
+			om.ToolCalls = append(om.ToolCalls, call)
+		}
+		messages = append(messages, om)
+	}
+	body := map[string]any{"model": req.Model, "messages": messages, "stream": stream}
+	if len(req.Tools) > 0 {
+		tools := make([]map[string]any, 0, len(req.Tools))
+		for _, t := range req.Tools {
+			tools = append(tools, map[string]any{"type": "function", "function": map[string]any{"name": t.Name, "description": t.Description, "parameters": t.Parameters}})
+		}
+		body["tools"] = tools
+	}
+	options := map[string]any{}
+	if req.Temperature != nil {
+		options["temperature"] = *req.Temperature
+	}
+	if req.MaxTokens > 0 {
+		options["num_predict"] = req.MaxTokens
+	}
+	if len(options) > 0 {
+		body["options"] = options
+	}
+	return body
+}
+
+func (p ollamaProvider) headers(s Settings) map[string]string {
+	if s.APIKey == "" {
+		return nil
+	}
+	return map[string]string{"Authorization": "Bearer " + s.APIKey}
+}
+
+// apply folds one response object into out. Ollama does not id tool calls,
+// so they are numbered in order of appearance.
+func (p ollamaProvider) apply(out *ChatResponse, r ollamaResponse, onEvent func(StreamEvent)) {
+	if r.Model != "" {
+		out.Model = r.Model
+	}
+	if r.Message.Content != "" {
+		out.Message.Content += r.Message.Content
+		if onEvent != nil {
+			onEvent(StreamEvent{Text: r.Message.Content})
+		}
+	}
+	for _, tc := range r.Message.ToolCalls {
+		call := ToolCall{
+			ID:        fmt.Sprintf("call_%d", len(out.Message.ToolCalls)+1),
+			Name:      tc.Function.Name,
+			Arguments: string(tc.Function.Arguments),
+		}
+		if call.Arguments == "" {
+			call.Arguments = "{}"
+		}
+		out.Message.ToolCalls = append(out.Message.ToolCalls, call)
+		if onEvent != nil {
+			onEvent(StreamEvent{ToolCall: &call})
+		}
+	}
+	if r.Done {
+		out.Usage = Usage{InputTokens: r.PromptEvalCount, OutputTokens: r.EvalCount, TotalTokens: r.PromptEvalCount + r.EvalCount}
+		out.FinishReason = FinishStop
+		switch {
+		case len(out.Message.ToolCalls) > 0:
+			out.FinishReason = FinishToolCalls
+		case r.DoneReason == "length":
+			out.FinishReason = FinishLength
+		}
+	}
+}
+
+func (p ollamaProvider) Chat(ctx context.Context, s Settings, req ChatRequest) (ChatResponse, error) {
+	resp, err := call(ctx, p.Code(), s, http.MethodPost, baseURL(s, p), "/api/chat", p.body(req, false), p.headers(s))
+	if err != nil {
+		return ChatResponse{}, err
+	}
+	var body ollamaResponse
+	if err := decodeJSON(resp, &body); err != nil {
+		return ChatResponse{}, fmt.Errorf("decode chat: %w", err)
+	}
+	out := ChatResponse{ID: body.CreatedAt, Message: Message{Role: "assistant"}}
+	p.apply(&out, body, nil)
+	return out, nil
+}
+
+// ChatStream reads Ollama's newline-delimited JSON stream.
+func (p ollamaProvider) ChatStream(ctx context.Context, s Settings, req ChatRequest, onEvent func(StreamEvent)) (ChatResponse, error) {
+	resp, err := call(ctx, p.Code(), s, http.MethodPost, baseURL(s, p), "/api/chat", p.body(req, true), p.headers(s))
+	if err != nil {
+		return ChatResponse{}, err
+	}
+	defer resp.Body.Close()
+	out := ChatResponse{Message: Message{Role: "assistant"}}
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var chunk ollamaResponse
+		if err := json.Unmarshal(line, &chunk); err != nil {
+			return out, fmt.Errorf("decode stream chunk: %w", err)
+		}
+		if out.ID == "" {
+			out.ID = chunk.CreatedAt
+		}
+		p.apply(&out, chunk, onEvent)
+		if chunk.Done {
+			break
+		}
+	}
+	return out, scanner.Err()
+}
+
+func (p ollamaProvider) ListModels(ctx context.Context, s Settings) ([]string, error) {
+	resp, err := call(ctx, p.Code(), s, http.MethodGet, baseURL(s, p), "/api/tags", nil, p.headers(s))
+	if err != nil {
+		return nil, err
+	}
+	var body struct {
+		Models []struct {
+			Name string `json:"name"`
+		} `json:"models"`
+	}
+	if err := decodeJSON(resp, &body); err != nil {
+		return nil, fmt.Errorf("decode models: %w", err)
+	}
+	names := make([]string, 0, len(body.Models))
+	for _, m := range body.Models {
+		names = append(names, m.Name)
+	}
+	return names, nil
+}
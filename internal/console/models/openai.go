@@ -0,0 +1,237 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+const ProviderOpenAICompatible = "openai_compatible"
+
+// openAIProvider speaks the OpenAI chat-completions dialect served by OpenAI
+// and most compatible gateways (vLLM, LM Studio, OpenRouter, ...).
+type openAIProvider struct{}
+
+func (openAIProvider) Code() string { return ProviderOpenAICompatible }
+
+func (openAIProvider) Capabilities() Capabilities {
+	return Capabilities{
+		Streaming:       true,
+		ToolCalls:       true,
+		ReasoningLevels: []string{"low", "medium", "high"},
+		MaxTemperature:  2,
+		DefaultBaseURL:  "https://api.openai.com/v1",
+	}
+}
+
+type openAIMessage struct {
+	Role       string           `json:"role"`
+	Content    string           `json:"content"`
+	ToolCalls  []openAIToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+}
+
+type openAIToolCall struct {
+	Index    *int   `json:"index,omitempty"`
+	ID       string `json:"id,omitempty"`
+	Type     string `json:"type,omitempty"`
+	Function struct {
+		Name      string `json:"name,omitempty"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+type openAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+func (u openAIUsage) usage() Usage {
+	return Usage{InputTokens: u.PromptTokens, OutputTokens: u.CompletionTokens, TotalTokens: u.TotalTokens}
+}
+
+type openAIResponse struct {
+	ID      string `json:"id"`
+	Model   string `json:"model"`
+	Choices []struct {
+		Message      openAIMessage `json:"message"`
+		Delta        openAIMessage `json:"delta"`
+		FinishReason string        `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *openAIUsage `json:"usage"`
+}
+
+func (p openAIProvider) body(req ChatRequest, stream bool) map[string]any {
+	var messages []openAIMessage
+	if req.System != "" {
+		messages = append(messages, openAIMessage{Role: "system", Content: req.System})
+	}
+	for _, m := range req.Messages {
+		om := openAIMessage{Role: m.Role, Content: m.Content, ToolCallID: m.ToolCallID}
+		for _, tc := range m.ToolCalls {
+			call := openAIToolCall{ID: tc.ID, Type: "function"}
+			call.Function.Name = tc.Name
+			call.Function.Arguments = tc.Arguments
+			om.ToolCalls = append(om.ToolCalls, call)
+		}
+		messages = append(messages, om)
+	}
+	body := map[string]any{"model": req.Model, "messages": messages}
+	if len(req.Tools) > 0 {
+		tools := make([]map[string]any, 0, len(req.Tools))
+		for _, t := range req.Tools {
+			tools = append(tools, map[string]any{"type": "function", "function": map[string]any{"name": t.Name, "description": t.Description, "parameters": t.Parameters}})
+		}
+		body["tools"] = tools
+	}
+	if req.Temperature != nil {
+		body["temperature"] = *req.Temperature
+	}
+	if req.ReasoningLevel != "" {
+		body["reasoning_effort"] = req.ReasoningLevel
+	}
+	if req.MaxTokens > 0 {
+		body["max_tokens"] = req.MaxTokens
+	}
+	if stream {
+		body["stream"] = true
+		body["stream_options"] = map[string]any{"include_usage": true}
+	}
+	return body
+}
+
+func (p openAIProvider) headers(s Settings) map[string]string {
+	if s.APIKey == "" {
+		return nil
+	}
+	return map[string]string{"Authorization": "Bearer " + s.APIKey}
+}
+
+func (p openAIProvider) Chat(ctx context.Context, s Settings, req ChatRequest) (ChatResponse, error) {
+	resp, err := call(ctx, p.Code(), s, http.MethodPost, baseURL(s, p), "/chat/completions", p.body(req, false), p.headers(s))
+	if err != nil {
+		return ChatResponse{}, err
+	}
+	var body openAIResponse
+	if err := decodeJSON(resp, &body); err != nil {
+		return ChatResponse{}, fmt.Errorf("decode chat completion: %w", err)
+	}
+	if len(body.Choices) == 0 {
+		return ChatResponse{}, fmt.Errorf("chat completion returned no choices")
+	}
+	choice := body.Choices[0]
+	out := ChatResponse{ID: body.ID, Model: body.Model, FinishReason: openAIFinish(choice.FinishReason)}
+	out.Message = Message{Role: "assistant", Content: choice.Message.Content}
+	for _, tc := range choice.Message.ToolCalls {
+		out.Message.ToolCalls = append(out.Message.ToolCalls, ToolCall{ID: tc.ID, Name: tc.Function.Name, Arguments: tc.Function.Arguments})
+	}
+	if body.Usage != nil {
+		out.Usage = body.Usage.usage()
+	}
+	return out, nil
+}
+
+func (p openAIProvider) ChatStream(ctx context.Context, s Settings, req ChatRequest, onEvent func(StreamEvent)) (ChatResponse, error) {
+	resp, err := call(ctx, p.Code(), s, http.MethodPost, baseURL(s, p), "/chat/completions", p.body(req, true), p.headers(s))
+	if err != nil {
+		return ChatResponse{}, err
+	}
+	defer resp.Body.Close()
+	out := ChatResponse{Message: Message{Role: "assistant"}}
+	calls := map[int]*ToolCall{}
+	err = readSSE(resp.Body, func(data []byte) (bool, error) {
+		if string(data) == "[DONE]" {
+			return true, nil
+		}
+		var chunk openAIResponse
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			return false, fmt.Errorf("decode stream chunk: %w", err)
+		}
+		if chunk.ID != "" {
+			out.ID = chunk.ID
+		}
+		if chunk.Model != "" {
+			out.Model = chunk.Model
+		}
+		if chunk.Usage != nil {
+			out.Usage = chunk.Usage.usage()
+		}
+		for _, choice := range chunk.Choices {
+			if choice.Delta.Content != "" {
+				out.Message.Content += choice.Delta.Content
+				onEvent(StreamEvent{Text: choice.Delta.Content})
+			}
+			for i, tc := range choice.Delta.ToolCalls {
+				idx := i
+				if tc.Index != nil {
+					idx = *tc.Index
+				}
+				acc, ok := calls[idx]
+				if !ok {
+					acc = &ToolCall{}
+					calls[idx] = acc
+				}
+				if tc.ID != "" {
+					acc.ID = tc.ID
+				}
+				if tc.Function.Name != "" {
+					acc.Name = tc.Function.Name
+				}
+				acc.Arguments += tc.Function.Arguments
+			}
+			if choice.FinishReason != "" {
+				out.FinishReason = openAIFinish(choice.FinishReason)
+			}
+		}
+		return false, nil
+	})
+	if err != nil {
+		return out, err
+	}
+	indexes := make([]int, 0, len(calls))
+	for idx := range calls {
+		indexes = append(indexes, idx)
+	}
+	sort.Ints(indexes)
+	for _, idx := range indexes {
+		tc := *calls[idx]
+		out.Message.ToolCalls = append(out.Message.ToolCalls, tc)
+		onEvent(StreamEvent{ToolCall: &tc})
+	}
+	return out, nil
+}
+
+func (p openAIProvider) ListModels(ctx context.Context, s Settings) ([]string, error) {
+	resp, err := call(ctx, p.Code(), s, http.MethodGet, baseURL(s, p), "/models", nil, p.headers(s))
+	if err != nil {
+		return nil, err
+	}
+	var body struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := decodeJSON(resp, &body); err != nil {
+		return nil, fmt.Errorf("decode models: %w", err)
+	}
+	ids := make([]string, 0, len(body.Data))
+	for _, m := range body.Data {
+		ids = append(ids, m.ID)
+	}
+	return ids, nil
+}
+
+func openAIFinish(reason string) string {
+	switch reason {
+	case "tool_calls", "function_call":
+		return FinishToolCalls
+	case "length":
+		return FinishLength
+	case "":
+		return ""
+	}
+	return FinishStop
+}
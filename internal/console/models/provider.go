@@ -0,0 +1,221 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrUnknownProvider = errors.New("unknown model provider")
+	ErrInvalidProfile  = errors.New("invalid model profile")
+)
+
+// Message is one turn of a conversation in the provider-neutral shape.
+// Role is "user", "assistant" or "tool"; the system prompt travels in
+// ChatRequest.System. Assistant turns may carry ToolCalls and tool turns
+// answer one call by ToolCallID.
+type Message struct {
+	Role       string     `json:"role"`
+	Content    string     `json:"content"`
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"`
+}
+
+// Tool is a function the model may call; Parameters is a JSON schema object.
+type Tool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Parameters  map[string]any `json:"parameters"`
+}
+
+// ToolCall is a model request to run a tool; Arguments is a JSON object.
+type ToolCall struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// ChatRequest is what callers send to any provider.
+type ChatRequest struct {
+	Model          string    `json:"model"`
+	System         string    `json:"system,omitempty"`
+	Messages       []Message `json:"messages"`
+	Tools          []Tool    `json:"tools,omitempty"`
+	Temperature    *float64  `json:"temperature,omitempty"`
+	ReasoningLevel string    `json:"reasoning_level,omitempty"`
+	MaxTokens      int       `json:"max_tokens,omitempty"`
+}
+
+type Usage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+	TotalTokens  int `json:"total_tokens"`
+}
+
+// Finish reasons normalized across providers.
+const (
+	FinishStop      = "stop"
+	FinishToolCalls = "tool_calls"
+	FinishLength    = "length"
+)
+
+// ChatResponse is the assistant turn a provider returned.
+type ChatResponse struct {
+	ID           string  `json:"id"`
+	Model        string  `json:"model"`
+	Message      Message `json:"message"`
+	FinishReason string  `json:"finish_reason"`
+	Usage        Usage   `json:"usage"`
+}
+
+// StreamEvent is delivered while a streamed response arrives: text deltas as
+// they come and each tool call once its arguments are complete.
+type StreamEvent struct {
+	Text     string    `json:"text,omitempty"`
+	ToolCall *ToolCall `json:"tool_call,omitempty"`
+}
+
+// Settings are the provider connection settings of an integration instance.
+type Settings struct {
+	BaseURL string
+	APIKey  string
+	Headers map[string]string
+	HTTP    *http.Client
+}
+
+// Capabilities declares what a provider dialect supports; model profiles are
+// validated against them.
+type Capabilities struct {
+	Streaming       bool     `json:"streaming"`
+	ToolCalls       bool     `json:"tool_calls"`
+	ReasoningLevels []string `json:"reasoning_levels"`
+	MaxTemperature  float64  `json:"max_temperature"`
+	DefaultBaseURL  string   `json:"default_base_url"`
+}
+
+// Provider adapts one model API dialect to the common request/response shape.
+type Provider interface {
+	Code() string
+	Capabilities() Capabilities
+	Chat(ctx context.Context, s Settings, req ChatRequest) (ChatResponse, error)
+	// ChatStream streams the response to onEvent and returns it assembled.
+	ChatStream(ctx context.Context, s Settings, req ChatRequest, onEvent func(StreamEvent)) (ChatResponse, error)
+	ListModels(ctx context.Context, s Settings) ([]string, error)
+}
+
+// Registry maps provider codes (and aliases) to adapters.
+type Registry struct {
+	mu        sync.RWMutex
+	providers map[string]Provider
+	aliases   map[string]string
+}
+
+func NewRegistry() *Registry {
+	return &Registry{providers: map[string]Provider{}, aliases: map[string]string{}}
+}
+
+// DefaultRegistry holds the built-in adapters: "openai_compatible" (alias
+// "openai"), "anthropic" and "ollama".
+var DefaultRegistry = func() *Registry {
+	r := NewRegistry()
+	r.Register(openAIProvider{})
+	r.Register(anthropicProvider{})
+	r.Register(ollamaProvider{})
+	r.Alias("openai", ProviderOpenAICompatible)
+	return r
+}()
+
+func (r *Registry) Register(p Provider) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.providers[p.Code()] = p
+}
+
+// Alias makes name resolve to the provider registered as code.
+func (r *Registry) Alias(name, code string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.aliases[name] = code
+}
+
+// Get resolves a provider by code or alias, case-insensitively.
+func (r *Registry) Get(code string) (Provider, error) {
+	key := strings.ToLower(strings.TrimSpace(code))
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if alias, ok := r.aliases[key]; ok {
+		key = alias
+	}
+	p, ok := r.providers[key]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownProvider, code)
+	}
+	return p, nil
+}
+
+// Codes lists registered provider codes.
+func (r *Registry) Codes() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]string, 0, len(r.providers))
+	for code := range r.providers {
+		out = append(out, code)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Profile is the part of a model_profiles row that drives a request.
+type Profile struct {
+	ID             string  `json:"id"`
+	Provider       string  `json:"provider"`
+	ModelName      string  `json:"model_name"`
+	Temperature    float64 `json:"temperature"`
+	ReasoningLevel string  `json:"reasoning_level"`
+}
+
+// ValidateProfile checks a profile against its provider's capabilities.
+func (r *Registry) ValidateProfile(p Profile) error {
+	provider, err := r.Get(p.Provider)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidProfile, err)
+	}
+	if strings.TrimSpace(p.ModelName) == "" {
+		return fmt.Errorf("%w: model_name required", ErrInvalidProfile)
+	}
+	caps := provider.Capabilities()
+	if p.Temperature < 0 || p.Temperature > caps.MaxTemperature {
+		return fmt.Errorf("%w: temperature %.2f outside 0..%.1f for %s", ErrInvalidProfile, p.Temperature, caps.MaxTemperature, provider.Code())
+	}
+	if p.ReasoningLevel != "" && p.ReasoningLevel != "standard" && !containsString(caps.ReasoningLevels, p.ReasoningLevel) {
+		return fmt.Errorf("%w: reasoning_level %q not supported by %s", ErrInvalidProfile, p.ReasoningLevel, provider.Code())
+	}
+	return nil
+}
+
+// Request builds a chat request for the profile: a non-standard reasoning
+// level is sent instead of the temperature.
+func (p Profile) Request(system string, messages []Message) ChatRequest {
+	req := ChatRequest{Model: p.ModelName, System: system, Messages: messages}
+	if p.ReasoningLevel != "" && p.ReasoningLevel != "standard" {
+		req.ReasoningLevel = p.ReasoningLevel
+	} else {
+		t := p.Temperature
+		req.Temperature = &t
+	}
+	return req
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,295 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/PonyDevAI/Bull-Board/internal/common"
+)
+
+// fakeAPI serves one scripted handler per path and records decoded request bodies.
+type fakeAPI struct {
+	*httptest.Server
+	bodies  []map[string]any
+	headers []http.Header
+}
+
+func newFakeAPI(t *testing.T, routes map[string]func(w http.ResponseWriter, body map[string]any)) *fakeAPI {
+	f := &fakeAPI{}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := map[string]any{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		f.bodies = append(f.bodies, body)
+		f.headers = append(f.headers, r.Header.Clone())
+		route, ok := routes[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		route(w, body)
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func writeLines(w http.ResponseWriter, lines ...string) {
+	for _, line := range lines {
+		fmt.Fprintln(w, line)
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+	}
+}
+
+var weatherTool = Tool{Name: "weather", Description: "Look up weather", Parameters: map[string]any{"type": "object"}}
+
+func toolRequest() ChatRequest {
+	return ChatRequest{
+		Model:  "m",
+		System: "be brief",
+		Messages: []Message{
+			{Role: "user", Content: "weather in Paris?"},
+			{Role: "assistant", ToolCalls: []ToolCall{{ID: "call_1", Name: "weather", Arguments: `{"city":"Paris"}`}}},
+			{Role: "tool", ToolCallID: "call_1", Content: "sunny"},
+		},
+		Tools: []Tool{weatherTool},
+	}
+}
+
+func collect(events *[]StreamEvent) func(StreamEvent) {
+	return func(ev StreamEvent) { *events = append(*events, ev) }
+}
+
+func TestOpenAIChatAndStream(t *testing.T) {
+	api := newFakeAPI(t, map[string]func(http.ResponseWriter, map[string]any){
+		"/v1/chat/completions": func(w http.ResponseWriter, body map[string]any) {
+			if body["stream"] != true {
+				_ = json.NewEncoder(w).Encode(map[string]any{
+					"id": "c1", "model": "m",
+					"choices": []any{map[string]any{"message": map[string]any{"role": "assistant", "content": "It is sunny."}, "finish_reason": "stop"}},
+					"usage":   map[string]any{"prompt_tokens": 10, "completion_tokens": 4, "total_tokens": 14},
+				})
+				return
+			}
+			writeLines(w,
+				`data: {"id":"c2","model":"m","choices":[{"delta":{"content":"Check"}}]}`,
+				`data: {"choices":[{"delta":{"tool_calls":[{"index":0,"id":"call_9","function":{"name":"weather","arguments":"{\"ci"}}]}}]}`,
+				`data: {"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"ty\":\"Oslo\"}"}}]},"finish_reason":"tool_calls"}]}`,
+				`data: {"choices":[],"usage":{"prompt_tokens":7,"completion_tokens":3,"total_tokens":10}}`,
+				`data: [DONE]`)
+		},
+	})
+	p, _ := DefaultRegistry.Get("openai")
+	s := Settings{BaseURL: api.URL + "/v1", APIKey: "sk-1", Headers: map[string]string{"X-Org": "bull"}}
+
+	resp, err := p.Chat(context.Background(), s, toolRequest())
+	if err != nil {
+		t.Fatalf("Chat: %v", err)
+	}
+	if resp.Message.Content != "It is sunny." || resp.FinishReason != FinishStop || resp.Usage != (Usage{10, 4, 14}) {
+		t.Fatalf("unexpected response %+v", resp)
+	}
+	if api.headers[0].Get("Authorization") != "Bearer sk-1" || api.headers[0].Get("X-Org") != "bull" {
+		t.Fatalf("unexpected headers %v", api.headers[0])
+	}
+	messages := api.bodies[0]["messages"].([]any)
+	if len(messages) != 4 || messages[0].(map[string]any)["role"] != "system" || messages[3].(map[string]any)["tool_call_id"] != "call_1" {
+		t.Fatalf("unexpected wire messages %v", messages)
+	}
+
+	var events []StreamEvent
+	resp, err = p.ChatStream(context.Background(), s, toolRequest(), collect(&events))
+	if err != nil {
+		t.Fatalf("ChatStream: %v", err)
+	}
+	if resp.FinishReason != FinishToolCalls || len(resp.Message.ToolCalls) != 1 || resp.Message.ToolCalls[0].Arguments != `{"city":"Oslo"}` {
+		t.Fatalf("unexpected streamed response %+v", resp)
+	}
+	if resp.Usage.TotalTokens != 10 || len(events) != 2 || events[0].Text != "Check" || events[1].ToolCall.ID != "call_9" {
+		t.Fatalf("unexpected events %+v usage %+v", events, resp.Usage)
+	}
+}
+
+func TestAnthropicChatAndStream(t *testing.T) {
+	api := newFakeAPI(t, map[string]func(http.ResponseWriter, map[string]any){
+		"/v1/messages": func(w http.ResponseWriter, body map[string]any) {
+			if body["stream"] != true {
+				_ = json.NewEncoder(w).Encode(map[string]any{
+					"id": "msg_1", "model": "claude",
+					"content":     []any{map[string]any{"type": "text", "text": "Let me check."}, map[string]any{"type": "tool_use", "id": "tu_1", "name": "weather", "input": map[string]any{"city": "Rome"}}},
+					"stop_reason": "tool_use",
+					"usage":       map[string]any{"input_tokens": 20, "output_tokens": 8},
+				})
+				return
+			}
+			writeLines(w,
+				`event: message_start`,
+				`data: {"type":"message_start","message":{"id":"msg_2","model":"claude","usage":{"input_tokens":5}}}`,
+				`data: {"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+				`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Sunny"}}`,
+				`data: {"type":"content_block_stop","index":0}`,
+				`data: {"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":2}}`,
+				`data: {"type":"message_stop"}`)
+		},
+	})
+	p, _ := DefaultRegistry.Get(ProviderAnthropic)
+	s := Settings{BaseURL: api.URL, APIKey: "ak-1"}
+	req := toolRequest()
+	req.ReasoningLevel = "low"
+
+	resp, err := p.Chat(context.Background(), s, req)
+	if err != nil {
+		t.Fatalf("Chat: %v", err)
+	}
+	if resp.FinishReason != FinishToolCalls || resp.Message.Content != "Let me check." || resp.Usage != (Usage{20, 8, 28}) {
+		t.Fatalf("unexpected response %+v", resp)
+	}
+	if len(resp.Message.ToolCalls) != 1 || resp.Message.ToolCalls[0].Arguments != `{"city":"Rome"}` {
+		t.Fatalf("unexpected tool calls %+v", resp.Message.ToolCalls)
+	}
+	if api.headers[0].Get("x-api-key") != "ak-1" || api.headers[0].Get("anthropic-version") == "" {
+		t.Fatalf("unexpected headers %v", api.headers[0])
+	}
+	sent := api.bodies[0]
+	if sent["system"] != "be brief" || sent["thinking"] == nil || sent["temperature"] != nil {
+		t.Fatalf("unexpected request body %v", sent)
+	}
+	messages := sent["messages"].([]any)
+	last := messages[2].(map[string]any)["content"].([]any)[0].(map[string]any)
+	if len(messages) != 3 || last["type"] != "tool_result" || last["tool_use_id"] != "call_1" {
+		t.Fatalf("unexpected wire messages %v", messages)
+	}
+
+	var events []StreamEvent
+	resp, err = p.ChatStream(context.Background(), s, toolRequest(), collect(&events))
+	if err != nil {
+		t.Fatalf("ChatStream: %v", err)
+	}
+	if resp.ID != "msg_2" || resp.Message.Content != "Sunny" || resp.FinishReason != FinishStop || resp.Usage != (Usage{5, 2, 7}) {
+		t.Fatalf("unexpected streamed response %+v", resp)
+	}
+	if len(events) != 1 || events[0].Text != "Sunny" {
+		t.Fatalf("unexpected events %+v", events)
+	}
+}
+
+func TestOllamaChatAndStream(t *testing.T) {
+	api := newFakeAPI(t, map[string]func(http.ResponseWriter, map[string]any){
+		"/api/chat": func(w http.ResponseWriter, body map[string]any) {
+			if body["stream"] != true {
+				_ = json.NewEncoder(w).Encode(map[string]any{
+					"model":   "llama",
+					"message": map[string]any{"role": "assistant", "content": "", "tool_calls": []any{map[string]any{"function": map[string]any{"name": "weather", "arguments": map[string]any{"city": "Lima"}}}}},
+					"done":    true, "done_reason": "stop", "prompt_eval_count": 9, "eval_count": 3,
+				})
+				return
+			}
+			writeLines(w,
+				`{"model":"llama","message":{"role":"assistant","content":"Hot"},"done":false}`,
+				`{"model":"llama","message":{"role":"assistant","content":" today"},"done":false}`,
+				`{"model":"llama","message":{"role":"assistant","content":""},"done":true,"done_reason":"length","prompt_eval_count":4,"eval_count":2}`)
+		},
+		"/api/tags": func(w http.ResponseWriter, _ map[string]any) {
+			_ = json.NewEncoder(w).Encode(map[string]any{"models": []any{map[string]any{"name": "llama"}}})
+		},
+	})
+	p, _ := DefaultRegistry.Get(ProviderOllama)
+	s := Settings{BaseURL: api.URL}
+	temperature := 0.2
+
+	req := toolRequest()
+	req.Temperature = &temperature
+	resp, err := p.Chat(context.Background(), s, req)
+	if err != nil {
+		t.Fatalf("Chat: %v", err)
+	}
+	if resp.FinishReason != FinishToolCalls || len(resp.Message.ToolCalls) != 1 || resp.Message.ToolCalls[0].Arguments != `{"city":"Lima"}` || resp.Usage != (Usage{9, 3, 12}) {
+		t.Fatalf("unexpected response %+v", resp)
+	}
+	if opts, _ := api.bodies[0]["options"].(map[string]any); opts["temperature"] != 0.2 {
+		t.Fatalf("expected temperature option, got %v", api.bodies[0])
+	}
+
+	var events []StreamEvent
+	resp, err = p.ChatStream(context.Background(), s, toolRequest(), collect(&events))
+	if err != nil {
+		t.Fatalf("ChatStream: %v", err)
+	}
+	if resp.Message.Content != "Hot today" || resp.FinishReason != FinishLength || resp.Usage.TotalTokens != 6 || len(events) != 2 {
+		t.Fatalf("unexpected streamed response %+v events %+v", resp, events)
+	}
+
+	names, err := p.ListModels(context.Background(), s)
+	if err != nil || len(names) != 1 || names[0] != "llama" {
+		t.Fatalf("ListModels = %v, %v", names, err)
+	}
+}
+
+func TestProviderErrorsAreAPIErrors(t *testing.T) {
+	api := newFakeAPI(t, map[string]func(http.ResponseWriter, map[string]any){
+		"/v1/messages": func(w http.ResponseWriter, _ map[string]any) {
+			w.WriteHeader(http.StatusUnauthorized)
+			_ = json.NewEncoder(w).Encode(map[string]any{"type": "error", "error": map[string]any{"type": "authentication_error", "message": "invalid x-api-key"}})
+		},
+	})
+	p, _ := DefaultRegistry.Get(ProviderAnthropic)
+	_, err := p.Chat(context.Background(), Settings{BaseURL: api.URL}, toolRequest())
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized || apiErr.Message != "invalid x-api-key" || apiErr.Provider != ProviderAnthropic {
+		t.Fatalf("expected API error, got %v", err)
+	}
+}
+
+func TestValidateProfile(t *testing.T) {
+	cases := []struct {
+		profile Profile
+		ok      bool
+	}{
+		{Profile{Provider: "openai", ModelName: "gpt", Temperature: 1.5, ReasoningLevel: "standard"}, true},
+		{Profile{Provider: "OpenAI_Compatible", ModelName: "gpt", ReasoningLevel: "high"}, true},
+		{Profile{Provider: "anthropic", ModelName: "claude", Temperature: 1.5}, false},
+		{Profile{Provider: "ollama", ModelName: "llama", ReasoningLevel: "high"}, false},
+		{Profile{Provider: "ollama", ModelName: "llama", Temperature: -0.1}, false},
+		{Profile{Provider: "anthropic", ModelName: " "}, false},
+		{Profile{Provider: "bedrock", ModelName: "x"}, false},
+	}
+	for _, tc := range cases {
+		err := DefaultRegistry.ValidateProfile(tc.profile)
+		if tc.ok != (err == nil) {
+			t.Errorf("ValidateProfile(%+v) = %v", tc.profile, err)
+		}
+		if err != nil && !errors.Is(err, ErrInvalidProfile) {
+			t.Errorf("expected ErrInvalidProfile, got %v", err)
+		}
+	}
+	if codes := strings.Join(DefaultRegistry.Codes(), ","); codes != "anthropic,ollama,openai_compatible" {
+		t.Fatalf("unexpected codes %s", codes)
+	}
+}
+
+func TestLoadSettings(t *testing.T) {
+	t.Setenv("SQLITE_PATH", filepath.Join(t.TempDir(), "bb.sqlite"))
+	t.Setenv("BB_TEST_ANTHROPIC_KEY", "ak-env")
+	db, _, err := common.OpenDB("")
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(`INSERT INTO integration_instances (id, home_id, connector_code, name, endpoint, auth_config_json, metadata_json) VALUES ('int-a','default','anthropic','Claude','https://proxy.local','{"api_key_env":"BB_TEST_ANTHROPIC_KEY"}','{"headers":{"X-Team":"core"}}')`); err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+	code, s, err := LoadSettings(db, "int-a")
+	if err != nil {
+		t.Fatalf("LoadSettings: %v", err)
+	}
+	if code != ProviderAnthropic || s.BaseURL != "https://proxy.local" || s.APIKey != "ak-env" || s.Headers["X-Team"] != "core" {
+		t.Fatalf("unexpected settings %s %+v", code, s)
+	}
+}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// LoadSettings reads provider settings from an integration instance: endpoint
+// is the API base URL, auth_config_json {"api_key_env": "NAME"} names the
+// environment variable holding the key and metadata_json {"headers": {...}}
+// adds request headers. The instance's connector_code is returned as the
+// provider code.
+func LoadSettings(db *sql.DB, integrationInstanceID string) (string, Settings, error) {
+	var s Settings
+	var code, authJSON, metaJSON string
+	err := db.QueryRow(`SELECT connector_code, COALESCE(endpoint,''), auth_config_json, metadata_json FROM integration_instances WHERE id = ?`, integrationInstanceID).
+		Scan(&code, &s.BaseURL, &authJSON, &metaJSON)
+	if err != nil {
+		return "", s, fmt.Errorf("integration instance %s: %w", integrationInstanceID, err)
+	}
+	var auth struct {
+		APIKeyEnv string `json:"api_key_env"`
+	}
+	_ = json.Unmarshal([]byte(authJSON), &auth)
+	if auth.APIKeyEnv != "" {
+		s.APIKey = os.Getenv(auth.APIKeyEnv)
+	}
+	var meta struct {
+		Headers map[string]string `json:"headers"`
+	}
+	_ = json.Unmarshal([]byte(metaJSON), &meta)
+	s.Headers = meta.Headers
+	return code, s, nil
+}
+
+// LoadProfile reads a model_profiles row.
+func LoadProfile(db *sql.DB, id string) (Profile, error) {
+	p := Profile{ID: id}
+	err := db.QueryRow(`SELECT provider, model_name, temperature, reasoning_level FROM model_profiles WHERE id = ?`, id).
+		Scan(&p.Provider, &p.ModelName, &p.Temperature, &p.ReasoningLevel)
+	return p, err
+}
@@ -0,0 +1,230 @@
+package protection
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/PonyDevAI/Bull-Board/internal/common"
+)
+
+// Operation is a git operation about to be performed on a workspace branch,
+// with what is performing it: Source names the code path ("local",
+// "pull_request", "submit"), the run IDs the step.
+type Operation struct {
+	WorkspaceID   string
+	Operation     string
+	Branch        string
+	Source        string
+	TaskID        string
+	WorkflowRunID string
+	StepRunID     string
+}
+
+// Attempt is a git_operation_attempts row: one guarded operation and what
+// was decided about it.
+type Attempt struct {
+	ID            string `json:"id"`
+	WorkspaceID   string `json:"workspace_id"`
+	Operation     string `json:"operation"`
+	Branch        string `json:"branch"`
+	Source        string `json:"source"`
+	RuleID        string `json:"rule_id"`
+	Decision      string `json:"decision"`
+	Reason        string `json:"reason"`
+	TaskID        string `json:"task_id"`
+	WorkflowRunID string `json:"workflow_run_id"`
+	StepRunID     string `json:"step_run_id"`
+	DecidedBy     string `json:"decided_by"`
+	DecidedAt     string `json:"decided_at"`
+	ConsumedAt    string `json:"consumed_at"`
+	CreatedAt     string `json:"created_at"`
+}
+
+// Violation is the error for an operation a rule does not allow. It wraps
+// ErrBlocked, or ErrApprovalRequired when the attempt waits for approval.
+type Violation struct {
+	Attempt Attempt
+	Rule    Rule
+}
+
+func (v *Violation) Error() string {
+	msg := fmt.Sprintf("%s to branch %q is not allowed by branch protection rule %q of workspace %s", opName(v.Attempt.Operation), v.Attempt.Branch, v.Rule.Pattern, v.Attempt.WorkspaceID)
+	if v.Attempt.Decision == DecisionPending {
+		return msg + "; waiting for approval of git operation " + v.Attempt.ID
+	}
+	return msg
+}
+
+func (v *Violation) Unwrap() error {
+	if v.Attempt.Decision == DecisionPending {
+		return ErrApprovalRequired
+	}
+	return ErrBlocked
+}
+
+func opName(op string) string { return strings.ReplaceAll(op, "_", "-") }
+
+// Check decides whether op may go ahead and logs the attempt. An operation
+// is allowed when every rule matching the branch allows it, or when an
+// earlier attempt of the same step (or, outside a workflow, of the same
+// task and source) was approved and not used yet. Otherwise it returns a
+// *Violation: blocked if any violated rule blocks, else pending approval.
+func (s *Store) Check(op Operation) (Attempt, error) {
+	branch := strings.TrimPrefix(op.Branch, "refs/heads/")
+	a := Attempt{
+		WorkspaceID: op.WorkspaceID, Operation: op.Operation, Branch: branch, Source: op.Source,
+		TaskID: op.TaskID, WorkflowRunID: op.WorkflowRunID, StepRunID: op.StepRunID, Decision: DecisionAllowed,
+	}
+	rules, err := s.Rules(op.WorkspaceID)
+	if err != nil {
+		return a, err
+	}
+	var violated *Rule
+	for i, r := range rules {
+		if !r.Matches(branch) {
+			continue
+		}
+		if a.RuleID == "" {
+			a.RuleID = r.ID
+		}
+		if r.Allows(op.Operation) {
+			continue
+		}
+		if violated == nil || (violated.OnViolation != ViolationBlock && r.OnViolation == ViolationBlock) {
+			violated = &rules[i]
+		}
+	}
+	if violated == nil {
+		err := s.log(&a)
+		return a, err
+	}
+	a.RuleID = violated.ID
+	if violated.OnViolation == ViolationBlock {
+		a.Decision = DecisionBlocked
+		a.Reason = "rule blocks " + opName(op.Operation)
+		if err := s.log(&a); err != nil {
+			return a, err
+		}
+		return a, &Violation{Attempt: a, Rule: *violated}
+	}
+	approved, ok, err := s.consumeApproval(a)
+	if err != nil {
+		return a, err
+	}
+	if ok {
+		a.Reason = "approved in git operation " + approved.ID
+		err := s.log(&a)
+		return a, err
+	}
+	a.Decision = DecisionPending
+	a.Reason = "rule requires approval for " + opName(op.Operation)
+	if err := s.log(&a); err != nil {
+		return a, err
+	}
+	return a, &Violation{Attempt: a, Rule: *violated}
+}
+
+// refuse logs op as blocked for reason, whatever the rules say.
+func (s *Store) refuse(op Operation, reason string) error {
+	a := Attempt{
+		WorkspaceID: op.WorkspaceID, Operation: op.Operation, Branch: strings.TrimPrefix(op.Branch, "refs/heads/"), Source: op.Source,
+		TaskID: op.TaskID, WorkflowRunID: op.WorkflowRunID, StepRunID: op.StepRunID, Decision: DecisionBlocked, Reason: reason,
+	}
+	return s.log(&a)
+}
+
+// consumeApproval marks the approved attempt matching a as used.
+func (s *Store) consumeApproval(a Attempt) (Attempt, bool, error) {
+	where, args := `step_run_id = ?`, []any{a.StepRunID}
+	if a.StepRunID == "" {
+		where, args = `step_run_id = '' AND task_id = ? AND source = ?`, []any{a.TaskID, a.Source}
+	}
+	items, err := s.attempts(`WHERE workspace_id = ? AND operation = ? AND branch = ? AND decision = ? AND consumed_at = '' AND `+where+` ORDER BY decided_at ASC LIMIT 1`,
+		append([]any{a.WorkspaceID, a.Operation, a.Branch, DecisionApproved}, args...)...)
+	if err != nil || len(items) == 0 {
+		return Attempt{}, false, err
+	}
+	res, err := s.db.Exec(`UPDATE git_operation_attempts SET consumed_at = ? WHERE id = ? AND consumed_at = ''`, timestamp(), items[0].ID)
+	if err != nil {
+		return Attempt{}, false, err
+	}
+	n, _ := res.RowsAffected()
+	return items[0], n == 1, nil
+}
+
+func (s *Store) log(a *Attempt) error {
+	a.ID, a.CreatedAt = common.UUID(), timestamp()
+	_, err := s.db.Exec(`INSERT INTO git_operation_attempts (`+attemptColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		a.ID, a.WorkspaceID, a.Operation, a.Branch, a.Source, a.RuleID, a.Decision, a.Reason, a.TaskID, a.WorkflowRunID, a.StepRunID,
+		a.DecidedBy, a.DecidedAt, a.ConsumedAt, a.CreatedAt)
+	return err
+}
+
+const attemptColumns = `id, workspace_id, operation, branch, source, rule_id, decision, reason, task_id, workflow_run_id, step_run_id, decided_by, decided_at, consumed_at, created_at`
+
+func (s *Store) attempts(where string, args ...any) ([]Attempt, error) {
+	rows, err := s.db.Query(`SELECT `+attemptColumns+` FROM git_operation_attempts `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Attempt{}
+	for rows.Next() {
+		var a Attempt
+		if err := rows.Scan(&a.ID, &a.WorkspaceID, &a.Operation, &a.Branch, &a.Source, &a.RuleID, &a.Decision, &a.Reason, &a.TaskID,
+			&a.WorkflowRunID, &a.StepRunID, &a.DecidedBy, &a.DecidedAt, &a.ConsumedAt, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, a)
+	}
+	return items, rows.Err()
+}
+
+func (s *Store) GetAttempt(id string) (Attempt, error) {
+	items, err := s.attempts(`WHERE id = ?`, id)
+	if err != nil {
+		return Attempt{}, err
+	}
+	if len(items) == 0 {
+		return Attempt{}, ErrAttemptNotFound
+	}
+	return items[0], nil
+}
+
+// Attempts lists a workspace's attempts, newest first, optionally only those
+// with the given decision.
+func (s *Store) Attempts(workspaceID, decision string, limit int) ([]Attempt, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	if decision != "" {
+		return s.attempts(`WHERE workspace_id = ? AND decision = ? ORDER BY created_at DESC LIMIT ?`, workspaceID, decision, limit)
+	}
+	return s.attempts(`WHERE workspace_id = ? ORDER BY created_at DESC LIMIT ?`, workspaceID, limit)
+}
+
+// Approve lets a pending attempt's operation go ahead the next time the same
+// step, or task and source, performs it.
+func (s *Store) Approve(id, by string) (Attempt, error) {
+	return s.decide(id, DecisionApproved, by, "")
+}
+
+// Reject refuses a pending attempt.
+func (s *Store) Reject(id, by, reason string) (Attempt, error) {
+	return s.decide(id, DecisionRejected, by, reason)
+}
+
+func (s *Store) decide(id, decision, by, reason string) (Attempt, error) {
+	res, err := s.db.Exec(`UPDATE git_operation_attempts SET decision = ?, decided_by = ?, decided_at = ?, reason = COALESCE(NULLIF(?, ''), reason) WHERE id = ? AND decision = ?`,
+		decision, by, timestamp(), reason, id, DecisionPending)
+	if err != nil {
+		return Attempt{}, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		if _, err := s.GetAttempt(id); err != nil {
+			return Attempt{}, err
+		}
+		return Attempt{}, ErrNotPending
+	}
+	return s.GetAttempt(id)
+}
@@ -0,0 +1,273 @@
+package protection
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PonyDevAI/Bull-Board/pkg/gitrefs"
+)
+
+// Hooks installed for step commands. reference-transaction sees every ref
+// update of the local repository (commits, branch -f, update-ref, merges);
+// pre-push sees the refs a push would change on the remote.
+const (
+	hookReferenceTransaction = "reference-transaction"
+	hookPrePush              = "pre-push"
+)
+
+// HookServer answers the git hooks of one step's commands over a unix
+// socket next to the hooks. A request must carry the server's token and is
+// checked in the server's operation context, so a command can only report
+// its own branch updates: it never reaches the database and cannot act for
+// another step.
+type HookServer struct {
+	store *Store
+	op    Operation
+	token string
+	ln    net.Listener
+	wg    sync.WaitGroup
+}
+
+// hookRequest is what the guard sends for one hook call.
+type hookRequest struct {
+	Token   string      `json:"token"`
+	Hook    string      `json:"hook"`
+	Updates []refUpdate `json:"updates"`
+}
+
+// hookReply carries the first refusal, empty when every update may go ahead.
+type hookReply struct {
+	Error string `json:"error,omitempty"`
+}
+
+// hookTimeout bounds one hook call, including an approval check.
+const hookTimeout = 30 * time.Second
+
+// ServeHooks writes git hooks into dir that report every branch update to
+// a HookServer for op, and returns the server with the environment entries
+// that make git use the hooks. guard is the command line the hooks run; it
+// must end up in RunHook, as `bb git-guard` does. Close stops the server.
+// The hooks only cover git itself: a command that reconfigures git or
+// writes under .git directly is not stopped by them.
+func (s *Store) ServeHooks(dir string, guard []string, op Operation) (*HookServer, []string, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, nil, err
+	}
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return nil, nil, err
+	}
+	socket := filepath.Join(dir, "guard.sock")
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		return nil, nil, err
+	}
+	h := &HookServer{store: s, op: op, token: hex.EncodeToString(token), ln: ln}
+	args := append(append([]string{}, guard...), "--socket", socket, "--token", h.token, "--")
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		quoted[i] = shellQuote(a)
+	}
+	for _, hook := range []string{hookReferenceTransaction, hookPrePush} {
+		script := "#!/bin/sh\nexec " + strings.Join(quoted, " ") + " " + hook + " \"$@\"\n"
+		if err := os.WriteFile(filepath.Join(dir, hook), []byte(script), 0755); err != nil {
+			ln.Close()
+			return nil, nil, err
+		}
+	}
+	h.wg.Add(1)
+	go h.serve()
+	return h, []string{"GIT_CONFIG_COUNT=1", "GIT_CONFIG_KEY_0=core.hooksPath", "GIT_CONFIG_VALUE_0=" + dir}, nil
+}
+
+func (h *HookServer) serve() {
+	defer h.wg.Done()
+	for {
+		conn, err := h.ln.Accept()
+		if err != nil {
+			return
+		}
+		h.wg.Add(1)
+		go func() {
+			defer h.wg.Done()
+			defer conn.Close()
+			_ = conn.SetDeadline(time.Now().Add(hookTimeout))
+			var req hookRequest
+			if err := json.NewDecoder(conn).Decode(&req); err != nil {
+				return
+			}
+			_ = json.NewEncoder(conn).Encode(h.answer(req))
+		}()
+	}
+}
+
+// answer checks the updates of one hook call. Pushes are refused outright:
+// only console-controlled steps (the pull request backend and submit) push.
+func (h *HookServer) answer(req hookRequest) hookReply {
+	if subtle.ConstantTimeCompare([]byte(req.Token), []byte(h.token)) != 1 {
+		return hookReply{Error: "git guard: invalid token"}
+	}
+	for _, u := range req.Updates {
+		o := h.op
+		o.Operation, o.Branch = u.Op, u.Branch
+		if req.Hook == hookPrePush {
+			if err := h.store.refuse(o, "pushes run only from the pull request step and submit, not from step commands"); err != nil {
+				return hookReply{Error: err.Error()}
+			}
+			return hookReply{Error: fmt.Sprintf("%s to branch %q is not allowed from step commands: pushes run only from the pull request step and submit", opName(o.Operation), o.Branch)}
+		}
+		if _, err := h.store.Check(o); err != nil {
+			return hookReply{Error: err.Error()}
+		}
+	}
+	return hookReply{}
+}
+
+// Close stops answering hooks and waits for calls in progress.
+func (h *HookServer) Close() error {
+	err := h.ln.Close()
+	h.wg.Wait()
+	return err
+}
+
+func shellQuote(s string) string { return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'" }
+
+// RunHook is the guard the installed hooks call: args are the --socket and
+// --token of the HookServer, then the hook name and git's arguments; git's
+// input is on stdin and the hook runs in the repository. The branch updates
+// are classified here and sent to the server; the first one not allowed is
+// reported on stderr and the exit code is non-zero so git refuses the whole
+// update. An unreachable server refuses it too.
+func RunHook(args []string, stdin io.Reader, stderr io.Writer) int {
+	fs := flag.NewFlagSet("git-guard", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	socket := fs.String("socket", "", "socket of the step's hook server")
+	token := fs.String("token", "", "token of the step's hook server")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fmt.Fprintln(stderr, "bb git-guard: hook name required")
+		return 2
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), hookTimeout)
+	defer cancel()
+	updates, err := readUpdates(ctx, fs.Arg(0), fs.Args()[1:], stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "bb git-guard: %v\n", err)
+		return 1
+	}
+	if len(updates) == 0 {
+		return 0
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", *socket)
+	if err != nil {
+		fmt.Fprintf(stderr, "bb git-guard: %v\n", err)
+		return 1
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	var reply hookReply
+	if err := json.NewEncoder(conn).Encode(hookRequest{Token: *token, Hook: fs.Arg(0), Updates: updates}); err == nil {
+		err = json.NewDecoder(conn).Decode(&reply)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "bb git-guard: %v\n", err)
+		return 1
+	}
+	if reply.Error != "" {
+		fmt.Fprintf(stderr, "bb: %s\n", reply.Error)
+		return 1
+	}
+	return 0
+}
+
+type refUpdate struct {
+	Op     string `json:"operation"`
+	Branch string `json:"branch"`
+}
+
+// readUpdates classifies the branch updates a hook was called for.
+func readUpdates(ctx context.Context, hook string, args []string, stdin io.Reader) ([]refUpdate, error) {
+	var out []refUpdate
+	sc := bufio.NewScanner(stdin)
+	switch hook {
+	case hookReferenceTransaction:
+		// Only the prepared state can still refuse the update.
+		if len(args) == 0 || args[0] != "prepared" {
+			return nil, nil
+		}
+		for sc.Scan() {
+			f := strings.Fields(sc.Text())
+			if len(f) != 3 || !strings.HasPrefix(f[2], "refs/heads/") {
+				continue
+			}
+			old := f[0]
+			if gitrefs.IsZero(old) {
+				// Forced and new updates carry no old value; the ref still
+				// has it while the transaction is prepared.
+				old, _ = gitOut(ctx, "rev-parse", "-q", "--verify", f[2])
+			}
+			if op := gitrefs.Classify(ctx, "", old, f[1], true); op != "" {
+				out = append(out, refUpdate{op, strings.TrimPrefix(f[2], "refs/heads/")})
+			}
+		}
+	case hookPrePush:
+		for sc.Scan() {
+			f := strings.Fields(sc.Text())
+			if len(f) != 4 || !strings.HasPrefix(f[2], "refs/heads/") {
+				continue
+			}
+			if op := gitrefs.Classify(ctx, "", f[3], f[1], false); op != "" {
+				out = append(out, refUpdate{op, strings.TrimPrefix(f[2], "refs/heads/")})
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown hook %q", hook)
+	}
+	return out, sc.Err()
+}
+
+func gitOut(ctx context.Context, args ...string) (string, error) {
+	out, err := exec.CommandContext(ctx, "git", args...).Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+// Held returns the *Violation of the latest operation of stepRunID that was
+// attempted at or after since and waits for approval, or nil. Connectors
+// use it to park a step whose command was stopped by a hook.
+func (s *Store) Held(stepRunID, since string) error {
+	items, err := s.attempts(`WHERE step_run_id = ? AND decision = ? AND created_at >= ? ORDER BY created_at DESC LIMIT 1`, stepRunID, DecisionPending, since)
+	if err != nil || len(items) == 0 {
+		return err
+	}
+	rule, err := s.GetRule(items[0].RuleID)
+	if err != nil {
+		rule = Rule{ID: items[0].RuleID, Pattern: "(deleted)"}
+	}
+	return &Violation{Attempt: items[0], Rule: rule}
+}
+
+// Now is the current time in the format attempts are stamped with, for
+// comparing with Held's since.
+func Now() string { return timestamp() }
+
+// Stamp formats t like Now.
+func Stamp(t time.Time) string { return t.UTC().Format(timeFormat) }
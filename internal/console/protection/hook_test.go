@@ -0,0 +1,252 @@
+package protection
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// The test binary doubles as the guard command the installed hooks run.
+func TestMain(m *testing.M) {
+	if len(os.Args) > 1 && os.Args[1] == "git-guard" {
+		os.Exit(RunHook(os.Args[2:], os.Stdin, os.Stderr))
+	}
+	os.Exit(m.Run())
+}
+
+// guardedRepo returns a repo with one commit on main, a bare remote holding
+// it and the environment that makes git in it run the guard hooks.
+func guardedRepo(t *testing.T, s *Store) (string, []string) {
+	t.Helper()
+	dir := t.TempDir()
+	repo, remote := filepath.Join(dir, "repo"), filepath.Join(dir, "remote.git")
+	for _, args := range [][]string{{"init", "-q", "-b", "main", repo}, {"init", "-q", "--bare", remote}} {
+		if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v %s", args, err, out)
+		}
+	}
+	env := append(os.Environ(), "GIT_AUTHOR_NAME=t", "GIT_AUTHOR_EMAIL=t@example.test", "GIT_COMMITTER_NAME=t", "GIT_COMMITTER_EMAIL=t@example.test")
+	mustGit(t, repo, env, "commit", "-q", "--allow-empty", "-m", "init")
+	mustGit(t, repo, env, "remote", "add", "origin", remote)
+	mustGit(t, repo, env, "push", "-q", "origin", "main")
+
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, vars, err := s.ServeHooks(filepath.Join(dir, "hooks"), []string{exe, "git-guard"},
+		Operation{WorkspaceID: "ws", Source: "local", TaskID: "task-1", WorkflowRunID: "run-1", StepRunID: "sr-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { h.Close() })
+	return repo, append(env, vars...)
+}
+
+func runGit(dir string, env []string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir, cmd.Env = dir, env
+	out, err := cmd.CombinedOutput()
+	return string(out), err
+}
+
+func mustGit(t *testing.T, dir string, env []string, args ...string) {
+	t.Helper()
+	if out, err := runGit(dir, env, args...); err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, out)
+	}
+}
+
+func TestHooksGuardBranchUpdates(t *testing.T) {
+	s := NewStore(testDB(t))
+	repo, env := guardedRepo(t, s)
+	if _, err := s.SaveRule(Rule{WorkspaceID: "ws", Pattern: "main"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.SaveRule(Rule{WorkspaceID: "ws", Pattern: "bb/**", AllowedOperations: []string{OpCommit, OpPush}}); err != nil {
+		t.Fatal(err)
+	}
+	main := func() string { out, _ := runGit(repo, env, "rev-parse", "main"); return strings.TrimSpace(out) }
+	before := main()
+
+	// Work on a run branch is allowed, but pushing it is left to the
+	// console's own steps.
+	mustGit(t, repo, env, "checkout", "-q", "-b", "bb/run-1")
+	mustGit(t, repo, env, "commit", "-q", "--allow-empty", "-m", "work")
+	if out, err := runGit(repo, env, "push", "-q", "origin", "bb/run-1"); err == nil || !strings.Contains(out, "not allowed from step commands") {
+		t.Fatalf("push from a step command = %v\n%s", err, out)
+	}
+
+	// Moving or pushing main is not, however it is attempted.
+	for _, args := range [][]string{
+		{"update-ref", "refs/heads/main", "HEAD"},
+		{"branch", "-f", "main", "HEAD"},
+		{"push", "origin", "HEAD:main"},
+	} {
+		out, err := runGit(repo, env, args...)
+		if err == nil || !strings.Contains(out, `to branch "main" is not allowed`) {
+			t.Fatalf("git %v = %v\n%s", args, err, out)
+		}
+	}
+	if main() != before {
+		t.Fatalf("main moved")
+	}
+
+	// Rewriting or merging into the run branch is outside what the rule allows.
+	mustGit(t, repo, env, "branch", "side", "main")
+	mustGit(t, repo, env, "checkout", "-q", "side")
+	mustGit(t, repo, env, "commit", "-q", "--allow-empty", "-m", "side")
+	mustGit(t, repo, env, "checkout", "-q", "bb/run-1")
+	if out, err := runGit(repo, env, "merge", "--no-ff", "-q", "-m", "merge", "side"); err == nil {
+		t.Fatalf("merge into run branch allowed\n%s", out)
+	}
+	if out, err := runGit(repo, env, "reset", "-q", "--hard", "main"); err == nil {
+		t.Fatalf("reset of run branch allowed\n%s", out)
+	}
+	if out, err := runGit(repo, env, "push", "-q", "origin", "--delete", "main"); err == nil {
+		t.Fatalf("remote branch deletion allowed\n%s", out)
+	}
+
+	items, err := s.Attempts("ws", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for i := len(items) - 1; i >= 0; i-- {
+		a := items[i]
+		if a.Source != "local" || a.StepRunID != "sr-1" {
+			t.Fatalf("attempt context %+v", a)
+		}
+		got = append(got, a.Operation+" "+a.Branch+" "+a.Decision)
+	}
+	want := []string{
+		"commit bb/run-1 allowed", // checkout -b
+		"commit bb/run-1 allowed",
+		"push bb/run-1 blocked",
+		"commit main blocked",
+		"commit main blocked",
+		"push main blocked",
+		"commit side allowed",
+		"commit side allowed",
+		"merge bb/run-1 blocked",
+		"force_push bb/run-1 blocked",
+		"force_push main blocked",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("attempts:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestHookFailsClosed(t *testing.T) {
+	s := NewStore(testDB(t))
+	if _, err := s.SaveRule(Rule{WorkspaceID: "ws", Pattern: "main"}); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	h, _, err := s.ServeHooks(filepath.Join(dir, "hooks"), []string{"git-guard"}, Operation{WorkspaceID: "ws", StepRunID: "sr-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	socket := filepath.Join(dir, "hooks", "guard.sock")
+	// A branch deletion is classified without reading the repository.
+	stdin := "0000000000000000000000000000000000000001 0000000000000000000000000000000000000000 refs/heads/main\n"
+
+	for name, args := range map[string][]string{
+		"wrong token":  {"--socket", socket, "--token", "forged", "--", "reference-transaction", "prepared"},
+		"no server":    {"--socket", filepath.Join(dir, "missing.sock"), "--token", h.token, "--", "reference-transaction", "prepared"},
+		"no arguments": {"reference-transaction", "prepared"},
+	} {
+		var stderr strings.Builder
+		if code := RunHook(args, strings.NewReader(stdin), &stderr); code == 0 {
+			t.Errorf("%s: hook allowed the update", name)
+		}
+	}
+	if items, err := s.Attempts("ws", "", 0); err != nil || len(items) != 0 {
+		t.Fatalf("refused requests were checked: %+v, %v", items, err)
+	}
+}
+
+func TestRefGuardMovesBackUncheckedUpdates(t *testing.T) {
+	s := NewStore(testDB(t))
+	repo, env := guardedRepo(t, s)
+	if _, err := s.SaveRule(Rule{WorkspaceID: "ws", Pattern: "main"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.SaveRule(Rule{WorkspaceID: "ws", Pattern: "release/*", OnViolation: ViolationApproval}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.SaveRule(Rule{WorkspaceID: "ws", Pattern: "bb/**", AllowedOperations: []string{OpCommit}}); err != nil {
+		t.Fatal(err)
+	}
+	rev := func(ref string) string {
+		out, _ := runGit(repo, env, "rev-parse", "-q", "--verify", ref)
+		return strings.TrimSpace(out)
+	}
+	mustGit(t, repo, env, "checkout", "-q", "-b", "bb/run-1")
+	mustGit(t, repo, env, "commit", "-q", "--allow-empty", "-m", "work")
+	main, work := rev("main"), rev("HEAD")
+
+	g := s.GuardRefs(repo, Operation{WorkspaceID: "ws", Source: "local", StepRunID: "sr-1"})
+	command := func(args ...string) error {
+		t.Helper()
+		if err := g.Before(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if out, err := runGit(repo, env, args...); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+		return g.After(context.Background())
+	}
+
+	// Going around the hooks does not keep the update.
+	if err := command("-c", "core.hooksPath=/dev/null", "update-ref", "refs/heads/main", "HEAD"); !errors.Is(err, ErrBlocked) {
+		t.Fatalf("bypassed update of main = %v", err)
+	}
+	if rev("main") != main {
+		t.Fatalf("main was not moved back")
+	}
+	if err := command("-c", "core.hooksPath=/dev/null", "branch", "-D", "main"); !errors.Is(err, ErrBlocked) || rev("main") != main {
+		t.Fatalf("bypassed deletion of main = %v", err)
+	}
+	if err := command("-c", "core.hooksPath=/dev/null", "branch", "release/1"); !errors.Is(err, ErrApprovalRequired) || rev("release/1") != "" {
+		t.Fatalf("bypassed creation of release/1 = %v", err)
+	}
+	if held := s.Held("sr-1", ""); !errors.Is(held, ErrApprovalRequired) {
+		t.Fatalf("Held = %v", held)
+	}
+
+	// Updates the hooks checked, and allowed ones, are kept.
+	if err := command("commit", "-q", "--allow-empty", "-m", "more"); err != nil || rev("bb/run-1") == work {
+		t.Fatalf("hooked commit = %v", err)
+	}
+	work = rev("bb/run-1")
+	if err := command("-c", "core.hooksPath=/dev/null", "commit", "-q", "--allow-empty", "-m", "unhooked"); err != nil || rev("bb/run-1") == work {
+		t.Fatalf("allowed unhooked commit = %v", err)
+	}
+
+	items, err := s.Attempts("ws", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for i := len(items) - 1; i >= 0; i-- {
+		got = append(got, items[i].Operation+" "+items[i].Branch+" "+items[i].Decision)
+	}
+	want := []string{
+		"commit bb/run-1 allowed", // checkout -b
+		"commit bb/run-1 allowed",
+		"commit main blocked",
+		"force_push main blocked",
+		"commit release/1 pending_approval",
+		"commit bb/run-1 allowed",
+		"commit bb/run-1 allowed",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("attempts:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,226 @@
+// Package protection guards git operations on workspace branches. A rule
+// names a branch pattern and the operations allowed on matching branches;
+// any other operation is blocked or, when the rule says so, held until a
+// person approves it. Every guarded operation is logged as an attempt,
+// whether it was allowed or not.
+package protection
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/PonyDevAI/Bull-Board/internal/common"
+	"github.com/PonyDevAI/Bull-Board/pkg/gitrefs"
+)
+
+// Guarded operations.
+const (
+	OpPush      = gitrefs.OpPush
+	OpForcePush = gitrefs.OpForcePush
+	OpMerge     = gitrefs.OpMerge
+	OpCommit    = gitrefs.OpCommit
+)
+
+// What a rule does with an operation it does not allow.
+const (
+	ViolationBlock    = "block"
+	ViolationApproval = "approval"
+)
+
+// Attempt decisions.
+const (
+	DecisionAllowed  = "allowed"
+	DecisionBlocked  = "blocked"
+	DecisionPending  = "pending_approval"
+	DecisionApproved = "approved"
+	DecisionRejected = "rejected"
+)
+
+var (
+	ErrRuleNotFound     = errors.New("branch protection rule not found")
+	ErrAttemptNotFound  = errors.New("git operation attempt not found")
+	ErrInvalidRule      = errors.New("invalid branch protection rule")
+	ErrNotPending       = errors.New("git operation attempt is not pending approval")
+	ErrBlocked          = errors.New("blocked by branch protection")
+	ErrApprovalRequired = errors.New("approval required by branch protection")
+)
+
+var operations = []string{OpPush, OpForcePush, OpMerge, OpCommit}
+
+// Rule is a branch_protection_rules row. Pattern is a glob over branch
+// names: "*" matches within one path segment, "**" across segments, "?"
+// one character.
+type Rule struct {
+	ID                string   `json:"id"`
+	WorkspaceID       string   `json:"workspace_id"`
+	Pattern           string   `json:"pattern"`
+	AllowedOperations []string `json:"allowed_operations"`
+	OnViolation       string   `json:"on_violation"`
+	CreatedAt         string   `json:"created_at"`
+	UpdatedAt         string   `json:"updated_at"`
+}
+
+// Matches reports whether branch falls under the rule.
+func (r Rule) Matches(branch string) bool {
+	re, err := compile(r.Pattern)
+	return err == nil && re.MatchString(strings.TrimPrefix(branch, "refs/heads/"))
+}
+
+// Allows reports whether the rule allows op on its branches.
+func (r Rule) Allows(op string) bool {
+	for _, a := range r.AllowedOperations {
+		if a == op {
+			return true
+		}
+	}
+	return false
+}
+
+func (r Rule) validate() error {
+	if strings.TrimSpace(r.Pattern) == "" {
+		return fmt.Errorf("%w: pattern required", ErrInvalidRule)
+	}
+	if _, err := compile(r.Pattern); err != nil {
+		return fmt.Errorf("%w: pattern %q: %v", ErrInvalidRule, r.Pattern, err)
+	}
+	for _, op := range r.AllowedOperations {
+		if !validOperation(op) {
+			return fmt.Errorf("%w: unknown operation %q (want one of %s)", ErrInvalidRule, op, strings.Join(operations, ", "))
+		}
+	}
+	if r.OnViolation != ViolationBlock && r.OnViolation != ViolationApproval {
+		return fmt.Errorf("%w: on_violation must be %q or %q", ErrInvalidRule, ViolationBlock, ViolationApproval)
+	}
+	return nil
+}
+
+func validOperation(op string) bool {
+	for _, o := range operations {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
+
+func compile(pattern string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case c == '*' && i+1 < len(pattern) && pattern[i+1] == '*':
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+// Store keeps the rules and the attempt log.
+type Store struct{ db *sql.DB }
+
+func NewStore(db *sql.DB) *Store { return &Store{db: db} }
+
+// timestamp is fixed-width so stamps order as strings.
+const timeFormat = "2006-01-02T15:04:05.000000000Z07:00"
+
+func timestamp() string { return time.Now().UTC().Format(timeFormat) }
+
+const ruleColumns = `id, workspace_id, pattern, allowed_operations_json, on_violation, created_at, updated_at`
+
+func (s *Store) rules(where string, args ...any) ([]Rule, error) {
+	rows, err := s.db.Query(`SELECT `+ruleColumns+` FROM branch_protection_rules `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Rule{}
+	for rows.Next() {
+		var r Rule
+		var ops string
+		if err := rows.Scan(&r.ID, &r.WorkspaceID, &r.Pattern, &ops, &r.OnViolation, &r.CreatedAt, &r.UpdatedAt); err != nil {
+			return nil, err
+		}
+		_ = json.Unmarshal([]byte(ops), &r.AllowedOperations)
+		if r.AllowedOperations == nil {
+			r.AllowedOperations = []string{}
+		}
+		items = append(items, r)
+	}
+	return items, rows.Err()
+}
+
+// Rules lists a workspace's rules, oldest first.
+func (s *Store) Rules(workspaceID string) ([]Rule, error) {
+	return s.rules(`WHERE workspace_id = ? ORDER BY created_at ASC, id ASC`, workspaceID)
+}
+
+func (s *Store) GetRule(id string) (Rule, error) {
+	items, err := s.rules(`WHERE id = ?`, id)
+	if err != nil {
+		return Rule{}, err
+	}
+	if len(items) == 0 {
+		return Rule{}, ErrRuleNotFound
+	}
+	return items[0], nil
+}
+
+// SaveRule creates the rule, or replaces it when it has an ID. On violation
+// defaults to block.
+func (s *Store) SaveRule(r Rule) (Rule, error) {
+	r.Pattern = strings.TrimPrefix(strings.TrimSpace(r.Pattern), "refs/heads/")
+	if r.OnViolation == "" {
+		r.OnViolation = ViolationBlock
+	}
+	if r.AllowedOperations == nil {
+		r.AllowedOperations = []string{}
+	}
+	if err := r.validate(); err != nil {
+		return r, err
+	}
+	ops, err := json.Marshal(r.AllowedOperations)
+	if err != nil {
+		return r, err
+	}
+	ts := timestamp()
+	r.UpdatedAt = ts
+	if r.ID == "" {
+		r.ID, r.CreatedAt = common.UUID(), ts
+		_, err := s.db.Exec(`INSERT INTO branch_protection_rules (`+ruleColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			r.ID, r.WorkspaceID, r.Pattern, string(ops), r.OnViolation, r.CreatedAt, r.UpdatedAt)
+		return r, err
+	}
+	res, err := s.db.Exec(`UPDATE branch_protection_rules SET pattern = ?, allowed_operations_json = ?, on_violation = ?, updated_at = ? WHERE id = ? AND workspace_id = ?`,
+		r.Pattern, string(ops), r.OnViolation, r.UpdatedAt, r.ID, r.WorkspaceID)
+	if err != nil {
+		return r, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return r, ErrRuleNotFound
+	}
+	return s.GetRule(r.ID)
+}
+
+func (s *Store) DeleteRule(workspaceID, id string) error {
+	res, err := s.db.Exec(`DELETE FROM branch_protection_rules WHERE id = ? AND workspace_id = ?`, id, workspaceID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrRuleNotFound
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package protection
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/PonyDevAI/Bull-Board/internal/common"
+)
+
+func testDB(t *testing.T) *sql.DB {
+	t.Helper()
+	t.Setenv("SQLITE_PATH", filepath.Join(t.TempDir(), "bb.sqlite"))
+	db, _, err := common.OpenDB("")
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	return db
+}
+
+func TestRuleMatches(t *testing.T) {
+	for _, tc := range []struct {
+		pattern, branch string
+		want            bool
+	}{
+		{"main", "main", true},
+		{"main", "refs/heads/main", true},
+		{"main", "main2", false},
+		{"release/*", "release/1.2", true},
+		{"release/*", "release/1.2/hotfix", false},
+		{"release/**", "release/1.2/hotfix", true},
+		{"bb/run-?", "bb/run-1", true},
+		{"v1.0", "v1x0", false},
+	} {
+		if got := (Rule{Pattern: tc.pattern}).Matches(tc.branch); got != tc.want {
+			t.Errorf("%q matches %q = %v, want %v", tc.pattern, tc.branch, got, tc.want)
+		}
+	}
+}
+
+func TestSaveRuleValidates(t *testing.T) {
+	s := NewStore(testDB(t))
+	for _, r := range []Rule{
+		{WorkspaceID: "ws", Pattern: " "},
+		{WorkspaceID: "ws", Pattern: "main", AllowedOperations: []string{"rebase"}},
+		{WorkspaceID: "ws", Pattern: "main", OnViolation: "warn"},
+	} {
+		if _, err := s.SaveRule(r); !errors.Is(err, ErrInvalidRule) {
+			t.Errorf("SaveRule(%+v) = %v, want ErrInvalidRule", r, err)
+		}
+	}
+	r, err := s.SaveRule(Rule{WorkspaceID: "ws", Pattern: "refs/heads/main"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Pattern != "main" || r.OnViolation != ViolationBlock || len(r.AllowedOperations) != 0 {
+		t.Fatalf("rule = %+v", r)
+	}
+	r.AllowedOperations = []string{OpCommit}
+	if r, err = s.SaveRule(r); err != nil || !r.Allows(OpCommit) {
+		t.Fatalf("update = %+v, %v", r, err)
+	}
+	if err := s.DeleteRule("other", r.ID); !errors.Is(err, ErrRuleNotFound) {
+		t.Fatalf("delete from another workspace = %v", err)
+	}
+}
+
+func TestCheckBlocksAndLogs(t *testing.T) {
+	s := NewStore(testDB(t))
+	if _, err := s.SaveRule(Rule{WorkspaceID: "ws", Pattern: "main", AllowedOperations: []string{OpCommit}}); err != nil {
+		t.Fatal(err)
+	}
+	// A stricter rule wins over a looser one on the same branch.
+	if _, err := s.SaveRule(Rule{WorkspaceID: "ws", Pattern: "**", AllowedOperations: []string{OpPush, OpCommit}, OnViolation: ViolationApproval}); err != nil {
+		t.Fatal(err)
+	}
+	op := Operation{WorkspaceID: "ws", Operation: OpPush, Branch: "main", Source: "pull_request", StepRunID: "sr-1"}
+	a, err := s.Check(op)
+	var v *Violation
+	if !errors.Is(err, ErrBlocked) || !errors.As(err, &v) || v.Rule.Pattern != "main" || a.Decision != DecisionBlocked {
+		t.Fatalf("push to main = %+v, %v", a, err)
+	}
+	op.Branch = "bb/run-1"
+	if _, err := s.Check(op); err != nil {
+		t.Fatalf("push to run branch: %v", err)
+	}
+	op.Operation = OpForcePush
+	if _, err := s.Check(op); !errors.Is(err, ErrApprovalRequired) {
+		t.Fatalf("force push to run branch = %v", err)
+	}
+	op.WorkspaceID = "unprotected"
+	if _, err := s.Check(op); err != nil {
+		t.Fatalf("unprotected workspace: %v", err)
+	}
+
+	items, err := s.Attempts("ws", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 3 || items[0].Decision != DecisionPending || items[1].Decision != DecisionAllowed || items[2].Decision != DecisionBlocked {
+		t.Fatalf("attempts = %+v", items)
+	}
+	if items[2].RuleID == "" || items[2].Source != "pull_request" || items[2].StepRunID != "sr-1" {
+		t.Fatalf("blocked attempt = %+v", items[2])
+	}
+}
+
+func TestApprovalIsUsedOnce(t *testing.T) {
+	s := NewStore(testDB(t))
+	if _, err := s.SaveRule(Rule{WorkspaceID: "ws", Pattern: "main", OnViolation: ViolationApproval}); err != nil {
+		t.Fatal(err)
+	}
+	op := Operation{WorkspaceID: "ws", Operation: OpPush, Branch: "main", Source: "submit", TaskID: "task-1"}
+	pending, err := s.Check(op)
+	if !errors.Is(err, ErrApprovalRequired) {
+		t.Fatalf("Check = %v", err)
+	}
+	// Another task's push is not covered by the approval.
+	if _, err := s.Check(Operation{WorkspaceID: "ws", Operation: OpPush, Branch: "main", Source: "submit", TaskID: "task-2"}); !errors.Is(err, ErrApprovalRequired) {
+		t.Fatalf("other task = %v", err)
+	}
+	approved, err := s.Approve(pending.ID, "alice")
+	if err != nil || approved.Decision != DecisionApproved || approved.DecidedBy != "alice" {
+		t.Fatalf("Approve = %+v, %v", approved, err)
+	}
+	if _, err := s.Approve(pending.ID, "alice"); !errors.Is(err, ErrNotPending) {
+		t.Fatalf("second Approve = %v", err)
+	}
+	a, err := s.Check(op)
+	if err != nil || a.ID == "" || a.Decision != DecisionAllowed || a.Reason != "approved in git operation "+pending.ID {
+		t.Fatalf("Check after approval = %+v, %v", a, err)
+	}
+	if _, err := s.Check(op); !errors.Is(err, ErrApprovalRequired) {
+		t.Fatalf("approval reused: %v", err)
+	}
+	if got, _ := s.GetAttempt(pending.ID); got.ConsumedAt == "" {
+		t.Fatalf("approval not marked used: %+v", got)
+	}
+
+	rejected, err := s.Reject(pending.ID, "bob", "no")
+	if !errors.Is(err, ErrNotPending) {
+		t.Fatalf("Reject decided attempt = %+v, %v", rejected, err)
+	}
+	if _, err := s.Reject("missing", "bob", ""); !errors.Is(err, ErrAttemptNotFound) {
+		t.Fatalf("Reject missing = %v", err)
+	}
+}
@@ -0,0 +1,148 @@
+package protection
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/PonyDevAI/Bull-Board/pkg/gitrefs"
+)
+
+// RefGuard compares the protected branches of a repository before and after
+// each step command, so updates that went around the hooks (another
+// core.hooksPath, --no-verify, a write under .git) are caught too. An
+// update that was not checked is checked now; when it is not allowed the
+// branch is moved back and the command fails with the *Violation, which
+// Held then finds if it waits for approval.
+type RefGuard struct {
+	store *Store
+	op    Operation
+	dir   string
+	since string
+	refs  map[string]string
+}
+
+// GuardRefs returns a RefGuard for the repository dir is in, checking
+// updates in op's context. It is a sandbox.Guard.
+func (s *Store) GuardRefs(dir string, op Operation) *RefGuard {
+	return &RefGuard{store: s, op: op, dir: dir}
+}
+
+func (g *RefGuard) Before(ctx context.Context) error {
+	refs, err := gitrefs.Branches(ctx, g.dir)
+	if err != nil {
+		return err
+	}
+	g.refs, g.since = refs, Now()
+	return nil
+}
+
+func (g *RefGuard) After(ctx context.Context) error {
+	refs, err := gitrefs.Branches(ctx, g.dir)
+	if err != nil {
+		return err
+	}
+	rules, err := g.store.Rules(g.op.WorkspaceID)
+	if err != nil {
+		return err
+	}
+	var moved []string
+	for name, oid := range refs {
+		if g.refs[name] != oid {
+			moved = append(moved, name)
+		}
+	}
+	for name := range g.refs {
+		if _, ok := refs[name]; !ok {
+			moved = append(moved, name)
+		}
+	}
+	sort.Strings(moved)
+	var refused error
+	for _, name := range moved {
+		if !protected(rules, name) {
+			continue
+		}
+		old, new := g.refs[name], refs[name]
+		op := gitrefs.Classify(ctx, g.dir, old, new, true)
+		if gitrefs.IsZero(old) {
+			if ok, err := g.store.runBranch(name); err != nil {
+				return err
+			} else if ok {
+				continue
+			}
+		}
+		o := g.op
+		o.Operation, o.Branch = op, name
+		_, err := g.store.CheckUpdate(o, g.since)
+		var v *Violation
+		if err == nil {
+			continue
+		} else if !errors.As(err, &v) {
+			return err
+		}
+		if rerr := gitrefs.Restore(ctx, g.dir, name, old, new); rerr != nil {
+			return fmt.Errorf("%v; %w", rerr, err)
+		}
+		err = fmt.Errorf("branch %q was moved back: %w", name, err)
+		if refused == nil || (errors.Is(err, ErrBlocked) && !errors.Is(refused, ErrBlocked)) {
+			refused = err
+		}
+	}
+	return refused
+}
+
+// CheckUpdate checks op, an update of a branch that was already made and
+// found by comparing the branches around a command. It is allowed without a
+// new attempt when the same update was already allowed in the workspace at
+// or after since, such as by a hook of the command, or by another step
+// that is still running, such as its commit phase while the command ran.
+// Otherwise it is checked like any operation.
+func (s *Store) CheckUpdate(op Operation, since string) (Attempt, error) {
+	items, err := s.attempts(`WHERE workspace_id = ? AND operation = ? AND branch = ? AND decision = ?
+		AND (created_at >= ? OR (step_run_id NOT IN ('', ?) AND step_run_id IN (SELECT id FROM step_runs WHERE status = 'running'))) LIMIT 1`,
+		op.WorkspaceID, op.Operation, op.Branch, DecisionAllowed, since, op.StepRunID)
+	if err != nil {
+		return Attempt{}, err
+	}
+	if len(items) > 0 {
+		return items[0], nil
+	}
+	return s.Check(op)
+}
+
+// Recheck is Check for an operation of a step that may have been checked
+// before, such as a runner's commit, checked when its job was handed out:
+// an allowed attempt of the same step run, operation and branch allows it
+// again without a new attempt, so an approval is not needed twice.
+func (s *Store) Recheck(op Operation) (Attempt, error) {
+	if op.StepRunID != "" {
+		items, err := s.attempts(`WHERE step_run_id = ? AND workspace_id = ? AND operation = ? AND branch = ? AND decision = ? LIMIT 1`,
+			op.StepRunID, op.WorkspaceID, op.Operation, op.Branch, DecisionAllowed)
+		if err != nil {
+			return Attempt{}, err
+		}
+		if len(items) > 0 {
+			return items[0], nil
+		}
+	}
+	return s.Check(op)
+}
+
+func protected(rules []Rule, branch string) bool {
+	for _, r := range rules {
+		if r.Matches(branch) {
+			return true
+		}
+	}
+	return false
+}
+
+// runBranch reports whether branch is the branch of a run's worktree, which
+// the console creates while other steps may be running.
+func (s *Store) runBranch(branch string) (bool, error) {
+	var n int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM run_worktrees WHERE branch = ?`, branch).Scan(&n)
+	return n > 0, err
+}
@@ -0,0 +1,24 @@
+package protection
+
+import (
+	"errors"
+
+	"github.com/PonyDevAI/Bull-Board/internal/console/execution_backends"
+)
+
+// StepResult is the outcome of a job whose git operation check returned err:
+// a pending approval parks the step with the attempt in its output, anything
+// else fails the job with err.
+func StepResult(err error, output map[string]any) (execution_backends.Result, error) {
+	var v *Violation
+	if !errors.As(err, &v) || v.Attempt.Decision != DecisionPending {
+		return execution_backends.Result{}, err
+	}
+	if output == nil {
+		output = map[string]any{}
+	}
+	output["error"] = err.Error()
+	output["approval"] = v.Attempt
+	output["summary"] = "waiting for approval: " + opName(v.Attempt.Operation) + " to " + v.Attempt.Branch
+	return execution_backends.Result{Status: execution_backends.StatusAwaitingApproval, Output: output}, nil
+}
@@ -0,0 +1,43 @@
+package console
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/PonyDevAI/Bull-Board/internal/console/githosting"
+)
+
+// pullRequestRefreshTimeout 限制一次从 git 托管服务回读评审状态的时长
+const pullRequestRefreshTimeout = 30 * time.Second
+
+// listTaskPullRequests 处理 GET /api/tasks/:id/pull-requests：任务 run 打开的 PR，最新在前；
+// ?refresh=1 时先向 git 托管服务回读仍打开的 PR 的状态与评审结果，回读失败的保留上次记录
+func (s *Server) listTaskPullRequests(w http.ResponseWriter, r *http.Request, taskID string) {
+	store := githosting.NewStore(s.db)
+	items, err := store.ForTask(taskID)
+	if err != nil {
+		writeJSONError(w, "db", http.StatusInternalServerError)
+		return
+	}
+	if r.URL.Query().Get("refresh") == "1" {
+		ctx, cancel := context.WithTimeout(r.Context(), pullRequestRefreshTimeout)
+		defer cancel()
+		for i, pr := range items {
+			if pr.State != "open" {
+				continue
+			}
+			fresh, err := store.Refresh(ctx, pr.ID)
+			if err != nil {
+				if !errors.Is(err, context.Canceled) {
+					slog.Warn("pull request: refresh", "id", pr.ID, "url", pr.URL, "err", err)
+				}
+				continue
+			}
+			items[i] = fresh
+		}
+	}
+	writeJSON(w, map[string]any{"items": items})
+}
@@ -0,0 +1,87 @@
+package repos
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// gitEnv runs git for one repository, authenticating ssh remotes with the
+// deploy key when there is one. Host keys are trusted on first use and
+// pinned in <root>/known_hosts.
+type gitEnv struct {
+	root string
+	key  []byte
+}
+
+func (g *gitEnv) run(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_ASKPASS=true")
+	if g.key != nil {
+		keyFile, cleanup, err := g.writeKey()
+		if err != nil {
+			return "", err
+		}
+		defer cleanup()
+		cmd.Env = append(cmd.Env, "GIT_SSH_COMMAND="+strings.Join([]string{
+			"ssh", "-i", shellQuote(keyFile),
+			"-o", "IdentitiesOnly=yes",
+			"-o", "BatchMode=yes",
+			"-o", "StrictHostKeyChecking=accept-new",
+			"-o", "UserKnownHostsFile=" + shellQuote(filepath.Join(g.root, "known_hosts")),
+		}, " "))
+	}
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Run(); err != nil {
+		return out.String(), fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(out.String()))
+	}
+	return out.String(), nil
+}
+
+// writeKey puts the decrypted key in a 0600 file for ssh to read for the
+// duration of one command.
+func (g *gitEnv) writeKey() (string, func(), error) {
+	dir := filepath.Join(g.root, ".keys")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", nil, err
+	}
+	f, err := os.CreateTemp(dir, "key-*")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() { _ = os.Remove(f.Name()) }
+	if err := f.Chmod(0600); err != nil {
+		f.Close()
+		cleanup()
+		return "", nil, err
+	}
+	_, err = f.Write(g.key)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return f.Name(), cleanup, nil
+}
+
+func isBareRepo(ctx context.Context, path string) bool {
+	if _, err := os.Stat(filepath.Join(path, "HEAD")); err != nil {
+		return false
+	}
+	out, err := (&gitEnv{}).run(ctx, path, "rev-parse", "--is-bare-repository")
+	return err == nil && strings.TrimSpace(out) == "true"
+}
+
+// shellQuote quotes s for the shell git runs GIT_SSH_COMMAND through.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
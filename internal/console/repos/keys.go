@@ -0,0 +1,62 @@
+package repos
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+var ErrInvalidKey = errors.New("invalid deploy key")
+
+// DeployKey is an SSH key pair. Private is an OpenSSH PEM block; Public is
+// the authorized_keys line to paste into the git host.
+type DeployKey struct {
+	Private     []byte
+	Public      string
+	Fingerprint string
+}
+
+// GenerateKey creates an ed25519 deploy key labelled with comment.
+func GenerateKey(comment string) (DeployKey, error) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return DeployKey{}, err
+	}
+	block, err := ssh.MarshalPrivateKey(priv, comment)
+	if err != nil {
+		return DeployKey{}, err
+	}
+	return describeKey(pem.EncodeToMemory(block), comment)
+}
+
+// ParseKey accepts an unencrypted private key in OpenSSH, PKCS#1, PKCS#8 or
+// SEC 1 form. Keys protected by a passphrase are rejected: git runs
+// unattended and could not unlock them.
+func ParseKey(privatePEM []byte, comment string) (DeployKey, error) {
+	privatePEM = []byte(strings.TrimSpace(string(privatePEM)) + "\n")
+	if _, err := ssh.ParseRawPrivateKey(privatePEM); err != nil {
+		var missing *ssh.PassphraseMissingError
+		if errors.As(err, &missing) {
+			return DeployKey{}, fmt.Errorf("%w: passphrase-protected keys are not supported", ErrInvalidKey)
+		}
+		return DeployKey{}, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+	return describeKey(privatePEM, comment)
+}
+
+func describeKey(privatePEM []byte, comment string) (DeployKey, error) {
+	signer, err := ssh.ParsePrivateKey(privatePEM)
+	if err != nil {
+		return DeployKey{}, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+	pub := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(signer.PublicKey())))
+	if comment != "" {
+		pub += " " + comment
+	}
+	return DeployKey{Private: privatePEM, Public: pub, Fingerprint: ssh.FingerprintSHA256(signer.PublicKey())}, nil
+}
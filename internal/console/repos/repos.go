@@ -0,0 +1,434 @@
+// Package repos manages the git repository behind a workspace: a remote URL,
+// an SSH deploy key kept encrypted in the database, and a bare clone under
+// PREFIX/data/repos that is fetched on demand or on a schedule. A successful
+// sync points the workspace's repo_path at the clone, so worktrees are cut
+// from it.
+package repos
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PonyDevAI/Bull-Board/internal/console/secrets"
+)
+
+// Repo statuses.
+const (
+	StatusPending  = "pending"
+	StatusCloning  = "cloning"
+	StatusFetching = "fetching"
+	StatusReady    = "ready"
+	StatusError    = "error"
+)
+
+// FetchSweepInterval is how often scheduled fetches are checked for.
+const FetchSweepInterval = time.Minute
+
+// maxError bounds the git output kept as last_error.
+const maxError = 4 << 10
+
+var (
+	ErrRepoNotFound      = errors.New("workspace repository not registered")
+	ErrWorkspaceNotFound = errors.New("workspace not found")
+	ErrInvalidRemote     = errors.New("invalid remote url")
+	ErrNoSecretKey       = errors.New("secret key not available")
+	// ErrSyncFailed wraps git failures; the repo row carries the details.
+	ErrSyncFailed = errors.New("repository sync failed")
+	ErrPushFailed = errors.New("repository push failed")
+)
+
+// Repo is a workspace_repos row. The private key never leaves the package.
+type Repo struct {
+	WorkspaceID          string `json:"workspace_id"`
+	RemoteURL            string `json:"remote_url"`
+	DefaultBranch        string `json:"default_branch"`
+	ClonePath            string `json:"clone_path"`
+	PublicKey            string `json:"deploy_key_public"`
+	KeyFingerprint       string `json:"deploy_key_fingerprint"`
+	HasKey               bool   `json:"has_deploy_key"`
+	FetchIntervalMinutes int    `json:"fetch_interval_minutes"`
+	Status               string `json:"status"`
+	LastOperation        string `json:"last_operation"`
+	LastError            string `json:"last_error"`
+	Head                 string `json:"head"`
+	LastSyncAt           string `json:"last_sync_at"`
+	CreatedAt            string `json:"created_at"`
+	UpdatedAt            string `json:"updated_at"`
+}
+
+// Manager registers repositories and keeps their clones current.
+type Manager struct {
+	db   *sql.DB
+	root string
+	box  *secrets.Box
+
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+// NewManager keeps clones under <dataDir>/repos. box seals deploy keys; with
+// a nil box keys cannot be stored or used.
+func NewManager(db *sql.DB, dataDir string, box *secrets.Box) *Manager {
+	return &Manager{db: db, root: filepath.Join(dataDir, "repos"), box: box, locks: map[string]*sync.Mutex{}}
+}
+
+// Root returns the directory holding the clones.
+func (m *Manager) Root() string { return m.root }
+
+// scpRemote matches scp-like ssh remotes, e.g. git@github.com:org/repo.git.
+var scpRemote = regexp.MustCompile(`^[A-Za-z0-9._-]+@[A-Za-z0-9.-]+:[^/\\]`)
+
+// ValidRemote reports whether url is a remote git may be pointed at: ssh,
+// https, http and file URLs, scp-like ssh addresses and absolute paths. Other
+// transports (ext::, fd::) are refused since they run commands.
+func ValidRemote(url string) bool {
+	if url == "" || url != strings.TrimSpace(url) || strings.ContainsAny(url, "\r\n\t ") || strings.HasPrefix(url, "-") {
+		return false
+	}
+	for _, p := range []string{"ssh://", "https://", "http://", "file://"} {
+		if strings.HasPrefix(url, p) && len(url) > len(p) {
+			return true
+		}
+	}
+	return filepath.IsAbs(url) || scpRemote.MatchString(url)
+}
+
+// validWorkspaceID keeps ids usable as a directory name.
+func validWorkspaceID(id string) bool {
+	return id != "" && id != "." && id != ".." && !strings.ContainsAny(id, `/\`)
+}
+
+func now() string { return time.Now().UTC().Format(time.RFC3339) }
+
+// Register sets the remote of a workspace. Changing the remote resets the
+// clone status; the next sync starts over.
+func (m *Manager) Register(workspaceID, remoteURL string, fetchIntervalMinutes int) (Repo, error) {
+	if !ValidRemote(remoteURL) {
+		return Repo{}, fmt.Errorf("%w: %q", ErrInvalidRemote, remoteURL)
+	}
+	if fetchIntervalMinutes < 0 {
+		fetchIntervalMinutes = 0
+	}
+	var exists int
+	if err := m.db.QueryRow(`SELECT COUNT(*) FROM workspaces WHERE id = ?`, workspaceID).Scan(&exists); err != nil {
+		return Repo{}, err
+	}
+	if exists == 0 || !validWorkspaceID(workspaceID) {
+		return Repo{}, ErrWorkspaceNotFound
+	}
+	ts := now()
+	_, err := m.db.Exec(`INSERT INTO workspace_repos (workspace_id, remote_url, clone_path, fetch_interval_minutes, status, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(workspace_id) DO UPDATE SET
+			status = CASE WHEN workspace_repos.remote_url = excluded.remote_url THEN workspace_repos.status ELSE excluded.status END,
+			last_error = CASE WHEN workspace_repos.remote_url = excluded.remote_url THEN workspace_repos.last_error ELSE '' END,
+			remote_url = excluded.remote_url, clone_path = excluded.clone_path,
+			fetch_interval_minutes = excluded.fetch_interval_minutes, updated_at = excluded.updated_at`,
+		workspaceID, remoteURL, m.clonePath(workspaceID), fetchIntervalMinutes, StatusPending, ts, ts)
+	if err != nil {
+		return Repo{}, err
+	}
+	return m.Get(workspaceID)
+}
+
+// Get returns a workspace's repository.
+func (m *Manager) Get(workspaceID string) (Repo, error) {
+	items, err := m.query(`WHERE r.workspace_id = ?`, workspaceID)
+	if err != nil {
+		return Repo{}, err
+	}
+	if len(items) == 0 {
+		return Repo{}, ErrRepoNotFound
+	}
+	return items[0], nil
+}
+
+// List returns all registered repositories.
+func (m *Manager) List() ([]Repo, error) {
+	return m.query(`ORDER BY r.created_at ASC`)
+}
+
+func (m *Manager) query(where string, args ...any) ([]Repo, error) {
+	rows, err := m.db.Query(`SELECT r.workspace_id, r.remote_url, COALESCE(c.default_branch,'main'), r.clone_path, r.deploy_key_public, r.deploy_key_fingerprint, r.deploy_key_encrypted != '',
+		r.fetch_interval_minutes, r.status, r.last_operation, r.last_error, r.head, COALESCE(r.last_sync_at,''), r.created_at, r.updated_at
+		FROM workspace_repos r LEFT JOIN workspace_runtime_configs c ON c.workspace_id = r.workspace_id `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Repo{}
+	for rows.Next() {
+		var r Repo
+		if err := rows.Scan(&r.WorkspaceID, &r.RemoteURL, &r.DefaultBranch, &r.ClonePath, &r.PublicKey, &r.KeyFingerprint, &r.HasKey,
+			&r.FetchIntervalMinutes, &r.Status, &r.LastOperation, &r.LastError, &r.Head, &r.LastSyncAt, &r.CreatedAt, &r.UpdatedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, r)
+	}
+	return items, rows.Err()
+}
+
+// GenerateKey creates a new deploy key for the workspace, replacing any
+// previous one. The public half is returned for the git host.
+func (m *Manager) GenerateKey(workspaceID string) (Repo, error) {
+	key, err := GenerateKey("bull-board@" + workspaceID)
+	if err != nil {
+		return Repo{}, err
+	}
+	return m.setKey(workspaceID, key)
+}
+
+// ImportKey stores an existing private key as the workspace's deploy key.
+func (m *Manager) ImportKey(workspaceID string, privatePEM []byte) (Repo, error) {
+	key, err := ParseKey(privatePEM, "bull-board@"+workspaceID)
+	if err != nil {
+		return Repo{}, err
+	}
+	return m.setKey(workspaceID, key)
+}
+
+// DeleteKey drops the deploy key; later syncs use the host's own credentials.
+func (m *Manager) DeleteKey(workspaceID string) (Repo, error) {
+	res, err := m.db.Exec(`UPDATE workspace_repos SET deploy_key_public = '', deploy_key_fingerprint = '', deploy_key_encrypted = '', updated_at = ? WHERE workspace_id = ?`, now(), workspaceID)
+	if err != nil {
+		return Repo{}, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return Repo{}, ErrRepoNotFound
+	}
+	return m.Get(workspaceID)
+}
+
+func (m *Manager) setKey(workspaceID string, key DeployKey) (Repo, error) {
+	if m.box == nil {
+		return Repo{}, ErrNoSecretKey
+	}
+	sealed, err := m.box.Seal(key.Private)
+	if err != nil {
+		return Repo{}, err
+	}
+	res, err := m.db.Exec(`UPDATE workspace_repos SET deploy_key_public = ?, deploy_key_fingerprint = ?, deploy_key_encrypted = ?, updated_at = ? WHERE workspace_id = ?`,
+		key.Public, key.Fingerprint, sealed, now(), workspaceID)
+	if err != nil {
+		return Repo{}, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return Repo{}, ErrRepoNotFound
+	}
+	return m.Get(workspaceID)
+}
+
+// privateKey returns the decrypted deploy key, or nil when none is set.
+func (m *Manager) privateKey(workspaceID string) ([]byte, error) {
+	var sealed string
+	if err := m.db.QueryRow(`SELECT deploy_key_encrypted FROM workspace_repos WHERE workspace_id = ?`, workspaceID).Scan(&sealed); err != nil {
+		return nil, err
+	}
+	if sealed == "" {
+		return nil, nil
+	}
+	if m.box == nil {
+		return nil, ErrNoSecretKey
+	}
+	return m.box.Open(sealed)
+}
+
+func (m *Manager) clonePath(workspaceID string) string {
+	return filepath.Join(m.root, workspaceID)
+}
+
+// lock serializes git operations on one clone.
+func (m *Manager) lock(workspaceID string) func() {
+	m.mu.Lock()
+	l, ok := m.locks[workspaceID]
+	if !ok {
+		l = &sync.Mutex{}
+		m.locks[workspaceID] = l
+	}
+	m.mu.Unlock()
+	l.Lock()
+	return l.Unlock
+}
+
+// Sync clones the repository when there is no clone yet and fetches it
+// otherwise, then moves the local default branch to the remote's. Git
+// failures are recorded on the repo and returned wrapped in ErrSyncFailed.
+func (m *Manager) Sync(ctx context.Context, workspaceID string) (Repo, error) {
+	unlock := m.lock(workspaceID)
+	defer unlock()
+	repo, err := m.Get(workspaceID)
+	if err != nil {
+		return repo, err
+	}
+	key, err := m.privateKey(workspaceID)
+	if err != nil {
+		return repo, err
+	}
+	path := m.clonePath(workspaceID)
+	op, status := "fetch", StatusFetching
+	if !isBareRepo(ctx, path) {
+		op, status = "clone", StatusCloning
+	}
+	if _, err := m.db.Exec(`UPDATE workspace_repos SET status = ?, last_operation = ?, updated_at = ? WHERE workspace_id = ?`, status, op, now(), workspaceID); err != nil {
+		return repo, err
+	}
+	g := &gitEnv{root: m.root, key: key}
+	head, syncErr := m.sync(ctx, g, path, repo, op == "clone")
+	ts := now()
+	if syncErr != nil {
+		msg := syncErr.Error()
+		if len(msg) > maxError {
+			msg = msg[:maxError]
+		}
+		_, err = m.db.Exec(`UPDATE workspace_repos SET status = ?, last_error = ?, last_sync_at = ?, updated_at = ? WHERE workspace_id = ?`, StatusError, msg, ts, ts, workspaceID)
+	} else {
+		_, err = m.db.Exec(`UPDATE workspace_repos SET status = ?, last_error = '', head = ?, clone_path = ?, last_sync_at = ?, updated_at = ? WHERE workspace_id = ?`, StatusReady, head, path, ts, ts, workspaceID)
+		if err == nil {
+			err = m.useClone(workspaceID, path, repo.DefaultBranch)
+		}
+	}
+	if err != nil {
+		return repo, err
+	}
+	repo, err = m.Get(workspaceID)
+	if err != nil {
+		return repo, err
+	}
+	if syncErr != nil {
+		return repo, fmt.Errorf("%w: %s %s: %v", ErrSyncFailed, op, workspaceID, syncErr)
+	}
+	return repo, nil
+}
+
+func (m *Manager) sync(ctx context.Context, g *gitEnv, path string, repo Repo, clone bool) (string, error) {
+	branch := repo.DefaultBranch
+	if _, err := g.run(ctx, "", "check-ref-format", "refs/heads/"+branch); err != nil {
+		return "", fmt.Errorf("invalid default branch %q", branch)
+	}
+	if clone {
+		// Whatever is there is a clone that never completed.
+		if err := os.RemoveAll(path); err != nil {
+			return "", err
+		}
+		if err := os.MkdirAll(m.root, 0755); err != nil {
+			return "", err
+		}
+		if _, err := g.run(ctx, m.root, "init", "--bare", "--quiet", path); err != nil {
+			return "", err
+		}
+	}
+	// Remote-tracking refs keep fetches from touching the run branches
+	// worktrees have checked out.
+	if _, err := g.run(ctx, path, "config", "remote.origin.url", repo.RemoteURL); err != nil {
+		return "", err
+	}
+	if _, err := g.run(ctx, path, "config", "remote.origin.fetch", "+refs/heads/*:refs/remotes/origin/*"); err != nil {
+		return "", err
+	}
+	if _, err := g.run(ctx, path, "fetch", "--prune", "--quiet", "origin"); err != nil {
+		return "", err
+	}
+	out, err := g.run(ctx, path, "rev-parse", "--verify", "--quiet", "refs/remotes/origin/"+branch+"^{commit}")
+	if err != nil {
+		return "", fmt.Errorf("default branch %q not found on remote", branch)
+	}
+	head := strings.TrimSpace(out)
+	if _, err := g.run(ctx, path, "update-ref", "refs/heads/"+branch, head); err != nil {
+		return "", err
+	}
+	if _, err := g.run(ctx, path, "symbolic-ref", "HEAD", "refs/heads/"+branch); err != nil {
+		return "", err
+	}
+	return head, nil
+}
+
+// Push pushes branch src of the clone to branch dst on the remote with the
+// workspace's deploy key. Without force the remote refuses an update that
+// would drop its commits; callers force only once the force push is allowed
+// by branch protection.
+func (m *Manager) Push(ctx context.Context, workspaceID, src, dst string, force bool) error {
+	unlock := m.lock(workspaceID)
+	defer unlock()
+	if _, err := m.Get(workspaceID); err != nil {
+		return err
+	}
+	path := m.clonePath(workspaceID)
+	if !isBareRepo(ctx, path) {
+		return fmt.Errorf("%w: %s has not been cloned", ErrPushFailed, workspaceID)
+	}
+	key, err := m.privateKey(workspaceID)
+	if err != nil {
+		return err
+	}
+	g := &gitEnv{root: m.root, key: key}
+	for _, b := range []string{src, dst} {
+		if _, err := g.run(ctx, "", "check-ref-format", "refs/heads/"+b); err != nil {
+			return fmt.Errorf("%w: invalid branch %q", ErrPushFailed, b)
+		}
+	}
+	if _, err := g.run(ctx, path, "push", "--quiet", "origin", refspec(src, dst, force)); err != nil {
+		return fmt.Errorf("%w: %v", ErrPushFailed, err)
+	}
+	return nil
+}
+
+// refspec maps branch src to branch dst, forced when force is set.
+func refspec(src, dst string, force bool) string {
+	spec := "refs/heads/" + src + ":refs/heads/" + dst
+	if force {
+		return "+" + spec
+	}
+	return spec
+}
+
+// useClone makes the clone the workspace's repo_path.
+func (m *Manager) useClone(workspaceID, path, defaultBranch string) error {
+	ts := now()
+	_, err := m.db.Exec(`INSERT INTO workspace_runtime_configs (workspace_id, repo_path, default_branch, created_at, updated_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(workspace_id) DO UPDATE SET repo_path = excluded.repo_path, updated_at = excluded.updated_at`,
+		workspaceID, path, defaultBranch, ts, ts)
+	return err
+}
+
+// FetchDue syncs repositories whose fetch interval has passed since the
+// last attempt, failed or not.
+func (m *Manager) FetchDue(ctx context.Context, at time.Time) {
+	items, err := m.query(`WHERE r.fetch_interval_minutes > 0`)
+	if err != nil {
+		slog.Warn("repos: list scheduled fetches", "err", err)
+		return
+	}
+	for _, r := range items {
+		if ctx.Err() != nil {
+			return
+		}
+		if last, err := time.Parse(time.RFC3339, r.LastSyncAt); err == nil && at.Sub(last) < time.Duration(r.FetchIntervalMinutes)*time.Minute {
+			continue
+		}
+		if _, err := m.Sync(ctx, r.WorkspaceID); err != nil {
+			slog.Warn("repos: scheduled sync", "workspace_id", r.WorkspaceID, "err", err)
+		}
+	}
+}
+
+// RunFetches runs scheduled fetches until ctx is done.
+func (m *Manager) RunFetches(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		m.FetchDue(ctx, time.Now().UTC())
+	}
+}
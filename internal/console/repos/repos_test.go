@@ -0,0 +1,217 @@
+package repos
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PonyDevAI/Bull-Board/internal/common"
+	"github.com/PonyDevAI/Bull-Board/internal/console/secrets"
+)
+
+func testDB(t *testing.T) *sql.DB {
+	t.Helper()
+	t.Setenv("SQLITE_PATH", filepath.Join(t.TempDir(), "bb.sqlite"))
+	db, _, err := common.OpenDB("")
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	if _, err := db.Exec(`INSERT INTO workspaces (id, home_id, name, created_at, updated_at) VALUES ('ws', 'default', 'WS', datetime('now'), datetime('now'))`); err != nil {
+		t.Fatalf("insert workspace: %v", err)
+	}
+	return db
+}
+
+func testManager(t *testing.T, db *sql.DB) *Manager {
+	t.Helper()
+	box, err := secrets.LoadBox(filepath.Join(t.TempDir(), "secret.key"))
+	if err != nil {
+		t.Fatalf("load box: %v", err)
+	}
+	return NewManager(db, t.TempDir(), box)
+}
+
+func mustGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	out, err := (&gitEnv{}).run(context.Background(), dir, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(out)
+}
+
+// remoteRepo creates a bare repository with one commit on main and returns
+// it with a work tree that pushes to it.
+func remoteRepo(t *testing.T) (string, string) {
+	t.Helper()
+	t.Setenv("GIT_AUTHOR_NAME", "test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+	bare := filepath.Join(t.TempDir(), "origin.git")
+	mustGit(t, "", "init", "--bare", "-b", "main", bare)
+	work := t.TempDir()
+	mustGit(t, work, "init", "-b", "main")
+	commit(t, work, "hello\n")
+	mustGit(t, work, "remote", "add", "origin", bare)
+	mustGit(t, work, "push", "origin", "main")
+	return bare, work
+}
+
+func commit(t *testing.T, work, content string) string {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(work, "README.md"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	mustGit(t, work, "add", "-A")
+	mustGit(t, work, "commit", "-m", "update")
+	return mustGit(t, work, "rev-parse", "HEAD")
+}
+
+func TestSyncClonesThenFetches(t *testing.T) {
+	db := testDB(t)
+	m := testManager(t, db)
+	bare, work := remoteRepo(t)
+	ctx := context.Background()
+
+	if _, err := m.Sync(ctx, "ws"); !errors.Is(err, ErrRepoNotFound) {
+		t.Fatalf("sync unregistered: %v", err)
+	}
+	repo, err := m.Register("ws", bare, 0)
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	if repo.Status != StatusPending || repo.ClonePath != filepath.Join(m.Root(), "ws") {
+		t.Fatalf("registered %+v", repo)
+	}
+	repo, err = m.Sync(ctx, "ws")
+	if err != nil {
+		t.Fatalf("clone: %v", err)
+	}
+	want := mustGit(t, work, "rev-parse", "HEAD")
+	if repo.Status != StatusReady || repo.LastOperation != "clone" || repo.Head != want || repo.LastSyncAt == "" {
+		t.Fatalf("cloned %+v, want head %s", repo, want)
+	}
+	if got := mustGit(t, repo.ClonePath, "rev-parse", "refs/heads/main"); got != want {
+		t.Fatalf("local main %s, want %s", got, want)
+	}
+	var repoPath string
+	if err := db.QueryRow(`SELECT repo_path FROM workspace_runtime_configs WHERE workspace_id = 'ws'`).Scan(&repoPath); err != nil || repoPath != repo.ClonePath {
+		t.Fatalf("workspace repo_path %q, %v", repoPath, err)
+	}
+
+	// A run branch checked out in a worktree must survive fetches.
+	mustGit(t, repo.ClonePath, "worktree", "add", "-b", "bb/run-1", filepath.Join(t.TempDir(), "wt"), "main")
+	want = commit(t, work, "second\n")
+	mustGit(t, work, "push", "origin", "main")
+	repo, err = m.Sync(ctx, "ws")
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if repo.LastOperation != "fetch" || repo.Head != want {
+		t.Fatalf("fetched %+v, want head %s", repo, want)
+	}
+}
+
+func TestSyncRecordsFailure(t *testing.T) {
+	db := testDB(t)
+	m := testManager(t, db)
+	if _, err := m.Register("ws", filepath.Join(t.TempDir(), "missing.git"), 5); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	repo, err := m.Sync(context.Background(), "ws")
+	if !errors.Is(err, ErrSyncFailed) {
+		t.Fatalf("expected ErrSyncFailed, got %v", err)
+	}
+	if repo.Status != StatusError || repo.LastOperation != "clone" || repo.LastError == "" {
+		t.Fatalf("failed repo %+v", repo)
+	}
+
+	// The retry waits for the fetch interval.
+	at, _ := time.Parse(time.RFC3339, repo.LastSyncAt)
+	m.FetchDue(context.Background(), at.Add(time.Minute))
+	if again, _ := m.Get("ws"); again.LastSyncAt != repo.LastSyncAt {
+		t.Fatalf("synced before the interval passed")
+	}
+	bare, _ := remoteRepo(t)
+	if _, err := m.Register("ws", bare, 5); err != nil {
+		t.Fatal(err)
+	}
+	m.FetchDue(context.Background(), at.Add(6*time.Minute))
+	if again, _ := m.Get("ws"); again.Status != StatusReady || again.LastError != "" {
+		t.Fatalf("scheduled sync %+v", again)
+	}
+}
+
+func TestDeployKeys(t *testing.T) {
+	db := testDB(t)
+	m := testManager(t, db)
+	if _, err := m.GenerateKey("ws"); !errors.Is(err, ErrRepoNotFound) {
+		t.Fatalf("key for unregistered repo: %v", err)
+	}
+	if _, err := m.Register("ws", "git@example.com:org/repo.git", 0); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	repo, err := m.GenerateKey("ws")
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if !repo.HasKey || !strings.HasPrefix(repo.PublicKey, "ssh-ed25519 ") || !strings.HasSuffix(repo.PublicKey, " bull-board@ws") || !strings.HasPrefix(repo.KeyFingerprint, "SHA256:") {
+		t.Fatalf("generated %+v", repo)
+	}
+	var sealed string
+	if err := db.QueryRow(`SELECT deploy_key_encrypted FROM workspace_repos WHERE workspace_id = 'ws'`).Scan(&sealed); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(sealed, "PRIVATE KEY") {
+		t.Fatal("deploy key stored in clear")
+	}
+	private, err := m.privateKey("ws")
+	if err != nil || !strings.Contains(string(private), "OPENSSH PRIVATE KEY") {
+		t.Fatalf("private key %q, %v", private, err)
+	}
+
+	imported, err := m.ImportKey("ws", private)
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if imported.KeyFingerprint != repo.KeyFingerprint {
+		t.Fatalf("imported fingerprint %s, want %s", imported.KeyFingerprint, repo.KeyFingerprint)
+	}
+	if _, err := m.ImportKey("ws", []byte("not a key")); !errors.Is(err, ErrInvalidKey) {
+		t.Fatalf("expected ErrInvalidKey, got %v", err)
+	}
+	repo, err = m.DeleteKey("ws")
+	if err != nil || repo.HasKey || repo.PublicKey != "" {
+		t.Fatalf("deleted %+v, %v", repo, err)
+	}
+}
+
+func TestValidRemote(t *testing.T) {
+	for url, want := range map[string]bool{
+		"git@github.com:org/repo.git":    true,
+		"ssh://git@host:2222/org/repo":   true,
+		"https://gitea.local/org/repo":   true,
+		"file:///srv/git/repo.git":       true,
+		"/srv/git/repo.git":              true,
+		"ext::sh -c touch% /tmp/pwned":   false,
+		"--upload-pack=touch /tmp/pwned": false,
+		"repo.git":                       false,
+		"":                               false,
+		"https://host/repo\n":            false,
+	} {
+		if got := ValidRemote(url); got != want {
+			t.Errorf("ValidRemote(%q) = %t, want %t", url, got, want)
+		}
+	}
+	db := testDB(t)
+	if _, err := testManager(t, db).Register("other", "/srv/repo.git", 0); !errors.Is(err, ErrWorkspaceNotFound) {
+		t.Fatalf("expected ErrWorkspaceNotFound, got %v", err)
+	}
+}
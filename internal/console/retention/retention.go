@@ -0,0 +1,521 @@
+// Package retention applies the retention rules in bb.json to run data:
+// finished workflow runs beyond the newest N per task, artifacts, job logs and
+// dispatch payloads older than a cutoff, and artifact storage above a size
+// cap. Runs of tasks marked important are never touched. Foreign keys are not
+// enforced by the database, so every row is deleted together with the rows
+// that reference it, in one transaction.
+package retention
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/PonyDevAI/Bull-Board/internal/common"
+	"github.com/PonyDevAI/Bull-Board/internal/console/artifacts"
+)
+
+// DefaultInterval is how often the background collector runs when the
+// config does not say.
+const DefaultInterval = time.Hour
+
+// orphanGrace protects blobs and temp files that are not referenced yet: an
+// upload is committed to the store a moment before its artifact row exists.
+const orphanGrace = time.Hour
+
+// activeJob matches jobs a backend or runner may still write to.
+const activeJob = `status IN ('queued','running','cancelling')`
+
+// importantJob matches jobs of runs whose task is marked important.
+const importantJob = `step_run_id IN (SELECT sr.id FROM step_runs sr JOIN workflow_runs r ON r.id = sr.workflow_run_id JOIN legacy_tasks t ON t.id = r.task_id WHERE t.important = 1)`
+
+// Interval returns the configured collection interval.
+func Interval(policy common.RetentionConfig) time.Duration {
+	if policy.IntervalMinutes > 0 {
+		return time.Duration(policy.IntervalMinutes) * time.Minute
+	}
+	return DefaultInterval
+}
+
+// Report is what a collection deleted, or would delete on a dry run.
+type Report struct {
+	DryRun        bool  `json:"dry_run"`
+	WorkflowRuns  int   `json:"workflow_runs"`
+	StepRuns      int   `json:"step_runs"`
+	Jobs          int   `json:"jobs"`
+	Artifacts     int   `json:"artifacts"`
+	TestRuns      int   `json:"test_runs"`
+	ToolCalls     int   `json:"tool_calls"`
+	GitOperations int   `json:"git_operations"`
+	LogChunks     int   `json:"log_chunks"`
+	Payloads      int   `json:"payloads"`
+	Blobs         int   `json:"blobs"`
+	Files         int   `json:"files"`
+	BlobBytes     int64 `json:"blob_bytes"`
+	LogBytes      int64 `json:"log_bytes"`
+	PayloadBytes  int64 `json:"payload_bytes"`
+	FileBytes     int64 `json:"file_bytes"`
+	BytesFreed    int64 `json:"bytes_freed"`
+	// StorageBytes is the artifact storage still referenced afterwards.
+	StorageBytes int64 `json:"storage_bytes"`
+}
+
+// Collector deletes run data the policy no longer keeps.
+type Collector struct {
+	db      *sql.DB
+	dataDir string
+	store   *artifacts.Store
+	policy  common.RetentionConfig
+	now     func() time.Time
+}
+
+func New(db *sql.DB, dataDir string, policy common.RetentionConfig) *Collector {
+	return &Collector{
+		db:      db,
+		dataDir: dataDir,
+		store:   artifacts.NewStore(filepath.Join(dataDir, "artifacts")),
+		policy:  policy,
+		now:     func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// Run collects every interval until ctx is done.
+func (c *Collector) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		rep, err := c.Collect(ctx, false)
+		if err != nil {
+			slog.Warn("retention: collect", "err", err)
+			continue
+		}
+		if rep.BytesFreed > 0 || rep.WorkflowRuns > 0 || rep.Artifacts > 0 {
+			slog.Info("retention: collected", "workflow_runs", rep.WorkflowRuns, "artifacts", rep.Artifacts, "blobs", rep.Blobs, "bytes_freed", rep.BytesFreed)
+		}
+	}
+}
+
+// collection is the state of one Collect call.
+type collection struct {
+	tx  *sql.Tx
+	rep *Report
+	// released holds blobs whose artifacts were deleted in this collection;
+	// they are swept without waiting for orphanGrace.
+	released map[string]bool
+	// jobDirs are local job directories to remove once the deletions commit.
+	jobDirs map[string]bool
+	// remove are store paths to remove once the deletions commit.
+	remove map[string]string
+}
+
+// Collect applies the policy. A dry run computes the same report inside a
+// transaction that is rolled back and leaves files in place.
+func (c *Collector) Collect(ctx context.Context, dryRun bool) (Report, error) {
+	rep := Report{DryRun: dryRun}
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return rep, err
+	}
+	defer tx.Rollback()
+	col := &collection{tx: tx, rep: &rep, released: map[string]bool{}, jobDirs: map[string]bool{}, remove: map[string]string{}}
+	now := c.now()
+	if c.policy.KeepRunsPerTask > 0 {
+		if err := c.pruneRuns(col); err != nil {
+			return rep, err
+		}
+	}
+	if c.policy.ArtifactMaxAgeDays > 0 {
+		if err := c.expire(col, now.Add(-time.Duration(c.policy.ArtifactMaxAgeDays)*24*time.Hour)); err != nil {
+			return rep, err
+		}
+	}
+	if err := c.capStorage(col); err != nil {
+		return rep, err
+	}
+	if err := c.sweepBlobs(col, now.Add(-orphanGrace)); err != nil {
+		return rep, err
+	}
+	c.sizeJobDirs(col)
+	rep.BytesFreed = rep.BlobBytes + rep.LogBytes + rep.PayloadBytes + rep.FileBytes
+	if dryRun {
+		return rep, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return rep, err
+	}
+	c.removeFiles(col)
+	return rep, nil
+}
+
+// pruneRuns deletes finished runs beyond the newest KeepRunsPerTask of each
+// task. Runs with an active job are kept whatever their status says.
+func (c *Collector) pruneRuns(col *collection) error {
+	runIDs, err := queryStrings(col.tx, `SELECT id FROM (
+		SELECT r.id, r.task_id, r.status, ROW_NUMBER() OVER (PARTITION BY r.task_id ORDER BY r.created_at DESC, r.rowid DESC) AS n
+		FROM workflow_runs r WHERE r.task_id IS NOT NULL AND r.task_id != ''
+	) x WHERE x.n > ? AND x.status IN ('completed','failed','cancelled')
+	AND x.task_id NOT IN (SELECT id FROM legacy_tasks WHERE important = 1)
+	AND x.id NOT IN (SELECT sr.workflow_run_id FROM step_runs sr JOIN jobs j ON j.step_run_id = sr.id WHERE j.`+activeJob+`)`, c.policy.KeepRunsPerTask)
+	if err != nil || len(runIDs) == 0 {
+		return err
+	}
+	stepRunIDs, err := queryIn(col.tx, `SELECT id FROM step_runs WHERE workflow_run_id IN `, runIDs)
+	if err != nil {
+		return err
+	}
+	jobIDs, err := queryIn(col.tx, `SELECT id FROM jobs WHERE step_run_id IN `, stepRunIDs)
+	if err != nil {
+		return err
+	}
+	if err := c.deleteJobs(col, jobIDs); err != nil {
+		return err
+	}
+	// Rows recorded against a step run without a job of it are left over.
+	artifactIDs, err := queryIn(col.tx, `SELECT id FROM artifacts WHERE step_run_id IN `, stepRunIDs)
+	if err != nil {
+		return err
+	}
+	if err := c.deleteArtifacts(col, artifactIDs); err != nil {
+		return err
+	}
+	if err := deleteIn(col.tx, &col.rep.ToolCalls, `DELETE FROM tool_calls WHERE step_run_id IN `, stepRunIDs); err != nil {
+		return err
+	}
+	if err := deleteIn(col.tx, &col.rep.StepRuns, `DELETE FROM step_runs WHERE id IN `, stepRunIDs); err != nil {
+		return err
+	}
+	// The run's branch operations go with it. Their approvals are matched by
+	// step run, so they are not kept with the ids cleared.
+	if err := deleteIn(col.tx, &col.rep.GitOperations, `DELETE FROM git_operation_attempts WHERE workflow_run_id IN `, runIDs); err != nil {
+		return err
+	}
+	// Pull requests belong to the task and stay tracked; they only lose the
+	// run that last pushed to them.
+	if err := deleteIn(col.tx, nil, `UPDATE pull_requests SET workflow_run_id = '' WHERE workflow_run_id IN `, runIDs); err != nil {
+		return err
+	}
+	return deleteIn(col.tx, &col.rep.WorkflowRuns, `DELETE FROM workflow_runs WHERE id IN `, runIDs)
+}
+
+// deleteJobs deletes jobs with their logs, tool calls, artifacts and test reports.
+func (c *Collector) deleteJobs(col *collection, jobIDs []string) error {
+	if len(jobIDs) == 0 {
+		return nil
+	}
+	artifactIDs, err := queryIn(col.tx, `SELECT id FROM artifacts WHERE job_id IN `, jobIDs)
+	if err != nil {
+		return err
+	}
+	if err := c.deleteArtifacts(col, artifactIDs); err != nil {
+		return err
+	}
+	if err := c.deleteLogs(col, jobIDs); err != nil {
+		return err
+	}
+	if err := deleteIn(col.tx, &col.rep.ToolCalls, `DELETE FROM tool_calls WHERE job_id IN `, jobIDs); err != nil {
+		return err
+	}
+	if err := deleteIn(col.tx, &col.rep.Jobs, `DELETE FROM jobs WHERE id IN `, jobIDs); err != nil {
+		return err
+	}
+	for _, id := range jobIDs {
+		col.jobDirs[id] = true
+	}
+	return nil
+}
+
+// deleteArtifacts deletes artifacts and the test reports parsed from them,
+// noting the blobs they referenced.
+func (c *Collector) deleteArtifacts(col *collection, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	sums, err := queryIn(col.tx, `SELECT DISTINCT sha256 FROM artifacts WHERE sha256 != '' AND id IN `, ids)
+	if err != nil {
+		return err
+	}
+	for _, sum := range sums {
+		col.released[sum] = true
+	}
+	runIDs, err := queryIn(col.tx, `SELECT id FROM test_runs WHERE artifact_id IN `, ids)
+	if err != nil {
+		return err
+	}
+	if err := deleteIn(col.tx, nil, `DELETE FROM test_cases WHERE test_run_id IN `, runIDs); err != nil {
+		return err
+	}
+	if err := deleteIn(col.tx, &col.rep.TestRuns, `DELETE FROM test_runs WHERE id IN `, runIDs); err != nil {
+		return err
+	}
+	return deleteIn(col.tx, &col.rep.Artifacts, `DELETE FROM artifacts WHERE id IN `, ids)
+}
+
+// deleteLogs deletes the log chunks of jobs.
+func (c *Collector) deleteLogs(col *collection, jobIDs []string) error {
+	for _, batch := range batches(jobIDs) {
+		var bytes int64
+		if err := col.tx.QueryRow(`SELECT COALESCE(SUM(LENGTH(CAST(content AS BLOB))),0) FROM job_logs WHERE job_id IN `+placeholders(len(batch)), anys(batch)...).Scan(&bytes); err != nil {
+			return err
+		}
+		col.rep.LogBytes += bytes
+	}
+	return deleteIn(col.tx, &col.rep.LogChunks, `DELETE FROM job_logs WHERE job_id IN `, jobIDs)
+}
+
+// expire deletes artifacts created before cutoff, and drops the logs and
+// dispatch payloads of jobs that finished before it. Jobs of important tasks
+// and jobs still active are skipped; the job rows themselves stay.
+func (c *Collector) expire(col *collection, cutoff time.Time) error {
+	before := cutoff.Format(time.RFC3339)
+	artifactIDs, err := queryStrings(col.tx, `SELECT a.id FROM artifacts a JOIN jobs j ON j.id = a.job_id
+		WHERE datetime(a.created_at) < datetime(?) AND NOT j.`+activeJob+` AND NOT j.`+importantJob, before)
+	if err != nil {
+		return err
+	}
+	if err := c.deleteArtifacts(col, artifactIDs); err != nil {
+		return err
+	}
+	jobIDs, err := queryStrings(col.tx, `SELECT id FROM jobs
+		WHERE finished_at IS NOT NULL AND datetime(finished_at) < datetime(?) AND NOT `+activeJob+` AND NOT `+importantJob, before)
+	if err != nil || len(jobIDs) == 0 {
+		return err
+	}
+	if err := c.deleteLogs(col, jobIDs); err != nil {
+		return err
+	}
+	// Only active jobs read their payload back; finished ones keep '{}'.
+	for _, batch := range batches(jobIDs) {
+		in := placeholders(len(batch))
+		var n int
+		var bytes int64
+		if err := col.tx.QueryRow(`SELECT COUNT(*), COALESCE(SUM(LENGTH(CAST(request_json AS BLOB)) - 2),0) FROM jobs WHERE request_json != '{}' AND id IN `+in, anys(batch)...).Scan(&n, &bytes); err != nil {
+			return err
+		}
+		if _, err := col.tx.Exec(`UPDATE jobs SET request_json = '{}' WHERE request_json != '{}' AND id IN `+in, anys(batch)...); err != nil {
+			return err
+		}
+		col.rep.Payloads += n
+		col.rep.PayloadBytes += bytes
+	}
+	// A job directory may hold the only copy of an artifact that never made
+	// it into the store; keep those.
+	kept, err := queryIn(col.tx, `SELECT DISTINCT job_id FROM artifacts WHERE sha256 = '' AND job_id IN `, jobIDs)
+	if err != nil {
+		return err
+	}
+	skip := map[string]bool{}
+	for _, id := range kept {
+		skip[id] = true
+	}
+	for _, id := range jobIDs {
+		if !skip[id] {
+			col.jobDirs[id] = true
+		}
+	}
+	return nil
+}
+
+// capStorage deletes the oldest artifacts until the blobs still referenced
+// fit in MaxStorageMB. A blob shared by several artifacts only counts, and
+// is only freed, once. Artifacts of important tasks and active jobs are kept
+// even when that leaves storage above the cap.
+func (c *Collector) capStorage(col *collection) error {
+	refs := map[string]int{}
+	sizes := map[string]int64{}
+	rows, err := col.tx.Query(`SELECT sha256, size_bytes FROM artifacts WHERE sha256 != ''`)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var sum string
+		var size int64
+		if err := rows.Scan(&sum, &size); err != nil {
+			rows.Close()
+			return err
+		}
+		refs[sum]++
+		sizes[sum] = size
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	var total int64
+	for _, size := range sizes {
+		total += size
+	}
+	limit := c.policy.MaxStorageMB << 20
+	if c.policy.MaxStorageMB <= 0 || total <= limit {
+		col.rep.StorageBytes = total
+		return nil
+	}
+	rows, err = col.tx.Query(`SELECT a.id, a.sha256 FROM artifacts a JOIN jobs j ON j.id = a.job_id
+		WHERE a.sha256 != '' AND NOT j.` + activeJob + ` AND NOT j.` + importantJob + `
+		ORDER BY datetime(a.created_at) ASC, a.rowid ASC`)
+	if err != nil {
+		return err
+	}
+	var victims []string
+	for total > limit && rows.Next() {
+		var id, sum string
+		if err := rows.Scan(&id, &sum); err != nil {
+			rows.Close()
+			return err
+		}
+		victims = append(victims, id)
+		if refs[sum]--; refs[sum] == 0 {
+			total -= sizes[sum]
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	col.rep.StorageBytes = total
+	return c.deleteArtifacts(col, victims)
+}
+
+// sweepBlobs deletes stored blobs no artifact references, plus stale temp
+// files. Blobs released by this collection go at once; other unreferenced
+// blobs only after orphanGrace, so an upload in flight is not lost.
+func (c *Collector) sweepBlobs(col *collection, graceCutoff time.Time) error {
+	referenced := map[string]bool{}
+	sums, err := queryStrings(col.tx, `SELECT DISTINCT sha256 FROM artifacts WHERE sha256 != ''`)
+	if err != nil {
+		return err
+	}
+	for _, sum := range sums {
+		referenced[sum] = true
+	}
+	orphan := func(sum string, at time.Time) bool {
+		return !referenced[sum] && (col.released[sum] || at.Before(graceCutoff))
+	}
+	rows, err := col.tx.Query(`SELECT sha256, created_at FROM artifact_blobs`)
+	if err != nil {
+		return err
+	}
+	var stale []string
+	for rows.Next() {
+		var sum, createdAt string
+		if err := rows.Scan(&sum, &createdAt); err != nil {
+			rows.Close()
+			return err
+		}
+		at, _ := time.Parse(time.RFC3339, createdAt)
+		if orphan(sum, at) {
+			stale = append(stale, sum)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if err := deleteIn(col.tx, nil, `DELETE FROM artifact_blobs WHERE sha256 IN `, stale); err != nil {
+		return err
+	}
+	swept := map[string]bool{}
+	for _, sum := range stale {
+		swept[sum] = true
+	}
+	if c.dataDir == "" {
+		col.rep.Blobs = len(swept)
+		return nil
+	}
+	err = filepath.WalkDir(filepath.Join(c.store.Root, "blobs", "sha256"), func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !artifacts.ValidHash(d.Name()) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		sum := d.Name()
+		if !swept[sum] && !orphan(sum, info.ModTime()) {
+			return nil
+		}
+		swept[sum] = true
+		col.remove[sum] = path
+		col.rep.BlobBytes += info.Size()
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	col.rep.Blobs = len(swept)
+	entries, _ := os.ReadDir(filepath.Join(c.store.Root, "tmp"))
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil || e.IsDir() || !info.ModTime().Before(graceCutoff) {
+			continue
+		}
+		col.remove["tmp/"+e.Name()] = filepath.Join(c.store.Root, "tmp", e.Name())
+		col.rep.Files++
+		col.rep.FileBytes += info.Size()
+	}
+	return nil
+}
+
+// sizeJobDirs counts the local job directories that will be removed.
+func (c *Collector) sizeJobDirs(col *collection) {
+	for id := range col.jobDirs {
+		dir, ok := c.jobDir(id)
+		if !ok {
+			delete(col.jobDirs, id)
+			continue
+		}
+		_ = filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return nil
+			}
+			if info, err := d.Info(); err == nil {
+				col.rep.Files++
+				col.rep.FileBytes += info.Size()
+			}
+			return nil
+		})
+	}
+}
+
+// jobDir returns the local directory of a job when it exists.
+func (c *Collector) jobDir(jobID string) (string, bool) {
+	if c.dataDir == "" || jobID == "" || strings.ContainsAny(jobID, `/\`) || jobID == "." || jobID == ".." {
+		return "", false
+	}
+	dir := filepath.Join(c.dataDir, "artifacts", "jobs", jobID)
+	info, err := os.Stat(dir)
+	return dir, err == nil && info.IsDir()
+}
+
+// removeFiles removes what the committed collection released. A blob that
+// an artifact recorded since references again is left in place.
+func (c *Collector) removeFiles(col *collection) {
+	for key, path := range col.remove {
+		if artifacts.ValidHash(key) {
+			var n int
+			if err := c.db.QueryRow(`SELECT COUNT(*) FROM artifacts WHERE sha256 = ?`, key).Scan(&n); err != nil || n > 0 {
+				continue
+			}
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			slog.Warn("retention: remove file", "path", path, "err", err)
+		}
+	}
+	for id := range col.jobDirs {
+		if dir, ok := c.jobDir(id); ok {
+			if err := os.RemoveAll(dir); err != nil {
+				slog.Warn("retention: remove job dir", "path", dir, "err", err)
+			}
+		}
+	}
+}
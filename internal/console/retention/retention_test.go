@@ -0,0 +1,262 @@
+package retention
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PonyDevAI/Bull-Board/internal/common"
+	"github.com/PonyDevAI/Bull-Board/internal/console/artifacts"
+)
+
+func testDB(t *testing.T) *sql.DB {
+	t.Helper()
+	t.Setenv("SQLITE_PATH", filepath.Join(t.TempDir(), "bb.sqlite"))
+	db, _, err := common.OpenDB("")
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	return db
+}
+
+var now = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func ts(d time.Duration) string { return now.Add(-d).Format(time.RFC3339) }
+
+func seedTask(t *testing.T, db *sql.DB, id string, important bool) {
+	t.Helper()
+	if _, err := db.Exec(`INSERT INTO legacy_tasks (id, workspace_id, title, important, created_at, updated_at) VALUES (?, 'ws', ?, ?, ?, ?)`, id, id, important, ts(0), ts(0)); err != nil {
+		t.Fatalf("insert task: %v", err)
+	}
+}
+
+// seedRun inserts a run with one step run and job that logged output,
+// recorded a tool call and stored content as a test report artifact.
+func seedRun(t *testing.T, db *sql.DB, store *artifacts.Store, taskID, id, status, jobStatus string, age time.Duration, content string) {
+	t.Helper()
+	at := ts(age)
+	blob, err := store.Put(strings.NewReader(content), "report.xml")
+	if err != nil {
+		t.Fatalf("store blob: %v", err)
+	}
+	for _, q := range []struct {
+		sql  string
+		args []any
+	}{
+		{`INSERT INTO workflow_runs (id, workspace_id, workflow_template_id, task_id, status, created_at, updated_at) VALUES (?, 'ws', 'tpl', ?, ?, ?, ?)`, []any{id, taskID, status, at, at}},
+		{`INSERT INTO step_runs (id, workflow_run_id, workflow_step_template_id, status, created_at, updated_at) VALUES (?, ?, 'step', ?, ?, ?)`, []any{"sr-" + id, id, status, at, at}},
+		{`INSERT INTO jobs (id, step_run_id, status, request_json, finished_at, created_at, updated_at) VALUES (?, ?, ?, '{"step":{"name":"verify"}}', ?, ?, ?)`, []any{"job-" + id, "sr-" + id, jobStatus, at, at, at}},
+		{`INSERT INTO job_logs (job_id, byte_offset, content, created_at) VALUES (?, 0, 'hello', ?)`, []any{"job-" + id, at}},
+		{`INSERT INTO tool_calls (id, job_id, step_run_id, seq, tool, started_at) VALUES (?, ?, ?, 1, 'shell', ?)`, []any{"tc-" + id, "job-" + id, "sr-" + id, at}},
+		{`INSERT INTO artifact_blobs (sha256, size_bytes, created_at) VALUES (?, ?, ?) ON CONFLICT(sha256) DO NOTHING`, []any{blob.SHA256, blob.Size, at}},
+		{`INSERT INTO artifacts (id, job_id, step_run_id, kind, uri, sha256, size_bytes, created_at) VALUES (?, ?, ?, 'test_report', ?, ?, ?, ?)`, []any{"art-" + id, "job-" + id, "sr-" + id, blob.URI(), blob.SHA256, blob.Size, at}},
+		{`INSERT INTO test_runs (id, job_id, step_run_id, artifact_id, format, created_at) VALUES (?, ?, ?, ?, 'junit', ?)`, []any{"tr-" + id, "job-" + id, "sr-" + id, "art-" + id, at}},
+		{`INSERT INTO test_cases (test_run_id, seq, name, status) VALUES (?, 1, 'TestA', 'passed')`, []any{"tr-" + id}},
+	} {
+		if _, err := db.Exec(q.sql, q.args...); err != nil {
+			t.Fatalf("seed %s: %v", q.sql, err)
+		}
+	}
+}
+
+func count(t *testing.T, db *sql.DB, query string, args ...any) int {
+	t.Helper()
+	var n int
+	if err := db.QueryRow(query, args...).Scan(&n); err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	return n
+}
+
+func newCollector(db *sql.DB, dataDir string, policy common.RetentionConfig) *Collector {
+	c := New(db, dataDir, policy)
+	c.now = func() time.Time { return now }
+	return c
+}
+
+func TestCollectKeepsLastRunsPerTask(t *testing.T) {
+	db := testDB(t)
+	dataDir := t.TempDir()
+	c := newCollector(db, dataDir, common.RetentionConfig{KeepRunsPerTask: 1})
+	seedTask(t, db, "task-a", false)
+	seedTask(t, db, "task-b", true)
+	seedRun(t, db, c.store, "task-a", "a1", "completed", "succeeded", 4*time.Hour, "shared")
+	seedRun(t, db, c.store, "task-a", "a2", "failed", "failed", 3*time.Hour, "only a2")
+	// Still running although its run says otherwise: kept.
+	seedRun(t, db, c.store, "task-a", "a3", "failed", "running", 2*time.Hour, "only a3")
+	seedRun(t, db, c.store, "task-a", "a4", "completed", "succeeded", time.Hour, "shared")
+	seedRun(t, db, c.store, "task-b", "b1", "completed", "succeeded", 4*time.Hour, "only b1")
+	seedRun(t, db, c.store, "task-b", "b2", "completed", "succeeded", time.Hour, "only b2")
+	for number, id := range []string{"a1", "a4"} {
+		if _, err := db.Exec(`INSERT INTO git_operation_attempts (id, workspace_id, operation, branch, source, decision, task_id, workflow_run_id, step_run_id, created_at) VALUES (?, 'ws', 'push', 'main', 'step', 'approved', 'task-a', ?, ?, ?)`, "op-"+id, id, "sr-"+id, ts(0)); err != nil {
+			t.Fatalf("insert git operation: %v", err)
+		}
+		if _, err := db.Exec(`INSERT INTO pull_requests (id, integration_instance_id, repo, number, url, workspace_id, task_id, workflow_run_id, head_branch, base_branch, created_at, updated_at) VALUES (?, 'gitea', 'o/r', ?, '', 'ws', 'task-a', ?, 'bb/a', 'main', ?, ?)`, "pr-"+id, number+1, id, ts(0), ts(0)); err != nil {
+			t.Fatalf("insert pull request: %v", err)
+		}
+	}
+	jobDir := filepath.Join(dataDir, "artifacts", "jobs", "job-a1")
+	if err := os.MkdirAll(jobDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(jobDir, "execution.log"), []byte("0123456789"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	onlyA2, _ := c.store.Path(blobSum(t, db, "art-a2"))
+
+	dry, err := c.Collect(context.Background(), true)
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if dry.WorkflowRuns != 2 || dry.Jobs != 2 || dry.Artifacts != 2 || dry.TestRuns != 2 || dry.ToolCalls != 2 || dry.LogChunks != 2 || dry.GitOperations != 1 {
+		t.Fatalf("dry run report %+v", dry)
+	}
+	// "shared" is still referenced by a4; only a2's blob goes.
+	if dry.Blobs != 1 || dry.BlobBytes != int64(len("only a2")) || dry.Files != 1 || dry.FileBytes != 10 || dry.LogBytes != 10 {
+		t.Fatalf("dry run sizes %+v", dry)
+	}
+	if dry.BytesFreed != dry.BlobBytes+dry.LogBytes+dry.FileBytes {
+		t.Fatalf("bytes freed %d", dry.BytesFreed)
+	}
+	if n := count(t, db, `SELECT COUNT(*) FROM workflow_runs`); n != 6 {
+		t.Fatalf("dry run deleted runs: %d left", n)
+	}
+	if _, err := os.Stat(onlyA2); err != nil {
+		t.Fatalf("dry run removed blob: %v", err)
+	}
+
+	rep, err := c.Collect(context.Background(), false)
+	if err != nil {
+		t.Fatalf("collect: %v", err)
+	}
+	rep.DryRun = true
+	if rep != dry {
+		t.Fatalf("report %+v differs from dry run %+v", rep, dry)
+	}
+	for _, id := range []string{"a1", "a2"} {
+		for table, q := range map[string]string{
+			"workflow_runs": `SELECT COUNT(*) FROM workflow_runs WHERE id = ?`,
+			"step_runs":     `SELECT COUNT(*) FROM step_runs WHERE id = 'sr-' || ?`,
+			"jobs":          `SELECT COUNT(*) FROM jobs WHERE id = 'job-' || ?`,
+			"job_logs":      `SELECT COUNT(*) FROM job_logs WHERE job_id = 'job-' || ?`,
+			"tool_calls":    `SELECT COUNT(*) FROM tool_calls WHERE job_id = 'job-' || ?`,
+			"artifacts":     `SELECT COUNT(*) FROM artifacts WHERE id = 'art-' || ?`,
+			"test_runs":     `SELECT COUNT(*) FROM test_runs WHERE id = 'tr-' || ?`,
+			"test_cases":    `SELECT COUNT(*) FROM test_cases WHERE test_run_id = 'tr-' || ?`,
+		} {
+			if n := count(t, db, q, id); n != 0 {
+				t.Errorf("%s of run %s left: %d", table, id, n)
+			}
+		}
+	}
+	if n := count(t, db, `SELECT COUNT(*) FROM workflow_runs`); n != 4 {
+		t.Fatalf("runs left %d, want a3, a4, b1, b2", n)
+	}
+	for table, q := range map[string]string{
+		"git_operation_attempts": `SELECT COUNT(*) FROM git_operation_attempts WHERE workflow_run_id != '' AND workflow_run_id NOT IN (SELECT id FROM workflow_runs)`,
+		"pull_requests":          `SELECT COUNT(*) FROM pull_requests WHERE workflow_run_id != '' AND workflow_run_id NOT IN (SELECT id FROM workflow_runs)`,
+	} {
+		if n := count(t, db, q); n != 0 {
+			t.Errorf("%s orphaned by pruned runs: %d", table, n)
+		}
+	}
+	if n := count(t, db, `SELECT COUNT(*) FROM git_operation_attempts WHERE id = 'op-a4'`); n != 1 {
+		t.Fatal("git operation of a kept run deleted")
+	}
+	if n := count(t, db, `SELECT COUNT(*) FROM pull_requests WHERE id = 'pr-a1' AND task_id = 'task-a'`); n != 1 {
+		t.Fatal("pull request of a pruned run no longer tracked for its task")
+	}
+	if _, err := os.Stat(onlyA2); !os.IsNotExist(err) {
+		t.Fatalf("orphaned blob kept: %v", err)
+	}
+	if _, err := os.Stat(jobDir); !os.IsNotExist(err) {
+		t.Fatalf("job dir kept: %v", err)
+	}
+	if !c.store.Has(blobSum(t, db, "art-a4")) {
+		t.Fatal("shared blob removed")
+	}
+	if n := count(t, db, `SELECT COUNT(*) FROM artifact_blobs`); n != 4 {
+		t.Fatalf("artifact_blobs rows %d, want 4", n)
+	}
+}
+
+func TestCollectExpiresOldDataAndCapsStorage(t *testing.T) {
+	db := testDB(t)
+	dataDir := t.TempDir()
+	c := newCollector(db, dataDir, common.RetentionConfig{ArtifactMaxAgeDays: 7})
+	seedTask(t, db, "task-a", false)
+	seedTask(t, db, "task-b", true)
+	day := 24 * time.Hour
+	seedRun(t, db, c.store, "task-a", "old", "completed", "succeeded", 10*day, strings.Repeat("o", 1<<20))
+	seedRun(t, db, c.store, "task-a", "active", "running", "running", 10*day, "active")
+	seedRun(t, db, c.store, "task-b", "kept", "completed", "succeeded", 10*day, "important")
+	seedRun(t, db, c.store, "task-a", "mid", "completed", "succeeded", 3*day, strings.Repeat("m", 1<<20))
+	seedRun(t, db, c.store, "task-a", "new", "completed", "succeeded", day, strings.Repeat("n", 1<<20))
+	// Unreferenced blobs: one left over from long ago, one just uploaded.
+	stale, err := c.store.Put(strings.NewReader("stale"), "x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stalePath, _ := c.store.Path(stale.SHA256)
+	_ = os.Chtimes(stalePath, now.Add(-2*time.Hour), now.Add(-2*time.Hour))
+	fresh, err := c.store.Put(strings.NewReader("fresh"), "x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	freshPath, _ := c.store.Path(fresh.SHA256)
+	_ = os.Chtimes(freshPath, now, now)
+
+	rep, err := c.Collect(context.Background(), false)
+	if err != nil {
+		t.Fatalf("collect: %v", err)
+	}
+	if rep.WorkflowRuns != 0 || rep.Jobs != 0 || rep.Artifacts != 1 || rep.LogChunks != 1 || rep.Payloads != 1 || rep.Blobs != 2 {
+		t.Fatalf("report %+v", rep)
+	}
+	if n := count(t, db, `SELECT COUNT(*) FROM artifacts WHERE id IN ('art-active','art-kept','art-mid','art-new')`); n != 4 {
+		t.Fatalf("recent, active or important artifacts deleted: %d left", n)
+	}
+	if n := count(t, db, `SELECT COUNT(*) FROM jobs WHERE id = 'job-old' AND request_json = '{}'`); n != 1 {
+		t.Fatal("old job payload not compacted")
+	}
+	if n := count(t, db, `SELECT COUNT(*) FROM jobs WHERE request_json != '{}'`); n != 4 {
+		t.Fatalf("payloads compacted beyond the old job: %d kept", n)
+	}
+	if _, err := os.Stat(stalePath); !os.IsNotExist(err) {
+		t.Fatalf("stale blob kept: %v", err)
+	}
+	if !c.store.Has(fresh.SHA256) {
+		t.Fatal("fresh upload swept")
+	}
+
+	// Two 1 MiB blobs plus small ones: a 2 MB cap drops the oldest
+	// deletable artifact, then stops.
+	c.policy = common.RetentionConfig{MaxStorageMB: 2}
+	rep, err = c.Collect(context.Background(), false)
+	if err != nil {
+		t.Fatalf("cap: %v", err)
+	}
+	if rep.Artifacts != 1 || rep.StorageBytes > 2<<20 {
+		t.Fatalf("cap report %+v", rep)
+	}
+	if n := count(t, db, `SELECT COUNT(*) FROM artifacts WHERE id = 'art-mid'`); n != 0 {
+		t.Fatal("oldest artifact kept over the cap")
+	}
+	if n := count(t, db, `SELECT COUNT(*) FROM artifacts WHERE id IN ('art-active','art-kept','art-new')`); n != 3 {
+		t.Fatal("cap deleted more than needed")
+	}
+}
+
+func blobSum(t *testing.T, db *sql.DB, artifactID string) string {
+	t.Helper()
+	var sum string
+	if err := db.QueryRow(`SELECT sha256 FROM artifacts WHERE id = ?`, artifactID).Scan(&sum); err != nil {
+		t.Fatalf("artifact %s: %v", artifactID, err)
+	}
+	return sum
+}
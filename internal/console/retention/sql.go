@@ -0,0 +1,78 @@
+package retention
+
+import (
+	"database/sql"
+	"strings"
+)
+
+// batchSize bounds the ids bound into one IN (...) list.
+const batchSize = 500
+
+func queryStrings(tx *sql.Tx, query string, args ...any) ([]string, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []string
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+// queryIn runs query, which ends in "IN ", once per batch of ids and
+// collects the single column it selects.
+func queryIn(tx *sql.Tx, query string, ids []string) ([]string, error) {
+	var out []string
+	for _, batch := range batches(ids) {
+		got, err := queryStrings(tx, query+placeholders(len(batch)), anys(batch)...)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, got...)
+	}
+	return out, nil
+}
+
+// deleteIn runs a DELETE ending in "IN " per batch of ids, adding the rows
+// it deleted to count when count is not nil.
+func deleteIn(tx *sql.Tx, count *int, query string, ids []string) error {
+	for _, batch := range batches(ids) {
+		res, err := tx.Exec(query+placeholders(len(batch)), anys(batch)...)
+		if err != nil {
+			return err
+		}
+		if count != nil {
+			n, _ := res.RowsAffected()
+			*count += int(n)
+		}
+	}
+	return nil
+}
+
+func batches(ids []string) [][]string {
+	var out [][]string
+	for len(ids) > 0 {
+		n := min(len(ids), batchSize)
+		out = append(out, ids[:n])
+		ids = ids[n:]
+	}
+	return out
+}
+
+func placeholders(n int) string {
+	return "(" + strings.TrimSuffix(strings.Repeat("?,", n), ",") + ")"
+}
+
+func anys(ids []string) []any {
+	out := make([]any, len(ids))
+	for i, id := range ids {
+		out[i] = id
+	}
+	return out
+}
@@ -0,0 +1,381 @@
+package console
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PonyDevAI/Bull-Board/internal/console/execution"
+	"github.com/PonyDevAI/Bull-Board/internal/console/protection"
+)
+
+// maxRunnerBody 限制 runner 注册、心跳、日志与结果请求体大小
+const maxRunnerBody = 8 << 20
+
+// apiRunnerRoutes 处理 runner API，按路由区分鉴权方式：
+// 注册凭一次性 enrollment token：POST /api/runners/register；
+// runner 凭自身 credential：POST /api/runners/:id/claim?wait=秒、PUT /api/runners/:id/info、
+// POST /api/runners/:id/jobs/:job/{heartbeat,logs,artifacts,result,git-operations}；
+// 轮换 credential 可由 runner 自身或管理员发起：POST /api/runners/:id/rotate；
+// 其余需管理员 session 或 API key：GET /api/runners、GET /api/runners/:id、POST /api/runners/:id/revoke、
+// GET|POST /api/runners/enrollment-tokens、DELETE /api/runners/enrollment-tokens/:id
+func (s *Server) apiRunnerRoutes(w http.ResponseWriter, r *http.Request) {
+	if s.db == nil {
+		writeJSONError(w, "db not configured", http.StatusServiceUnavailable)
+		return
+	}
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/runners"), "/")
+	parts := strings.Split(rest, "/")
+	switch {
+	case rest == "register":
+		if r.Method != http.MethodPost {
+			http.Error(w, "", http.StatusMethodNotAllowed)
+			return
+		}
+		s.enrollRunner(w, r)
+	case parts[0] == "enrollment-tokens":
+		if !s.authRequired(w, r) {
+			return
+		}
+		s.enrollmentTokenRoutes(w, r, parts[1:])
+	case rest == "":
+		if !s.authRequired(w, r) {
+			return
+		}
+		if r.Method != http.MethodGet {
+			http.Error(w, "", http.StatusMethodNotAllowed)
+			return
+		}
+		runners, err := s.execution.ListRunners()
+		if err != nil {
+			writeJSONError(w, "db", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, map[string]any{"items": runners})
+	case len(parts) == 1:
+		if !s.authRequired(w, r) {
+			return
+		}
+		if r.Method != http.MethodGet {
+			http.Error(w, "", http.StatusMethodNotAllowed)
+			return
+		}
+		runner, err := s.execution.GetRunner(parts[0])
+		if err != nil {
+			writeRunnerError(w, err)
+			return
+		}
+		writeJSON(w, map[string]any{"item": runner})
+	case len(parts) == 2 && parts[1] == "revoke":
+		if !s.authRequired(w, r) {
+			return
+		}
+		if r.Method != http.MethodPost {
+			http.Error(w, "", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := s.execution.RevokeRunner(parts[0]); err != nil {
+			writeRunnerError(w, err)
+			return
+		}
+		writeJSON(w, map[string]any{"ok": true})
+	case len(parts) == 2 && parts[1] == "rotate":
+		if strings.HasPrefix(getAPIKey(r), execution.RunnerCredentialPrefix) {
+			if !s.runnerAuthorized(w, r, parts[0]) {
+				return
+			}
+		} else if !s.authRequired(w, r) {
+			return
+		}
+		if r.Method != http.MethodPost {
+			http.Error(w, "", http.StatusMethodNotAllowed)
+			return
+		}
+		s.rotateRunnerCredential(w, parts[0])
+	case len(parts) == 2 && parts[1] == "info":
+		if !s.runnerAuthorized(w, r, parts[0]) {
+			return
+		}
+		if r.Method != http.MethodPut {
+			http.Error(w, "", http.StatusMethodNotAllowed)
+			return
+		}
+		s.updateRunnerInfo(w, r, parts[0])
+	case len(parts) == 2 && parts[1] == "claim":
+		if !s.runnerAuthorized(w, r, parts[0]) {
+			return
+		}
+		if r.Method != http.MethodPost {
+			http.Error(w, "", http.StatusMethodNotAllowed)
+			return
+		}
+		s.claimRunnerJob(w, r, parts[0])
+	case len(parts) == 4 && parts[1] == "jobs" && parts[2] != "":
+		if !s.runnerAuthorized(w, r, parts[0]) {
+			return
+		}
+		if r.Method != http.MethodPost {
+			http.Error(w, "", http.StatusMethodNotAllowed)
+			return
+		}
+		runnerID, jobID := parts[0], parts[2]
+		switch parts[3] {
+		case "heartbeat":
+			s.runnerHeartbeat(w, r, runnerID, jobID)
+		case "logs":
+			s.runnerLogs(w, r, runnerID, jobID)
+		case "artifacts":
+			s.runnerArtifact(w, r, runnerID, jobID)
+		case "result":
+			s.runnerResult(w, r, runnerID, jobID)
+		case "git-operations":
+			s.runnerGitOperation(w, r, runnerID, jobID)
+		default:
+			http.NotFound(w, r)
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// runnerAuthorized 校验 Bearer runner credential 且属于路径中的 runner；
+// 管理员 API key 不能代替 runner 领取或上报 job
+func (s *Server) runnerAuthorized(w http.ResponseWriter, r *http.Request, runnerID string) bool {
+	id, err := s.execution.AuthenticateRunner(getAPIKey(r))
+	if err != nil {
+		if errors.Is(err, execution.ErrRunnerUnauthorized) {
+			writeJSONError(w, "unauthorized", http.StatusUnauthorized)
+		} else {
+			writeJSONError(w, "db", http.StatusInternalServerError)
+		}
+		return false
+	}
+	if id != runnerID {
+		writeJSONError(w, "credential does not belong to this runner", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// enrollmentTokenRoutes 管理 enrollment token；token 明文只在创建时返回一次
+func (s *Server) enrollmentTokenRoutes(w http.ResponseWriter, r *http.Request, parts []string) {
+	switch {
+	case len(parts) == 0 && r.Method == http.MethodGet:
+		tokens, err := s.execution.ListEnrollmentTokens()
+		if err != nil {
+			writeJSONError(w, "db", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, map[string]any{"items": tokens})
+	case len(parts) == 0 && r.Method == http.MethodPost:
+		var req execution.EnrollmentRequest
+		if !decodeRunnerBody(w, r, &req) {
+			return
+		}
+		token, err := s.execution.CreateEnrollmentToken(req)
+		if err != nil {
+			writeRunnerError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]any{"item": token})
+	case len(parts) == 1 && parts[0] != "" && r.Method == http.MethodDelete:
+		if err := s.execution.DeleteEnrollmentToken(parts[0]); err != nil {
+			writeRunnerError(w, err)
+			return
+		}
+		writeJSON(w, map[string]any{"ok": true})
+	case len(parts) <= 1:
+		http.Error(w, "", http.StatusMethodNotAllowed)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// writeRunnerError 把执行层错误映射为 HTTP 状态；409 表示租约已失效，runner 应放弃该 job
+func writeRunnerError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, execution.ErrRunnerNotFound), errors.Is(err, execution.ErrJobNotFound), errors.Is(err, execution.ErrEnrollmentTokenNotFound):
+		writeJSONError(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, execution.ErrRunnerUnauthorized):
+		writeJSONError(w, err.Error(), http.StatusUnauthorized)
+	case errors.Is(err, execution.ErrLeaseLost), errors.Is(err, execution.ErrJobNotActive):
+		writeJSONError(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, execution.ErrInvalidRunner), errors.Is(err, execution.ErrInvalidResult), errors.Is(err, execution.ErrInvalidUpload),
+		errors.Is(err, execution.ErrInvalidGitOperation):
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+	default:
+		writeJSONError(w, "db", http.StatusInternalServerError)
+	}
+}
+
+// decodeRunnerBody 解析 JSON 请求体；空请求体视为 {}
+func decodeRunnerBody(w http.ResponseWriter, r *http.Request, v any) bool {
+	err := json.NewDecoder(io.LimitReader(r.Body, maxRunnerBody)).Decode(v)
+	if err != nil && err != io.EOF {
+		writeJSONError(w, "invalid json", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// enrollRunner 用一次性 enrollment token 换取 runner 及其 credential；credential 只返回这一次
+func (s *Server) enrollRunner(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		EnrollmentToken string `json:"enrollment_token"`
+		execution.RunnerInfo
+	}
+	if !decodeRunnerBody(w, r, &body) {
+		return
+	}
+	runner, credential, err := s.execution.EnrollRunner(strings.TrimSpace(body.EnrollmentToken), body.RunnerInfo)
+	if err != nil {
+		writeRunnerError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(map[string]any{"item": runner, "credential": credential})
+}
+
+// rotateRunnerCredential 生成新 credential，旧 credential 立即失效
+func (s *Server) rotateRunnerCredential(w http.ResponseWriter, runnerID string) {
+	credential, err := s.execution.RotateRunnerCredential(runnerID)
+	if err != nil {
+		writeRunnerError(w, err)
+		return
+	}
+	runner, err := s.execution.GetRunner(runnerID)
+	if err != nil {
+		writeRunnerError(w, err)
+		return
+	}
+	writeJSON(w, map[string]any{"item": runner, "credential": credential})
+}
+
+// updateRunnerInfo 记录 runner 上报的版本与主机信息
+func (s *Server) updateRunnerInfo(w http.ResponseWriter, r *http.Request, runnerID string) {
+	var info execution.RunnerInfo
+	if !decodeRunnerBody(w, r, &info) {
+		return
+	}
+	if err := s.execution.UpdateRunnerInfo(runnerID, info); err != nil {
+		writeRunnerError(w, err)
+		return
+	}
+	runner, err := s.execution.GetRunner(runnerID)
+	if err != nil {
+		writeRunnerError(w, err)
+		return
+	}
+	writeJSON(w, map[string]any{"item": runner})
+}
+
+// claimRunnerJob 长轮询领取 job：最多等待 ?wait= 秒，无 job 时返回 204
+func (s *Server) claimRunnerJob(w http.ResponseWriter, r *http.Request, runnerID string) {
+	wait, _ := strconv.Atoi(r.URL.Query().Get("wait"))
+	if wait < 0 {
+		wait = 0
+	}
+	lease, err := s.execution.ClaimJob(r.Context(), runnerID, time.Duration(wait)*time.Second)
+	if err != nil {
+		if r.Context().Err() != nil {
+			return
+		}
+		writeRunnerError(w, err)
+		return
+	}
+	if lease == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSON(w, map[string]any{"item": lease})
+}
+
+// runnerHeartbeat 续租并可选上报进度
+func (s *Server) runnerHeartbeat(w http.ResponseWriter, r *http.Request, runnerID, jobID string) {
+	var body struct {
+		Progress map[string]any `json:"progress"`
+	}
+	if !decodeRunnerBody(w, r, &body) {
+		return
+	}
+	expires, err := s.execution.RenewLease(runnerID, jobID, body.Progress)
+	if err != nil {
+		writeRunnerError(w, err)
+		return
+	}
+	writeJSON(w, map[string]any{"item": map[string]any{"job_id": jobID, "lease_expires_at": expires}})
+}
+
+// runnerLogs 追加 job 输出，body: {"logs":[{"stream":"stdout","content":"..."}]}
+func (s *Server) runnerLogs(w http.ResponseWriter, r *http.Request, runnerID, jobID string) {
+	var body struct {
+		Logs []execution.LogChunk `json:"logs"`
+	}
+	if !decodeRunnerBody(w, r, &body) {
+		return
+	}
+	if err := s.execution.AppendRunnerLogs(runnerID, jobID, body.Logs); err != nil {
+		writeRunnerError(w, err)
+		return
+	}
+	writeJSON(w, map[string]any{"ok": true})
+}
+
+// runnerArtifact 以原始请求体流式上传产物：?kind=&name=
+func (s *Server) runnerArtifact(w http.ResponseWriter, r *http.Request, runnerID, jobID string) {
+	q := r.URL.Query()
+	body := http.MaxBytesReader(w, r.Body, maxArtifactUpload)
+	artifact, err := s.execution.StoreRunnerArtifact(runnerID, jobID, q.Get("kind"), q.Get("name"), body)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeJSONError(w, "artifact too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		writeRunnerError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(map[string]any{"item": artifact})
+}
+
+// runnerResult 上报最终结果并结束 job
+func (s *Server) runnerResult(w http.ResponseWriter, r *http.Request, runnerID, jobID string) {
+	var result execution.RunnerResult
+	if !decodeRunnerBody(w, r, &result) {
+		return
+	}
+	if err := s.execution.ReportRunnerResult(runnerID, jobID, result); err != nil {
+		writeRunnerError(w, err)
+		return
+	}
+	writeJSON(w, map[string]any{"ok": true})
+}
+
+// runnerGitOperation 在 job 的上下文中按分支保护检查 runner 的 git 操作，body: {"operation","branch","observed"}；
+// 不允许时仍返回 200，item 为记录的尝试（blocked 或 pending_approval），error 为原因，runner 据此放弃或回滚该操作
+func (s *Server) runnerGitOperation(w http.ResponseWriter, r *http.Request, runnerID, jobID string) {
+	var op execution.RunnerGitOperation
+	if !decodeRunnerBody(w, r, &op) {
+		return
+	}
+	attempt, err := s.execution.CheckRunnerGitOperation(runnerID, jobID, op)
+	var violation *protection.Violation
+	if errors.As(err, &violation) {
+		writeJSON(w, map[string]any{"item": violation.Attempt, "error": violation.Error()})
+		return
+	}
+	if err != nil {
+		writeRunnerError(w, err)
+		return
+	}
+	writeJSON(w, map[string]any{"item": attempt})
+}
@@ -0,0 +1,125 @@
+// Package secrets encrypts values the console keeps in its database, such as
+// deploy keys, with AES-256-GCM under a key file in PREFIX/config.
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sealedPrefix versions the sealed format: "v1:" + base64(nonce || ciphertext).
+const sealedPrefix = "v1:"
+
+var ErrSealed = errors.New("cannot decrypt secret")
+
+// Box seals and opens secrets with one key.
+type Box struct {
+	aead cipher.AEAD
+}
+
+// NewBox returns a box for a 32-byte key.
+func NewBox(key []byte) (*Box, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("secret key must be 32 bytes, got %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Box{aead: aead}, nil
+}
+
+// LoadBox reads the hex key at path, creating it with a random key (mode
+// 0600) on first use. Losing the file makes sealed secrets unreadable.
+func LoadBox(path string) (*Box, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return createKey(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("read secret key %s: %w", path, err)
+	}
+	return NewBox(key)
+}
+
+// createKey writes a new key to a temporary file and links it into place, so
+// a concurrent caller never reads a key file before it is complete.
+func createKey(path string) (*Box, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	f, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return nil, err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+	_, err = f.WriteString(hex.EncodeToString(key) + "\n")
+	if err == nil {
+		err = f.Chmod(0600)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Link(tmp, path); errors.Is(err, os.ErrExist) {
+		// Created by a concurrent caller.
+		return LoadBox(path)
+	} else if err != nil {
+		return nil, err
+	}
+	return NewBox(key)
+}
+
+// Seal encrypts plain.
+func (b *Box) Seal(plain []byte) (string, error) {
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return sealedPrefix + base64.StdEncoding.EncodeToString(b.aead.Seal(nonce, nonce, plain, nil)), nil
+}
+
+// Open decrypts a value produced by Seal.
+func (b *Box) Open(sealed string) ([]byte, error) {
+	rest, ok := strings.CutPrefix(sealed, sealedPrefix)
+	if !ok {
+		return nil, ErrSealed
+	}
+	raw, err := base64.StdEncoding.DecodeString(rest)
+	if err != nil || len(raw) < b.aead.NonceSize() {
+		return nil, ErrSealed
+	}
+	n := b.aead.NonceSize()
+	plain, err := b.aead.Open(nil, raw[:n], raw[n:], nil)
+	if err != nil {
+		return nil, ErrSealed
+	}
+	return plain, nil
+}
@@ -0,0 +1,79 @@
+package secrets
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestLoadBoxCreatesKeyAndRoundTrips(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config", "secret.key")
+	box, err := LoadBox(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("key file %v, %v", info, err)
+	}
+	sealed, err := box.Seal([]byte("deploy key"))
+	if err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+	again, err := LoadBox(path)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	plain, err := again.Open(sealed)
+	if err != nil || string(plain) != "deploy key" {
+		t.Fatalf("open %q, %v", plain, err)
+	}
+
+	other, err := LoadBox(filepath.Join(t.TempDir(), "secret.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, bad := range []string{sealed[:len(sealed)-4], "plain", "v1:!!"} {
+		if _, err := box.Open(bad); !errors.Is(err, ErrSealed) {
+			t.Errorf("Open(%q) error %v, want ErrSealed", bad, err)
+		}
+	}
+	if _, err := other.Open(sealed); !errors.Is(err, ErrSealed) {
+		t.Fatalf("opened with another key: %v", err)
+	}
+}
+
+func TestLoadBoxConcurrentCallersShareKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secret.key")
+	const callers = 16
+	boxes := make([]*Box, callers)
+	errs := make([]error, callers)
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			boxes[i], errs[i] = LoadBox(path)
+		}(i)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("caller %d: %v", i, err)
+		}
+	}
+	sealed, err := boxes[0].Seal([]byte("deploy key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, b := range boxes[1:] {
+		if plain, err := b.Open(sealed); err != nil || string(plain) != "deploy key" {
+			t.Fatalf("caller %d holds another key: %q, %v", i+1, plain, err)
+		}
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Fatalf("temporary key files left behind: %v", entries)
+	}
+}
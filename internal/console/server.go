@@ -10,30 +10,98 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/PonyDevAI/Bull-Board/internal/common"
+	"github.com/PonyDevAI/Bull-Board/internal/console/events"
+	"github.com/PonyDevAI/Bull-Board/internal/console/execution"
+	"github.com/PonyDevAI/Bull-Board/internal/console/execution_backends/agent"
+	"github.com/PonyDevAI/Bull-Board/internal/console/execution_backends/llm"
+	"github.com/PonyDevAI/Bull-Board/internal/console/execution_backends/local"
+	"github.com/PonyDevAI/Bull-Board/internal/console/execution_backends/pullrequest"
+	"github.com/PonyDevAI/Bull-Board/internal/console/protection"
+	"github.com/PonyDevAI/Bull-Board/internal/console/repos"
+	"github.com/PonyDevAI/Bull-Board/internal/console/retention"
+	"github.com/PonyDevAI/Bull-Board/internal/console/secrets"
+	"github.com/PonyDevAI/Bull-Board/internal/console/worktrees"
 )
 
 // Server 提供 /api/health、/api/events(SSE)、静态托管与 SPA fallback
 type Server struct {
 	cfg            *common.ServerConfig
 	startAt        time.Time
-	sseConns       sync.Map
+	bus            *events.Bus
 	db             *sql.DB
 	dbPath         string
+	execution      *execution.Service
+	repos          *repos.Manager
+	worktrees      *worktrees.Manager
+	protection     *protection.Store
 	logStreamConns int32
 }
 
 func NewServer(cfg *common.ServerConfig) *Server {
-	return &Server{cfg: cfg, startAt: time.Now()}
+	return &Server{cfg: cfg, startAt: time.Now(), bus: events.NewBus()}
 }
 
-// SetDB 设置可选 DB，health 将检查可用性并报告 db_path
+// SetDB 设置可选 DB，health 将检查可用性并报告 db_path；同时创建后台执行 job 的 execution service
 func (s *Server) SetDB(db *sql.DB, dbPath string) {
 	s.db = db
 	s.dbPath = dbPath
+	s.execution = execution.NewService(db)
+	s.execution.SetEventBus(s.bus)
+	s.execution.SetDataDir(s.dataDir())
+	s.worktrees = worktrees.NewManager(db, s.dataDir(), s.cfg.Worktrees)
+	localConn := local.NewConnector(s.dataDir())
+	localConn.SetWorktrees(s.worktrees)
+	s.protection = protection.NewStore(db)
+	localConn.SetProtection(s.protection)
+	if exe, err := os.Executable(); err == nil {
+		// 步骤命令的 git hook 运行 bb git-guard，经每个步骤独立的 socket 与 token 回调本进程检查分支保护，沙箱内拿不到数据库
+		localConn.SetGitGuard([]string{exe, "git-guard"})
+	} else {
+		slog.Error("protection: locate bb for git hooks", "err", err)
+	}
+	s.execution.Connectors().Register(local.ConnectorCode, localConn)
+	s.execution.Connectors().Register(llm.ConnectorCode, llm.NewConnector(db))
+	s.execution.Connectors().Register(agent.ConnectorCode, agent.NewConnector(db, localConn))
+	box, err := secrets.LoadBox(s.secretKeyPath())
+	if err != nil {
+		slog.Error("secrets: load key", "err", err)
+	}
+	s.repos = repos.NewManager(db, s.dataDir(), box)
+	s.execution.Connectors().Register(pullrequest.ConnectorCode, pullrequest.NewConnector(db, s.worktrees, s.repos))
+}
+
+// dataDir 返回 PREFIX/data，存放 worktree、job 产物等运行时数据
+func (s *Server) dataDir() string {
+	prefix := s.cfg.Prefix
+	if prefix == "" {
+		prefix = "/opt/bull-board"
+	}
+	return filepath.Join(prefix, "data")
+}
+
+// secretKeyPath 返回 PREFIX/config/secret.key，加密 deploy key 等密文的主密钥
+func (s *Server) secretKeyPath() string {
+	return filepath.Join(filepath.Dir(s.dataDir()), "config", "secret.key")
+}
+
+// startBackground 启动依赖 DB 的后台任务，随 ctx 结束
+func (s *Server) startBackground(ctx context.Context) {
+	if s.db == nil {
+		return
+	}
+	if err := s.execution.Start(ctx); err != nil {
+		slog.Error("execution: start", "err", err)
+	}
+	go s.execution.RunHealthChecks(ctx, execution.HealthCheckInterval)
+	go s.execution.RunJobTimeouts(ctx, execution.JobTimeoutSweepInterval)
+	go s.execution.RunLogPolls(ctx, execution.LogPollInterval)
+	go s.execution.RunLeaseSweeps(ctx, execution.LeaseSweepInterval)
+	go s.repos.RunFetches(ctx, repos.FetchSweepInterval)
+	go s.worktrees.RunPrunes(ctx, worktrees.PruneInterval)
+	go retention.New(s.db, s.dataDir(), s.cfg.Retention).Run(ctx, retention.Interval(s.cfg.Retention))
 }
 
 func (s *Server) health(w http.ResponseWriter, r *http.Request) {
@@ -71,14 +139,23 @@ func (s *Server) events(w http.ResponseWriter, r *http.Request) {
 	if flusher, ok := w.(http.Flusher); ok {
 		flusher.Flush()
 	}
-	s.sseConns.Store(&w, struct{}{})
-	defer s.sseConns.Delete(&w)
+	sub, unsubscribe := s.bus.Subscribe(64)
+	defer unsubscribe()
 	ticker := time.NewTicker(15 * time.Second)
 	defer ticker.Stop()
 	for {
 		select {
 		case <-r.Context().Done():
 			return
+		case ev := <-sub:
+			data, err := json.Marshal(ev.Data)
+			if err != nil {
+				continue
+			}
+			_, _ = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, data)
+			if flusher, ok := w.(http.Flusher); ok {
+				flusher.Flush()
+			}
 		case <-ticker.C:
 			_, _ = w.Write([]byte(": heartbeat\n\n"))
 			if flusher, ok := w.(http.Flusher); ok {
@@ -224,8 +301,50 @@ func (s *Server) apiRouter(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 执行后端回调与产物上传以 HMAC 签名鉴权
+	if strings.HasPrefix(path, "/api/jobs/") && strings.HasSuffix(path, "/callback") {
+		s.jobCallback(w, r)
+		return
+	}
+	if strings.HasPrefix(path, "/api/jobs/") && strings.HasSuffix(path, "/artifacts") && r.Method == http.MethodPost {
+		s.jobArtifactUpload(w, r)
+		return
+	}
+	if strings.HasPrefix(path, "/api/jobs") {
+		if !s.authRequired(w, r) {
+			return
+		}
+		s.apiJobRoutes(w, r)
+		return
+	}
+	if strings.HasPrefix(path, "/api/artifacts") {
+		if !s.authRequired(w, r) {
+			return
+		}
+		s.apiArtifactRoutes(w, r)
+		return
+	}
+	if strings.HasPrefix(path, "/api/git-operations") {
+		if !s.authRequired(w, r) {
+			return
+		}
+		s.apiGitOperationRoutes(w, r)
+		return
+	}
+	if strings.HasPrefix(path, "/api/test-runs") {
+		if !s.authRequired(w, r) {
+			return
+		}
+		s.apiTestRunRoutes(w, r)
+		return
+	}
+	// runner API 按路由自行鉴权：enrollment token、runner credential 或管理员身份
+	if strings.HasPrefix(path, "/api/runners") {
+		s.apiRunnerRoutes(w, r)
+		return
+	}
 	// /api/workers 需鉴权
-	if strings.HasPrefix(path, "/api/roles") || strings.HasPrefix(path, "/api/model-profiles") || strings.HasPrefix(path, "/api/integrations") || strings.HasPrefix(path, "/api/agent-apps") || strings.HasPrefix(path, "/api/execution-backends") || strings.HasPrefix(path, "/api/workers") {
+	if strings.HasPrefix(path, "/api/roles") || strings.HasPrefix(path, "/api/model-profiles") || strings.HasPrefix(path, "/api/integrations") || strings.HasPrefix(path, "/api/agent-apps") || strings.HasPrefix(path, "/api/plugins") || strings.HasPrefix(path, "/api/execution-backends") || strings.HasPrefix(path, "/api/workers") {
 		if !s.authRequired(w, r) {
 			return
 		}
@@ -259,6 +378,7 @@ func (s *Server) ListenAndServe(ctx context.Context) error {
 	mux.HandleFunc("/api/", s.apiRouter)
 	mux.HandleFunc("/", s.rootHandler)
 
+	s.startBackground(ctx)
 	addr := listenAddr(s.cfg.Port)
 	srv := &http.Server{Addr: addr, Handler: mux}
 	go func() {
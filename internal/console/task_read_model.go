@@ -26,7 +26,7 @@ func (s *Server) loadTaskCanonicalReadModel(taskID string) taskCanonicalReadMode
 	}
 	out.WorkflowRun = &wfRun
 	for _, sr := range wfRun.StepRuns {
-		if st, _ := sr["status"].(string); st == "running" || st == "ready" || st == "pending_unassigned" {
+		if st, _ := sr["status"].(string); st == "running" || st == "queued" || st == "ready" || st == "pending_unassigned" || st == "awaiting_approval" {
 			out.CurrentStep = sr
 			break
 		}
@@ -62,7 +62,7 @@ func (s *Server) loadTaskCanonicalReadModel(taskID string) taskCanonicalReadMode
 		}
 	}
 
-	artifactRows, err := s.db.Query(`SELECT a.id, a.job_id, COALESCE(a.step_run_id, ''), a.kind, a.uri, a.metadata_json, a.created_at
+	artifactRows, err := s.db.Query(`SELECT a.id, a.job_id, COALESCE(a.step_run_id, ''), a.kind, a.uri, a.metadata_json, a.sha256, a.size_bytes, a.mime_type, a.created_at
 		FROM artifacts a
 		JOIN jobs j ON j.id = a.job_id
 		JOIN step_runs sr ON sr.id = j.step_run_id
@@ -72,8 +72,9 @@ func (s *Server) loadTaskCanonicalReadModel(taskID string) taskCanonicalReadMode
 	if err == nil && artifactRows != nil {
 		defer artifactRows.Close()
 		for artifactRows.Next() {
-			var artifactID, jobID, stepRunID, kind, uri, metadataJSON, createdAt string
-			if err := artifactRows.Scan(&artifactID, &jobID, &stepRunID, &kind, &uri, &metadataJSON, &createdAt); err != nil {
+			var artifactID, jobID, stepRunID, kind, uri, metadataJSON, sha256, mimeType, createdAt string
+			var sizeBytes int64
+			if err := artifactRows.Scan(&artifactID, &jobID, &stepRunID, &kind, &uri, &metadataJSON, &sha256, &sizeBytes, &mimeType, &createdAt); err != nil {
 				continue
 			}
 			out.CanonicalArtifacts = append(out.CanonicalArtifacts, map[string]any{
@@ -83,6 +84,10 @@ func (s *Server) loadTaskCanonicalReadModel(taskID string) taskCanonicalReadMode
 				"kind":         kind,
 				"uri":          uri,
 				"metadataJson": metadataJSON,
+				"sha256":       sha256,
+				"sizeBytes":    sizeBytes,
+				"mimeType":     mimeType,
+				"contentUrl":   "/api/artifacts/" + artifactID + "/content",
 				"createdAt":    createdAt,
 			})
 		}
@@ -0,0 +1,43 @@
+package console
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/PonyDevAI/Bull-Board/internal/console/testreports"
+)
+
+// apiTestRunRoutes 处理 GET /api/test-runs/:id（单份测试报告的汇总与用例，?status=failed 只取该状态的用例）。
+// 步骤级的汇总与失败用例见 GET /api/step-runs/:id/tests
+func (s *Server) apiTestRunRoutes(w http.ResponseWriter, r *http.Request) {
+	if s.db == nil {
+		writeJSONError(w, "db not configured", http.StatusServiceUnavailable)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "", http.StatusMethodNotAllowed)
+		return
+	}
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/test-runs"), "/")
+	if id == "" || strings.Contains(id, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	tests := s.execution.Tests()
+	run, err := tests.Get(id)
+	if errors.Is(err, testreports.ErrRunNotFound) {
+		writeJSONError(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeJSONError(w, "db", http.StatusInternalServerError)
+		return
+	}
+	cases, err := tests.Cases(id, r.URL.Query().Get("status"))
+	if err != nil {
+		writeJSONError(w, "db", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]any{"item": map[string]any{"run": run, "cases": cases}})
+}
@@ -0,0 +1,99 @@
+package testreports
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidCondition = errors.New("invalid test condition")
+
+var conditionExpr = regexp.MustCompile(`^\s*([a-z_]+)\s*(==|!=|>=|<=|>|<)\s*(\d+)\s*$`)
+
+// Condition is a check over test totals, written "<metric> <op> <n>", e.g.
+// "failing == 0" or "total > 0". Metrics are total, passed, failed,
+// skipped, errors, failing (failed plus errors) and reports, the number of
+// test reports recorded.
+type Condition struct {
+	Metric string `json:"metric"`
+	Op     string `json:"op"`
+	Value  int    `json:"value"`
+}
+
+// ParseCondition parses one condition expression.
+func ParseCondition(expr string) (Condition, error) {
+	m := conditionExpr.FindStringSubmatch(expr)
+	if m == nil {
+		return Condition{}, fmt.Errorf("%w: %q", ErrInvalidCondition, expr)
+	}
+	c := Condition{Metric: m[1], Op: m[2]}
+	if _, ok := (Totals{}).Metric(c.Metric, 0); !ok {
+		return Condition{}, fmt.Errorf("%w: unknown metric %q", ErrInvalidCondition, c.Metric)
+	}
+	v, err := strconv.Atoi(m[3])
+	if err != nil {
+		return Condition{}, fmt.Errorf("%w: %q", ErrInvalidCondition, expr)
+	}
+	c.Value = v
+	return c, nil
+}
+
+// ParseConditions parses a list of condition expressions.
+func ParseConditions(exprs []string) ([]Condition, error) {
+	out := make([]Condition, 0, len(exprs))
+	for _, e := range exprs {
+		c, err := ParseCondition(e)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, nil
+}
+
+func (c Condition) String() string {
+	return c.Metric + " " + c.Op + " " + strconv.Itoa(c.Value)
+}
+
+// Holds evaluates the condition against totals gathered from reports test reports.
+func (c Condition) Holds(t Totals, reports int) bool {
+	v, _ := t.Metric(c.Metric, reports)
+	switch c.Op {
+	case "==":
+		return v == c.Value
+	case "!=":
+		return v != c.Value
+	case ">":
+		return v > c.Value
+	case ">=":
+		return v >= c.Value
+	case "<":
+		return v < c.Value
+	case "<=":
+		return v <= c.Value
+	}
+	return false
+}
+
+// Metric returns a named count for conditions.
+func (t Totals) Metric(name string, reports int) (int, bool) {
+	switch strings.ToLower(name) {
+	case "total":
+		return t.Total, true
+	case "passed":
+		return t.Passed, true
+	case "failed":
+		return t.Failed, true
+	case "skipped":
+		return t.Skipped, true
+	case "errors":
+		return t.Errors, true
+	case "failing":
+		return t.Failing(), true
+	case "reports":
+		return reports, true
+	}
+	return 0, false
+}
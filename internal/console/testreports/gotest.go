@@ -0,0 +1,160 @@
+package testreports
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// packageCase names the case recorded for a Go package that failed outside
+// any test (build errors, TestMain, a panic in init).
+const packageCase = "(package)"
+
+// goEvent is one line of `go test -json` (test2json) output.
+type goEvent struct {
+	Action      string  `json:"Action"`
+	Package     string  `json:"Package"`
+	Test        string  `json:"Test"`
+	Elapsed     float64 `json:"Elapsed"`
+	Output      string  `json:"Output"`
+	ImportPath  string  `json:"ImportPath"`
+	FailedBuild string  `json:"FailedBuild"`
+}
+
+type goCase struct {
+	*Case
+	output strings.Builder
+	done   bool
+}
+
+func (c *goCase) write(s string) {
+	if strings.HasPrefix(s, "=== ") || c.output.Len() > maxMessage {
+		return
+	}
+	c.output.WriteString(s)
+}
+
+// parseGoTest reads test2json events. Lines that are not JSON objects (build
+// output interleaved on a shared stream) are ignored; every Go package
+// becomes a suite and every test, subtests included, a case.
+func parseGoTest(r io.Reader) (*Report, error) {
+	rep := &Report{Format: FormatGoTest}
+	suites := map[string]*Suite{}
+	cases := map[string]*goCase{}
+	var order []*goCase
+	pkgOutput := map[string]*goCase{}
+	buildOutput := map[string]*strings.Builder{}
+	events := 0
+
+	suite := func(pkg string) *Suite {
+		s, ok := suites[pkg]
+		if !ok {
+			s = &Suite{Name: pkg}
+			suites[pkg] = s
+			rep.Suites = append(rep.Suites, s)
+		}
+		return s
+	}
+	testCase := func(pkg, test string) *goCase {
+		key := pkg + "\x00" + test
+		c, ok := cases[key]
+		if !ok {
+			c = &goCase{Case: &Case{Suite: pkg, Name: test}}
+			cases[key] = c
+			order = append(order, c)
+		}
+		return c
+	}
+
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64<<10), 16<<20)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if !strings.HasPrefix(text, "{") {
+			continue
+		}
+		var ev goEvent
+		if err := json.Unmarshal([]byte(text), &ev); err != nil {
+			return nil, fmt.Errorf("%w: line %d: %v", ErrMalformed, line, err)
+		}
+		events++
+		switch {
+		case ev.Action == "build-output":
+			b := buildOutput[ev.ImportPath]
+			if b == nil {
+				b = &strings.Builder{}
+				buildOutput[ev.ImportPath] = b
+			}
+			if b.Len() <= maxMessage {
+				b.WriteString(ev.Output)
+			}
+		case ev.Package == "":
+		case ev.Test != "":
+			suite(ev.Package)
+			c := testCase(ev.Package, ev.Test)
+			switch ev.Action {
+			case "output":
+				c.write(ev.Output)
+			case "pass", "fail", "skip":
+				c.Status = map[string]string{"pass": StatusPassed, "fail": StatusFailed, "skip": StatusSkipped}[ev.Action]
+				c.DurationMS = int64(ev.Elapsed * 1000)
+				c.done = true
+			}
+		default:
+			s := suite(ev.Package)
+			pc := pkgOutput[ev.Package]
+			if pc == nil {
+				pc = &goCase{Case: &Case{Suite: ev.Package, Name: packageCase, Status: StatusError}}
+				pkgOutput[ev.Package] = pc
+			}
+			switch ev.Action {
+			case "output":
+				pc.write(ev.Output)
+			case "pass", "skip":
+				s.DurationMS = int64(ev.Elapsed * 1000)
+			case "fail":
+				s.DurationMS = int64(ev.Elapsed * 1000)
+				pc.DurationMS = s.DurationMS
+				if b := buildOutput[ev.FailedBuild]; ev.FailedBuild != "" && b != nil {
+					pc.output.WriteString(b.String())
+				}
+				pc.done = true
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if events == 0 {
+		return nil, fmt.Errorf("%w: no go test events", ErrMalformed)
+	}
+
+	for _, c := range order {
+		if !c.done {
+			// Still running when the stream ended: the binary crashed or timed out.
+			c.Status = StatusError
+		}
+		if c.Status != StatusPassed {
+			c.Message = c.output.String()
+		}
+		s := suites[c.Suite]
+		s.Cases = append(s.Cases, c.Case)
+	}
+	for pkg, pc := range pkgOutput {
+		if !pc.done {
+			continue
+		}
+		s := suites[pkg]
+		failing := false
+		for _, c := range s.Cases {
+			failing = failing || c.Failing()
+		}
+		if !failing {
+			pc.Message = pc.output.String()
+			s.Cases = append(s.Cases, pc.Case)
+		}
+	}
+	return rep.finish(), nil
+}
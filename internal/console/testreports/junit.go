@@ -0,0 +1,137 @@
+package testreports
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+type junitSuite struct {
+	Name   string       `xml:"name,attr"`
+	Time   string       `xml:"time,attr"`
+	Cases  []junitCase  `xml:"testcase"`
+	Suites []junitSuite `xml:"testsuite"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitProblem `xml:"failure"`
+	Error     *junitProblem `xml:"error"`
+	Skipped   *junitProblem `xml:"skipped"`
+	SystemOut string        `xml:"system-out"`
+	SystemErr string        `xml:"system-err"`
+}
+
+type junitProblem struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// text is the message attribute followed by the element body; the type is
+// used only when neither is set.
+func (p *junitProblem) text() string {
+	msg, body := strings.TrimSpace(p.Message), strings.TrimSpace(p.Text)
+	switch {
+	case msg == "" && body == "":
+		return strings.TrimSpace(p.Type)
+	case body == "" || body == msg:
+		return msg
+	case msg == "":
+		return body
+	}
+	return msg + "\n" + body
+}
+
+// parseJUnit reads a <testsuites> or <testsuite> document. Nested suites
+// are flattened; a case takes its suite's name, or its classname when the
+// suite has none.
+func parseJUnit(r io.Reader) (*Report, error) {
+	dec := xml.NewDecoder(r)
+	rep := &Report{Format: FormatJUnit}
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%w: no <testsuites> or <testsuite> element", ErrMalformed)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrMalformed, err)
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		var root junitSuite
+		switch start.Name.Local {
+		case "testsuites", "testsuite":
+			if err := dec.DecodeElement(&root, &start); err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrMalformed, err)
+			}
+		default:
+			return nil, fmt.Errorf("%w: unexpected root element <%s>", ErrMalformed, start.Name.Local)
+		}
+		if start.Name.Local == "testsuites" {
+			for _, s := range root.Suites {
+				addJUnitSuite(rep, s)
+			}
+			// Some writers put cases straight under <testsuites>.
+			root.Suites = nil
+			if len(root.Cases) > 0 {
+				addJUnitSuite(rep, root)
+			}
+		} else {
+			addJUnitSuite(rep, root)
+		}
+		return rep.finish(), nil
+	}
+}
+
+func addJUnitSuite(rep *Report, js junitSuite) {
+	s := &Suite{Name: js.Name, DurationMS: seconds(js.Time)}
+	var caseTime int64
+	for _, jc := range js.Cases {
+		c := &Case{Suite: js.Name, Name: jc.Name, Status: StatusPassed, DurationMS: seconds(jc.Time)}
+		if c.Suite == "" {
+			c.Suite = jc.Classname
+		}
+		switch {
+		case jc.Error != nil:
+			c.Status, c.Message = StatusError, jc.Error.text()
+		case jc.Failure != nil:
+			c.Status, c.Message = StatusFailed, jc.Failure.text()
+		case jc.Skipped != nil:
+			c.Status, c.Message = StatusSkipped, jc.Skipped.text()
+		}
+		if c.Failing() {
+			for _, out := range []string{jc.SystemOut, jc.SystemErr} {
+				if out = strings.TrimSpace(out); out != "" {
+					c.Message += "\n" + out
+				}
+			}
+		}
+		caseTime += c.DurationMS
+		s.Cases = append(s.Cases, c)
+	}
+	// A parent's time includes its nested suites, which are counted on their own.
+	if s.DurationMS == 0 || len(js.Suites) > 0 {
+		s.DurationMS = caseTime
+	}
+	rep.Suites = append(rep.Suites, s)
+	for _, child := range js.Suites {
+		addJUnitSuite(rep, child)
+	}
+}
+
+// seconds converts a JUnit time attribute ("1.25", "1,234.5") to milliseconds.
+func seconds(v string) int64 {
+	f, err := strconv.ParseFloat(strings.ReplaceAll(strings.TrimSpace(v), ",", ""), 64)
+	if err != nil || f < 0 {
+		return 0
+	}
+	return int64(f * 1000)
+}
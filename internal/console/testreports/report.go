@@ -0,0 +1,196 @@
+// Package testreports turns test runner output (go test -json, JUnit XML and
+// TAP) into one model of suites and cases with pass/fail totals.
+package testreports
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// Report formats.
+const (
+	FormatGoTest = "go_test_json"
+	FormatJUnit  = "junit"
+	FormatTAP    = "tap"
+)
+
+// Case statuses. StatusError is a case that could not run to a verdict
+// (a JUnit <error>, a test cut off by a panic or timeout, a TAP bail out).
+const (
+	StatusPassed  = "passed"
+	StatusFailed  = "failed"
+	StatusSkipped = "skipped"
+	StatusError   = "error"
+)
+
+// maxMessage bounds the failure text kept per case.
+const maxMessage = 8 << 10
+
+var (
+	ErrUnknownFormat = errors.New("unrecognized test report format")
+	ErrMalformed     = errors.New("malformed test report")
+)
+
+// Report is a parsed test report.
+type Report struct {
+	Format string   `json:"format"`
+	Suites []*Suite `json:"suites"`
+	Totals Totals   `json:"totals"`
+}
+
+// Suite groups cases: a Go package, a JUnit <testsuite>, a TAP stream.
+type Suite struct {
+	Name       string  `json:"name"`
+	DurationMS int64   `json:"duration_ms"`
+	Cases      []*Case `json:"cases"`
+}
+
+// Case is one test. Message holds the failure or skip reason and, for Go
+// tests, the test's output.
+type Case struct {
+	// RunID is the stored report the case belongs to; empty before storing.
+	RunID      string `json:"test_run_id,omitempty"`
+	Suite      string `json:"suite"`
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	DurationMS int64  `json:"duration_ms"`
+	Message    string `json:"message,omitempty"`
+}
+
+// Failing reports whether the case failed or errored.
+func (c *Case) Failing() bool { return c.Status == StatusFailed || c.Status == StatusError }
+
+// Totals counts cases by status.
+type Totals struct {
+	Total      int   `json:"total"`
+	Passed     int   `json:"passed"`
+	Failed     int   `json:"failed"`
+	Skipped    int   `json:"skipped"`
+	Errors     int   `json:"errors"`
+	DurationMS int64 `json:"duration_ms"`
+}
+
+// Failing is the number of failed plus errored cases.
+func (t Totals) Failing() int { return t.Failed + t.Errors }
+
+// Add sums o into t.
+func (t *Totals) Add(o Totals) {
+	t.Total += o.Total
+	t.Passed += o.Passed
+	t.Failed += o.Failed
+	t.Skipped += o.Skipped
+	t.Errors += o.Errors
+	t.DurationMS += o.DurationMS
+}
+
+// Failures returns the failed and errored cases in report order.
+func (r *Report) Failures() []*Case {
+	var out []*Case
+	for _, s := range r.Suites {
+		for _, c := range s.Cases {
+			if c.Failing() {
+				out = append(out, c)
+			}
+		}
+	}
+	return out
+}
+
+// finish drops empty suites and computes the totals.
+func (r *Report) finish() *Report {
+	suites := r.Suites[:0]
+	var t Totals
+	for _, s := range r.Suites {
+		if len(s.Cases) == 0 {
+			continue
+		}
+		suites = append(suites, s)
+		t.DurationMS += s.DurationMS
+		for _, c := range s.Cases {
+			c.Message = truncate(strings.TrimSpace(c.Message))
+			t.Total++
+			switch c.Status {
+			case StatusPassed:
+				t.Passed++
+			case StatusFailed:
+				t.Failed++
+			case StatusSkipped:
+				t.Skipped++
+			default:
+				t.Errors++
+			}
+		}
+	}
+	r.Suites, r.Totals = suites, t
+	return r
+}
+
+// Parse reads a report in the given format; an empty format is detected
+// from the content.
+func Parse(format string, r io.Reader) (*Report, error) {
+	br := bufio.NewReaderSize(r, 64<<10)
+	if format == "" {
+		head, _ := br.Peek(4096)
+		if format = Detect(head); format == "" {
+			return nil, ErrUnknownFormat
+		}
+	}
+	switch format {
+	case FormatGoTest:
+		return parseGoTest(br)
+	case FormatJUnit:
+		return parseJUnit(br)
+	case FormatTAP:
+		return parseTAP(br)
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownFormat, format)
+}
+
+// ParseString parses a report held in memory.
+func ParseString(format, s string) (*Report, error) {
+	return Parse(format, strings.NewReader(s))
+}
+
+// ValidFormat reports whether format names a supported report format.
+func ValidFormat(format string) bool {
+	return format == FormatGoTest || format == FormatJUnit || format == FormatTAP
+}
+
+// Detect guesses the format from the start of a report, or returns "".
+func Detect(head []byte) string {
+	head = bytes.TrimPrefix(head, []byte("\xef\xbb\xbf"))
+	trimmed := bytes.TrimSpace(head)
+	if bytes.HasPrefix(trimmed, []byte("<")) {
+		if bytes.Contains(trimmed, []byte("<testsuite")) {
+			return FormatJUnit
+		}
+		return ""
+	}
+	for _, line := range bytes.Split(trimmed, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		switch {
+		case bytes.HasPrefix(line, []byte("{")) && bytes.Contains(line, []byte(`"Action"`)):
+			return FormatGoTest
+		case bytes.HasPrefix(line, []byte("TAP version")), tapPlan.Match(line), tapDetect.Match(line):
+			return FormatTAP
+		}
+	}
+	return ""
+}
+
+// truncate cuts s to maxMessage bytes on a rune boundary.
+func truncate(s string) string {
+	if len(s) <= maxMessage {
+		return s
+	}
+	cut := maxMessage
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + "\n… (truncated)"
+}
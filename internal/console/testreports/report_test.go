@@ -0,0 +1,202 @@
+package testreports
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const goTestOutput = `# example.test/pkg/b
+{"Action":"start","Package":"example.test/pkg/a"}
+{"Action":"run","Package":"example.test/pkg/a","Test":"TestOK"}
+{"Action":"output","Package":"example.test/pkg/a","Test":"TestOK","Output":"=== RUN   TestOK\n"}
+{"Action":"output","Package":"example.test/pkg/a","Test":"TestOK","Output":"--- PASS: TestOK (0.01s)\n"}
+{"Action":"pass","Package":"example.test/pkg/a","Test":"TestOK","Elapsed":0.01}
+{"Action":"run","Package":"example.test/pkg/a","Test":"TestBad"}
+{"Action":"output","Package":"example.test/pkg/a","Test":"TestBad","Output":"    a_test.go:12: want 2, got 3\n"}
+{"Action":"fail","Package":"example.test/pkg/a","Test":"TestBad","Elapsed":0.25}
+{"Action":"run","Package":"example.test/pkg/a","Test":"TestSkip"}
+{"Action":"output","Package":"example.test/pkg/a","Test":"TestSkip","Output":"    a_test.go:20: needs docker\n"}
+{"Action":"skip","Package":"example.test/pkg/a","Test":"TestSkip","Elapsed":0}
+{"Action":"run","Package":"example.test/pkg/a","Test":"TestHang"}
+{"Action":"output","Package":"example.test/pkg/a","Output":"panic: test timed out after 1s\n"}
+{"Action":"fail","Package":"example.test/pkg/a","Elapsed":1.5}
+{"Action":"build-output","ImportPath":"example.test/pkg/b [example.test/pkg/b.test]","Output":"b_test.go:3:2: undefined: x\n"}
+{"Action":"build-fail","ImportPath":"example.test/pkg/b [example.test/pkg/b.test]"}
+{"Action":"start","Package":"example.test/pkg/b"}
+{"Action":"output","Package":"example.test/pkg/b","Output":"FAIL\texample.test/pkg/b [build failed]\n"}
+{"Action":"fail","Package":"example.test/pkg/b","Elapsed":0,"FailedBuild":"example.test/pkg/b [example.test/pkg/b.test]"}
+{"Action":"start","Package":"example.test/pkg/c"}
+{"Action":"output","Package":"example.test/pkg/c","Output":"?   \texample.test/pkg/c\t[no test files]\n"}
+{"Action":"skip","Package":"example.test/pkg/c","Elapsed":0}
+`
+
+func TestParseGoTestJSON(t *testing.T) {
+	rep, err := ParseString("", goTestOutput)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if rep.Format != FormatGoTest {
+		t.Fatalf("format %q", rep.Format)
+	}
+	want := Totals{Total: 5, Passed: 1, Failed: 1, Skipped: 1, Errors: 2, DurationMS: 1500}
+	if rep.Totals != want {
+		t.Fatalf("totals %+v, want %+v", rep.Totals, want)
+	}
+	if len(rep.Suites) != 2 || rep.Suites[0].Name != "example.test/pkg/a" || rep.Suites[1].Name != "example.test/pkg/b" {
+		t.Fatalf("suites %+v", rep.Suites)
+	}
+	failures := rep.Failures()
+	if len(failures) != 3 {
+		t.Fatalf("failures %+v", failures)
+	}
+	if c := failures[0]; c.Name != "TestBad" || c.DurationMS != 250 || c.Message != "a_test.go:12: want 2, got 3" {
+		t.Fatalf("failed case %+v", c)
+	}
+	// The test still running when the binary died is reported as an error.
+	if c := failures[1]; c.Name != "TestHang" || c.Status != StatusError {
+		t.Fatalf("unfinished case %+v", c)
+	}
+	if c := failures[2]; c.Name != packageCase || !strings.Contains(c.Message, "undefined: x") {
+		t.Fatalf("build failure %+v", c)
+	}
+	if c := rep.Suites[0].Cases[0]; c.Message != "" {
+		t.Fatalf("passing case keeps output %q", c.Message)
+	}
+}
+
+func TestParseJUnit(t *testing.T) {
+	const doc = `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites>
+  <testsuite name="api" time="2.5">
+    <testcase classname="api.Users" name="lists users" time="0.5"/>
+    <testcase classname="api.Users" name="creates user" time="1,000.0">
+      <failure message="expected 201" type="AssertionError">at users.spec.js:14</failure>
+      <system-out>POST /users 500</system-out>
+    </testcase>
+    <testcase classname="api.Users" name="deletes user"><skipped message="flaky"/></testcase>
+    <testsuite name="api.nested">
+      <testcase name="boom" time="0.25"><error message="connection refused"/></testcase>
+    </testsuite>
+  </testsuite>
+</testsuites>`
+	rep, err := ParseString("", doc)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	want := Totals{Total: 4, Passed: 1, Failed: 1, Skipped: 1, Errors: 1, DurationMS: 1000750}
+	if rep.Format != FormatJUnit || rep.Totals != want {
+		t.Fatalf("format %q totals %+v, want %+v", rep.Format, rep.Totals, want)
+	}
+	failures := rep.Failures()
+	if len(failures) != 2 {
+		t.Fatalf("failures %+v", failures)
+	}
+	if c := failures[0]; c.Suite != "api" || c.Message != "expected 201\nat users.spec.js:14\nPOST /users 500" {
+		t.Fatalf("failure %+v", c)
+	}
+	if c := failures[1]; c.Suite != "api.nested" || c.Status != StatusError || c.Message != "connection refused" {
+		t.Fatalf("error %+v", c)
+	}
+
+	// A bare <testsuite> root is accepted too.
+	rep, err = ParseString(FormatJUnit, `<testsuite name="s"><testcase name="a"/></testsuite>`)
+	if err != nil || rep.Totals.Passed != 1 {
+		t.Fatalf("bare testsuite: %+v, %v", rep, err)
+	}
+	if _, err := ParseString(FormatJUnit, `<html></html>`); !errors.Is(err, ErrMalformed) {
+		t.Fatalf("expected ErrMalformed, got %v", err)
+	}
+}
+
+func TestParseTAP(t *testing.T) {
+	const stream = `TAP version 13
+1..6
+ok 1 - parses input
+not ok 2 - rejects bad input
+  ---
+  message: expected error
+  duration_ms: 12.5
+  ...
+# got nil
+ok 3 # SKIP no network
+not ok 4 - flaky thing # TODO fix later
+# Subtest: nested
+    ok 1 - inner
+    1..1
+ok 5 - nested
+`
+	rep, err := ParseString("", stream)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	// Six were planned but five ran: the missing one counts as an error.
+	want := Totals{Total: 6, Passed: 2, Failed: 1, Skipped: 2, Errors: 1, DurationMS: 12}
+	if rep.Format != FormatTAP || rep.Totals != want {
+		t.Fatalf("format %q totals %+v, want %+v", rep.Format, rep.Totals, want)
+	}
+	cases := rep.Suites[0].Cases
+	if c := cases[1]; c.Name != "rejects bad input" || c.Message != "message: expected error\nduration_ms: 12.5\ngot nil" {
+		t.Fatalf("failing case %+v", c)
+	}
+	if c := cases[2]; c.Name != "test 3" || c.Status != StatusSkipped || c.Message != "no network" {
+		t.Fatalf("skipped case %+v", c)
+	}
+	if c := cases[3]; c.Status != StatusSkipped {
+		t.Fatalf("TODO case should not fail: %+v", c)
+	}
+	if c := cases[5]; c.Name != planCase || c.Status != StatusError {
+		t.Fatalf("plan case %+v", c)
+	}
+
+	rep, err = ParseString(FormatTAP, "1..3\nok 1\nBail out! database down\nok 2\n")
+	if err != nil {
+		t.Fatalf("parse bail out: %v", err)
+	}
+	if rep.Totals.Total != 2 || rep.Totals.Errors != 1 || rep.Suites[0].Cases[1].Message != "database down" {
+		t.Fatalf("bail out %+v", rep.Suites[0].Cases)
+	}
+}
+
+func TestDetect(t *testing.T) {
+	for in, want := range map[string]string{
+		`{"Time":"2024-01-01T00:00:00Z","Action":"start","Package":"p"}`: FormatGoTest,
+		"\ufeff<?xml version=\"1.0\"?>\n<testsuites>":                    FormatJUnit,
+		"TAP version 14\n":                      FormatTAP,
+		"ok 1 - works\n":                        FormatTAP,
+		"PASS\nok  \texample.test/pkg\t0.01s\n": "",
+		"<html>":                                "",
+	} {
+		if got := Detect([]byte(in)); got != want {
+			t.Errorf("Detect(%q) = %q, want %q", in, got, want)
+		}
+	}
+	if _, err := ParseString("", "hello"); !errors.Is(err, ErrUnknownFormat) {
+		t.Fatalf("expected ErrUnknownFormat, got %v", err)
+	}
+}
+
+func TestConditions(t *testing.T) {
+	totals := Totals{Total: 10, Passed: 8, Failed: 1, Errors: 1}
+	for expr, want := range map[string]bool{
+		"failing == 0": false,
+		"failed <= 1":  true,
+		"total > 0":    true,
+		"passed >= 9":  false,
+		"errors != 0":  true,
+		"reports == 2": true,
+	} {
+		c, err := ParseCondition(expr)
+		if err != nil {
+			t.Fatalf("parse %q: %v", expr, err)
+		}
+		if got := c.Holds(totals, 2); got != want {
+			t.Errorf("%s = %t, want %t", c, got, want)
+		}
+	}
+	for _, bad := range []string{"", "failing", "failing = 0", "coverage > 80", "failed == -1"} {
+		if _, err := ParseCondition(bad); !errors.Is(err, ErrInvalidCondition) {
+			t.Errorf("ParseCondition(%q) error %v, want ErrInvalidCondition", bad, err)
+		}
+	}
+}
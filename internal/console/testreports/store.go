@@ -0,0 +1,165 @@
+package testreports
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/PonyDevAI/Bull-Board/internal/common"
+)
+
+var ErrRunNotFound = errors.New("test run not found")
+
+// Run is a stored test report: one test_runs row, linked to the job and step
+// run that produced it and the artifact it was parsed from.
+type Run struct {
+	ID         string `json:"id"`
+	JobID      string `json:"job_id"`
+	StepRunID  string `json:"step_run_id"`
+	ArtifactID string `json:"artifact_id"`
+	Format     string `json:"format"`
+	Totals
+	CreatedAt string `json:"created_at"`
+}
+
+// StepSummary is the test outcome of a step run, taken from the latest job
+// of the step that recorded test reports; a retried step is judged by its
+// last attempt only.
+type StepSummary struct {
+	JobID    string `json:"job_id"`
+	Reports  int    `json:"reports"`
+	Totals   Totals `json:"totals"`
+	Runs     []Run  `json:"runs"`
+	Failures []Case `json:"failures"`
+}
+
+// Service stores parsed reports in test_runs and test_cases.
+type Service struct {
+	db *sql.DB
+}
+
+func NewService(db *sql.DB) *Service {
+	return &Service{db: db}
+}
+
+// Record stores a parsed report.
+func (s *Service) Record(jobID, stepRunID, artifactID string, rep *Report) (Run, error) {
+	run := Run{
+		ID:         common.UUID(),
+		JobID:      jobID,
+		StepRunID:  stepRunID,
+		ArtifactID: artifactID,
+		Format:     rep.Format,
+		Totals:     rep.Totals,
+		CreatedAt:  time.Now().UTC().Format(time.RFC3339),
+	}
+	var stepRun any
+	if stepRunID != "" {
+		stepRun = stepRunID
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return run, err
+	}
+	defer tx.Rollback()
+	t := rep.Totals
+	if _, err := tx.Exec(`INSERT INTO test_runs (id, job_id, step_run_id, artifact_id, format, total, passed, failed, skipped, errors, duration_ms, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		run.ID, jobID, stepRun, artifactID, rep.Format, t.Total, t.Passed, t.Failed, t.Skipped, t.Errors, t.DurationMS, run.CreatedAt); err != nil {
+		return run, err
+	}
+	stmt, err := tx.Prepare(`INSERT INTO test_cases (test_run_id, seq, suite, name, status, duration_ms, message) VALUES (?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return run, err
+	}
+	defer stmt.Close()
+	seq := 0
+	for _, suite := range rep.Suites {
+		for _, c := range suite.Cases {
+			seq++
+			if _, err := stmt.Exec(run.ID, seq, c.Suite, c.Name, c.Status, c.DurationMS, c.Message); err != nil {
+				return run, err
+			}
+		}
+	}
+	return run, tx.Commit()
+}
+
+// StepSummary returns the totals, reports and up to maxFailures failing cases
+// of a step run. JobID is empty when no report has been recorded.
+func (s *Service) StepSummary(stepRunID string, maxFailures int) (StepSummary, error) {
+	out := StepSummary{Runs: []Run{}, Failures: []Case{}}
+	err := s.db.QueryRow(`SELECT job_id FROM test_runs WHERE step_run_id = ? ORDER BY created_at DESC, rowid DESC LIMIT 1`, stepRunID).Scan(&out.JobID)
+	if err == sql.ErrNoRows {
+		return out, nil
+	}
+	if err != nil {
+		return out, err
+	}
+	rows, err := s.db.Query(`SELECT id, job_id, COALESCE(step_run_id,''), artifact_id, format, total, passed, failed, skipped, errors, duration_ms, created_at FROM test_runs WHERE step_run_id = ? AND job_id = ? ORDER BY created_at ASC, rowid ASC`, stepRunID, out.JobID)
+	if err != nil {
+		return out, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var r Run
+		if err := rows.Scan(&r.ID, &r.JobID, &r.StepRunID, &r.ArtifactID, &r.Format, &r.Total, &r.Passed, &r.Failed, &r.Skipped, &r.Errors, &r.DurationMS, &r.CreatedAt); err != nil {
+			return out, err
+		}
+		out.Runs = append(out.Runs, r)
+		out.Totals.Add(r.Totals)
+	}
+	if err := rows.Err(); err != nil {
+		return out, err
+	}
+	out.Reports = len(out.Runs)
+	if maxFailures > 0 {
+		out.Failures, err = s.cases(`tc.test_run_id IN (SELECT id FROM test_runs WHERE step_run_id = ? AND job_id = ?) AND tc.status IN ('failed','error') ORDER BY tr.created_at ASC, tr.rowid ASC, tc.seq ASC LIMIT ?`, stepRunID, out.JobID, maxFailures)
+	}
+	return out, err
+}
+
+// JobTotals sums the reports a job recorded and returns how many there are.
+func (s *Service) JobTotals(jobID string) (Totals, int, error) {
+	var t Totals
+	var reports int
+	err := s.db.QueryRow(`SELECT COUNT(*), COALESCE(SUM(total),0), COALESCE(SUM(passed),0), COALESCE(SUM(failed),0), COALESCE(SUM(skipped),0), COALESCE(SUM(errors),0), COALESCE(SUM(duration_ms),0) FROM test_runs WHERE job_id = ?`, jobID).
+		Scan(&reports, &t.Total, &t.Passed, &t.Failed, &t.Skipped, &t.Errors, &t.DurationMS)
+	return t, reports, err
+}
+
+// Get returns a stored report.
+func (s *Service) Get(runID string) (Run, error) {
+	var r Run
+	err := s.db.QueryRow(`SELECT id, job_id, COALESCE(step_run_id,''), artifact_id, format, total, passed, failed, skipped, errors, duration_ms, created_at FROM test_runs WHERE id = ?`, runID).
+		Scan(&r.ID, &r.JobID, &r.StepRunID, &r.ArtifactID, &r.Format, &r.Total, &r.Passed, &r.Failed, &r.Skipped, &r.Errors, &r.DurationMS, &r.CreatedAt)
+	if err == sql.ErrNoRows {
+		return r, ErrRunNotFound
+	}
+	return r, err
+}
+
+// Cases returns a stored report's cases in report order, optionally only
+// those with the given status.
+func (s *Service) Cases(runID, status string) ([]Case, error) {
+	if status != "" {
+		return s.cases(`tc.test_run_id = ? AND tc.status = ? ORDER BY tc.seq ASC`, runID, status)
+	}
+	return s.cases(`tc.test_run_id = ? ORDER BY tc.seq ASC`, runID)
+}
+
+func (s *Service) cases(where string, args ...any) ([]Case, error) {
+	rows, err := s.db.Query(`SELECT tc.test_run_id, tc.suite, tc.name, tc.status, tc.duration_ms, tc.message FROM test_cases tc JOIN test_runs tr ON tr.id = tc.test_run_id WHERE `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []Case{}
+	for rows.Next() {
+		var c Case
+		if err := rows.Scan(&c.RunID, &c.Suite, &c.Name, &c.Status, &c.DurationMS, &c.Message); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,151 @@
+package testreports
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	tapPlan      = regexp.MustCompile(`^1\.\.(\d+)(?:\s*#\s*(.*))?$`)
+	tapTest      = regexp.MustCompile(`^(not ok|ok)\b(?:\s+(\d+))?\s*(?:-\s*)?(.*)$`)
+	tapDirective = regexp.MustCompile(`(?i)^(skip|todo)\S*\s*(.*)$`)
+	tapDuration  = regexp.MustCompile(`^\s*duration_ms:\s*([0-9.]+)\s*$`)
+	// tapDetect is stricter than tapTest so plain `go test` output
+	// ("ok  \texample.com/pkg") is not taken for TAP.
+	tapDetect = regexp.MustCompile(`^(not ok|ok)(\s+\d+\b|\s+-\s|$)`)
+)
+
+// planCase names the case recorded when fewer tests ran than the plan announced.
+const planCase = "(plan)"
+
+// parseTAP reads a TAP stream (versions 12 to 14) into a single suite.
+// Indented subtests are summarized by their parent's result line, TODO
+// tests count as skipped whatever their result, YAML diagnostics become the
+// case message and "Bail out!" ends the run with an errored case.
+func parseTAP(r io.Reader) (*Report, error) {
+	suite := &Suite{}
+	rep := &Report{Format: FormatTAP, Suites: []*Suite{suite}}
+	planned, sawPlan, bailed := 0, false, false
+	var last *Case
+	var yaml []string
+	yamlIndent := -1
+
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64<<10), 16<<20)
+	for sc.Scan() {
+		raw := strings.TrimRight(sc.Text(), "\r")
+		line := strings.TrimSpace(raw)
+		indent := len(raw) - len(strings.TrimLeft(raw, " \t"))
+
+		if yamlIndent >= 0 {
+			if line == "..." && indent == yamlIndent {
+				attachYAML(last, yaml)
+				yaml, yamlIndent = nil, -1
+			} else {
+				yaml = append(yaml, strings.TrimPrefix(raw, strings.Repeat(" ", yamlIndent)))
+			}
+			continue
+		}
+		if line == "---" && indent > 0 && last != nil && len(yaml) == 0 {
+			yamlIndent = indent
+			continue
+		}
+		if indent > 0 || line == "" {
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "Bail out!"):
+			reason := strings.TrimSpace(strings.TrimPrefix(line, "Bail out!"))
+			suite.Cases = append(suite.Cases, &Case{Name: "Bail out!", Status: StatusError, Message: reason})
+			bailed = true
+		case tapPlan.MatchString(line):
+			m := tapPlan.FindStringSubmatch(line)
+			planned, _ = strconv.Atoi(m[1])
+			sawPlan = true
+		case tapTest.MatchString(line):
+			m := tapTest.FindStringSubmatch(line)
+			last = tapCase(m[1] == "ok", m[2], m[3], len(suite.Cases)+1)
+			suite.Cases = append(suite.Cases, last)
+			yaml = nil
+			continue
+		case strings.HasPrefix(line, "#"):
+			// Diagnostics after a failing test explain the failure.
+			if last != nil && last.Failing() && !strings.HasPrefix(line, "# Subtest") {
+				last.Message = strings.TrimSpace(last.Message + "\n" + strings.TrimSpace(strings.TrimPrefix(line, "#")))
+			}
+			continue
+		}
+		if bailed {
+			break
+		}
+		last = nil
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if yamlIndent >= 0 {
+		attachYAML(last, yaml)
+	}
+	if !sawPlan && len(suite.Cases) == 0 {
+		return nil, fmt.Errorf("%w: no TAP plan or test lines", ErrMalformed)
+	}
+	if ran := len(suite.Cases); sawPlan && !bailed && ran < planned {
+		suite.Cases = append(suite.Cases, &Case{Name: planCase, Status: StatusError, Message: fmt.Sprintf("planned %d tests but %d ran", planned, ran)})
+	}
+	for _, c := range suite.Cases {
+		suite.DurationMS += c.DurationMS
+	}
+	return rep.finish(), nil
+}
+
+func tapCase(ok bool, number, rest string, seq int) *Case {
+	desc, directive := rest, ""
+	// "#" starts the directive unless escaped as "\#".
+	for i := 0; i < len(rest); i++ {
+		if rest[i] == '#' && (i == 0 || rest[i-1] != '\\') {
+			desc, directive = rest[:i], strings.TrimSpace(rest[i+1:])
+			break
+		}
+	}
+	desc = strings.ReplaceAll(strings.TrimSpace(desc), `\#`, "#")
+	if desc == "" {
+		if number == "" {
+			number = strconv.Itoa(seq)
+		}
+		desc = "test " + number
+	}
+	c := &Case{Name: desc, Status: StatusPassed}
+	if !ok {
+		c.Status = StatusFailed
+	}
+	if m := tapDirective.FindStringSubmatch(directive); m != nil {
+		c.Status, c.Message = StatusSkipped, m[2]
+		if strings.EqualFold(m[1], "todo") && m[2] == "" {
+			c.Message = "TODO"
+		}
+	}
+	return c
+}
+
+// attachYAML keeps a YAML diagnostic block as the message of a failing case
+// and reads the duration node-tap and others record in it.
+func attachYAML(c *Case, lines []string) {
+	if c == nil {
+		return
+	}
+	for _, l := range lines {
+		if m := tapDuration.FindStringSubmatch(l); m != nil {
+			if ms, err := strconv.ParseFloat(m[1], 64); err == nil {
+				c.DurationMS = int64(ms)
+			}
+		}
+	}
+	if c.Failing() {
+		c.Message = strings.TrimSpace(strings.Join(lines, "\n") + "\n" + c.Message)
+	}
+}
@@ -0,0 +1,363 @@
+package toolpolicy
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Invocation is what a tool call would do, as classified by the tool runner.
+type Invocation struct {
+	Tool string
+	// Paths are repository-relative paths the call reads or, with Write, writes.
+	Paths []string
+	Write bool
+	// Command is the shell command run_command would execute.
+	Command string
+	// Git lists git subcommands the call uses; those inside Command are
+	// found by the enforcer itself.
+	Git     []string
+	Network bool
+}
+
+// Decision is the outcome of checking an invocation. A denial names the
+// rule that blocked it as "<layer>.<rule>", e.g. "worker.commands".
+type Decision struct {
+	Allowed bool   `json:"allowed"`
+	Rule    string `json:"rule,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// Enforcer checks the invocations of one run against a resolved policy and
+// counts the files written so far.
+type Enforcer struct {
+	policy Resolved
+	mu     sync.Mutex
+	writes int
+}
+
+func NewEnforcer(p Resolved) *Enforcer { return &Enforcer{policy: p} }
+
+func (e *Enforcer) Policy() Resolved { return e.policy }
+
+// Check decides whether inv may run; allowed writes count toward max_file_writes.
+func (e *Enforcer) Check(inv Invocation) Decision {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	p := e.policy
+	if p.AllowedTools != nil && !matchAny(p.AllowedTools, inv.Tool, matchName) {
+		return e.deny("allowed_tools", "tool %q is not allowed", inv.Tool)
+	}
+	if inv.Network && p.NetworkDisabled() {
+		return e.deny("network", "tool %q needs network access", inv.Tool)
+	}
+	for _, rel := range inv.Paths {
+		clean := path.Clean(strings.TrimPrefix(rel, "./"))
+		for _, g := range p.Paths.Deny {
+			if matchPath(g, clean) {
+				return e.denyKey("paths.deny:"+g, "paths.deny", "path %q matches deny glob %q", clean, g)
+			}
+		}
+		if len(p.Paths.Allow) > 0 && !matchAny(p.Paths.Allow, clean, matchPath) {
+			return e.deny("paths.allow", "path %q matches no allow glob", clean)
+		}
+	}
+	git := inv.Git
+	if inv.Command != "" {
+		segments := splitCommand(inv.Command)
+		if p.Commands != nil {
+			if strings.Contains(inv.Command, "$(") || strings.Contains(inv.Command, "`") {
+				return e.deny("commands", "command substitution is not allowed with a command allowlist")
+			}
+			// A glob's "*" would match whatever a subshell or redirection adds.
+			if strings.ContainsAny(inv.Command, "()<>") {
+				return e.deny("commands", "subshells and redirections are not allowed with a command allowlist")
+			}
+			for _, seg := range segments {
+				if !matchAny(p.Commands, seg, matchCommand) {
+					return e.deny("commands", "command %q is not in the allowlist", seg)
+				}
+			}
+		}
+		for _, seg := range segments {
+			subs, ok := gitSubcommands(seg, 0)
+			if !ok && p.Git != nil {
+				return e.deny("git", "cannot tell which git subcommands %q runs", seg)
+			}
+			git = append(git, subs...)
+		}
+	}
+	if p.Git != nil {
+		for _, sub := range git {
+			if !contains(p.Git, sub) {
+				return e.deny("git", "git %s is not allowed", sub)
+			}
+		}
+	}
+	if inv.Write && p.MaxFileWrites != nil && e.writes+len(inv.Paths) > *p.MaxFileWrites {
+		return e.deny("max_file_writes", "writing %d file(s) would exceed %d (already wrote %d)", len(inv.Paths), *p.MaxFileWrites, e.writes)
+	}
+	if inv.Write {
+		e.writes += len(inv.Paths)
+	}
+	return Decision{Allowed: true}
+}
+
+func (e *Enforcer) deny(key, format string, args ...any) Decision {
+	return e.denyKey(key, key, format, args...)
+}
+
+// denyKey names the rule by its source layer; sourceKey looks up the layer
+// (deny globs are tracked per glob), key is the rule name reported.
+func (e *Enforcer) denyKey(sourceKey, key, format string, args ...any) Decision {
+	layer := e.policy.Sources[sourceKey]
+	if layer == "" {
+		layer = "policy"
+	}
+	return Decision{Rule: layer + "." + key, Reason: fmt.Sprintf(format, args...)}
+}
+
+var commandSeparators = regexp.MustCompile(`&&|\|\||[;|&\n()]`)
+
+// splitCommand splits a shell command line at ;, &&, ||, pipes, background
+// & and subshell parentheses.
+func splitCommand(command string) []string {
+	var out []string
+	for _, seg := range commandSeparators.Split(command, -1) {
+		if seg = strings.TrimSpace(seg); seg != "" {
+			out = append(out, seg)
+		}
+	}
+	return out
+}
+
+// commandWrappers run another command given among their arguments.
+var commandWrappers = map[string]bool{
+	"env": true, "command": true, "exec": true, "xargs": true, "nice": true, "nohup": true,
+	"time": true, "timeout": true, "stdbuf": true, "sudo": true, "find": true, "watch": true,
+}
+
+// shells run the script given with -c, or a script file, or read one from stdin.
+var shells = map[string]bool{"sh": true, "bash": true, "dash": true, "zsh": true, "ksh": true}
+
+// maxScriptDepth bounds how deeply sh -c scripts are followed.
+const maxScriptDepth = 4
+
+var assignment = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*=`)
+
+// gitSubcommands returns the git subcommands one command segment runs. It
+// skips leading NAME=value assignments, looks through known wrappers (env,
+// xargs, ...) and into the scripts of sh -c and eval. ok is false when the
+// segment's command cannot be told statically: a command name built from
+// $-expansions or backticks, a shell reading its script from stdin, or
+// scripts nested too deeply.
+func gitSubcommands(segment string, depth int) (subs []string, ok bool) {
+	if depth > maxScriptDepth || strings.Contains(segment, "`") {
+		return nil, false
+	}
+	return classifyWords(shellWords(segment), depth)
+}
+
+func classifyWords(words []string, depth int) ([]string, bool) {
+	for len(words) > 0 && assignment.MatchString(words[0]) {
+		words = words[1:]
+	}
+	if len(words) == 0 {
+		return nil, true
+	}
+	name := words[0]
+	if strings.Contains(name, "$") {
+		return nil, false
+	}
+	switch base := path.Base(name); {
+	case base == "git":
+		if sub := gitSubcommand(words[1:]); sub != "" {
+			return []string{sub}, true
+		}
+		return nil, true
+	case base == "eval":
+		return script(strings.Join(words[1:], " "), depth)
+	case shells[base]:
+		var subs []string
+		args := 0
+		for _, w := range words[1:] {
+			if strings.HasPrefix(w, "-") {
+				continue
+			}
+			args++
+			got, ok := script(w, depth)
+			if !ok {
+				return nil, false
+			}
+			subs = append(subs, got...)
+		}
+		return subs, args > 0
+	case commandWrappers[base]:
+		// The wrapped command is the first argument that is itself
+		// classifiable as a command; options and their values are skipped.
+		rest := words[1:]
+		for i, w := range rest {
+			if strings.Contains(w, "$") {
+				return nil, false
+			}
+			if strings.ContainsAny(w, " \t\n") {
+				return script(w, depth)
+			}
+			b := path.Base(w)
+			if b == "git" || b == "eval" || shells[b] || commandWrappers[b] {
+				return classifyWords(rest[i:], depth+1)
+			}
+		}
+		return nil, true
+	}
+	return nil, true
+}
+
+// script returns the git subcommands of a shell script given as a string.
+func script(src string, depth int) ([]string, bool) {
+	var subs []string
+	for _, seg := range splitCommand(src) {
+		got, ok := gitSubcommands(seg, depth+1)
+		if !ok {
+			return nil, false
+		}
+		subs = append(subs, got...)
+	}
+	return subs, true
+}
+
+// gitSubcommand returns the subcommand among git's arguments, skipping
+// global options such as -C dir or -c key=value.
+func gitSubcommand(args []string) string {
+	for i := 0; i < len(args); i++ {
+		f := args[i]
+		if f == "-C" || f == "-c" {
+			i++
+			continue
+		}
+		if !strings.HasPrefix(f, "-") {
+			return f
+		}
+	}
+	return ""
+}
+
+// shellWords splits a command segment into words the way a shell would,
+// removing quotes and backslash escapes. An unterminated quote runs to the
+// end of the segment.
+func shellWords(s string) []string {
+	var words []string
+	var b strings.Builder
+	inWord := false
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else if c == '\\' && quote == '"' && i+1 < len(s) {
+				i++
+				b.WriteByte(s[i])
+			} else {
+				b.WriteByte(c)
+			}
+		case c == '\'' || c == '"':
+			quote, inWord = c, true
+		case c == '\\' && i+1 < len(s):
+			i++
+			b.WriteByte(s[i])
+			inWord = true
+		case c == ' ' || c == '\t' || c == '\n':
+			if inWord {
+				words = append(words, b.String())
+				b.Reset()
+				inWord = false
+			}
+		default:
+			b.WriteByte(c)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, b.String())
+	}
+	return words
+}
+
+func matchAny(globs []string, s string, match func(string, string) bool) bool {
+	for _, g := range globs {
+		if match(g, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPath matches a repository path against a glob where "*" and "?" stay
+// within one segment and "**" spans any number of segments.
+func matchPath(glob, p string) bool {
+	return globRegexp(glob, true).MatchString(p)
+}
+
+// matchName matches a tool name against a glob where "*" matches anything.
+func matchName(glob, name string) bool {
+	return globRegexp(glob, false).MatchString(name)
+}
+
+// matchCommand matches a command against a glob where "*" matches anything.
+func matchCommand(glob, command string) bool {
+	return globRegexp(strings.Join(strings.Fields(glob), " "), false).MatchString(strings.Join(strings.Fields(command), " "))
+}
+
+var (
+	globMu    sync.Mutex
+	globCache = map[string]*regexp.Regexp{}
+)
+
+func globRegexp(glob string, segments bool) *regexp.Regexp {
+	key := fmt.Sprintf("%t:%s", segments, glob)
+	globMu.Lock()
+	defer globMu.Unlock()
+	if re, ok := globCache[key]; ok {
+		return re
+	}
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case segments && strings.HasPrefix(glob[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case segments && strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*' && segments:
+			b.WriteString("[^/]*")
+		case c == '*':
+			b.WriteString(".*")
+		case c == '?' && segments:
+			b.WriteString("[^/]")
+		case c == '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	re := regexp.MustCompile(b.String())
+	globCache[key] = re
+	return re
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
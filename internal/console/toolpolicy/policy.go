@@ -0,0 +1,181 @@
+// Package toolpolicy defines the tool_policy_json schema, merges it across the
+// model profile, agent app and worker layers and decides whether each tool
+// invocation of a locally executed agent may run.
+package toolpolicy
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrInvalidPolicy = errors.New("invalid tool policy")
+
+// Layers a policy is merged from, least specific first.
+const (
+	LayerModelProfile = "model_profile"
+	LayerAgentApp     = "agent_app"
+	LayerWorker       = "worker"
+)
+
+// Policy is the tool_policy_json schema. Unset fields place no restriction.
+//
+//   - allowed_tools: tool names, or globs such as "docs__*" for plugin
+//     tools, the agent may call.
+//   - paths.allow / paths.deny: globs over repository-relative paths ("*"
+//     stays within a path segment, "**" crosses segments). Every path a call
+//     touches must match an allow glob, when any are set, and no deny glob.
+//   - commands: globs the run_command command must match; chained commands
+//     are checked segment by segment.
+//   - network: false runs commands without network and blocks network tools.
+//   - max_file_writes: files the run may write in total.
+//   - git: git subcommands the agent may use (status, diff, apply, commit, ...).
+type Policy struct {
+	AllowedTools  []string `json:"allowed_tools,omitempty"`
+	Paths         Paths    `json:"paths"`
+	Commands      []string `json:"commands,omitempty"`
+	Network       *bool    `json:"network,omitempty"`
+	MaxFileWrites *int     `json:"max_file_writes,omitempty"`
+	Git           []string `json:"git,omitempty"`
+}
+
+type Paths struct {
+	Allow []string `json:"allow,omitempty"`
+	Deny  []string `json:"deny,omitempty"`
+}
+
+// Parse reads a tool_policy_json value; empty input is the empty policy.
+func Parse(raw string) (Policy, error) {
+	var p Policy
+	if strings.TrimSpace(raw) == "" {
+		return p, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader([]byte(raw)))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&p); err != nil {
+		return p, fmt.Errorf("%w: %v", ErrInvalidPolicy, err)
+	}
+	return p, p.validate()
+}
+
+func (p Policy) validate() error {
+	for _, g := range append(append(append([]string{}, p.Paths.Allow...), p.Paths.Deny...), p.Commands...) {
+		if strings.TrimSpace(g) == "" {
+			return fmt.Errorf("%w: empty glob", ErrInvalidPolicy)
+		}
+	}
+	if p.MaxFileWrites != nil && *p.MaxFileWrites < 0 {
+		return fmt.Errorf("%w: max_file_writes must not be negative", ErrInvalidPolicy)
+	}
+	return nil
+}
+
+// ParseOverride reads the "tool_policy" key of a worker config_override_json.
+func ParseOverride(configOverrideJSON string) (Policy, error) {
+	if strings.TrimSpace(configOverrideJSON) == "" {
+		return Policy{}, nil
+	}
+	var override struct {
+		ToolPolicy json.RawMessage `json:"tool_policy"`
+	}
+	if err := json.Unmarshal([]byte(configOverrideJSON), &override); err != nil {
+		return Policy{}, fmt.Errorf("%w: config_override_json: %v", ErrInvalidPolicy, err)
+	}
+	if len(override.ToolPolicy) == 0 || string(override.ToolPolicy) == "null" {
+		return Policy{}, nil
+	}
+	return Parse(string(override.ToolPolicy))
+}
+
+// Resolved is the merged policy with the layer each rule came from, keyed by
+// rule name ("allowed_tools", "paths.allow", "paths.deny:<glob>", ...).
+type Resolved struct {
+	Policy
+	Sources map[string]string `json:"sources"`
+}
+
+// Layer is one policy with the name of the layer it came from.
+type Layer struct {
+	Name   string
+	Policy Policy
+}
+
+// Merge combines layers given least specific first. Allow lists and scalars
+// come from the most specific layer that sets them; deny globs accumulate.
+func Merge(layers ...Layer) Resolved {
+	r := Resolved{Sources: map[string]string{}}
+	for _, l := range layers {
+		p := l.Policy
+		if p.AllowedTools != nil {
+			r.AllowedTools = p.AllowedTools
+			r.Sources["allowed_tools"] = l.Name
+		}
+		if p.Paths.Allow != nil {
+			r.Paths.Allow = p.Paths.Allow
+			r.Sources["paths.allow"] = l.Name
+		}
+		for _, g := range p.Paths.Deny {
+			if _, seen := r.Sources["paths.deny:"+g]; !seen {
+				r.Paths.Deny = append(r.Paths.Deny, g)
+				r.Sources["paths.deny:"+g] = l.Name
+			}
+		}
+		if p.Commands != nil {
+			r.Commands = p.Commands
+			r.Sources["commands"] = l.Name
+		}
+		if p.Network != nil {
+			r.Network = p.Network
+			r.Sources["network"] = l.Name
+		}
+		if p.MaxFileWrites != nil {
+			r.MaxFileWrites = p.MaxFileWrites
+			r.Sources["max_file_writes"] = l.Name
+		}
+		if p.Git != nil {
+			r.Git = p.Git
+			r.Sources["git"] = l.Name
+		}
+	}
+	return r
+}
+
+// NetworkDisabled reports whether the policy forbids network access.
+func (r Resolved) NetworkDisabled() bool { return r.Network != nil && !*r.Network }
+
+// Resolve loads and merges the policies of a model profile, agent app and
+// worker; empty ids skip their layer.
+func Resolve(db *sql.DB, modelProfileID, agentAppID, workerID string) (Resolved, error) {
+	var layers []Layer
+	load := func(layer, query, id string, parse func(string) (Policy, error)) error {
+		if id == "" {
+			return nil
+		}
+		var raw string
+		if err := db.QueryRow(query, id).Scan(&raw); err != nil {
+			if err == sql.ErrNoRows {
+				return nil
+			}
+			return err
+		}
+		p, err := parse(raw)
+		if err != nil {
+			return fmt.Errorf("%s %s: %w", layer, id, err)
+		}
+		layers = append(layers, Layer{Name: layer, Policy: p})
+		return nil
+	}
+	if err := load(LayerModelProfile, `SELECT tool_policy_json FROM model_profiles WHERE id = ?`, modelProfileID, Parse); err != nil {
+		return Resolved{}, err
+	}
+	if err := load(LayerAgentApp, `SELECT tool_policy_json FROM agent_apps WHERE id = ?`, agentAppID, Parse); err != nil {
+		return Resolved{}, err
+	}
+	if err := load(LayerWorker, `SELECT config_override_json FROM workers WHERE id = ?`, workerID, ParseOverride); err != nil {
+		return Resolved{}, err
+	}
+	return Merge(layers...), nil
+}
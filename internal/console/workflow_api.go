@@ -3,6 +3,7 @@ package console
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strings"
 	"time"
@@ -10,7 +11,11 @@ import (
 	"github.com/PonyDevAI/Bull-Board/internal/common"
 	"github.com/PonyDevAI/Bull-Board/internal/console/dispatch"
 	"github.com/PonyDevAI/Bull-Board/internal/console/execution"
+	"github.com/PonyDevAI/Bull-Board/internal/console/execution_backends"
+	"github.com/PonyDevAI/Bull-Board/internal/console/execution_backends/agent"
+	"github.com/PonyDevAI/Bull-Board/internal/console/toolpolicy"
 	"github.com/PonyDevAI/Bull-Board/internal/console/workflows"
+	"github.com/PonyDevAI/Bull-Board/pkg/sandbox"
 )
 
 func (s *Server) apiWorkflowRoutes(w http.ResponseWriter, r *http.Request) {
@@ -149,6 +154,50 @@ func (s *Server) handleStepRunActions(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		writeJSON(w, map[string]any{"ok": true})
+	case "trace":
+		if r.Method != http.MethodGet {
+			http.Error(w, "", http.StatusMethodNotAllowed)
+			return
+		}
+		items, err := agent.ListToolCalls(s.db, stepRunID)
+		if err != nil {
+			writeJSONError(w, "db", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, map[string]any{"items": items})
+	case "diff-stats":
+		if r.Method != http.MethodGet {
+			http.Error(w, "", http.StatusMethodNotAllowed)
+			return
+		}
+		stats, err := s.execution.StepDiffStats(stepRunID)
+		if err != nil {
+			s.writeStepActionError(w, err)
+			return
+		}
+		writeJSON(w, map[string]any{"item": stats})
+	case "tests":
+		if r.Method != http.MethodGet {
+			http.Error(w, "", http.StatusMethodNotAllowed)
+			return
+		}
+		summary, err := s.execution.StepTests(stepRunID)
+		if err != nil {
+			s.writeStepActionError(w, err)
+			return
+		}
+		writeJSON(w, map[string]any{"item": summary})
+	case "candidates":
+		if r.Method != http.MethodGet {
+			http.Error(w, "", http.StatusMethodNotAllowed)
+			return
+		}
+		required, assigned, candidates, err := wf.StepCandidates(stepRunID)
+		if err != nil {
+			s.writeStepActionError(w, err)
+			return
+		}
+		writeJSON(w, map[string]any{"item": map[string]any{"required_capabilities": required, "assigned": assigned, "candidates": candidates}})
 	case "dispatch-preview":
 		if r.Method != http.MethodGet {
 			http.Error(w, "", http.StatusMethodNotAllowed)
@@ -163,6 +212,10 @@ func (s *Server) handleStepRunActions(w http.ResponseWriter, r *http.Request) {
 			writeJSONError(w, "not found", http.StatusNotFound)
 			return
 		}
+		if errors.Is(err, toolpolicy.ErrInvalidPolicy) {
+			writeJSONError(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
 		if err != nil {
 			writeJSONError(w, "dispatch preview failed", http.StatusInternalServerError)
 			return
@@ -173,13 +226,19 @@ func (s *Server) handleStepRunActions(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "", http.StatusMethodNotAllowed)
 			return
 		}
-		execSvc := execution.NewService(s.db)
-		result, err := execSvc.DispatchStepRun(r.Context(), stepRunID)
+		result, err := s.execution.DispatchStepRun(r.Context(), stepRunID)
 		if err != nil {
 			if err == sql.ErrNoRows || err == workflows.ErrStepRunNotFound {
 				writeJSONError(w, "not found", http.StatusNotFound)
 				return
 			}
+			var rejected *execution.DispatchRejectedError
+			if errors.As(err, &rejected) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusConflict)
+				_ = json.NewEncoder(w).Encode(map[string]any{"error": err.Error(), "mismatch": rejected})
+				return
+			}
 			if err == dispatch.ErrStepRunWorkerMissing || err == execution.ErrStepNotDispatchable || strings.Contains(err.Error(), execution.ErrStepNotDispatchable.Error()) {
 				writeJSONError(w, err.Error(), http.StatusConflict)
 				return
@@ -187,6 +246,8 @@ func (s *Server) handleStepRunActions(w http.ResponseWriter, r *http.Request) {
 			writeJSONError(w, "dispatch failed", http.StatusInternalServerError)
 			return
 		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
 		writeJSON(w, map[string]any{"item": result})
 	default:
 		http.NotFound(w, r)
@@ -242,6 +303,16 @@ func (s *Server) handleTemplateSteps(w http.ResponseWriter, r *http.Request, tem
 		if _, ok := payload["config_json"]; !ok {
 			payload["config_json"] = "{}"
 		}
+		if v, ok := payload["required_capabilities_json"]; ok {
+			if _, err := execution_backends.ParseCapabilities(asString(v)); err != nil {
+				writeJSONError(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		if err := sandbox.ValidateStepConfig(asString(payload["config_json"])); err != nil {
+			writeJSONError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		columns := make([]string, 0, len(payload))
 		values := make([]any, 0, len(payload))
 		marks := make([]string, 0, len(payload))
@@ -281,7 +352,7 @@ func (s *Server) getTaskWorkflow(w http.ResponseWriter, taskID string) {
 	current := map[string]any(nil)
 	for _, sr := range state.StepRuns {
 		st, _ := sr["status"].(string)
-		if st == "running" || st == "ready" || st == "pending_unassigned" {
+		if st == "running" || st == "queued" || st == "ready" || st == "pending_unassigned" || st == "awaiting_approval" {
 			current = sr
 			break
 		}
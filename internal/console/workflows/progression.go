@@ -6,6 +6,8 @@ import (
 	"errors"
 	"fmt"
 	"time"
+
+	"github.com/PonyDevAI/Bull-Board/internal/console/execution_backends"
 )
 
 var (
@@ -30,8 +32,8 @@ func (s *Service) StartStep(stepRunID string) error {
 	if err != nil {
 		return err
 	}
-	if sr.Status != "ready" {
-		return fmt.Errorf("%w: start requires ready status", ErrInvalidStepTransition)
+	if sr.Status != "ready" && sr.Status != "queued" {
+		return fmt.Errorf("%w: start requires ready or queued status", ErrInvalidStepTransition)
 	}
 	now := time.Now().UTC().Format(time.RFC3339)
 	if _, err := tx.Exec(`UPDATE step_runs SET status='running', started_at=?, updated_at=? WHERE id=?`, now, now, stepRunID); err != nil {
@@ -43,6 +45,26 @@ func (s *Service) StartStep(stepRunID string) error {
 	return tx.Commit()
 }
 
+// QueuedAtLayout is the fixed-width layout of step_runs.queued_at, so that
+// queue order can compare the column as text. RFC3339Nano drops trailing
+// zeros of the fraction and does not sort.
+const QueuedAtLayout = "2006-01-02T15:04:05.000000000Z07:00"
+
+// QueueStep parks a ready step run until its worker and execution backend have
+// capacity; queued steps keep their worker and are started in queued_at order.
+func (s *Service) QueueStep(stepRunID string) error {
+	at := time.Now().UTC()
+	res, err := s.db.Exec(`UPDATE step_runs SET status='queued', queued_at=?, updated_at=? WHERE id=? AND status='ready'`,
+		at.Format(QueuedAtLayout), at.Format(time.RFC3339), stepRunID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("%w: queue requires ready status", ErrInvalidStepTransition)
+	}
+	return nil
+}
+
 func (s *Service) CompleteStep(stepRunID string, output any) error {
 	outputJSON, err := marshalJSONOrEmpty(output)
 	if err != nil {
@@ -71,6 +93,62 @@ func (s *Service) CompleteStep(stepRunID string, output any) error {
 	return tx.Commit()
 }
 
+// AwaitApproval parks a running step run whose git operation waits for
+// approval; the workflow run waits with it. ResumeStep makes it ready to be
+// dispatched again once the operation is approved.
+func (s *Service) AwaitApproval(stepRunID string, output any) error {
+	outputJSON, err := marshalJSONOrEmpty(output)
+	if err != nil {
+		return err
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	sr, err := loadStepRun(tx, stepRunID)
+	if err != nil {
+		return err
+	}
+	if sr.Status != "running" {
+		return fmt.Errorf("%w: await approval requires running status", ErrInvalidStepTransition)
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	if _, err := tx.Exec(`UPDATE step_runs SET status='awaiting_approval', output_json=?, updated_at=? WHERE id=?`, outputJSON, now, stepRunID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE workflow_runs SET status='awaiting_approval', updated_at=? WHERE id=?`, now, sr.WorkflowRun); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ResumeStep moves a step run awaiting approval back to ready.
+func (s *Service) ResumeStep(stepRunID string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	sr, err := loadStepRun(tx, stepRunID)
+	if err != nil {
+		return err
+	}
+	if sr.Status != "awaiting_approval" {
+		return fmt.Errorf("%w: resume requires awaiting_approval status", ErrInvalidStepTransition)
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	if _, err := tx.Exec(`UPDATE step_runs SET status='ready', updated_at=? WHERE id=?`, now, stepRunID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE workflow_runs SET status='running', updated_at=? WHERE id=?`, now, sr.WorkflowRun); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
 func (s *Service) FailStep(stepRunID string, errorInfo any) error {
 	errorJSON, err := marshalJSONOrEmpty(errorInfo)
 	if err != nil {
@@ -86,8 +164,8 @@ func (s *Service) FailStep(stepRunID string, errorInfo any) error {
 	if err != nil {
 		return err
 	}
-	if sr.Status != "ready" && sr.Status != "running" {
-		return fmt.Errorf("%w: fail requires ready or running status", ErrInvalidStepTransition)
+	if sr.Status != "ready" && sr.Status != "queued" && sr.Status != "running" && sr.Status != "awaiting_approval" {
+		return fmt.Errorf("%w: fail requires ready, queued, running or awaiting_approval status", ErrInvalidStepTransition)
 	}
 	now := time.Now().UTC().Format(time.RFC3339)
 	if _, err := tx.Exec(`UPDATE step_runs SET status='failed', output_json=?, finished_at=?, updated_at=? WHERE id=?`, errorJSON, now, now, stepRunID); err != nil {
@@ -99,6 +177,126 @@ func (s *Service) FailStep(stepRunID string, errorInfo any) error {
 	return tx.Commit()
 }
 
+// ReassignWorker re-resolves the worker of a ready or pending_unassigned step
+// run, e.g. when its current worker's execution backend went offline. The step
+// becomes pending_unassigned when no worker resolves.
+func (s *Service) ReassignWorker(stepRunID string) (string, error) {
+	res, err := s.loadStepResolution(stepRunID)
+	if err != nil {
+		return "", err
+	}
+	if res.status != "ready" && res.status != "pending_unassigned" {
+		return "", fmt.Errorf("%w: reassign requires ready or pending_unassigned status", ErrInvalidStepTransition)
+	}
+	workerID, err := NewDBWorkerResolver(s.db).Resolve(res.workspaceID, res.roleID, res.required)
+	if err != nil {
+		return "", err
+	}
+	nextStatus := "ready"
+	if workerID == "" {
+		nextStatus = "pending_unassigned"
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	_, err = s.db.Exec(`UPDATE step_runs SET worker_id=NULLIF(?, ''), status=?, updated_at=? WHERE id=? AND status IN ('ready','pending_unassigned')`, workerID, nextStatus, now, stepRunID)
+	return workerID, err
+}
+
+// MoveQueuedStep assigns a queued step run whose worker can no longer take it
+// to the first eligible worker of its role. The step keeps its queued_at and
+// so its place in the queue. It returns "" and leaves the step where it is
+// when no other worker is eligible.
+func (s *Service) MoveQueuedStep(stepRunID string) (string, error) {
+	res, err := s.loadStepResolution(stepRunID)
+	if err != nil {
+		return "", err
+	}
+	if res.status != "queued" {
+		return "", fmt.Errorf("%w: move requires queued status", ErrInvalidStepTransition)
+	}
+	workerID, err := NewDBWorkerResolver(s.db).Resolve(res.workspaceID, res.roleID, res.required)
+	if err != nil || workerID == "" || workerID == res.workerID {
+		return "", err
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	if _, err := s.db.Exec(`UPDATE step_runs SET worker_id=?, updated_at=? WHERE id=? AND status='queued'`, workerID, now, stepRunID); err != nil {
+		return "", err
+	}
+	return workerID, nil
+}
+
+// StepCandidates returns a step run's required capabilities, the evaluation
+// of its assigned worker (nil when unassigned) and of every worker of its role.
+func (s *Service) StepCandidates(stepRunID string) (execution_backends.Capabilities, *WorkerCandidate, []WorkerCandidate, error) {
+	res, err := s.loadStepResolution(stepRunID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	resolver := NewDBWorkerResolver(s.db)
+	var assigned *WorkerCandidate
+	if res.workerID != "" {
+		c, err := resolver.Assess(res.workerID, res.required)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, nil, nil, err
+		}
+		if err == nil {
+			assigned = &c
+		}
+	}
+	candidates, err := resolver.Candidates(res.workspaceID, res.roleID, res.required)
+	return res.required, assigned, candidates, err
+}
+
+type stepResolution struct {
+	workspaceID, roleID, workerID, status string
+	required                              execution_backends.Capabilities
+}
+
+func (s *Service) loadStepResolution(stepRunID string) (stepResolution, error) {
+	var res stepResolution
+	var requiredJSON string
+	err := s.db.QueryRow(`
+		SELECT wr.workspace_id, COALESCE(wst.role_id,''), COALESCE(sr.worker_id,''), COALESCE(wst.required_capabilities_json,'{}'), sr.status
+		FROM step_runs sr
+		JOIN workflow_runs wr ON wr.id = sr.workflow_run_id
+		LEFT JOIN workflow_step_templates wst ON wst.id = sr.workflow_step_template_id
+		WHERE sr.id = ?`, stepRunID).Scan(&res.workspaceID, &res.roleID, &res.workerID, &requiredJSON, &res.status)
+	if err == sql.ErrNoRows {
+		return res, ErrStepRunNotFound
+	}
+	res.required = StepRequirements(requiredJSON)
+	return res, err
+}
+
+// CancelStep stops a ready, queued, running or awaiting_approval step run;
+// like a failure it ends the workflow run, which is marked cancelled.
+func (s *Service) CancelStep(stepRunID string, info any) error {
+	infoJSON, err := marshalJSONOrEmpty(info)
+	if err != nil {
+		return err
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	sr, err := loadStepRun(tx, stepRunID)
+	if err != nil {
+		return err
+	}
+	if sr.Status != "ready" && sr.Status != "queued" && sr.Status != "running" && sr.Status != "awaiting_approval" {
+		return fmt.Errorf("%w: cancel requires ready, queued, running or awaiting_approval status", ErrInvalidStepTransition)
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	if _, err := tx.Exec(`UPDATE step_runs SET status='cancelled', output_json=?, finished_at=?, updated_at=? WHERE id=?`, infoJSON, now, now, stepRunID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE workflow_runs SET status='cancelled', finished_at=?, updated_at=? WHERE id=?`, now, now, sr.WorkflowRun); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
 func (s *Service) AdvanceWorkflow(workflowRunID string) error {
 	tx, err := s.db.Begin()
 	if err != nil {
@@ -118,7 +316,7 @@ func (s *Service) advanceWorkflowTx(tx *sql.Tx, workflowRunID, now string) error
 		return err
 	}
 	rows, err := tx.Query(`
-		SELECT sr.id, sr.status, COALESCE(wst.role_id,''), COALESCE(wst.step_order,0), sr.created_at
+		SELECT sr.id, sr.status, COALESCE(wst.role_id,''), COALESCE(wst.required_capabilities_json,'{}'), COALESCE(wst.step_order,0), sr.created_at
 		FROM step_runs sr
 		LEFT JOIN workflow_step_templates wst ON wst.id = sr.workflow_step_template_id
 		WHERE sr.workflow_run_id = ?
@@ -128,13 +326,13 @@ func (s *Service) advanceWorkflowTx(tx *sql.Tx, workflowRunID, now string) error
 	}
 	defer rows.Close()
 
-	type stepState struct{ id, status, roleID string }
+	type stepState struct{ id, status, roleID, requiredJSON string }
 	var steps []stepState
 	for rows.Next() {
 		var st stepState
 		var order int
 		var created string
-		if err := rows.Scan(&st.id, &st.status, &st.roleID, &order, &created); err != nil {
+		if err := rows.Scan(&st.id, &st.status, &st.roleID, &st.requiredJSON, &order, &created); err != nil {
 			return err
 		}
 		steps = append(steps, st)
@@ -152,6 +350,10 @@ func (s *Service) advanceWorkflowTx(tx *sql.Tx, workflowRunID, now string) error
 			_, err := tx.Exec(`UPDATE workflow_runs SET status='failed', finished_at=?, updated_at=? WHERE id=?`, now, now, workflowRunID)
 			return err
 		}
+		if st.status == "cancelled" {
+			_, err := tx.Exec(`UPDATE workflow_runs SET status='cancelled', finished_at=?, updated_at=? WHERE id=?`, now, now, workflowRunID)
+			return err
+		}
 		if st.status != "completed" {
 			allCompleted = false
 		}
@@ -162,14 +364,18 @@ func (s *Service) advanceWorkflowTx(tx *sql.Tx, workflowRunID, now string) error
 	}
 
 	for _, st := range steps {
-		if st.status == "running" || st.status == "ready" {
+		if st.status == "awaiting_approval" {
+			_, err := tx.Exec(`UPDATE workflow_runs SET status='awaiting_approval', finished_at=NULL, updated_at=? WHERE id=?`, now, workflowRunID)
+			return err
+		}
+		if st.status == "running" || st.status == "ready" || st.status == "queued" {
 			_, err := tx.Exec(`UPDATE workflow_runs SET status='running', started_at=COALESCE(started_at, ?), finished_at=NULL, updated_at=? WHERE id=?`, now, now, workflowRunID)
 			return err
 		}
 		if st.status == "pending" || st.status == "pending_unassigned" {
 			workerID := ""
 			if st.roleID != "" {
-				workerID, err = NewDBWorkerResolver(s.db).Resolve(workspaceID, st.roleID)
+				workerID, err = NewDBWorkerResolver(s.db).Resolve(workspaceID, st.roleID, StepRequirements(st.requiredJSON))
 				if err != nil {
 					return err
 				}
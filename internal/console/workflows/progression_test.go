@@ -89,6 +89,61 @@ func TestWorkflowProgressionPendingUnassignedThenResolve(t *testing.T) {
 	assertStepStatus(t, db, step2, "ready")
 }
 
+func TestWorkflowProgressionAwaitApprovalThenResume(t *testing.T) {
+	db := testDB(t)
+	seedExecutionStack(t, db)
+	seedWorker(t, db, "worker-planner", "planner")
+	seedWorker(t, db, "worker-coder", "coder")
+
+	svc := NewService(db)
+	runID, err := svc.CreateRunFromTask("task-3", "default-workspace", seedWorkflowTemplate(t, db, "tpl-approval"), NewDBWorkerResolver(db))
+	if err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+	state, err := svc.GetWorkflowRunState(runID)
+	if err != nil {
+		t.Fatalf("load state: %v", err)
+	}
+	step1 := state.StepRuns[0]["id"].(string)
+
+	if err := svc.AwaitApproval(step1, nil); err == nil {
+		t.Fatalf("expected await approval of a ready step to fail")
+	}
+	if err := svc.StartStep(step1); err != nil {
+		t.Fatalf("start step1: %v", err)
+	}
+	if err := svc.AwaitApproval(step1, map[string]any{"approval": map[string]any{"id": "op-1"}}); err != nil {
+		t.Fatalf("await approval: %v", err)
+	}
+	assertStepStatus(t, db, step1, "awaiting_approval")
+	assertWorkflowStatus(t, db, runID, "awaiting_approval")
+
+	if err := svc.AdvanceWorkflow(runID); err != nil {
+		t.Fatalf("advance workflow: %v", err)
+	}
+	assertWorkflowStatus(t, db, runID, "awaiting_approval")
+
+	if err := svc.ResumeStep(step1); err != nil {
+		t.Fatalf("resume step1: %v", err)
+	}
+	assertStepStatus(t, db, step1, "ready")
+	assertWorkflowStatus(t, db, runID, "running")
+	if err := svc.ResumeStep(step1); err == nil {
+		t.Fatalf("expected resume of a ready step to fail")
+	}
+
+	if err := svc.StartStep(step1); err != nil {
+		t.Fatalf("restart step1: %v", err)
+	}
+	if err := svc.AwaitApproval(step1, nil); err != nil {
+		t.Fatalf("await approval again: %v", err)
+	}
+	if err := svc.FailStep(step1, map[string]any{"error": "rejected"}); err != nil {
+		t.Fatalf("fail awaiting step: %v", err)
+	}
+	assertWorkflowStatus(t, db, runID, "failed")
+}
+
 func testDB(t *testing.T) *sql.DB {
 	t.Helper()
 	t.Setenv("SQLITE_PATH", filepath.Join(t.TempDir(), "bb.sqlite"))
@@ -158,3 +213,46 @@ func assertWorkflowStatus(t *testing.T, db *sql.DB, runID, want string) {
 		t.Fatalf("workflow %s status got %s want %s", runID, got, want)
 	}
 }
+
+func TestResolverSkipsWorkersLackingRequiredCapabilities(t *testing.T) {
+	db := testDB(t)
+	seedExecutionStack(t, db)
+	seedWorker(t, db, "worker-planner", "planner")
+	now := time.Now().UTC().Format(time.RFC3339)
+	if _, err := db.Exec(`INSERT INTO execution_backends (id, home_id, connector_code, name, type, endpoint_url, status, capabilities_json, created_at, updated_at) VALUES ('backend-go','default','openclaw','Go Backend','openclaw','http://go.local','online','{"git_push":true,"languages":["go"]}',?,?)`, now, now); err != nil {
+		t.Fatalf("insert backend: %v", err)
+	}
+	if _, err := db.Exec(`INSERT INTO workers (id, home_id, workspace_id, group_id, role_id, agent_app_id, execution_backend_id, name, status, max_concurrency, config_override_json, created_at, updated_at) VALUES ('worker-go','default','default-workspace','default-group','planner','app-default','backend-go','Go','active',1,'{}',?,?)`, now, now); err != nil {
+		t.Fatalf("insert worker: %v", err)
+	}
+	templateID := seedWorkflowTemplate(t, db, "tpl-caps")
+	if _, err := db.Exec(`UPDATE workflow_step_templates SET required_capabilities_json = '{"git_push":true,"languages":["go"]}' WHERE id = ?`, templateID+"-step-1"); err != nil {
+		t.Fatalf("set requirements: %v", err)
+	}
+
+	svc := NewService(db)
+	runID, err := svc.CreateRunFromTask("task-caps", "default-workspace", templateID, NewDBWorkerResolver(db))
+	if err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+	state, err := svc.GetWorkflowRunState(runID)
+	if err != nil {
+		t.Fatalf("load state: %v", err)
+	}
+	stepID := state.StepRuns[0]["id"].(string)
+	var workerID string
+	if err := db.QueryRow(`SELECT worker_id FROM step_runs WHERE id = ?`, stepID).Scan(&workerID); err != nil {
+		t.Fatalf("read worker: %v", err)
+	}
+	if workerID != "worker-go" {
+		t.Fatalf("expected capable worker-go, got %s", workerID)
+	}
+
+	_, _, candidates, err := svc.StepCandidates(stepID)
+	if err != nil {
+		t.Fatalf("candidates: %v", err)
+	}
+	if len(candidates) != 2 || candidates[0].WorkerID != "worker-planner" || candidates[0].Eligible || len(candidates[0].Missing) != 2 {
+		t.Fatalf("expected worker-planner rejected with 2 missing capabilities, got %+v", candidates)
+	}
+}
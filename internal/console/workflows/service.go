@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/PonyDevAI/Bull-Board/internal/common"
+	"github.com/PonyDevAI/Bull-Board/internal/console/execution_backends"
 )
 
 type Service struct{ db *sql.DB }
@@ -14,23 +15,106 @@ type Service struct{ db *sql.DB }
 func NewService(db *sql.DB) *Service { return &Service{db: db} }
 
 type WorkerResolver interface {
-	Resolve(workspaceID, roleID string) (string, error)
+	Resolve(workspaceID, roleID string, required execution_backends.Capabilities) (string, error)
 }
 
 type DBWorkerResolver struct{ db *sql.DB }
 
 func NewDBWorkerResolver(db *sql.DB) *DBWorkerResolver { return &DBWorkerResolver{db: db} }
 
-func (r *DBWorkerResolver) Resolve(workspaceID, roleID string) (string, error) {
+// WorkerCandidate is one active worker of a role evaluated for a step.
+type WorkerCandidate struct {
+	WorkerID           string                                  `json:"worker_id"`
+	ExecutionBackendID string                                  `json:"execution_backend_id"`
+	BackendStatus      string                                  `json:"backend_status"`
+	Eligible           bool                                    `json:"eligible"`
+	Reason             string                                  `json:"reason,omitempty"`
+	Missing            []execution_backends.CapabilityMismatch `json:"missing,omitempty"`
+}
+
+// Resolve picks the first eligible candidate: the oldest active worker for the
+// role whose execution backend is not offline and offers the required
+// capabilities, preferring online backends over degraded ones.
+func (r *DBWorkerResolver) Resolve(workspaceID, roleID string, required execution_backends.Capabilities) (string, error) {
+	candidates, err := r.Candidates(workspaceID, roleID, required)
+	if err != nil {
+		return "", err
+	}
+	for _, c := range candidates {
+		if c.Eligible {
+			return c.WorkerID, nil
+		}
+	}
+	return "", nil
+}
+
+// Candidates evaluates every active worker for the role, explaining why ineligible ones were skipped.
+func (r *DBWorkerResolver) Candidates(workspaceID, roleID string, required execution_backends.Capabilities) ([]WorkerCandidate, error) {
 	if roleID == "" {
-		return "", nil
+		return nil, nil
+	}
+	rows, err := r.db.Query(`
+		SELECT w.id, w.execution_backend_id, COALESCE(eb.status,''), COALESCE(eb.capabilities_json,'{}')
+		FROM workers w
+		LEFT JOIN execution_backends eb ON eb.id = w.execution_backend_id
+		WHERE w.workspace_id = ? AND w.role_id = ? AND w.status = 'active'
+		ORDER BY CASE eb.status WHEN 'degraded' THEN 1 ELSE 0 END, w.created_at ASC`, workspaceID, roleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []WorkerCandidate
+	for rows.Next() {
+		var c WorkerCandidate
+		var capsJSON string
+		if err := rows.Scan(&c.WorkerID, &c.ExecutionBackendID, &c.BackendStatus, &capsJSON); err != nil {
+			return nil, err
+		}
+		out = append(out, evaluateCandidate(c, capsJSON, required))
 	}
-	var id string
-	err := r.db.QueryRow(`SELECT id FROM workers WHERE workspace_id = ? AND role_id = ? AND status = 'active' ORDER BY created_at ASC LIMIT 1`, workspaceID, roleID).Scan(&id)
-	if err == sql.ErrNoRows {
-		return "", nil
+	return out, rows.Err()
+}
+
+// Assess evaluates a single worker against the required capabilities.
+func (r *DBWorkerResolver) Assess(workerID string, required execution_backends.Capabilities) (WorkerCandidate, error) {
+	c := WorkerCandidate{WorkerID: workerID}
+	var capsJSON string
+	err := r.db.QueryRow(`
+		SELECT w.execution_backend_id, COALESCE(eb.status,''), COALESCE(eb.capabilities_json,'{}')
+		FROM workers w
+		LEFT JOIN execution_backends eb ON eb.id = w.execution_backend_id
+		WHERE w.id = ?`, workerID).Scan(&c.ExecutionBackendID, &c.BackendStatus, &capsJSON)
+	if err != nil {
+		return c, err
+	}
+	return evaluateCandidate(c, capsJSON, required), nil
+}
+
+func evaluateCandidate(c WorkerCandidate, capsJSON string, required execution_backends.Capabilities) WorkerCandidate {
+	offered, err := execution_backends.ParseCapabilities(capsJSON)
+	switch {
+	case c.BackendStatus == "offline":
+		c.Reason = "execution backend offline"
+	case err != nil:
+		c.Reason = err.Error()
+	default:
+		c.Missing = required.Missing(offered)
+		if len(c.Missing) > 0 {
+			c.Reason = "execution backend lacks required capabilities"
+		}
 	}
-	return id, err
+	c.Eligible = c.Reason == ""
+	return c
+}
+
+// StepRequirements returns the parsed required_capabilities_json of a step template.
+func StepRequirements(raw string) execution_backends.Capabilities {
+	caps, err := execution_backends.ParseCapabilities(raw)
+	if err != nil {
+		// Templates are validated on write; an unreadable declaration matches no backend.
+		return execution_backends.Capabilities{"x-invalid-requirements": true}
+	}
+	return caps
 }
 
 type StepTemplate struct {
@@ -52,6 +136,8 @@ type WorkflowRunState struct {
 	CreatedAt          string           `json:"created_at"`
 	UpdatedAt          string           `json:"updated_at"`
 	StepRuns           []map[string]any `json:"step_runs"`
+	// Worktree is the run's git worktree once a step has created it.
+	Worktree map[string]any `json:"worktree,omitempty"`
 }
 
 func (s *Service) CreateRunFromTask(taskID, workspaceID, workflowTemplateID string, resolver WorkerResolver) (string, error) {
@@ -68,7 +154,7 @@ func (s *Service) CreateRunFromTask(taskID, workspaceID, workflowTemplateID stri
 	if _, err = tx.Exec(`INSERT INTO workflow_runs (id, workspace_id, workflow_template_id, task_id, status, created_at, updated_at) VALUES (?, ?, ?, ?, 'pending', ?, ?)`, runID, workspaceID, workflowTemplateID, taskID, now, now); err != nil {
 		return "", err
 	}
-	rows, err := tx.Query(`SELECT id, role_id, config_json FROM workflow_step_templates WHERE workflow_template_id = ? ORDER BY step_order ASC, created_at ASC`, workflowTemplateID)
+	rows, err := tx.Query(`SELECT id, role_id, config_json, required_capabilities_json FROM workflow_step_templates WHERE workflow_template_id = ? ORDER BY step_order ASC, created_at ASC`, workflowTemplateID)
 	if err != nil {
 		return "", err
 	}
@@ -77,8 +163,8 @@ func (s *Service) CreateRunFromTask(taskID, workspaceID, workflowTemplateID stri
 	for rows.Next() {
 		var stepID string
 		var roleID sql.NullString
-		var cfg string
-		if err := rows.Scan(&stepID, &roleID, &cfg); err != nil {
+		var cfg, requiredJSON string
+		if err := rows.Scan(&stepID, &roleID, &cfg, &requiredJSON); err != nil {
 			return "", err
 		}
 		resolvedRole := roleID.String
@@ -93,7 +179,7 @@ func (s *Service) CreateRunFromTask(taskID, workspaceID, workflowTemplateID stri
 		status := "pending"
 		if idx == 0 {
 			if resolver != nil {
-				workerID, err = resolver.Resolve(workspaceID, resolvedRole)
+				workerID, err = resolver.Resolve(workspaceID, resolvedRole, StepRequirements(requiredJSON))
 				if err != nil {
 					return "", err
 				}
@@ -136,20 +222,23 @@ func (s *Service) GetWorkflowRunState(runID string) (WorkflowRunState, error) {
 		Scan(&out.ID, &out.WorkspaceID, &out.WorkflowTemplateID, &out.TaskID, &out.Status, &out.CreatedAt, &out.UpdatedAt); err != nil {
 		return out, err
 	}
-	rows, err := s.db.Query(`SELECT sr.id, sr.workflow_step_template_id, sr.worker_id, sr.status, sr.created_at, wst.name, wst.step_order FROM step_runs sr LEFT JOIN workflow_step_templates wst ON sr.workflow_step_template_id = wst.id WHERE sr.workflow_run_id = ? ORDER BY wst.step_order ASC, sr.created_at ASC`, runID)
+	rows, err := s.db.Query(`SELECT sr.id, sr.workflow_step_template_id, sr.worker_id, sr.status, sr.diff_stats_json, sr.test_totals_json, sr.created_at, wst.name, wst.step_order FROM step_runs sr LEFT JOIN workflow_step_templates wst ON sr.workflow_step_template_id = wst.id WHERE sr.workflow_run_id = ? ORDER BY wst.step_order ASC, sr.created_at ASC`, runID)
 	if err != nil {
 		return out, err
 	}
 	defer rows.Close()
 	for rows.Next() {
-		var id, tplID, status, createdAt string
+		var id, tplID, status, diffStatsJSON, testTotalsJSON, createdAt string
 		var workerID sql.NullString
 		var stepName sql.NullString
 		var order sql.NullInt64
-		if err := rows.Scan(&id, &tplID, &workerID, &status, &createdAt, &stepName, &order); err != nil {
+		if err := rows.Scan(&id, &tplID, &workerID, &status, &diffStatsJSON, &testTotalsJSON, &createdAt, &stepName, &order); err != nil {
 			return out, err
 		}
-		m := map[string]any{"id": id, "workflow_step_template_id": tplID, "status": status, "created_at": createdAt, "worker_id": ""}
+		var diffStats, testTotals map[string]any
+		_ = json.Unmarshal([]byte(diffStatsJSON), &diffStats)
+		_ = json.Unmarshal([]byte(testTotalsJSON), &testTotals)
+		m := map[string]any{"id": id, "workflow_step_template_id": tplID, "status": status, "created_at": createdAt, "worker_id": "", "diff_stats": diffStats, "test_totals": testTotals}
 		if workerID.Valid {
 			m["worker_id"] = workerID.String
 		}
@@ -161,6 +250,19 @@ func (s *Service) GetWorkflowRunState(runID string) (WorkflowRunState, error) {
 		}
 		out.StepRuns = append(out.StepRuns, m)
 	}
+	if err := rows.Err(); err != nil {
+		return out, err
+	}
+	var path, branch, baseBranch, baseCommit, head, wtStatus string
+	var size int64
+	err = s.db.QueryRow(`SELECT path, branch, base_branch, base_commit, head, status, size_bytes FROM run_worktrees WHERE workflow_run_id = ?`, runID).
+		Scan(&path, &branch, &baseBranch, &baseCommit, &head, &wtStatus, &size)
+	switch {
+	case err == nil:
+		out.Worktree = map[string]any{"path": path, "branch": branch, "base_branch": baseBranch, "base_commit": baseCommit, "head": head, "status": wtStatus, "size_bytes": size}
+	case err != sql.ErrNoRows:
+		return out, err
+	}
 	return out, nil
 }
 
@@ -3,11 +3,17 @@ package console
 import (
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/PonyDevAI/Bull-Board/internal/common"
+	"github.com/PonyDevAI/Bull-Board/internal/console/execution_backends"
+	"github.com/PonyDevAI/Bull-Board/internal/console/mcp"
+	"github.com/PonyDevAI/Bull-Board/internal/console/models"
+	"github.com/PonyDevAI/Bull-Board/internal/console/toolpolicy"
 )
 
 type workforceResource struct {
@@ -15,15 +21,20 @@ type workforceResource struct {
 	Path           string
 	RequiredFields []string
 	SafeDeleteRefs []string
+	// SecretFields 不经通用 CRUD 读写，响应中仅以 <field>_set 表示是否已配置
+	SecretFields []string
+	// Validate 在创建/更新前校验 payload（更新时仅含待修改字段）
+	Validate func(payload map[string]any) error
 }
 
 var workforceResources = []workforceResource{
 	{Table: "roles", Path: "/api/roles", RequiredFields: []string{"home_id", "name", "code"}, SafeDeleteRefs: []string{"workers.role_id"}},
-	{Table: "model_profiles", Path: "/api/model-profiles", RequiredFields: []string{"home_id", "name", "provider", "model_name"}, SafeDeleteRefs: []string{"agent_apps.default_model_profile_id"}},
+	{Table: "model_profiles", Path: "/api/model-profiles", RequiredFields: []string{"home_id", "name", "provider", "model_name"}, SafeDeleteRefs: []string{"agent_apps.default_model_profile_id"}, Validate: validateModelProfile},
 	{Table: "integration_instances", Path: "/api/integrations", RequiredFields: []string{"home_id", "connector_code", "name", "status"}, SafeDeleteRefs: []string{"execution_backends.integration_instance_id"}},
-	{Table: "agent_apps", Path: "/api/agent-apps", RequiredFields: []string{"home_id", "name"}, SafeDeleteRefs: []string{"workers.agent_app_id"}},
-	{Table: "execution_backends", Path: "/api/execution-backends", RequiredFields: []string{"home_id", "name", "connector_code", "type", "endpoint_url", "status"}, SafeDeleteRefs: []string{"workers.execution_backend_id", "agent_apps.default_execution_backend_id"}},
-	{Table: "workers", Path: "/api/workers", RequiredFields: []string{"home_id", "workspace_id", "group_id", "role_id", "agent_app_id", "execution_backend_id", "name", "status"}},
+	{Table: "agent_apps", Path: "/api/agent-apps", RequiredFields: []string{"home_id", "name"}, SafeDeleteRefs: []string{"workers.agent_app_id"}, Validate: validateAgentApp},
+	{Table: "plugins", Path: "/api/plugins", RequiredFields: []string{"code", "name"}, SafeDeleteRefs: []string{"agent_app_plugins.plugin_id"}, Validate: validatePlugin},
+	{Table: "execution_backends", Path: "/api/execution-backends", RequiredFields: []string{"home_id", "name", "connector_code", "type", "endpoint_url", "status"}, SafeDeleteRefs: []string{"workers.execution_backend_id", "agent_apps.default_execution_backend_id", "runner_backends.execution_backend_id"}, SecretFields: []string{"callback_secret"}, Validate: validateExecutionBackend},
+	{Table: "workers", Path: "/api/workers", RequiredFields: []string{"home_id", "workspace_id", "group_id", "role_id", "agent_app_id", "execution_backend_id", "name", "status"}, Validate: validateWorker},
 }
 
 func (s *Server) apiWorkforceRoutes(w http.ResponseWriter, r *http.Request) {
@@ -31,6 +42,18 @@ func (s *Server) apiWorkforceRoutes(w http.ResponseWriter, r *http.Request) {
 		writeJSONError(w, "db not configured", http.StatusServiceUnavailable)
 		return
 	}
+	if strings.HasPrefix(r.URL.Path, "/api/execution-backends/") && strings.HasSuffix(r.URL.Path, "/callback-secret") {
+		s.rotateCallbackSecret(w, r)
+		return
+	}
+	if strings.HasPrefix(r.URL.Path, "/api/agent-apps/") && strings.HasSuffix(r.URL.Path, "/plugins") {
+		s.agentAppPlugins(w, r)
+		return
+	}
+	if strings.HasPrefix(r.URL.Path, "/api/workers/") && strings.HasSuffix(r.URL.Path, "/load") {
+		s.workerLoad(w, r)
+		return
+	}
 	for _, resource := range workforceResources {
 		if r.URL.Path == resource.Path || strings.HasPrefix(r.URL.Path, resource.Path+"/") {
 			s.handleResource(w, r, resource)
@@ -81,6 +104,9 @@ func (s *Server) resourceList(w http.ResponseWriter, resource workforceResource)
 		writeJSONError(w, "db", http.StatusInternalServerError)
 		return
 	}
+	for _, item := range items {
+		resource.redactSecrets(item)
+	}
 	writeJSON(w, map[string]any{"items": items})
 }
 
@@ -96,6 +122,7 @@ func (s *Server) resourceGet(w http.ResponseWriter, resource workforceResource,
 		writeJSONError(w, "not found", http.StatusNotFound)
 		return
 	}
+	resource.redactSecrets(items[0])
 	writeJSON(w, map[string]any{"item": items[0]})
 }
 
@@ -105,12 +132,21 @@ func (s *Server) resourceCreate(w http.ResponseWriter, r *http.Request, resource
 		writeJSONError(w, "invalid body", http.StatusBadRequest)
 		return
 	}
+	for _, f := range resource.SecretFields {
+		delete(payload, f)
+	}
 	for _, f := range resource.RequiredFields {
 		if strings.TrimSpace(asString(payload[f])) == "" {
 			writeJSONError(w, f+" required", http.StatusBadRequest)
 			return
 		}
 	}
+	if resource.Validate != nil {
+		if err := resource.Validate(payload); err != nil {
+			writeJSONError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
 	if resource.Table == "workers" {
 		if _, ok := payload["max_concurrency"]; !ok {
 			payload["max_concurrency"] = 1
@@ -133,6 +169,7 @@ func (s *Server) resourceCreate(w http.ResponseWriter, r *http.Request, resource
 		writeJSONError(w, "db", http.StatusInternalServerError)
 		return
 	}
+	resource.redactSecrets(payload)
 	w.WriteHeader(http.StatusCreated)
 	writeJSON(w, map[string]any{"item": payload})
 }
@@ -145,10 +182,31 @@ func (s *Server) resourceUpdate(w http.ResponseWriter, r *http.Request, resource
 	}
 	delete(payload, "id")
 	delete(payload, "created_at")
+	for _, f := range resource.SecretFields {
+		delete(payload, f)
+	}
 	if len(payload) == 0 {
 		writeJSONError(w, "no fields to update", http.StatusBadRequest)
 		return
 	}
+	if resource.Validate != nil {
+		// 部分更新：在现有行上叠加 payload 后整体校验
+		merged := map[string]any{}
+		if rows, err := s.db.Query("SELECT * FROM "+resource.Table+" WHERE id = ?", id); err == nil {
+			items, _ := scanRows(rows)
+			rows.Close()
+			if len(items) > 0 {
+				merged = items[0]
+			}
+		}
+		for k, v := range payload {
+			merged[k] = v
+		}
+		if err := resource.Validate(merged); err != nil {
+			writeJSONError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
 	payload["updated_at"] = time.Now().UTC().Format(time.RFC3339)
 	sets := make([]string, 0, len(payload))
 	values := make([]any, 0, len(payload)+1)
@@ -193,6 +251,145 @@ func (s *Server) resourceDelete(w http.ResponseWriter, resource workforceResourc
 	writeJSON(w, map[string]any{"ok": true})
 }
 
+// validateExecutionBackend 校验 capabilities_json 是否符合能力词表
+func validateExecutionBackend(payload map[string]any) error {
+	if v, ok := payload["capabilities_json"]; ok {
+		if _, err := execution_backends.ParseCapabilities(asString(v)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateModelProfile 按 provider 能力校验 temperature 与 reasoning_level
+func validateModelProfile(payload map[string]any) error {
+	p := models.Profile{
+		Provider:       asString(payload["provider"]),
+		ModelName:      asString(payload["model_name"]),
+		ReasoningLevel: asString(payload["reasoning_level"]),
+	}
+	switch v := payload["temperature"].(type) {
+	case float64:
+		p.Temperature = v
+	case int64:
+		p.Temperature = float64(v)
+	case string:
+		if strings.TrimSpace(v) != "" {
+			t, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			if err != nil {
+				return fmt.Errorf("%w: temperature must be a number", models.ErrInvalidProfile)
+			}
+			p.Temperature = t
+		}
+	}
+	if err := models.DefaultRegistry.ValidateProfile(p); err != nil {
+		return err
+	}
+	_, err := toolpolicy.Parse(asString(payload["tool_policy_json"]))
+	return err
+}
+
+// validateAgentApp 校验 tool_policy_json 符合 tool policy schema
+func validateAgentApp(payload map[string]any) error {
+	_, err := toolpolicy.Parse(asString(payload["tool_policy_json"]))
+	return err
+}
+
+// validateWorker 校验 config_override_json 中的 tool_policy
+func validateWorker(payload map[string]any) error {
+	_, err := toolpolicy.ParseOverride(asString(payload["config_override_json"]))
+	return err
+}
+
+// validatePlugin 校验 MCP 插件的 transport 配置；transport 为空表示非 MCP 插件
+func validatePlugin(payload map[string]any) error {
+	c := mcp.Config{
+		Transport: asString(payload["transport"]),
+		Command:   asString(payload["command"]),
+		ArgsJSON:  asString(payload["args_json"]),
+		EnvJSON:   asString(payload["env_json"]),
+		URL:       asString(payload["url"]),
+	}
+	if strings.TrimSpace(c.Transport) == "" {
+		return nil
+	}
+	_, err := c.Server()
+	return err
+}
+
+// agentAppPlugins 查看（GET）或整体替换（PUT {"plugin_ids": [...]}）agent app 挂载的插件
+func (s *Server) agentAppPlugins(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/agent-apps/"), "/plugins")
+	if id == "" || strings.Contains(id, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	var n int
+	if err := s.db.QueryRow(`SELECT COUNT(1) FROM agent_apps WHERE id = ?`, id).Scan(&n); err != nil || n == 0 {
+		writeJSONError(w, "not found", http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var body struct {
+			PluginIDs []string `json:"plugin_ids"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeJSONError(w, "invalid body", http.StatusBadRequest)
+			return
+		}
+		for _, pid := range body.PluginIDs {
+			if err := s.db.QueryRow(`SELECT COUNT(1) FROM plugins WHERE id = ?`, pid).Scan(&n); err != nil || n == 0 {
+				writeJSONError(w, "unknown plugin "+pid, http.StatusBadRequest)
+				return
+			}
+		}
+		tx, err := s.db.Begin()
+		if err != nil {
+			writeJSONError(w, "db", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+		if _, err := tx.Exec(`DELETE FROM agent_app_plugins WHERE agent_app_id = ?`, id); err != nil {
+			writeJSONError(w, "db", http.StatusInternalServerError)
+			return
+		}
+		for _, pid := range body.PluginIDs {
+			if _, err := tx.Exec(`INSERT OR IGNORE INTO agent_app_plugins (agent_app_id, plugin_id) VALUES (?, ?)`, id, pid); err != nil {
+				writeJSONError(w, "db", http.StatusInternalServerError)
+				return
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			writeJSONError(w, "db", http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "", http.StatusMethodNotAllowed)
+		return
+	}
+	rows, err := s.db.Query(`SELECT p.* FROM agent_app_plugins ap JOIN plugins p ON p.id = ap.plugin_id WHERE ap.agent_app_id = ? ORDER BY p.code`, id)
+	if err != nil {
+		writeJSONError(w, "db", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	items, err := scanRows(rows)
+	if err != nil {
+		writeJSONError(w, "db", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]any{"items": items})
+}
+
+func (resource workforceResource) redactSecrets(item map[string]any) {
+	for _, f := range resource.SecretFields {
+		item[f+"_set"] = asString(item[f]) != ""
+		delete(item, f)
+	}
+}
+
 func scanRows(rows *sql.Rows) ([]map[string]any, error) {
 	cols, err := rows.Columns()
 	if err != nil {
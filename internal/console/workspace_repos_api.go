@@ -0,0 +1,88 @@
+package console
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/PonyDevAI/Bull-Board/internal/console/repos"
+)
+
+// repoSyncTimeout 限制一次按需 clone/fetch 的时长
+const repoSyncTimeout = 10 * time.Minute
+
+// apiWorkspaceRepo 处理工作区仓库管理：
+// GET/PUT /api/workspaces/:id/repo（查看状态 / 登记远程地址与定时 fetch 间隔）、
+// POST /api/workspaces/:id/repo/sync（立即 clone 或 fetch）、
+// POST /api/workspaces/:id/repo/key（生成 deploy key，body 带 private_key 时为导入）、DELETE /api/workspaces/:id/repo/key
+func (s *Server) apiWorkspaceRepo(w http.ResponseWriter, r *http.Request, workspaceID, sub string) {
+	switch {
+	case sub == "" && r.Method == http.MethodGet:
+		repo, err := s.repos.Get(workspaceID)
+		writeRepo(w, repo, err)
+	case sub == "" && r.Method == http.MethodPut:
+		var body struct {
+			RemoteURL            string `json:"remote_url"`
+			FetchIntervalMinutes int    `json:"fetch_interval_minutes"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.RemoteURL == "" {
+			writeJSONError(w, "remote_url required", http.StatusBadRequest)
+			return
+		}
+		repo, err := s.repos.Register(workspaceID, body.RemoteURL, body.FetchIntervalMinutes)
+		writeRepo(w, repo, err)
+	case sub == "sync" && r.Method == http.MethodPost:
+		ctx, cancel := context.WithTimeout(r.Context(), repoSyncTimeout)
+		defer cancel()
+		repo, err := s.repos.Sync(ctx, workspaceID)
+		writeRepo(w, repo, err)
+	case sub == "key" && r.Method == http.MethodPost:
+		// 私钥只进不出：响应里只有公钥与指纹
+		var body struct {
+			PrivateKey string `json:"private_key"`
+		}
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				writeJSONError(w, "invalid body", http.StatusBadRequest)
+				return
+			}
+		}
+		var repo repos.Repo
+		var err error
+		if body.PrivateKey != "" {
+			repo, err = s.repos.ImportKey(workspaceID, []byte(body.PrivateKey))
+		} else {
+			repo, err = s.repos.GenerateKey(workspaceID)
+		}
+		writeRepo(w, repo, err)
+	case sub == "key" && r.Method == http.MethodDelete:
+		repo, err := s.repos.DeleteKey(workspaceID)
+		writeRepo(w, repo, err)
+	case sub == "" || sub == "sync" || sub == "key":
+		http.Error(w, "", http.StatusMethodNotAllowed)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// writeRepo 输出仓库状态；同步失败时仍带上仓库（含 last_error），状态码为 502
+func writeRepo(w http.ResponseWriter, repo repos.Repo, err error) {
+	switch {
+	case err == nil:
+		writeJSON(w, map[string]any{"item": repo})
+	case errors.Is(err, repos.ErrSyncFailed):
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadGateway)
+		_ = json.NewEncoder(w).Encode(map[string]any{"error": err.Error(), "item": repo})
+	case errors.Is(err, repos.ErrRepoNotFound), errors.Is(err, repos.ErrWorkspaceNotFound):
+		writeJSONError(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, repos.ErrInvalidRemote), errors.Is(err, repos.ErrInvalidKey):
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, repos.ErrNoSecretKey):
+		writeJSONError(w, err.Error(), http.StatusServiceUnavailable)
+	default:
+		writeJSONError(w, "db", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,397 @@
+// Package worktrees gives each workflow run its own git worktree and branch,
+// cut from the workspace's default branch and kept for the whole run so its
+// steps build on each other and the result can be inspected afterwards.
+// Worktrees of finished runs are pruned by age and by a disk quota; their
+// branches are kept.
+package worktrees
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PonyDevAI/Bull-Board/internal/common"
+)
+
+// Worktree statuses.
+const (
+	StatusActive = "active"
+	StatusPruned = "pruned"
+)
+
+const (
+	// DefaultBranchPattern names run branches when the config does not.
+	DefaultBranchPattern = "bb/run-{run_id}"
+	// DefaultKeepFinished is how long a finished run's worktree is kept.
+	DefaultKeepFinished = 72 * time.Hour
+	// PruneInterval is how often the background pruner runs.
+	PruneInterval = 10 * time.Minute
+)
+
+var (
+	ErrWorktreeNotFound = errors.New("worktree not found")
+	ErrInvalidBranch    = errors.New("invalid worktree branch name")
+)
+
+// Worktree is a run_worktrees row.
+type Worktree struct {
+	WorkflowRunID string `json:"workflow_run_id"`
+	RepoPath      string `json:"repo_path"`
+	Path          string `json:"path"`
+	Branch        string `json:"branch"`
+	BaseBranch    string `json:"base_branch"`
+	BaseCommit    string `json:"base_commit"`
+	Head          string `json:"head"`
+	Status        string `json:"status"`
+	SizeBytes     int64  `json:"size_bytes"`
+	CreatedAt     string `json:"created_at"`
+	UpdatedAt     string `json:"updated_at"`
+	PrunedAt      string `json:"pruned_at,omitempty"`
+}
+
+// Manager creates, tracks and prunes run worktrees under <dataDir>/worktrees.
+// Without a database it only manages the checkouts; nothing is recorded and
+// the branch pattern variables other than the run id are empty.
+type Manager struct {
+	db     *sql.DB
+	root   string
+	policy common.WorktreeConfig
+	mu     sync.Mutex
+}
+
+func NewManager(db *sql.DB, dataDir string, policy common.WorktreeConfig) *Manager {
+	return &Manager{db: db, root: filepath.Join(dataDir, "worktrees"), policy: policy}
+}
+
+// Root returns the directory holding the worktrees.
+func (m *Manager) Root() string { return m.root }
+
+// BranchName expands a branch pattern. Variables are {run_id}, {short_id}
+// (the first 8 characters of the run id), {task_id} and {workspace_id}.
+func BranchName(pattern string, vars map[string]string) string {
+	if pattern == "" {
+		pattern = DefaultBranchPattern
+	}
+	runID := vars["run_id"]
+	short := runID
+	if len(short) > 8 {
+		short = short[:8]
+	}
+	return strings.NewReplacer(
+		"{run_id}", runID,
+		"{short_id}", short,
+		"{task_id}", vars["task_id"],
+		"{workspace_id}", vars["workspace_id"],
+	).Replace(pattern)
+}
+
+func timestamp() string { return time.Now().UTC().Format(time.RFC3339) }
+
+// Ensure returns the run's worktree, creating it and its branch from
+// baseBranch of repoPath on first use. A pruned worktree is checked out
+// again from its branch.
+func (m *Manager) Ensure(ctx context.Context, runID, repoPath, baseBranch string) (Worktree, error) {
+	if runID == "" || strings.ContainsAny(runID, `/\`) || runID == "." || runID == ".." {
+		return Worktree{}, fmt.Errorf("invalid workflow run id %q", runID)
+	}
+	if repoPath == "" {
+		return Worktree{}, errors.New("workspace repo_path is not configured")
+	}
+	if baseBranch == "" {
+		baseBranch = "main"
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	wt, err := m.get(runID)
+	if errors.Is(err, ErrWorktreeNotFound) {
+		wt = Worktree{WorkflowRunID: runID, RepoPath: repoPath, Path: filepath.Join(m.root, runID), BaseBranch: baseBranch, CreatedAt: timestamp()}
+		if wt.Branch, err = m.branchFor(runID); err != nil {
+			return wt, err
+		}
+	} else if err != nil {
+		return wt, err
+	}
+	if wt.Status == StatusActive && isWorktree(ctx, wt.Path) {
+		return wt, nil
+	}
+	if err := m.checkout(ctx, &wt); err != nil {
+		return wt, err
+	}
+	wt.Status, wt.PrunedAt, wt.UpdatedAt = StatusActive, "", timestamp()
+	wt.Head = headCommit(ctx, wt.Path)
+	if wt.BaseCommit == "" {
+		wt.BaseCommit = wt.Head
+	}
+	return wt, m.save(wt)
+}
+
+// branchFor expands the configured pattern for a run.
+func (m *Manager) branchFor(runID string) (string, error) {
+	vars := map[string]string{"run_id": runID}
+	if m.db != nil {
+		var taskID, workspaceID string
+		err := m.db.QueryRow(`SELECT COALESCE(task_id,''), workspace_id FROM workflow_runs WHERE id = ?`, runID).Scan(&taskID, &workspaceID)
+		if err != nil && err != sql.ErrNoRows {
+			return "", err
+		}
+		vars["task_id"], vars["workspace_id"] = taskID, workspaceID
+	}
+	branch := BranchName(m.policy.BranchPattern, vars)
+	if !validBranch(branch) {
+		return "", fmt.Errorf("%w: %q from pattern %q", ErrInvalidBranch, branch, m.policy.BranchPattern)
+	}
+	return branch, nil
+}
+
+func (m *Manager) checkout(ctx context.Context, wt *Worktree) error {
+	if err := os.MkdirAll(m.root, 0755); err != nil {
+		return err
+	}
+	// A directory left behind by an interrupted checkout or a manual
+	// removal of the .git link is not a worktree git will reuse.
+	if _, err := os.Stat(wt.Path); err == nil {
+		if err := os.RemoveAll(wt.Path); err != nil {
+			return err
+		}
+	}
+	_, _ = git(ctx, wt.RepoPath, "worktree", "prune")
+	if branchExists(ctx, wt.RepoPath, wt.Branch) {
+		_, err := git(ctx, wt.RepoPath, "worktree", "add", wt.Path, wt.Branch)
+		return err
+	}
+	_, err := git(ctx, wt.RepoPath, "worktree", "add", "-b", wt.Branch, wt.Path, wt.BaseBranch)
+	return err
+}
+
+// RecordHead notes the commit a job left the run's worktree at.
+func (m *Manager) RecordHead(runID, head string) {
+	if m.db == nil || head == "" {
+		return
+	}
+	if _, err := m.db.Exec(`UPDATE run_worktrees SET head = ?, updated_at = ? WHERE workflow_run_id = ?`, head, timestamp(), runID); err != nil {
+		slog.Warn("worktrees: record head", "workflow_run_id", runID, "err", err)
+	}
+}
+
+// Get returns a run's worktree.
+func (m *Manager) Get(runID string) (Worktree, error) {
+	return m.get(runID)
+}
+
+func (m *Manager) get(runID string) (Worktree, error) {
+	if m.db == nil {
+		return Worktree{}, ErrWorktreeNotFound
+	}
+	items, err := m.query(`WHERE workflow_run_id = ?`, runID)
+	if err != nil {
+		return Worktree{}, err
+	}
+	if len(items) == 0 {
+		return Worktree{}, ErrWorktreeNotFound
+	}
+	return items[0], nil
+}
+
+func (m *Manager) query(where string, args ...any) ([]Worktree, error) {
+	rows, err := m.db.Query(`SELECT workflow_run_id, repo_path, path, branch, base_branch, base_commit, head, status, size_bytes, created_at, updated_at, COALESCE(pruned_at,'') FROM run_worktrees `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Worktree{}
+	for rows.Next() {
+		var w Worktree
+		if err := rows.Scan(&w.WorkflowRunID, &w.RepoPath, &w.Path, &w.Branch, &w.BaseBranch, &w.BaseCommit, &w.Head, &w.Status, &w.SizeBytes, &w.CreatedAt, &w.UpdatedAt, &w.PrunedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, w)
+	}
+	return items, rows.Err()
+}
+
+func (m *Manager) save(w Worktree) error {
+	if m.db == nil {
+		return nil
+	}
+	var prunedAt any
+	if w.PrunedAt != "" {
+		prunedAt = w.PrunedAt
+	}
+	_, err := m.db.Exec(`INSERT INTO run_worktrees (workflow_run_id, repo_path, path, branch, base_branch, base_commit, head, status, size_bytes, created_at, updated_at, pruned_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(workflow_run_id) DO UPDATE SET repo_path = excluded.repo_path, path = excluded.path, branch = excluded.branch, base_branch = excluded.base_branch,
+			base_commit = excluded.base_commit, head = excluded.head, status = excluded.status, size_bytes = excluded.size_bytes, updated_at = excluded.updated_at, pruned_at = excluded.pruned_at`,
+		w.WorkflowRunID, w.RepoPath, w.Path, w.Branch, w.BaseBranch, w.BaseCommit, w.Head, w.Status, w.SizeBytes, w.CreatedAt, w.UpdatedAt, prunedAt)
+	return err
+}
+
+// PruneReport is what a prune pass removed.
+type PruneReport struct {
+	Pruned     []string `json:"pruned"`
+	BytesFreed int64    `json:"bytes_freed"`
+	// DiskBytes is what the remaining worktrees take up.
+	DiskBytes int64 `json:"disk_bytes"`
+}
+
+// candidate is an active worktree with the state of its run.
+type candidate struct {
+	Worktree
+	finished   bool
+	finishedAt time.Time
+}
+
+// Prune removes worktrees of finished runs kept longer than the policy
+// allows, then, while the worktrees together exceed MaxDiskMB, those of the
+// runs that finished first. Worktrees of runs still in progress are never
+// removed, even over the quota. A run deleted by retention counts as
+// finished.
+func (m *Manager) Prune(ctx context.Context, at time.Time) (PruneReport, error) {
+	var rep PruneReport
+	if m.db == nil {
+		return rep, nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cands, err := m.candidates()
+	if err != nil {
+		return rep, err
+	}
+	keep := DefaultKeepFinished
+	if m.policy.KeepFinishedHours != 0 {
+		keep = time.Duration(m.policy.KeepFinishedHours) * time.Hour
+	}
+	var remaining []candidate
+	for _, c := range cands {
+		c.SizeBytes = dirSize(c.Path)
+		if c.finished && keep >= 0 && at.Sub(c.finishedAt) >= keep {
+			m.prune(ctx, c.Worktree, &rep)
+			continue
+		}
+		rep.DiskBytes += c.SizeBytes
+		remaining = append(remaining, c)
+		if _, err := m.db.Exec(`UPDATE run_worktrees SET size_bytes = ? WHERE workflow_run_id = ?`, c.SizeBytes, c.WorkflowRunID); err != nil {
+			return rep, err
+		}
+	}
+	defer m.forgetDeleted()
+	quota := m.policy.MaxDiskMB << 20
+	if m.policy.MaxDiskMB <= 0 || rep.DiskBytes <= quota {
+		return rep, nil
+	}
+	sort.SliceStable(remaining, func(i, j int) bool { return remaining[i].finishedAt.Before(remaining[j].finishedAt) })
+	for _, c := range remaining {
+		if rep.DiskBytes <= quota || ctx.Err() != nil {
+			break
+		}
+		if !c.finished {
+			continue
+		}
+		m.prune(ctx, c.Worktree, &rep)
+		rep.DiskBytes -= c.SizeBytes
+	}
+	return rep, nil
+}
+
+func (m *Manager) candidates() ([]candidate, error) {
+	rows, err := m.db.Query(`SELECT w.workflow_run_id, w.repo_path, w.path, w.branch, w.updated_at, COALESCE(r.status,''), COALESCE(r.finished_at, r.updated_at, w.updated_at),
+		EXISTS (SELECT 1 FROM step_runs sr JOIN jobs j ON j.step_run_id = sr.id WHERE sr.workflow_run_id = w.workflow_run_id AND j.status IN ('queued','running','cancelling'))
+		FROM run_worktrees w LEFT JOIN workflow_runs r ON r.id = w.workflow_run_id WHERE w.status = ?`, StatusActive)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []candidate
+	for rows.Next() {
+		var c candidate
+		var runStatus, finishedAt string
+		var activeJobs bool
+		if err := rows.Scan(&c.WorkflowRunID, &c.RepoPath, &c.Path, &c.Branch, &c.UpdatedAt, &runStatus, &finishedAt, &activeJobs); err != nil {
+			return nil, err
+		}
+		switch runStatus {
+		case "completed", "failed", "cancelled", "":
+			c.finished = !activeJobs
+		}
+		c.finishedAt = parseTime(finishedAt)
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// forgetDeleted drops pruned rows whose run retention has deleted.
+func (m *Manager) forgetDeleted() {
+	if _, err := m.db.Exec(`DELETE FROM run_worktrees WHERE status = ? AND workflow_run_id NOT IN (SELECT id FROM workflow_runs)`, StatusPruned); err != nil {
+		slog.Warn("worktrees: forget deleted runs", "err", err)
+	}
+}
+
+// prune removes the checkout but keeps the branch, so the run's commits stay
+// reachable and the worktree can be checked out again.
+func (m *Manager) prune(ctx context.Context, w Worktree, rep *PruneReport) {
+	if _, err := git(ctx, w.RepoPath, "worktree", "remove", "--force", w.Path); err != nil {
+		if err := os.RemoveAll(w.Path); err != nil {
+			slog.Warn("worktrees: remove", "path", w.Path, "err", err)
+			return
+		}
+		_, _ = git(ctx, w.RepoPath, "worktree", "prune")
+	}
+	ts := timestamp()
+	if _, err := m.db.Exec(`UPDATE run_worktrees SET status = ?, size_bytes = 0, pruned_at = ?, updated_at = ? WHERE workflow_run_id = ?`, StatusPruned, ts, ts, w.WorkflowRunID); err != nil {
+		slog.Warn("worktrees: mark pruned", "workflow_run_id", w.WorkflowRunID, "err", err)
+	}
+	rep.Pruned = append(rep.Pruned, w.WorkflowRunID)
+	rep.BytesFreed += w.SizeBytes
+}
+
+// RunPrunes prunes every interval until ctx is done.
+func (m *Manager) RunPrunes(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		rep, err := m.Prune(ctx, time.Now().UTC())
+		if err != nil {
+			slog.Warn("worktrees: prune", "err", err)
+			continue
+		}
+		if len(rep.Pruned) > 0 {
+			slog.Info("worktrees: pruned", "count", len(rep.Pruned), "bytes_freed", rep.BytesFreed)
+		}
+	}
+}
+
+// dirSize sums the regular files under dir.
+func dirSize(dir string) int64 {
+	var n int64
+	_ = filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && info.Mode().IsRegular() {
+			n += info.Size()
+		}
+		return nil
+	})
+	return n
+}
+
+// parseTime reads RFC 3339 and SQLite datetime('now') timestamps.
+func parseTime(s string) time.Time {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t
+	}
+	t, _ := time.Parse("2006-01-02 15:04:05", s)
+	return t
+}
@@ -0,0 +1,191 @@
+package worktrees
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PonyDevAI/Bull-Board/internal/common"
+)
+
+func testDB(t *testing.T) *sql.DB {
+	t.Helper()
+	t.Setenv("SQLITE_PATH", filepath.Join(t.TempDir(), "bb.sqlite"))
+	db, _, err := common.OpenDB("")
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	return db
+}
+
+func mustGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	out, err := git(context.Background(), dir, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(out)
+}
+
+// testRepo creates a repository with one commit on main.
+func testRepo(t *testing.T) string {
+	t.Helper()
+	t.Setenv("GIT_AUTHOR_NAME", "test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+	repo := t.TempDir()
+	mustGit(t, repo, "init", "-b", "main")
+	writeFile(t, filepath.Join(repo, "README.md"), 6)
+	mustGit(t, repo, "add", "-A")
+	mustGit(t, repo, "commit", "-m", "init")
+	return repo
+}
+
+func writeFile(t *testing.T, path string, size int) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(strings.Repeat("x", size)), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+var now = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func seedRun(t *testing.T, db *sql.DB, id, status string, finishedAgo time.Duration) {
+	t.Helper()
+	var finishedAt any
+	if finishedAgo > 0 {
+		finishedAt = now.Add(-finishedAgo).Format(time.RFC3339)
+	}
+	if _, err := db.Exec(`INSERT INTO workflow_runs (id, workspace_id, workflow_template_id, task_id, status, finished_at, created_at, updated_at) VALUES (?, 'ws', 'tpl', 'task-1', ?, ?, ?, ?)`,
+		id, status, finishedAt, now.Format(time.RFC3339), now.Format(time.RFC3339)); err != nil {
+		t.Fatalf("insert run: %v", err)
+	}
+}
+
+func TestEnsureKeepsWorktreeAcrossSteps(t *testing.T) {
+	db := testDB(t)
+	repo := testRepo(t)
+	base := mustGit(t, repo, "rev-parse", "HEAD")
+	m := NewManager(db, t.TempDir(), common.WorktreeConfig{BranchPattern: "bb/{task_id}/{short_id}"})
+	ctx := context.Background()
+	seedRun(t, db, "0123456789abcdef", "running", 0)
+
+	wt, err := m.Ensure(ctx, "0123456789abcdef", repo, "")
+	if err != nil {
+		t.Fatalf("ensure: %v", err)
+	}
+	if wt.Branch != "bb/task-1/01234567" || wt.Path != filepath.Join(m.Root(), "0123456789abcdef") || wt.BaseBranch != "main" || wt.BaseCommit != base || wt.Status != StatusActive {
+		t.Fatalf("created %+v", wt)
+	}
+
+	// A step commits; the next step sees the same checkout.
+	writeFile(t, filepath.Join(wt.Path, "step.txt"), 3)
+	mustGit(t, wt.Path, "add", "-A")
+	mustGit(t, wt.Path, "commit", "-m", "step 1")
+	head := mustGit(t, wt.Path, "rev-parse", "HEAD")
+	m.RecordHead(wt.WorkflowRunID, head)
+	again, err := m.Ensure(ctx, "0123456789abcdef", repo, "main")
+	if err != nil {
+		t.Fatalf("ensure again: %v", err)
+	}
+	if again.Path != wt.Path || again.Head != head || again.BaseCommit != base {
+		t.Fatalf("reused %+v, want head %s", again, head)
+	}
+
+	// A pruned worktree comes back from its branch.
+	if _, err := m.Prune(ctx, now); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`UPDATE workflow_runs SET status = 'completed', finished_at = ?`, now.Add(-100*time.Hour).Format(time.RFC3339)); err != nil {
+		t.Fatal(err)
+	}
+	rep, err := m.Prune(ctx, now)
+	if err != nil || len(rep.Pruned) != 1 {
+		t.Fatalf("prune %+v, %v", rep, err)
+	}
+	if _, err := os.Stat(wt.Path); !os.IsNotExist(err) {
+		t.Fatalf("worktree still on disk: %v", err)
+	}
+	again, err = m.Ensure(ctx, "0123456789abcdef", repo, "main")
+	if err != nil {
+		t.Fatalf("recreate: %v", err)
+	}
+	if again.Status != StatusActive || again.Head != head || again.PrunedAt != "" {
+		t.Fatalf("recreated %+v, want head %s", again, head)
+	}
+}
+
+func TestEnsureRejectsInvalidBranch(t *testing.T) {
+	m := NewManager(nil, t.TempDir(), common.WorktreeConfig{BranchPattern: "bb/{run_id}..x"})
+	if _, err := m.Ensure(context.Background(), "run-1", testRepo(t), "main"); !errors.Is(err, ErrInvalidBranch) {
+		t.Fatalf("expected ErrInvalidBranch, got %v", err)
+	}
+	if _, err := m.Ensure(context.Background(), "../x", t.TempDir(), "main"); err == nil {
+		t.Fatal("accepted a run id outside the worktree root")
+	}
+}
+
+func TestPruneByAgeThenQuota(t *testing.T) {
+	db := testDB(t)
+	repo := testRepo(t)
+	m := NewManager(db, t.TempDir(), common.WorktreeConfig{KeepFinishedHours: 72, MaxDiskMB: 1})
+	ctx := context.Background()
+	runs := []struct {
+		id, status string
+		finished   time.Duration
+		size       int
+	}{
+		{"running", "running", 0, 512 << 10},
+		{"old", "completed", 100 * time.Hour, 0},
+		{"big", "failed", 10 * time.Hour, 768 << 10},
+		{"recent", "cancelled", 5 * time.Hour, 0},
+	}
+	for _, r := range runs {
+		seedRun(t, db, r.id, r.status, r.finished)
+		wt, err := m.Ensure(ctx, r.id, repo, "main")
+		if err != nil {
+			t.Fatalf("ensure %s: %v", r.id, err)
+		}
+		if r.size > 0 {
+			writeFile(t, filepath.Join(wt.Path, "blob.bin"), r.size)
+		}
+	}
+
+	rep, err := m.Prune(ctx, now)
+	if err != nil {
+		t.Fatalf("prune: %v", err)
+	}
+	if strings.Join(rep.Pruned, ",") != "old,big" || rep.BytesFreed < 768<<10 {
+		t.Fatalf("pruned %+v", rep)
+	}
+	for id, want := range map[string]string{"running": StatusActive, "old": StatusPruned, "big": StatusPruned, "recent": StatusActive} {
+		wt, err := m.Get(id)
+		if err != nil || wt.Status != want {
+			t.Errorf("%s: %+v, %v; want %s", id, wt, err, want)
+		}
+		if _, err := os.Stat(wt.Path); (err == nil) != (want == StatusActive) {
+			t.Errorf("%s: on disk %v, want status %s", id, err == nil, want)
+		}
+		if !branchExists(ctx, repo, "bb/run-"+id) {
+			t.Errorf("%s: branch removed", id)
+		}
+	}
+
+	// Once retention deletes a pruned run its row goes too.
+	if _, err := db.Exec(`DELETE FROM workflow_runs WHERE id = 'old'`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Prune(ctx, now); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Get("old"); !errors.Is(err, ErrWorktreeNotFound) {
+		t.Fatalf("pruned row of deleted run: %v", err)
+	}
+}
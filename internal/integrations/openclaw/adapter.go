@@ -1,6 +1,10 @@
 package openclaw
 
-import "context"
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
 
 type TaskPayload struct {
 	WorkerID string         `json:"worker_id"`
@@ -96,3 +100,20 @@ func (a *Adapter) ExecutePreparedDispatch(ctx context.Context, prepared Prepared
 		}},
 	}, nil
 }
+
+// Ping checks that the OpenClaw endpoint answers HTTP; any non-5xx response counts as reachable.
+func (a *Adapter) Ping(ctx context.Context, endpointURL string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpointURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("openclaw endpoint returned %s", resp.Status)
+	}
+	return nil
+}
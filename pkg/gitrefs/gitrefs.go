@@ -0,0 +1,109 @@
+// Package gitrefs reads, classifies and restores the branches of a git
+// repository. Branch protection uses it both in the hooks of step commands
+// and to compare the branches before and after each command, which also
+// catches updates that went around the hooks.
+package gitrefs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Operations a branch update is classified as.
+const (
+	OpPush      = "push"
+	OpForcePush = "force_push"
+	OpMerge     = "merge"
+	OpCommit    = "commit"
+)
+
+// Branches returns the commit of every local branch of the repository dir is
+// in, by branch name. Worktrees of one repository share their branches.
+func Branches(ctx context.Context, dir string) (map[string]string, error) {
+	out, err := gitOut(ctx, dir, "for-each-ref", "--format=%(objectname) %(refname)", "refs/heads/")
+	if err != nil {
+		return nil, fmt.Errorf("list branches: %w", err)
+	}
+	branches := map[string]string{}
+	for _, line := range strings.Split(out, "\n") {
+		oid, ref, ok := strings.Cut(line, " ")
+		if ok {
+			branches[strings.TrimPrefix(ref, "refs/heads/")] = oid
+		}
+	}
+	return branches, nil
+}
+
+// Classify names the operation that moves a branch from old to new, run in
+// dir ("" for the current directory). Deleting a branch or moving it to a
+// commit that does not contain the old one rewrites history and counts as a
+// force push; bringing in a merge commit is a merge; anything else is a
+// commit locally and a push remotely. It is "" when the branch did not move.
+func Classify(ctx context.Context, dir, old, new string, local bool) string {
+	switch {
+	case old == new:
+		return ""
+	case IsZero(new):
+		return OpForcePush
+	case IsZero(old):
+		if local {
+			return OpCommit
+		}
+		return OpPush
+	case !isAncestor(ctx, dir, old, new):
+		return OpForcePush
+	}
+	if n, _ := gitOut(ctx, dir, "rev-list", "--min-parents=2", "--count", old+".."+new); n != "" && n != "0" {
+		return OpMerge
+	}
+	if local {
+		return OpCommit
+	}
+	return OpPush
+}
+
+// Restore moves branch back from new to old, creating it again when old is
+// zero or "" and deleting it when it did not exist. It fails if the branch
+// is no longer at new. Hooks are not run, so a restore is never refused.
+func Restore(ctx context.Context, dir, branch, old, new string) error {
+	ref := "refs/heads/" + branch
+	args := []string{"-c", "core.hooksPath=/dev/null", "update-ref", "-m", "bb: restore protected branch"}
+	switch {
+	case IsZero(old):
+		args = append(args, "-d", ref, new)
+	case IsZero(new):
+		args = append(args, ref, old, strings.Repeat("0", len(old)))
+	default:
+		args = append(args, ref, old, new)
+	}
+	if _, err := gitOut(ctx, dir, args...); err != nil {
+		return fmt.Errorf("restore branch %q: %w", branch, err)
+	}
+	return nil
+}
+
+// IsZero reports whether oid names no commit: git's all-zero id, or "".
+func IsZero(oid string) bool { return strings.Trim(oid, "0") == "" }
+
+// isAncestor is false also when old is not in the repository, which for a
+// push means the remote has commits the pushed branch does not contain.
+func isAncestor(ctx context.Context, dir, old, new string) bool {
+	cmd := exec.CommandContext(ctx, "git", "merge-base", "--is-ancestor", old, new)
+	cmd.Dir = dir
+	return cmd.Run() == nil
+}
+
+func gitOut(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil && stderr.Len() > 0 {
+		err = fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(string(out)), err
+}
@@ -0,0 +1,82 @@
+package gitrefs
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func testRepo(t *testing.T) (string, func(args ...string) string) {
+	t.Helper()
+	dir := t.TempDir()
+	env := append(os.Environ(), "GIT_AUTHOR_NAME=t", "GIT_AUTHOR_EMAIL=t@example.test", "GIT_COMMITTER_NAME=t", "GIT_COMMITTER_EMAIL=t@example.test")
+	git := func(args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir, cmd.Env = dir, env
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	git("init", "-q", "-b", "main")
+	git("commit", "-q", "--allow-empty", "-m", "init")
+	return dir, git
+}
+
+func TestClassifyAndRestore(t *testing.T) {
+	ctx := context.Background()
+	dir, git := testRepo(t)
+	base := git("rev-parse", "main")
+	git("checkout", "-q", "-b", "side")
+	git("commit", "-q", "--allow-empty", "-m", "side")
+	side := git("rev-parse", "HEAD")
+	git("checkout", "-q", "main")
+	git("commit", "-q", "--allow-empty", "-m", "main")
+	ahead := git("rev-parse", "HEAD")
+	git("merge", "-q", "--no-ff", "-m", "merge", "side")
+	merged := git("rev-parse", "HEAD")
+
+	for _, c := range []struct {
+		old, new string
+		local    bool
+		want     string
+	}{
+		{base, base, true, ""},
+		{base, ahead, true, OpCommit},
+		{base, ahead, false, OpPush},
+		{"", ahead, true, OpCommit},
+		{ahead, "", true, OpForcePush},
+		{side, ahead, true, OpForcePush},
+		{ahead, merged, true, OpMerge},
+	} {
+		if got := Classify(ctx, dir, c.old, c.new, c.local); got != c.want {
+			t.Errorf("Classify(%.7s, %.7s, %v) = %q, want %q", c.old, c.new, c.local, got, c.want)
+		}
+	}
+
+	branches, err := Branches(ctx, dir)
+	if err != nil || branches["main"] != merged || branches["side"] != side || len(branches) != 2 {
+		t.Fatalf("Branches = %v, %v", branches, err)
+	}
+	if err := Restore(ctx, dir, "main", base, merged); err != nil || git("rev-parse", "main") != base {
+		t.Fatalf("moving main back: %v", err)
+	}
+	if err := Restore(ctx, dir, "main", ahead, merged); err == nil {
+		t.Fatalf("restored a branch that moved again")
+	}
+	git("branch", "new")
+	if err := Restore(ctx, dir, "new", "", base); err != nil {
+		t.Fatalf("deleting a created branch: %v", err)
+	}
+	git("branch", "-D", "side")
+	if err := Restore(ctx, dir, "side", side, ""); err != nil || git("rev-parse", "side") != side {
+		t.Fatalf("recreating a deleted branch: %v", err)
+	}
+	if branches, _ := Branches(ctx, dir); len(branches) != 2 {
+		t.Fatalf("branches after restores: %v", branches)
+	}
+}
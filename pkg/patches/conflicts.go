@@ -0,0 +1,124 @@
+package patches
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// stages are the blobs of an unmerged path: 1 the patch's preimage, 2 the
+// work tree's version, 3 the patch's result.
+type stages [4]string
+
+// conflicts reads the unmerged entries a 3-way apply left in the scratch
+// index and merges each path again with diff3 markers to find its
+// conflicting regions.
+func conflicts(ctx context.Context, dir, tmp, unmerged string) (map[string][]Conflict, error) {
+	paths := map[string]*stages{}
+	var order []string
+	for _, entry := range strings.Split(strings.TrimSuffix(unmerged, "\x00"), "\x00") {
+		meta, path, ok := strings.Cut(entry, "\t")
+		fields := strings.Fields(meta)
+		if !ok || len(fields) != 3 {
+			continue
+		}
+		st, ok := paths[path]
+		if !ok {
+			st = &stages{}
+			paths[path] = st
+			order = append(order, path)
+		}
+		switch fields[2] {
+		case "1", "2", "3":
+			st[fields[2][0]-'0'] = fields[1]
+		}
+	}
+	out := map[string][]Conflict{}
+	for i, path := range order {
+		files := make([]string, 4)
+		for stage := 1; stage <= 3; stage++ {
+			files[stage] = filepath.Join(tmp, fmt.Sprintf("merge-%d-%d", i, stage))
+			var data []byte
+			if sha := paths[path][stage]; sha != "" {
+				blob, err := gitRun(ctx, dir, nil, "cat-file", "blob", sha)
+				if err != nil {
+					return nil, fmt.Errorf("read %s: %s", path, blob)
+				}
+				data = []byte(blob)
+			}
+			if err := os.WriteFile(files[stage], data, 0600); err != nil {
+				return nil, err
+			}
+		}
+		merged, err := mergeFile(ctx, dir, files[2], files[1], files[3])
+		if err != nil {
+			return nil, err
+		}
+		out[path] = parseConflicts(merged)
+	}
+	return out, nil
+}
+
+// mergeFile prints the diff3 merge of current and patch against base. Its
+// exit status is the number of conflicts, so only a signal or a status of
+// 128 or more is a failure.
+func mergeFile(ctx context.Context, dir, current, base, patch string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", "merge-file", "-p", "--diff3",
+		"-L", "current", "-L", "base", "-L", "patch", current, base, patch)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	var exit *exec.ExitError
+	if errors.As(err, &exit) && exit.ExitCode() > 0 && exit.ExitCode() < 128 {
+		err = nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("git merge-file: %w", err)
+	}
+	return string(out), nil
+}
+
+// parseConflicts reads the regions between diff3 markers. StartLine counts
+// lines of the current file, not of the merged output.
+func parseConflicts(merged string) []Conflict {
+	const (
+		outside = iota
+		current
+		base
+		patch
+	)
+	var out []Conflict
+	var c *Conflict
+	state, line := outside, 0
+	sc := bufio.NewScanner(strings.NewReader(merged))
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		l := sc.Text()
+		switch {
+		case state == outside && strings.HasPrefix(l, "<<<<<<< "):
+			out = append(out, Conflict{StartLine: line + 1})
+			c, state = &out[len(out)-1], current
+		case state == current && strings.HasPrefix(l, "||||||| "):
+			state = base
+		case (state == current || state == base) && l == "=======":
+			state = patch
+		case state == patch && strings.HasPrefix(l, ">>>>>>> "):
+			c.Current, c.Base, c.Patch = trim(c.Current), trim(c.Base), trim(c.Patch)
+			state = outside
+		case state == current:
+			c.Current += l + "\n"
+			line++
+		case state == base:
+			c.Base += l + "\n"
+		case state == patch:
+			c.Patch += l + "\n"
+		default:
+			line++
+		}
+	}
+	return out
+}
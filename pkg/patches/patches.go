@@ -0,0 +1,376 @@
+// Package patches applies patches to a work tree: strictly first, then as a
+// 3-way merge against the blobs the patch was made from. A patch that does
+// not apply leaves the tree untouched and yields a report of which files and
+// hunks failed and why, with the conflicting regions of a 3-way merge, for a
+// later step to repair the patch from. Binary patches, renames, copies and
+// mode changes are applied by git as they come.
+package patches
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/PonyDevAI/Bull-Board/internal/console/diffs"
+)
+
+// Methods that applied a patch.
+const (
+	MethodStrict   = "strict"
+	MethodThreeWay = "three_way"
+)
+
+// File results.
+const (
+	ResultApplied  = "applied"
+	ResultClean    = "clean" // would apply, but another file of the patch did not
+	ResultConflict = "conflict"
+	ResultRejected = "rejected"
+)
+
+// Failure reasons.
+const (
+	ReasonContextMismatch = "context_mismatch" // the lines a hunk expects are not there
+	ReasonMissingFile     = "missing_file"     // the file to change or delete does not exist
+	ReasonFileExists      = "file_exists"      // the file to create already exists
+	ReasonBinaryNoIndex   = "binary_no_index"  // a binary patch without full index lines
+	ReasonBinaryMismatch  = "binary_mismatch"  // the binary file is not the one the patch was made from
+	ReasonTypeMismatch    = "type_mismatch"    // e.g. a symlink where the patch expects a file
+	ReasonMalformed       = "malformed"
+	ReasonConflict        = "conflict" // the 3-way merge conflicted
+	ReasonOther           = "error"
+)
+
+// maxMessage bounds the git output kept per file or hunk.
+const maxMessage = 2000
+
+// Report is the outcome of applying a patch.
+type Report struct {
+	Applied bool   `json:"applied"`
+	Method  string `json:"method,omitempty"`
+	Summary string `json:"summary"`
+	// ThreeWay is why the 3-way merge could not be attempted or failed
+	// other than by conflicts, e.g. missing preimage blobs.
+	ThreeWay string       `json:"three_way_error,omitempty"`
+	Files    []FileReport `json:"files"`
+}
+
+// FileReport is one file of the patch.
+type FileReport struct {
+	Path      string       `json:"path"`
+	OldPath   string       `json:"old_path,omitempty"`
+	Status    string       `json:"status"`
+	Binary    bool         `json:"binary,omitempty"`
+	OldMode   string       `json:"old_mode,omitempty"`
+	NewMode   string       `json:"new_mode,omitempty"`
+	Result    string       `json:"result"`
+	Reason    string       `json:"reason,omitempty"`
+	Message   string       `json:"message,omitempty"`
+	Hunks     []HunkReport `json:"hunks,omitempty"`
+	Conflicts []Conflict   `json:"conflicts,omitempty"`
+}
+
+// HunkReport tells whether a hunk applies on its own.
+type HunkReport struct {
+	Index    int    `json:"index"`
+	Header   string `json:"header"`
+	OldStart int    `json:"old_start"`
+	OldLines int    `json:"old_lines"`
+	NewStart int    `json:"new_start"`
+	NewLines int    `json:"new_lines"`
+	Applies  bool   `json:"applies"`
+	Reason   string `json:"reason,omitempty"`
+	Message  string `json:"message,omitempty"`
+}
+
+// Conflict is a region the 3-way merge could not resolve. StartLine is where
+// it begins in the current file; Current is what the file has there, Base
+// what the patch was made against and Patch what the patch wants.
+type Conflict struct {
+	StartLine int    `json:"start_line"`
+	Current   string `json:"current"`
+	Base      string `json:"base"`
+	Patch     string `json:"patch"`
+}
+
+// Apply applies patch to the work tree at dir. A patch that does not apply
+// is reported, not returned as an error; err is for failures to run git or
+// to read the tree.
+func Apply(ctx context.Context, dir string, patch []byte) (*Report, error) {
+	text := string(patch)
+	if !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	tmp, err := os.MkdirTemp("", "bb-patch-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+	patchPath := filepath.Join(tmp, "input.patch")
+	if err := os.WriteFile(patchPath, []byte(text), 0600); err != nil {
+		return nil, err
+	}
+	sections := split(text)
+	rep := &Report{Files: describe(sections)}
+	if len(sections) == 0 {
+		rep.Summary = "patch did not apply: no file changes found"
+		return rep, nil
+	}
+
+	if _, err := check(ctx, dir, patchPath); err == nil {
+		if out, err := gitRun(ctx, dir, nil, "apply", "--whitespace=nowarn", "--recount", patchPath); err != nil {
+			return nil, fmt.Errorf("git apply: %s", out)
+		}
+		return rep.applied(MethodStrict), nil
+	}
+
+	conflicts, err := threeWay(ctx, dir, patchPath, tmp, rep)
+	if err != nil {
+		return nil, err
+	}
+	if rep.Applied {
+		return rep, nil
+	}
+	if err := analyze(ctx, dir, tmp, sections, rep, conflicts); err != nil {
+		return nil, err
+	}
+	return rep, nil
+}
+
+func (r *Report) applied(method string) *Report {
+	r.Applied, r.Method = true, method
+	for i := range r.Files {
+		r.Files[i].Result = ResultApplied
+	}
+	r.Summary = fmt.Sprintf("patch applied (%s): %d file(s)", strings.ReplaceAll(method, "_", "-"), len(r.Files))
+	return r
+}
+
+// describe lists the files of a patch as the diff parser sees them.
+func describe(sections []section) []FileReport {
+	files := make([]FileReport, len(sections))
+	for i, s := range sections {
+		d, err := diffs.ParseString(s.text())
+		if err != nil || len(d.Files) == 0 {
+			files[i] = FileReport{Path: headerPath(s.header), Status: diffs.StatusModified}
+			continue
+		}
+		f := d.Files[0]
+		files[i] = FileReport{Path: f.Path(), Status: f.Status, Binary: f.Binary}
+		if f.ModeChanged() {
+			files[i].OldMode, files[i].NewMode = f.OldMode, f.NewMode
+		}
+		if f.OldPath != "" && f.OldPath != f.Path() {
+			files[i].OldPath = f.OldPath
+		}
+	}
+	return files
+}
+
+// headerPath is the best-effort path of a section the diff parser rejected.
+func headerPath(header string) string {
+	first, _, _ := strings.Cut(header, "\n")
+	fields := strings.Fields(first)
+	if len(fields) == 0 {
+		return ""
+	}
+	p := fields[len(fields)-1]
+	for _, prefix := range []string{"a/", "b/"} {
+		p = strings.TrimPrefix(p, prefix)
+	}
+	return p
+}
+
+func check(ctx context.Context, dir, patchPath string) (string, error) {
+	return gitRun(ctx, dir, nil, "apply", "--check", "--whitespace=nowarn", "--recount", patchPath)
+}
+
+// threeWay merges the patch into a copy of the index holding the work tree
+// as it is, so a conflicted merge leaves the tree untouched. A clean merge
+// is checked out into the work tree. It returns the conflicted paths.
+func threeWay(ctx context.Context, dir, patchPath, tmp string, rep *Report) (map[string][]Conflict, error) {
+	index := filepath.Join(tmp, "index")
+	if real, err := gitRun(ctx, dir, nil, "rev-parse", "--path-format=absolute", "--git-path", "index"); err == nil {
+		if data, err := os.ReadFile(strings.TrimSpace(real)); err == nil {
+			if err := os.WriteFile(index, data, 0600); err != nil {
+				return nil, err
+			}
+		}
+	}
+	env := []string{"GIT_INDEX_FILE=" + index}
+	if out, err := gitRun(ctx, dir, env, "add", "-A"); err != nil {
+		return nil, fmt.Errorf("snapshot work tree: %s", out)
+	}
+	out, mergeErr := gitRun(ctx, dir, env, "apply", "--cached", "--3way", "--whitespace=nowarn", "--recount", patchPath)
+	unmerged, err := gitRun(ctx, dir, env, "ls-files", "-u", "-z")
+	if err != nil {
+		return nil, err
+	}
+	if mergeErr == nil && unmerged == "" {
+		if err := checkout(ctx, dir, env, rep.Files); err != nil {
+			return nil, err
+		}
+		rep.applied(MethodThreeWay)
+		return nil, nil
+	}
+	if unmerged == "" {
+		rep.ThreeWay = trim(out)
+		return nil, nil
+	}
+	return conflicts(ctx, dir, tmp, unmerged)
+}
+
+// checkout writes the merged files of the patch from the scratch index into
+// the work tree and removes those the patch deleted or renamed away.
+func checkout(ctx context.Context, dir string, env []string, files []FileReport) error {
+	for _, f := range files {
+		for _, p := range []string{f.OldPath, f.Path} {
+			if p == "" {
+				continue
+			}
+			staged, err := gitRun(ctx, dir, env, "ls-files", "-z", "--", p)
+			if err != nil {
+				return err
+			}
+			if staged != "" {
+				if out, err := gitRun(ctx, dir, env, "checkout-index", "-f", "--", p); err != nil {
+					return fmt.Errorf("checkout %s: %s", p, out)
+				}
+				continue
+			}
+			if err := os.Remove(filepath.Join(dir, filepath.FromSlash(p))); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// analyze fills in why the patch did not apply: each file is checked on its
+// own and, where its context does not match, each of its hunks.
+func analyze(ctx context.Context, dir, tmp string, sections []section, rep *Report, conflicts map[string][]Conflict) error {
+	failed := 0
+	var notes []string
+	for i, s := range sections {
+		f := &rep.Files[i]
+		path := filepath.Join(tmp, fmt.Sprintf("file-%d.patch", i))
+		if err := os.WriteFile(path, []byte(s.text()), 0600); err != nil {
+			return err
+		}
+		out, err := check(ctx, dir, path)
+		regions, conflicted := conflicts[f.Path]
+		switch {
+		case conflicted:
+			f.Result, f.Reason, f.Conflicts = ResultConflict, ReasonConflict, regions
+		case err != nil:
+			f.Result, f.Reason = ResultRejected, classify(out)
+		default:
+			f.Result = ResultClean
+			continue
+		}
+		failed++
+		if err != nil {
+			f.Message = trim(out)
+		}
+		if f.Reason == ReasonConflict {
+			notes = append(notes, fmt.Sprintf("%s: %d conflicting region(s)", f.Path, len(regions)))
+		} else {
+			notes = append(notes, fmt.Sprintf("%s: %s", f.Path, f.Reason))
+		}
+		if err == nil || len(s.hunks) == 0 || (classify(out) != ReasonContextMismatch && !conflicted) {
+			continue
+		}
+		for h := range s.hunks {
+			hr := HunkReport{Index: h + 1, Applies: true}
+			hr.Header, hr.OldStart, hr.OldLines, hr.NewStart, hr.NewLines = hunkRange(s.hunks[h])
+			hpath := filepath.Join(tmp, fmt.Sprintf("file-%d-hunk-%d.patch", i, h))
+			if err := os.WriteFile(hpath, []byte(s.withHunk(h)), 0600); err != nil {
+				return err
+			}
+			if out, err := check(ctx, dir, hpath); err != nil {
+				hr.Applies, hr.Reason, hr.Message = false, classify(out), trim(out)
+			}
+			f.Hunks = append(f.Hunks, hr)
+		}
+	}
+	rep.Summary = fmt.Sprintf("patch did not apply: %d of %d file(s) failed (%s)", failed, len(rep.Files), strings.Join(notes, "; "))
+	if failed == 0 {
+		// Each file applies alone but not together, e.g. two sections
+		// changing the same file.
+		rep.Summary = "patch did not apply: its files apply one by one but not together"
+	}
+	return nil
+}
+
+// classify maps git apply's error output to a reason.
+func classify(out string) string {
+	switch {
+	case strings.Contains(out, "without full index line"):
+		return ReasonBinaryNoIndex
+	case strings.Contains(out, "binary patch does not apply"), strings.Contains(out, "binary patch to"):
+		return ReasonBinaryMismatch
+	case strings.Contains(out, "does not exist in index"), strings.Contains(out, "No such file or directory"), strings.Contains(out, "does not exist"):
+		return ReasonMissingFile
+	case strings.Contains(out, "already exists"):
+		return ReasonFileExists
+	case strings.Contains(out, "wrong type"):
+		return ReasonTypeMismatch
+	case strings.Contains(out, "corrupt patch"), strings.Contains(out, "No valid patches"), strings.Contains(out, "unrecognized input"), strings.Contains(out, "malformed"):
+		return ReasonMalformed
+	case strings.Contains(out, "patch does not apply"), strings.Contains(out, "patch failed"):
+		return ReasonContextMismatch
+	}
+	return ReasonOther
+}
+
+func trim(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) > maxMessage {
+		s = strings.ToValidUTF8(s[:maxMessage], "") + "…"
+	}
+	return s
+}
+
+// Text renders the report for a log or a model: the summary and, for each
+// failed file, its reason, failing hunks and conflicting regions.
+func (r *Report) Text() string {
+	var b strings.Builder
+	b.WriteString(r.Summary + "\n")
+	if r.ThreeWay != "" {
+		fmt.Fprintf(&b, "3-way merge not possible: %s\n", r.ThreeWay)
+	}
+	files := append([]FileReport(nil), r.Files...)
+	sort.SliceStable(files, func(i, j int) bool { return files[i].Result != ResultClean && files[j].Result == ResultClean })
+	for _, f := range files {
+		if f.Result == ResultApplied || f.Result == ResultClean {
+			continue
+		}
+		fmt.Fprintf(&b, "\n%s: %s (%s)\n", f.Path, f.Result, f.Reason)
+		for _, h := range f.Hunks {
+			if !h.Applies {
+				fmt.Fprintf(&b, "  hunk %d %s does not apply: %s\n", h.Index, h.Header, h.Reason)
+			}
+		}
+		for _, c := range f.Conflicts {
+			fmt.Fprintf(&b, "  conflict at line %d\n  current:\n%s  patch:\n%s", c.StartLine, indent(c.Current), indent(c.Patch))
+		}
+		if len(f.Hunks) == 0 && len(f.Conflicts) == 0 && f.Message != "" {
+			fmt.Fprintf(&b, "%s\n", indent(f.Message))
+		}
+	}
+	return b.String()
+}
+
+func indent(s string) string {
+	if s == "" {
+		return ""
+	}
+	lines := strings.SplitAfter(strings.TrimSuffix(s, "\n"), "\n")
+	for i, l := range lines {
+		lines[i] = "    " + l
+	}
+	return strings.Join(lines, "") + "\n"
+}
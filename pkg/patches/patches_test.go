@@ -0,0 +1,237 @@
+package patches
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func mustGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	out, err := gitRun(context.Background(), dir, nil, args...)
+	if err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	return out
+}
+
+// testRepo creates a repository with files committed on main.
+func testRepo(t *testing.T, files map[string]string) string {
+	t.Helper()
+	t.Setenv("GIT_AUTHOR_NAME", "test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+	repo := t.TempDir()
+	mustGit(t, repo, "init", "-b", "main")
+	for name, content := range files {
+		writeFile(t, repo, name, content)
+	}
+	mustGit(t, repo, "add", "-A")
+	mustGit(t, repo, "commit", "-m", "init")
+	return repo
+}
+
+func writeFile(t *testing.T, repo, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(repo, name), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, repo, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(repo, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// diffOf records the changes change makes to the committed tree as a patch
+// and resets the tree.
+func diffOf(t *testing.T, repo string, change func()) []byte {
+	t.Helper()
+	change()
+	mustGit(t, repo, "add", "-A")
+	patch := mustGit(t, repo, "diff", "--cached", "--binary", "-M")
+	mustGit(t, repo, "reset", "--hard", "-q")
+	mustGit(t, repo, "clean", "-fdq")
+	return []byte(patch)
+}
+
+func commitChange(t *testing.T, repo, name, content string) {
+	t.Helper()
+	writeFile(t, repo, name, content)
+	mustGit(t, repo, "commit", "-qam", "change "+name)
+}
+
+func lines(n int, edit map[int]string) string {
+	var b strings.Builder
+	for i := 1; i <= n; i++ {
+		if l, ok := edit[i]; ok {
+			b.WriteString(l + "\n")
+			continue
+		}
+		b.WriteString("line " + string(rune('a'+i-1)) + "\n")
+	}
+	return b.String()
+}
+
+func TestApplyStrict(t *testing.T) {
+	repo := testRepo(t, map[string]string{
+		"main.go":  "package main\n\nfunc main() {}\n",
+		"old.txt":  lines(10, nil),
+		"run.sh":   "echo hi\n",
+		"logo.bin": "\x00\x01\x02\x03",
+	})
+	patch := diffOf(t, repo, func() {
+		writeFile(t, repo, "main.go", "package main\n\nfunc main() { println(1) }\n")
+		if err := os.Rename(filepath.Join(repo, "old.txt"), filepath.Join(repo, "new.txt")); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(filepath.Join(repo, "run.sh"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		writeFile(t, repo, "logo.bin", "\x00\x09\x08\x07\x06")
+	})
+
+	rep, err := Apply(context.Background(), repo, patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rep.Applied || rep.Method != MethodStrict || len(rep.Files) != 4 {
+		t.Fatalf("report = %+v", rep)
+	}
+	byPath := map[string]FileReport{}
+	for _, f := range rep.Files {
+		byPath[f.Path] = f
+	}
+	if f := byPath["new.txt"]; f.Status != "renamed" || f.OldPath != "old.txt" {
+		t.Fatalf("rename = %+v", f)
+	}
+	if f := byPath["run.sh"]; f.OldMode != "100644" || f.NewMode != "100755" {
+		t.Fatalf("mode change = %+v", f)
+	}
+	if f := byPath["logo.bin"]; !f.Binary || f.Result != ResultApplied {
+		t.Fatalf("binary = %+v", f)
+	}
+	if got := readFile(t, repo, "logo.bin"); got != "\x00\x09\x08\x07\x06" {
+		t.Fatalf("logo.bin = %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(repo, "old.txt")); !os.IsNotExist(err) {
+		t.Fatalf("old.txt still there: %v", err)
+	}
+	if info, err := os.Stat(filepath.Join(repo, "run.sh")); err != nil || info.Mode()&0100 == 0 {
+		t.Fatalf("run.sh mode = %v, %v", info.Mode(), err)
+	}
+}
+
+func TestApplyThreeWay(t *testing.T) {
+	repo := testRepo(t, map[string]string{"f.txt": lines(12, nil)})
+	patch := diffOf(t, repo, func() {
+		writeFile(t, repo, "f.txt", lines(12, map[int]string{6: "patched"}))
+	})
+	// The tree moved on under the patch's context but not its change.
+	commitChange(t, repo, "f.txt", lines(12, map[int]string{4: "moved on"}))
+
+	rep, err := Apply(context.Background(), repo, patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rep.Applied || rep.Method != MethodThreeWay {
+		t.Fatalf("report = %+v", rep)
+	}
+	if got, want := readFile(t, repo, "f.txt"), lines(12, map[int]string{4: "moved on", 6: "patched"}); got != want {
+		t.Fatalf("f.txt = %q, want %q", got, want)
+	}
+	// The merge is left in the work tree only, like a strict apply.
+	if out := mustGit(t, repo, "diff", "--cached", "--name-only"); out != "" {
+		t.Fatalf("index changed: %s", out)
+	}
+}
+
+func TestApplyConflictReport(t *testing.T) {
+	repo := testRepo(t, map[string]string{
+		"f.txt":    lines(20, nil),
+		"other.go": "package other\n",
+	})
+	patch := diffOf(t, repo, func() {
+		writeFile(t, repo, "f.txt", lines(20, map[int]string{3: "patched head", 16: "patched tail"}))
+		writeFile(t, repo, "other.go", "package other\n\nconst X = 1\n")
+	})
+	commitChange(t, repo, "f.txt", lines(20, map[int]string{16: "changed tail"}))
+	before := readFile(t, repo, "f.txt")
+
+	rep, err := Apply(context.Background(), repo, patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.Applied {
+		t.Fatalf("conflicting patch applied: %+v", rep)
+	}
+	if readFile(t, repo, "f.txt") != before || readFile(t, repo, "other.go") != "package other\n" {
+		t.Fatal("failed patch changed the work tree")
+	}
+	var f, other FileReport
+	for _, fr := range rep.Files {
+		switch fr.Path {
+		case "f.txt":
+			f = fr
+		case "other.go":
+			other = fr
+		}
+	}
+	if other.Result != ResultClean {
+		t.Fatalf("other.go = %+v", other)
+	}
+	if f.Result != ResultConflict || f.Reason != ReasonConflict || len(f.Conflicts) != 1 {
+		t.Fatalf("f.txt = %+v", f)
+	}
+	c := f.Conflicts[0]
+	if c.StartLine != 16 || c.Current != "changed tail" || c.Base != "line p" || c.Patch != "patched tail" {
+		t.Fatalf("conflict = %+v", c)
+	}
+	if len(f.Hunks) != 2 || !f.Hunks[0].Applies || f.Hunks[1].Applies || f.Hunks[1].Reason != ReasonContextMismatch {
+		t.Fatalf("hunks = %+v", f.Hunks)
+	}
+	if f.Hunks[1].OldStart != 13 || f.Hunks[1].OldLines != 7 {
+		t.Fatalf("hunk range = %+v", f.Hunks[1])
+	}
+	if text := rep.Text(); !strings.Contains(text, "conflict at line 16") || !strings.Contains(text, "hunk 2") {
+		t.Fatalf("text = %s", text)
+	}
+}
+
+func TestApplyMissingFile(t *testing.T) {
+	repo := testRepo(t, map[string]string{"gone.txt": lines(5, nil), "keep.txt": "keep\n"})
+	patch := diffOf(t, repo, func() {
+		writeFile(t, repo, "gone.txt", lines(5, map[int]string{2: "patched"}))
+	})
+	mustGit(t, repo, "rm", "-q", "gone.txt")
+	mustGit(t, repo, "commit", "-qm", "remove")
+
+	rep, err := Apply(context.Background(), repo, patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.Applied || len(rep.Files) != 1 {
+		t.Fatalf("report = %+v", rep)
+	}
+	if f := rep.Files[0]; f.Result != ResultRejected || f.Reason != ReasonMissingFile {
+		t.Fatalf("file = %+v", f)
+	}
+}
+
+func TestApplyMalformed(t *testing.T) {
+	repo := testRepo(t, map[string]string{"f.txt": "a\n"})
+	rep, err := Apply(context.Background(), repo, []byte("not a patch"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.Applied || len(rep.Files) != 0 || !strings.Contains(rep.Summary, "no file changes") {
+		t.Fatalf("report = %+v", rep)
+	}
+}
@@ -0,0 +1,76 @@
+package patches
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// section is the raw text of one file of a patch: its header lines (for a
+// binary patch, the whole section) and its hunks.
+type section struct {
+	header string
+	hunks  []string
+}
+
+func (s section) text() string { return s.header + strings.Join(s.hunks, "") }
+
+// withHunk is the section reduced to its header and hunk i.
+func (s section) withHunk(i int) string { return s.header + s.hunks[i] }
+
+var hunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// split cuts a patch into file sections. Hunks end at the next hunk or file
+// header rather than by their line counts, which patches written by models
+// often get wrong (they are applied with --recount).
+func split(patch string) []section {
+	lines := strings.SplitAfter(patch, "\n")
+	var out []section
+	var cur *section
+	inHunk := false
+	for i, line := range lines {
+		if line == "" {
+			continue
+		}
+		// A "---"/"+++" pair opens a plain diff's file unless it belongs to
+		// the header of a git diff's.
+		gitHeader := cur != nil && strings.HasPrefix(cur.header, "diff --git ") && len(cur.hunks) == 0
+		startsFile := strings.HasPrefix(line, "diff --git ") ||
+			(strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ ") && !gitHeader)
+		switch {
+		case startsFile:
+			out = append(out, section{header: line})
+			cur = &out[len(out)-1]
+			inHunk = false
+		case cur == nil:
+			// Text before the first file header (a commit message) is ignored.
+		case strings.HasPrefix(line, "@@ "):
+			cur.hunks = append(cur.hunks, line)
+			inHunk = true
+		case inHunk:
+			cur.hunks[len(cur.hunks)-1] += line
+		default:
+			cur.header += line
+		}
+	}
+	return out
+}
+
+// hunkRange parses a hunk's "@@ -a,b +c,d @@" line.
+func hunkRange(hunk string) (header string, oldStart, oldLines, newStart, newLines int) {
+	header, _, _ = strings.Cut(hunk, "\n")
+	m := hunkHeader.FindStringSubmatch(header)
+	if m == nil {
+		return header, 0, 0, 0, 0
+	}
+	count := func(s string) int {
+		if s == "" {
+			return 1
+		}
+		n, _ := strconv.Atoi(s)
+		return n
+	}
+	oldStart, _ = strconv.Atoi(m[1])
+	newStart, _ = strconv.Atoi(m[3])
+	return header, oldStart, count(m[2]), newStart, count(m[4])
+}
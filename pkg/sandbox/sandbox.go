@@ -0,0 +1,316 @@
+// Package sandbox runs a job's shell commands under resource limits, in a
+// scrubbed environment and optionally without network. The console's local
+// backend and the runner both run step commands through it.
+package sandbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var ErrInvalid = errors.New("invalid sandbox config")
+
+// ErrNoNetworkIsolation fails a command of a step with network: false on a
+// host that cannot create unprivileged user and network namespaces; such a
+// command is not run with network instead.
+var ErrNoNetworkIsolation = errors.New("network isolation is unavailable on this host")
+
+// isolationAvailable probes the host for network isolation; tests replace it.
+var isolationAvailable = networkIsolationAvailable
+
+// Limits a sandboxed command can hit, recorded in CommandReport.LimitHit and
+// the job output's limit_hit.
+const (
+	LimitTimeout   = "timeout"
+	LimitCPU       = "cpu"
+	LimitMemory    = "memory"
+	LimitOpenFiles = "open_files"
+)
+
+// Config limits each command a job runs. It is read from the "sandbox" key
+// of the step template config; step run input cannot change it. Zero limits
+// fall back to Default and a negative value means unlimited.
+type Config struct {
+	CPUSeconds     int               `json:"cpu_seconds"`
+	MemoryMB       int               `json:"memory_mb"`
+	OpenFiles      int               `json:"open_files"`
+	TimeoutSeconds int               `json:"timeout_seconds"`
+	Network        *bool             `json:"network,omitempty"`
+	Env            map[string]string `json:"env,omitempty"`
+}
+
+// Default applies to steps that do not configure a limit.
+var Default = Config{CPUSeconds: 900, MemoryMB: 4096, OpenFiles: 4096, TimeoutSeconds: 1800}
+
+// FromStepConfig reads the sandbox of a step template config and fills in defaults.
+func FromStepConfig(cfg map[string]any) (Config, error) {
+	sb := Config{}
+	if raw, ok := cfg["sandbox"]; ok && raw != nil {
+		data, err := json.Marshal(raw)
+		if err != nil {
+			return sb, fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+		if err := json.Unmarshal(data, &sb); err != nil {
+			return sb, fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+	}
+	for name, value := range sb.Env {
+		if name == "" || strings.ContainsAny(name, "=\x00") || strings.Contains(value, "\x00") {
+			return sb, fmt.Errorf("%w: bad env var %q", ErrInvalid, name)
+		}
+	}
+	sb.CPUSeconds = withDefault(sb.CPUSeconds, Default.CPUSeconds)
+	sb.MemoryMB = withDefault(sb.MemoryMB, Default.MemoryMB)
+	sb.OpenFiles = withDefault(sb.OpenFiles, Default.OpenFiles)
+	sb.TimeoutSeconds = withDefault(sb.TimeoutSeconds, Default.TimeoutSeconds)
+	return sb, nil
+}
+
+// ValidateStepConfig checks the sandbox section of a step template config_json.
+func ValidateStepConfig(configJSON string) error {
+	if strings.TrimSpace(configJSON) == "" {
+		return nil
+	}
+	cfg := map[string]any{}
+	if err := json.Unmarshal([]byte(configJSON), &cfg); err != nil {
+		return fmt.Errorf("%w: config_json: %v", ErrInvalid, err)
+	}
+	_, err := FromStepConfig(cfg)
+	return err
+}
+
+func withDefault(v, def int) int {
+	if v == 0 {
+		return def
+	}
+	return v
+}
+
+// NetworkDisabled reports whether the step asked to run without network access.
+func (sb Config) NetworkDisabled() bool { return sb.Network != nil && !*sb.Network }
+
+// CommandReport records one executed shell command.
+type CommandReport struct {
+	Phase           string `json:"phase"`
+	Command         string `json:"command"`
+	ExitCode        int    `json:"exit_code"`
+	DurationMS      int64  `json:"duration_ms"`
+	LimitHit        string `json:"limit_hit,omitempty"`
+	NetworkIsolated bool   `json:"network_isolated,omitempty"`
+}
+
+// result describes how a sandboxed command ended.
+type result struct {
+	ExitCode        int
+	LimitHit        string
+	NetworkIsolated bool
+}
+
+// Shell runs one job's commands under its sandbox, sharing a temporary HOME
+// and a scrubbed environment: only PATH, HOME, TMPDIR, LANG, the BB_* job
+// identifiers and the step's own env entries are passed to commands.
+type Shell struct {
+	config Config
+	home   string
+	vars   []string
+	guards []Guard
+}
+
+// Guard checks what a command did outside its output. Before runs before
+// each command and After once it ended; an error from either fails the
+// command, and Before's keeps it from running.
+type Guard interface {
+	Before(ctx context.Context) error
+	After(ctx context.Context) error
+}
+
+// NewShell prepares the job environment; Close removes it.
+func NewShell(jobID, workflowRunID, stepRunID string, sb Config) (*Shell, error) {
+	home, err := os.MkdirTemp("", "bb-home-")
+	if err != nil {
+		return nil, err
+	}
+	tmp := filepath.Join(home, "tmp")
+	if err := os.Mkdir(tmp, 0700); err != nil {
+		os.RemoveAll(home)
+		return nil, err
+	}
+	path := os.Getenv("PATH")
+	if path == "" {
+		path = "/usr/local/bin:/usr/bin:/bin"
+	}
+	vars := []string{
+		"PATH=" + path,
+		"HOME=" + home,
+		"TMPDIR=" + tmp,
+		"LANG=C.UTF-8",
+		"BB_JOB_ID=" + jobID,
+		"BB_WORKFLOW_RUN_ID=" + workflowRunID,
+		"BB_STEP_RUN_ID=" + stepRunID,
+	}
+	for k, v := range sb.Env {
+		vars = append(vars, k+"="+v)
+	}
+	return &Shell{config: sb, home: home, vars: vars}, nil
+}
+
+func (s *Shell) Config() Config { return s.config }
+
+// Home is the job's temporary HOME, removed by Close.
+func (s *Shell) Home() string { return s.home }
+
+// AddEnv passes vars to every later command. They come after the step's own
+// env entries, so the step cannot override them.
+func (s *Shell) AddEnv(vars ...string) { s.vars = append(s.vars, vars...) }
+
+// AddGuard runs g around every later command.
+func (s *Shell) AddGuard(g Guard) { s.guards = append(s.guards, g) }
+
+func (s *Shell) Close() { os.RemoveAll(s.home) }
+
+// Run executes command in dir, echoing it and its output to out, and reports
+// how it ended. A failed command also writes its exit code and any limit hit.
+func (s *Shell) Run(ctx context.Context, phase, command, dir string, out io.Writer) (CommandReport, error) {
+	fmt.Fprintf(out, "$ %s\n", command)
+	if s.config.NetworkDisabled() && !isolationAvailable() {
+		io.WriteString(out, "!! network isolation unavailable on this host; not running a command that must run without network\n")
+		return CommandReport{Phase: phase, Command: command, ExitCode: -1}, fmt.Errorf("%s: %w", command, ErrNoNetworkIsolation)
+	}
+	for _, g := range s.guards {
+		if err := g.Before(ctx); err != nil {
+			fmt.Fprintf(out, "!! %v\n", err)
+			return CommandReport{Phase: phase, Command: command, ExitCode: -1}, fmt.Errorf("%s: %w", command, err)
+		}
+	}
+	start := time.Now()
+	res, err := run(ctx, s.config, s.vars, command, dir, out)
+	for _, g := range s.guards {
+		// A guard's error takes the place of the command's own, which is
+		// already in its output.
+		if gerr := g.After(ctx); gerr != nil {
+			fmt.Fprintf(out, "!! %v\n", gerr)
+			if res.ExitCode == 0 {
+				res.ExitCode = -1
+			}
+			err = gerr
+		}
+	}
+	report := CommandReport{
+		Phase:           phase,
+		Command:         command,
+		ExitCode:        res.ExitCode,
+		DurationMS:      time.Since(start).Milliseconds(),
+		LimitHit:        res.LimitHit,
+		NetworkIsolated: res.NetworkIsolated,
+	}
+	if err != nil {
+		if res.LimitHit != "" {
+			fmt.Fprintf(out, "!! %s limit hit\n", res.LimitHit)
+		}
+		fmt.Fprintf(out, "exit code: %d\n", report.ExitCode)
+		return report, fmt.Errorf("%s: %w", command, err)
+	}
+	return report, nil
+}
+
+// ulimitScript wraps command so the shell sets rlimits before exec'ing it;
+// limits set this way apply to every process the command starts.
+func ulimitScript(sb Config) string {
+	var b strings.Builder
+	if sb.CPUSeconds > 0 {
+		// The soft limit delivers SIGXCPU so the cause is visible; the hard
+		// limit a few seconds later kills commands that ignore it.
+		fmt.Fprintf(&b, "ulimit -S -t %d && ulimit -H -t %d || exit 125; ", sb.CPUSeconds, sb.CPUSeconds+cpuGraceSeconds)
+	}
+	if sb.MemoryMB > 0 {
+		fmt.Fprintf(&b, "ulimit -v %d || exit 125; ", sb.MemoryMB*1024)
+	}
+	if sb.OpenFiles > 0 {
+		fmt.Fprintf(&b, "ulimit -n %d || exit 125; ", sb.OpenFiles)
+	}
+	b.WriteString(`exec sh -c "$1"`)
+	return b.String()
+}
+
+const cpuGraceSeconds = 5
+
+var (
+	memoryExhausted = regexp.MustCompile(`(?i)cannot allocate memory|out of memory|memoryerror|bad_alloc|failed to reserve`)
+	filesExhausted  = regexp.MustCompile(`(?i)too many open files`)
+)
+
+// run runs command with sh in dir under sb. Output goes to out. The
+// wall-clock timeout kills the command's whole process group.
+func run(ctx context.Context, sb Config, env []string, command, dir string, out io.Writer) (result, error) {
+	res := result{ExitCode: -1}
+	runCtx := ctx
+	if sb.TimeoutSeconds > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, time.Duration(sb.TimeoutSeconds)*time.Second)
+		defer cancel()
+	}
+	tail := &tailWriter{limit: 4096}
+	cmd := exec.CommandContext(runCtx, "sh", "-c", ulimitScript(sb), "bb-sandbox", command)
+	cmd.Dir = dir
+	cmd.Env = env
+	cmd.Stdout = io.MultiWriter(out, tail)
+	cmd.Stderr = cmd.Stdout
+	cmd.WaitDelay = 5 * time.Second
+	res.NetworkIsolated = sb.NetworkDisabled() && isolationAvailable()
+	cmd.SysProcAttr = sandboxAttrs(res.NetworkIsolated)
+	cmd.Cancel = func() error { return killProcessGroup(cmd) }
+
+	err := cmd.Run()
+	if cmd.ProcessState != nil {
+		res.ExitCode = cmd.ProcessState.ExitCode()
+	}
+	if err == nil {
+		return res, nil
+	}
+	switch {
+	case errors.Is(runCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil:
+		res.LimitHit = LimitTimeout
+	case cmd.ProcessState != nil && sb.CPUSeconds > 0 && cpuLimitHit(cmd.ProcessState, sb.CPUSeconds):
+		res.LimitHit = LimitCPU
+	case sb.MemoryMB > 0 && memoryExhausted.MatchString(tail.String()):
+		res.LimitHit = LimitMemory
+	case sb.OpenFiles > 0 && filesExhausted.MatchString(tail.String()):
+		res.LimitHit = LimitOpenFiles
+	}
+	return res, err
+}
+
+// cpuLimitHit reports whether the process died from RLIMIT_CPU: the shell or
+// its command was killed by SIGXCPU, or it used up the whole CPU budget.
+func cpuLimitHit(state *os.ProcessState, cpuSeconds int) bool {
+	if killedBySIGXCPU(state) {
+		return true
+	}
+	used := state.UserTime() + state.SystemTime()
+	return used >= time.Duration(cpuSeconds)*time.Second
+}
+
+// tailWriter keeps the last limit bytes written to it.
+type tailWriter struct {
+	limit int
+	buf   []byte
+}
+
+func (t *tailWriter) Write(p []byte) (int, error) {
+	t.buf = append(t.buf, p...)
+	if len(t.buf) > t.limit {
+		t.buf = t.buf[len(t.buf)-t.limit:]
+	}
+	return len(p), nil
+}
+
+func (t *tailWriter) String() string { return string(t.buf) }
@@ -0,0 +1,55 @@
+package sandbox
+
+import (
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+)
+
+// sandboxAttrs starts the command in its own process group and, when
+// isolated, in new user and network namespaces that only have loopback.
+func sandboxAttrs(isolateNetwork bool) *syscall.SysProcAttr {
+	attrs := &syscall.SysProcAttr{Setpgid: true}
+	if isolateNetwork {
+		attrs.Cloneflags = syscall.CLONE_NEWUSER | syscall.CLONE_NEWNET
+		attrs.UidMappings = []syscall.SysProcIDMap{{ContainerID: os.Getuid(), HostID: os.Getuid(), Size: 1}}
+		attrs.GidMappings = []syscall.SysProcIDMap{{ContainerID: os.Getgid(), HostID: os.Getgid(), Size: 1}}
+	}
+	return attrs
+}
+
+func killProcessGroup(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
+
+func killedBySIGXCPU(state *os.ProcessState) bool {
+	ws, ok := state.Sys().(syscall.WaitStatus)
+	if !ok {
+		return false
+	}
+	if ws.Signaled() {
+		return ws.Signal() == syscall.SIGXCPU
+	}
+	// sh reports a child killed by a signal as exit status 128+signal.
+	return ws.ExitStatus() == 128+int(syscall.SIGXCPU)
+}
+
+var (
+	netnsOnce      sync.Once
+	netnsAvailable bool
+)
+
+// networkIsolationAvailable probes once whether unprivileged user and network
+// namespaces can be created on this host.
+func networkIsolationAvailable() bool {
+	netnsOnce.Do(func() {
+		cmd := exec.Command("true")
+		cmd.SysProcAttr = sandboxAttrs(true)
+		netnsAvailable = cmd.Run() == nil
+	})
+	return netnsAvailable
+}
@@ -0,0 +1,24 @@
+//go:build !linux
+
+package sandbox
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// Process groups and namespaces are only used on Linux; elsewhere the timeout
+// kills the shell alone and network isolation is unavailable.
+func sandboxAttrs(isolateNetwork bool) *syscall.SysProcAttr { return nil }
+
+func killProcessGroup(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	return cmd.Process.Kill()
+}
+
+func killedBySIGXCPU(state *os.ProcessState) bool { return false }
+
+func networkIsolationAvailable() bool { return false }
@@ -0,0 +1,133 @@
+package sandbox
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testShell(t *testing.T, cfg map[string]any) *Shell {
+	t.Helper()
+	sb, err := FromStepConfig(map[string]any{"sandbox": cfg})
+	if err != nil {
+		t.Fatalf("sandbox: %v", err)
+	}
+	s, err := NewShell("job-1", "run-1", "step-1", sb)
+	if err != nil {
+		t.Fatalf("job env: %v", err)
+	}
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestSandboxScrubsEnvAndAppliesRlimits(t *testing.T) {
+	t.Setenv("BB_TEST_SECRET", "leak")
+	s := testShell(t, map[string]any{"open_files": 64, "memory_mb": 1024, "env": map[string]any{"GOFLAGS": "-mod=mod"}})
+	var out bytes.Buffer
+	script := `echo "home=$HOME secret=$BB_TEST_SECRET goflags=$GOFLAGS job=$BB_JOB_ID"; echo "nofile=$(ulimit -n) vmem=$(ulimit -v)"`
+	if _, err := run(context.Background(), s.config, s.vars, script, t.TempDir(), &out); err != nil {
+		t.Fatalf("run: %v (%s)", err, out.String())
+	}
+	got := out.String()
+	for _, want := range []string{"home=" + s.home + " ", "secret= ", "goflags=-mod=mod", "job=job-1", "nofile=64", "vmem=1048576"} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("expected %q in output:\n%s", want, got)
+		}
+	}
+}
+
+func TestSandboxTimeoutKillsProcessGroup(t *testing.T) {
+	s := testShell(t, map[string]any{"timeout_seconds": 1})
+	var out bytes.Buffer
+	start := time.Now()
+	res, err := run(context.Background(), s.config, s.vars, "sleep 30 & sleep 30", t.TempDir(), &out)
+	if err == nil || res.LimitHit != LimitTimeout {
+		t.Fatalf("expected timeout, got limit=%q err=%v", res.LimitHit, err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Fatalf("background child kept the command alive for %s", elapsed)
+	}
+}
+
+func TestSandboxRecordsCPULimit(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("rlimit signals are checked on linux")
+	}
+	s := testShell(t, map[string]any{"cpu_seconds": 1, "timeout_seconds": 20})
+	var out bytes.Buffer
+	res, err := run(context.Background(), s.config, s.vars, "while :; do :; done", t.TempDir(), &out)
+	if err == nil || res.LimitHit != LimitCPU {
+		t.Fatalf("expected cpu limit, got limit=%q err=%v", res.LimitHit, err)
+	}
+}
+
+func TestSandboxNetworkOff(t *testing.T) {
+	if !networkIsolationAvailable() {
+		t.Skip("user and network namespaces unavailable")
+	}
+	s := testShell(t, map[string]any{"network": false})
+	var out bytes.Buffer
+	res, err := run(context.Background(), s.config, s.vars, "tail -n +3 /proc/net/dev | cut -d: -f1 | tr -d ' '", t.TempDir(), &out)
+	if err != nil || !res.NetworkIsolated {
+		t.Fatalf("run: isolated=%v err=%v", res.NetworkIsolated, err)
+	}
+	if strings.TrimSpace(out.String()) != "lo" {
+		t.Fatalf("expected only loopback in isolated namespace, got %q", out.String())
+	}
+}
+
+func TestSandboxNetworkOffFailsWithoutIsolation(t *testing.T) {
+	available := isolationAvailable
+	isolationAvailable = func() bool { return false }
+	t.Cleanup(func() { isolationAvailable = available })
+	s := testShell(t, map[string]any{"network": false})
+	var out bytes.Buffer
+	report, err := s.Run(context.Background(), "command", "echo ran", t.TempDir(), &out)
+	if !errors.Is(err, ErrNoNetworkIsolation) || report.ExitCode != -1 || strings.Contains(out.String(), "\nran\n") {
+		t.Fatalf("expected the command refused, got %+v %v:\n%s", report, err, out.String())
+	}
+}
+
+type testGuard struct {
+	before, after error
+	calls         []string
+}
+
+func (g *testGuard) Before(context.Context) error {
+	g.calls = append(g.calls, "before")
+	return g.before
+}
+
+func (g *testGuard) After(context.Context) error {
+	g.calls = append(g.calls, "after")
+	return g.after
+}
+
+func TestSandboxRunsGuardsAroundCommands(t *testing.T) {
+	s := testShell(t, nil)
+	g := &testGuard{}
+	s.AddGuard(g)
+	if _, err := s.Run(context.Background(), "command", "true", t.TempDir(), &bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+
+	refused := errors.New("branch moved")
+	g.after = refused
+	report, err := s.Run(context.Background(), "command", "true", t.TempDir(), &bytes.Buffer{})
+	if !errors.Is(err, refused) || report.ExitCode != -1 {
+		t.Fatalf("expected the guard to fail the command, got %+v %v", report, err)
+	}
+
+	g.before = refused
+	var out bytes.Buffer
+	if _, err := s.Run(context.Background(), "command", "echo ran", t.TempDir(), &out); !errors.Is(err, refused) || strings.Contains(out.String(), "\nran\n") {
+		t.Fatalf("expected the command not to run, got %v:\n%s", err, out.String())
+	}
+	if got := strings.Join(g.calls, " "); got != "before after before after before" {
+		t.Fatalf("guard calls = %s", got)
+	}
+}